@@ -0,0 +1,33 @@
+package lungo
+
+import "github.com/256dpi/lungo/mongokit"
+
+// RegisterAccumulator will register the function accumulator under the
+// specified name. An $accumulator operator of a $group stage uses the function
+// accumulator that is registered under the value of its "accumulate" field.
+// The name may be the JavaScript source of the accumulate function to support
+// existing pipelines without changes.
+func (e *Engine) RegisterAccumulator(name string, fn mongokit.FunctionAccumulator) {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// copy functions
+	functions := make(map[string]mongokit.FunctionAccumulator, len(e.functions)+1)
+	for key, value := range e.functions {
+		functions[key] = value
+	}
+
+	// set function
+	functions[name] = fn
+	e.functions = functions
+}
+
+func (e *Engine) accumulators() map[string]mongokit.FunctionAccumulator {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// the map is replaced on every registration and may therefore be shared
+	return e.functions
+}
@@ -0,0 +1,69 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/mongokit"
+)
+
+func TestEngineRegisterAccumulator(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	accumulate := "function(state, tag) { state.push(tag); return state }"
+	engine.RegisterAccumulator(accumulate, mongokit.FunctionAccumulator{
+		Init: func(args bson.A) (interface{}, error) {
+			return bson.A{}, nil
+		},
+		Accumulate: func(state interface{}, args bson.A) (interface{}, error) {
+			return append(state.(bson.A), args[0]), nil
+		},
+		Finalize: func(state interface{}) (interface{}, error) {
+			return int32(len(state.(bson.A))), nil
+		},
+	})
+
+	coll := client.Database("test").Collection("foo")
+	_, err = coll.InsertMany(nil, bson.A{
+		bson.M{"kind": "a", "tag": "x"},
+		bson.M{"kind": "b", "tag": "y"},
+		bson.M{"kind": "a", "tag": "z"},
+	})
+	assert.NoError(t, err)
+
+	csr, err := coll.Aggregate(nil, bson.A{
+		bson.M{"$group": bson.M{
+			"_id": "$kind",
+			"tags": bson.M{"$accumulator": bson.M{
+				"init":           "function() { return [] }",
+				"accumulate":     accumulate,
+				"accumulateArgs": bson.A{"$tag"},
+				"merge":          "function(a, b) { return a.concat(b) }",
+				"lang":           "js",
+			}},
+		}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": "a", "tags": int32(2)},
+		{"_id": "b", "tags": int32(1)},
+	}, readAll(csr))
+
+	_, err = coll.Aggregate(nil, bson.A{
+		bson.M{"$group": bson.M{
+			"_id": nil,
+			"tags": bson.M{"$accumulator": bson.M{
+				"accumulate":     "missing",
+				"accumulateArgs": bson.A{"$tag"},
+			}},
+		}},
+	})
+	assert.Error(t, err)
+}
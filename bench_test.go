@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func BenchmarkMemoryStoreWrite(b *testing.B) {
@@ -42,6 +44,47 @@ func BenchmarkMemoryStoreWrite(b *testing.B) {
 	}
 }
 
+func BenchmarkMemoryStoreInsertMany(b *testing.B) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("foo")
+
+	_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys: bson.M{"n": 1},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	docs := make([]interface{}, 1000)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for j := range docs {
+			docs[j] = bson.M{"n": rand.Int()}
+		}
+
+		_, err = coll.InsertMany(nil, docs)
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = coll.DeleteMany(nil, bson.M{})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
 func BenchmarkMemoryStoreRead(b *testing.B) {
 	client, engine, err := Open(nil, Options{
 		Store: NewMemoryStore(),
@@ -76,6 +119,50 @@ func BenchmarkMemoryStoreRead(b *testing.B) {
 	}
 }
 
+func BenchmarkMemoryStoreReadSortedProjection(b *testing.B) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("foo")
+
+	for i := 0; i < 1000; i++ {
+		_, err = coll.InsertOne(nil, bson.M{
+			"n": rand.Intn(1000),
+			"m": i,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	opts := options.Find().SetSort(bson.M{"n": 1}).SetProjection(bson.M{"m": 1})
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		csr, err := coll.Find(nil, bson.M{
+			"n": bson.M{
+				"$gte": rand.Intn(1000),
+			},
+		}, opts)
+		if err != nil {
+			panic(err)
+		}
+
+		err = csr.Close(nil)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
 func BenchmarkSingleFileStoreWrite(b *testing.B) {
 	_ = os.Remove("./bench.bson")
 
@@ -0,0 +1,225 @@
+package benchmarks
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo"
+)
+
+func open(tb testing.TB) (lungo.ICollection, func()) {
+	client, engine, err := lungo.Open(nil, lungo.Options{
+		Store: lungo.NewMemoryStore(),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return client.Database("bench").Collection("bench"), engine.Close
+}
+
+func TestWorkloads(t *testing.T) {
+	for _, workload := range []Workload{WorkloadA, WorkloadB, WorkloadC, WorkloadE, WorkloadF} {
+		t.Run(workload.Name, func(t *testing.T) {
+			coll, done := open(t)
+			defer done()
+
+			workload.Records = 100
+			rng := rand.New(rand.NewSource(1))
+
+			err := workload.Load(coll, rng)
+			assert.NoError(t, err)
+
+			runner := NewRunner(workload, coll, rng)
+			for i := 0; i < 100; i++ {
+				err = runner.Step()
+				assert.NoError(t, err)
+			}
+
+			n, err := coll.CountDocuments(nil, bson.M{})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(runner.records), n)
+		})
+	}
+}
+
+func BenchmarkYCSB(b *testing.B) {
+	for _, workload := range []Workload{WorkloadA, WorkloadB, WorkloadC, WorkloadE, WorkloadF} {
+		b.Run(workload.Name, func(b *testing.B) {
+			coll, done := open(b)
+			defer done()
+
+			rng := rand.New(rand.NewSource(1))
+
+			err := workload.Load(coll, rng)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			runner := NewRunner(workload, coll, rng)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				err = runner.Step()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	for _, indexed := range []bool{false, true} {
+		name := "Scan"
+		if indexed {
+			name = "Index"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			coll, done := open(b)
+			defer done()
+
+			if indexed {
+				_, err := coll.Indexes().CreateOne(nil, mongo.IndexModel{
+					Keys: bson.M{"group": 1},
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			docs := make([]interface{}, 10000)
+			for i := range docs {
+				docs[i] = bson.M{"group": i % 1000, "value": i}
+			}
+			_, err := coll.InsertMany(nil, docs)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				csr, err := coll.Find(nil, bson.M{"group": i % 1000})
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				var res []bson.M
+				err = csr.All(nil, &res)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSort(b *testing.B) {
+	for _, indexed := range []bool{false, true} {
+		name := "Scan"
+		if indexed {
+			name = "Index"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			coll, done := open(b)
+			defer done()
+
+			if indexed {
+				_, err := coll.Indexes().CreateOne(nil, mongo.IndexModel{
+					Keys: bson.D{{Key: "created", Value: -1}},
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			docs := make([]interface{}, 10000)
+			for i := range docs {
+				docs[i] = bson.M{"created": i, "value": i}
+			}
+			_, err := coll.InsertMany(nil, docs)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				csr, err := coll.Find(nil, bson.M{}, options.Find().
+					SetSort(bson.M{"created": -1}).
+					SetSkip(int64(i%10)*20).
+					SetLimit(20))
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				var res []bson.M
+				err = csr.All(nil, &res)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLargeDocuments(b *testing.B) {
+	workload := Workload{
+		Records:   100,
+		Fields:    10,
+		FieldSize: 100 * 1024,
+	}
+
+	b.Run("Insert", func(b *testing.B) {
+		coll, done := open(b)
+		defer done()
+
+		rng := rand.New(rand.NewSource(1))
+		record := workload.Record("", rng)
+
+		b.ResetTimer()
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			record[0].Value = Key(i)
+			_, err := coll.InsertOne(nil, record)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Read", func(b *testing.B) {
+		coll, done := open(b)
+		defer done()
+
+		rng := rand.New(rand.NewSource(1))
+		err := workload.Load(coll, rng)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ResetTimer()
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			var record bson.D
+			err = coll.FindOne(nil, bson.M{"_id": Key(i % workload.Records)}).Decode(&record)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
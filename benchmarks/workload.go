@@ -0,0 +1,259 @@
+// Package benchmarks provides realistic workloads to measure the performance
+// of the lungo engine. The workloads are run by the benchmarks of this package
+// and can be compared against a baseline using "make bench-compare".
+package benchmarks
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo"
+)
+
+// Mix defines the relative weights of the operations of a workload.
+type Mix struct {
+	Read            int
+	Update          int
+	Insert          int
+	Scan            int
+	ReadModifyWrite int
+}
+
+// Workload describes a YCSB-like workload of records that are identified by
+// a key and consist of a number of string fields.
+type Workload struct {
+	// The name of the workload.
+	Name string
+
+	// The mix of operations.
+	Mix Mix
+
+	// The number of records loaded before the workload is run.
+	Records int
+
+	// The number of fields and the size of every field in bytes.
+	Fields    int
+	FieldSize int
+
+	// The maximum number of records returned by a scan.
+	ScanLength int
+}
+
+// The standard YCSB workloads. Workload D is omitted as it requires a latest
+// distribution of keys that is not meaningful for an in-process engine.
+var (
+	// WorkloadA is an update heavy workload.
+	WorkloadA = Workload{Name: "A", Mix: Mix{Read: 50, Update: 50}}
+
+	// WorkloadB is a read mostly workload.
+	WorkloadB = Workload{Name: "B", Mix: Mix{Read: 95, Update: 5}}
+
+	// WorkloadC is a read only workload.
+	WorkloadC = Workload{Name: "C", Mix: Mix{Read: 100}}
+
+	// WorkloadE is a workload of short ranges.
+	WorkloadE = Workload{Name: "E", Mix: Mix{Scan: 95, Insert: 5}}
+
+	// WorkloadF is a read-modify-write workload.
+	WorkloadF = Workload{Name: "F", Mix: Mix{Read: 50, ReadModifyWrite: 50}}
+)
+
+func (w Workload) defaults() Workload {
+	// set default values
+	if w.Records == 0 {
+		w.Records = 1000
+	}
+	if w.Fields == 0 {
+		w.Fields = 10
+	}
+	if w.FieldSize == 0 {
+		w.FieldSize = 100
+	}
+	if w.ScanLength == 0 {
+		w.ScanLength = 100
+	}
+
+	return w
+}
+
+// Key returns the key of the record with the specified number.
+func Key(n int) string {
+	return fmt.Sprintf("user%010d", n)
+}
+
+// Record returns a record with the specified key and random field values.
+func (w Workload) Record(key string, rng *rand.Rand) bson.D {
+	// get defaults
+	w = w.defaults()
+
+	// prepare record
+	record := make(bson.D, 0, w.Fields+1)
+	record = append(record, bson.E{Key: "_id", Value: key})
+	for i := 0; i < w.Fields; i++ {
+		record = append(record, bson.E{Key: fmt.Sprintf("field%d", i), Value: randomString(rng, w.FieldSize)})
+	}
+
+	return record
+}
+
+// Load will insert the initial records of the workload.
+func (w Workload) Load(coll lungo.ICollection, rng *rand.Rand) error {
+	// get defaults
+	w = w.defaults()
+
+	// insert records in batches
+	batch := make([]interface{}, 0, 1000)
+	for i := 0; i < w.Records; i++ {
+		batch = append(batch, w.Record(Key(i), rng))
+		if len(batch) == cap(batch) || i == w.Records-1 {
+			_, err := coll.InsertMany(nil, batch)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	return nil
+}
+
+// Runner runs the operations of a loaded workload.
+type Runner struct {
+	workload Workload
+	coll     lungo.ICollection
+	rng      *rand.Rand
+	records  int
+}
+
+// NewRunner creates and returns a new runner for a loaded workload.
+func NewRunner(workload Workload, coll lungo.ICollection, rng *rand.Rand) *Runner {
+	// get defaults
+	workload = workload.defaults()
+
+	return &Runner{
+		workload: workload,
+		coll:     coll,
+		rng:      rng,
+		records:  workload.Records,
+	}
+}
+
+// Step will run a single randomly chosen operation.
+func (r *Runner) Step() error {
+	// choose operation
+	mix := r.workload.Mix
+	total := mix.Read + mix.Update + mix.Insert + mix.Scan + mix.ReadModifyWrite
+	if total <= 0 {
+		return fmt.Errorf("empty operation mix")
+	}
+	n := r.rng.Intn(total)
+
+	// run operation
+	switch {
+	case n < mix.Read:
+		return r.read()
+	case n < mix.Read+mix.Update:
+		return r.update()
+	case n < mix.Read+mix.Update+mix.Insert:
+		return r.insert()
+	case n < mix.Read+mix.Update+mix.Insert+mix.Scan:
+		return r.scan()
+	default:
+		return r.readModifyWrite()
+	}
+}
+
+func (r *Runner) key() string {
+	return Key(r.rng.Intn(r.records))
+}
+
+func (r *Runner) field() string {
+	return fmt.Sprintf("field%d", r.rng.Intn(r.workload.Fields))
+}
+
+func (r *Runner) read() error {
+	// find record
+	var record bson.D
+	err := r.coll.FindOne(nil, bson.M{"_id": r.key()}).Decode(&record)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Runner) update() error {
+	// update single field
+	_, err := r.coll.UpdateOne(nil, bson.M{"_id": r.key()}, bson.M{
+		"$set": bson.M{r.field(): randomString(r.rng, r.workload.FieldSize)},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Runner) insert() error {
+	// insert new record
+	_, err := r.coll.InsertOne(nil, r.workload.Record(Key(r.records), r.rng))
+	if err != nil {
+		return err
+	}
+
+	// increment records
+	r.records++
+
+	return nil
+}
+
+func (r *Runner) scan() error {
+	// find range of records
+	limit := int64(r.rng.Intn(r.workload.ScanLength) + 1)
+	csr, err := r.coll.Find(nil, bson.M{"_id": bson.M{"$gte": r.key()}}, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit))
+	if err != nil {
+		return err
+	}
+
+	// decode records
+	var records []bson.D
+	err = csr.All(nil, &records)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Runner) readModifyWrite() error {
+	// read record
+	key := r.key()
+	var record bson.D
+	err := r.coll.FindOne(nil, bson.M{"_id": key}).Decode(&record)
+	if err != nil {
+		return err
+	}
+
+	// write record
+	_, err = r.coll.ReplaceOne(nil, bson.M{"_id": key}, r.workload.Record(key, r.rng))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func randomString(rng *rand.Rand, size int) string {
+	// generate random letters
+	var builder strings.Builder
+	builder.Grow(size)
+	for i := 0; i < size; i++ {
+		builder.WriteByte(byte('a' + rng.Intn(26)))
+	}
+
+	return builder.String()
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"math"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/shopspring/decimal"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,6 +16,17 @@ import (
 // BSON type comparison order specification:
 // https://docs.mongodb.com/manual/reference/bson-type-comparison-order.
 func Compare(lv, rv interface{}) int {
+	return compare(lv, rv, false)
+}
+
+// CompareFold is like Compare but compares strings case-insensitively using
+// simple Unicode case folding, also in nested documents and arrays. It is used
+// to implement collations with a strength of 1 or 2.
+func CompareFold(lv, rv interface{}) int {
+	return compare(lv, rv, true)
+}
+
+func compare(lv, rv interface{}, fold bool) int {
 	// get types
 	lc, _ := Inspect(lv)
 	rc, _ := Inspect(rv)
@@ -32,11 +45,11 @@ func Compare(lv, rv interface{}) int {
 	case Number:
 		return compareNumbers(lv, rv)
 	case String:
-		return compareStrings(lv, rv)
+		return compareStrings(lv, rv, fold)
 	case Document:
-		return compareDocuments(lv, rv)
+		return compareDocuments(lv, rv, fold)
 	case Array:
-		return compareArrays(lv, rv)
+		return compareArrays(lv, rv, fold)
 	case Binary:
 		return compareBinaries(lv, rv)
 	case ObjectID:
@@ -105,18 +118,50 @@ func compareNumbers(lv, rv interface{}) int {
 	panic("bsonkit: unreachable")
 }
 
-func compareStrings(lv, rv interface{}) int {
+func compareStrings(lv, rv interface{}, fold bool) int {
 	// get strings
 	l := lv.(string)
 	r := rv.(string)
 
+	// compare folded strings
+	if fold {
+		return compareFoldedStrings(l, r)
+	}
+
 	// compare strings
 	res := strings.Compare(l, r)
 
 	return res
 }
 
-func compareDocuments(lv, rv interface{}) int {
+func compareFoldedStrings(l, r string) int {
+	// compare lower case runes
+	for l != "" && r != "" {
+		// decode runes
+		lr, ls := utf8.DecodeRuneInString(l)
+		rr, rs := utf8.DecodeRuneInString(r)
+		l, r = l[ls:], r[rs:]
+
+		// compare runes
+		lr, rr = unicode.ToLower(lr), unicode.ToLower(rr)
+		if lr < rr {
+			return -1
+		} else if lr > rr {
+			return 1
+		}
+	}
+
+	// compare remaining length
+	if l == "" && r == "" {
+		return 0
+	} else if l == "" {
+		return -1
+	}
+
+	return 1
+}
+
+func compareDocuments(lv, rv interface{}, fold bool) int {
 	// get documents
 	l := lv.(bson.D)
 	r := rv.(bson.D)
@@ -150,14 +195,14 @@ func compareDocuments(lv, rv interface{}) int {
 		}
 
 		// compare values
-		res = Compare(l[i].Value, r[i].Value)
+		res = compare(l[i].Value, r[i].Value, fold)
 		if res != 0 {
 			return res
 		}
 	}
 }
 
-func compareArrays(lv, rv interface{}) int {
+func compareArrays(lv, rv interface{}, fold bool) int {
 	// get array
 	l := lv.(bson.A)
 	r := rv.(bson.A)
@@ -185,7 +230,7 @@ func compareArrays(lv, rv interface{}) int {
 		}
 
 		// compare elements
-		res := Compare(l[i], r[i])
+		res := compare(l[i], r[i], fold)
 		if res != 0 {
 			return res
 		}
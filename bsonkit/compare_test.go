@@ -23,3 +23,21 @@ func TestCompare(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1, Compare(5.0, dec))
 }
+
+func TestCompareFold(t *testing.T) {
+	// strings
+	assert.Equal(t, 0, CompareFold("Alice", "aLICE"))
+	assert.Equal(t, -1, CompareFold("alice", "Bob"))
+	assert.Equal(t, 1, CompareFold("Bob", "alice"))
+	assert.Equal(t, -1, CompareFold("Al", "alice"))
+	assert.Equal(t, 0, CompareFold("ÄRGER", "ärger"))
+	assert.Equal(t, 1, Compare("alice", "Bob"))
+
+	// nested
+	assert.Equal(t, 0, CompareFold(bson.A{"Foo", bson.D{{Key: "a", Value: "BAR"}}}, bson.A{"foo", bson.D{{Key: "a", Value: "bar"}}}))
+	assert.Equal(t, -1, CompareFold(bson.D{{Key: "A", Value: "x"}}, bson.D{{Key: "a", Value: "x"}}))
+
+	// other types
+	assert.Equal(t, -1, CompareFold("foo", false))
+	assert.Equal(t, 0, CompareFold(int32(1), 1.0))
+}
@@ -3,6 +3,8 @@ package bsonkit
 import (
 	"fmt"
 	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 )
 
 // Decode will decode the specified document to an arbitrary value which may be
@@ -11,16 +13,38 @@ func Decode(doc Doc, out interface{}) error {
 	return Transfer(doc, out)
 }
 
+// DecodeWithRegistry will decode the specified document to an arbitrary value
+// using the specified registry.
+func DecodeWithRegistry(r *bsoncodec.Registry, doc Doc, out interface{}) error {
+	return TransferWithRegistry(r, doc, out)
+}
+
 // DecodeList will decode a list of documents to an arbitrary value.
 func DecodeList(list List, out interface{}) error {
+	return DecodeListWithRegistry(nil, list, out)
+}
+
+// DecodeListWithRegistry will decode a list of documents to an arbitrary value
+// using the specified registry. Like the driver, the value must be a pointer to
+// a slice, which is completely overwritten. Existing elements are reused and
+// slices of pointers e.g. *[]*T are supported.
+func DecodeListWithRegistry(r *bsoncodec.Registry, list List, out interface{}) error {
 	// get out value
 	outValue := reflect.ValueOf(out)
 	if outValue.Kind() != reflect.Ptr {
-		return fmt.Errorf("results argument must be a pointer to a slice")
+		return fmt.Errorf("results argument must be a pointer to a slice, but was a %s", outValue.Kind())
 	}
 
-	// get slice value and item type
+	// get slice value, which may be wrapped in an interface
 	sliceVal := outValue.Elem()
+	if sliceVal.Kind() == reflect.Interface {
+		sliceVal = sliceVal.Elem()
+	}
+	if sliceVal.Kind() != reflect.Slice {
+		return fmt.Errorf("results argument must be a pointer to a slice, but was a pointer to %s", sliceVal.Kind())
+	}
+
+	// get item type
 	itemType := sliceVal.Type().Elem()
 
 	for i, item := range list {
@@ -34,7 +58,7 @@ func DecodeList(list List, out interface{}) error {
 		curItem := sliceVal.Index(i).Addr().Interface()
 
 		// marshal item
-		err := Decode(item, curItem)
+		err := DecodeWithRegistry(r, item, curItem)
 		if err != nil {
 			return err
 		}
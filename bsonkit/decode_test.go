@@ -1,12 +1,39 @@
 package bsonkit
 
 import (
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
 )
 
+type counter int
+
+func counterRegistry() *bsoncodec.Registry {
+	typ := reflect.TypeOf(counter(0))
+	return bson.NewRegistryBuilder().
+		RegisterTypeEncoder(typ, bsoncodec.ValueEncoderFunc(func(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+			return vw.WriteString(strconv.Itoa(int(val.Int())))
+		})).
+		RegisterTypeDecoder(typ, bsoncodec.ValueDecoderFunc(func(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+			str, err := vr.ReadString()
+			if err != nil {
+				return err
+			}
+			num, err := strconv.Atoi(str)
+			if err != nil {
+				return err
+			}
+			val.SetInt(int64(num))
+			return nil
+		})).
+		Build()
+}
+
 func TestDecode(t *testing.T) {
 	type model struct {
 		Title  string
@@ -47,4 +74,67 @@ func TestDecodeList(t *testing.T) {
 			Clicks: 42,
 		},
 	}, list)
+
+	// pointers
+	var ptrs []*model
+	err = DecodeList(List{
+		{bson.E{Key: "title", Value: "Hello"}},
+		{bson.E{Key: "title", Value: "World"}},
+	}, &ptrs)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model{{Title: "Hello"}, {Title: "World"}}, ptrs)
+
+	// overwrite
+	list = []model{{Title: "A"}, {Title: "B"}}
+	err = DecodeList(List{
+		{bson.E{Key: "clicks", Value: 7}},
+	}, &list)
+	assert.NoError(t, err)
+	assert.Equal(t, []model{{Title: "A", Clicks: 7}}, list)
+
+	// interface
+	var iface interface{} = []model{}
+	err = DecodeList(List{
+		{bson.E{Key: "title", Value: "Hello"}},
+	}, &iface)
+	assert.NoError(t, err)
+	assert.Equal(t, []model{{Title: "Hello"}}, iface)
+
+	// empty
+	list = []model{{Title: "A"}}
+	err = DecodeList(List{}, &list)
+	assert.NoError(t, err)
+	assert.Equal(t, []model{}, list)
+
+	// invalid
+	var doc model
+	err = DecodeList(List{}, &doc)
+	assert.Error(t, err)
+	err = DecodeList(List{}, list)
+	assert.Error(t, err)
+}
+
+func TestDecodeWithRegistry(t *testing.T) {
+	type model struct {
+		Count counter
+	}
+
+	var doc model
+	err := DecodeWithRegistry(counterRegistry(), &bson.D{
+		bson.E{Key: "count", Value: "42"},
+	}, &doc)
+	assert.NoError(t, err)
+	assert.Equal(t, model{Count: 42}, doc)
+
+	var list []model
+	err = DecodeListWithRegistry(counterRegistry(), List{
+		{bson.E{Key: "count", Value: "7"}},
+	}, &list)
+	assert.NoError(t, err)
+	assert.Equal(t, []model{{Count: 7}}, list)
+
+	err = Decode(&bson.D{
+		bson.E{Key: "count", Value: "42"},
+	}, &doc)
+	assert.Error(t, err)
 }
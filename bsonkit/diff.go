@@ -0,0 +1,94 @@
+package bsonkit
+
+import (
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Difference describes the changes between two documents.
+type Difference struct {
+	// The added or updated fields with their paths as keys and the new values.
+	Updated bson.D
+
+	// The paths of the removed fields.
+	Removed []string
+}
+
+// Empty returns whether there are no changes.
+func (d *Difference) Empty() bool {
+	return len(d.Updated) == 0 && len(d.Removed) == 0
+}
+
+// Diff will compare the old and new document and return the changes needed
+// to turn the old document into the new document. Embedded documents are
+// compared field by field and arrays of the same length element by element.
+// Other changed values, including arrays with a different length, are
+// reported as a whole.
+func Diff(old, new Doc) *Difference {
+	// prepare difference
+	diff := &Difference{}
+
+	// compare documents
+	diffDocument(diff, "", *old, *new)
+
+	return diff
+}
+
+func diffDocument(diff *Difference, prefix string, old, new bson.D) {
+	// collect updated fields
+	for _, e := range new {
+		// get old value
+		value, ok := lookup(old, e.Key)
+		if !ok {
+			diff.Updated = append(diff.Updated, bson.E{Key: prefix + e.Key, Value: e.Value})
+			continue
+		}
+
+		// compare values
+		diffValue(diff, prefix+e.Key, value, e.Value)
+	}
+
+	// collect removed fields
+	for _, e := range old {
+		if _, ok := lookup(new, e.Key); !ok {
+			diff.Removed = append(diff.Removed, prefix+e.Key)
+		}
+	}
+}
+
+func diffValue(diff *Difference, path string, old, new interface{}) {
+	switch n := new.(type) {
+	case bson.D:
+		if o, ok := old.(bson.D); ok {
+			diffDocument(diff, path+".", o, n)
+			return
+		}
+	case bson.A:
+		if o, ok := old.(bson.A); ok && len(o) == len(n) {
+			for i := range n {
+				diffValue(diff, path+"."+strconv.Itoa(i), o[i], n[i])
+			}
+			return
+		}
+	}
+
+	// get types
+	_, oldType := Inspect(old)
+	_, newType := Inspect(new)
+
+	// check equality, values of different types are never equal
+	if oldType != newType || Compare(old, new) != 0 {
+		diff.Updated = append(diff.Updated, bson.E{Key: path, Value: new})
+	}
+}
+
+func lookup(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+
+	return nil, false
+}
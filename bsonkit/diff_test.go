@@ -0,0 +1,71 @@
+package bsonkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDiff(t *testing.T) {
+	old := &bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "a", Value: "foo"},
+		{Key: "b", Value: int32(1)},
+		{Key: "c", Value: bson.D{
+			{Key: "d", Value: true},
+			{Key: "e", Value: false},
+		}},
+		{Key: "f", Value: bson.A{int32(1), int32(2)}},
+		{Key: "g", Value: bson.A{int32(1)}},
+		{Key: "h", Value: nil},
+	}
+
+	// equal
+	diff := Diff(old, Clone(old))
+	assert.True(t, diff.Empty())
+	assert.Equal(t, &Difference{}, diff)
+
+	// changes
+	diff = Diff(old, &bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "a", Value: "bar"},
+		{Key: "b", Value: int64(1)},
+		{Key: "c", Value: bson.D{
+			{Key: "e", Value: false},
+			{Key: "x", Value: "y"},
+		}},
+		{Key: "f", Value: bson.A{int32(1), int32(3)}},
+		{Key: "g", Value: bson.A{int32(1), int32(2)}},
+		{Key: "i", Value: bson.D{}},
+	})
+	assert.False(t, diff.Empty())
+	assert.Equal(t, &Difference{
+		Updated: bson.D{
+			{Key: "a", Value: "bar"},
+			{Key: "b", Value: int64(1)},
+			{Key: "c.x", Value: "y"},
+			{Key: "f.1", Value: int32(3)},
+			{Key: "g", Value: bson.A{int32(1), int32(2)}},
+			{Key: "i", Value: bson.D{}},
+		},
+		Removed: []string{"c.d", "h"},
+	}, diff)
+
+	// type change
+	diff = Diff(old, &bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "a", Value: bson.D{}},
+		{Key: "b", Value: int32(1)},
+		{Key: "c", Value: "c"},
+		{Key: "f", Value: bson.A{int32(1), int32(2)}},
+		{Key: "g", Value: bson.A{int32(1)}},
+		{Key: "h", Value: nil},
+	})
+	assert.Equal(t, &Difference{
+		Updated: bson.D{
+			{Key: "a", Value: bson.D{}},
+			{Key: "c", Value: "c"},
+		},
+	}, diff)
+}
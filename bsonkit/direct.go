@@ -0,0 +1,518 @@
+package bsonkit
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var objectIDType = reflect.TypeOf(primitive.ObjectID{})
+
+var hookTypes = []reflect.Type{
+	reflect.TypeOf((*bsoncodec.Marshaler)(nil)).Elem(),
+	reflect.TypeOf((*bsoncodec.ValueMarshaler)(nil)).Elem(),
+	reflect.TypeOf((*bsoncodec.Unmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*bsoncodec.ValueUnmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*bsoncodec.Proxy)(nil)).Elem(),
+}
+
+type zeroer interface {
+	IsZero() bool
+}
+
+type structField struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+type structInfo struct {
+	fields []structField
+	names  map[string]int
+}
+
+var structCache sync.Map
+
+// TransformDirect will transform a struct, a pointer to a struct or a map or
+// document into a document. If the registry is absent or the default registry,
+// values that only use types with a known encoding are transformed directly,
+// which avoids the marshalling roundtrip. The result is the same as with
+// TransformWithRegistry, which is used for all other values, except that map
+// keys are sorted.
+func TransformDirect(r *bsoncodec.Registry, v interface{}) (Doc, error) {
+	// transform directly if possible
+	if r == nil || r == bson.DefaultRegistry {
+		if value, ok := encodeDynamic(v); ok {
+			if doc, ok := value.(bson.D); ok {
+				return &doc, nil
+			}
+		}
+	}
+
+	return TransformWithRegistry(r, v)
+}
+
+// DecodeDirect will decode the specified document into a pointer to a struct.
+// Like TransformDirect, the document is decoded directly if the registry is
+// absent or the default registry and the struct and document only use types
+// with a known decoding. Otherwise, DecodeWithRegistry is used.
+func DecodeDirect(r *bsoncodec.Registry, doc Doc, out interface{}) error {
+	// decode directly if possible
+	if (r == nil || r == bson.DefaultRegistry) && doc != nil {
+		value := reflect.ValueOf(out)
+		if value.Kind() == reflect.Ptr && !value.IsNil() && value.Elem().Kind() == reflect.Struct {
+			info := describeStruct(value.Elem().Type())
+			if info != nil {
+				// decode into a new value to keep the output unchanged if the
+				// document cannot be decoded directly
+				res := reflect.New(value.Elem().Type()).Elem()
+				if decodeStruct(info, *doc, res) {
+					value.Elem().Set(res)
+					return nil
+				}
+			}
+		}
+	}
+
+	return DecodeWithRegistry(r, doc, out)
+}
+
+func describeStruct(t reflect.Type) *structInfo {
+	// check cache
+	if info, ok := structCache.Load(t); ok {
+		return info.(*structInfo)
+	}
+
+	// analyze struct
+	info := analyzeStruct(t, map[reflect.Type]bool{})
+
+	// store info, which is nil for unsupported structs
+	structCache.Store(t, info)
+
+	return info
+}
+
+func analyzeStruct(t reflect.Type, visiting map[reflect.Type]bool) *structInfo {
+	// check recursion
+	if visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	// check type, time values are encoded as dates
+	if t == timeType || !supportedType(t) {
+		return nil
+	}
+
+	// collect fields
+	info := &structInfo{
+		names: map[string]int{},
+	}
+	for i := 0; i < t.NumField(); i++ {
+		// get field, unexported fields are ignored by the struct codec
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		// embedded fields may be inlined or named by their type
+		if sf.Anonymous {
+			return nil
+		}
+
+		// parse tags like the default struct tag parser
+		key := strings.ToLower(sf.Name)
+		tag, ok := sf.Tag.Lookup("bson")
+		if !ok && !strings.Contains(string(sf.Tag), ":") && len(sf.Tag) > 0 {
+			tag = string(sf.Tag)
+		}
+		if tag == "-" {
+			continue
+		}
+		field := structField{index: i}
+		for j, str := range strings.Split(tag, ",") {
+			if j == 0 && str != "" {
+				key = str
+			}
+			switch str {
+			case "omitempty":
+				field.omitEmpty = true
+			case "minsize", "truncate", "inline":
+				return nil
+			}
+		}
+		field.name = key
+
+		// check field type
+		if !supportedValue(sf.Type, visiting) {
+			return nil
+		}
+
+		// check duplicates
+		if _, ok := info.names[key]; ok {
+			return nil
+		}
+
+		// add field
+		info.names[key] = len(info.fields)
+		info.fields = append(info.fields, field)
+	}
+
+	return info
+}
+
+func supportedType(t reflect.Type) bool {
+	// check hooks
+	for _, hook := range hookTypes {
+		if t.Implements(hook) || reflect.PtrTo(t).Implements(hook) {
+			return false
+		}
+	}
+
+	// check packages with custom codecs
+	switch t.PkgPath() {
+	case "encoding/json", "net/url":
+		return false
+	}
+	if strings.HasPrefix(t.PkgPath(), "go.mongodb.org/") {
+		return false
+	}
+
+	return true
+}
+
+func supportedValue(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	// check known types
+	if t == timeType || t == objectIDType {
+		return true
+	}
+
+	// check type
+	if !supportedType(t) {
+		return false
+	}
+
+	// check kind
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	case reflect.Ptr:
+		return supportedValue(t.Elem(), visiting)
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8 && supportedValue(t.Elem(), visiting)
+	case reflect.Struct:
+		return analyzeStruct(t, visiting) != nil
+	default:
+		return false
+	}
+}
+
+func encodeStruct(info *structInfo, value reflect.Value) bson.D {
+	doc := make(bson.D, 0, len(info.fields))
+	for _, field := range info.fields {
+		// get value
+		fieldValue := value.Field(field.index)
+		if field.omitEmpty && isZero(fieldValue) {
+			continue
+		}
+
+		// add value
+		doc = append(doc, bson.E{Key: field.name, Value: encodeValue(fieldValue)})
+	}
+
+	return doc
+}
+
+func encodeValue(value reflect.Value) interface{} {
+	// handle known types
+	switch value.Type() {
+	case timeType:
+		return primitive.NewDateTimeFromTime(value.Interface().(time.Time))
+	case objectIDType:
+		return value.Interface().(primitive.ObjectID)
+	}
+
+	// handle kinds
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return int32(value.Int())
+	case reflect.Int:
+		n := value.Int()
+		if n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int32(n)
+		}
+		return n
+	case reflect.Int64:
+		return value.Int()
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.String:
+		return value.String()
+	case reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
+		return encodeValue(value.Elem())
+	case reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+		array := make(bson.A, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			array = append(array, encodeValue(value.Index(i)))
+		}
+		return array
+	case reflect.Struct:
+		return encodeStruct(describeStruct(value.Type()), value)
+	default:
+		panic("bsonkit: unsupported value")
+	}
+}
+
+func encodeDynamic(v interface{}) (interface{}, bool) {
+	// handle standard types
+	switch v := v.(type) {
+	case nil, bool, int32, int64, float64, string,
+		primitive.ObjectID, primitive.DateTime, primitive.Decimal128, primitive.Timestamp:
+		return v, true
+	case int:
+		return encodeValue(reflect.ValueOf(v)), true
+	case int8:
+		return int32(v), true
+	case int16:
+		return int32(v), true
+	case float32:
+		return float64(v), true
+	case time.Time:
+		return primitive.NewDateTimeFromTime(v), true
+	case bson.M:
+		return encodeMap(v)
+	case map[string]interface{}:
+		return encodeMap(v)
+	case bson.D:
+		doc := make(bson.D, 0, len(v))
+		for _, e := range v {
+			value, ok := encodeDynamic(e.Value)
+			if !ok {
+				return nil, false
+			}
+			doc = append(doc, bson.E{Key: e.Key, Value: value})
+		}
+		return doc, true
+	case bson.A:
+		return encodeArray(v)
+	case []interface{}:
+		return encodeArray(v)
+	case []string:
+		array := make(bson.A, 0, len(v))
+		for _, item := range v {
+			array = append(array, item)
+		}
+		return array, true
+	}
+
+	// handle supported structs
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Ptr && value.Type().Elem().Kind() == reflect.Struct {
+		if describeStruct(value.Type().Elem()) == nil {
+			return nil, false
+		} else if value.IsNil() {
+			return nil, true
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Struct {
+		info := describeStruct(value.Type())
+		if info == nil {
+			return nil, false
+		}
+		return encodeStruct(info, value), true
+	}
+
+	return nil, false
+}
+
+func encodeMap(m map[string]interface{}) (interface{}, bool) {
+	// encode fields
+	doc := make(bson.D, 0, len(m))
+	for key, item := range m {
+		value, ok := encodeDynamic(item)
+		if !ok {
+			return nil, false
+		}
+		doc = append(doc, bson.E{Key: key, Value: value})
+	}
+
+	// sort fields
+	sort.Slice(doc, func(i, j int) bool {
+		return doc[i].Key < doc[j].Key
+	})
+
+	return doc, true
+}
+
+func encodeArray(a []interface{}) (interface{}, bool) {
+	array := make(bson.A, 0, len(a))
+	for _, item := range a {
+		value, ok := encodeDynamic(item)
+		if !ok {
+			return nil, false
+		}
+		array = append(array, value)
+	}
+
+	return array, true
+}
+
+func isZero(value reflect.Value) bool {
+	// use zeroer like the struct codec
+	if value.Kind() != reflect.Ptr || !value.IsNil() {
+		if z, ok := value.Interface().(zeroer); ok {
+			return z.IsZero()
+		}
+	}
+
+	// check kind
+	switch value.Kind() {
+	case reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Ptr:
+		return value.IsNil()
+	default:
+		return false
+	}
+}
+
+func decodeStruct(info *structInfo, doc bson.D, value reflect.Value) bool {
+	for _, e := range doc {
+		// find field, names are also matched in lowercase like the struct codec
+		i, ok := info.names[e.Key]
+		if !ok {
+			i, ok = info.names[strings.ToLower(e.Key)]
+		}
+		if !ok {
+			continue
+		}
+
+		// decode value
+		if !decodeValue(e.Value, value.Field(info.fields[i].index)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func decodeValue(v interface{}, value reflect.Value) bool {
+	// handle known types
+	switch value.Type() {
+	case timeType:
+		dt, ok := v.(primitive.DateTime)
+		if ok {
+			value.Set(reflect.ValueOf(dt.Time().UTC()))
+		}
+		return ok
+	case objectIDType:
+		id, ok := v.(primitive.ObjectID)
+		if ok {
+			value.Set(reflect.ValueOf(id))
+		}
+		return ok
+	}
+
+	// handle kinds, other value types are left to the registry
+	switch value.Kind() {
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if ok {
+			value.SetBool(b)
+		}
+		return ok
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch v := v.(type) {
+		case int32:
+			n = int64(v)
+		case int64:
+			n = v
+		default:
+			return false
+		}
+		if value.OverflowInt(n) {
+			return false
+		}
+		value.SetInt(n)
+		return true
+	case reflect.Float32, reflect.Float64:
+		f, ok := v.(float64)
+		if !ok || (value.Kind() == reflect.Float32 && float64(float32(f)) != f) {
+			return false
+		}
+		value.SetFloat(f)
+		return true
+	case reflect.String:
+		s, ok := v.(string)
+		if ok {
+			value.SetString(s)
+		}
+		return ok
+	case reflect.Ptr:
+		if v == nil {
+			value.Set(reflect.Zero(value.Type()))
+			return true
+		}
+		elem := reflect.New(value.Type().Elem())
+		if !decodeValue(v, elem.Elem()) {
+			return false
+		}
+		value.Set(elem)
+		return true
+	case reflect.Slice:
+		if v == nil {
+			value.Set(reflect.Zero(value.Type()))
+			return true
+		}
+		array, ok := v.(bson.A)
+		if !ok {
+			return false
+		}
+		slice := reflect.MakeSlice(value.Type(), len(array), len(array))
+		for i, item := range array {
+			if !decodeValue(item, slice.Index(i)) {
+				return false
+			}
+		}
+		value.Set(slice)
+		return true
+	case reflect.Struct:
+		if v == nil {
+			value.Set(reflect.Zero(value.Type()))
+			return true
+		}
+		doc, ok := v.(bson.D)
+		if !ok {
+			return false
+		}
+		return decodeStruct(describeStruct(value.Type()), doc, value)
+	default:
+		return false
+	}
+}
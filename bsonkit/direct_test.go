@@ -0,0 +1,242 @@
+package bsonkit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type structAddress struct {
+	Street string
+	City   string `bson:"city,omitempty"`
+}
+
+type structPerson struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Name     string             `bson:"name"`
+	Age      int                `bson:"age"`
+	Small    int8
+	Big      int64
+	Score    float64
+	Ratio    float32
+	Active   bool             `bson:",omitempty"`
+	Born     time.Time        `bson:"born"`
+	Updated  time.Time        `bson:"updated,omitempty"`
+	Tags     []string         `bson:"tags"`
+	Empty    []string         `bson:"empty"`
+	Address  structAddress    `bson:"address"`
+	Previous *structAddress   `bson:"previous"`
+	Other    []*structAddress `bson:"other,omitempty"`
+	Note     *string          `bson:"note,omitempty"`
+	Skipped  string           `bson:"-"`
+	private  string
+}
+
+type structCustom struct {
+	Value json.Number `bson:"value"`
+}
+
+type structMap struct {
+	Data map[string]int `bson:"data"`
+}
+
+type structNode struct {
+	Next *structNode `bson:"next"`
+}
+
+func TestTransformDirect(t *testing.T) {
+	note := "note"
+	for _, value := range []interface{}{
+		structPerson{},
+		structPerson{
+			ID:       primitive.NewObjectID(),
+			Name:     "Alice",
+			Age:      1 << 40,
+			Small:    -5,
+			Big:      7,
+			Score:    1.5,
+			Ratio:    0.25,
+			Active:   true,
+			Born:     time.Date(2000, 1, 2, 3, 4, 5, 6000000, time.UTC),
+			Updated:  time.Now(),
+			Tags:     []string{"a", "b"},
+			Empty:    []string{},
+			Address:  structAddress{Street: "Main", City: "Zurich"},
+			Previous: &structAddress{Street: "Side"},
+			Other:    []*structAddress{nil, {City: "Bern"}},
+			Note:     &note,
+			Skipped:  "skipped",
+			private:  "private",
+		},
+		&structPerson{Name: "Bob"},
+		structCustom{Value: "42"},
+		structMap{Data: map[string]int{"a": 1}},
+		structNode{Next: &structNode{}},
+		bson.M{"foo": "bar"},
+		bson.D{
+			{Key: "$set", Value: bson.M{"age": 5}},
+			{Key: "$inc", Value: bson.M{"n": int64(1)}},
+			{Key: "$push", Value: map[string]interface{}{"list": bson.A{int8(1), 1 << 40, "x", 1.5, float32(0.5), nil}}},
+			{Key: "$max", Value: bson.M{"born": time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)}},
+			{Key: "$setOnInsert", Value: bson.M{"address": structAddress{Street: "Main"}}},
+			{Key: "$unset", Value: bson.M{"tags": []string{"a"}}},
+		},
+		bson.M{"regex": primitive.Regex{Pattern: "foo", Options: "mi"}},
+		bson.M{"values": []int{1, 2}},
+	} {
+		expected, err := TransformWithRegistry(nil, value)
+		assert.NoError(t, err)
+
+		actual, err := TransformDirect(nil, value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	_, err := TransformDirect(nil, "foo")
+	assert.Error(t, err)
+}
+
+func TestDecodeDirect(t *testing.T) {
+	note := "note"
+	for _, doc := range []Doc{
+		MustConvert(bson.M{}),
+		MustConvert(bson.M{
+			"_id":      primitive.NewObjectID(),
+			"name":     "Alice",
+			"age":      int64(1 << 40),
+			"small":    int32(-5),
+			"big":      int32(7),
+			"score":    1.5,
+			"ratio":    0.25,
+			"active":   true,
+			"born":     primitive.NewDateTimeFromTime(time.Date(2000, 1, 2, 3, 4, 5, 6000000, time.UTC)),
+			"tags":     bson.A{"a", "b"},
+			"empty":    bson.A{},
+			"address":  bson.M{"Street": "Main", "city": "Zurich"},
+			"previous": nil,
+			"other":    bson.A{nil, bson.M{"city": "Bern"}},
+			"note":     note,
+			"Skipped":  "skipped",
+			"unknown":  "unknown",
+		}),
+		MustConvert(bson.M{"age": 1.0}),
+		MustConvert(bson.M{"small": int32(500)}),
+		MustConvert(bson.M{"ratio": 0.1}),
+		MustConvert(bson.M{"name": 42}),
+	} {
+		var expected structPerson
+		expectedErr := DecodeWithRegistry(nil, doc, &expected)
+
+		var actual structPerson
+		actualErr := DecodeDirect(nil, doc, &actual)
+		assert.Equal(t, expectedErr, actualErr)
+		assert.Equal(t, expected, actual)
+	}
+
+	// custom codecs use the registry
+	var custom structCustom
+	err := DecodeDirect(nil, MustConvert(bson.M{"value": "42"}), &custom)
+	assert.Equal(t, DecodeWithRegistry(nil, MustConvert(bson.M{"value": "42"}), &custom), err)
+
+	var m bson.M
+	err = DecodeDirect(nil, MustConvert(bson.M{"foo": "bar"}), &m)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{"foo": "bar"}, m)
+}
+
+var benchPerson = structPerson{
+	ID:      primitive.NewObjectID(),
+	Name:    "Alice",
+	Age:     42,
+	Score:   1.5,
+	Born:    time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC),
+	Tags:    []string{"a", "b", "c"},
+	Address: structAddress{Street: "Main", City: "Zurich"},
+}
+
+func BenchmarkTransformWithRegistry(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, err := TransformWithRegistry(nil, benchPerson)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkTransformDirect(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, err := TransformDirect(nil, benchPerson)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+var benchUpdate = bson.M{
+	"$set": bson.M{"name": "Bob", "age": 42},
+	"$inc": bson.M{"score": 1.5},
+}
+
+func BenchmarkTransformWithRegistryMap(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, err := TransformWithRegistry(nil, benchUpdate)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkTransformDirectMap(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, err := TransformDirect(nil, benchUpdate)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkDecodeWithRegistry(b *testing.B) {
+	b.ReportAllocs()
+
+	doc, err := TransformDirect(nil, benchPerson)
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		var person structPerson
+		err = DecodeWithRegistry(nil, doc, &person)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkDecodeDirect(b *testing.B) {
+	b.ReportAllocs()
+
+	doc, err := TransformDirect(nil, benchPerson)
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		var person structPerson
+		err = DecodeDirect(nil, doc, &person)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
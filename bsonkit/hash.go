@@ -0,0 +1,169 @@
+package bsonkit
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Hash will return a stable hash of the provided document. The hash is
+// computed over a canonical form of the document in which values that are
+// equal according to Compare produce the same hash e.g. int32(1), int64(1)
+// and 1.0. If unordered is true, the fields of documents are hashed in key
+// order, which makes the hash independent of the field order.
+func Hash(doc Doc, unordered bool) uint64 {
+	// prepare hasher
+	h := &hasher{hash: fnv.New64a(), unordered: unordered}
+
+	// hash document
+	if doc != nil {
+		h.value(*doc)
+	} else {
+		h.value(nil)
+	}
+
+	return h.hash.Sum64()
+}
+
+type hasher struct {
+	hash      hash.Hash64
+	unordered bool
+	buf       [8]byte
+}
+
+func (h *hasher) byte(b byte) {
+	h.buf[0] = b
+	_, _ = h.hash.Write(h.buf[:1])
+}
+
+func (h *hasher) uint64(n uint64) {
+	binary.BigEndian.PutUint64(h.buf[:], n)
+	_, _ = h.hash.Write(h.buf[:])
+}
+
+func (h *hasher) string(s string) {
+	h.uint64(uint64(len(s)))
+	_, _ = h.hash.Write([]byte(s))
+}
+
+func (h *hasher) value(v interface{}) {
+	// write class
+	class, _ := Inspect(v)
+	h.byte(byte(class))
+
+	// write value
+	switch v := v.(type) {
+	case nil, primitive.Null, MissingType:
+		// class is sufficient
+	case int32:
+		h.integer(int64(v))
+	case int64:
+		h.integer(v)
+	case float64:
+		h.float(v)
+	case primitive.Decimal128:
+		h.decimal(v)
+	case string:
+		h.string(v)
+	case bson.D:
+		h.document(v)
+	case bson.A:
+		h.uint64(uint64(len(v)))
+		for _, item := range v {
+			h.value(item)
+		}
+	case primitive.Binary:
+		h.byte(v.Subtype)
+		h.uint64(uint64(len(v.Data)))
+		_, _ = h.hash.Write(v.Data)
+	case primitive.ObjectID:
+		_, _ = h.hash.Write(v[:])
+	case bool:
+		if v {
+			h.byte(1)
+		} else {
+			h.byte(0)
+		}
+	case primitive.DateTime:
+		h.uint64(uint64(v))
+	case primitive.Timestamp:
+		h.uint64(uint64(v.T)<<32 | uint64(v.I))
+	case primitive.Regex:
+		h.string(v.Pattern)
+		h.string(v.Options)
+	}
+}
+
+func (h *hasher) integer(n int64) {
+	h.byte('i')
+	h.uint64(uint64(n))
+}
+
+func (h *hasher) float(f float64) {
+	// use integer form for integral values
+	if f >= math.MinInt64 && f < math.MaxInt64 && f == math.Trunc(f) {
+		h.integer(int64(f))
+		return
+	}
+
+	// canonicalize not a number
+	if math.IsNaN(f) {
+		f = math.NaN()
+	}
+
+	h.byte('f')
+	h.uint64(math.Float64bits(f))
+}
+
+func (h *hasher) decimal(d primitive.Decimal128) {
+	// get big integer, fails for infinity and not a number
+	big, exp, err := d.BigInt()
+	if err != nil {
+		h.byte('d')
+		h.string(d.String())
+		return
+	}
+
+	// use integer form for integral values
+	dec := decimal.NewFromBigInt(big, int32(exp))
+	if dec.IsInteger() && dec.BigInt().IsInt64() {
+		h.integer(dec.IntPart())
+		return
+	}
+
+	// use float form for exactly representable values
+	if f, exact := dec.Float64(); exact {
+		h.float(f)
+		return
+	}
+
+	h.byte('d')
+	h.string(dec.String())
+}
+
+func (h *hasher) document(doc bson.D) {
+	// write length
+	h.uint64(uint64(len(doc)))
+
+	// sort fields if unordered
+	if h.unordered && len(doc) > 1 {
+		sorted := make(bson.D, len(doc))
+		copy(sorted, doc)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Key < sorted[j].Key
+		})
+		doc = sorted
+	}
+
+	// write fields
+	for _, field := range doc {
+		h.string(field.Key)
+		h.value(field.Value)
+	}
+}
@@ -0,0 +1,86 @@
+package bsonkit
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHash(t *testing.T) {
+	id := primitive.NewObjectID()
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	doc := MustConvert(bson.M{
+		"a": id,
+		"b": bson.A{"1", true, now},
+		"c": bson.M{"d": primitive.Binary{Subtype: 1, Data: []byte("x")}},
+	})
+
+	// stable
+	assert.Equal(t, Hash(doc, false), Hash(Clone(doc), false))
+	assert.NotEqual(t, uint64(0), Hash(doc, false))
+	assert.Equal(t, Hash(nil, false), Hash(nil, false))
+
+	// equal numbers
+	d1 := &bson.D{{Key: "n", Value: int32(1)}}
+	d2 := &bson.D{{Key: "n", Value: int64(1)}}
+	d3 := &bson.D{{Key: "n", Value: 1.0}}
+	one, err := primitive.ParseDecimal128("1.0")
+	assert.NoError(t, err)
+	d4 := &bson.D{{Key: "n", Value: one}}
+	assert.Equal(t, Hash(d1, false), Hash(d2, false))
+	assert.Equal(t, Hash(d1, false), Hash(d3, false))
+	assert.Equal(t, Hash(d1, false), Hash(d4, false))
+
+	// fractional numbers
+	half, err := primitive.ParseDecimal128("0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, Hash(&bson.D{{Key: "n", Value: 0.5}}, false), Hash(&bson.D{{Key: "n", Value: half}}, false))
+	assert.NotEqual(t, Hash(&bson.D{{Key: "n", Value: 0.5}}, false), Hash(&bson.D{{Key: "n", Value: 1.5}}, false))
+
+	// special numbers
+	assert.Equal(t, Hash(&bson.D{{Key: "n", Value: math.NaN()}}, false), Hash(&bson.D{{Key: "n", Value: -math.NaN()}}, false))
+	assert.Equal(t, Hash(&bson.D{{Key: "n", Value: 0.0}}, false), Hash(&bson.D{{Key: "n", Value: math.Copysign(0, -1)}}, false))
+	inf, err := primitive.ParseDecimal128("Infinity")
+	assert.NoError(t, err)
+	assert.NotEqual(t, Hash(&bson.D{{Key: "n", Value: inf}}, false), Hash(d1, false))
+
+	// null values
+	assert.Equal(t, Hash(&bson.D{{Key: "n", Value: nil}}, false), Hash(&bson.D{{Key: "n", Value: primitive.Null{}}}, false))
+
+	// different types
+	assert.NotEqual(t, Hash(&bson.D{{Key: "n", Value: "1"}}, false), Hash(d1, false))
+	assert.NotEqual(t, Hash(&bson.D{{Key: "n", Value: bson.A{"1"}}}, false), Hash(&bson.D{{Key: "n", Value: "1"}}, false))
+
+	// different keys
+	assert.NotEqual(t, Hash(&bson.D{{Key: "m", Value: int32(1)}}, false), Hash(d1, false))
+
+	// field order
+	o1 := &bson.D{{Key: "a", Value: "1"}, {Key: "b", Value: bson.D{{Key: "c", Value: "2"}, {Key: "d", Value: "3"}}}}
+	o2 := &bson.D{{Key: "b", Value: bson.D{{Key: "d", Value: "3"}, {Key: "c", Value: "2"}}}, {Key: "a", Value: "1"}}
+	assert.NotEqual(t, Hash(o1, false), Hash(o2, false))
+	assert.Equal(t, Hash(o1, true), Hash(o2, true))
+	assert.Equal(t, bson.D{{Key: "b", Value: bson.D{{Key: "d", Value: "3"}, {Key: "c", Value: "2"}}}, {Key: "a", Value: "1"}}, *o2)
+
+	// array order
+	assert.NotEqual(t, Hash(&bson.D{{Key: "a", Value: bson.A{"1", "2"}}}, true), Hash(&bson.D{{Key: "a", Value: bson.A{"2", "1"}}}, true))
+}
+
+func BenchmarkHash(b *testing.B) {
+	doc := MustConvert(bson.M{
+		"a": primitive.NewObjectID(),
+		"b": bson.A{"1", true, 2.5},
+		"c": bson.M{"d": "foo", "e": int64(42)},
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		Hash(doc, true)
+	}
+}
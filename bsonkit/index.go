@@ -1,9 +1,27 @@
 package bsonkit
 
-import "github.com/tidwall/btree"
+import (
+	"unsafe"
 
-// Index is a basic btree based index for documents. The index is not safe from
-// concurrent access.
+	"github.com/tidwall/btree"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The btree uses a degree of 32 which allows up to 63 items per node. The node
+// overhead covers the node header and the children of internal nodes.
+const (
+	indexNodeItems    = 64
+	indexNodeOverhead = 64
+)
+
+// boundKey is the key of the field appended to bound documents. As BSON keys
+// cannot contain null bytes, the field never collides with stored documents.
+const boundKey = "\x00bound"
+
+// Index is a basic btree based index for documents. The index only stores
+// references to the documents, which are shared with the collection and other
+// indexes. Keys are extracted from the documents when compared and are not
+// stored separately. The index is not safe from concurrent access.
 type Index struct {
 	btree *btree.BTreeG[Doc]
 }
@@ -12,11 +30,51 @@ type Index struct {
 func NewIndex(unique bool, columns []Column) *Index {
 	return &Index{
 		btree: btree.NewBTreeG[Doc](func(a, b Doc) bool {
-			return Order(a, b, columns, !unique) < 0
+			// compare keys
+			res := Order(a, b, columns, false)
+			if res != 0 {
+				return res < 0
+			}
+
+			// order bounds before or after documents with equal keys
+			ba, bb := indexBound(a), indexBound(b)
+			if ba != 0 || bb != 0 {
+				return ba < bb
+			}
+
+			// compare identity for non-unique indexes
+			if !unique {
+				return Order(a, b, nil, true) < 0
+			}
+
+			return false
 		}),
 	}
 }
 
+func indexBound(doc Doc) int {
+	// check last field
+	if n := len(*doc); n > 0 && (*doc)[n-1].Key == boundKey {
+		return (*doc)[n-1].Value.(int)
+	}
+
+	return 0
+}
+
+func withBound(doc Doc, bound int) Doc {
+	// check doc
+	if doc == nil {
+		return nil
+	}
+
+	// copy fields and add bound
+	fields := make(bson.D, len(*doc), len(*doc)+1)
+	copy(fields, *doc)
+	fields = append(fields, bson.E{Key: boundKey, Value: bound})
+
+	return &fields
+}
+
 // Build will build the index from the specified list. It may return false if
 // there was a unique constraint error when building the index. If an error
 // is returned the index only has some documents added.
@@ -75,6 +133,72 @@ func (i *Index) List() List {
 	return list
 }
 
+// Ascend will call the function with the documents in index order starting at
+// the optional inclusive lower bound and ending at the optional inclusive upper
+// bound. Bounds are documents that provide the values of all index columns.
+// The iteration stops if the function returns false.
+func (i *Index) Ascend(lower, upper Doc, fn func(Doc) bool) {
+	// prepare bounds
+	lower = withBound(lower, -1)
+	upper = withBound(upper, 1)
+
+	// prepare iterator
+	iter := func(doc Doc) bool {
+		if upper != nil && i.btree.Less(upper, doc) {
+			return false
+		}
+		return fn(doc)
+	}
+
+	// walk index
+	if lower != nil {
+		i.btree.Ascend(lower, iter)
+	} else {
+		i.btree.Scan(iter)
+	}
+}
+
+// Descend will call the function with the documents in reverse index order
+// starting at the optional inclusive upper bound and ending at the optional
+// inclusive lower bound. Bounds are documents that provide the values of all
+// index columns. The iteration stops if the function returns false.
+func (i *Index) Descend(lower, upper Doc, fn func(Doc) bool) {
+	// prepare bounds
+	lower = withBound(lower, -1)
+	upper = withBound(upper, 1)
+
+	// prepare iterator
+	iter := func(doc Doc) bool {
+		if lower != nil && i.btree.Less(doc, lower) {
+			return false
+		}
+		return fn(doc)
+	}
+
+	// walk index
+	if upper != nil {
+		i.btree.Descend(upper, iter)
+	} else {
+		i.btree.Reverse(iter)
+	}
+}
+
+// Len will return the number of documents in the index.
+func (i *Index) Len() int {
+	return i.btree.Len()
+}
+
+// Memory will return the approximate number of bytes used by the index
+// excluding the referenced documents. The estimate assumes that nodes are on
+// average filled by three quarters.
+func (i *Index) Memory() int {
+	// estimate nodes
+	entries := i.btree.Len()
+	nodes := (entries*4/3 + indexNodeItems - 1) / indexNodeItems
+
+	return nodes * (indexNodeOverhead + indexNodeItems*int(unsafe.Sizeof(Doc(nil))))
+}
+
 // Clone will clone the index. Mutating the new index will not mutate the original
 // index.
 func (i *Index) Clone() *Index {
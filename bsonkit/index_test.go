@@ -250,3 +250,101 @@ func TestIndexClone(t *testing.T) {
 	assert.True(t, index2.Has(d3))
 	assert.Equal(t, List{d2, d3}, index2.List())
 }
+
+func TestIndexMemory(t *testing.T) {
+	index := NewIndex(false, []Column{
+		{Path: "a"},
+	})
+	assert.Equal(t, 0, index.Len())
+	assert.Equal(t, 0, index.Memory())
+
+	for i := 0; i < 1000; i++ {
+		index.Add(MustConvert(bson.M{"a": i, "b": "some large value that is not copied"}))
+	}
+	assert.Equal(t, 1000, index.Len())
+
+	memory := index.Memory()
+	assert.True(t, memory >= 1000*8, memory)
+	assert.True(t, memory <= 1000*32, memory)
+}
+
+func TestIndexAscendDescend(t *testing.T) {
+	for _, unique := range []bool{false, true} {
+		index := NewIndex(unique, []Column{
+			{Path: "a"},
+			{Path: "b", Reverse: true},
+		})
+
+		var docs List
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				doc := MustConvert(bson.M{"a": a, "b": b})
+				docs = append(docs, doc)
+				assert.True(t, index.Add(doc))
+			}
+		}
+		if !unique {
+			doc := MustConvert(bson.M{"a": 1, "b": 1})
+			docs = append(docs, doc)
+			assert.True(t, index.Add(doc))
+		}
+
+		collect := func(walk func(lower, upper Doc, fn func(Doc) bool), lower, upper Doc, limit int) []bson.M {
+			var list []bson.M
+			walk(lower, upper, func(doc Doc) bool {
+				list = append(list, bson.M{"a": Get(doc, "a"), "b": Get(doc, "b")})
+				return limit <= 0 || len(list) < limit
+			})
+			return list
+		}
+
+		all := collect(index.Ascend, nil, nil, 0)
+		assert.Len(t, all, index.Len())
+		assert.Equal(t, bson.M{"a": int64(0), "b": int64(2)}, all[0])
+		assert.Equal(t, bson.M{"a": int64(2), "b": int64(0)}, all[len(all)-1])
+
+		reverse := collect(index.Descend, nil, nil, 0)
+		for i := range all {
+			assert.Equal(t, all[i], reverse[len(reverse)-1-i])
+		}
+
+		lower := MustConvert(bson.M{"a": 1, "b": 2})
+		upper := MustConvert(bson.M{"a": 1, "b": 1})
+
+		res := collect(index.Ascend, lower, upper, 0)
+		expected := []bson.M{
+			{"a": int64(1), "b": int64(2)},
+			{"a": int64(1), "b": int64(1)},
+		}
+		if !unique {
+			expected = append(expected, bson.M{"a": int64(1), "b": int64(1)})
+		}
+		assert.Equal(t, expected, res)
+
+		res = collect(index.Descend, lower, upper, 0)
+		for i := range expected {
+			assert.Equal(t, expected[i], res[len(res)-1-i])
+		}
+
+		res = collect(index.Ascend, upper, nil, 2)
+		if unique {
+			assert.Equal(t, []bson.M{
+				{"a": int64(1), "b": int64(1)},
+				{"a": int64(1), "b": int64(0)},
+			}, res)
+		} else {
+			assert.Equal(t, []bson.M{
+				{"a": int64(1), "b": int64(1)},
+				{"a": int64(1), "b": int64(1)},
+			}, res)
+		}
+
+		res = collect(index.Descend, nil, lower, 0)
+		assert.Len(t, res, 4)
+		assert.Equal(t, bson.M{"a": int64(1), "b": int64(2)}, res[0])
+
+		for _, doc := range docs {
+			assert.True(t, index.Has(doc))
+		}
+	}
+}
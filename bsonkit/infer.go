@@ -0,0 +1,118 @@
+package bsonkit
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type inferNode struct {
+	values int
+	docs   int
+	types  map[string]bool
+	fields map[string]*inferNode
+	order  []string
+	items  *inferNode
+}
+
+// InferSchema will infer a $jsonSchema compatible schema from the specified
+// list of documents. The schema lists the observed BSON types of all fields
+// and array elements. Fields that are present in all observed documents are
+// marked as required.
+func InferSchema(list List) Doc {
+	// observe documents
+	root := &inferNode{}
+	for _, doc := range list {
+		root.observe(*doc)
+	}
+
+	// build schema
+	schema := root.build()
+
+	return &schema
+}
+
+func (n *inferNode) observe(v interface{}) {
+	// count value
+	n.values++
+
+	// record type
+	if n.types == nil {
+		n.types = map[string]bool{}
+	}
+	_, typ := Inspect(v)
+	n.types[Type2Alias[typ]] = true
+
+	switch value := v.(type) {
+	case bson.D:
+		// count document
+		n.docs++
+
+		// observe fields
+		for _, e := range value {
+			if n.fields == nil {
+				n.fields = map[string]*inferNode{}
+			}
+			field, ok := n.fields[e.Key]
+			if !ok {
+				field = &inferNode{}
+				n.fields[e.Key] = field
+				n.order = append(n.order, e.Key)
+			}
+			field.observe(e.Value)
+		}
+	case bson.A:
+		// observe items
+		for _, item := range value {
+			if n.items == nil {
+				n.items = &inferNode{}
+			}
+			n.items.observe(item)
+		}
+	}
+}
+
+func (n *inferNode) build() bson.D {
+	// collect types
+	types := make([]string, 0, len(n.types))
+	for typ := range n.types {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	// prepare schema
+	schema := bson.D{}
+	if len(types) == 1 {
+		schema = append(schema, bson.E{Key: "bsonType", Value: types[0]})
+	} else if len(types) > 1 {
+		list := make(bson.A, 0, len(types))
+		for _, typ := range types {
+			list = append(list, typ)
+		}
+		schema = append(schema, bson.E{Key: "bsonType", Value: list})
+	}
+
+	// add fields
+	if len(n.order) > 0 {
+		required := bson.A{}
+		properties := make(bson.D, 0, len(n.order))
+		for _, name := range n.order {
+			field := n.fields[name]
+			if field.values == n.docs {
+				required = append(required, name)
+			}
+			properties = append(properties, bson.E{Key: name, Value: field.build()})
+		}
+		if len(required) > 0 {
+			schema = append(schema, bson.E{Key: "required", Value: required})
+		}
+		schema = append(schema, bson.E{Key: "properties", Value: properties})
+	}
+
+	// add items
+	if n.items != nil {
+		schema = append(schema, bson.E{Key: "items", Value: n.items.build()})
+	}
+
+	return schema
+}
@@ -0,0 +1,85 @@
+package bsonkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInferSchema(t *testing.T) {
+	list := List{
+		&bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "Alice"},
+			{Key: "age", Value: int32(42)},
+			{Key: "tags", Value: bson.A{"a", int32(1)}},
+			{Key: "address", Value: bson.D{
+				{Key: "city", Value: "Zurich"},
+			}},
+		},
+		&bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "Bob"},
+			{Key: "age", Value: 42.5},
+			{Key: "tags", Value: bson.A{}},
+			{Key: "address", Value: nil},
+		},
+	}
+
+	schema := InferSchema(list)
+	assert.Equal(t, &bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: bson.A{"_id", "name", "age", "tags", "address"}},
+		{Key: "properties", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "bsonType", Value: "objectId"},
+			}},
+			{Key: "name", Value: bson.D{
+				{Key: "bsonType", Value: "string"},
+			}},
+			{Key: "age", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"double", "int"}},
+			}},
+			{Key: "tags", Value: bson.D{
+				{Key: "bsonType", Value: "array"},
+				{Key: "items", Value: bson.D{
+					{Key: "bsonType", Value: bson.A{"int", "string"}},
+				}},
+			}},
+			{Key: "address", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"null", "object"}},
+				{Key: "required", Value: bson.A{"city"}},
+				{Key: "properties", Value: bson.D{
+					{Key: "city", Value: bson.D{
+						{Key: "bsonType", Value: "string"},
+					}},
+				}},
+			}},
+		}},
+	}, schema)
+
+	// optional fields
+	schema = InferSchema(List{
+		&bson.D{{Key: "a", Value: int32(1)}},
+		&bson.D{{Key: "b", Value: int32(1)}},
+	})
+	assert.Equal(t, &bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "properties", Value: bson.D{
+			{Key: "a", Value: bson.D{{Key: "bsonType", Value: "int"}}},
+			{Key: "b", Value: bson.D{{Key: "bsonType", Value: "int"}}},
+		}},
+	}, schema)
+
+	// empty list
+	schema = InferSchema(nil)
+	assert.Equal(t, &bson.D{}, schema)
+
+	// valid schema
+	for _, doc := range list {
+		err := NewSchema(*InferSchema(list)).Evaluate(*doc)
+		assert.NoError(t, err)
+	}
+}
@@ -199,3 +199,59 @@ func Mod(num, div interface{}) interface{} {
 		return Missing
 	}
 }
+
+// Div will divide the two numerical values. It accepts int32, int64, float64
+// and decimal128 and returns a float64 or a decimal128 if one of the values is
+// a decimal128. Missing is returned for non-numerical values and divisions by
+// zero.
+func Div(num, div interface{}) interface{} {
+	// divide decimals
+	_, numDec := num.(primitive.Decimal128)
+	_, divDec := div.(primitive.Decimal128)
+	if numDec || divDec {
+		n, ok1 := toDecimal(num)
+		d, ok2 := toDecimal(div)
+		if !ok1 || !ok2 || d.IsZero() {
+			return Missing
+		}
+		res, _ := decimal.NewFromString(n.Div(d).String())
+		return decTod128(res)
+	}
+
+	// divide floats
+	n, ok1 := toFloat(num)
+	d, ok2 := toFloat(div)
+	if !ok1 || !ok2 || d == 0 {
+		return Missing
+	}
+
+	return n / d
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func toDecimal(v interface{}) (decimal.Decimal, bool) {
+	switch v := v.(type) {
+	case int32:
+		return decimal.NewFromInt(int64(v)), true
+	case int64:
+		return decimal.NewFromInt(v), true
+	case float64:
+		return decimal.NewFromFloat(v), true
+	case primitive.Decimal128:
+		return d128ToDec(v), true
+	default:
+		return decimal.Decimal{}, false
+	}
+}
@@ -92,3 +92,17 @@ func TestMod(t *testing.T) {
 	assert.Equal(t, d128("0"), Mod(d128("2"), float64(2)))
 	assert.Equal(t, d128("0"), Mod(d128("2"), d128("2")))
 }
+
+func TestDiv(t *testing.T) {
+	assert.Equal(t, Missing, Div("x", "y"))
+	assert.Equal(t, Missing, Div(int32(2), "y"))
+	assert.Equal(t, Missing, Div("x", int32(2)))
+	assert.Equal(t, Missing, Div(int32(2), int32(0)))
+	assert.Equal(t, Missing, Div(d128("2"), int32(0)))
+
+	assert.Equal(t, float64(2.5), Div(int32(5), int32(2)))
+	assert.Equal(t, float64(2.5), Div(int64(5), int32(2)))
+	assert.Equal(t, float64(2.5), Div(float64(5), int64(2)))
+	assert.Equal(t, d128("2.5"), Div(int32(5), d128("2")))
+	assert.Equal(t, d128("2.5"), Div(d128("5"), float64(2)))
+}
@@ -0,0 +1,123 @@
+package bsonkit
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ArrayStrategy defines how arrays are merged.
+type ArrayStrategy int
+
+// The available array strategies.
+const (
+	// ReplaceArrays replaces the base array with the patch array.
+	ReplaceArrays ArrayStrategy = iota
+
+	// AppendArrays appends the patch array elements to the base array.
+	AppendArrays
+
+	// MergeArrays merges the elements at the same position. Documents are
+	// merged recursively while other elements are replaced. Additional patch
+	// array elements are appended.
+	MergeArrays
+)
+
+// Merge will deep merge the patch into the base document and return the
+// resulting document. Similar to a JSON merge patch (RFC 7396), embedded
+// documents are merged recursively and null values in the patch remove the
+// field from the base document. Arrays are merged according to the specified
+// strategy. Both documents are not mutated.
+//
+// The function may panic if the docs are not obtained using Convert or
+// Transform and contain unsupported types.
+func Merge(base, patch Doc, strategy ArrayStrategy) Doc {
+	// merge documents
+	result := mergeDocument(*base, *patch, strategy)
+
+	return &result
+}
+
+func mergeDocument(base, patch bson.D, strategy ArrayStrategy) bson.D {
+	// clone base
+	result := cloneValue(base).(bson.D)
+
+	// merge fields
+	for _, e := range patch {
+		// find field
+		index := -1
+		for i, f := range result {
+			if f.Key == e.Key {
+				index = i
+				break
+			}
+		}
+
+		// remove field on null
+		if e.Value == nil {
+			if index >= 0 {
+				result = append(result[:index], result[index+1:]...)
+			}
+			continue
+		}
+
+		// add missing field
+		if index < 0 {
+			result = append(result, bson.E{Key: e.Key, Value: mergeValue(nil, e.Value, strategy)})
+			continue
+		}
+
+		// merge field
+		result[index].Value = mergeValue(result[index].Value, e.Value, strategy)
+	}
+
+	return result
+}
+
+func mergeValue(base, patch interface{}, strategy ArrayStrategy) interface{} {
+	switch p := patch.(type) {
+	case bson.D:
+		// merge documents, other values are replaced with a merge into an
+		// empty document to remove null values
+		b, ok := base.(bson.D)
+		if !ok {
+			b = bson.D{}
+		}
+		return mergeDocument(b, p, strategy)
+	case bson.A:
+		// merge arrays
+		if b, ok := base.(bson.A); ok {
+			return mergeArray(b, p, strategy)
+		}
+	}
+
+	return cloneValue(patch)
+}
+
+func mergeArray(base, patch bson.A, strategy ArrayStrategy) bson.A {
+	switch strategy {
+	case AppendArrays:
+		// append elements
+		result := make(bson.A, 0, len(base)+len(patch))
+		result = append(result, cloneValue(base).(bson.A)...)
+		result = append(result, cloneValue(patch).(bson.A)...)
+		return result
+	case MergeArrays:
+		// merge elements
+		result := cloneValue(base).(bson.A)
+		for i, item := range patch {
+			if i < len(result) {
+				if doc, ok := item.(bson.D); ok {
+					if b, ok := result[i].(bson.D); ok {
+						result[i] = mergeDocument(b, doc, strategy)
+						continue
+					}
+				}
+				result[i] = cloneValue(item)
+			} else {
+				result = append(result, cloneValue(item))
+			}
+		}
+		return result
+	default:
+		return cloneValue(patch).(bson.A)
+	}
+}
@@ -0,0 +1,94 @@
+package bsonkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMerge(t *testing.T) {
+	base := &bson.D{
+		{Key: "a", Value: "foo"},
+		{Key: "b", Value: bson.D{
+			{Key: "c", Value: int32(1)},
+			{Key: "d", Value: int32(2)},
+		}},
+		{Key: "e", Value: bson.A{
+			bson.D{{Key: "f", Value: "g"}},
+			int32(1),
+		}},
+		{Key: "h", Value: true},
+	}
+
+	patch := &bson.D{
+		{Key: "a", Value: "bar"},
+		{Key: "b", Value: bson.D{
+			{Key: "c", Value: nil},
+			{Key: "x", Value: "y"},
+		}},
+		{Key: "e", Value: bson.A{
+			bson.D{{Key: "i", Value: "j"}},
+			int32(2),
+			int32(3),
+		}},
+		{Key: "h", Value: nil},
+		{Key: "k", Value: bson.D{{Key: "l", Value: nil}}},
+	}
+
+	// replace arrays
+	res := Merge(base, patch, ReplaceArrays)
+	assert.Equal(t, &bson.D{
+		{Key: "a", Value: "bar"},
+		{Key: "b", Value: bson.D{
+			{Key: "d", Value: int32(2)},
+			{Key: "x", Value: "y"},
+		}},
+		{Key: "e", Value: bson.A{
+			bson.D{{Key: "i", Value: "j"}},
+			int32(2),
+			int32(3),
+		}},
+		{Key: "k", Value: bson.D{}},
+	}, res)
+
+	// append arrays
+	res = Merge(base, patch, AppendArrays)
+	assert.Equal(t, bson.A{
+		bson.D{{Key: "f", Value: "g"}},
+		int32(1),
+		bson.D{{Key: "i", Value: "j"}},
+		int32(2),
+		int32(3),
+	}, Get(res, "e"))
+
+	// merge arrays
+	res = Merge(base, patch, MergeArrays)
+	assert.Equal(t, bson.A{
+		bson.D{{Key: "f", Value: "g"}, {Key: "i", Value: "j"}},
+		int32(2),
+		int32(3),
+	}, Get(res, "e"))
+
+	// base is not mutated
+	assert.Equal(t, &bson.D{
+		{Key: "a", Value: "foo"},
+		{Key: "b", Value: bson.D{
+			{Key: "c", Value: int32(1)},
+			{Key: "d", Value: int32(2)},
+		}},
+		{Key: "e", Value: bson.A{
+			bson.D{{Key: "f", Value: "g"}},
+			int32(1),
+		}},
+		{Key: "h", Value: true},
+	}, base)
+
+	// type change
+	res = Merge(base, &bson.D{
+		{Key: "a", Value: bson.D{{Key: "b", Value: "c"}}},
+		{Key: "b", Value: "c"},
+	}, ReplaceArrays)
+	assert.Equal(t, bson.D{{Key: "b", Value: "c"}}, Get(res, "a"))
+	assert.Equal(t, "c", Get(res, "b"))
+}
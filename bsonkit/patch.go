@@ -0,0 +1,353 @@
+package bsonkit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PatchOperation is a single JSON Patch (RFC 6902) operation.
+type PatchOperation struct {
+	// The operation: "add", "remove", "replace", "move", "copy" or "test".
+	Op string `bson:"op"`
+
+	// The JSON Pointer (RFC 6901) to the target location.
+	Path string `bson:"path"`
+
+	// The JSON Pointer to the source location (move, copy).
+	From string `bson:"from,omitempty"`
+
+	// The value (add, replace, test).
+	Value interface{} `bson:"value"`
+}
+
+// ParsePatch will parse a JSON Patch document in extended JSON format.
+func ParsePatch(data []byte) ([]PatchOperation, error) {
+	// wrap array
+	var wrapper struct {
+		Ops []PatchOperation `bson:"ops"`
+	}
+	buf := make([]byte, 0, len(data)+9)
+	buf = append(buf, `{"ops":`...)
+	buf = append(buf, data...)
+	buf = append(buf, '}')
+
+	// decode operations
+	err := bson.UnmarshalExtJSON(buf, false, &wrapper)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapper.Ops, nil
+}
+
+// ApplyPatch will apply the JSON Patch operations to a clone of the document
+// and return it. If an operation fails, an error is returned and no changes
+// are visible in the original document.
+//
+// The function may panic if the doc is not obtained using Convert or Transform
+// and contains unsupported types.
+func ApplyPatch(doc Doc, ops []PatchOperation) (Doc, error) {
+	// clone document
+	var root interface{} = *Clone(doc)
+
+	// apply operations
+	for i, op := range ops {
+		var err error
+		root, err = applyPatchOperation(root, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	// check root
+	result, ok := root.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("patch result is not a document")
+	}
+
+	return &result, nil
+}
+
+func applyPatchOperation(root interface{}, op PatchOperation) (interface{}, error) {
+	// parse path
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert value
+	var value interface{}
+	if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		value, err = ConvertValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// get value from source
+	if op.Op == "move" || op.Op == "copy" {
+		// parse from
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		// check move
+		if op.Op == "move" && len(path) > len(from) && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("cannot move %q into itself", op.From)
+		}
+
+		// get value
+		value, err = lookupPointer(root, from)
+		if err != nil {
+			return nil, err
+		}
+		value = cloneValue(value)
+
+		// remove source
+		if op.Op == "move" {
+			root, err = patchRemove(root, from)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return patchAdd(root, path, value)
+	case "remove":
+		return patchRemove(root, path)
+	case "replace":
+		return patchReplace(root, path, value)
+	case "test":
+		// get value
+		actual, err := lookupPointer(root, path)
+		if err != nil {
+			return nil, err
+		}
+
+		// compare value
+		_, actualType := Inspect(actual)
+		_, valueType := Inspect(value)
+		if actualType != valueType || Compare(actual, value) != 0 {
+			return nil, fmt.Errorf("test failed at %q", op.Path)
+		}
+
+		return root, nil
+	default:
+		return nil, fmt.Errorf("unsupported patch operation %q", op.Op)
+	}
+}
+
+func patchAdd(root interface{}, path []string, value interface{}) (interface{}, error) {
+	// replace root
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return patchParent(root, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case bson.D:
+			// set or add field
+			for i, e := range container {
+				if e.Key == token {
+					container[i].Value = value
+					return container, nil
+				}
+			}
+			return append(container, bson.E{Key: token, Value: value}), nil
+		case bson.A:
+			// append element
+			if token == "-" {
+				return append(container, value), nil
+			}
+
+			// insert element
+			index, err := parseArrayIndex(token, len(container)+1)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+
+			return container, nil
+		default:
+			return nil, fmt.Errorf("cannot add to %T", parent)
+		}
+	})
+}
+
+func patchRemove(root interface{}, path []string) (interface{}, error) {
+	// check root
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove root")
+	}
+
+	return patchParent(root, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case bson.D:
+			// remove field
+			for i, e := range container {
+				if e.Key == token {
+					return append(container[:i], container[i+1:]...), nil
+				}
+			}
+			return nil, fmt.Errorf("missing field %q", token)
+		case bson.A:
+			// remove element
+			index, err := parseArrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:index], container[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove from %T", parent)
+		}
+	})
+}
+
+func patchReplace(root interface{}, path []string, value interface{}) (interface{}, error) {
+	// replace root
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return patchParent(root, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case bson.D:
+			// replace field
+			for i, e := range container {
+				if e.Key == token {
+					container[i].Value = value
+					return container, nil
+				}
+			}
+			return nil, fmt.Errorf("missing field %q", token)
+		case bson.A:
+			// replace element
+			index, err := parseArrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("cannot replace in %T", parent)
+		}
+	})
+}
+
+func patchParent(value interface{}, path []string, fn func(interface{}, string) (interface{}, error)) (interface{}, error) {
+	// yield parent
+	if len(path) == 1 {
+		return fn(value, path[0])
+	}
+
+	switch container := value.(type) {
+	case bson.D:
+		// descend into field
+		for i, e := range container {
+			if e.Key == path[0] {
+				res, err := patchParent(e.Value, path[1:], fn)
+				if err != nil {
+					return nil, err
+				}
+				container[i].Value = res
+				return container, nil
+			}
+		}
+		return nil, fmt.Errorf("missing field %q", path[0])
+	case bson.A:
+		// descend into element
+		index, err := parseArrayIndex(path[0], len(container))
+		if err != nil {
+			return nil, err
+		}
+		res, err := patchParent(container[index], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = res
+		return container, nil
+	default:
+		return nil, fmt.Errorf("cannot descend into %T", value)
+	}
+}
+
+func lookupPointer(value interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := value.(type) {
+		case bson.D:
+			// get field
+			found := false
+			for _, e := range container {
+				if e.Key == token {
+					value = e.Value
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("missing field %q", token)
+			}
+		case bson.A:
+			// get element
+			index, err := parseArrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			value = container[index]
+		default:
+			return nil, fmt.Errorf("cannot descend into %T", value)
+		}
+	}
+
+	return value, nil
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	// handle root
+	if pointer == "" {
+		return nil, nil
+	}
+
+	// check prefix
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid pointer %q", pointer)
+	}
+
+	// split and unescape tokens
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		token = strings.ReplaceAll(token, "~0", "~")
+		tokens[i] = token
+	}
+
+	return tokens, nil
+}
+
+func parseArrayIndex(token string, length int) (int, error) {
+	// check format
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.Trim(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	// parse index
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	// check bounds
+	if index >= length {
+		return 0, fmt.Errorf("array index %q out of bounds", token)
+	}
+
+	return index, nil
+}
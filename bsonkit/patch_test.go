@@ -0,0 +1,165 @@
+package bsonkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParsePatch(t *testing.T) {
+	ops, err := ParsePatch([]byte(`[
+		{ "op": "add", "path": "/a", "value": { "b": [1, 2.5] } },
+		{ "op": "move", "from": "/a", "path": "/c" }
+	]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []PatchOperation{
+		{Op: "add", Path: "/a", Value: bson.D{{Key: "b", Value: bson.A{int32(1), 2.5}}}},
+		{Op: "move", Path: "/c", From: "/a"},
+	}, ops)
+
+	_, err = ParsePatch([]byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestApplyPatch(t *testing.T) {
+	doc := &bson.D{
+		{Key: "a", Value: "b"},
+		{Key: "c", Value: bson.D{
+			{Key: "d", Value: bson.A{"e", "f"}},
+		}},
+		{Key: "g/h", Value: int32(1)},
+		{Key: "i~j", Value: int32(2)},
+	}
+
+	table := []struct {
+		op  PatchOperation
+		res *bson.D
+		err string
+	}{
+		{
+			op: PatchOperation{Op: "add", Path: "/x", Value: bson.M{"y": "z"}},
+			res: &bson.D{
+				{Key: "a", Value: "b"},
+				{Key: "c", Value: bson.D{{Key: "d", Value: bson.A{"e", "f"}}}},
+				{Key: "g/h", Value: int32(1)},
+				{Key: "i~j", Value: int32(2)},
+				{Key: "x", Value: bson.D{{Key: "y", Value: "z"}}},
+			},
+		},
+		{
+			op: PatchOperation{Op: "add", Path: "/c/d/1", Value: "x"},
+			res: &bson.D{
+				{Key: "a", Value: "b"},
+				{Key: "c", Value: bson.D{{Key: "d", Value: bson.A{"e", "x", "f"}}}},
+				{Key: "g/h", Value: int32(1)},
+				{Key: "i~j", Value: int32(2)},
+			},
+		},
+		{
+			op: PatchOperation{Op: "add", Path: "/c/d/-", Value: "x"},
+			res: &bson.D{
+				{Key: "a", Value: "b"},
+				{Key: "c", Value: bson.D{{Key: "d", Value: bson.A{"e", "f", "x"}}}},
+				{Key: "g/h", Value: int32(1)},
+				{Key: "i~j", Value: int32(2)},
+			},
+		},
+		{
+			op: PatchOperation{Op: "remove", Path: "/g~1h"},
+			res: &bson.D{
+				{Key: "a", Value: "b"},
+				{Key: "c", Value: bson.D{{Key: "d", Value: bson.A{"e", "f"}}}},
+				{Key: "i~j", Value: int32(2)},
+			},
+		},
+		{
+			op: PatchOperation{Op: "replace", Path: "/i~0j", Value: "x"},
+			res: &bson.D{
+				{Key: "a", Value: "b"},
+				{Key: "c", Value: bson.D{{Key: "d", Value: bson.A{"e", "f"}}}},
+				{Key: "g/h", Value: int32(1)},
+				{Key: "i~j", Value: "x"},
+			},
+		},
+		{
+			op: PatchOperation{Op: "move", From: "/c/d/0", Path: "/a"},
+			res: &bson.D{
+				{Key: "a", Value: "e"},
+				{Key: "c", Value: bson.D{{Key: "d", Value: bson.A{"f"}}}},
+				{Key: "g/h", Value: int32(1)},
+				{Key: "i~j", Value: int32(2)},
+			},
+		},
+		{
+			op: PatchOperation{Op: "copy", From: "/c", Path: "/x"},
+			res: &bson.D{
+				{Key: "a", Value: "b"},
+				{Key: "c", Value: bson.D{{Key: "d", Value: bson.A{"e", "f"}}}},
+				{Key: "g/h", Value: int32(1)},
+				{Key: "i~j", Value: int32(2)},
+				{Key: "x", Value: bson.D{{Key: "d", Value: bson.A{"e", "f"}}}},
+			},
+		},
+		{
+			op:  PatchOperation{Op: "test", Path: "/c/d/1", Value: "f"},
+			res: doc,
+		},
+		{
+			op:  PatchOperation{Op: "test", Path: "/g~1h", Value: int64(1)},
+			err: `operation 0: test failed at "/g~1h"`,
+		},
+		{
+			op:  PatchOperation{Op: "replace", Path: "/x", Value: "y"},
+			err: `operation 0: missing field "x"`,
+		},
+		{
+			op:  PatchOperation{Op: "remove", Path: "/c/d/2"},
+			err: `operation 0: array index "2" out of bounds`,
+		},
+		{
+			op:  PatchOperation{Op: "add", Path: "/c/d/01", Value: "x"},
+			err: `operation 0: invalid array index "01"`,
+		},
+		{
+			op:  PatchOperation{Op: "move", From: "/c", Path: "/c/x"},
+			err: `operation 0: cannot move "/c" into itself`,
+		},
+		{
+			op:  PatchOperation{Op: "add", Path: "a", Value: "x"},
+			err: `operation 0: invalid pointer "a"`,
+		},
+		{
+			op:  PatchOperation{Op: "remove", Path: ""},
+			err: `operation 0: cannot remove root`,
+		},
+		{
+			op:  PatchOperation{Op: "replace", Path: "", Value: "x"},
+			err: `patch result is not a document`,
+		},
+		{
+			op:  PatchOperation{Op: "foo", Path: "/a"},
+			err: `operation 0: unsupported patch operation "foo"`,
+		},
+	}
+
+	for _, item := range table {
+		res, err := ApplyPatch(doc, []PatchOperation{item.op})
+		if item.err != "" {
+			assert.EqualError(t, err, item.err, item.op)
+			assert.Nil(t, res)
+		} else {
+			assert.NoError(t, err, item.op)
+			assert.Equal(t, item.res, res, item.op)
+		}
+	}
+
+	// atomic
+	res, err := ApplyPatch(doc, []PatchOperation{
+		{Op: "remove", Path: "/a"},
+		{Op: "test", Path: "/a", Value: "b"},
+	})
+	assert.Error(t, err)
+	assert.Nil(t, res)
+	assert.Equal(t, "b", Get(doc, "a"))
+}
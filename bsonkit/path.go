@@ -4,6 +4,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // PathEnd is returned by X if the end of the path has been reached.
@@ -237,3 +239,60 @@ func (b *PathBuilder) Truncate(len int) {
 func (b *PathBuilder) String() string {
 	return string(b.buf[:b.len])
 }
+
+// Paths will call the provided function with every leaf path and value of the
+// document in order. Nested documents are descended and, if expand is true,
+// array elements are yielded using their index as path segment. Otherwise,
+// arrays are yielded as a whole. Empty documents and arrays are yielded as
+// leaves. Iteration stops if the function returns false. The function returns
+// whether all paths have been visited.
+func Paths(doc Doc, expand bool, fn func(path string, value interface{}) bool) bool {
+	// check document
+	if doc == nil {
+		return true
+	}
+
+	return walkPaths(*doc, "", expand, fn)
+}
+
+func walkPaths(value interface{}, prefix string, expand bool, fn func(string, interface{}) bool) bool {
+	switch value := value.(type) {
+	case bson.D:
+		// yield empty document
+		if len(value) == 0 && prefix != "" {
+			return fn(prefix, value)
+		}
+
+		// descend fields
+		for _, field := range value {
+			if !walkPaths(field.Value, joinPath(prefix, field.Key), expand, fn) {
+				return false
+			}
+		}
+
+		return true
+	case bson.A:
+		// yield array as a whole
+		if !expand || len(value) == 0 {
+			return fn(prefix, value)
+		}
+
+		// descend elements
+		for i, item := range value {
+			if !walkPaths(item, joinPath(prefix, strconv.Itoa(i)), expand, fn) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return fn(prefix, value)
+	}
+}
+
+func joinPath(prefix, segment string) string {
+	if prefix == "" {
+		return segment
+	}
+	return prefix + "." + segment
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestReducePath(t *testing.T) {
@@ -177,3 +178,69 @@ func BenchmarkPathBuilder(b *testing.B) {
 		_ = pb.String()
 	}
 }
+
+func TestPaths(t *testing.T) {
+	doc := &bson.D{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: bson.D{
+			{Key: "c", Value: int32(2)},
+			{Key: "d", Value: bson.D{}},
+		}},
+		{Key: "e", Value: bson.A{
+			"3",
+			bson.D{{Key: "f", Value: true}},
+			bson.A{},
+		}},
+		{Key: "g", Value: nil},
+	}
+
+	type pair struct {
+		path  string
+		value interface{}
+	}
+
+	collect := func(expand bool, limit int) ([]pair, bool) {
+		var pairs []pair
+		ok := Paths(doc, expand, func(path string, value interface{}) bool {
+			pairs = append(pairs, pair{path, value})
+			return limit <= 0 || len(pairs) < limit
+		})
+		return pairs, ok
+	}
+
+	pairs, ok := collect(true, 0)
+	assert.True(t, ok)
+	assert.Equal(t, []pair{
+		{"a", "1"},
+		{"b.c", int32(2)},
+		{"b.d", bson.D{}},
+		{"e.0", "3"},
+		{"e.1.f", true},
+		{"e.2", bson.A{}},
+		{"g", nil},
+	}, pairs)
+
+	pairs, ok = collect(false, 0)
+	assert.True(t, ok)
+	assert.Equal(t, []pair{
+		{"a", "1"},
+		{"b.c", int32(2)},
+		{"b.d", bson.D{}},
+		{"e", bson.A{"3", bson.D{{Key: "f", Value: true}}, bson.A{}}},
+		{"g", nil},
+	}, pairs)
+
+	pairs, ok = collect(true, 2)
+	assert.False(t, ok)
+	assert.Equal(t, []pair{
+		{"a", "1"},
+		{"b.c", int32(2)},
+	}, pairs)
+
+	assert.True(t, Paths(nil, true, func(string, interface{}) bool {
+		panic("unexpected call")
+	}))
+	assert.True(t, Paths(&bson.D{}, true, func(string, interface{}) bool {
+		panic("unexpected call")
+	}))
+}
@@ -0,0 +1,40 @@
+package bsonkit
+
+import "sync"
+
+// maxPooledList is the maximum capacity of lists kept in the pool.
+const maxPooledList = 1 << 20
+
+var listPool sync.Pool
+
+// AcquireList will return an empty list with at least the specified capacity.
+// The list is taken from a pool if possible and may be returned using
+// ReleaseList once it is not used anymore. Lists that are not released are
+// collected as usual.
+func AcquireList(capacity int) List {
+	// get pooled list
+	ptr, ok := listPool.Get().(*List)
+	if ok && cap(*ptr) >= capacity {
+		return (*ptr)[:0]
+	}
+
+	return make(List, 0, capacity)
+}
+
+// ReleaseList will return the list to the pool. The list must not be used by
+// the caller afterwards.
+func ReleaseList(list List) {
+	// check capacity
+	if cap(list) == 0 || cap(list) > maxPooledList {
+		return
+	}
+
+	// clear references
+	list = list[:cap(list)]
+	for i := range list {
+		list[i] = nil
+	}
+
+	// put list
+	listPool.Put(&list)
+}
@@ -0,0 +1,61 @@
+package bsonkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestListPool(t *testing.T) {
+	d1 := &bson.D{}
+
+	list := AcquireList(10)
+	assert.Len(t, list, 0)
+	assert.GreaterOrEqual(t, cap(list), 10)
+
+	list = append(list, d1)
+	ReleaseList(list)
+	assert.Nil(t, list[:1][0])
+
+	list = AcquireList(5)
+	assert.Len(t, list, 0)
+	assert.GreaterOrEqual(t, cap(list), 5)
+
+	list = AcquireList(100)
+	assert.Len(t, list, 0)
+	assert.GreaterOrEqual(t, cap(list), 100)
+
+	ReleaseList(nil)
+}
+
+var benchList List
+
+func BenchmarkListAllocate(b *testing.B) {
+	d1 := &bson.D{}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		list := make(List, 0, 1000)
+		for j := 0; j < 1000; j++ {
+			list = append(list, d1)
+		}
+		benchList = list
+	}
+}
+
+func BenchmarkListPool(b *testing.B) {
+	d1 := &bson.D{}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		list := AcquireList(1000)
+		for j := 0; j < 1000; j++ {
+			list = append(list, d1)
+		}
+		benchList = list
+		ReleaseList(list)
+	}
+}
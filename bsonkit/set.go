@@ -1,16 +1,75 @@
 package bsonkit
 
+import (
+	"sort"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/tidwall/btree"
+)
+
+type setItem struct {
+	doc Doc
+	seq uint64
+}
+
+// setArrays is the owner token of the list and sequence arrays of a set. It is
+// shared by all sets that use the same arrays and marked shared atomically as
+// the original of a clone may be part of a catalog that is read concurrently.
+type setArrays struct {
+	shared atomic.Bool
+}
+
 // Set is set of unique documents. The set is not safe from concurrent access.
+//
+// Documents are identified by their address unless the set has been created
+// using NewKeyedSet, in which case documents are identified by their _id field
+// and documents without an _id field by their address. Keyed sets therefore
+// accept value-equal documents in Has, Position, Get, Replace and Remove.
+//
+// Cloned sets share their structures with the original set until they are
+// modified. The document lookup index is a copy on write btree while the list
+// is only copied when the first document is replaced or removed.
 type Set struct {
-	List  List
-	Index map[Doc]int
+	List List
+
+	seqs   []uint64
+	index  *btree.BTreeG[setItem]
+	next   uint64
+	keyed  bool
+	arrays *setArrays
 }
 
-// NewSet returns a new set from the specified list.
+// NewSet returns a new set from the specified list that identifies documents
+// by their address.
 func NewSet(list List) *Set {
+	return newSet(list, false)
+}
+
+// NewKeyedSet returns a new set from the specified list that identifies
+// documents by their _id field.
+func NewKeyedSet(list List) *Set {
+	return newSet(list, true)
+}
+
+func newSet(list List, keyed bool) *Set {
+	// prepare comparator
+	less := func(a, b setItem) bool {
+		return compareAddresses(a.doc, b.doc) < 0
+	}
+	if keyed {
+		less = func(a, b setItem) bool {
+			return compareIdentities(a.doc, b.doc) < 0
+		}
+	}
+
 	// create set
 	set := &Set{
-		Index: make(map[Doc]int, len(list)),
+		List:   make(List, 0, len(list)),
+		seqs:   make([]uint64, 0, len(list)),
+		index:  btree.NewBTreeG[setItem](less),
+		keyed:  keyed,
+		arrays: &setArrays{},
 	}
 
 	// add documents
@@ -21,41 +80,102 @@ func NewSet(list List) *Set {
 	return set
 }
 
+// Keyed returns whether the set identifies documents by their _id field.
+func (s *Set) Keyed() bool {
+	return s.keyed
+}
+
+// Has returns whether the document has been added to the set.
+func (s *Set) Has(doc Doc) bool {
+	_, ok := s.index.Get(setItem{doc: doc})
+	return ok
+}
+
+// Get returns the added document that has the identity of the specified
+// document. It may return false if no such document has been added.
+func (s *Set) Get(doc Doc) (Doc, bool) {
+	item, ok := s.index.Get(setItem{doc: doc})
+	return item.doc, ok
+}
+
+// Position returns the position of the document in the set list. It may
+// return false if the document has not been added to the set.
+func (s *Set) Position(doc Doc) (int, bool) {
+	// get item
+	item, ok := s.index.Get(setItem{doc: doc})
+	if !ok {
+		return 0, false
+	}
+
+	// find position
+	i := sort.Search(len(s.seqs), func(i int) bool {
+		return s.seqs[i] >= item.seq
+	})
+
+	return i, true
+}
+
+// Sequence returns the sequence of the document. Sequences are assigned in
+// increasing order when documents are added and kept when documents are
+// replaced. It may return false if the document has not been added.
+func (s *Set) Sequence(doc Doc) (uint64, bool) {
+	item, ok := s.index.Get(setItem{doc: doc})
+	return item.seq, ok
+}
+
+// After returns the position of the first document in the set list that has a
+// sequence greater than the specified sequence.
+func (s *Set) After(seq uint64) int {
+	return sort.Search(len(s.seqs), func(i int) bool {
+		return s.seqs[i] > seq
+	})
+}
+
 // Add will add the document to set, if has not already been added. It may return
 // false if the document has already been added.
 func (s *Set) Add(doc Doc) bool {
 	// check if already added
-	if _, ok := s.Index[doc]; ok {
+	if s.Has(doc) {
 		return false
 	}
 
 	// append document
 	s.List = append(s.List, doc)
-	s.Index[doc] = len(s.List) - 1
+	s.seqs = append(s.seqs, s.next)
+	s.index.Set(setItem{doc: doc, seq: s.next})
+	s.next++
 
 	return true
 }
 
 // Replace will replace the first document with the second. It may return false
-// if the first document has not been added and the second already has been added.
+// if the first document has not been added and the second already has been
+// added. In keyed sets, the second document may have the same _id as the
+// first.
 func (s *Set) Replace(d1, d2 Doc) bool {
-	// get index
-	index, ok := s.Index[d1]
+	// get position
+	i, ok := s.Position(d1)
 	if !ok {
 		return false
 	}
 
+	// get added document
+	old := s.List[i]
+
 	// check existence
-	if _, ok := s.Index[d2]; ok {
+	if s.Has(d2) && (!s.keyed || compareIdentities(old, d2) != 0) {
 		return false
 	}
 
+	// ensure list is owned
+	s.own()
+
 	// replace document
-	s.List[index] = d2
+	s.List[i] = d2
 
 	// update index
-	delete(s.Index, d1)
-	s.Index[d2] = index
+	s.index.Delete(setItem{doc: old})
+	s.index.Set(setItem{doc: d2, seq: s.seqs[i]})
 
 	return true
 }
@@ -63,40 +183,120 @@ func (s *Set) Replace(d1, d2 Doc) bool {
 // Remove will remove the document from the set. It may return false if the
 // document has not been added to the set.
 func (s *Set) Remove(doc Doc) bool {
-	// check if document has been added
-	i, ok := s.Index[doc]
+	// get position
+	i, ok := s.Position(doc)
 	if !ok {
 		return false
 	}
 
+	// ensure list is owned
+	s.own()
+
 	// remove document
 	s.List = append(s.List[:i], s.List[i+1:]...)
-	delete(s.Index, doc)
-
-	// update index
-	for ; i < len(s.List); i++ {
-		s.Index[s.List[i]] = i
-	}
+	s.seqs = append(s.seqs[:i], s.seqs[i+1:]...)
+	s.index.Delete(setItem{doc: doc})
 
 	return true
 }
 
 // Clone will clone the set. Mutating the new set will not mutate the original
-// set.
+// set. The original set itself is not modified and may be cloned concurrently.
 func (s *Set) Clone() *Set {
-	// prepare clone
+	// mark arrays as shared
+	s.arrays.shared.Store(true)
+
+	// prepare clone, capping the list ensures that appends will copy it
 	clone := &Set{
-		List:  make(List, len(s.List)),
-		Index: make(map[Doc]int, len(s.Index)),
+		List:   s.List[:len(s.List):len(s.List)],
+		seqs:   s.seqs[:len(s.seqs):len(s.seqs)],
+		index:  s.index.Copy(),
+		next:   s.next,
+		keyed:  s.keyed,
+		arrays: s.arrays,
+	}
+
+	return clone
+}
+
+// Rebuild will return a copy of the set that does not share any structures
+// with the original set. The sequences of the documents are kept.
+func (s *Set) Rebuild() *Set {
+	// create set
+	set := newSet(nil, s.keyed)
+	set.List = make(List, len(s.List))
+	set.seqs = make([]uint64, len(s.seqs))
+	set.next = s.next
+
+	// copy documents and sequences
+	copy(set.List, s.List)
+	copy(set.seqs, s.seqs)
+
+	// build index
+	for i, doc := range set.List {
+		set.index.Set(setItem{doc: doc, seq: set.seqs[i]})
+	}
+
+	return set
+}
+
+func (s *Set) own() {
+	// check arrays
+	if !s.arrays.shared.Load() {
+		return
 	}
 
 	// copy list
-	copy(clone.List, s.List)
+	list := make(List, len(s.List), cap(s.List))
+	copy(list, s.List)
+	s.List = list
+
+	// copy sequences
+	seqs := make([]uint64, len(s.seqs), cap(s.seqs))
+	copy(seqs, s.seqs)
+	s.seqs = seqs
+
+	// set owned arrays
+	s.arrays = &setArrays{}
+}
+
+func compareAddresses(l, r Doc) int {
+	// get addresses
+	al := uintptr(unsafe.Pointer(l))
+	ar := uintptr(unsafe.Pointer(r))
 
-	// copy index
-	for doc, index := range s.Index {
-		clone.Index[doc] = index
+	// compare addresses
+	if al == ar {
+		return 0
+	} else if al < ar {
+		return -1
 	}
 
-	return clone
+	return 1
+}
+
+func compareIdentities(l, r Doc) int {
+	// get ids
+	lid := documentID(l)
+	rid := documentID(r)
+
+	// compare ids, documents with ids sort first
+	if lid != Missing && rid != Missing {
+		return Compare(lid, rid)
+	} else if lid != Missing {
+		return -1
+	} else if rid != Missing {
+		return 1
+	}
+
+	return compareAddresses(l, r)
+}
+
+func documentID(doc Doc) interface{} {
+	// check first field
+	if len(*doc) > 0 && (*doc)[0].Key == "_id" {
+		return (*doc)[0].Value
+	}
+
+	return Get(doc, "_id")
 }
@@ -15,73 +15,35 @@ func TestSet(t *testing.T) {
 
 	ok := set.Add(d1)
 	assert.True(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d1},
-		Index: map[Doc]int{
-			d1: 0,
-		},
-	}, set)
+	assertSet(t, List{d1}, set)
 
 	ok = set.Add(d1)
 	assert.False(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d1},
-		Index: map[Doc]int{
-			d1: 0,
-		},
-	}, set)
+	assertSet(t, List{d1}, set)
 
 	ok = set.Add(d2)
 	assert.True(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d1, d2},
-		Index: map[Doc]int{
-			d1: 0,
-			d2: 1,
-		},
-	}, set)
+	assertSet(t, List{d1, d2}, set)
 
 	ok = set.Remove(d1)
 	assert.True(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d2},
-		Index: map[Doc]int{
-			d2: 0,
-		},
-	}, set)
+	assertSet(t, List{d2}, set)
 
 	ok = set.Add(d1)
 	assert.True(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d2, d1},
-		Index: map[Doc]int{
-			d2: 0,
-			d1: 1,
-		},
-	}, set)
+	assertSet(t, List{d2, d1}, set)
 
 	ok = set.Remove(d2)
 	assert.True(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d1},
-		Index: map[Doc]int{
-			d1: 0,
-		},
-	}, set)
+	assertSet(t, List{d1}, set)
 
 	ok = set.Remove(d1)
 	assert.True(t, ok)
-	assert.Equal(t, &Set{
-		List:  List{},
-		Index: map[Doc]int{},
-	}, set)
+	assertSet(t, List{}, set)
 
 	ok = set.Remove(d1)
 	assert.False(t, ok)
-	assert.Equal(t, &Set{
-		List:  List{},
-		Index: map[Doc]int{},
-	}, set)
+	assertSet(t, List{}, set)
 }
 
 func TestSetReplace(t *testing.T) {
@@ -94,34 +56,172 @@ func TestSetReplace(t *testing.T) {
 
 	ok := set.Replace(d2, d4)
 	assert.True(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d1, d4, d3},
-		Index: map[Doc]int{
-			d1: 0,
-			d4: 1,
-			d3: 2,
-		},
-	}, set)
+	assertSet(t, List{d1, d4, d3}, set)
 
 	ok = set.Replace(d2, d4)
 	assert.False(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d1, d4, d3},
-		Index: map[Doc]int{
-			d1: 0,
-			d4: 1,
-			d3: 2,
-		},
-	}, set)
+	assertSet(t, List{d1, d4, d3}, set)
 
 	ok = set.Replace(d1, d3)
 	assert.False(t, ok)
-	assert.Equal(t, &Set{
-		List: List{d1, d4, d3},
-		Index: map[Doc]int{
-			d1: 0,
-			d4: 1,
-			d3: 2,
-		},
-	}, set)
+	assertSet(t, List{d1, d4, d3}, set)
+}
+
+func TestSetClone(t *testing.T) {
+	d1 := &bson.D{}
+	d2 := &bson.D{}
+	d3 := &bson.D{}
+	d4 := &bson.D{}
+
+	set := NewSet(List{d1, d2})
+
+	clone := set.Clone()
+	assertSet(t, List{d1, d2}, clone)
+
+	ok := clone.Add(d3)
+	assert.True(t, ok)
+	assertSet(t, List{d1, d2, d3}, clone)
+	assertSet(t, List{d1, d2}, set)
+
+	ok = set.Add(d4)
+	assert.True(t, ok)
+	assertSet(t, List{d1, d2, d4}, set)
+	assertSet(t, List{d1, d2, d3}, clone)
+
+	ok = clone.Replace(d1, d4)
+	assert.True(t, ok)
+	assertSet(t, List{d4, d2, d3}, clone)
+	assertSet(t, List{d1, d2, d4}, set)
+
+	ok = set.Remove(d2)
+	assert.True(t, ok)
+	assertSet(t, List{d1, d4}, set)
+	assertSet(t, List{d4, d2, d3}, clone)
+
+	clone2 := clone.Clone()
+	ok = clone2.Remove(d4)
+	assert.True(t, ok)
+	assertSet(t, List{d2, d3}, clone2)
+	assertSet(t, List{d4, d2, d3}, clone)
+	assertSet(t, List{d1, d4}, set)
+}
+
+func TestKeyedSet(t *testing.T) {
+	d1 := &bson.D{{Key: "_id", Value: int32(1)}, {Key: "v", Value: "a"}}
+	d2 := &bson.D{{Key: "v", Value: "b"}, {Key: "_id", Value: int32(2)}}
+	d3 := &bson.D{{Key: "v", Value: "c"}}
+	d4 := &bson.D{{Key: "v", Value: "c"}}
+
+	set := NewKeyedSet(List{d1, d2, d3})
+	assertSet(t, List{d1, d2, d3}, set)
+
+	// value equal documents
+	assert.True(t, set.Has(&bson.D{{Key: "_id", Value: int64(1)}}))
+	assert.True(t, set.Has(&bson.D{{Key: "_id", Value: 2.0}}))
+	assert.False(t, set.Has(&bson.D{{Key: "_id", Value: int32(3)}}))
+	pos, ok := set.Position(&bson.D{{Key: "_id", Value: int32(2)}})
+	assert.True(t, ok)
+	assert.Equal(t, 1, pos)
+	doc, ok := set.Get(&bson.D{{Key: "_id", Value: int32(2)}})
+	assert.True(t, ok)
+	assert.True(t, doc == d2)
+
+	// documents without id are identified by address
+	assert.True(t, set.Has(d3))
+	assert.False(t, set.Has(d4))
+
+	// duplicate id
+	ok = set.Add(&bson.D{{Key: "_id", Value: int32(1)}})
+	assert.False(t, ok)
+	assertSet(t, List{d1, d2, d3}, set)
+
+	// replace with same id
+	d5 := &bson.D{{Key: "_id", Value: int32(1)}, {Key: "v", Value: "d"}}
+	ok = set.Replace(&bson.D{{Key: "_id", Value: int32(1)}}, d5)
+	assert.True(t, ok)
+	assertSet(t, List{d5, d2, d3}, set)
+
+	// replace with existing id
+	ok = set.Replace(d5, &bson.D{{Key: "_id", Value: int32(2)}})
+	assert.False(t, ok)
+	assertSet(t, List{d5, d2, d3}, set)
+
+	// remove value equal document
+	ok = set.Remove(&bson.D{{Key: "_id", Value: int32(2)}})
+	assert.True(t, ok)
+	assertSet(t, List{d5, d3}, set)
+
+	// clone
+	clone := set.Clone()
+	ok = clone.Remove(&bson.D{{Key: "_id", Value: int32(1)}})
+	assert.True(t, ok)
+	assertSet(t, List{d3}, clone)
+	assertSet(t, List{d5, d3}, set)
+}
+
+func assertSet(t *testing.T, list List, set *Set) {
+	assert.Equal(t, list, set.List)
+	assert.Equal(t, len(list), set.index.Len())
+	for i, doc := range list {
+		assert.True(t, set.Has(doc))
+		pos, ok := set.Position(doc)
+		assert.True(t, ok)
+		assert.Equal(t, i, pos)
+	}
+}
+
+func TestSetSequence(t *testing.T) {
+	d1 := &bson.D{}
+	d2 := &bson.D{}
+	d3 := &bson.D{}
+	d4 := &bson.D{}
+
+	set := NewSet(List{d1, d2, d3})
+
+	seq, ok := set.Sequence(d1)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), seq)
+
+	seq, ok = set.Sequence(d3)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), seq)
+
+	_, ok = set.Sequence(d4)
+	assert.False(t, ok)
+
+	// sequences are not reused
+	ok = set.Remove(d3)
+	assert.True(t, ok)
+	ok = set.Add(d4)
+	assert.True(t, ok)
+	seq, ok = set.Sequence(d4)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), seq)
+
+	// sequences are kept on replace
+	d5 := &bson.D{}
+	ok = set.Replace(d2, d5)
+	assert.True(t, ok)
+	seq, ok = set.Sequence(d5)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), seq)
+
+	assert.Equal(t, 1, set.After(0))
+	assert.Equal(t, 2, set.After(1))
+	assert.Equal(t, 2, set.After(2))
+	assert.Equal(t, 3, set.After(3))
+
+	// rebuild keeps sequences
+	rebuilt := set.Rebuild()
+	assertSet(t, List{d1, d5, d4}, rebuilt)
+	seq, ok = rebuilt.Sequence(d4)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), seq)
+
+	ok = rebuilt.Add(d3)
+	assert.True(t, ok)
+	seq, ok = rebuilt.Sequence(d3)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(4), seq)
+	assertSet(t, List{d1, d5, d4}, set)
 }
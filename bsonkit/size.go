@@ -0,0 +1,32 @@
+package bsonkit
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Size will return the encoded BSON size of the specified document in bytes.
+// Documents that cannot be encoded are reported with a size of zero.
+func Size(doc Doc) int {
+	// check if nil
+	if doc == nil {
+		return 0
+	}
+
+	// encode document
+	bytes, err := bson.Marshal(doc)
+	if err != nil {
+		return 0
+	}
+
+	return len(bytes)
+}
+
+// SizeList will return the sum of the encoded BSON sizes of the specified
+// documents in bytes.
+func SizeList(list List) int {
+	// sum sizes
+	var size int
+	for _, doc := range list {
+		size += Size(doc)
+	}
+
+	return size
+}
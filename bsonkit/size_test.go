@@ -0,0 +1,24 @@
+package bsonkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSize(t *testing.T) {
+	assert.Equal(t, 0, Size(nil))
+	assert.Equal(t, 5, Size(&bson.D{}))
+	assert.Equal(t, 18, Size(&bson.D{
+		bson.E{Key: "foo", Value: "bar"},
+	}))
+
+	assert.Equal(t, 0, SizeList(nil))
+	assert.Equal(t, 23, SizeList(List{
+		&bson.D{},
+		&bson.D{
+			bson.E{Key: "foo", Value: "bar"},
+		},
+	}))
+}
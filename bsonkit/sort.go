@@ -1,6 +1,7 @@
 package bsonkit
 
 import (
+	"container/heap"
 	"sort"
 	"unsafe"
 )
@@ -9,6 +10,9 @@ import (
 type Column struct {
 	Path    string
 	Reverse bool
+
+	// Whether strings are compared case-insensitively using CompareFold.
+	Fold bool
 }
 
 // Sort will sort the list of documents in-place based on the specified columns.
@@ -27,7 +31,12 @@ func Order(l, r Doc, columns []Column, identity bool) int {
 		b := Get(r, column.Path)
 
 		// compare values
-		res := Compare(a, b)
+		var res int
+		if column.Fold {
+			res = CompareFold(a, b)
+		} else {
+			res = Compare(a, b)
+		}
 
 		// continue if equal
 		if res == 0 {
@@ -60,3 +69,72 @@ func Order(l, r Doc, columns []Column, identity bool) int {
 		return 1
 	}
 }
+
+// SortLimit will return a sorted list of the first documents based on the
+// specified columns up to the provided limit. Different to Sort the list is
+// not modified and only the selected documents are sorted, which avoids
+// sorting the whole list if only a few documents are needed.
+func SortLimit(list List, columns []Column, identity bool, limit int) List {
+	// sort whole list if limit is absent or exceeds the list
+	if limit <= 0 || limit >= len(list) {
+		result := make(List, len(list))
+		copy(result, list)
+		Sort(result, columns, identity)
+		return result
+	}
+
+	// prepare heap that keeps the largest document on top
+	h := &docHeap{
+		list: make(List, 0, limit),
+		less: func(a, b Doc) bool {
+			return Order(a, b, columns, identity) > 0
+		},
+	}
+
+	// select documents
+	for _, doc := range list {
+		// add documents until the heap is full
+		if len(h.list) < limit {
+			heap.Push(h, doc)
+			continue
+		}
+
+		// replace the largest document if the document is smaller
+		if Order(doc, h.list[0], columns, identity) < 0 {
+			h.list[0] = doc
+			heap.Fix(h, 0)
+		}
+	}
+
+	// sort selected documents
+	Sort(h.list, columns, identity)
+
+	return h.list
+}
+
+type docHeap struct {
+	list List
+	less func(a, b Doc) bool
+}
+
+func (h *docHeap) Len() int {
+	return len(h.list)
+}
+
+func (h *docHeap) Less(i, j int) bool {
+	return h.less(h.list[i], h.list[j])
+}
+
+func (h *docHeap) Swap(i, j int) {
+	h.list[i], h.list[j] = h.list[j], h.list[i]
+}
+
+func (h *docHeap) Push(x interface{}) {
+	h.list = append(h.list, x.(Doc))
+}
+
+func (h *docHeap) Pop() interface{} {
+	doc := h.list[len(h.list)-1]
+	h.list = h.list[:len(h.list)-1]
+	return doc
+}
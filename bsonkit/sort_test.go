@@ -51,6 +51,26 @@ func TestSort(t *testing.T) {
 	assert.Equal(t, List{a2, a3, a1}, list)
 }
 
+func TestSortFold(t *testing.T) {
+	a1 := MustConvert(bson.M{"a": "b"})
+	a2 := MustConvert(bson.M{"a": "C"})
+	a3 := MustConvert(bson.M{"a": "A"})
+
+	// sort binary
+	list := List{a1, a2, a3}
+	Sort(list, []Column{
+		{Path: "a"},
+	}, false)
+	assert.Equal(t, List{a3, a2, a1}, list)
+
+	// sort folded
+	list = List{a1, a2, a3}
+	Sort(list, []Column{
+		{Path: "a", Fold: true},
+	}, false)
+	assert.Equal(t, List{a3, a1, a2}, list)
+}
+
 func TestSortIdentity(t *testing.T) {
 	a1 := MustConvert(bson.M{"a": "1", "b": true})
 	a2 := MustConvert(bson.M{"a": "2", "b": false})
@@ -95,3 +115,81 @@ func TestSortIdentity(t *testing.T) {
 	}, true)
 	assert.Equal(t, List{a2, a3, a4, a1}, list)
 }
+
+func TestSortLimit(t *testing.T) {
+	a1 := MustConvert(bson.M{"a": "1", "b": true})
+	a2 := MustConvert(bson.M{"a": "2", "b": false})
+	a3 := MustConvert(bson.M{"a": "2", "b": false})
+	a4 := MustConvert(bson.M{"a": "3", "b": true})
+	a5 := MustConvert(bson.M{"a": "4", "b": false})
+
+	// limit forwards
+	list := List{a5, a3, a1, a4, a2}
+	res := SortLimit(list, []Column{
+		{Path: "a", Reverse: false},
+	}, true, 2)
+	assert.Equal(t, List{a1, sort2(a2, a3)[0]}, res)
+	assert.Equal(t, List{a5, a3, a1, a4, a2}, list)
+
+	// limit backwards
+	res = SortLimit(list, []Column{
+		{Path: "a", Reverse: true},
+	}, true, 3)
+	assert.Equal(t, List{a5, a4, sort2(a2, a3)[1]}, res)
+
+	// limit multiple
+	res = SortLimit(list, []Column{
+		{Path: "b", Reverse: false},
+		{Path: "a", Reverse: true},
+	}, true, 1)
+	assert.Equal(t, List{a5}, res)
+
+	// limit exceeding list
+	res = SortLimit(list, []Column{
+		{Path: "a", Reverse: false},
+	}, true, 10)
+	assert.Equal(t, List{a1, sort2(a2, a3)[0], sort2(a2, a3)[1], a4, a5}, res)
+	assert.Equal(t, List{a5, a3, a1, a4, a2}, list)
+
+	// no limit
+	res = SortLimit(list, []Column{
+		{Path: "a", Reverse: true},
+	}, true, 0)
+	assert.Equal(t, List{a5, a4, sort2(a2, a3)[1], sort2(a2, a3)[0], a1}, res)
+
+	// equal to full sort
+	for i := 1; i <= len(list); i++ {
+		full := make(List, len(list))
+		copy(full, list)
+		Sort(full, []Column{
+			{Path: "b", Reverse: true},
+			{Path: "a", Reverse: false},
+		}, true)
+		assert.Equal(t, full[:i], SortLimit(list, []Column{
+			{Path: "b", Reverse: true},
+			{Path: "a", Reverse: false},
+		}, true, i))
+	}
+}
+
+func sort2(a, b Doc) List {
+	list := List{a, b}
+	Sort(list, nil, true)
+	return list
+}
+
+func BenchmarkSortLimit(b *testing.B) {
+	list := make(List, 0, 100000)
+	for i := 0; i < 100000; i++ {
+		list = append(list, MustConvert(bson.M{"a": int64((i * 7919) % 100000)}))
+	}
+
+	columns := []Column{{Path: "a"}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		SortLimit(list, columns, true, 10)
+	}
+}
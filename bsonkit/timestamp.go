@@ -34,3 +34,18 @@ func Now() primitive.Timestamp {
 		I: tsCounter,
 	}
 }
+
+// Advance will ensure that timestamps generated by Now are greater than the
+// specified timestamp. It should be used to continue a sequence of timestamps
+// that has been persisted by a previous process.
+func Advance(ts primitive.Timestamp) {
+	// acquire mutex
+	tsMutex.Lock()
+	defer tsMutex.Unlock()
+
+	// advance seconds and counter
+	if ts.T > tsSeconds || (ts.T == tsSeconds && ts.I > tsCounter) {
+		tsSeconds = ts.T
+		tsCounter = ts.I
+	}
+}
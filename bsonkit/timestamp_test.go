@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestGenerate(t *testing.T) {
@@ -13,3 +14,22 @@ func TestGenerate(t *testing.T) {
 	assert.Equal(t, ts1.T, ts1.T)
 	assert.Equal(t, ts2.I, ts1.I+1)
 }
+
+func TestAdvance(t *testing.T) {
+	ts1 := Now()
+
+	Advance(primitive.Timestamp{T: ts1.T, I: ts1.I + 10})
+	ts2 := Now()
+	assert.Equal(t, ts1.T, ts2.T)
+	assert.Equal(t, ts1.I+11, ts2.I)
+
+	Advance(primitive.Timestamp{T: ts1.T + 60, I: 5})
+	ts3 := Now()
+	assert.Equal(t, ts1.T+60, ts3.T)
+	assert.Equal(t, uint32(6), ts3.I)
+
+	Advance(ts1)
+	ts4 := Now()
+	assert.Equal(t, ts3.T, ts4.T)
+	assert.Equal(t, ts3.I+1, ts4.I)
+}
@@ -4,14 +4,21 @@ import (
 	"fmt"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 )
 
 // Transform will transform an arbitrary value into a document composed of known
 // primitives.
 func Transform(v interface{}) (Doc, error) {
+	return TransformWithRegistry(nil, v)
+}
+
+// TransformWithRegistry will transform an arbitrary value into a document
+// composed of known primitives using the specified registry.
+func TransformWithRegistry(r *bsoncodec.Registry, v interface{}) (Doc, error) {
 	// transfer
 	var doc bson.D
-	err := Transfer(v, &doc)
+	err := TransferWithRegistry(r, v, &doc)
 	if err != nil {
 		return nil, err
 	}
@@ -22,8 +29,14 @@ func Transform(v interface{}) (Doc, error) {
 // TransformList will transform an arbitrary value info a list of documents
 // composed of known primitives.
 func TransformList(v interface{}) (List, error) {
+	return TransformListWithRegistry(nil, v)
+}
+
+// TransformListWithRegistry will transform an arbitrary value info a list of
+// documents composed of known primitives using the specified registry.
+func TransformListWithRegistry(r *bsoncodec.Registry, v interface{}) (List, error) {
 	// transform value
-	doc, err := Transform(bson.M{"v": v})
+	doc, err := TransformWithRegistry(r, bson.M{"v": v})
 	if err != nil {
 		return nil, err
 	}
@@ -51,14 +64,25 @@ func TransformList(v interface{}) (List, error) {
 // and unmarshalling it again. This method is not very fast, but it ensures
 // compatibility with custom types that implement the bson.Marshaller interface.
 func Transfer(in, out interface{}) error {
+	return TransferWithRegistry(nil, in, out)
+}
+
+// TransferWithRegistry will transfer data from one type to another using the
+// specified registry. If the registry is absent, the default registry is used.
+func TransferWithRegistry(r *bsoncodec.Registry, in, out interface{}) error {
+	// ensure registry
+	if r == nil {
+		r = bson.DefaultRegistry
+	}
+
 	// marshal to bytes
-	bytes, err := bson.Marshal(in)
+	bytes, err := bson.MarshalWithRegistry(r, in)
 	if err != nil {
 		return err
 	}
 
 	// unmarshal bytes
-	err = bson.Unmarshal(bytes, out)
+	err = bson.UnmarshalWithRegistry(r, bytes, out)
 	if err != nil {
 		return err
 	}
@@ -109,3 +109,21 @@ func TestTransformList(t *testing.T) {
 		MustConvert(bson.M{"bar": "baz"}),
 	}, list)
 }
+
+func TestTransformWithRegistry(t *testing.T) {
+	doc, err := TransformWithRegistry(counterRegistry(), bson.M{"count": counter(42)})
+	assert.NoError(t, err)
+	assert.Equal(t, MustConvert(bson.M{"count": "42"}), doc)
+
+	list, err := TransformListWithRegistry(counterRegistry(), bson.A{
+		bson.M{"count": counter(7)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, List{
+		MustConvert(bson.M{"count": "7"}),
+	}, list)
+
+	doc, err = Transform(bson.M{"count": counter(42)})
+	assert.NoError(t, err)
+	assert.Equal(t, MustConvert(bson.M{"count": int32(42)}), doc)
+}
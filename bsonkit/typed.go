@@ -0,0 +1,30 @@
+package bsonkit
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Primitive is the set of common BSON value types supported by the typed
+// accessors.
+type Primitive interface {
+	string | bool | int32 | int64 | float64 |
+		primitive.ObjectID | primitive.DateTime | primitive.Timestamp |
+		primitive.Decimal128 | primitive.Binary | primitive.Regex |
+		bson.D | bson.A
+}
+
+// GetAs returns the value in the document specified by path if it is of the
+// requested type. It returns the zero value and false if the value is missing
+// or of a different type. Numbers are not converted between types.
+func GetAs[T Primitive](doc Doc, path string) (T, bool) {
+	value, ok := Get(doc, path).(T)
+	return value, ok
+}
+
+// SetTyped will store the typed value in the document at the location
+// specified by path. See Put for details.
+func SetTyped[T Primitive](doc Doc, path string, value T) error {
+	_, err := Put(doc, path, value, false)
+	return err
+}
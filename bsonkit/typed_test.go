@@ -0,0 +1,74 @@
+package bsonkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetAs(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	doc := MustConvert(bson.M{
+		"id": id,
+		"foo": bson.M{
+			"bar": "baz",
+			"num": int32(42),
+		},
+		"list": bson.A{1.5, true},
+	})
+
+	str, ok := GetAs[string](doc, "foo.bar")
+	assert.True(t, ok)
+	assert.Equal(t, "baz", str)
+
+	num, ok := GetAs[int32](doc, "foo.num")
+	assert.True(t, ok)
+	assert.Equal(t, int32(42), num)
+
+	oid, ok := GetAs[primitive.ObjectID](doc, "id")
+	assert.True(t, ok)
+	assert.Equal(t, id, oid)
+
+	f, ok := GetAs[float64](doc, "list.0")
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, f)
+
+	sub, ok := GetAs[bson.D](doc, "foo")
+	assert.True(t, ok)
+	assert.Equal(t, bson.D{{Key: "bar", Value: "baz"}, {Key: "num", Value: int32(42)}}, sub)
+
+	// wrong type
+	n64, ok := GetAs[int64](doc, "foo.num")
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), n64)
+
+	// missing
+	str, ok = GetAs[string](doc, "foo.qux")
+	assert.False(t, ok)
+	assert.Equal(t, "", str)
+}
+
+func TestSetTyped(t *testing.T) {
+	doc := &bson.D{}
+
+	err := SetTyped(doc, "foo.bar", "baz")
+	assert.NoError(t, err)
+
+	err = SetTyped(doc, "num", int64(7))
+	assert.NoError(t, err)
+
+	err = SetTyped(doc, "foo.bar.baz", true)
+	assert.Error(t, err)
+
+	assert.Equal(t, &bson.D{
+		{Key: "foo", Value: bson.D{{Key: "bar", Value: "baz"}}},
+		{Key: "num", Value: int64(7)},
+	}, doc)
+
+	str, ok := GetAs[string](doc, "foo.bar")
+	assert.True(t, ok)
+	assert.Equal(t, "baz", str)
+}
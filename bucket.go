@@ -70,6 +70,7 @@ type BucketChunk struct {
 // large uploads and instead enable the tracking mode and claim the uploads
 // to ensure operational safety.
 type Bucket struct {
+	engine       *Engine
 	tracked      bool
 	files        ICollection
 	chunks       ICollection
@@ -84,8 +85,15 @@ func NewBucket(db IDatabase, opts ...*options.BucketOptions) *Bucket {
 	// merge options
 	opt := options.MergeBucketOptions(opts...)
 
-	// assert supported options
-	assertOptions(opt, map[string]string{
+	// get engine
+	var engine *Engine
+	if d, ok := db.(*Database); ok {
+		engine = d.engine
+	}
+
+	// assert supported options, errors are returned by the first operation
+	// on the bucket collections as they cannot be returned here
+	err := assertOptions(engine, "NewBucket", opt, map[string]string{
 		"Name":           supported,
 		"ChunkSizeBytes": supported,
 		"WriteConcern":   supported,
@@ -111,12 +119,29 @@ func NewBucket(db IDatabase, opts ...*options.BucketOptions) *Bucket {
 		SetReadConcern(opt.ReadConcern).
 		SetReadPreference(opt.ReadPreference)
 
-	return &Bucket{
+	// create bucket
+	bucket := &Bucket{
+		engine:    engine,
 		files:     db.Collection(name+".files", collOpt),
 		chunks:    db.Collection(name+".chunks", collOpt),
 		markers:   db.Collection(name+".markers", collOpt),
 		chunkSize: chunkSize,
 	}
+
+	// set error on collections, the error is only logged for other
+	// collection implementations
+	if err != nil {
+		for _, coll := range []ICollection{bucket.files, bucket.chunks, bucket.markers} {
+			if c, ok := coll.(*Collection); ok {
+				c.err = err
+			} else {
+				engine.log(LogError, "unsupported option", "error", err)
+				break
+			}
+		}
+	}
+
+	return bucket
 }
 
 // GetFilesCollection returns the collection used for storing files.
@@ -305,9 +330,12 @@ func (b *Bucket) OpenDownloadStreamByName(ctx context.Context, name string, opts
 	opt := options.MergeNameOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := assertOptions(b.engine, "Bucket.OpenDownloadStreamByName", opt, map[string]string{
 		"Revision": supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// get revision
 	revision := int(options.DefaultRevision)
@@ -334,14 +362,17 @@ func (b *Bucket) OpenUploadStreamWithID(ctx context.Context, id interface{}, nam
 	opt := options.MergeUploadOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := assertOptions(b.engine, "Bucket.OpenUploadStreamWithID", opt, map[string]string{
 		"ChunkSizeBytes": supported,
 		"Metadata":       supported,
 		"Registry":       ignored,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// ensure indexes
-	err := b.EnsureIndexes(ctx, false)
+	err = b.EnsureIndexes(ctx, false)
 	if err != nil {
 		return nil, err
 	}
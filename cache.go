@@ -0,0 +1,199 @@
+package lungo
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
+)
+
+type queryKey struct {
+	handle    Handle
+	query     string
+	sort      string
+	collation string
+	skip      int
+	limit     int
+}
+
+type queryEntry struct {
+	key       queryKey
+	namespace *mongokit.Collection
+	list      bsonkit.List
+}
+
+// queryCache is a LRU cache of query results. Since namespaces are never
+// modified in place, an entry is valid as long as the namespace it has been
+// computed from is still the current namespace of a catalog.
+type queryCache struct {
+	size    int
+	list    *list.List
+	entries map[queryKey]*list.Element
+	mutex   sync.Mutex
+}
+
+func newQueryCache(size int) *queryCache {
+	return &queryCache{
+		size:    size,
+		list:    list.New(),
+		entries: map[queryKey]*list.Element{},
+	}
+}
+
+func (c *queryCache) key(handle Handle, query, sort, collation bsonkit.Doc, skip, limit int) (queryKey, bool) {
+	// skip queries that depend on the time of evaluation
+	if mongokit.Volatile(query) {
+		return queryKey{}, false
+	}
+
+	// marshal canonical query
+	queryBytes, err := bson.Marshal(canonicalQuery(query))
+	if err != nil {
+		return queryKey{}, false
+	}
+
+	// marshal sort
+	var sortBytes []byte
+	if sort != nil {
+		sortBytes, err = bson.Marshal(sort)
+		if err != nil {
+			return queryKey{}, false
+		}
+	}
+
+	// marshal collation
+	var collationBytes []byte
+	if collation != nil {
+		collationBytes, err = bson.Marshal(collation)
+		if err != nil {
+			return queryKey{}, false
+		}
+	}
+
+	return queryKey{
+		handle:    handle,
+		query:     string(queryBytes),
+		sort:      string(sortBytes),
+		collation: string(collationBytes),
+		skip:      skip,
+		limit:     limit,
+	}, true
+}
+
+// canonicalQuery will return a copy of the query with sorted top-level fields
+// and sorted operator documents. The order of these fields does not affect the
+// result, unlike the order of fields in embedded documents that are matched
+// by equality.
+func canonicalQuery(query bsonkit.Doc) bson.D {
+	// check query
+	if query == nil {
+		return bson.D{}
+	}
+
+	// copy and sort fields
+	doc := sortFields(*query)
+
+	// sort operator documents
+	for i, field := range doc {
+		if ops, ok := field.Value.(bson.D); ok && len(ops) > 0 && isOperatorDoc(ops) {
+			doc[i].Value = sortFields(ops)
+		}
+	}
+
+	return doc
+}
+
+func sortFields(doc bson.D) bson.D {
+	// copy fields
+	sorted := make(bson.D, len(doc))
+	copy(sorted, doc)
+
+	// sort fields
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	return sorted
+}
+
+func isOperatorDoc(doc bson.D) bool {
+	// check keys
+	for _, field := range doc {
+		if !strings.HasPrefix(field.Key, "$") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *queryCache) get(key queryKey, namespace *mongokit.Collection) (bsonkit.List, bool) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// get element
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	// check namespace
+	entry := elem.Value.(*queryEntry)
+	if entry.namespace != namespace {
+		return nil, false
+	}
+
+	// mark as recently used
+	c.list.MoveToFront(elem)
+
+	return entry.list, true
+}
+
+func (c *queryCache) put(key queryKey, namespace *mongokit.Collection, list bsonkit.List) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// update existing entry
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*queryEntry)
+		entry.namespace = namespace
+		entry.list = list
+		c.list.MoveToFront(elem)
+		return
+	}
+
+	// add entry
+	c.entries[key] = c.list.PushFront(&queryEntry{
+		key:       key,
+		namespace: namespace,
+		list:      list,
+	})
+
+	// evict least recently used entries
+	for c.list.Len() > c.size {
+		elem := c.list.Back()
+		c.list.Remove(elem)
+		delete(c.entries, elem.Value.(*queryEntry).key)
+	}
+}
+
+func (c *queryCache) invalidate(catalog *Catalog) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// remove entries of changed namespaces
+	for key, elem := range c.entries {
+		if catalog.Namespaces[key.handle] != elem.Value.(*queryEntry).namespace {
+			c.list.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package lungo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestQueryCache(t *testing.T) {
+	engine, err := CreateEngine(Options{
+		Store:          NewMemoryStore(),
+		QueryCacheSize: 2,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	handle := Handle{"foo", "bar"}
+	query := bsonkit.MustConvert(bson.M{"foo": "bar"})
+	sort := bsonkit.MustConvert(bson.M{"_id": 1})
+
+	/* prepare */
+
+	txn, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	_, err = txn.Insert(handle, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 1, "foo": "bar"}),
+		bsonkit.MustConvert(bson.M{"_id": 2, "foo": "baz"}),
+	}, true)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn)
+	assert.NoError(t, err)
+
+	/* miss and hit */
+
+	txn, err = engine.Begin(nil, false)
+	assert.NoError(t, err)
+
+	res1, err := txn.Find(handle, query, sort, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res1.Matched, 1)
+	assert.Equal(t, 1, engine.cache.list.Len())
+
+	res2, err := txn.Find(handle, bsonkit.MustConvert(bson.M{"foo": "bar"}), sort, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, res1.Matched, res2.Matched)
+	assert.True(t, &res1.Matched[0] == &res2.Matched[0])
+	assert.Equal(t, 1, engine.cache.list.Len())
+
+	res3, err := txn.Find(handle, query, sort, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, res1.Matched, res3.Matched)
+	assert.Equal(t, 2, engine.cache.list.Len())
+
+	/* eviction */
+
+	_, err = txn.Find(handle, query, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, engine.cache.list.Len())
+
+	/* invalidation */
+
+	wtxn, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	_, err = wtxn.Insert(handle, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 3, "foo": "bar"}),
+	}, true)
+	assert.NoError(t, err)
+
+	err = engine.Commit(wtxn)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, engine.cache.list.Len())
+
+	res4, err := txn.Find(handle, query, sort, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res4.Matched, 1)
+
+	txn, err = engine.Begin(nil, false)
+	assert.NoError(t, err)
+
+	res5, err := txn.Find(handle, query, sort, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res5.Matched, 2)
+}
+
+func TestQueryCacheKey(t *testing.T) {
+	cache := newQueryCache(2)
+	handle := Handle{"foo", "bar"}
+
+	key1, ok := cache.key(handle, bsonkit.MustConvert(bson.D{
+		{Key: "a", Value: 1},
+		{Key: "b", Value: bson.D{{Key: "$gt", Value: 1}, {Key: "$lt", Value: 5}}},
+	}), nil, nil, 0, 0)
+	assert.True(t, ok)
+
+	key2, ok := cache.key(handle, bsonkit.MustConvert(bson.D{
+		{Key: "b", Value: bson.D{{Key: "$lt", Value: 5}, {Key: "$gt", Value: 1}}},
+		{Key: "a", Value: 1},
+	}), nil, nil, 0, 0)
+	assert.True(t, ok)
+	assert.Equal(t, key1, key2)
+
+	key3, ok := cache.key(handle, bsonkit.MustConvert(bson.D{
+		{Key: "a", Value: bson.D{{Key: "x", Value: 1}, {Key: "y", Value: 2}}},
+	}), nil, nil, 0, 0)
+	assert.True(t, ok)
+
+	key4, ok := cache.key(handle, bsonkit.MustConvert(bson.D{
+		{Key: "a", Value: bson.D{{Key: "y", Value: 2}, {Key: "x", Value: 1}}},
+	}), nil, nil, 0, 0)
+	assert.True(t, ok)
+	assert.NotEqual(t, key3, key4)
+
+	_, ok = cache.key(handle, bsonkit.MustConvert(bson.M{
+		"$expr": bson.M{"$lt": bson.A{"$t", "$$NOW"}},
+	}), nil, nil, 0, 0)
+	assert.False(t, ok)
+}
+
+func TestQueryCacheVolatile(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:          NewMemoryStore(),
+		QueryCacheSize: 10,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"t": time.Now().Add(100 * time.Millisecond)})
+	assert.NoError(t, err)
+
+	filter := bson.M{"$expr": bson.M{"$lt": bson.A{"$t", "$$NOW"}}}
+
+	n, err := coll.CountDocuments(nil, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	assert.Equal(t, 0, engine.cache.list.Len())
+
+	time.Sleep(150 * time.Millisecond)
+
+	n, err = coll.CountDocuments(nil, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	csr, err := coll.Find(nil, filter)
+	assert.NoError(t, err)
+	assert.Len(t, readAll(csr), 1)
+}
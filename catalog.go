@@ -8,19 +8,81 @@ import (
 )
 
 // Handle is a two component identifier for namespaces where the first part is
-// the database and the second the collection.
+// the database and the second the collection. A handle with an empty
+// collection refers to the whole database. Collection names may contain dots
+// e.g. "fs.files".
 type Handle [2]string
 
+// NewHandle will validate the database and collection names and return a
+// handle. The collection may be empty to refer to the whole database.
+func NewHandle(database, collection string) (Handle, error) {
+	// check database
+	if database == "" {
+		return Handle{}, fmt.Errorf("missing database in handle")
+	} else if len(database) > 64 {
+		return Handle{}, fmt.Errorf("database name %q is too long", database)
+	} else if strings.ContainsAny(database, "/\\. \"$*<>:|?\x00") {
+		return Handle{}, fmt.Errorf("invalid database name %q", database)
+	}
+
+	// check collection
+	if strings.ContainsAny(collection, "$\x00") {
+		return Handle{}, fmt.Errorf("invalid collection name %q", collection)
+	} else if strings.HasPrefix(collection, ".") || strings.HasSuffix(collection, ".") || strings.Contains(collection, "..") {
+		return Handle{}, fmt.Errorf("invalid collection name %q", collection)
+	}
+
+	return Handle{database, collection}, nil
+}
+
+// ParseHandle will parse and validate a namespace string like "db.fs.files".
+// The string is split at the first dot as database names may not contain dots.
+// A string without a dot refers to the whole database.
+func ParseHandle(ns string) (Handle, error) {
+	// split namespace
+	database, collection, ok := strings.Cut(ns, ".")
+	if ok && collection == "" {
+		return Handle{}, fmt.Errorf("missing collection in namespace %q", ns)
+	}
+
+	return NewHandle(database, collection)
+}
+
+// Database will return the database of the handle.
+func (h Handle) Database() string {
+	return h[0]
+}
+
+// Collection will return the collection of the handle.
+func (h Handle) Collection() string {
+	return h[1]
+}
+
+// IsDatabase will return whether the handle refers to a whole database.
+func (h Handle) IsDatabase() bool {
+	return h[0] != "" && h[1] == ""
+}
+
+// Contains will return whether the other handle is the same namespace or, if
+// the handle refers to a database, a namespace of that database.
+func (h Handle) Contains(other Handle) bool {
+	if h.IsDatabase() {
+		return other[0] == h[0]
+	}
+	return other == h
+}
+
 // String will return the string form of the handle.
 func (h Handle) String() string {
 	return strings.Join(h[:], ".")
 }
 
-// Validate will validate the handle.
+// Validate will validate the handle using the rules of NewHandle.
 func (h Handle) Validate(needCollection bool) error {
-	// check database
-	if h[0] == "" {
-		return fmt.Errorf("missing database in handle")
+	// check names
+	_, err := NewHandle(h[0], h[1])
+	if err != nil {
+		return err
 	}
 
 	// check collection
@@ -65,3 +127,17 @@ func (d *Catalog) Clone() *Catalog {
 
 	return clone
 }
+
+// Size will return the encoded BSON size of all documents in bytes, excluding
+// the namespaces of the local database.
+func (d *Catalog) Size() int {
+	// sum sizes
+	var size int
+	for handle, namespace := range d.Namespaces {
+		if handle[0] != Local {
+			size += namespace.Size
+		}
+	}
+
+	return size
+}
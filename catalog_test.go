@@ -0,0 +1,80 @@
+package lungo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHandle(t *testing.T) {
+	handle, err := NewHandle("foo", "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, Handle{"foo", "bar"}, handle)
+	assert.Equal(t, "foo", handle.Database())
+	assert.Equal(t, "bar", handle.Collection())
+	assert.False(t, handle.IsDatabase())
+
+	handle, err = NewHandle("foo", "fs.files")
+	assert.NoError(t, err)
+	assert.Equal(t, Handle{"foo", "fs.files"}, handle)
+	assert.Equal(t, "foo.fs.files", handle.String())
+
+	handle, err = NewHandle("foo", "")
+	assert.NoError(t, err)
+	assert.True(t, handle.IsDatabase())
+
+	for _, item := range [][2]string{
+		{"", "bar"},
+		{"fo.o", "bar"},
+		{"fo o", "bar"},
+		{"fo$o", "bar"},
+		{strings.Repeat("x", 65), "bar"},
+		{"foo", "b$ar"},
+		{"foo", ".bar"},
+		{"foo", "bar."},
+		{"foo", "b..ar"},
+		{"foo", "b\x00ar"},
+	} {
+		handle, err = NewHandle(item[0], item[1])
+		assert.Error(t, err, item)
+		assert.Zero(t, handle)
+	}
+}
+
+func TestParseHandle(t *testing.T) {
+	handle, err := ParseHandle("foo.bar")
+	assert.NoError(t, err)
+	assert.Equal(t, Handle{"foo", "bar"}, handle)
+
+	handle, err = ParseHandle("foo.fs.chunks")
+	assert.NoError(t, err)
+	assert.Equal(t, Handle{"foo", "fs.chunks"}, handle)
+
+	handle, err = ParseHandle("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, Handle{"foo", ""}, handle)
+
+	for _, ns := range []string{"", ".bar", "foo.", "foo..bar"} {
+		_, err = ParseHandle(ns)
+		assert.Error(t, err, ns)
+	}
+}
+
+func TestHandleContains(t *testing.T) {
+	assert.True(t, Handle{"foo", "bar"}.Contains(Handle{"foo", "bar"}))
+	assert.False(t, Handle{"foo", "bar"}.Contains(Handle{"foo", "bar.baz"}))
+	assert.False(t, Handle{"foo", "bar"}.Contains(Handle{"foo", ""}))
+	assert.True(t, Handle{"foo", ""}.Contains(Handle{"foo", "bar"}))
+	assert.True(t, Handle{"foo", ""}.Contains(Handle{"foo", "fs.files"}))
+	assert.False(t, Handle{"foo", ""}.Contains(Handle{"foobar", "baz"}))
+}
+
+func TestHandleValidate(t *testing.T) {
+	assert.NoError(t, Handle{"foo", "bar"}.Validate(true))
+	assert.NoError(t, Handle{"foo", ""}.Validate(false))
+	assert.Error(t, Handle{"foo", ""}.Validate(true))
+	assert.Error(t, Handle{"", "bar"}.Validate(true))
+	assert.Error(t, Handle{"a.b", "bar"}.Validate(true))
+	assert.Error(t, Handle{"foo", "$bar"}.Validate(true))
+}
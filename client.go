@@ -2,8 +2,12 @@ package lungo
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"strconv"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -15,7 +19,8 @@ var _ IClient = &Client{}
 
 // Client wraps an Engine to be mongo compatible.
 type Client struct {
-	engine *Engine
+	engine   *Engine
+	registry *bsoncodec.Registry
 }
 
 // Open will open a lungo database using the provided store.
@@ -29,10 +34,92 @@ func Open(_ context.Context, opts Options) (IClient, *Engine, error) {
 	return NewClient(engine), engine, nil
 }
 
+// ParseURI will parse a lungo connection string and return the corresponding
+// options. Connection strings are also accepted by Connect. The string
+// "lungo://" selects a memory store while a string with a path like
+// "lungo:///path/to/file.db" selects a file store. The "flush" query parameter
+// sets the interval (e.g. "1s") at which a file store is written using a flush
+// store. If missing, every commit is written immediately. The "readOnly" query
+// parameter (e.g. "true") enables the read-only mode. The "snapshot" query
+// parameter sets the path of a file a memory store is loaded from and written
+// to when the engine is closed.
+func ParseURI(uri string) (Options, error) {
+	// parse uri
+	u, err := url.Parse(uri)
+	if err != nil {
+		return Options{}, err
+	}
+
+	// check scheme and host
+	if u.Scheme != "lungo" {
+		return Options{}, fmt.Errorf("invalid scheme %q", u.Scheme)
+	} else if u.Host != "" || u.User != nil {
+		return Options{}, fmt.Errorf("unexpected host %q", u.Host)
+	}
+
+	// get parameters
+	query := u.Query()
+	var flush time.Duration
+	var readOnly bool
+	var snapshot string
+	for key, values := range query {
+		value := values[len(values)-1]
+		switch key {
+		case "flush":
+			flush, err = time.ParseDuration(value)
+			if err != nil || flush < 0 {
+				return Options{}, fmt.Errorf("invalid flush interval %q", value)
+			}
+		case "readOnly":
+			readOnly, err = strconv.ParseBool(value)
+			if err != nil {
+				return Options{}, fmt.Errorf("invalid read-only flag %q", value)
+			}
+		case "snapshot":
+			if value == "" {
+				return Options{}, fmt.Errorf("invalid snapshot path %q", value)
+			}
+			snapshot = value
+		default:
+			return Options{}, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+
+	// use memory store if path is missing
+	if u.Path == "" || u.Path == "/" {
+		if flush > 0 {
+			return Options{}, fmt.Errorf("flush interval requires a path")
+		}
+		return Options{
+			Store: NewMemoryStore(MemoryStoreOptions{
+				SnapshotPath: snapshot,
+			}),
+			ReadOnly: readOnly,
+		}, nil
+	}
+
+	// check snapshot
+	if snapshot != "" {
+		return Options{}, fmt.Errorf("snapshot path requires a memory store")
+	}
+
+	// prepare file store
+	var store Store = NewFileStore(u.Path, 0666)
+	if flush > 0 {
+		store = NewFlushStore(store, flush)
+	}
+
+	return Options{
+		Store:    store,
+		ReadOnly: readOnly,
+	}, nil
+}
+
 // NewClient will create and return a new client.
 func NewClient(engine *Engine) IClient {
 	return &Client{
-		engine: engine,
+		engine:   engine,
+		registry: engine.opts.Registry,
 	}
 }
 
@@ -46,22 +133,34 @@ func (c *Client) Database(name string, opts ...*options.DatabaseOptions) IDataba
 	// merge options
 	opt := options.MergeDatabaseOptions(opts...)
 
-	// assert supported options
-	assertOptions(opt, map[string]string{
+	// assert supported options, errors are returned by the first operation
+	// on the database as they cannot be returned here
+	err := assertOptions(c.engine, "Client.Database", opt, map[string]string{
 		"ReadConcern":    ignored,
 		"WriteConcern":   ignored,
 		"ReadPreference": ignored,
+		"Registry":       supported,
 	})
 
+	// get registry
+	registry := c.registry
+	if opt.Registry != nil {
+		registry = opt.Registry
+	}
+
 	return &Database{
-		name:   name,
-		engine: c.engine,
+		name:     name,
+		engine:   c.engine,
+		registry: registry,
+		err:      err,
 	}
 }
 
-// Disconnect implements the IClient.Disconnect method.
+// Disconnect implements the IClient.Disconnect method. It closes the engine
+// used by the client and returns the error from closing its store.
 func (c *Client) Disconnect(context.Context) error {
-	return nil
+	// close engine
+	return c.engine.close()
 }
 
 // ListDatabaseNames implements the IClient.ListDatabaseNames method.
@@ -87,10 +186,13 @@ func (c *Client) ListDatabases(ctx context.Context, filter interface{}, opts ...
 	opt := options.MergeListDatabasesOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{})
+	err := assertOptions(c.engine, "Client.ListDatabases", opt, map[string]string{})
+	if err != nil {
+		return mongo.ListDatabasesResult{}, err
+	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
 	if err != nil {
 		return mongo.ListDatabasesResult{}, err
 	}
@@ -109,7 +211,7 @@ func (c *Client) ListDatabases(ctx context.Context, filter interface{}, opts ...
 
 	// decode documents
 	specs := make([]mongo.DatabaseSpecification, 0, len(list))
-	err = bsonkit.DecodeList(list, &specs)
+	err = bsonkit.DecodeListWithRegistry(c.registry, list, &specs)
 	if err != nil {
 		return mongo.ListDatabasesResult{}, err
 	}
@@ -131,7 +233,7 @@ func (c *Client) ListDatabases(ctx context.Context, filter interface{}, opts ...
 
 // NumberSessionsInProgress implements the IClient.NumberSessionsInProgress method.
 func (c *Client) NumberSessionsInProgress() int {
-	return 0
+	return c.engine.sessionsInProgress()
 }
 
 // Ping implements the IClient.Ping method.
@@ -145,16 +247,20 @@ func (c *Client) StartSession(opts ...*options.SessionOptions) (ISession, error)
 	opt := options.MergeSessionOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := assertOptions(c.engine, "Client.StartSession", opt, map[string]string{
 		"CausalConsistency":     ignored,
 		"DefaultReadConcern":    ignored,
 		"DefaultReadPreference": ignored,
 		"DefaultWriteConcern":   ignored,
 		"DefaultMaxCommitTime":  ignored,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &Session{
 		engine: c.engine,
+		id:     c.engine.acquireSession(),
 	}, nil
 }
 
@@ -171,17 +277,21 @@ func (c *Client) UseSession(ctx context.Context, fn func(ISessionContext) error)
 // UseSessionWithOptions implements the IClient.UseSessionWithOptions method.
 func (c *Client) UseSessionWithOptions(ctx context.Context, opt *options.SessionOptions, fn func(ISessionContext) error) error {
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := assertOptions(c.engine, "Client.UseSessionWithOptions", opt, map[string]string{
 		"CausalConsistency":     ignored,
 		"DefaultReadConcern":    ignored,
 		"DefaultReadPreference": ignored,
 		"DefaultWriteConcern":   ignored,
 		"DefaultMaxCommitTime":  ignored,
 	})
+	if err != nil {
+		return err
+	}
 
 	// create session
 	session := &Session{
 		engine: c.engine,
+		id:     c.engine.acquireSession(),
 	}
 
 	// ensure ending
@@ -194,7 +304,7 @@ func (c *Client) UseSessionWithOptions(ctx context.Context, opt *options.Session
 	}
 
 	// yield context
-	err := fn(sc)
+	err = fn(sc)
 	if err != nil {
 		return err
 	}
@@ -208,17 +318,21 @@ func (c *Client) Watch(_ context.Context, pipeline interface{}, opts ...*options
 	opt := options.MergeChangeStreamOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"BatchSize":            ignored,
-		"FullDocument":         ignored,
-		"MaxAwaitTime":         ignored,
-		"ResumeAfter":          supported,
-		"StartAtOperationTime": supported,
-		"StartAfter":           supported,
+	err := assertOptions(c.engine, "Client.Watch", opt, map[string]string{
+		"BatchSize":                ignored,
+		"FullDocument":             supported,
+		"FullDocumentBeforeChange": supported,
+		"MaxAwaitTime":             ignored,
+		"ResumeAfter":              supported,
+		"StartAtOperationTime":     supported,
+		"StartAfter":               supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// transform pipeline
-	filter, err := bsonkit.TransformList(pipeline)
+	filter, err := bsonkit.TransformListWithRegistry(c.registry, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -226,7 +340,7 @@ func (c *Client) Watch(_ context.Context, pipeline interface{}, opts ...*options
 	// get resume after
 	var resumeAfter bsonkit.Doc
 	if opt.ResumeAfter != nil {
-		resumeAfter, err = bsonkit.Transform(opt.ResumeAfter)
+		resumeAfter, err = bsonkit.TransformWithRegistry(c.registry, opt.ResumeAfter)
 		if err != nil {
 			return nil, err
 		}
@@ -235,7 +349,7 @@ func (c *Client) Watch(_ context.Context, pipeline interface{}, opts ...*options
 	// get start after
 	var startAfter bsonkit.Doc
 	if opt.StartAfter != nil {
-		startAfter, err = bsonkit.Transform(opt.StartAfter)
+		startAfter, err = bsonkit.TransformWithRegistry(c.registry, opt.StartAfter)
 		if err != nil {
 			return nil, err
 		}
@@ -247,5 +361,18 @@ func (c *Client) Watch(_ context.Context, pipeline interface{}, opts ...*options
 		return nil, err
 	}
 
+	// set registry
+	stream.registry = c.registry
+
+	// set full document
+	if opt.FullDocument != nil {
+		stream.fullDocument = *opt.FullDocument
+	}
+
+	// set full document before change
+	if opt.FullDocumentBeforeChange != nil {
+		stream.fullDocumentBeforeChange = *opt.FullDocumentBeforeChange
+	}
+
 	return stream, nil
 }
@@ -1,11 +1,15 @@
 package lungo
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestClientListDatabasesAndNames(t *testing.T) {
@@ -54,3 +58,136 @@ func TestClientListDatabasesAndNames(t *testing.T) {
 		}, res)
 	})
 }
+
+func TestClientRegistry(t *testing.T) {
+	type model struct {
+		ID   int      `bson:"_id"`
+		Date testDate `bson:"date"`
+	}
+
+	client, engine, err := Open(nil, Options{
+		Store:    NewMemoryStore(),
+		Registry: testRegistry(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	doc := model{
+		ID:   1,
+		Date: testDate{Year: 2020, Month: 1, Day: 2},
+	}
+
+	_, err = coll.InsertOne(nil, doc)
+	assert.NoError(t, err)
+
+	var raw bson.M
+	err = coll.FindOne(nil, bson.M{}, options.FindOne().SetProjection(bson.M{"_id": 0})).Decode(&raw)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{"date": "2020-01-02"}, raw)
+
+	var res model
+	err = coll.FindOne(nil, bson.M{"date": doc.Date}).Decode(&res)
+	assert.NoError(t, err)
+	assert.Equal(t, doc, res)
+}
+
+func TestClientDisconnect(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+
+	err = client.Disconnect(nil)
+	assert.NoError(t, err)
+	assert.True(t, engine.Closed())
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{})
+	assert.ErrorIs(t, err, ErrEngineClosed)
+}
+
+func TestParseURI(t *testing.T) {
+	opts, err := ParseURI("lungo://")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, opts.Store)
+
+	opts, err = ParseURI("lungo:///tmp/data.db")
+	assert.NoError(t, err)
+	assert.Equal(t, NewFileStore("/tmp/data.db", 0666), opts.Store)
+
+	opts, err = ParseURI("lungo:///tmp/data.db?flush=1s")
+	assert.NoError(t, err)
+	assert.Equal(t, NewFlushStore(NewFileStore("/tmp/data.db", 0666), time.Second), opts.Store)
+
+	opts, err = ParseURI("lungo:///tmp/data.db?readOnly=true")
+	assert.NoError(t, err)
+	assert.True(t, opts.ReadOnly)
+
+	opts, err = ParseURI("lungo://?snapshot=/tmp/data.db")
+	assert.NoError(t, err)
+	assert.Equal(t, NewFileStore("/tmp/data.db", 0666), opts.Store.(*MemoryStore).snapshot)
+
+	for _, uri := range []string{
+		"mongodb://localhost",
+		"lungo://localhost/data.db",
+		"lungo:///tmp/data.db?flush=foo",
+		"lungo:///tmp/data.db?foo=bar",
+		"lungo://?flush=1s",
+		"lungo:///tmp/data.db?readOnly=foo",
+		"lungo:///tmp/data.db?snapshot=/tmp/other.db",
+	} {
+		_, err = ParseURI(uri)
+		assert.Error(t, err, uri)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	client, err := Connect(nil, options.Client().ApplyURI("lungo://"+path))
+	assert.NoError(t, err)
+	assert.IsType(t, &Client{}, client)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	err = client.Disconnect(nil)
+	assert.NoError(t, err)
+
+	client, err = Connect(nil, options.Client().ApplyURI("lungo://"+path+"?flush=1h"))
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	err = client.Disconnect(nil)
+	assert.NoError(t, err)
+
+	client, err = Connect(nil, options.Client().ApplyURI("lungo://"+path))
+	assert.NoError(t, err)
+	defer client.Disconnect(nil)
+
+	n, err := client.Database("foo").Collection("bar").CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	_, err = Connect(nil, options.Client().ApplyURI("lungo://?foo=bar"))
+	assert.Error(t, err)
+}
+
+func TestConnectFlushError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	assert.NoError(t, os.Mkdir(dir, 0777))
+
+	client, err := Connect(nil, options.Client().ApplyURI("lungo://"+filepath.Join(dir, "data.db")+"?flush=1h"))
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	// final flush fails
+	assert.NoError(t, os.RemoveAll(dir))
+	err = client.Disconnect(nil)
+	assert.Error(t, err)
+}
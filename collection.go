@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -15,13 +16,104 @@ var _ ICollection = &Collection{}
 
 // Collection wraps an Engine to be mongo compatible.
 type Collection struct {
-	engine *Engine
-	handle Handle
+	engine   *Engine
+	handle   Handle
+	registry *bsoncodec.Registry
+
+	// the unsupported option error of the handle constructor, returned by
+	// all operations
+	err error
 }
 
-// Aggregate implements the ICollection.Aggregate method.
-func (c *Collection) Aggregate(context.Context, interface{}, ...*options.AggregateOptions) (ICursor, error) {
-	panic("lungo: not implemented")
+// Aggregate implements the ICollection.Aggregate method. The pipeline may
+// start with a $collStats stage to obtain the latency and storage statistics
+// of the collection.
+func (c *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (ICursor, error) {
+	// merge options
+	opt := options.MergeAggregateOptions(opts...)
+
+	// assert supported options
+	err := c.assertOptions("Collection.Aggregate", opt, map[string]string{
+		"AllowDiskUse": ignored,
+		"BatchSize":    ignored,
+		"Comment":      supported,
+		"Let":          supported,
+		"MaxTime":      supported,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// check pipeline
+	if pipeline == nil {
+		panic("lungo: missing pipeline")
+	}
+
+	// transform pipeline
+	stages, err := bsonkit.TransformListWithRegistry(c.registry, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	// get variables
+	variables, err := transformLet(c.registry, opt.Let)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "aggregate", opt.Comment, nil)
+	defer done()
+
+	// get first stage
+	var stage bson.E
+	if len(stages) > 0 && len(*stages[0]) == 1 {
+		stage = (*stages[0])[0]
+	}
+
+	// get documents
+	var list bsonkit.List
+	if stage.Key == "$collStats" {
+		// get statistics
+		list, err = c.collStats(ctx, stage.Value)
+		if err != nil {
+			return nil, commandError(contextError(ctx, err))
+		}
+
+		// remove stage
+		stages = stages[1:]
+	} else {
+		// find documents
+		res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
+			return txn.Find(c.handle, &bson.D{}, nil, 0, 0)
+		})
+		if err != nil {
+			return nil, commandError(contextError(ctx, err))
+		}
+
+		// decrypt documents
+		list, err = c.decryptList(res.(*Result).Matched)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// run pipeline
+	list, err = mongokit.Aggregate(&mongokit.AggregationContext{
+		Context:   ctx,
+		Variables: variables,
+		Random:    c.engine.Random(),
+		Functions: c.engine.accumulators(),
+	}, list, stages)
+	if err != nil {
+		return nil, commandError(contextError(ctx, err))
+	}
+
+	return c.engine.trackCursor(&Cursor{engine: c.engine, list: list, registry: c.registry, ns: c.handle.String()}), nil
 }
 
 // BulkWrite implements the ICollection.BulkWrite method.
@@ -30,9 +122,15 @@ func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, o
 	opt := options.MergeBulkWriteOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"Ordered": supported,
+	err := c.assertOptions("Collection.BulkWrite", opt, map[string]string{
+		"BypassDocumentValidation": ignored,
+		"Comment":                  supported,
+		"Let":                      supported,
+		"Ordered":                  supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// get ordered
 	var ordered bool
@@ -40,6 +138,12 @@ func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, o
 		ordered = *opt.Ordered
 	}
 
+	// get variables
+	variables, err := transformLet(c.registry, opt.Let)
+	if err != nil {
+		return nil, err
+	}
+
 	// prepare operations
 	ops := make([]Operation, 0, len(models))
 
@@ -101,20 +205,31 @@ func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, o
 
 		// transform document
 		if document != nil {
-			doc, err := bsonkit.Transform(document)
+			doc, err := bsonkit.TransformWithRegistry(c.registry, document)
 			if err != nil {
 				return nil, err
 			}
+
+			// encrypt or check document
+			if opcode == Update {
+				err = c.checkEncryptedUpdate(doc)
+			} else {
+				err = c.encrypt(doc)
+			}
+			if err != nil {
+				return nil, err
+			}
+
 			op.Document = doc
 		}
 
 		// transform filter
 		if filter != nil {
-			flt, err := bsonkit.Transform(filter)
+			flt, err := bsonkit.TransformWithRegistry(c.registry, filter)
 			if err != nil {
 				return nil, err
 			}
-			op.Filter = flt
+			op.Filter = mongokit.BindVariables(flt, variables)
 		}
 
 		// check upsert
@@ -124,7 +239,7 @@ func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, o
 
 		// transform array filters
 		if arrayFilters != nil {
-			arrFlt, err := bsonkit.TransformList(arrayFilters)
+			arrFlt, err := bsonkit.TransformListWithRegistry(c.registry, arrayFilters)
 			if err != nil {
 				return nil, err
 			}
@@ -135,12 +250,16 @@ func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, o
 		ops = append(ops, op)
 	}
 
+	// monitor operation
+	ctx, done := c.monitor(ctx, "bulkWrite", opt.Comment, nil)
+	defer done()
+
 	// run bulk
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Bulk(c.handle, ops, ordered)
 	})
 	if err != nil {
-		return nil, err
+		return nil, commandError(contextError(ctx, err))
 	}
 
 	// get results
@@ -157,17 +276,13 @@ func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, o
 	}
 
 	// prepare errors
-	errors := make(mongo.WriteErrors, 0, len(results))
+	var writeErrors []mongo.BulkWriteError
 
 	// apply bulk results
 	for i, res := range results {
 		// check error
 		if res.Error != nil {
-			errors = append(errors, mongo.WriteError{
-				Index:   i,
-				Code:    0,
-				Message: res.Error.Error(),
-			})
+			writeErrors = append(writeErrors, writeError(i, res.Error, models[i]))
 			continue
 		}
 
@@ -196,8 +311,10 @@ func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, o
 
 	// prepare error
 	err = nil
-	if len(errors) > 0 {
-		err = errors
+	if len(writeErrors) > 0 {
+		err = mongo.BulkWriteException{
+			WriteErrors: writeErrors,
+		}
 	}
 
 	return result, err
@@ -209,15 +326,26 @@ func (c *Collection) Clone(opts ...*options.CollectionOptions) (ICollection, err
 	opt := options.MergeCollectionOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := c.assertOptions("Collection.Clone", opt, map[string]string{
 		"ReadConcern":    ignored,
 		"WriteConcern":   ignored,
 		"ReadPreference": ignored,
+		"Registry":       supported,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// get registry
+	registry := c.registry
+	if opt.Registry != nil {
+		registry = opt.Registry
+	}
 
 	return &Collection{
-		engine: c.engine,
-		handle: c.handle,
+		engine:   c.engine,
+		handle:   c.handle,
+		registry: registry,
 	}, nil
 }
 
@@ -227,11 +355,15 @@ func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opt
 	opt := options.MergeCountOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := c.assertOptions("Collection.CountDocuments", opt, map[string]string{
+		"Comment": supported,
 		"Limit":   supported,
-		"MaxTime": ignored,
+		"MaxTime": supported,
 		"Skip":    supported,
 	})
+	if err != nil {
+		return 0, err
+	}
 
 	// check filer
 	if filter == nil {
@@ -239,7 +371,7 @@ func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opt
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
 	if err != nil {
 		return 0, err
 	}
@@ -256,12 +388,20 @@ func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opt
 		limit = int(*opt.Limit)
 	}
 
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "count", opt.Comment, query)
+	defer done()
+
 	// find documents
 	res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
 		return txn.Find(c.handle, query, nil, skip, limit)
 	})
 	if err != nil {
-		return 0, err
+		return 0, commandError(contextError(ctx, err))
 	}
 
 	// get list
@@ -273,8 +413,9 @@ func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opt
 // Database implements the ICollection.Database method.
 func (c *Collection) Database() IDatabase {
 	return &Database{
-		name:   c.handle[0],
-		engine: c.engine,
+		name:     c.handle[0],
+		engine:   c.engine,
+		registry: c.registry,
 	}
 }
 
@@ -284,7 +425,13 @@ func (c *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ..
 	opt := options.MergeDeleteOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{})
+	err := c.assertOptions("Collection.DeleteMany", opt, map[string]string{
+		"Comment": supported,
+		"Let":     supported,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check filer
 	if filter == nil {
@@ -292,17 +439,27 @@ func (c *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ..
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
 	if err != nil {
 		return nil, err
 	}
 
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
+	if err != nil {
+		return nil, err
+	}
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "delete", opt.Comment, query)
+	defer done()
+
 	// delete documents
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Delete(c.handle, query, nil, 0, 0)
 	})
 	if err != nil {
-		return nil, err
+		return nil, writeException(contextError(ctx, err))
 	}
 
 	// get list
@@ -319,7 +476,13 @@ func (c *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...
 	opt := options.MergeDeleteOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{})
+	err := c.assertOptions("Collection.DeleteOne", opt, map[string]string{
+		"Comment": supported,
+		"Let":     supported,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check filer
 	if filter == nil {
@@ -327,17 +490,27 @@ func (c *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
 	if err != nil {
 		return nil, err
 	}
 
+	// monitor operation
+	ctx, done := c.monitor(ctx, "delete", opt.Comment, query)
+	defer done()
+
 	// delete document
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Delete(c.handle, query, nil, 0, 1)
 	})
 	if err != nil {
-		return nil, err
+		return nil, writeException(contextError(ctx, err))
 	}
 
 	// get list
@@ -354,9 +527,13 @@ func (c *Collection) Distinct(ctx context.Context, field string, filter interfac
 	opt := options.MergeDistinctOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"MaxTime": ignored,
+	err := c.assertOptions("Collection.Distinct", opt, map[string]string{
+		"Comment": supported,
+		"MaxTime": supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check field
 	if field == "" {
@@ -369,21 +546,32 @@ func (c *Collection) Distinct(ctx context.Context, field string, filter interfac
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
 	if err != nil {
 		return nil, err
 	}
 
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "distinct", opt.Comment, query)
+	defer done()
+
 	// find documents
 	res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
 		return txn.Find(c.handle, query, nil, 0, 0)
 	})
 	if err != nil {
-		return nil, err
+		return nil, commandError(contextError(ctx, err))
 	}
 
-	// get list
-	list := res.(*Result).Matched
+	// decrypt documents
+	list, err := c.decryptList(res.(*Result).Matched)
+	if err != nil {
+		return nil, err
+	}
 
 	// collect distinct values
 	values := mongokit.Distinct(list, field)
@@ -393,10 +581,15 @@ func (c *Collection) Distinct(ctx context.Context, field string, filter interfac
 
 // Drop implements the ICollection.Drop method.
 func (c *Collection) Drop(ctx context.Context) error {
+	// check error
+	if c.err != nil {
+		return c.err
+	}
+
 	// begin transaction
 	txn, err := c.engine.Begin(ctx, true)
 	if err != nil {
-		return err
+		return commandError(err)
 	}
 
 	// ensure abortion
@@ -405,13 +598,13 @@ func (c *Collection) Drop(ctx context.Context) error {
 	// drop namespace
 	err = txn.Drop(c.handle)
 	if err != nil {
-		return err
+		return commandError(err)
 	}
 
 	// commit transaction
 	err = c.engine.Commit(txn)
 	if err != nil {
-		return err
+		return commandError(err)
 	}
 
 	return nil
@@ -423,16 +616,28 @@ func (c *Collection) EstimatedDocumentCount(ctx context.Context, opts ...*option
 	opt := options.MergeEstimatedDocumentCountOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"MaxTime": ignored,
+	err := c.assertOptions("Collection.EstimatedDocumentCount", opt, map[string]string{
+		"Comment": supported,
+		"MaxTime": supported,
 	})
+	if err != nil {
+		return 0, err
+	}
+
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "count", opt.Comment, nil)
+	defer done()
 
 	// count documents
 	res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
 		return txn.CountDocuments(c.handle)
 	})
 	if err != nil {
-		return 0, err
+		return 0, commandError(contextError(ctx, err))
 	}
 
 	return int64(res.(int)), nil
@@ -444,19 +649,26 @@ func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*opti
 	opt := options.MergeFindOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := c.assertOptions("Collection.Find", opt, map[string]string{
 		"AllowPartialResults": ignored,
 		"BatchSize":           ignored,
-		"Comment":             ignored,
+		"Collation":           supported,
+		"Comment":             supported,
+		"Hint":                supported,
+		"Let":                 supported,
 		"Limit":               supported,
 		"MaxAwaitTime":        ignored,
-		"MaxTime":             ignored,
-		"NoCursorTimeout":     ignored,
+		"MaxTime":             supported,
+		"NoCursorTimeout":     supported,
 		"Projection":          supported,
+		"ShowRecordID":        supported,
 		"Skip":                supported,
 		"Snapshot":            ignored,
 		"Sort":                supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check filer
 	if filter == nil {
@@ -464,7 +676,13 @@ func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*opti
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
 	if err != nil {
 		return nil, err
 	}
@@ -472,7 +690,26 @@ func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*opti
 	// get sort
 	var sort bsonkit.Doc
 	if opt.Sort != nil {
-		sort, err = bsonkit.Transform(opt.Sort)
+		sort, err = bsonkit.TransformWithRegistry(c.registry, opt.Sort)
+		if err != nil {
+			return nil, err
+		}
+		sort = tiebreakSort(c.engine, sort)
+	}
+
+	// get hint, only natural order hints are applied as indexes are selected
+	// automatically
+	if sort == nil && opt.Hint != nil {
+		sort, err = naturalHint(c.registry, opt.Hint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// get collation
+	var collation bsonkit.Doc
+	if opt.Collation != nil {
+		collation, err = bsonkit.TransformWithRegistry(c.registry, opt.Collation.ToDocument())
 		if err != nil {
 			return nil, err
 		}
@@ -481,7 +718,7 @@ func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*opti
 	// get projection
 	var projection bsonkit.Doc
 	if opt.Projection != nil {
-		projection, err = bsonkit.Transform(opt.Projection)
+		projection, err = bsonkit.TransformWithRegistry(c.registry, opt.Projection)
 		if err != nil {
 			return nil, err
 		}
@@ -493,32 +730,66 @@ func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*opti
 		skip = int(*opt.Skip)
 	}
 
-	// get limit
+	// get limit, a negative limit requests a single batch
 	var limit int
 	if opt.Limit != nil {
 		limit = int(*opt.Limit)
+		if limit < 0 {
+			limit = -limit
+		}
 	}
 
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "find", opt.Comment, query)
+	defer done()
+
 	// find documents
+	var recordIDs []int64
 	res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
-		return txn.Find(c.handle, query, sort, skip, limit)
+		res, ids, err := findDocuments(ctx, txn, c.handle, query, sort, collation, skip, limit, opt.ShowRecordID != nil && *opt.ShowRecordID)
+		recordIDs = ids
+		return res, err
 	})
 	if err != nil {
-		return nil, err
+		return nil, commandError(contextError(ctx, err))
 	}
 
 	// get list
 	list := res.(*Result).Matched
 
+	// decrypt documents
+	list, err = c.decryptList(list)
+	if err != nil {
+		return nil, err
+	}
+
 	// apply projection
+	var pooled bool
 	if projection != nil {
 		list, err = mongokit.ProjectList(list, projection)
 		if err != nil {
 			return nil, err
 		}
+		pooled = true
 	}
 
-	return &Cursor{list: list}, nil
+	// add record ids
+	if recordIDs != nil {
+		list = addRecordIDs(list, recordIDs)
+	}
+
+	return c.engine.trackCursor(&Cursor{
+		engine:    c.engine,
+		list:      list,
+		pooled:    pooled,
+		registry:  c.registry,
+		ns:        c.handle.String(),
+		noTimeout: opt.NoCursorTimeout != nil && *opt.NoCursorTimeout,
+	}), nil
 }
 
 // FindOne implements the ICollection.FindOne method.
@@ -527,18 +798,24 @@ func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*o
 	opt := options.MergeFindOneOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := c.assertOptions("Collection.FindOne", opt, map[string]string{
 		"AllowPartialResults": ignored,
 		"BatchSize":           ignored,
-		"Comment":             ignored,
+		"Collation":           supported,
+		"Comment":             supported,
+		"Hint":                supported,
 		"MaxAwaitTime":        ignored,
-		"MaxTime":             ignored,
+		"MaxTime":             supported,
 		"NoCursorTimeout":     ignored,
 		"Projection":          supported,
+		"ShowRecordID":        supported,
 		"Skip":                supported,
 		"Snapshot":            ignored,
 		"Sort":                supported,
 	})
+	if err != nil {
+		return &SingleResult{err: err}
+	}
 
 	// check filer
 	if filter == nil {
@@ -546,7 +823,7 @@ func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*o
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
 	if err != nil {
 		return &SingleResult{err: err}
 	}
@@ -554,7 +831,26 @@ func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*o
 	// get sort
 	var sort bsonkit.Doc
 	if opt.Sort != nil {
-		sort, err = bsonkit.Transform(opt.Sort)
+		sort, err = bsonkit.TransformWithRegistry(c.registry, opt.Sort)
+		if err != nil {
+			return &SingleResult{err: err}
+		}
+		sort = tiebreakSort(c.engine, sort)
+	}
+
+	// get hint, only natural order hints are applied as indexes are selected
+	// automatically
+	if sort == nil && opt.Hint != nil {
+		sort, err = naturalHint(c.registry, opt.Hint)
+		if err != nil {
+			return &SingleResult{err: err}
+		}
+	}
+
+	// get collation
+	var collation bsonkit.Doc
+	if opt.Collation != nil {
+		collation, err = bsonkit.TransformWithRegistry(c.registry, opt.Collation.ToDocument())
 		if err != nil {
 			return &SingleResult{err: err}
 		}
@@ -569,18 +865,29 @@ func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*o
 	// get projection
 	var projection bsonkit.Doc
 	if opt.Projection != nil {
-		projection, err = bsonkit.Transform(opt.Projection)
+		projection, err = bsonkit.TransformWithRegistry(c.registry, opt.Projection)
 		if err != nil {
 			return &SingleResult{err: err}
 		}
 	}
 
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "find", opt.Comment, query)
+	defer done()
+
 	// find documents
+	var recordIDs []int64
 	res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
-		return txn.Find(c.handle, query, sort, skip, 1)
+		res, ids, err := findDocuments(ctx, txn, c.handle, query, sort, collation, skip, 1, opt.ShowRecordID != nil && *opt.ShowRecordID)
+		recordIDs = ids
+		return res, err
 	})
 	if err != nil {
-		return &SingleResult{err: err}
+		return &SingleResult{err: commandError(contextError(ctx, err))}
 	}
 
 	// get list
@@ -591,6 +898,12 @@ func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*o
 		return &SingleResult{}
 	}
 
+	// decrypt documents
+	list, err = c.decryptList(list)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
 	// apply projection
 	if projection != nil {
 		list, err = mongokit.ProjectList(list, projection)
@@ -599,7 +912,12 @@ func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*o
 		}
 	}
 
-	return &SingleResult{doc: list[0]}
+	// add record ids
+	if recordIDs != nil {
+		list = addRecordIDs(list, recordIDs)
+	}
+
+	return &SingleResult{doc: list[0], registry: c.registry}
 }
 
 // FindOneAndDelete implements the ICollection.FindOneAndDelete method.
@@ -608,11 +926,16 @@ func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, o
 	opt := options.MergeFindOneAndDeleteOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"MaxTime":    ignored,
+	err := c.assertOptions("Collection.FindOneAndDelete", opt, map[string]string{
+		"Comment":    supported,
+		"Let":        supported,
+		"MaxTime":    supported,
 		"Projection": supported,
 		"Sort":       supported,
 	})
+	if err != nil {
+		return &SingleResult{err: err}
+	}
 
 	// check filer
 	if filter == nil {
@@ -620,7 +943,13 @@ func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, o
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
 	if err != nil {
 		return &SingleResult{err: err}
 	}
@@ -628,7 +957,7 @@ func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, o
 	// get projection
 	var projection bsonkit.Doc
 	if opt.Projection != nil {
-		projection, err = bsonkit.Transform(opt.Projection)
+		projection, err = bsonkit.TransformWithRegistry(c.registry, opt.Projection)
 		if err != nil {
 			return &SingleResult{err: err}
 		}
@@ -637,18 +966,27 @@ func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, o
 	// get sort
 	var sort bsonkit.Doc
 	if opt.Sort != nil {
-		sort, err = bsonkit.Transform(opt.Sort)
+		sort, err = bsonkit.TransformWithRegistry(c.registry, opt.Sort)
 		if err != nil {
 			return &SingleResult{err: err}
 		}
+		sort = tiebreakSort(c.engine, sort)
 	}
 
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "findAndModify", opt.Comment, query)
+	defer done()
+
 	// delete documents
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Delete(c.handle, query, sort, 0, 1)
 	})
 	if err != nil {
-		return &SingleResult{err: err}
+		return &SingleResult{err: commandError(contextError(ctx, err))}
 	}
 
 	// get list
@@ -659,6 +997,12 @@ func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, o
 		return &SingleResult{}
 	}
 
+	// decrypt documents
+	list, err = c.decryptList(list)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
 	// apply projection
 	if projection != nil {
 		list, err = mongokit.ProjectList(list, projection)
@@ -667,7 +1011,7 @@ func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, o
 		}
 	}
 
-	return &SingleResult{doc: list[0]}
+	return &SingleResult{doc: list[0], registry: c.registry}
 }
 
 // FindOneAndReplace implements the ICollection.FindOneAndReplace method.
@@ -676,13 +1020,19 @@ func (c *Collection) FindOneAndReplace(ctx context.Context, filter, replacement
 	opt := options.MergeFindOneAndReplaceOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"MaxTime":        ignored,
-		"Projection":     supported,
-		"ReturnDocument": supported,
-		"Sort":           supported,
-		"Upsert":         supported,
+	err := c.assertOptions("Collection.FindOneAndReplace", opt, map[string]string{
+		"BypassDocumentValidation": ignored,
+		"Comment":                  supported,
+		"Let":                      supported,
+		"MaxTime":                  supported,
+		"Projection":               supported,
+		"ReturnDocument":           supported,
+		"Sort":                     supported,
+		"Upsert":                   supported,
 	})
+	if err != nil {
+		return &SingleResult{err: err}
+	}
 
 	// check filer
 	if filter == nil {
@@ -695,7 +1045,13 @@ func (c *Collection) FindOneAndReplace(ctx context.Context, filter, replacement
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
 	if err != nil {
 		return &SingleResult{err: err}
 	}
@@ -703,7 +1059,7 @@ func (c *Collection) FindOneAndReplace(ctx context.Context, filter, replacement
 	// get projection
 	var projection bsonkit.Doc
 	if opt.Projection != nil {
-		projection, err = bsonkit.Transform(opt.Projection)
+		projection, err = bsonkit.TransformWithRegistry(c.registry, opt.Projection)
 		if err != nil {
 			return &SingleResult{err: err}
 		}
@@ -712,14 +1068,21 @@ func (c *Collection) FindOneAndReplace(ctx context.Context, filter, replacement
 	// get sort
 	var sort bsonkit.Doc
 	if opt.Sort != nil {
-		sort, err = bsonkit.Transform(opt.Sort)
+		sort, err = bsonkit.TransformWithRegistry(c.registry, opt.Sort)
 		if err != nil {
 			return &SingleResult{err: err}
 		}
+		sort = tiebreakSort(c.engine, sort)
 	}
 
 	// transform document
-	repl, err := bsonkit.Transform(replacement)
+	repl, err := bsonkit.TransformWithRegistry(c.registry, replacement)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// encrypt document
+	err = c.encrypt(repl)
 	if err != nil {
 		return &SingleResult{err: err}
 	}
@@ -736,12 +1099,20 @@ func (c *Collection) FindOneAndReplace(ctx context.Context, filter, replacement
 		returnAfter = *opt.ReturnDocument == options.After
 	}
 
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "findAndModify", opt.Comment, query)
+	defer done()
+
 	// insert document
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Replace(c.handle, query, sort, repl, upsert)
 	})
 	if err != nil {
-		return &SingleResult{err: err}
+		return &SingleResult{err: commandError(contextError(ctx, err))}
 	}
 
 	// get result
@@ -760,6 +1131,12 @@ func (c *Collection) FindOneAndReplace(ctx context.Context, filter, replacement
 		}
 	}
 
+	// decrypt document
+	doc, err = c.decrypt(doc)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
 	// apply projection
 	if doc != nil && projection != nil {
 		doc, err = mongokit.Project(doc, projection)
@@ -768,7 +1145,7 @@ func (c *Collection) FindOneAndReplace(ctx context.Context, filter, replacement
 		}
 	}
 
-	return &SingleResult{doc: doc}
+	return &SingleResult{doc: doc, registry: c.registry}
 }
 
 // FindOneAndUpdate implements the ICollection.FindOneAndUpdate method.
@@ -777,14 +1154,20 @@ func (c *Collection) FindOneAndUpdate(ctx context.Context, filter, update interf
 	opt := options.MergeFindOneAndUpdateOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"MaxTime":        ignored,
-		"Projection":     supported,
-		"ReturnDocument": supported,
-		"Sort":           supported,
-		"Upsert":         supported,
-		"ArrayFilters":   supported,
+	err := c.assertOptions("Collection.FindOneAndUpdate", opt, map[string]string{
+		"BypassDocumentValidation": ignored,
+		"MaxTime":                  supported,
+		"Projection":               supported,
+		"ReturnDocument":           supported,
+		"Sort":                     supported,
+		"Upsert":                   supported,
+		"ArrayFilters":             supported,
+		"Let":                      supported,
+		"Comment":                  supported,
 	})
+	if err != nil {
+		return &SingleResult{err: err}
+	}
 
 	// check filer
 	if filter == nil {
@@ -797,7 +1180,13 @@ func (c *Collection) FindOneAndUpdate(ctx context.Context, filter, update interf
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
 	if err != nil {
 		return &SingleResult{err: err}
 	}
@@ -805,7 +1194,7 @@ func (c *Collection) FindOneAndUpdate(ctx context.Context, filter, update interf
 	// get projection
 	var projection bsonkit.Doc
 	if opt.Projection != nil {
-		projection, err = bsonkit.Transform(opt.Projection)
+		projection, err = bsonkit.TransformWithRegistry(c.registry, opt.Projection)
 		if err != nil {
 			return &SingleResult{err: err}
 		}
@@ -814,14 +1203,21 @@ func (c *Collection) FindOneAndUpdate(ctx context.Context, filter, update interf
 	// get sort
 	var sort bsonkit.Doc
 	if opt.Sort != nil {
-		sort, err = bsonkit.Transform(opt.Sort)
+		sort, err = bsonkit.TransformWithRegistry(c.registry, opt.Sort)
 		if err != nil {
 			return &SingleResult{err: err}
 		}
+		sort = tiebreakSort(c.engine, sort)
 	}
 
 	// transform document
-	upd, err := bsonkit.Transform(update)
+	upd, err := bsonkit.TransformWithRegistry(c.registry, update)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// check update
+	err = c.checkEncryptedUpdate(upd)
 	if err != nil {
 		return &SingleResult{err: err}
 	}
@@ -841,18 +1237,26 @@ func (c *Collection) FindOneAndUpdate(ctx context.Context, filter, update interf
 	// get array filters
 	var arrayFilters bsonkit.List
 	if opt.ArrayFilters != nil && opt.ArrayFilters.Filters != nil {
-		arrayFilters, err = bsonkit.TransformList(opt.ArrayFilters.Filters)
+		arrayFilters, err = bsonkit.TransformListWithRegistry(c.registry, opt.ArrayFilters.Filters)
 		if err != nil {
 			return &SingleResult{err: err}
 		}
 	}
 
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// monitor operation
+	ctx, done := c.monitor(ctx, "findAndModify", opt.Comment, query)
+	defer done()
+
 	// update documents
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Update(c.handle, query, sort, upd, 0, 1, upsert, arrayFilters)
 	})
 	if err != nil {
-		return &SingleResult{err: err}
+		return &SingleResult{err: commandError(contextError(ctx, err))}
 	}
 
 	// get result
@@ -871,6 +1275,12 @@ func (c *Collection) FindOneAndUpdate(ctx context.Context, filter, update interf
 		}
 	}
 
+	// decrypt document
+	doc, err = c.decrypt(doc)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
 	// apply projection
 	if doc != nil && projection != nil {
 		doc, err = mongokit.Project(doc, projection)
@@ -879,14 +1289,16 @@ func (c *Collection) FindOneAndUpdate(ctx context.Context, filter, update interf
 		}
 	}
 
-	return &SingleResult{doc: doc}
+	return &SingleResult{doc: doc, registry: c.registry}
 }
 
 // Indexes implements the ICollection.Indexes method.
 func (c *Collection) Indexes() IIndexView {
 	return &IndexView{
-		handle: c.handle,
-		engine: c.engine,
+		handle:   c.handle,
+		engine:   c.engine,
+		registry: c.registry,
+		err:      c.err,
 	}
 }
 
@@ -896,9 +1308,14 @@ func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, op
 	opt := options.MergeInsertManyOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"Ordered": supported,
+	err := c.assertOptions("Collection.InsertMany", opt, map[string]string{
+		"BypassDocumentValidation": ignored,
+		"Comment":                  supported,
+		"Ordered":                  supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check documents
 	if len(documents) == 0 {
@@ -911,7 +1328,13 @@ func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, op
 	// transform documents
 	for _, document := range documents {
 		// transform document
-		doc, err := bsonkit.Transform(document)
+		doc, err := bsonkit.TransformWithRegistry(c.registry, document)
+		if err != nil {
+			return nil, err
+		}
+
+		// encrypt document
+		err = c.encrypt(doc)
 		if err != nil {
 			return nil, err
 		}
@@ -926,20 +1349,30 @@ func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, op
 		ordered = *opt.Ordered
 	}
 
+	// monitor operation
+	ctx, done := c.monitor(ctx, "insert", opt.Comment, nil)
+	defer done()
+
 	// insert documents
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Insert(c.handle, list, ordered)
 	})
 	if err != nil {
-		return nil, err
+		return nil, commandError(contextError(ctx, err))
 	}
 
 	// get result
 	result := res.(*Result)
 
+	// get error, with write errors for individual documents
+	err = result.Error
+	if result.Errors != nil {
+		err = insertErrors(documents, result.Errors)
+	}
+
 	return &mongo.InsertManyResult{
 		InsertedIDs: bsonkit.Pick(result.Modified, "_id", false),
-	}, result.Error
+	}, err
 }
 
 // InsertOne implements the ICollection.InsertOne method.
@@ -948,7 +1381,13 @@ func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts .
 	opt := options.MergeInsertOneOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{})
+	err := c.assertOptions("Collection.InsertOne", opt, map[string]string{
+		"BypassDocumentValidation": ignored,
+		"Comment":                  supported,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check document
 	if document == nil {
@@ -956,17 +1395,27 @@ func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts .
 	}
 
 	// transform document
-	doc, err := bsonkit.Transform(document)
+	doc, err := bsonkit.TransformWithRegistry(c.registry, document)
+	if err != nil {
+		return nil, err
+	}
+
+	// encrypt document
+	err = c.encrypt(doc)
 	if err != nil {
 		return nil, err
 	}
 
+	// monitor operation
+	ctx, done := c.monitor(ctx, "insert", opt.Comment, nil)
+	defer done()
+
 	// insert document
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Insert(c.handle, bsonkit.List{doc}, true)
 	})
 	if err != nil {
-		return nil, err
+		return nil, writeException(contextError(ctx, err))
 	}
 
 	// get result
@@ -974,7 +1423,7 @@ func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts .
 
 	// check error
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, writeException(result.Error)
 	}
 
 	return &mongo.InsertOneResult{
@@ -993,9 +1442,15 @@ func (c *Collection) ReplaceOne(ctx context.Context, filter, replacement interfa
 	opt := options.MergeReplaceOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"Upsert": supported,
+	err := c.assertOptions("Collection.ReplaceOne", opt, map[string]string{
+		"BypassDocumentValidation": ignored,
+		"Comment":                  supported,
+		"Let":                      supported,
+		"Upsert":                   supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check filer
 	if filter == nil {
@@ -1008,13 +1463,25 @@ func (c *Collection) ReplaceOne(ctx context.Context, filter, replacement interfa
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
 	if err != nil {
 		return nil, err
 	}
 
 	// transform document
-	doc, err := bsonkit.Transform(replacement)
+	doc, err := bsonkit.TransformWithRegistry(c.registry, replacement)
+	if err != nil {
+		return nil, err
+	}
+
+	// encrypt document
+	err = c.encrypt(doc)
 	if err != nil {
 		return nil, err
 	}
@@ -1025,12 +1492,16 @@ func (c *Collection) ReplaceOne(ctx context.Context, filter, replacement interfa
 		upsert = *opt.Upsert
 	}
 
+	// monitor operation
+	ctx, done := c.monitor(ctx, "update", opt.Comment, query)
+	defer done()
+
 	// insert document
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Replace(c.handle, query, nil, doc, upsert)
 	})
 	if err != nil {
-		return nil, err
+		return nil, writeException(contextError(ctx, err))
 	}
 
 	// get result
@@ -1066,10 +1537,16 @@ func (c *Collection) UpdateMany(ctx context.Context, filter, update interface{},
 	opt := options.MergeUpdateOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"Upsert":       supported,
-		"ArrayFilters": supported,
+	err := c.assertOptions("Collection.UpdateMany", opt, map[string]string{
+		"BypassDocumentValidation": ignored,
+		"Upsert":                   supported,
+		"ArrayFilters":             supported,
+		"Let":                      supported,
+		"Comment":                  supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check filer
 	if filter == nil {
@@ -1082,13 +1559,25 @@ func (c *Collection) UpdateMany(ctx context.Context, filter, update interface{},
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
 	if err != nil {
 		return nil, err
 	}
 
 	// transform document
-	doc, err := bsonkit.Transform(update)
+	doc, err := bsonkit.TransformWithRegistry(c.registry, update)
+	if err != nil {
+		return nil, err
+	}
+
+	// check update
+	err = c.checkEncryptedUpdate(doc)
 	if err != nil {
 		return nil, err
 	}
@@ -1102,18 +1591,22 @@ func (c *Collection) UpdateMany(ctx context.Context, filter, update interface{},
 	// get array filters
 	var arrayFilters bsonkit.List
 	if opt.ArrayFilters != nil && opt.ArrayFilters.Filters != nil {
-		arrayFilters, err = bsonkit.TransformList(opt.ArrayFilters.Filters)
+		arrayFilters, err = bsonkit.TransformListWithRegistry(c.registry, opt.ArrayFilters.Filters)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// monitor operation
+	ctx, done := c.monitor(ctx, "update", opt.Comment, query)
+	defer done()
+
 	// update documents
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Update(c.handle, query, nil, doc, 0, 0, upsert, arrayFilters)
 	})
 	if err != nil {
-		return nil, err
+		return nil, writeException(contextError(ctx, err))
 	}
 
 	// get result
@@ -1139,10 +1632,16 @@ func (c *Collection) UpdateOne(ctx context.Context, filter, update interface{},
 	opt := options.MergeUpdateOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"Upsert":       supported,
-		"ArrayFilters": supported,
+	err := c.assertOptions("Collection.UpdateOne", opt, map[string]string{
+		"BypassDocumentValidation": ignored,
+		"Upsert":                   supported,
+		"ArrayFilters":             supported,
+		"Let":                      supported,
+		"Comment":                  supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// check filer
 	if filter == nil {
@@ -1155,13 +1654,25 @@ func (c *Collection) UpdateOne(ctx context.Context, filter, update interface{},
 	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// bind variables
+	query, err = bindLet(c.registry, query, opt.Let)
 	if err != nil {
 		return nil, err
 	}
 
 	// transform document
-	doc, err := bsonkit.Transform(update)
+	doc, err := bsonkit.TransformWithRegistry(c.registry, update)
+	if err != nil {
+		return nil, err
+	}
+
+	// check update
+	err = c.checkEncryptedUpdate(doc)
 	if err != nil {
 		return nil, err
 	}
@@ -1175,18 +1686,22 @@ func (c *Collection) UpdateOne(ctx context.Context, filter, update interface{},
 	// get array filters
 	var arrayFilters bsonkit.List
 	if opt.ArrayFilters != nil && opt.ArrayFilters.Filters != nil {
-		arrayFilters, err = bsonkit.TransformList(opt.ArrayFilters.Filters)
+		arrayFilters, err = bsonkit.TransformListWithRegistry(c.registry, opt.ArrayFilters.Filters)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// monitor operation
+	ctx, done := c.monitor(ctx, "update", opt.Comment, query)
+	defer done()
+
 	// update documents
 	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
 		return txn.Update(c.handle, query, nil, doc, 0, 1, upsert, arrayFilters)
 	})
 	if err != nil {
-		return nil, err
+		return nil, writeException(contextError(ctx, err))
 	}
 
 	// get result
@@ -1212,17 +1727,22 @@ func (c *Collection) Watch(_ context.Context, pipeline interface{}, opts ...*opt
 	opt := options.MergeChangeStreamOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"BatchSize":            ignored,
-		"FullDocument":         ignored,
-		"MaxAwaitTime":         ignored,
-		"ResumeAfter":          supported,
-		"StartAtOperationTime": supported,
-		"StartAfter":           supported,
+	err := c.assertOptions("Collection.Watch", opt, map[string]string{
+		"BatchSize":                ignored,
+		"Comment":                  ignored,
+		"FullDocument":             supported,
+		"FullDocumentBeforeChange": supported,
+		"MaxAwaitTime":             ignored,
+		"ResumeAfter":              supported,
+		"StartAtOperationTime":     supported,
+		"StartAfter":               supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// transform pipeline
-	filter, err := bsonkit.TransformList(pipeline)
+	filter, err := bsonkit.TransformListWithRegistry(c.registry, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -1230,7 +1750,7 @@ func (c *Collection) Watch(_ context.Context, pipeline interface{}, opts ...*opt
 	// get resume after
 	var resumeAfter bsonkit.Doc
 	if opt.ResumeAfter != nil {
-		resumeAfter, err = bsonkit.Transform(opt.ResumeAfter)
+		resumeAfter, err = bsonkit.TransformWithRegistry(c.registry, opt.ResumeAfter)
 		if err != nil {
 			return nil, err
 		}
@@ -1239,7 +1759,7 @@ func (c *Collection) Watch(_ context.Context, pipeline interface{}, opts ...*opt
 	// get start after
 	var startAfter bsonkit.Doc
 	if opt.StartAfter != nil {
-		startAfter, err = bsonkit.Transform(opt.StartAfter)
+		startAfter, err = bsonkit.TransformWithRegistry(c.registry, opt.StartAfter)
 		if err != nil {
 			return nil, err
 		}
@@ -1251,5 +1771,27 @@ func (c *Collection) Watch(_ context.Context, pipeline interface{}, opts ...*opt
 		return nil, err
 	}
 
+	// set registry
+	stream.registry = c.registry
+
+	// set full document
+	if opt.FullDocument != nil {
+		stream.fullDocument = *opt.FullDocument
+	}
+
+	// set full document before change
+	if opt.FullDocumentBeforeChange != nil {
+		stream.fullDocumentBeforeChange = *opt.FullDocumentBeforeChange
+	}
+
 	return stream, nil
 }
+
+func (c *Collection) assertOptions(operation string, opts interface{}, fields map[string]string) error {
+	// check error
+	if c.err != nil {
+		return c.err
+	}
+
+	return assertOptions(c.engine, operation, opts, fields)
+}
@@ -1,8 +1,11 @@
 package lungo
 
 import (
+	"context"
+	"errors"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,6 +14,94 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+func TestCollectionAggregate(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		_, err := c.InsertMany(nil, []interface{}{
+			bson.M{"group": "a", "value": 1},
+			bson.M{"group": "b", "value": 2},
+			bson.M{"group": "a", "value": 3},
+		})
+		assert.NoError(t, err)
+
+		// group documents
+		csr, err := c.Aggregate(nil, bson.A{
+			bson.M{"$group": bson.M{
+				"_id":   "$group",
+				"total": bson.M{"$sum": "$value"},
+			}},
+			bson.M{"$sort": bson.M{"_id": 1}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": "a", "total": int32(4)},
+			{"_id": "b", "total": int32(2)},
+		}, readAll(csr))
+
+		// invalid stage
+		_, err = c.Aggregate(nil, bson.A{
+			bson.M{"$foo": bson.M{}},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestCollectionLet(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		_, err := c.InsertMany(nil, []interface{}{
+			bson.M{"_id": "a", "value": 1},
+			bson.M{"_id": "b", "value": 2},
+			bson.M{"_id": "c", "value": 3},
+		})
+		assert.NoError(t, err)
+
+		let := bson.M{"min": 2}
+		filter := bson.M{"$expr": bson.M{"$gte": bson.A{"$value", "$$min"}}}
+
+		// find
+		csr, err := c.Find(nil, filter, options.Find().SetLet(let).SetSort(bson.M{"_id": 1}))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": "b", "value": int32(2)},
+			{"_id": "c", "value": int32(3)},
+		}, readAll(csr))
+
+		// undefined variable
+		_, err = c.Find(nil, filter)
+		assert.Error(t, err)
+
+		// aggregate
+		csr, err = c.Aggregate(nil, bson.A{
+			bson.M{"$match": filter},
+			bson.M{"$project": bson.M{"diff": bson.M{"$subtract": bson.A{"$value", "$$min"}}}},
+			bson.M{"$sort": bson.M{"_id": 1}},
+		}, options.Aggregate().SetLet(let))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": "b", "diff": int32(0)},
+			{"_id": "c", "diff": int32(1)},
+		}, readAll(csr))
+
+		// update
+		res1, err := c.UpdateMany(nil, filter, bson.M{
+			"$set": bson.M{"big": true},
+		}, options.Update().SetLet(let))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), res1.ModifiedCount)
+
+		// delete
+		res2, err := c.DeleteMany(nil, filter, options.Delete().SetLet(bson.M{"min": 3}))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), res2.DeletedCount)
+
+		csr, err = c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": "a", "value": int32(1)},
+			{"_id": "b", "value": int32(2), "big": true},
+		}, readAll(csr))
+	})
+}
+
 func TestCollectionBulkWrite(t *testing.T) {
 	collectionTest(t, func(t *testing.T, c ICollection) {
 		id1 := primitive.NewObjectID()
@@ -532,6 +623,39 @@ func TestCollectionFind(t *testing.T) {
 			},
 		}, readAll(csr))
 
+		// filter, skip and limit
+		csr, err = c.Find(nil, bson.M{
+			"n": bson.M{
+				"$lt": 3,
+			},
+		}, options.Find().SetSkip(1).SetLimit(1))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{
+				"_id": id3,
+				"n":   int32(1),
+				"foo": "qux",
+			},
+		}, readAll(csr))
+
+		// sort and negative limit
+		csr, err = c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{
+			"n": -1,
+		}).SetLimit(-2))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{
+				"_id": id2,
+				"n":   int32(3),
+				"foo": "baz",
+			},
+			{
+				"_id": id1,
+				"n":   int32(2),
+				"foo": "bar",
+			},
+		}, readAll(csr))
+
 		// cursor
 		var m bson.M
 		csr, err = c.Find(nil, bson.M{})
@@ -580,6 +704,87 @@ func TestCollectionFind(t *testing.T) {
 	})
 }
 
+func TestCollectionFindNatural(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		id1 := primitive.NewObjectID()
+		id2 := primitive.NewObjectID()
+		id3 := primitive.NewObjectID()
+
+		_, err := c.InsertMany(nil, bson.A{
+			bson.M{"_id": id2, "n": int32(1)},
+			bson.M{"_id": id3, "n": int32(2)},
+			bson.M{"_id": id1, "n": int32(3)},
+		})
+		assert.NoError(t, err)
+
+		// update keeps position
+		_, err = c.UpdateOne(nil, bson.M{"_id": id2}, bson.M{
+			"$set": bson.M{"n": int32(4)},
+		})
+		assert.NoError(t, err)
+
+		// natural sort
+		csr, err := c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{
+			"$natural": 1,
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": id2, "n": int32(4)},
+			{"_id": id3, "n": int32(2)},
+			{"_id": id1, "n": int32(3)},
+		}, readAll(csr))
+
+		// reverse natural sort
+		csr, err = c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{
+			"$natural": -1,
+		}).SetLimit(2))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": id1, "n": int32(3)},
+			{"_id": id3, "n": int32(2)},
+		}, readAll(csr))
+
+		// reverse natural hint
+		csr, err = c.Find(nil, bson.M{}, options.Find().SetHint(bson.M{
+			"$natural": -1,
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": id1, "n": int32(3)},
+			{"_id": id3, "n": int32(2)},
+			{"_id": id2, "n": int32(4)},
+		}, readAll(csr))
+
+		// sort takes precedence over hint
+		csr, err = c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{
+			"n": 1,
+		}).SetHint(bson.M{
+			"$natural": -1,
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": id3, "n": int32(2)},
+			{"_id": id1, "n": int32(3)},
+			{"_id": id2, "n": int32(4)},
+		}, readAll(csr))
+
+		// find one with natural hint
+		var doc bson.M
+		err = c.FindOne(nil, bson.M{}, options.FindOne().SetHint(bson.M{
+			"$natural": -1,
+		})).Decode(&doc)
+		assert.NoError(t, err)
+		assert.Equal(t, bson.M{"_id": id1, "n": int32(3)}, doc)
+
+		// invalid natural sort
+		_, err = c.Find(nil, bson.M{}, options.Find().SetSort(bson.D{
+			{Key: "$natural", Value: 1},
+			{Key: "n", Value: 1},
+		}))
+		assert.Error(t, err)
+	})
+}
+
 func TestCollectionFindOne(t *testing.T) {
 	// missing database
 	clientTest(t, func(t *testing.T, client IClient) {
@@ -1365,6 +1570,7 @@ func TestCollectionInsertMany(t *testing.T) {
 			},
 		})
 		assert.Error(t, err)
+		assert.True(t, mongo.IsDuplicateKeyError(err))
 		assert.Len(t, res.InsertedIDs, 1)
 		assert.Equal(t, []bson.M{
 			{
@@ -1372,6 +1578,12 @@ func TestCollectionInsertMany(t *testing.T) {
 				"foo": "bar",
 			},
 		}, dumpCollection(c, false))
+
+		var bwe mongo.BulkWriteException
+		assert.True(t, errors.As(err, &bwe))
+		assert.Len(t, bwe.WriteErrors, 1)
+		assert.Equal(t, 1, bwe.WriteErrors[0].Index)
+		assert.Equal(t, 11000, bwe.WriteErrors[0].Code)
 	})
 
 	// duplicate_id unordered
@@ -1394,6 +1606,7 @@ func TestCollectionInsertMany(t *testing.T) {
 			},
 		}, options.InsertMany().SetOrdered(false))
 		assert.Error(t, err)
+		assert.True(t, mongo.IsDuplicateKeyError(err))
 		assert.Len(t, res.InsertedIDs, 2)
 		assert.Equal(t, []bson.M{
 			{
@@ -1406,6 +1619,78 @@ func TestCollectionInsertMany(t *testing.T) {
 			},
 		}, dumpCollection(c, false))
 	})
+
+	// multiple duplicate _id unordered
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		id1 := primitive.NewObjectID()
+		id2 := primitive.NewObjectID()
+
+		res, err := c.InsertMany(nil, bson.A{
+			bson.M{
+				"_id": id1,
+				"foo": "bar",
+			},
+			bson.M{
+				"_id": id1,
+				"foo": "bar",
+			},
+			bson.M{
+				"_id": id2,
+				"bar": "baz",
+			},
+			bson.M{
+				"_id": id2,
+				"bar": "baz",
+			},
+		}, options.InsertMany().SetOrdered(false))
+		assert.Error(t, err)
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+		assert.Len(t, res.InsertedIDs, 2)
+
+		var bwe mongo.BulkWriteException
+		assert.True(t, errors.As(err, &bwe))
+		assert.Len(t, bwe.WriteErrors, 2)
+		assert.Equal(t, 1, bwe.WriteErrors[0].Index)
+		assert.Equal(t, 11000, bwe.WriteErrors[0].Code)
+		assert.Equal(t, 3, bwe.WriteErrors[1].Index)
+		assert.Equal(t, 11000, bwe.WriteErrors[1].Code)
+	})
+}
+
+func TestCollectionBypassDocumentValidation(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		_, err := c.InsertOne(nil, bson.M{"_id": 1}, options.InsertOne().SetBypassDocumentValidation(true))
+		assert.NoError(t, err)
+
+		_, err = c.InsertMany(nil, bson.A{bson.M{"_id": 2}}, options.InsertMany().SetBypassDocumentValidation(true))
+		assert.NoError(t, err)
+
+		_, err = c.UpdateOne(nil, bson.M{"_id": 1}, bson.M{"$set": bson.M{"a": 1}}, options.Update().SetBypassDocumentValidation(true))
+		assert.NoError(t, err)
+
+		_, err = c.UpdateMany(nil, bson.M{}, bson.M{"$set": bson.M{"b": 1}}, options.Update().SetBypassDocumentValidation(true))
+		assert.NoError(t, err)
+
+		_, err = c.ReplaceOne(nil, bson.M{"_id": 2}, bson.M{"c": 1}, options.Replace().SetBypassDocumentValidation(true))
+		assert.NoError(t, err)
+
+		err = c.FindOneAndUpdate(nil, bson.M{"_id": 1}, bson.M{"$set": bson.M{"d": 1}}, options.FindOneAndUpdate().SetBypassDocumentValidation(true)).Err()
+		assert.NoError(t, err)
+
+		err = c.FindOneAndReplace(nil, bson.M{"_id": 2}, bson.M{"e": 1}, options.FindOneAndReplace().SetBypassDocumentValidation(true)).Err()
+		assert.NoError(t, err)
+
+		_, err = c.BulkWrite(nil, []mongo.WriteModel{
+			mongo.NewInsertOneModel().SetDocument(bson.M{"_id": 3}),
+		}, options.BulkWrite().SetBypassDocumentValidation(true))
+		assert.NoError(t, err)
+
+		assert.Equal(t, []bson.M{
+			{"_id": int32(1), "a": int32(1), "b": int32(1), "d": int32(1)},
+			{"_id": int32(2), "e": int32(1)},
+			{"_id": int32(3)},
+		}, dumpCollection(c, false))
+	})
 }
 
 func TestCollectionInsertOne(t *testing.T) {
@@ -1472,6 +1757,52 @@ func TestCollectionName(t *testing.T) {
 	})
 }
 
+func TestCollectionRegistry(t *testing.T) {
+	type model struct {
+		ID   primitive.ObjectID `bson:"_id"`
+		Date testDate           `bson:"date"`
+	}
+
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		rc := c.Database().Collection(c.Name(), options.Collection().SetRegistry(testRegistry()))
+
+		doc := model{
+			ID:   primitive.NewObjectID(),
+			Date: testDate{Year: 2020, Month: 1, Day: 2},
+		}
+
+		_, err := rc.InsertOne(nil, doc)
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{
+				"_id":  doc.ID,
+				"date": "2020-01-02",
+			},
+		}, dumpCollection(c, false))
+
+		var res model
+		err = rc.FindOne(nil, bson.M{"date": doc.Date}).Decode(&res)
+		assert.NoError(t, err)
+		assert.Equal(t, doc, res)
+
+		csr, err := rc.Find(nil, bson.M{"date": doc.Date})
+		assert.NoError(t, err)
+		assert.True(t, csr.Next(nil))
+		res = model{}
+		err = csr.Decode(&res)
+		assert.NoError(t, err)
+		assert.Equal(t, doc, res)
+		assert.NoError(t, csr.Close(nil))
+
+		var list []model
+		csr, err = rc.Find(nil, bson.M{})
+		assert.NoError(t, err)
+		err = csr.All(nil, &list)
+		assert.NoError(t, err)
+		assert.Equal(t, []model{doc}, list)
+	})
+}
+
 func TestCollectionReplaceOne(t *testing.T) {
 	collectionTest(t, func(t *testing.T, c ICollection) {
 		id1 := primitive.NewObjectID()
@@ -1884,3 +2215,41 @@ func TestCollectionUpdateOneUpsert(t *testing.T) {
 }
 
 // TODO: Test upsert with zero object id.
+
+func TestCollectionMaxTime(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": 1})
+	assert.NoError(t, err)
+
+	_, err = coll.Find(nil, bson.M{}, options.Find().SetMaxTime(time.Nanosecond))
+	assert.Equal(t, ErrMaxTimeExpired, err)
+	assert.True(t, mongo.IsTimeout(err))
+
+	err = coll.FindOne(nil, bson.M{}, options.FindOne().SetMaxTime(time.Nanosecond)).Err()
+	assert.Equal(t, ErrMaxTimeExpired, err)
+
+	_, err = coll.CountDocuments(nil, bson.M{}, options.Count().SetMaxTime(time.Nanosecond))
+	assert.Equal(t, ErrMaxTimeExpired, err)
+
+	_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys: bson.M{"foo": 1},
+	}, options.CreateIndexes().SetMaxTime(time.Nanosecond))
+	assert.True(t, mongo.IsTimeout(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+
+	_, err = coll.Find(ctx, bson.M{}, options.Find().SetMaxTime(time.Hour))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	n, err := coll.CountDocuments(nil, bson.M{}, options.Count().SetMaxTime(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
@@ -0,0 +1,200 @@
+package lungo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
+)
+
+func (c *Collection) collStats(ctx context.Context, arg interface{}) (bsonkit.List, error) {
+	// get spec
+	spec, ok := arg.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("$collStats: expected document")
+	}
+
+	// parse spec
+	var latencyStats, histograms, storageStats, count bool
+	var scale int64 = 1
+	for _, field := range spec {
+		// get options
+		opts, ok := field.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("$collStats: expected document for %q", field.Key)
+		}
+
+		switch field.Key {
+		case "latencyStats":
+			latencyStats = true
+			for _, opt := range opts {
+				if opt.Key != "histograms" {
+					return nil, fmt.Errorf("$collStats: unrecognized option %q for latencyStats", opt.Key)
+				}
+				histograms, ok = opt.Value.(bool)
+				if !ok {
+					return nil, fmt.Errorf("$collStats: expected boolean for 'histograms'")
+				}
+			}
+		case "storageStats":
+			storageStats = true
+			for _, opt := range opts {
+				if opt.Key != "scale" {
+					return nil, fmt.Errorf("$collStats: unrecognized option %q for storageStats", opt.Key)
+				}
+				switch value := opt.Value.(type) {
+				case int32:
+					scale = int64(value)
+				case int64:
+					scale = value
+				case float64:
+					scale = int64(value)
+				default:
+					return nil, fmt.Errorf("$collStats: expected number for 'scale'")
+				}
+				if scale < 1 {
+					return nil, fmt.Errorf("$collStats: 'scale' must be at least 1")
+				}
+			}
+		case "count":
+			count = true
+		default:
+			return nil, fmt.Errorf("$collStats: unsupported option %q", field.Key)
+		}
+	}
+
+	// get namespace
+	res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
+		err := txn.Load(c.handle)
+		if err != nil {
+			return nil, err
+		}
+		return txn.Catalog().Namespaces[c.handle], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	namespace := res.(*mongokit.Collection)
+
+	// check namespace
+	if namespace == nil && (storageStats || count) {
+		return nil, fmt.Errorf("$collStats: collection [%s] not found", c.handle.String())
+	}
+
+	// get host
+	host, _ := os.Hostname()
+
+	// prepare document
+	doc := bson.D{
+		{Key: "ns", Value: c.handle.String()},
+		{Key: "host", Value: host},
+		{Key: "localTime", Value: primitive.NewDateTimeFromTime(time.Now())},
+	}
+
+	// add latency statistics
+	if latencyStats {
+		hists := c.engine.diagnostics.namespace(c.handle)
+		doc = append(doc, bson.E{Key: "latencyStats", Value: bson.D{
+			{Key: "reads", Value: latencyStatsDoc(&hists.reads, histograms)},
+			{Key: "writes", Value: latencyStatsDoc(&hists.writes, histograms)},
+			{Key: "commands", Value: latencyStatsDoc(&hists.commands, histograms)},
+			{Key: "transactions", Value: latencyStatsDoc(&histogram{}, histograms)},
+		}})
+	}
+
+	// add storage statistics
+	if storageStats {
+		// collect index sizes
+		names := make([]string, 0, len(namespace.Indexes))
+		for name := range namespace.Indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var indexSize int64
+		indexSizes := bson.D{}
+		for _, name := range names {
+			size := int64(namespace.Indexes[name].Memory())
+			indexSize += size
+			indexSizes = append(indexSizes, bson.E{Key: name, Value: size / scale})
+		}
+
+		// get sizes
+		num := int64(len(namespace.Documents.List))
+		size := int64(namespace.Size)
+		var avgSize int64
+		if num > 0 {
+			avgSize = size / num
+		}
+
+		doc = append(doc, bson.E{Key: "storageStats", Value: bson.D{
+			{Key: "size", Value: size / scale},
+			{Key: "count", Value: num},
+			{Key: "avgObjSize", Value: avgSize},
+			{Key: "storageSize", Value: size / scale},
+			{Key: "freeStorageSize", Value: int64(0)},
+			{Key: "capped", Value: false},
+			{Key: "nindexes", Value: int64(len(names))},
+			{Key: "indexBuilds", Value: bson.A{}},
+			{Key: "totalIndexSize", Value: indexSize / scale},
+			{Key: "totalSize", Value: (size + indexSize) / scale},
+			{Key: "indexSizes", Value: indexSizes},
+			{Key: "scaleFactor", Value: scale},
+		}})
+	}
+
+	// add count
+	if count {
+		doc = append(doc, bson.E{Key: "count", Value: int64(len(namespace.Documents.List))})
+	}
+
+	return bsonkit.List{&doc}, nil
+}
+
+func latencyStatsDoc(hist *histogram, histograms bool) bson.D {
+	// prepare document
+	doc := bson.D{
+		{Key: "latency", Value: int64(hist.total / time.Microsecond)},
+		{Key: "ops", Value: hist.count},
+	}
+
+	// add histogram, bucket i holds durations below 2^i nanoseconds
+	if histograms {
+		buckets := bson.A{}
+		for i, num := range hist.buckets {
+			// skip empty buckets
+			if num == 0 {
+				continue
+			}
+
+			// get lower bound in microseconds
+			var micros int64
+			if i > 0 {
+				micros = int64(uint64(1)<<uint(i-1)) / int64(time.Microsecond)
+			}
+
+			// merge with previous bucket
+			if n := len(buckets); n > 0 {
+				prev := buckets[n-1].(bson.D)
+				if prev[0].Value == micros {
+					prev[1].Value = prev[1].Value.(int64) + num
+					continue
+				}
+			}
+
+			buckets = append(buckets, bson.D{
+				{Key: "micros", Value: micros},
+				{Key: "count", Value: num},
+			})
+		}
+		doc = append(doc, bson.E{Key: "histogram", Value: buckets})
+	}
+
+	return doc
+}
@@ -0,0 +1,112 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCollectionAggregateCollStats(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertMany(nil, []interface{}{
+		bson.M{"n": 1},
+		bson.M{"n": 2},
+	})
+	assert.NoError(t, err)
+
+	_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys:    bson.M{"n": 1},
+		Options: options.Index().SetName("n"),
+	})
+	assert.NoError(t, err)
+
+	_, err = coll.Find(nil, bson.M{})
+	assert.NoError(t, err)
+
+	// latency statistics
+	csr, err := coll.Aggregate(nil, bson.A{
+		bson.M{"$collStats": bson.M{
+			"latencyStats": bson.M{"histograms": true},
+		}},
+	})
+	assert.NoError(t, err)
+	res := readAll(csr)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "foo.bar", res[0]["ns"])
+
+	stats := res[0]["latencyStats"].(bson.M)
+	assert.Equal(t, int64(1), stats["reads"].(bson.M)["ops"])
+	assert.Equal(t, int64(1), stats["writes"].(bson.M)["ops"])
+	assert.Equal(t, int64(0), stats["commands"].(bson.M)["ops"])
+	assert.Equal(t, int64(0), stats["transactions"].(bson.M)["ops"])
+	assert.Equal(t, bson.A{}, stats["transactions"].(bson.M)["histogram"])
+
+	var sum int64
+	for _, bucket := range stats["reads"].(bson.M)["histogram"].(bson.A) {
+		sum += bucket.(bson.M)["count"].(int64)
+	}
+	assert.Equal(t, int64(1), sum)
+
+	// the previous aggregation is counted as a read
+	csr, err = coll.Aggregate(nil, bson.A{
+		bson.M{"$collStats": bson.M{"latencyStats": bson.M{}}},
+		bson.M{"$project": bson.M{"reads": "$latencyStats.reads.ops", "_id": 0}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"reads": int64(2)},
+	}, readAll(csr))
+
+	// storage statistics
+	csr, err = coll.Aggregate(nil, bson.A{
+		bson.M{"$collStats": bson.M{
+			"storageStats": bson.M{"scale": 1},
+			"count":        bson.M{},
+		}},
+	})
+	assert.NoError(t, err)
+	res = readAll(csr)
+	assert.Len(t, res, 1)
+	assert.Equal(t, int64(2), res[0]["count"])
+
+	storage := res[0]["storageStats"].(bson.M)
+	assert.Equal(t, int64(2), storage["count"])
+	assert.Equal(t, int64(2), storage["nindexes"])
+	assert.True(t, storage["size"].(int64) > 0)
+	assert.Equal(t, storage["size"].(int64)/2, storage["avgObjSize"])
+	assert.Equal(t, storage["size"].(int64)+storage["totalIndexSize"].(int64), storage["totalSize"])
+	assert.Len(t, storage["indexSizes"].(bson.M), 2)
+	assert.Equal(t, int64(1), storage["scaleFactor"])
+
+	// missing collection
+	csr, err = client.Database("foo").Collection("baz").Aggregate(nil, bson.A{
+		bson.M{"$collStats": bson.M{"latencyStats": bson.M{}}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, readAll(csr), 1)
+
+	_, err = client.Database("foo").Collection("baz").Aggregate(nil, bson.A{
+		bson.M{"$collStats": bson.M{"storageStats": bson.M{}}},
+	})
+	assert.Error(t, err)
+
+	// invalid options
+	_, err = coll.Aggregate(nil, bson.A{
+		bson.M{"$collStats": bson.M{"queryExecStats": bson.M{}}},
+	})
+	assert.Error(t, err)
+
+	_, err = coll.Aggregate(nil, bson.A{
+		bson.M{"$collStats": bson.M{"storageStats": bson.M{"scale": 0}}},
+	})
+	assert.Error(t, err)
+}
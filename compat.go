@@ -0,0 +1,42 @@
+package lungo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseServerVersion will parse a server version in the form "major.minor" or
+// "major.minor.patch". The patch version is ignored.
+func parseServerVersion(version string) ([2]int, error) {
+	// split version
+	segments := strings.Split(version, ".")
+	if len(segments) < 2 || len(segments) > 3 {
+		return [2]int{}, fmt.Errorf("invalid server version %q", version)
+	}
+
+	// parse segments
+	var res [2]int
+	for i, segment := range segments {
+		num, err := strconv.Atoi(segment)
+		if err != nil || num < 0 {
+			return [2]int{}, fmt.Errorf("invalid server version %q", version)
+		}
+		if i < 2 {
+			res[i] = num
+		}
+	}
+
+	return res, nil
+}
+
+// older will return whether the mimicked server version is older than the
+// specified version. It always returns false if no version has been set.
+func (e *Engine) older(major, minor int) bool {
+	// check version
+	if e.version == [2]int{} {
+		return false
+	}
+
+	return e.version[0] < major || (e.version[0] == major && e.version[1] < minor)
+}
@@ -0,0 +1,97 @@
+package lungo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	version, err := parseServerVersion("4.0")
+	assert.NoError(t, err)
+	assert.Equal(t, [2]int{4, 0}, version)
+
+	version, err = parseServerVersion("4.2.18")
+	assert.NoError(t, err)
+	assert.Equal(t, [2]int{4, 2}, version)
+
+	for _, str := range []string{"4", "4.x", "4.2.1.0", "-1.0"} {
+		_, err = parseServerVersion(str)
+		assert.Error(t, err, str)
+	}
+
+	_, err = CreateEngine(Options{
+		Store:         NewMemoryStore(),
+		ServerVersion: "foo",
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `invalid server version "foo"`, err.Error())
+}
+
+func TestEngineServerVersion(t *testing.T) {
+	for _, item := range []struct {
+		version string
+		legacy  bool
+	}{
+		{version: "", legacy: false},
+		{version: "3.2", legacy: true},
+		{version: "4.0", legacy: true},
+		{version: "4.4", legacy: false},
+	} {
+		client, engine, err := Open(nil, Options{
+			Store:         NewMemoryStore(),
+			ServerVersion: item.version,
+		})
+		assert.NoError(t, err)
+
+		indexes := client.Database("foo").Collection("bar").Indexes()
+
+		// create index
+		name, err := indexes.CreateOne(nil, mongo.IndexModel{
+			Keys: bson.M{"baz": 1},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "baz_1", name)
+
+		// long index name
+		_, err = indexes.CreateOne(nil, mongo.IndexModel{
+			Keys:    bson.M{"qux": 1},
+			Options: options.Index().SetName(strings.Repeat("x", 120)),
+		})
+		if item.legacy {
+			assert.Error(t, err, item.version)
+			assert.Contains(t, err.Error(), "is too long (127 byte max)", item.version)
+		} else {
+			assert.NoError(t, err, item.version)
+		}
+
+		// list indexes
+		csr, err := indexes.List(nil)
+		assert.NoError(t, err)
+		specs := readAll(csr)
+		if item.legacy {
+			v := int32(2)
+			if item.version == "3.2" {
+				v = 1
+			}
+			assert.Equal(t, bson.M{
+				"v":    v,
+				"key":  bson.M{"_id": int32(1)},
+				"name": "_id_",
+				"ns":   "foo.bar",
+			}, specs[0], item.version)
+		} else {
+			assert.Equal(t, bson.M{
+				"v":    int32(2),
+				"key":  bson.M{"_id": int32(1)},
+				"name": "_id_",
+			}, specs[0], item.version)
+		}
+
+		engine.Close()
+	}
+}
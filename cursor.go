@@ -5,39 +5,75 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/256dpi/lungo/bsonkit"
 )
 
 var _ ICursor = &Cursor{}
 
-// Cursor wraps a list to be mongo compatible.
+// ErrCursorNotFound is returned by cursors that have been killed using
+// Engine.KillCursor or because they have been idle for longer than the
+// configured cursor timeout.
+var ErrCursorNotFound = mongo.CommandError{
+	Code:    43,
+	Name:    "CursorNotFound",
+	Message: "cursor not found",
+}
+
+// Cursor wraps a list to be mongo compatible. Cursors are closed when the
+// engine they have been created from is closed. Cursors with remaining
+// documents are tracked by the engine and killed if they are idle for longer
+// than the configured cursor timeout.
 type Cursor struct {
-	list   bsonkit.List
-	pos    int
-	closed bool
-	mutex  sync.Mutex
+	engine    *Engine
+	list      bsonkit.List
+	pos       int
+	current   bsonkit.Doc
+	pooled    bool
+	registry  *bsoncodec.Registry
+	ns        string
+	id        int64
+	noTimeout bool
+	used      time.Time
+	closed    bool
+	error     error
+	mutex     sync.Mutex
 }
 
-// All implements the ICursor.All method.
+// All implements the ICursor.All method. Like the driver, it decodes the
+// remaining documents into the slice pointed to by out, which may hold values
+// or pointers, and closes the cursor afterwards. Documents that have already
+// been iterated are not included.
 func (c *Cursor) All(_ context.Context, out interface{}) error {
 	// acquire mutex
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	// check engine
+	c.check()
+
 	// check if closed
-	if c.closed {
+	if c.error != nil {
+		return c.error
+	} else if c.closed {
 		return fmt.Errorf("cursor closed")
 	}
 
-	// decode items
-	err := bsonkit.DecodeList(c.list, out)
+	// ensure closing
+	defer c.close()
+
+	// decode remaining items
+	err := bsonkit.DecodeListWithRegistry(c.registry, c.list[c.pos:], out)
 	if err != nil {
 		return err
 	}
 
-	// close cursor
-	c.closed = true
+	// set position
+	c.pos = len(c.list)
 
 	return nil
 }
@@ -49,7 +85,7 @@ func (c *Cursor) Close(context.Context) error {
 	defer c.mutex.Unlock()
 
 	// close cursor
-	c.closed = true
+	c.close()
 
 	return nil
 }
@@ -60,13 +96,13 @@ func (c *Cursor) Decode(out interface{}) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	// check if exhausted
-	if c.pos == 0 || c.pos > len(c.list) {
+	// check current
+	if c.current == nil {
 		return io.EOF
 	}
 
 	// decode item
-	err := bsonkit.Decode(c.list[c.pos-1], out)
+	err := bsonkit.DecodeWithRegistry(c.registry, c.current, out)
 	if err != nil {
 		return err
 	}
@@ -74,14 +110,25 @@ func (c *Cursor) Decode(out interface{}) error {
 	return nil
 }
 
-// Err implements the ICursor.Err method.
+// Err implements the ICursor.Err method. Like the driver, closing a cursor does
+// not set an error. It returns ErrCursorNotFound if the cursor has been killed
+// and ErrEngineClosed if the engine has been closed while it was iterated.
 func (c *Cursor) Err() error {
-	return nil
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.error
 }
 
-// ID implements the ICursor.ID method.
+// ID implements the ICursor.ID method. It returns zero if the cursor is not
+// tracked by the engine or has been exhausted, closed or killed.
 func (c *Cursor) ID() int64 {
-	return 0
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.id
 }
 
 // Next implements the ICursor.Next method.
@@ -90,14 +137,24 @@ func (c *Cursor) Next(context.Context) bool {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	// check if closed
-	if c.closed {
+	// check engine
+	c.check()
+
+	// check if closed or failed
+	if c.closed || c.error != nil {
 		return false
 	}
 
+	// set usage
+	c.used = time.Now()
+
 	// increment position
 	if c.pos < len(c.list) {
+		c.current = c.list[c.pos]
 		c.pos++
+		if c.pos == len(c.list) {
+			c.untrack()
+		}
 		return true
 	}
 
@@ -106,13 +163,100 @@ func (c *Cursor) Next(context.Context) bool {
 
 // RemainingBatchLength implements the ICursor.RemainingBatchLength method.
 func (c *Cursor) RemainingBatchLength() int {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	return len(c.list) - c.pos
 }
 
-// SetBatchSize implements the ICursor.SetBatchSize method.
+// SetBatchSize implements the ICursor.SetBatchSize method. As all documents
+// are held in memory and returned as a single batch, the batch size has no
+// effect.
 func (c *Cursor) SetBatchSize(int32) {}
 
-// TryNext implements the ICursor.TryNext method.
+// TryNext implements the ICursor.TryNext method. As cursors are never tailable
+// and all documents are available immediately, it behaves like Next and never
+// blocks. Once it returns false, the cursor is exhausted.
 func (c *Cursor) TryNext(ctx context.Context) bool {
 	return c.Next(ctx)
 }
+
+func (c *Cursor) close() {
+	// check if closed
+	if c.closed {
+		return
+	}
+
+	// release pooled list
+	if c.pooled {
+		bsonkit.ReleaseList(c.list)
+		c.list = nil
+		c.pos = 0
+	}
+
+	// set flag
+	c.closed = true
+
+	// untrack cursor
+	c.untrack()
+}
+
+func (c *Cursor) info() (CursorInfo, bool) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// check id
+	if c.id == 0 {
+		return CursorInfo{}, false
+	}
+
+	return CursorInfo{
+		ID:        c.id,
+		Namespace: c.ns,
+		Remaining: len(c.list) - c.pos,
+		NoTimeout: c.noTimeout,
+		LastUsed:  c.used,
+	}, true
+}
+
+func (c *Cursor) kill(deadline time.Time) bool {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// check if closed or used recently, a zero deadline kills unconditionally
+	if c.closed || (!deadline.IsZero() && c.used.After(deadline)) {
+		return false
+	}
+
+	// close cursor and release documents
+	c.close()
+	c.list = nil
+	c.pos = 0
+	c.current = nil
+	c.error = ErrCursorNotFound
+
+	return true
+}
+
+func (c *Cursor) untrack() {
+	// check id
+	if c.id == 0 {
+		return
+	}
+
+	// remove cursor
+	c.engine.untrackCursor(c.id)
+	c.id = 0
+}
+
+func (c *Cursor) check() {
+	// close cursor if engine has been closed
+	if !c.closed && c.engine != nil && c.engine.Closed() {
+		c.close()
+		c.current = nil
+		c.error = ErrEngineClosed
+	}
+}
@@ -0,0 +1,128 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCursorAll(t *testing.T) {
+	type model struct {
+		N int `bson:"n"`
+	}
+
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		_, err := c.InsertMany(nil, []interface{}{
+			bson.M{"n": 1},
+			bson.M{"n": 2},
+			bson.M{"n": 3},
+		})
+		assert.NoError(t, err)
+
+		// values
+		var values []model
+		csr, err := c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{"n": 1}))
+		assert.NoError(t, err)
+		err = csr.All(nil, &values)
+		assert.NoError(t, err)
+		assert.Equal(t, []model{{N: 1}, {N: 2}, {N: 3}}, values)
+		assert.Equal(t, int64(0), csr.ID())
+
+		// pointers
+		var pointers []*model
+		csr, err = c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{"n": 1}))
+		assert.NoError(t, err)
+		err = csr.All(nil, &pointers)
+		assert.NoError(t, err)
+		assert.Equal(t, []*model{{N: 1}, {N: 2}, {N: 3}}, pointers)
+
+		// remaining
+		values = []model{{N: 7}, {N: 8}, {N: 9}}
+		csr, err = c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{"n": 1}))
+		assert.NoError(t, err)
+		assert.True(t, csr.Next(nil))
+		err = csr.All(nil, &values)
+		assert.NoError(t, err)
+		assert.Equal(t, []model{{N: 2}, {N: 3}}, values)
+		assert.False(t, csr.Next(nil))
+		assert.NoError(t, csr.Err())
+
+		// empty
+		values = []model{{N: 7}}
+		csr, err = c.Find(nil, bson.M{"n": 4})
+		assert.NoError(t, err)
+		err = csr.All(nil, &values)
+		assert.NoError(t, err)
+		assert.Equal(t, []model{}, values)
+
+		// invalid
+		var value model
+		csr, err = c.Find(nil, bson.M{})
+		assert.NoError(t, err)
+		err = csr.All(nil, &value)
+		assert.Error(t, err)
+	})
+}
+
+func TestCursorTryNext(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		_, err := c.InsertMany(nil, []interface{}{
+			bson.M{"n": 1},
+			bson.M{"n": 2},
+			bson.M{"n": 3},
+		})
+		assert.NoError(t, err)
+
+		csr, err := c.Find(nil, bson.M{}, options.Find().SetSort(bson.M{"n": 1}))
+		assert.NoError(t, err)
+		csr.SetBatchSize(1)
+
+		var list []int32
+		for csr.TryNext(nil) {
+			var doc struct {
+				N int32 `bson:"n"`
+			}
+			err = csr.Decode(&doc)
+			assert.NoError(t, err)
+			list = append(list, doc.N)
+		}
+		assert.Equal(t, []int32{1, 2, 3}, list)
+		assert.False(t, csr.TryNext(nil))
+		assert.NoError(t, csr.Err())
+		assert.Equal(t, int64(0), csr.ID())
+		assert.NoError(t, csr.Close(nil))
+	})
+}
+
+func TestCursorClose(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertMany(nil, []interface{}{
+		bson.M{"n": 1},
+		bson.M{"n": 2},
+	})
+	assert.NoError(t, err)
+
+	csr, err := coll.Find(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.NotZero(t, csr.ID())
+	assert.True(t, csr.Next(nil))
+
+	assert.NoError(t, csr.Close(nil))
+	assert.NoError(t, csr.Close(nil))
+	assert.False(t, csr.Next(nil))
+	assert.False(t, csr.TryNext(nil))
+	assert.NoError(t, csr.Err())
+	assert.Zero(t, csr.ID())
+
+	var list []bson.M
+	err = csr.All(nil, &list)
+	assert.Error(t, err)
+}
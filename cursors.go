@@ -0,0 +1,144 @@
+package lungo
+
+import (
+	"sort"
+	"time"
+)
+
+// CursorInfo describes a cursor that is tracked by the engine.
+type CursorInfo struct {
+	// The cursor ID as returned by Cursor.ID.
+	ID int64
+
+	// The namespace the cursor has been created for.
+	Namespace string
+
+	// The number of documents that have not yet been returned.
+	Remaining int
+
+	// Whether the cursor is exempt from the cursor timeout.
+	NoTimeout bool
+
+	// The time the cursor has been created or last used.
+	LastUsed time.Time
+}
+
+// ListCursors will return information about all cursors with remaining
+// documents that are tracked by the engine, ordered by their ID. Tracked
+// cursors retain the documents they have been created from, which may be
+// used to debug memory retention.
+func (e *Engine) ListCursors() []CursorInfo {
+	// collect cursors
+	e.mutex.Lock()
+	cursors := make([]*Cursor, 0, len(e.cursors))
+	for _, csr := range e.cursors {
+		cursors = append(cursors, csr)
+	}
+	e.mutex.Unlock()
+
+	// get infos (without lock)
+	list := make([]CursorInfo, 0, len(cursors))
+	for _, csr := range cursors {
+		info, ok := csr.info()
+		if ok {
+			list = append(list, info)
+		}
+	}
+
+	// sort infos
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// KillCursor will kill the cursor with the specified ID and release the
+// documents it retains. Subsequent uses of the cursor fail with
+// ErrCursorNotFound. It returns false if no such cursor is tracked.
+func (e *Engine) KillCursor(id int64) bool {
+	return e.killCursor(id, "")
+}
+
+func (e *Engine) killCursor(id int64, ns string) bool {
+	// get cursor
+	e.mutex.Lock()
+	csr := e.cursors[id]
+	e.mutex.Unlock()
+
+	// check cursor and namespace
+	if csr == nil || (ns != "" && csr.ns != ns) {
+		return false
+	}
+
+	// kill cursor (without lock)
+	return csr.kill(time.Time{})
+}
+
+func (e *Engine) trackCursor(csr *Cursor) *Cursor {
+	// set usage
+	csr.used = time.Now()
+
+	// check engine and list
+	if e == nil || len(csr.list) == 0 {
+		return csr
+	}
+
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// add cursor
+	e.cursor++
+	csr.id = e.cursor
+	e.cursors[csr.id] = csr
+
+	return csr
+}
+
+func (e *Engine) untrackCursor(id int64) {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// remove cursor
+	delete(e.cursors, id)
+}
+
+func (e *Engine) timeoutCursors(timeout time.Duration) {
+	// ensure done
+	defer e.group.Done()
+
+	// get interval
+	interval := timeout
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	for {
+		// await next interval or close
+		select {
+		case <-time.After(interval):
+		case <-e.done:
+			return
+		}
+
+		// collect cursors
+		e.mutex.Lock()
+		list := make([]*Cursor, 0, len(e.cursors))
+		for _, csr := range e.cursors {
+			if !csr.noTimeout {
+				list = append(list, csr)
+			}
+		}
+		e.mutex.Unlock()
+
+		// kill idle cursors (without lock)
+		deadline := time.Now().Add(-timeout)
+		for _, csr := range list {
+			if csr.kill(deadline) {
+				e.log(LogDebug, "killed idle cursor", "ns", csr.ns, "timeout", timeout)
+			}
+		}
+	}
+}
@@ -2,7 +2,14 @@ package lungo
 
 import (
 	"context"
-
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
@@ -10,25 +17,115 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 
 	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
 )
 
 var _ IDatabase = &Database{}
 
 // Database wraps an Engine to be mongo compatible.
 type Database struct {
-	engine *Engine
-	name   string
+	engine   *Engine
+	name     string
+	registry *bsoncodec.Registry
+
+	// the unsupported option error of the handle constructor, returned by
+	// all operations
+	err error
 }
 
-// Aggregate implements the IDatabase.Aggregate method.
-func (d *Database) Aggregate(context.Context, interface{}, ...*options.AggregateOptions) (ICursor, error) {
-	panic("lungo: not implemented")
+// Aggregate implements the IDatabase.Aggregate method. The pipeline must start
+// with one of the database level stages $documents, $currentOp,
+// $listLocalSessions or $listSessions. The latter three are only available on
+// the admin database and report the in-flight operations and server sessions
+// of the engine.
+func (d *Database) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (ICursor, error) {
+	// merge options
+	opt := options.MergeAggregateOptions(opts...)
+
+	// assert supported options
+	err := d.assertOptions("Database.Aggregate", opt, map[string]string{
+		"AllowDiskUse": ignored,
+		"BatchSize":    ignored,
+		"Comment":      supported,
+		"Let":          supported,
+		"MaxTime":      supported,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// check pipeline
+	if pipeline == nil {
+		panic("lungo: missing pipeline")
+	}
+
+	// transform pipeline
+	stages, err := bsonkit.TransformListWithRegistry(d.registry, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	// get variables
+	variables, err := transformLet(d.registry, opt.Let)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// get handle
+	handle := Handle{d.name, "$cmd.aggregate"}
+
+	// monitor operation
+	coll := &Collection{engine: d.engine, handle: handle, registry: d.registry}
+	ctx, done := coll.monitor(ctx, "aggregate", opt.Comment, nil)
+	defer done()
+
+	// get first stage
+	var stage bson.E
+	if len(stages) > 0 && len(*stages[0]) == 1 {
+		stage = (*stages[0])[0]
+	}
+
+	// get documents
+	var list bsonkit.List
+	switch stage.Key {
+	case "$documents":
+		list, err = d.documents(stage.Value, variables)
+	case "$currentOp":
+		list, err = d.currentOp(stage.Value)
+	case "$listLocalSessions", "$listSessions":
+		list, err = d.listSessions(stage.Key, stage.Value)
+	case "":
+		err = fmt.Errorf("{aggregate: 1} requires a database level stage")
+	default:
+		err = fmt.Errorf("{aggregate: 1} is not valid for '%s'; a collection is required", stage.Key)
+	}
+	if err != nil {
+		return nil, commandError(err)
+	}
+
+	// run remaining stages
+	list, err = mongokit.Aggregate(&mongokit.AggregationContext{
+		Context:   ctx,
+		Variables: variables,
+		Random:    d.engine.Random(),
+		Functions: d.engine.accumulators(),
+	}, list, stages[1:])
+	if err != nil {
+		return nil, commandError(contextError(ctx, err))
+	}
+
+	return d.engine.trackCursor(&Cursor{engine: d.engine, list: list, registry: d.registry, ns: handle.String()}), nil
 }
 
 // Client implements the IDatabase.Client method.
 func (d *Database) Client() IClient {
 	return &Client{
-		engine: d.engine,
+		engine:   d.engine,
+		registry: d.engine.opts.Registry,
 	}
 }
 
@@ -37,16 +134,26 @@ func (d *Database) Collection(name string, opts ...*options.CollectionOptions) I
 	// merge options
 	opt := options.MergeCollectionOptions(opts...)
 
-	// assert supported options
-	assertOptions(opt, map[string]string{
+	// assert supported options, errors are returned by the first operation
+	// on the collection as they cannot be returned here
+	err := d.assertOptions("Database.Collection", opt, map[string]string{
 		"ReadConcern":    ignored,
 		"WriteConcern":   ignored,
 		"ReadPreference": ignored,
+		"Registry":       supported,
 	})
 
+	// get registry
+	registry := d.registry
+	if opt.Registry != nil {
+		registry = opt.Registry
+	}
+
 	return &Collection{
-		engine: d.engine,
-		handle: Handle{d.name, name},
+		engine:   d.engine,
+		handle:   Handle{d.name, name},
+		registry: registry,
+		err:      err,
 	}
 }
 
@@ -56,7 +163,31 @@ func (d *Database) CreateCollection(ctx context.Context, name string, opts ...*o
 	opt := options.MergeCreateCollectionOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{})
+	err := d.assertOptions("Database.CreateCollection", opt, map[string]string{
+		"ChangeStreamPreAndPostImages": supported,
+		"TimeSeriesOptions":            supported,
+	})
+	if err != nil {
+		return err
+	}
+
+	// get pre-images
+	var preImages bool
+	if opt.ChangeStreamPreAndPostImages != nil {
+		doc, err := bsonkit.TransformWithRegistry(d.registry, opt.ChangeStreamPreAndPostImages)
+		if err != nil {
+			return err
+		}
+		preImages, _ = bsonkit.Get(doc, "enabled").(bool)
+	}
+
+	// get handle
+	handle, err := NewHandle(d.name, name)
+	if err != nil {
+		return err
+	} else if handle.IsDatabase() {
+		return fmt.Errorf("missing collection name")
+	}
 
 	// begin transaction
 	txn, err := d.engine.Begin(ctx, true)
@@ -67,10 +198,38 @@ func (d *Database) CreateCollection(ctx context.Context, name string, opts ...*o
 	// ensure abortion
 	defer d.engine.Abort(txn)
 
-	// create collection
-	err = txn.Create(Handle{d.name, name})
-	if err != nil {
-		return err
+	// create time series collection
+	if opt.TimeSeriesOptions != nil {
+		// prepare config
+		config := mongokit.TimeSeriesConfig{
+			TimeField: opt.TimeSeriesOptions.TimeField,
+		}
+		if opt.TimeSeriesOptions.MetaField != nil {
+			config.MetaField = *opt.TimeSeriesOptions.MetaField
+		}
+		if opt.TimeSeriesOptions.Granularity != nil {
+			config.Granularity = *opt.TimeSeriesOptions.Granularity
+		}
+
+		// create collection
+		err = txn.CreateTimeSeries(handle, config)
+		if err != nil {
+			return err
+		}
+	} else {
+		// create collection
+		err = txn.Create(handle)
+		if err != nil {
+			return err
+		}
+	}
+
+	// enable pre-images
+	if preImages {
+		err = txn.EnablePreImages(handle, true)
+		if err != nil {
+			return err
+		}
 	}
 
 	// commit transaction
@@ -89,6 +248,11 @@ func (d *Database) CreateView(_ context.Context, _, _ string, _ interface{}, _ .
 
 // Drop implements the IDatabase.Drop method.
 func (d *Database) Drop(ctx context.Context) error {
+	// check error
+	if d.err != nil {
+		return d.err
+	}
+
 	// begin transaction
 	txn, err := d.engine.Begin(ctx, true)
 	if err != nil {
@@ -145,10 +309,13 @@ func (d *Database) ListCollections(ctx context.Context, filter interface{}, opts
 	opt := options.MergeListCollectionsOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{})
+	err := d.assertOptions("Database.ListCollections", opt, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
 
 	// transform filter
-	query, err := bsonkit.Transform(filter)
+	query, err := bsonkit.TransformWithRegistry(d.registry, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -165,7 +332,7 @@ func (d *Database) ListCollections(ctx context.Context, filter interface{}, opts
 		return nil, err
 	}
 
-	return &Cursor{list: list}, nil
+	return d.engine.trackCursor(&Cursor{engine: d.engine, list: list, registry: d.registry, ns: d.name + ".$cmd.listCollections"}), nil
 }
 
 // Name implements the IDatabase.Name method.
@@ -183,9 +350,56 @@ func (d *Database) ReadPreference() *readpref.ReadPref {
 	return readpref.Primary()
 }
 
-// RunCommand implements the IDatabase.RunCommand method.
-func (d *Database) RunCommand(context.Context, interface{}, ...*options.RunCmdOptions) ISingleResult {
-	panic("lungo: not implemented")
+// RunCommand implements the IDatabase.RunCommand method. Only the killCursors,
+// killOp, mapReduce, renameCollection and validate commands are supported.
+func (d *Database) RunCommand(ctx context.Context, runCommand interface{}, opts ...*options.RunCmdOptions) ISingleResult {
+	// merge options
+	opt := options.MergeRunCmdOptions(opts...)
+
+	// assert supported options
+	err := d.assertOptions("Database.RunCommand", opt, map[string]string{
+		"ReadPreference": ignored,
+	})
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// transform command
+	cmd, err := bsonkit.TransformWithRegistry(d.registry, runCommand)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// check command
+	if len(*cmd) == 0 {
+		return &SingleResult{err: fmt.Errorf("empty command")}
+	}
+
+	// run command
+	var res bsonkit.Doc
+	switch name := (*cmd)[0].Key; name {
+	case "killCursors":
+		res, err = d.killCursors(cmd)
+	case "killOp":
+		res, err = d.killOp(cmd)
+	case "mapReduce":
+		res, err = d.mapReduce(ctx, cmd)
+	case "renameCollection":
+		res, err = d.renameCollection(ctx, cmd)
+	case "validate":
+		res, err = d.validate(ctx, cmd)
+	default:
+		err = mongo.CommandError{
+			Code:    59,
+			Name:    "CommandNotFound",
+			Message: fmt.Sprintf("no such command: '%s'", name),
+		}
+	}
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	return &SingleResult{doc: res, registry: d.registry}
 }
 
 // RunCommandCursor implements the IDatabase.RunCommandCursor method.
@@ -199,17 +413,21 @@ func (d *Database) Watch(_ context.Context, pipeline interface{}, opts ...*optio
 	opt := options.MergeChangeStreamOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"BatchSize":            ignored,
-		"FullDocument":         ignored,
-		"MaxAwaitTime":         ignored,
-		"ResumeAfter":          supported,
-		"StartAtOperationTime": supported,
-		"StartAfter":           supported,
+	err := d.assertOptions("Database.Watch", opt, map[string]string{
+		"BatchSize":                ignored,
+		"FullDocument":             supported,
+		"FullDocumentBeforeChange": supported,
+		"MaxAwaitTime":             ignored,
+		"ResumeAfter":              supported,
+		"StartAtOperationTime":     supported,
+		"StartAfter":               supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// transform pipeline
-	filter, err := bsonkit.TransformList(pipeline)
+	filter, err := bsonkit.TransformListWithRegistry(d.registry, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -217,7 +435,7 @@ func (d *Database) Watch(_ context.Context, pipeline interface{}, opts ...*optio
 	// get resume after
 	var resumeAfter bsonkit.Doc
 	if opt.ResumeAfter != nil {
-		resumeAfter, err = bsonkit.Transform(opt.ResumeAfter)
+		resumeAfter, err = bsonkit.TransformWithRegistry(d.registry, opt.ResumeAfter)
 		if err != nil {
 			return nil, err
 		}
@@ -226,7 +444,7 @@ func (d *Database) Watch(_ context.Context, pipeline interface{}, opts ...*optio
 	// get start after
 	var startAfter bsonkit.Doc
 	if opt.StartAfter != nil {
-		startAfter, err = bsonkit.Transform(opt.StartAfter)
+		startAfter, err = bsonkit.TransformWithRegistry(d.registry, opt.StartAfter)
 		if err != nil {
 			return nil, err
 		}
@@ -238,6 +456,19 @@ func (d *Database) Watch(_ context.Context, pipeline interface{}, opts ...*optio
 		return nil, err
 	}
 
+	// set registry
+	stream.registry = d.registry
+
+	// set full document
+	if opt.FullDocument != nil {
+		stream.fullDocument = *opt.FullDocument
+	}
+
+	// set full document before change
+	if opt.FullDocumentBeforeChange != nil {
+		stream.fullDocumentBeforeChange = *opt.FullDocumentBeforeChange
+	}
+
 	return stream, nil
 }
 
@@ -245,3 +476,398 @@ func (d *Database) Watch(_ context.Context, pipeline interface{}, opts ...*optio
 func (d *Database) WriteConcern() *writeconcern.WriteConcern {
 	return nil
 }
+
+func (d *Database) killCursors(cmd bsonkit.Doc) (bsonkit.Doc, error) {
+	// get collection
+	coll, ok := bsonkit.Get(cmd, "killCursors").(string)
+	if !ok || coll == "" {
+		return nil, fmt.Errorf("killCursors: expected collection name")
+	}
+
+	// get cursors
+	cursors, ok := bsonkit.Get(cmd, "cursors").(bson.A)
+	if !ok || len(cursors) == 0 {
+		return nil, fmt.Errorf("killCursors: expected non-empty cursors array")
+	}
+
+	// get namespace
+	ns := Handle{d.name, coll}.String()
+
+	// kill cursors
+	killed := bson.A{}
+	notFound := bson.A{}
+	for _, item := range cursors {
+		id, ok := item.(int64)
+		if !ok {
+			return nil, fmt.Errorf("killCursors: expected cursor id to be a long")
+		}
+		if d.engine.killCursor(id, ns) {
+			killed = append(killed, id)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+
+	return &bson.D{
+		{Key: "cursorsKilled", Value: killed},
+		{Key: "cursorsNotFound", Value: notFound},
+		{Key: "cursorsAlive", Value: bson.A{}},
+		{Key: "cursorsUnknown", Value: bson.A{}},
+		{Key: "ok", Value: 1.0},
+	}, nil
+}
+
+func (d *Database) killOp(cmd bsonkit.Doc) (bsonkit.Doc, error) {
+	// check database
+	if d.name != "admin" {
+		return nil, fmt.Errorf("killOp may only be run against the admin database")
+	}
+
+	// get operation
+	var id int64
+	switch op := bsonkit.Get(cmd, "op").(type) {
+	case int32:
+		id = int64(op)
+	case int64:
+		id = op
+	case float64:
+		id = int64(op)
+	default:
+		return nil, fmt.Errorf("killOp: expected numeric op")
+	}
+
+	// kill operation, like MongoDB the result does not indicate whether the
+	// operation has been found
+	d.engine.KillOp(id)
+
+	return &bson.D{
+		{Key: "info", Value: "attempting to kill op"},
+		{Key: "ok", Value: 1.0},
+	}, nil
+}
+
+func (d *Database) renameCollection(ctx context.Context, cmd bsonkit.Doc) (bsonkit.Doc, error) {
+	// check database
+	if d.name != "admin" {
+		return nil, fmt.Errorf("renameCollection may only be run against the admin database")
+	}
+
+	// get source and target
+	from, ok1 := parseNamespace(bsonkit.Get(cmd, "renameCollection"))
+	to, ok2 := parseNamespace(bsonkit.Get(cmd, "to"))
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("renameCollection: expected source and target namespaces")
+	}
+
+	// get drop target
+	dropTarget, _ := bsonkit.Get(cmd, "dropTarget").(bool)
+
+	// rename namespace
+	_, err := useTransaction(ctx, d.engine, true, func(txn *Transaction) (interface{}, error) {
+		return nil, txn.Rename(from, to, dropTarget)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &bson.D{
+		{Key: "ok", Value: 1.0},
+	}, nil
+}
+
+func (d *Database) validate(ctx context.Context, cmd bsonkit.Doc) (bsonkit.Doc, error) {
+	// get collection
+	coll, ok := bsonkit.Get(cmd, "validate").(string)
+	if !ok || coll == "" {
+		return nil, fmt.Errorf("validate: expected collection name")
+	}
+
+	// check options, validation is always full and never repairs
+	for _, field := range (*cmd)[1:] {
+		switch field.Key {
+		case "full", "background", "metadata", "checkBSONConformance":
+			if _, ok := field.Value.(bool); !ok {
+				return nil, fmt.Errorf("validate: expected boolean for %q", field.Key)
+			}
+		case "repair":
+			if field.Value != false {
+				return nil, fmt.Errorf("validate: repair is not supported")
+			}
+		case "comment":
+		default:
+			return nil, fmt.Errorf("validate: unrecognized option %q", field.Key)
+		}
+	}
+
+	// get handle
+	handle := Handle{d.name, coll}
+
+	// get namespace
+	res, err := useTransaction(ctx, d.engine, false, func(txn *Transaction) (interface{}, error) {
+		err := txn.Load(handle)
+		if err != nil {
+			return nil, err
+		}
+		return txn.Catalog().Namespaces[handle], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	namespace := res.(*mongokit.Collection)
+	if namespace == nil {
+		return nil, mongo.CommandError{
+			Code:    26,
+			Name:    "NamespaceNotFound",
+			Message: fmt.Sprintf("Collection '%s' does not exist to validate.", handle.String()),
+		}
+	}
+
+	// validate namespace
+	validation := namespace.Validate()
+
+	// sort index names
+	names := make([]string, 0, len(validation.Indexes))
+	for name := range validation.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// prepare index details
+	keysPerIndex := bson.D{}
+	indexDetails := bson.D{}
+	for _, name := range names {
+		index := validation.Indexes[name]
+		keysPerIndex = append(keysPerIndex, bson.E{Key: name, Value: int64(index.Keys)})
+		indexDetails = append(indexDetails, bson.E{Key: name, Value: bson.D{
+			{Key: "valid", Value: index.Valid},
+		}})
+	}
+
+	// prepare errors
+	errs := bson.A{}
+	for _, msg := range validation.Errors {
+		errs = append(errs, msg)
+	}
+
+	return &bson.D{
+		{Key: "ns", Value: handle.String()},
+		{Key: "nInvalidDocuments", Value: int64(0)},
+		{Key: "nNonCompliantDocuments", Value: int64(0)},
+		{Key: "nrecords", Value: int64(validation.Records)},
+		{Key: "nIndexes", Value: int64(len(names))},
+		{Key: "keysPerIndex", Value: keysPerIndex},
+		{Key: "indexDetails", Value: indexDetails},
+		{Key: "valid", Value: len(validation.Errors) == 0},
+		{Key: "repaired", Value: false},
+		{Key: "warnings", Value: bson.A{}},
+		{Key: "errors", Value: errs},
+		{Key: "extraIndexEntries", Value: bson.A{}},
+		{Key: "missingIndexEntries", Value: bson.A{}},
+		{Key: "corruptRecords", Value: bson.A{}},
+		{Key: "ok", Value: 1.0},
+	}, nil
+}
+
+func parseNamespace(value interface{}) (Handle, bool) {
+	// get string
+	str, ok := value.(string)
+	if !ok {
+		return Handle{}, false
+	}
+
+	// parse handle
+	handle, err := ParseHandle(str)
+	if err != nil || handle.IsDatabase() {
+		return Handle{}, false
+	}
+
+	return handle, true
+}
+
+func (d *Database) documents(arg interface{}, variables map[string]interface{}) (bsonkit.List, error) {
+	// evaluate expression
+	value, err := mongokit.Evaluate(&bson.D{}, arg, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	// get array
+	array, ok := value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("$documents: expected array")
+	}
+
+	// collect documents
+	list := make(bsonkit.List, 0, len(array))
+	for _, item := range array {
+		doc, ok := item.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("$documents: expected array of documents")
+		}
+		list = append(list, &doc)
+	}
+
+	return list, nil
+}
+
+func (d *Database) currentOp(arg interface{}) (bsonkit.List, error) {
+	// check database
+	if d.name != "admin" {
+		return nil, fmt.Errorf("$currentOp must be run against the 'admin' database with {aggregate: 1}")
+	}
+
+	// get spec
+	spec, ok := arg.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("$currentOp: expected document")
+	}
+
+	// check options, only idle cursors are supported
+	var idleCursors bool
+	for _, field := range spec {
+		switch field.Key {
+		case "allUsers", "idleConnections", "idleCursors", "idleSessions", "localOps", "truncateOps", "backtrace":
+			flag, ok := field.Value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("$currentOp: expected boolean for %q", field.Key)
+			}
+			if field.Key == "idleCursors" {
+				idleCursors = flag
+			}
+		default:
+			return nil, fmt.Errorf("$currentOp: unrecognized option %q", field.Key)
+		}
+	}
+
+	// get time
+	now := time.Now()
+
+	// add operations
+	var list bsonkit.List
+	for _, op := range d.engine.CurrentOps() {
+		// prepare command
+		var target interface{} = int32(1)
+		if _, coll, _ := strings.Cut(op.Namespace, "."); !strings.HasPrefix(coll, "$cmd") {
+			target = coll
+		}
+		command := bson.D{{Key: op.Command, Value: target}}
+		if op.Query != nil {
+			command = append(command, bson.E{Key: "filter", Value: *op.Query})
+		}
+		if op.Comment != nil {
+			command = append(command, bson.E{Key: "comment", Value: op.Comment})
+		}
+
+		// prepare document
+		running := now.Sub(op.Started)
+		doc := bson.D{
+			{Key: "type", Value: "op"},
+			{Key: "active", Value: true},
+			{Key: "opid", Value: op.ID},
+			{Key: "op", Value: operationType(op.Command)},
+			{Key: "ns", Value: op.Namespace},
+			{Key: "command", Value: command},
+			{Key: "currentOpTime", Value: now.Format(time.RFC3339Nano)},
+			{Key: "secs_running", Value: int64(running / time.Second)},
+			{Key: "microsecs_running", Value: int64(running / time.Microsecond)},
+		}
+
+		// add session
+		if op.SessionID != nil {
+			var lsid bson.D
+			err := bson.Unmarshal(op.SessionID, &lsid)
+			if err != nil {
+				return nil, err
+			}
+			doc = append(doc, bson.E{Key: "lsid", Value: lsid})
+		}
+
+		list = append(list, &doc)
+	}
+
+	// add idle cursors
+	if idleCursors {
+		for _, csr := range d.engine.ListCursors() {
+			list = append(list, &bson.D{
+				{Key: "type", Value: "idleCursor"},
+				{Key: "active", Value: false},
+				{Key: "ns", Value: csr.Namespace},
+				{Key: "cursor", Value: bson.D{
+					{Key: "cursorId", Value: csr.ID},
+					{Key: "lastAccessDate", Value: primitive.NewDateTimeFromTime(csr.LastUsed)},
+					{Key: "noCursorTimeout", Value: csr.NoTimeout},
+				}},
+			})
+		}
+	}
+
+	return list, nil
+}
+
+func (d *Database) listSessions(name string, arg interface{}) (bsonkit.List, error) {
+	// check database
+	if d.name != "admin" {
+		return nil, fmt.Errorf("%s must be run against the 'admin' database with {aggregate: 1}", name)
+	}
+
+	// get spec
+	spec, ok := arg.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected document", name)
+	}
+
+	// check options, users are not supported and all sessions are returned
+	for _, field := range spec {
+		switch field.Key {
+		case "allUsers":
+			if _, ok := field.Value.(bool); !ok {
+				return nil, fmt.Errorf("%s: expected boolean for %q", name, field.Key)
+			}
+		case "users":
+			if _, ok := field.Value.(bson.A); !ok {
+				return nil, fmt.Errorf("%s: expected array for %q", name, field.Key)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unrecognized option %q", name, field.Key)
+		}
+	}
+
+	// add sessions
+	var list bsonkit.List
+	for _, sess := range d.engine.ListSessions() {
+		var lsid bson.D
+		err := bson.Unmarshal(sess.ID, &lsid)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &bson.D{
+			{Key: "_id", Value: lsid},
+			{Key: "lastUse", Value: primitive.NewDateTimeFromTime(sess.LastUse)},
+		})
+	}
+
+	return list, nil
+}
+
+func operationType(command string) string {
+	// map command to operation type
+	switch command {
+	case "find":
+		return "query"
+	case "insert", "update":
+		return command
+	case "delete":
+		return "remove"
+	default:
+		return "command"
+	}
+}
+
+func (d *Database) assertOptions(operation string, opts interface{}, fields map[string]string) error {
+	// check error
+	if d.err != nil {
+		return d.err
+	}
+
+	return assertOptions(d.engine, operation, opts, fields)
+}
@@ -1,10 +1,14 @@
 package lungo
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
@@ -24,9 +28,116 @@ func TestDatabaseCollection(t *testing.T) {
 func TestDatabaseCreate(t *testing.T) {
 	databaseTest(t, func(t *testing.T, d IDatabase) {
 		assert.NoError(t, d.CreateCollection(nil, "bar"))
+		assert.NoError(t, d.CreateCollection(nil, "fs.files"))
+		assert.Error(t, d.CreateCollection(nil, "b$ar"))
+		assert.Error(t, d.CreateCollection(nil, ""))
 	})
 }
 
+func TestDatabaseCreateTimeSeries(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	db := client.Database("foo")
+
+	err = db.CreateCollection(nil, "bar", options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().SetTimeField("ts").SetMetaField("meta").SetGranularity("minutes"),
+	))
+	assert.NoError(t, err)
+
+	err = db.CreateCollection(nil, "bar", options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().SetTimeField("ts").SetMetaField("meta").SetGranularity("minutes"),
+	))
+	assert.NoError(t, err)
+
+	err = db.CreateCollection(nil, "bar", options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().SetTimeField("time"),
+	))
+	assert.Error(t, err)
+
+	csr, err := db.ListCollections(nil, bson.M{"name": "bar"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{
+			"name": "bar",
+			"type": "timeseries",
+			"options": bson.M{
+				"timeseries": bson.M{
+					"timeField":            "ts",
+					"metaField":            "meta",
+					"granularity":          "minutes",
+					"bucketMaxSpanSeconds": int32(86400),
+				},
+			},
+			"info": bson.M{
+				"readOnly": false,
+			},
+		},
+	}, readAll(csr))
+
+	coll := db.Collection("bar")
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		_, err = coll.InsertOne(nil, bson.M{
+			"ts":   base.Add(time.Duration(i) * 24 * time.Hour),
+			"meta": "a",
+			"v":    i,
+		})
+		assert.NoError(t, err)
+	}
+
+	_, err = coll.InsertOne(nil, bson.M{"v": 3})
+	assert.Error(t, err)
+
+	_, err = coll.UpdateMany(nil, bson.M{}, bson.M{"$set": bson.M{"v": 4}})
+	assert.Error(t, err)
+
+	n, err := coll.CountDocuments(nil, bson.M{
+		"ts": bson.M{"$gte": base.Add(24 * time.Hour), "$lt": base.Add(48 * time.Hour)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	catalog, err := BuildFile(engine.Catalog()).BuildCatalog()
+	assert.NoError(t, err)
+	namespace := catalog.Namespaces[Handle{"foo", "bar"}]
+	assert.Equal(t, 3, namespace.Buckets.Len())
+	assert.Equal(t, "minutes", namespace.Buckets.Config().Granularity)
+}
+
+func TestDatabaseCreatePreImages(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	db := client.Database("foo")
+	err = db.CreateCollection(nil, "bar", options.CreateCollection().SetChangeStreamPreAndPostImages(bson.M{
+		"enabled": true,
+	}))
+	assert.NoError(t, err)
+
+	err = db.CreateCollection(nil, "baz")
+	assert.NoError(t, err)
+
+	assert.True(t, engine.Catalog().Namespaces[Handle{"foo", "bar"}].PreImages)
+	assert.False(t, engine.Catalog().Namespaces[Handle{"foo", "baz"}].PreImages)
+
+	catalog, err := BuildFile(engine.Catalog()).BuildCatalog()
+	assert.NoError(t, err)
+	assert.True(t, catalog.Namespaces[Handle{"foo", "bar"}].PreImages)
+	assert.False(t, catalog.Namespaces[Handle{"foo", "baz"}].PreImages)
+
+	err = engine.Compact()
+	assert.NoError(t, err)
+	assert.True(t, engine.Catalog().Namespaces[Handle{"foo", "bar"}].PreImages)
+}
+
 func TestDatabaseDrop(t *testing.T) {
 	collectionTest(t, func(t *testing.T, c ICollection) {
 		_, err := c.InsertOne(nil, bson.M{
@@ -107,3 +218,295 @@ func TestDatabaseWriteConcern(t *testing.T) {
 		assert.Nil(t, d.WriteConcern())
 	})
 }
+
+func TestDatabaseRunCommandKillCursors(t *testing.T) {
+	databaseTest(t, func(t *testing.T, d IDatabase) {
+		coll := d.Collection("foo")
+		_, err := coll.InsertMany(nil, bson.A{
+			bson.M{"_id": int32(1)},
+			bson.M{"_id": int32(2)},
+			bson.M{"_id": int32(3)},
+		})
+		assert.NoError(t, err)
+
+		csr, err := coll.Find(nil, bson.M{}, options.Find().SetBatchSize(1))
+		assert.NoError(t, err)
+		id := csr.ID()
+		assert.NotZero(t, id)
+
+		var res struct {
+			Killed   []int64 `bson:"cursorsKilled"`
+			NotFound []int64 `bson:"cursorsNotFound"`
+			OK       float64 `bson:"ok"`
+		}
+		err = d.RunCommand(nil, bson.D{
+			{Key: "killCursors", Value: "foo"},
+			{Key: "cursors", Value: bson.A{id, int64(42)}},
+		}).Decode(&res)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{id}, res.Killed)
+		assert.Equal(t, []int64{42}, res.NotFound)
+		assert.Equal(t, 1.0, res.OK)
+
+		err = d.RunCommand(nil, bson.D{
+			{Key: "fooBar", Value: 1},
+		}).Err()
+		assert.Error(t, err)
+
+		if _, ok := d.(*Database); ok {
+			assert.False(t, csr.Next(nil))
+			assert.Equal(t, ErrCursorNotFound, csr.Err())
+		}
+	})
+}
+
+func TestDatabaseRunCommandRenameCollection(t *testing.T) {
+	databaseTest(t, func(t *testing.T, d IDatabase) {
+		from := collectionName()
+		to := collectionName()
+		admin := d.Client().Database("admin")
+
+		_, err := d.Collection(from).InsertOne(nil, bson.M{"_id": "a"})
+		assert.NoError(t, err)
+		_, err = d.Collection(to).InsertOne(nil, bson.M{"_id": "b"})
+		assert.NoError(t, err)
+
+		cmd := bson.D{
+			{Key: "renameCollection", Value: d.Name() + "." + from},
+			{Key: "to", Value: d.Name() + "." + to},
+		}
+
+		// target exists
+		err = admin.RunCommand(nil, cmd).Err()
+		assert.Error(t, err)
+
+		// non admin database
+		err = d.RunCommand(nil, append(cmd, bson.E{Key: "dropTarget", Value: true})).Err()
+		assert.Error(t, err)
+
+		// drop target
+		err = admin.RunCommand(nil, append(cmd, bson.E{Key: "dropTarget", Value: true})).Err()
+		assert.NoError(t, err)
+
+		assert.Equal(t, []bson.M{
+			{"_id": "a"},
+		}, dumpCollection(d.Collection(to), false))
+		assert.Empty(t, dumpCollection(d.Collection(from), false))
+
+		// missing source
+		err = admin.RunCommand(nil, cmd).Err()
+		assert.Error(t, err)
+	})
+}
+
+func TestDatabaseRunCommandValidate(t *testing.T) {
+	databaseTest(t, func(t *testing.T, d IDatabase) {
+		name := collectionName()
+		coll := d.Collection(name)
+		_, err := coll.InsertMany(nil, bson.A{
+			bson.M{"_id": int32(1), "n": 1},
+			bson.M{"_id": int32(2)},
+		})
+		assert.NoError(t, err)
+
+		_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys:    bson.M{"n": 1},
+			Options: options.Index().SetName("n").SetSparse(true),
+		})
+		assert.NoError(t, err)
+
+		var res struct {
+			NS           string           `bson:"ns"`
+			Records      int64            `bson:"nrecords"`
+			Indexes      int64            `bson:"nIndexes"`
+			KeysPerIndex map[string]int64 `bson:"keysPerIndex"`
+			Valid        bool             `bson:"valid"`
+			Errors       []string         `bson:"errors"`
+			OK           float64          `bson:"ok"`
+		}
+		err = d.RunCommand(nil, bson.D{
+			{Key: "validate", Value: name},
+			{Key: "full", Value: true},
+		}).Decode(&res)
+		assert.NoError(t, err)
+		assert.Equal(t, d.Name()+"."+name, res.NS)
+		assert.Equal(t, int64(2), res.Records)
+		assert.Equal(t, int64(2), res.Indexes)
+		assert.Equal(t, map[string]int64{"_id_": 2, "n": 1}, res.KeysPerIndex)
+		assert.True(t, res.Valid)
+		assert.Empty(t, res.Errors)
+		assert.Equal(t, 1.0, res.OK)
+
+		err = d.RunCommand(nil, bson.D{
+			{Key: "validate", Value: collectionName()},
+		}).Err()
+		var ce mongo.CommandError
+		assert.True(t, errors.As(err, &ce))
+		assert.Equal(t, int32(26), ce.Code)
+	})
+}
+
+func TestDatabaseAggregate(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	db := client.Database("foo")
+
+	// documents
+	csr, err := db.Aggregate(nil, bson.A{
+		bson.M{"$documents": bson.A{
+			bson.M{"n": 2},
+			bson.M{"n": 1},
+			bson.M{"n": 3},
+		}},
+		bson.M{"$match": bson.M{"n": bson.M{"$gt": 1}}},
+		bson.M{"$sort": bson.M{"n": 1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"n": int32(2)},
+		{"n": int32(3)},
+	}, readAll(csr))
+
+	// missing stage
+	_, err = db.Aggregate(nil, bson.A{})
+	assert.Error(t, err)
+
+	// collection stage
+	_, err = db.Aggregate(nil, bson.A{
+		bson.M{"$match": bson.M{}},
+	})
+	assert.Error(t, err)
+
+	// admin stages
+	_, err = db.Aggregate(nil, bson.A{
+		bson.M{"$currentOp": bson.M{}},
+	})
+	assert.Error(t, err)
+	_, err = db.Aggregate(nil, bson.A{
+		bson.M{"$listLocalSessions": bson.M{}},
+	})
+	assert.Error(t, err)
+}
+
+func TestDatabaseAggregateCurrentOp(t *testing.T) {
+	var ops []OperationInfo
+	var engine *Engine
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+		Monitor: func(event CommandEvent) {
+			if event.Command == "find" {
+				ops = engine.CurrentOps()
+			}
+		},
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertMany(nil, []interface{}{
+		bson.M{"n": 1},
+		bson.M{"n": 2},
+	})
+	assert.NoError(t, err)
+
+	// in-flight operation
+	csr, err := coll.Find(nil, bson.M{}, options.Find().SetComment("hello"))
+	assert.NoError(t, err)
+	assert.Len(t, ops, 1)
+	assert.Equal(t, "find", ops[0].Command)
+	assert.Equal(t, "foo.bar", ops[0].Namespace)
+	assert.Equal(t, "hello", ops[0].Comment)
+	assert.NotNil(t, ops[0].SessionID)
+	assert.Empty(t, engine.CurrentOps())
+
+	// current operation
+	admin := client.Database("admin")
+	res, err := admin.Aggregate(nil, bson.A{
+		bson.M{"$currentOp": bson.M{"allUsers": true}},
+		bson.M{"$project": bson.M{"_id": 0, "type": 1, "op": 1, "ns": 1, "command": 1}},
+	}, options.Aggregate().SetComment("ops"))
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{
+			"type": "op",
+			"op":   "command",
+			"ns":   "admin.$cmd.aggregate",
+			"command": bson.M{
+				"aggregate": int32(1),
+				"comment":   "ops",
+			},
+		},
+	}, readAll(res))
+
+	// idle cursors
+	res, err = admin.Aggregate(nil, bson.A{
+		bson.M{"$currentOp": bson.M{"idleCursors": true}},
+		bson.M{"$match": bson.M{"type": "idleCursor"}},
+		bson.M{"$project": bson.M{"_id": 0, "ns": 1, "cursor.cursorId": 1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{
+			"ns": "foo.bar",
+			"cursor": bson.M{
+				"cursorId": csr.ID(),
+			},
+		},
+	}, readAll(res))
+
+	// invalid option
+	_, err = admin.Aggregate(nil, bson.A{
+		bson.M{"$currentOp": bson.M{"foo": true}},
+	})
+	assert.Error(t, err)
+}
+
+func TestDatabaseAggregateListSessions(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	assert.Empty(t, engine.ListSessions())
+
+	sess, err := client.StartSession()
+	assert.NoError(t, err)
+
+	list := engine.ListSessions()
+	assert.Len(t, list, 1)
+	assert.Equal(t, sess.ID(), list[0].ID)
+	assert.True(t, list[0].Active)
+	assert.False(t, list[0].LastUse.IsZero())
+
+	var id bson.M
+	err = bson.Unmarshal(sess.ID(), &id)
+	assert.NoError(t, err)
+
+	admin := client.Database("admin")
+	for _, stage := range []string{"$listLocalSessions", "$listSessions"} {
+		csr, err := admin.Aggregate(nil, bson.A{
+			bson.M{stage: bson.M{"allUsers": true}},
+			bson.M{"$project": bson.M{"lastUse": 0}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": id},
+		}, readAll(csr))
+	}
+
+	sess.EndSession(nil)
+
+	list = engine.ListSessions()
+	assert.Len(t, list, 1)
+	assert.False(t, list[0].Active)
+
+	_, err = admin.Aggregate(nil, bson.A{
+		bson.M{"$listSessions": bson.M{"foo": true}},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,285 @@
+package lungo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// DB provides a typed API for applications that embed lungo directly and do
+// not need the mongo compatible driver interface. Documents are read and
+// written as Go values without going through the driver option handling and
+// result types.
+type DB struct {
+	engine *Engine
+}
+
+// NewDB will create and return a new DB for the specified engine.
+func NewDB(engine *Engine) *DB {
+	return &DB{
+		engine: engine,
+	}
+}
+
+// Engine will return the engine used by the DB.
+func (d *DB) Engine() *Engine {
+	return d.engine
+}
+
+// FindOptions configures a typed find operation.
+type FindOptions struct {
+	// The sort document.
+	Sort interface{}
+
+	// The number of documents to skip.
+	Skip int
+
+	// The maximum number of documents to return.
+	Limit int
+}
+
+// TypedCollection provides typed access to the documents of a namespace. Like
+// the mongo compatible collection, it uses the registry and field encryption
+// configured for the engine and supports sessions passed in the context.
+//
+// The typed collection avoids the driver operation, option and cursor handling.
+// If the engine uses the default registry, documents, filters, sorts and
+// updates are encoded and decoded directly using bsonkit.TransformDirect and
+// bsonkit.DecodeDirect. Values with custom codecs and custom registries are
+// handled by the registry to ensure they behave as with the driver.
+type TypedCollection[T any] struct {
+	coll *Collection
+}
+
+// Typed will return a typed collection for the specified database and
+// collection.
+func Typed[T any](db *DB, database, collection string) *TypedCollection[T] {
+	return &TypedCollection[T]{
+		coll: &Collection{
+			engine:   db.engine,
+			handle:   Handle{database, collection},
+			registry: db.engine.opts.Registry,
+		},
+	}
+}
+
+// Insert will insert the specified documents and return their ids.
+func (c *TypedCollection[T]) Insert(ctx context.Context, docs ...T) ([]interface{}, error) {
+	// transform documents
+	list := make(bsonkit.List, 0, len(docs))
+	for _, doc := range docs {
+		// transform document
+		d, err := bsonkit.TransformDirect(c.coll.registry, doc)
+		if err != nil {
+			return nil, err
+		}
+
+		// encrypt document
+		err = c.coll.encrypt(d)
+		if err != nil {
+			return nil, err
+		}
+
+		// add document
+		list = append(list, d)
+	}
+
+	// insert documents
+	res, err := useTransaction(ctx, c.coll.engine, true, func(txn *Transaction) (interface{}, error) {
+		return txn.Insert(c.coll.handle, list, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// get result
+	result := res.(*Result)
+
+	return bsonkit.Pick(result.Modified, "_id", false), result.Error
+}
+
+// Find will return all documents that match the filter.
+func (c *TypedCollection[T]) Find(ctx context.Context, filter interface{}, opts ...FindOptions) ([]T, error) {
+	// transform filter
+	query, err := c.transform(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// merge options
+	var opt FindOptions
+	for _, o := range opts {
+		if o.Sort != nil {
+			opt.Sort = o.Sort
+		}
+		if o.Skip != 0 {
+			opt.Skip = o.Skip
+		}
+		if o.Limit != 0 {
+			opt.Limit = o.Limit
+		}
+	}
+
+	// transform sort
+	var sort bsonkit.Doc
+	if opt.Sort != nil {
+		sort, err = c.transform(opt.Sort)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// find documents
+	res, err := useTransaction(ctx, c.coll.engine, false, func(txn *Transaction) (interface{}, error) {
+		return txn.Find(c.coll.handle, query, sort, opt.Skip, opt.Limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// decrypt documents
+	list, err := c.coll.decryptList(res.(*Result).Matched)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode documents
+	out := make([]T, len(list))
+	for i, doc := range list {
+		err = bsonkit.DecodeDirect(c.coll.registry, doc, &out[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// FindOne will return the first document that matches the filter. It returns
+// ErrNoDocuments if no document has been found.
+func (c *TypedCollection[T]) FindOne(ctx context.Context, filter interface{}) (T, error) {
+	// find document
+	var doc T
+	list, err := c.Find(ctx, filter, FindOptions{Limit: 1})
+	if err != nil {
+		return doc, err
+	} else if len(list) == 0 {
+		return doc, ErrNoDocuments
+	}
+
+	return list[0], nil
+}
+
+// Update will apply the update document to all documents that match the
+// filter and return the number of modified documents.
+func (c *TypedCollection[T]) Update(ctx context.Context, filter, update interface{}) (int, error) {
+	// transform filter
+	query, err := c.transform(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// transform update
+	doc, err := c.transform(update)
+	if err != nil {
+		return 0, err
+	}
+
+	// check encrypted fields
+	err = c.coll.checkEncryptedUpdate(doc)
+	if err != nil {
+		return 0, err
+	}
+
+	// update documents
+	res, err := useTransaction(ctx, c.coll.engine, true, func(txn *Transaction) (interface{}, error) {
+		return txn.Update(c.coll.handle, query, nil, doc, 0, 0, false, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(res.(*Result).Modified), nil
+}
+
+// Replace will replace the first document that matches the filter and return
+// whether a document has been replaced.
+func (c *TypedCollection[T]) Replace(ctx context.Context, filter interface{}, doc T) (bool, error) {
+	// transform filter
+	query, err := c.transform(filter)
+	if err != nil {
+		return false, err
+	}
+
+	// transform document
+	repl, err := bsonkit.TransformDirect(c.coll.registry, doc)
+	if err != nil {
+		return false, err
+	}
+
+	// encrypt document
+	err = c.coll.encrypt(repl)
+	if err != nil {
+		return false, err
+	}
+
+	// replace document
+	res, err := useTransaction(ctx, c.coll.engine, true, func(txn *Transaction) (interface{}, error) {
+		return txn.Replace(c.coll.handle, query, nil, repl, false)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return len(res.(*Result).Modified) > 0, nil
+}
+
+// Delete will delete all documents that match the filter and return the
+// number of deleted documents.
+func (c *TypedCollection[T]) Delete(ctx context.Context, filter interface{}) (int, error) {
+	// transform filter
+	query, err := c.transform(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// delete documents
+	res, err := useTransaction(ctx, c.coll.engine, true, func(txn *Transaction) (interface{}, error) {
+		return txn.Delete(c.coll.handle, query, nil, 0, 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(res.(*Result).Matched), nil
+}
+
+// Count will return the number of documents that match the filter.
+func (c *TypedCollection[T]) Count(ctx context.Context, filter interface{}) (int, error) {
+	// transform filter
+	query, err := c.transform(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// find documents
+	res, err := useTransaction(ctx, c.coll.engine, false, func(txn *Transaction) (interface{}, error) {
+		return txn.Find(c.coll.handle, query, nil, 0, 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(res.(*Result).Matched), nil
+}
+
+func (c *TypedCollection[T]) transform(filter interface{}) (bsonkit.Doc, error) {
+	// use empty filter if missing
+	if filter == nil {
+		return &bson.D{}, nil
+	}
+
+	return bsonkit.TransformDirect(c.coll.registry, filter)
+}
@@ -0,0 +1,150 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type typedPerson struct {
+	ID   int    `bson:"_id"`
+	Name string `bson:"name"`
+	Age  int    `bson:"age"`
+}
+
+func TestTypedCollection(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	db := NewDB(engine)
+	assert.Equal(t, engine, db.Engine())
+
+	people := Typed[typedPerson](db, "foo", "people")
+
+	ids, err := people.Insert(nil, typedPerson{
+		ID:   1,
+		Name: "Alice",
+		Age:  32,
+	}, typedPerson{
+		ID:   2,
+		Name: "Bob",
+		Age:  27,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1), int32(2)}, ids)
+
+	list, err := people.Find(nil, nil, FindOptions{
+		Sort: bson.M{"age": 1},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []typedPerson{
+		{ID: 2, Name: "Bob", Age: 27},
+		{ID: 1, Name: "Alice", Age: 32},
+	}, list)
+
+	person, err := people.FindOne(nil, bson.M{"name": "Alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, typedPerson{ID: 1, Name: "Alice", Age: 32}, person)
+
+	_, err = people.FindOne(nil, bson.M{"name": "Carol"})
+	assert.Equal(t, ErrNoDocuments, err)
+
+	n, err := people.Update(nil, bson.M{}, bson.M{"$inc": bson.M{"age": 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	ok, err := people.Replace(nil, bson.M{"_id": 2}, typedPerson{ID: 2, Name: "Robert", Age: 28})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	n, err = people.Count(nil, bson.M{"age": bson.M{"$gt": 30}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "name": "Alice", "age": int32(33)},
+		{"_id": int32(2), "name": "Robert", "age": int32(28)},
+	}, dumpCollection(client.Database("foo").Collection("people"), false))
+
+	n, err = people.Delete(nil, bson.M{"_id": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = people.Count(nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestTypedCollectionFilter(t *testing.T) {
+	_, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	people := Typed[typedPerson](NewDB(engine), "foo", "people")
+
+	_, err = people.Insert(nil, typedPerson{ID: 1, Name: "Alice", Age: 32}, typedPerson{ID: 2, Name: "Bob", Age: 27})
+	assert.NoError(t, err)
+
+	type ageFilter struct {
+		Age int `bson:"age"`
+	}
+
+	for _, filter := range []interface{}{
+		bson.M{"age": 27},
+		bson.D{{Key: "age", Value: int64(27)}},
+		map[string]interface{}{"age": bson.M{"$lt": 30.0}},
+		bson.M{"age": bson.M{"$in": []int{27}}},
+		ageFilter{Age: 27},
+	} {
+		person, err := people.FindOne(nil, filter)
+		assert.NoError(t, err)
+		assert.Equal(t, "Bob", person.Name)
+	}
+
+	list, err := people.Find(nil, bson.M{}, FindOptions{
+		Sort: bson.D{{Key: "age", Value: -1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []typedPerson{
+		{ID: 1, Name: "Alice", Age: 32},
+		{ID: 2, Name: "Bob", Age: 27},
+	}, list)
+}
+
+func TestTypedCollectionRegistry(t *testing.T) {
+	_, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	type document struct {
+		ID   int    `bson:"_id"`
+		Data bson.M `bson:"data"`
+	}
+
+	docs := Typed[document](NewDB(engine), "foo", "docs")
+
+	_, err = docs.Insert(nil, document{ID: 1, Data: bson.M{"foo": "bar"}})
+	assert.NoError(t, err)
+
+	list, err := docs.Find(nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []document{
+		{ID: 1, Data: bson.M{"foo": "bar"}},
+	}, list)
+
+	maps := Typed[bson.M](NewDB(engine), "foo", "docs")
+
+	list2, err := maps.Find(nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "data": bson.M{"foo": "bar"}},
+	}, list2)
+}
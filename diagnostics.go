@@ -0,0 +1,251 @@
+package lungo
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Latency summarizes the recorded durations of an operation. The percentiles
+// are approximated using a histogram with power of two buckets and are
+// therefore accurate to a factor of two.
+type Latency struct {
+	// The number of recorded durations.
+	Count int64
+
+	// The sum of all recorded durations.
+	Total time.Duration
+
+	// The smallest and largest recorded duration.
+	Min time.Duration
+	Max time.Duration
+
+	// The approximated percentiles.
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+}
+
+// Mean returns the mean of the recorded durations.
+func (l Latency) Mean() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
+// Diagnostics contains statistics collected by the engine.
+type Diagnostics struct {
+	// The latency of collection operations per command name, e.g. "find",
+	// "insert" or "aggregate". The latency includes the time spent waiting
+	// for the write lock.
+	Operations map[string]Latency
+
+	// The time spent by write transactions waiting for the write lock.
+	LockWait Latency
+
+	// The latency of collection operations per namespace.
+	Namespaces map[Handle]NamespaceDiagnostics
+}
+
+// NamespaceDiagnostics contains the statistics collected for a namespace.
+// Like the latency statistics of MongoDB, the "find", "aggregate", "count" and
+// "distinct" commands are counted as reads and the "insert", "update",
+// "delete", "findAndModify" and "bulkWrite" commands as writes.
+type NamespaceDiagnostics struct {
+	// The latency of read operations.
+	Reads Latency
+
+	// The latency of write operations.
+	Writes Latency
+
+	// The latency of other operations.
+	Commands Latency
+}
+
+type histogram struct {
+	count   int64
+	total   time.Duration
+	min     time.Duration
+	max     time.Duration
+	buckets [65]int64
+}
+
+func (h *histogram) record(duration time.Duration) {
+	// clamp duration
+	if duration < 0 {
+		duration = 0
+	}
+
+	// update summary
+	if h.count == 0 || duration < h.min {
+		h.min = duration
+	}
+	if duration > h.max {
+		h.max = duration
+	}
+	h.count++
+	h.total += duration
+
+	// update bucket, bucket i holds durations below 2^i nanoseconds
+	h.buckets[bits.Len64(uint64(duration))]++
+}
+
+func (h *histogram) percentile(p float64) time.Duration {
+	// check count
+	if h.count == 0 {
+		return 0
+	}
+
+	// find bucket that contains the percentile
+	rank := int64(p * float64(h.count))
+	if rank < 1 {
+		rank = 1
+	}
+	var sum int64
+	for i, num := range h.buckets {
+		sum += num
+		if sum >= rank {
+			// use upper bound of bucket limited by the recorded range
+			bound := time.Duration(uint64(1)<<uint(i) - 1)
+			if i == 64 || bound > h.max {
+				bound = h.max
+			}
+			if bound < h.min {
+				bound = h.min
+			}
+			return bound
+		}
+	}
+
+	return h.max
+}
+
+func (h *histogram) latency() Latency {
+	return Latency{
+		Count: h.count,
+		Total: h.total,
+		Min:   h.min,
+		Max:   h.max,
+		P50:   h.percentile(0.5),
+		P90:   h.percentile(0.9),
+		P99:   h.percentile(0.99),
+	}
+}
+
+type namespaceHistograms struct {
+	reads    histogram
+	writes   histogram
+	commands histogram
+}
+
+type diagnostics struct {
+	operations map[string]*histogram
+	namespaces map[Handle]*namespaceHistograms
+	lockWait   histogram
+	mutex      sync.Mutex
+}
+
+func (d *diagnostics) recordOperation(handle Handle, command string, duration time.Duration) {
+	// acquire lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// get histogram
+	hist := d.operations[command]
+	if hist == nil {
+		if d.operations == nil {
+			d.operations = map[string]*histogram{}
+		}
+		hist = &histogram{}
+		d.operations[command] = hist
+	}
+
+	// record duration
+	hist.record(duration)
+
+	// get namespace histograms
+	hists := d.namespaces[handle]
+	if hists == nil {
+		if d.namespaces == nil {
+			d.namespaces = map[Handle]*namespaceHistograms{}
+		}
+		hists = &namespaceHistograms{}
+		d.namespaces[handle] = hists
+	}
+
+	// record namespace duration
+	switch command {
+	case "find", "aggregate", "count", "distinct":
+		hists.reads.record(duration)
+	case "insert", "update", "delete", "findAndModify", "bulkWrite":
+		hists.writes.record(duration)
+	default:
+		hists.commands.record(duration)
+	}
+}
+
+func (d *diagnostics) namespace(handle Handle) namespaceHistograms {
+	// acquire lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// copy histograms
+	var hists namespaceHistograms
+	if d.namespaces[handle] != nil {
+		hists = *d.namespaces[handle]
+	}
+
+	return hists
+}
+
+func (d *diagnostics) recordLockWait(duration time.Duration) {
+	// acquire lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// record duration
+	d.lockWait.record(duration)
+}
+
+// Diagnostics will return the statistics collected since the engine has been
+// created or the statistics have been reset.
+func (e *Engine) Diagnostics() Diagnostics {
+	// acquire lock
+	e.diagnostics.mutex.Lock()
+	defer e.diagnostics.mutex.Unlock()
+
+	// collect operations
+	operations := make(map[string]Latency, len(e.diagnostics.operations))
+	for command, hist := range e.diagnostics.operations {
+		operations[command] = hist.latency()
+	}
+
+	// collect namespaces
+	namespaces := make(map[Handle]NamespaceDiagnostics, len(e.diagnostics.namespaces))
+	for handle, hists := range e.diagnostics.namespaces {
+		namespaces[handle] = NamespaceDiagnostics{
+			Reads:    hists.reads.latency(),
+			Writes:   hists.writes.latency(),
+			Commands: hists.commands.latency(),
+		}
+	}
+
+	return Diagnostics{
+		Operations: operations,
+		LockWait:   e.diagnostics.lockWait.latency(),
+		Namespaces: namespaces,
+	}
+}
+
+// ResetDiagnostics will reset the collected statistics.
+func (e *Engine) ResetDiagnostics() {
+	// acquire lock
+	e.diagnostics.mutex.Lock()
+	defer e.diagnostics.mutex.Unlock()
+
+	// reset statistics
+	e.diagnostics.operations = nil
+	e.diagnostics.namespaces = nil
+	e.diagnostics.lockWait = histogram{}
+}
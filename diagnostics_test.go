@@ -0,0 +1,64 @@
+package lungo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestHistogram(t *testing.T) {
+	var hist histogram
+	assert.Equal(t, Latency{}, hist.latency())
+
+	for i := 1; i <= 100; i++ {
+		hist.record(time.Duration(i) * time.Millisecond)
+	}
+
+	latency := hist.latency()
+	assert.Equal(t, int64(100), latency.Count)
+	assert.Equal(t, 5050*time.Millisecond, latency.Total)
+	assert.Equal(t, 50500*time.Microsecond, latency.Mean())
+	assert.Equal(t, time.Millisecond, latency.Min)
+	assert.Equal(t, 100*time.Millisecond, latency.Max)
+	assert.True(t, latency.P50 >= 50*time.Millisecond && latency.P50 <= 100*time.Millisecond)
+	assert.True(t, latency.P90 >= 90*time.Millisecond && latency.P90 <= 100*time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, latency.P99)
+}
+
+func TestEngineDiagnostics(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	for i := 0; i < 3; i++ {
+		_, err = coll.InsertOne(nil, bson.M{"i": i})
+		assert.NoError(t, err)
+	}
+
+	_, err = coll.Find(nil, bson.M{})
+	assert.NoError(t, err)
+
+	diag := engine.Diagnostics()
+	assert.Len(t, diag.Operations, 2)
+	assert.Equal(t, int64(3), diag.Operations["insert"].Count)
+	assert.Equal(t, int64(1), diag.Operations["find"].Count)
+	assert.True(t, diag.Operations["insert"].Max >= diag.Operations["insert"].P50)
+	assert.True(t, diag.LockWait.Count >= 3)
+	assert.Len(t, diag.Namespaces, 1)
+	assert.Equal(t, int64(1), diag.Namespaces[Handle{"foo", "bar"}].Reads.Count)
+	assert.Equal(t, int64(3), diag.Namespaces[Handle{"foo", "bar"}].Writes.Count)
+	assert.Equal(t, int64(0), diag.Namespaces[Handle{"foo", "bar"}].Commands.Count)
+
+	engine.ResetDiagnostics()
+
+	diag = engine.Diagnostics()
+	assert.Empty(t, diag.Operations)
+	assert.Empty(t, diag.Namespaces)
+	assert.Equal(t, Latency{}, diag.LockWait)
+}
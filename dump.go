@@ -0,0 +1,355 @@
+package lungo
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
+)
+
+// DumpMetadata is the metadata stored alongside each collection in a dump.
+type DumpMetadata struct {
+	Indexes        []bson.D `bson:"indexes"`
+	UUID           string   `bson:"uuid,omitempty"`
+	CollectionName string   `bson:"collectionName"`
+	Type           string   `bson:"type"`
+}
+
+// Dump will write all namespaces of the engine to the specified directory
+// using the layout produced by mongodump. Every collection is stored in a
+// "<db>/<coll>.bson" file containing the concatenated documents and a
+// "<db>/<coll>.metadata.json" file that describes the indexes. The dump is
+// taken from a consistent snapshot of the catalog.
+func Dump(ctx context.Context, engine *Engine, dir string) error {
+	// get snapshot
+	txn, err := engine.Begin(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	// load namespaces
+	handles := make([]Handle, 0, len(txn.Catalog().Namespaces))
+	for handle := range txn.Catalog().Namespaces {
+		handles = append(handles, handle)
+	}
+	err = txn.Load(handles...)
+	if err != nil {
+		return err
+	}
+
+	// get catalog
+	catalog := txn.Catalog()
+
+	// dump namespaces
+	for handle, namespace := range catalog.Namespaces {
+		// skip local namespaces
+		if handle[0] == Local {
+			continue
+		}
+
+		// ensure database directory
+		dbDir := filepath.Join(dir, handle[0])
+		err = os.MkdirAll(dbDir, 0777)
+		if err != nil {
+			return err
+		}
+
+		// write documents
+		err = writeDumpDocuments(filepath.Join(dbDir, handle[1]+".bson"), namespace.Documents.List)
+		if err != nil {
+			return err
+		}
+
+		// write metadata
+		err = writeDumpMetadata(filepath.Join(dbDir, handle[1]+".metadata.json"), handle, namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Restore will read a directory in the layout produced by mongodump and insert
+// the documents and indexes into the engine using a single transaction. If drop
+// is true, existing namespaces are dropped before being restored.
+func Restore(ctx context.Context, engine *Engine, dir string, drop bool) error {
+	// read databases
+	databases, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// begin transaction
+	txn, err := engine.Begin(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	// ensure abortion
+	defer engine.Abort(txn)
+
+	// restore databases
+	for _, database := range databases {
+		// skip files
+		if !database.IsDir() {
+			continue
+		}
+
+		// restore database
+		err = restoreDatabase(txn, filepath.Join(dir, database.Name()), database.Name(), drop)
+		if err != nil {
+			return err
+		}
+	}
+
+	// commit transaction
+	err = engine.Commit(txn)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func restoreDatabase(txn *Transaction, dir, name string, drop bool) error {
+	// read files
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// collect collections
+	collections := map[string]bool{}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".metadata.json") {
+			collections[strings.TrimSuffix(file.Name(), ".metadata.json")] = true
+		} else if strings.HasSuffix(file.Name(), ".bson") {
+			collections[strings.TrimSuffix(file.Name(), ".bson")] = true
+		}
+	}
+
+	// sort collections
+	names := make([]string, 0, len(collections))
+	for coll := range collections {
+		names = append(names, coll)
+	}
+	sort.Strings(names)
+
+	// restore collections
+	for _, coll := range names {
+		// skip system collections
+		if strings.HasPrefix(coll, "system.") {
+			continue
+		}
+
+		// prepare handle
+		handle := Handle{name, coll}
+
+		// drop existing namespace
+		if drop {
+			err = txn.Drop(handle)
+			if err != nil {
+				return err
+			}
+		}
+
+		// ensure namespace
+		err = txn.Create(handle)
+		if err != nil {
+			return err
+		}
+
+		// read documents
+		list, err := readDumpDocuments(filepath.Join(dir, coll+".bson"))
+		if err != nil {
+			return err
+		}
+
+		// insert documents
+		if len(list) > 0 {
+			res, err := txn.Insert(handle, list, true)
+			if err != nil {
+				return err
+			} else if res.Error != nil {
+				return res.Error
+			}
+		}
+
+		// read metadata
+		meta, err := readDumpMetadata(filepath.Join(dir, coll+".metadata.json"))
+		if err != nil {
+			return err
+		}
+
+		// create indexes
+		for _, spec := range meta.Indexes {
+			// parse spec
+			name, config, err := parseIndexSpec(&spec)
+			if err != nil {
+				return err
+			}
+
+			// skip default index
+			if name == "_id_" {
+				continue
+			}
+
+			// create index
+			_, err = txn.CreateIndex(handle, name, config)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeDumpDocuments(path string, list bsonkit.List) error {
+	// create file
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// ensure close
+	defer file.Close()
+
+	// prepare writer
+	writer := bufio.NewWriter(file)
+
+	// write documents
+	for _, doc := range list {
+		// encode document
+		buf, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+
+		// write document
+		_, err = writer.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	// flush writer
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func readDumpDocuments(path string) (bsonkit.List, error) {
+	// open file
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// ensure close
+	defer file.Close()
+
+	// prepare reader
+	reader := bufio.NewReader(file)
+
+	// read documents
+	var list bsonkit.List
+	for {
+		// read length
+		var header [4]byte
+		_, err = io.ReadFull(reader, header[:])
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		// check length
+		length := int(binary.LittleEndian.Uint32(header[:]))
+		if length < 5 {
+			return nil, fmt.Errorf("invalid document length %d in %q", length, path)
+		}
+
+		// read document
+		buf := make([]byte, length)
+		copy(buf, header[:])
+		_, err = io.ReadFull(reader, buf[4:])
+		if err != nil {
+			return nil, err
+		}
+
+		// decode document
+		var doc bson.D
+		err = bson.Unmarshal(buf, &doc)
+		if err != nil {
+			return nil, err
+		}
+
+		// add document
+		list = append(list, &doc)
+	}
+
+	return list, nil
+}
+
+func writeDumpMetadata(path string, handle Handle, namespace *mongokit.Collection) error {
+	// prepare metadata
+	meta := DumpMetadata{
+		Indexes:        []bson.D{},
+		CollectionName: handle[1],
+		Type:           "collection",
+	}
+
+	// collect indexes
+	for name, index := range namespace.Indexes {
+		meta.Indexes = append(meta.Indexes, *buildIndexSpec(name, index.Config()))
+	}
+
+	// sort indexes
+	sort.Slice(meta.Indexes, func(i, j int) bool {
+		return bsonkit.Get(&meta.Indexes[i], "name").(string) < bsonkit.Get(&meta.Indexes[j], "name").(string)
+	})
+
+	// encode metadata
+	buf, err := bson.MarshalExtJSON(meta, true, false)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buf, 0666)
+}
+
+func readDumpMetadata(path string) (*DumpMetadata, error) {
+	// read file
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &DumpMetadata{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// decode metadata
+	var meta DumpMetadata
+	err = bson.UnmarshalExtJSON(buf, true, &meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return &meta, nil
+}
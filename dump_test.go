@@ -0,0 +1,165 @@
+package lungo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestDumpAndRestore(t *testing.T) {
+	dir := t.TempDir()
+
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	id1 := primitive.NewObjectID()
+	id2 := primitive.NewObjectID()
+
+	_, err = coll.InsertMany(nil, []interface{}{
+		bson.M{"_id": id1, "foo": "bar", "n": int32(1)},
+		bson.M{"_id": id2, "foo": "baz", "n": int64(2)},
+	})
+	assert.NoError(t, err)
+
+	_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys:    bson.D{{Key: "foo", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("foo"),
+	})
+	assert.NoError(t, err)
+
+	_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys:    bson.D{{Key: "n", Value: -1}},
+		Options: options.Index().SetExpireAfterSeconds(60),
+	})
+	assert.NoError(t, err)
+
+	err = client.Database("foo").CreateCollection(nil, "empty")
+	assert.NoError(t, err)
+
+	err = Dump(nil, engine, dir)
+	assert.NoError(t, err)
+
+	buf, err := os.ReadFile(filepath.Join(dir, "foo", "bar.metadata.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"indexes": [
+			{ "v": { "$numberInt": "2" }, "key": { "_id": { "$numberInt": "1" } }, "name": "_id_" },
+			{ "v": { "$numberInt": "2" }, "key": { "foo": { "$numberInt": "1" } }, "name": "foo", "unique": true },
+			{ "v": { "$numberInt": "2" }, "key": { "n": { "$numberInt": "-1" } }, "name": "n_-1", "expireAfterSeconds": { "$numberInt": "60" } }
+		],
+		"collectionName": "bar",
+		"type": "collection"
+	}`, string(buf))
+
+	_, err = os.Stat(filepath.Join(dir, "foo", "empty.bson"))
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "local"))
+	assert.True(t, os.IsNotExist(err))
+
+	client2, engine2, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine2.Close()
+
+	err = Restore(nil, engine2, dir, false)
+	assert.NoError(t, err)
+
+	coll2 := client2.Database("foo").Collection("bar")
+	assert.Equal(t, []bson.M{
+		{"_id": id1, "foo": "bar", "n": int32(1)},
+		{"_id": id2, "foo": "baz", "n": int64(2)},
+	}, dumpCollection(coll2, false))
+
+	csr, err := coll2.Indexes().List(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"v": int32(2), "key": bson.M{"_id": int32(1)}, "name": "_id_"},
+		{"v": int32(2), "key": bson.M{"foo": int32(1)}, "name": "foo", "unique": true},
+		{"v": int32(2), "key": bson.M{"n": int32(-1)}, "name": "n_-1", "expireAfterSeconds": int32(60)},
+	}, readAll(csr))
+
+	names, err := client2.Database("foo").ListCollectionNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"bar", "empty"}, names)
+
+	/* restore again */
+
+	err = Restore(nil, engine2, dir, false)
+	assert.Error(t, err)
+
+	err = Restore(nil, engine2, dir, true)
+	assert.NoError(t, err)
+
+	n, err := coll2.CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestRestoreMongoDump(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(dir, "foo"), 0777)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	var buf []byte
+	for _, doc := range []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "date", Value: now}},
+		{{Key: "_id", Value: int32(2)}, {Key: "tags", Value: bson.A{"a", "b"}}},
+	} {
+		bytes, err := bson.Marshal(doc)
+		assert.NoError(t, err)
+		buf = append(buf, bytes...)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "foo", "fs.files.bson"), buf, 0666)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "foo", "fs.files.metadata.json"), []byte(`{
+		"indexes": [
+			{ "v": { "$numberInt": "2" }, "key": { "_id": { "$numberInt": "1" } }, "name": "_id_" },
+			{ "v": { "$numberInt": "2" }, "key": { "tags": { "$numberInt": "1" } }, "name": "tags_1", "partialFilterExpression": { "tags": { "$exists": true } } }
+		],
+		"uuid": "a2a2b5e1b0d94b1f8a3f6c1d2e3f4a5b",
+		"collectionName": "fs.files",
+		"type": "collection"
+	}`), 0666)
+	assert.NoError(t, err)
+
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	err = Restore(nil, engine, dir, false)
+	assert.NoError(t, err)
+
+	coll := client.Database("foo").Collection("fs.files")
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "date": primitive.NewDateTimeFromTime(now)},
+		{"_id": int32(2), "tags": bson.A{"a", "b"}},
+	}, dumpCollection(coll, false))
+
+	csr, err := coll.Indexes().List(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"v": int32(2), "key": bson.M{"_id": int32(1)}, "name": "_id_"},
+		{"v": int32(2), "key": bson.M{"tags": int32(1)}, "name": "tags_1", "partialFilterExpression": bson.M{"tags": bson.M{"$exists": true}}},
+	}, readAll(csr))
+}
@@ -0,0 +1,240 @@
+package lungo
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// EncryptedSubtype is the binary subtype used to store encrypted values. It is
+// the same subtype used by the official driver for client side field level
+// encryption.
+const EncryptedSubtype byte = 6
+
+// FieldEncryption configures a simplified client side field level encryption.
+// The values of the configured fields are encrypted before documents are
+// written and decrypted after they have been read. Queries on encrypted fields
+// are not supported and updates that modify encrypted fields are rejected.
+type FieldEncryption struct {
+	// The fields to encrypt per namespace e.g. "db.users": {"ssn", "card.number"}.
+	Fields map[string][]string
+
+	// The function called to encrypt the serialized value of a field. The
+	// plaintext is the BSON type byte followed by the BSON value.
+	Encrypt func(ns, field string, plaintext []byte) ([]byte, error)
+
+	// The function called to decrypt a previously encrypted value.
+	Decrypt func(ns, field string, ciphertext []byte) ([]byte, error)
+}
+
+func (c *Collection) encryptedFields() []string {
+	// get config
+	fe := c.engine.opts.FieldEncryption
+	if fe == nil {
+		return nil
+	}
+
+	return fe.Fields[c.handle.String()]
+}
+
+func (c *Collection) encrypt(doc bsonkit.Doc) error {
+	// get fields
+	fields := c.encryptedFields()
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// encrypt fields
+	for _, field := range fields {
+		// get value
+		value := bsonkit.Get(doc, field)
+		if value == bsonkit.Missing {
+			continue
+		}
+
+		// serialize value
+		typ, data, err := bson.MarshalValue(value)
+		if err != nil {
+			return err
+		}
+
+		// encrypt value
+		ciphertext, err := c.engine.opts.FieldEncryption.Encrypt(c.handle.String(), field, append([]byte{byte(typ)}, data...))
+		if err != nil {
+			return err
+		}
+
+		// set value
+		_, err = bsonkit.Put(doc, field, primitive.Binary{
+			Subtype: EncryptedSubtype,
+			Data:    ciphertext,
+		}, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Collection) decrypt(doc bsonkit.Doc) (bsonkit.Doc, error) {
+	// get fields
+	fields := c.encryptedFields()
+	if len(fields) == 0 || doc == nil {
+		return doc, nil
+	}
+
+	// decrypt fields
+	var clone bsonkit.Doc
+	for _, field := range fields {
+		// get value
+		bin, ok := bsonkit.Get(doc, field).(primitive.Binary)
+		if !ok || bin.Subtype != EncryptedSubtype {
+			continue
+		}
+
+		// decrypt value
+		plaintext, err := c.engine.opts.FieldEncryption.Decrypt(c.handle.String(), field, bin.Data)
+		if err != nil {
+			return nil, err
+		} else if len(plaintext) == 0 {
+			return nil, fmt.Errorf("invalid plaintext for field %q", field)
+		}
+
+		// deserialize value
+		var value interface{}
+		err = bson.RawValue{
+			Type:  bsontype.Type(plaintext[0]),
+			Value: plaintext[1:],
+		}.Unmarshal(&value)
+		if err != nil {
+			return nil, err
+		}
+
+		// convert value
+		value, err = bsonkit.ConvertValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		// clone document once
+		if clone == nil {
+			clone = bsonkit.Clone(doc)
+		}
+
+		// set value
+		_, err = bsonkit.Put(clone, field, value, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// check clone
+	if clone == nil {
+		return doc, nil
+	}
+
+	return clone, nil
+}
+
+func (c *Collection) decryptList(list bsonkit.List) (bsonkit.List, error) {
+	// check fields
+	if len(c.encryptedFields()) == 0 {
+		return list, nil
+	}
+
+	// decrypt documents
+	result := make(bsonkit.List, 0, len(list))
+	for _, doc := range list {
+		doc, err := c.decrypt(doc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, doc)
+	}
+
+	return result, nil
+}
+
+func (c *Collection) checkEncryptedUpdate(update bsonkit.Doc) error {
+	// get fields
+	fields := c.encryptedFields()
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// check operators
+	for _, op := range *update {
+		// get fields
+		doc, ok := op.Value.(bson.D)
+		if !ok {
+			continue
+		}
+
+		// check fields
+		for _, e := range doc {
+			// collect paths
+			paths := []string{e.Key}
+			if str, ok := e.Value.(string); ok && op.Key == "$rename" {
+				paths = append(paths, str)
+			}
+
+			// check paths
+			for _, path := range paths {
+				for _, field := range fields {
+					if overlapsPath(path, field) {
+						return fmt.Errorf("cannot update encrypted field %q", field)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Collection) checkEncryptedPatch(ops []bsonkit.PatchOperation) error {
+	// get fields
+	fields := c.encryptedFields()
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// check operations
+	for _, op := range ops {
+		// skip tests
+		if op.Op == "test" {
+			continue
+		}
+
+		// collect pointers
+		pointers := []string{op.Path}
+		if op.Op == "move" || op.Op == "copy" {
+			pointers = append(pointers, op.From)
+		}
+
+		// check pointers
+		for _, pointer := range pointers {
+			// convert pointer
+			path := strings.ReplaceAll(strings.TrimPrefix(pointer, "/"), "/", ".")
+
+			// check path
+			for _, field := range fields {
+				if pointer == "" || overlapsPath(path, field) {
+					return fmt.Errorf("cannot patch encrypted field %q", field)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func overlapsPath(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
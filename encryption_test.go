@@ -0,0 +1,247 @@
+package lungo
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func xorBytes(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ 0x5a
+	}
+	return out
+}
+
+func TestFieldEncryption(t *testing.T) {
+	var calls []string
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+		FieldEncryption: &FieldEncryption{
+			Fields: map[string][]string{
+				"foo.bar": {"ssn", "card.number"},
+			},
+			Encrypt: func(ns, field string, plaintext []byte) ([]byte, error) {
+				calls = append(calls, "encrypt:"+ns+":"+field)
+				return xorBytes(plaintext), nil
+			},
+			Decrypt: func(ns, field string, ciphertext []byte) ([]byte, error) {
+				calls = append(calls, "decrypt:"+ns+":"+field)
+				return xorBytes(ciphertext), nil
+			},
+		},
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	_, err = coll.InsertOne(nil, bson.M{
+		"_id":  1,
+		"name": "Alice",
+		"ssn":  "123-45-6789",
+		"card": bson.M{"number": int64(4111)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"encrypt:foo.bar:ssn",
+		"encrypt:foo.bar:card.number",
+	}, calls)
+
+	// stored values are encrypted
+	stored := engine.Catalog().Namespaces[Handle{"foo", "bar"}].Documents.List[0]
+	ssn, ok := bsonkit.Get(stored, "ssn").(primitive.Binary)
+	assert.True(t, ok)
+	assert.Equal(t, EncryptedSubtype, ssn.Subtype)
+	assert.NotContains(t, string(ssn.Data), "123-45-6789")
+
+	// read values are decrypted
+	var doc bson.M
+	err = coll.FindOne(nil, bson.M{"_id": 1}).Decode(&doc)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"_id":  int32(1),
+		"name": "Alice",
+		"ssn":  "123-45-6789",
+		"card": bson.M{"number": int64(4111)},
+	}, doc)
+
+	csr, err := coll.Find(nil, bson.M{}, options.Find().SetProjection(bson.M{"ssn": 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "ssn": "123-45-6789"},
+	}, readAll(csr))
+
+	// replacements are encrypted
+	doc = nil
+	err = coll.FindOneAndReplace(nil, bson.M{"_id": 1}, bson.M{
+		"name": "Bob",
+		"ssn":  "987-65-4321",
+	}, options.FindOneAndReplace().SetReturnDocument(options.After)).Decode(&doc)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"_id":  int32(1),
+		"name": "Bob",
+		"ssn":  "987-65-4321",
+	}, doc)
+
+	stored = engine.Catalog().Namespaces[Handle{"foo", "bar"}].Documents.List[0]
+	_, ok = bsonkit.Get(stored, "ssn").(primitive.Binary)
+	assert.True(t, ok)
+
+	// updates of encrypted fields are rejected
+	_, err = coll.UpdateOne(nil, bson.M{"_id": 1}, bson.M{
+		"$set": bson.M{"card": bson.M{"number": 1}},
+	})
+	assert.Error(t, err)
+
+	_, err = coll.UpdateOne(nil, bson.M{"_id": 1}, bson.M{
+		"$rename": bson.M{"name": "ssn"},
+	})
+	assert.Error(t, err)
+
+	_, err = coll.BulkWrite(nil, []mongo.WriteModel{
+		mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": 1}).SetUpdate(bson.M{
+			"$unset": bson.M{"ssn": ""},
+		}),
+	})
+	assert.Error(t, err)
+
+	_, err = coll.(*Collection).PatchOne(nil, bson.M{"_id": 1}, []bsonkit.PatchOperation{
+		{Op: "remove", Path: "/ssn"},
+	})
+	assert.Error(t, err)
+
+	// other updates are allowed
+	_, err = coll.UpdateOne(nil, bson.M{"_id": 1}, bson.M{
+		"$set": bson.M{"name": "Carol"},
+	})
+	assert.NoError(t, err)
+
+	// other namespaces are not encrypted
+	other := client.Database("foo").Collection("baz")
+	_, err = other.InsertOne(nil, bson.M{"_id": 1, "ssn": "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "ssn": "x"},
+	}, dumpCollection(other, false))
+}
+
+func TestFieldEncryptionPaths(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+		FieldEncryption: &FieldEncryption{
+			Fields: map[string][]string{
+				"foo.bar": {"ssn"},
+				"foo.baz": {"ssn"},
+			},
+			Encrypt: func(ns, field string, plaintext []byte) ([]byte, error) {
+				return xorBytes(plaintext), nil
+			},
+			Decrypt: func(ns, field string, ciphertext []byte) ([]byte, error) {
+				return xorBytes(ciphertext), nil
+			},
+		},
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar").(*Collection)
+
+	stored := func(handle Handle) []interface{} {
+		var list []interface{}
+		for _, doc := range engine.Catalog().Namespaces[handle].Documents.List {
+			bin, ok := bsonkit.Get(doc, "ssn").(primitive.Binary)
+			assert.True(t, ok)
+			assert.Equal(t, EncryptedSubtype, bin.Subtype)
+			list = append(list, bin)
+		}
+		return list
+	}
+
+	stream, err := coll.Watch(nil, bson.A{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	assert.NoError(t, err)
+	defer stream.Close(nil)
+
+	// ndjson
+	n, err := coll.ImportNDJSON(nil, strings.NewReader(`{"_id": 1, "ssn": "123"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, stored(Handle{"foo", "bar"}), 1)
+
+	var buf bytes.Buffer
+	n, err = coll.ExportNDJSON(nil, &buf, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, `{"_id":1,"ssn":"123"}`+"\n", buf.String())
+
+	// csv
+	n, err = coll.ImportCSV(nil, strings.NewReader("_id,ssn\n2,xyz"), CSVOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, stored(Handle{"foo", "bar"}), 2)
+
+	buf.Reset()
+	n, err = coll.ExportCSV(nil, &buf, bson.M{}, CSVOptions{Fields: []string{"_id", "ssn"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "_id,ssn\n1,123\n2,xyz\n", buf.String())
+
+	// distinct
+	values, err := coll.Distinct(nil, "ssn", bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"123", "xyz"}, values)
+
+	// refs
+	refs := client.Database("foo").Collection("baz").(*Collection)
+	_, err = refs.InsertOne(nil, bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "ssn", Value: "789"},
+		{Key: "person", Value: bson.D{
+			{Key: "$ref", Value: "bar"},
+			{Key: "$id", Value: 1},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, stored(Handle{"foo", "baz"}), 1)
+
+	var list []bson.M
+	err = refs.ResolveRefs(nil, bson.M{}, &list)
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{
+			"_id":    int32(1),
+			"ssn":    "789",
+			"person": bson.M{"_id": int32(1), "ssn": "123"},
+		},
+	}, list)
+
+	// change stream
+	_, err = coll.UpdateOne(nil, bson.M{"_id": 1}, bson.M{
+		"$set": bson.M{"name": "Alice"},
+	})
+	assert.NoError(t, err)
+
+	var docs []bson.M
+	for i := 0; i < 3; i++ {
+		assert.True(t, stream.Next(context.Background()))
+		var event bson.M
+		assert.NoError(t, stream.Decode(&event))
+		docs = append(docs, event["fullDocument"].(bson.M))
+	}
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "ssn": "123"},
+		{"_id": int32(2), "ssn": "xyz"},
+		{"_id": int32(1), "ssn": "123", "name": "Alice"},
+	}, docs)
+}
@@ -4,18 +4,134 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/256dpi/lungo/bsonkit"
 	"github.com/256dpi/lungo/dbkit"
+	"github.com/256dpi/lungo/mongokit"
 )
 
 // ErrEngineClosed is returned if the engine has been closed.
 var ErrEngineClosed = errors.New("engine closed")
 
+// ErrReadOnly is returned when a write transaction is started on a read-only
+// engine.
+var ErrReadOnly = errors.New("engine read only")
+
+// ErrWriteConflict is returned by Commit if optimistic concurrency is enabled
+// and another transaction has committed changes to the same namespaces since
+// the transaction began. Like the error returned by MongoDB it carries the
+// "TransientTransactionError" label that signals that the transaction can be
+// retried.
+var ErrWriteConflict = mongo.CommandError{
+	Code:    112,
+	Name:    "WriteConflict",
+	Message: "write conflict",
+	Labels:  []string{"TransientTransactionError"},
+}
+
+// ErrDatasetFull is returned by Commit if the transaction would grow the
+// dataset beyond the configured maximum size.
+var ErrDatasetFull = errors.New("dataset full")
+
+// EvictionPolicy is called by Commit with the currently committed catalog, the
+// transaction and the number of bytes by which the dataset exceeds the maximum
+// size. The policy may delete documents using the transaction to make room for
+// the new data.
+type EvictionPolicy func(base *Catalog, txn *Transaction, excess int) error
+
+// EvictOldest returns an eviction policy that deletes the oldest committed
+// documents of the specified namespaces in order until enough space has been
+// released. Documents written by the transaction itself are never evicted. If
+// no handles are specified, all namespaces are considered in alphabetical
+// order.
+func EvictOldest(handles ...Handle) EvictionPolicy {
+	return func(base *Catalog, txn *Transaction, excess int) error {
+		// collect handles
+		list := handles
+		if len(list) == 0 {
+			for handle := range txn.Catalog().Namespaces {
+				if handle[0] != Local {
+					list = append(list, handle)
+				}
+			}
+			sort.Slice(list, func(i, j int) bool {
+				return list[i].String() < list[j].String()
+			})
+		}
+
+		// delete documents
+		for _, handle := range list {
+			// load namespace
+			err := txn.Load(handle)
+			if err != nil {
+				return err
+			}
+
+			// get namespaces
+			committed, err := txn.resolve(base.Namespaces[handle])
+			if err != nil {
+				return err
+			}
+			namespace := txn.Catalog().Namespaces[handle]
+			if committed == nil || namespace == nil {
+				continue
+			}
+
+			// delete oldest committed documents
+			for _, doc := range namespace.Documents.List {
+				// check excess
+				if excess <= 0 {
+					return nil
+				}
+
+				// skip documents written by the transaction
+				if stored, ok := committed.Documents.Get(doc); !ok || stored != doc {
+					continue
+				}
+
+				// delete document
+				res, err := txn.Delete(handle, bsonkit.MustConvert(bson.M{
+					"_id": bsonkit.Get(doc, "_id"),
+				}), nil, 0, 1)
+				if err != nil {
+					return err
+				}
+
+				// update excess
+				excess -= bsonkit.SizeList(res.Matched)
+			}
+		}
+
+		return nil
+	}
+}
+
+// Strictness defines how unsupported options are handled.
+type Strictness string
+
+// The available strictness levels.
+const (
+	// Strict returns an error if an unsupported option is set. Errors of
+	// handle constructors are returned by the operations on the handle.
+	Strict Strictness = "strict"
+
+	// Lenient logs and ignores unsupported options.
+	Lenient Strictness = "lenient"
+
+	// Silent ignores unsupported options.
+	Silent Strictness = "silent"
+)
+
 // Options is used to configure an engine.
 type Options struct {
 	// The store used by the engine to load and store the catalog.
@@ -26,9 +142,15 @@ type Options struct {
 	// Default: 60s.
 	ExpireInterval time.Duration
 
-	// The function that is called with errors from the expiry goroutine.
+	// The function that is called with errors from the expiry and compaction
+	// goroutines.
 	ExpireErrors func(error)
 
+	// The interval at which the engine is compacted.
+	//
+	// Default: 0 (disabled).
+	CompactInterval time.Duration
+
 	// The minimum and maximum size of the oplog.
 	//
 	// Default: 100, 1000.
@@ -40,20 +162,151 @@ type Options struct {
 	// Default: 5m, 1h.
 	MinOplogAge time.Duration
 	MaxOplogAge time.Duration
+
+	// The maximum number of cached query results. Cached results are reused
+	// by identical queries until the queried namespace changes. Queries that
+	// depend on the time of evaluation, see mongokit.Volatile, are not cached.
+	//
+	// Default: 0 (disabled).
+	QueryCacheSize int
+
+	// The registry used to encode and decode documents by clients, databases
+	// and collections. It may be overridden using the database and collection
+	// options.
+	//
+	// Default: bson.DefaultRegistry.
+	Registry *bsoncodec.Registry
+
+	// The optional client side field level encryption configuration.
+	FieldEncryption *FieldEncryption
+
+	// The maximum encoded size of all documents in bytes. Commits that would
+	// grow the dataset beyond this size fail with ErrDatasetFull unless the
+	// eviction policy is able to release enough space. The oplog is not
+	// included in the dataset size.
+	//
+	// Default: 0 (unlimited).
+	MaxDatasetBytes int
+
+	// The policy used to release space if the dataset exceeds the maximum
+	// size. If missing, the exceeding commits are rejected.
+	Eviction EvictionPolicy
+
+	// Whether write transactions may run concurrently on their own snapshot
+	// of the catalog instead of being serialized. Conflicts are detected per
+	// namespace when committing and the transaction that commits first wins.
+	// Later transactions fail with ErrWriteConflict.
+	OptimisticConcurrency bool
+
+	// Whether the engine only loads the catalog and rejects all mutations
+	// with ErrReadOnly. Read-only engines never write to the store and do
+	// not run the background expiry and compaction.
+	ReadOnly bool
+
+	// Whether the engine maintains the version of every written document in
+	// the local.versions namespace. Versions are the cluster times of the
+	// last writes and deleted documents are kept as tombstones. Versions are
+	// required to reconcile diverged engines using Merge.
+	TrackVersions bool
+
+	// The random number generator used by operations that select random
+	// documents like the $sample aggregation stage. Operations derive their
+	// own generator from it, which makes results deterministic for a seeded
+	// generator and a fixed sequence of operations.
+	//
+	// Default: A generator seeded with the current time.
+	Random *rand.Rand
+
+	// The function that is called with an event for every operation started
+	// by a collection. Comments set using the Comment option or the $comment
+	// query operator are included to trace operations back to call sites.
+	Monitor func(CommandEvent)
+
+	// The MongoDB server version that should be mimicked in the form
+	// "major.minor". It controls version specific details like the "ns" and
+	// "v" fields of index specifications and the namespace length limit
+	// applied to index names by servers older than 4.2.
+	//
+	// Default: "" (latest behaviour).
+	ServerVersion string
+
+	// The handling of options that are not supported by lungo. Strict engines
+	// return an ErrUnsupportedOption, lenient engines log and ignore the
+	// options and silent engines ignore them. Methods that cannot return an
+	// error, like Client.Database, Database.Collection and NewBucket, defer the
+	// error to the operations on the returned handle.
+	//
+	// Default: Strict.
+	Strictness Strictness
+
+	// The logger that receives diagnostic messages about ignored options, slow
+	// operations, background expiry and compaction activity and store errors.
+	//
+	// Default: StdLogger(nil, LogWarn).
+	Logger Logger
+
+	// The duration after which completed operations are logged as slow.
+	//
+	// Default: 0 (disabled).
+	SlowOperationThreshold time.Duration
+
+	// Whether sorts specified by find operations are extended with an
+	// ascending "_id" sort to break ties between documents with equal sort
+	// keys. This makes paginating results using skip and limit deterministic
+	// regardless of the natural order of documents. Sorts that already include
+	// the "_id" field or request the natural order are not changed.
+	SortTiebreaker bool
+
+	// The duration after which idle cursors with remaining documents are
+	// killed to release the documents they retain. Killed cursors fail with
+	// ErrCursorNotFound. Cursors created with the NoCursorTimeout option are
+	// never killed. A negative value disables the timeout.
+	//
+	// Default: 10m.
+	CursorTimeout time.Duration
+
+	// Whether the catalog is verified after being loaded from the store using
+	// the checks of the validate command. The engine creation fails if an
+	// inconsistent namespace is detected, unless RepairOnLoad is set.
+	VerifyOnLoad bool
+
+	// Whether namespaces that fail the verification on load are repaired by
+	// rebuilding their indexes and size from the documents. Repairs are
+	// logged and written to the store with the next commit.
+	RepairOnLoad bool
 }
 
 // Engine manages the catalog loaded from a store and provides access to it
 // through transactions. Additionally, it also manages streams that subscribe
 // to catalog changes.
 type Engine struct {
-	opts    Options
-	store   Store
-	catalog *Catalog
-	streams map[*Stream]struct{}
-	token   *dbkit.Semaphore
-	txn     *Transaction
-	closed  bool
-	mutex   sync.Mutex
+	opts        Options
+	store       Store
+	lazy        LazyStore
+	catalog     *Catalog
+	cache       *queryCache
+	streams     map[*Stream]struct{}
+	token       *dbkit.Semaphore
+	txn         *Transaction
+	txns        map[*Transaction]struct{}
+	done        chan struct{}
+	group       sync.WaitGroup
+	closing     bool
+	closed      bool
+	random      *rand.Rand
+	version     [2]int
+	cursors     map[int64]*Cursor
+	cursor      int64
+	reducers    map[string]MapReducer
+	functions   map[string]mongokit.FunctionAccumulator
+	sessions    []bson.Raw
+	active      int
+	sessionUse  map[string]time.Time
+	operations  map[int64]*operation
+	operation   int64
+	ephemeral   map[Handle]*ephemeral
+	diagnostics diagnostics
+	mutex       sync.Mutex
 }
 
 // CreateEngine will create and return an engine with a loaded catalog from the
@@ -80,12 +333,62 @@ func CreateEngine(opts Options) (*Engine, error) {
 		opts.MaxOplogAge = time.Hour
 	}
 
+	// set default cursor timeout
+	if opts.CursorTimeout == 0 {
+		opts.CursorTimeout = 10 * time.Minute
+	}
+
+	// set default random number generator
+	if opts.Random == nil {
+		opts.Random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	// set default logger
+	if opts.Logger == nil {
+		opts.Logger = defaultLogger
+	}
+
+	// set and check strictness
+	switch opts.Strictness {
+	case "":
+		opts.Strictness = Strict
+	case Strict, Lenient, Silent:
+	default:
+		return nil, fmt.Errorf("invalid strictness %q", opts.Strictness)
+	}
+
+	// parse server version
+	var version [2]int
+	if opts.ServerVersion != "" {
+		var err error
+		version, err = parseServerVersion(opts.ServerVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// create engine
 	e := &Engine{
-		opts:    opts,
-		store:   opts.Store,
-		streams: map[*Stream]struct{}{},
-		token:   dbkit.NewSemaphore(1),
+		opts:       opts,
+		store:      opts.Store,
+		streams:    map[*Stream]struct{}{},
+		token:      dbkit.NewSemaphore(1),
+		txns:       map[*Transaction]struct{}{},
+		done:       make(chan struct{}),
+		random:     opts.Random,
+		version:    version,
+		cursors:    map[int64]*Cursor{},
+		sessionUse: map[string]time.Time{},
+		operations: map[int64]*operation{},
+		ephemeral:  map[Handle]*ephemeral{},
+	}
+
+	// check lazy store
+	e.lazy, _ = opts.Store.(LazyStore)
+
+	// create cache
+	if opts.QueryCacheSize > 0 {
+		e.cache = newQueryCache(opts.QueryCacheSize)
 	}
 
 	// load catalog
@@ -94,12 +397,47 @@ func CreateEngine(opts Options) (*Engine, error) {
 		return nil, err
 	}
 
+	// verify catalog
+	if opts.VerifyOnLoad {
+		data, err = e.verifyCatalog(data, opts.RepairOnLoad)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// set catalog
 	e.catalog = data
 
+	// continue timestamps of persisted oplog, the latest event is searched as
+	// oplogs written by previous versions may not be ordered by cluster time
+	for _, event := range data.Namespaces[Oplog].Documents.List {
+		ts, ok := bsonkit.Get(event, "clusterTime").(primitive.Timestamp)
+		if ok {
+			bsonkit.Advance(ts)
+		}
+	}
+
+	// run cursor timeout
+	if opts.CursorTimeout > 0 {
+		e.group.Add(1)
+		go e.timeoutCursors(opts.CursorTimeout)
+	}
+
+	// skip background tasks if read-only
+	if opts.ReadOnly {
+		return e, nil
+	}
+
 	// run expiry
+	e.group.Add(1)
 	go e.expire(opts.ExpireInterval, opts.ExpireErrors)
 
+	// run compaction
+	if opts.CompactInterval > 0 {
+		e.group.Add(1)
+		go e.compact(opts.CompactInterval, opts.ExpireErrors)
+	}
+
 	return e, nil
 }
 
@@ -116,25 +454,35 @@ func (e *Engine) Catalog() *Catalog {
 // Begin will create a new transaction from the current catalog. A locked
 // transaction must be committed or aborted before another transaction can be
 // started. Unlocked transactions serve as a point in time snapshots and can be
-// just be discarded when not being used further.
+// just be discarded when not being used further. Locked transactions are
+// rejected with ErrReadOnly if the engine is read-only.
 func (e *Engine) Begin(ctx context.Context, lock bool) (*Transaction, error) {
 	// acquire lock
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
 	// check if closed
-	if e.closed {
+	if e.closed || e.closing {
 		return nil, ErrEngineClosed
 	}
 
-	// non lock transactions do not need to be managed
-	if !lock {
-		return NewTransaction(e.catalog), nil
+	// check if read-only
+	if lock && e.opts.ReadOnly {
+		return nil, ErrReadOnly
 	}
 
 	// ensure context
 	ctx = ensureContext(ctx)
 
+	// non lock transactions do not need to be managed
+	if !lock {
+		txn := NewTransaction(e.catalog)
+		txn.ctx = ctx
+		txn.cache = e.cache
+		txn.lazy = e.lazy
+		return txn, nil
+	}
+
 	// check for transaction
 	sess, ok := ctx.Value(sessionKey{}).(*Session)
 	if ok {
@@ -144,14 +492,34 @@ func (e *Engine) Begin(ctx context.Context, lock bool) (*Transaction, error) {
 		}
 	}
 
+	// create optimistic transaction
+	if e.opts.OptimisticConcurrency {
+		txn := NewTransaction(e.catalog)
+		txn.ctx = ctx
+		txn.cache = e.cache
+		txn.lazy = e.lazy
+		e.txns[txn] = struct{}{}
+		return txn, nil
+	}
+
 	// acquire token (without lock)
 	e.mutex.Unlock()
+	start := time.Now()
 	ok = e.token.Acquire(ctx.Done(), time.Minute)
+	e.diagnostics.recordLockWait(time.Since(start))
 	e.mutex.Lock()
-	if !ok {
+	if !ok && ctx.Err() != nil {
+		return nil, ctx.Err()
+	} else if !ok {
 		return nil, fmt.Errorf("token acquisition timeout")
 	}
 
+	// check if closed in the meantime
+	if e.closed || e.closing {
+		e.token.Release()
+		return nil, ErrEngineClosed
+	}
+
 	// assert transaction
 	if e.txn != nil {
 		e.token.Release()
@@ -160,6 +528,9 @@ func (e *Engine) Begin(ctx context.Context, lock bool) (*Transaction, error) {
 
 	// create transaction
 	e.txn = NewTransaction(e.catalog)
+	e.txn.ctx = ctx
+	e.txn.cache = e.cache
+	e.txn.lazy = e.lazy
 
 	return e.txn, nil
 }
@@ -177,34 +548,70 @@ func (e *Engine) Commit(txn *Transaction) error {
 		return ErrEngineClosed
 	}
 
-	// check transaction
-	if e.txn != txn {
-		return fmt.Errorf("existing transaction")
+	// check and unset transaction
+	if e.opts.OptimisticConcurrency {
+		if _, ok := e.txns[txn]; !ok {
+			return fmt.Errorf("unknown transaction")
+		}
+		delete(e.txns, txn)
+	} else {
+		if e.txn != txn {
+			return fmt.Errorf("existing transaction")
+		}
+		defer e.token.Release()
+		e.txn = nil
 	}
 
-	// ensure token is released
-	defer e.token.Release()
-
-	// unset transaction
-	e.txn = nil
-
 	// check if dirty
 	if !txn.Dirty() {
 		return nil
 	}
 
+	// merge changes committed since the transaction began
+	if txn.base != e.catalog {
+		err := txn.rebase(e.catalog)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check dataset size
+	err := e.checkSize(txn)
+	if err != nil {
+		return err
+	}
+
+	// track versions
+	if e.opts.TrackVersions {
+		err = txn.trackVersions()
+		if err != nil {
+			return err
+		}
+	}
+
 	// clean oplog
 	txn.Clean(e.opts.MinOplogSize, e.opts.MaxOplogSize, e.opts.MinOplogAge, e.opts.MaxOplogAge)
 
-	// write catalog
-	err := e.store.Store(txn.Catalog())
+	// get changes
+	changes := DiffCatalogs(e.catalog, txn.Catalog())
+
+	// write changes
+	err = StoreChanges(e.store, txn.Catalog(), changes)
 	if err != nil {
 		return err
 	}
 
+	// track usage of ephemeral namespaces
+	e.trackEphemeral(changes)
+
 	// set new catalog
 	e.catalog = txn.Catalog()
 
+	// invalidate cache
+	if e.cache != nil {
+		e.cache.invalidate(e.catalog)
+	}
+
 	// broadcast change
 	for stream := range e.streams {
 		select {
@@ -217,6 +624,105 @@ func (e *Engine) Commit(txn *Transaction) error {
 	return nil
 }
 
+func (e *Engine) checkSize(txn *Transaction) error {
+	// check limit
+	if e.opts.MaxDatasetBytes <= 0 {
+		return nil
+	}
+
+	// allow commits that stay within the limit or do not grow the dataset
+	size := txn.Catalog().Size()
+	if size <= e.opts.MaxDatasetBytes || size <= e.catalog.Size() {
+		return nil
+	}
+
+	// check policy
+	if e.opts.Eviction == nil {
+		return ErrDatasetFull
+	}
+
+	// evict documents
+	err := e.opts.Eviction(e.catalog, txn, size-e.opts.MaxDatasetBytes)
+	if err != nil {
+		return err
+	}
+
+	// check size again
+	if txn.Catalog().Size() > e.opts.MaxDatasetBytes {
+		return ErrDatasetFull
+	}
+
+	return nil
+}
+
+// Transact will begin a locked transaction, yield it to the callback and commit
+// it if the callback returns no error. If the commit fails with a transient
+// error like ErrWriteConflict, the transaction is retried with an exponential
+// backoff until it succeeds or the context is cancelled.
+func (e *Engine) Transact(ctx context.Context, fn func(*Transaction) error) error {
+	// ensure context
+	ctx = ensureContext(ctx)
+
+	// prepare backoff
+	backoff := time.Millisecond
+
+	for {
+		// run transaction
+		err := e.transact(ctx, fn)
+		if !isTransient(err) {
+			return err
+		}
+
+		// await backoff
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// increase backoff
+		backoff *= 2
+		if backoff > 100*time.Millisecond {
+			backoff = 100 * time.Millisecond
+		}
+	}
+}
+
+func (e *Engine) transact(ctx context.Context, fn func(*Transaction) error) error {
+	// begin transaction
+	txn, err := e.Begin(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	// ensure abortion
+	defer e.Abort(txn)
+
+	// yield transaction
+	err = fn(txn)
+	if err != nil {
+		return err
+	}
+
+	// commit transaction
+	err = e.Commit(txn)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func isTransient(err error) bool {
+	// check label
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.HasErrorLabel("TransientTransactionError")
+	}
+
+	return false
+}
+
 // Abort will abort the specified transaction. To ensure a transaction is
 // always released, Abort should be called after finishing any transaction.
 func (e *Engine) Abort(txn *Transaction) {
@@ -229,6 +735,12 @@ func (e *Engine) Abort(txn *Transaction) {
 		return
 	}
 
+	// remove optimistic transaction
+	if e.opts.OptimisticConcurrency {
+		delete(e.txns, txn)
+		return
+	}
+
 	// check transaction
 	if e.txn != txn {
 		return
@@ -252,6 +764,12 @@ func (e *Engine) Watch(handle Handle, pipeline bsonkit.List, resumeAfter, startA
 		return nil, ErrEngineClosed
 	}
 
+	// validate pipeline
+	err := validatePipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
 	// get oplog
 	oplog := e.catalog.Namespaces[Oplog].Documents
 
@@ -273,7 +791,7 @@ func (e *Engine) Watch(handle Handle, pipeline bsonkit.List, resumeAfter, startA
 			}
 		}
 		if !resumed {
-			return nil, fmt.Errorf("unable to resume change stream")
+			return nil, resumeError(oplog, resumeAfter)
 		}
 	}
 
@@ -289,7 +807,7 @@ func (e *Engine) Watch(handle Handle, pipeline bsonkit.List, resumeAfter, startA
 			}
 		}
 		if !resumed {
-			return nil, fmt.Errorf("unable to resume change stream")
+			return nil, resumeError(oplog, startAfter)
 		}
 	}
 
@@ -326,6 +844,41 @@ func (e *Engine) Watch(handle Handle, pipeline bsonkit.List, resumeAfter, startA
 		return e.catalog.Namespaces[Oplog].Documents
 	}
 
+	// set lookup method
+	stream.lookup = func(handle Handle, id interface{}) (bsonkit.Doc, error) {
+		// get namespace
+		e.mutex.Lock()
+		namespace := e.catalog.Namespaces[handle]
+		e.mutex.Unlock()
+		if namespace == nil {
+			return nil, nil
+		}
+
+		// resolve namespace
+		namespace, err := e.resolve(namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		// find document
+		res, err := namespace.Find(context.Background(), bsonkit.MustConvert(bson.M{
+			"_id": id,
+		}), nil, 0, 1)
+		if err != nil {
+			return nil, err
+		} else if len(res.Matched) == 0 {
+			return nil, nil
+		}
+
+		return res.Matched[0], nil
+	}
+
+	// set decrypt method
+	stream.decrypt = func(handle Handle, doc bsonkit.Doc) (bsonkit.Doc, error) {
+		coll := &Collection{engine: e, handle: handle}
+		return coll.decrypt(doc)
+	}
+
 	// set cancel method
 	stream.cancel = func() {
 		e.mutex.Lock()
@@ -339,17 +892,85 @@ func (e *Engine) Watch(handle Handle, pipeline bsonkit.List, resumeAfter, startA
 	return stream, nil
 }
 
-// Close will close the engine.
-func (e *Engine) Close() {
+// InferSchema will infer a $jsonSchema compatible schema from all documents
+// in the namespace specified by the handle. See bsonkit.InferSchema for details.
+func (e *Engine) InferSchema(handle Handle) (bsonkit.Doc, error) {
+	// validate handle
+	err := handle.Validate(true)
+	if err != nil {
+		return nil, err
+	}
+
+	// get catalog
+	catalog := e.Catalog()
+
+	// get namespace
+	namespace := catalog.Namespaces[handle]
+	if namespace == nil {
+		return nil, fmt.Errorf("missing namespace %q", handle.String())
+	}
+
+	// resolve namespace
+	namespace, err = e.resolve(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return bsonkit.InferSchema(namespace.Documents.List), nil
+}
+
+func (e *Engine) resolve(namespace *mongokit.Collection) (*mongokit.Collection, error) {
+	// check store
+	if e.lazy == nil {
+		return namespace, nil
+	}
+
+	return e.lazy.Resolve(namespace)
+}
+
+// Random will return a new random number generator that is seeded from the
+// engine's generator. The returned generator is not safe for concurrent use.
+func (e *Engine) Random() *rand.Rand {
 	// acquire lock
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
+	return rand.New(rand.NewSource(e.random.Int63()))
+}
+
+// Close will close the engine. New transactions are rejected immediately
+// while an active write transaction may still be committed or aborted within
+// a minute. Afterwards, the background goroutines are stopped, all streams are
+// closed and subsequent operations return ErrEngineClosed. Finally, stores
+// that implement io.Closer (like the FlushStore) are closed to write pending
+// data. Errors from closing the store are reported to the ExpireErrors
+// function.
+func (e *Engine) Close() {
+	// close engine
+	err := e.close()
+	if err != nil && e.opts.ExpireErrors != nil {
+		e.opts.ExpireErrors(err)
+	}
+}
+
+func (e *Engine) close() error {
+	// acquire lock
+	e.mutex.Lock()
+
 	// check if closed
-	if e.closed {
-		return
+	if e.closed || e.closing {
+		e.mutex.Unlock()
+		return nil
 	}
 
+	// set flag
+	e.closing = true
+
+	// await active transaction (without lock)
+	e.mutex.Unlock()
+	ok := e.token.Acquire(nil, time.Minute)
+	e.mutex.Lock()
+
 	// close streams
 	for stream := range e.streams {
 		close(stream.signal)
@@ -357,16 +978,119 @@ func (e *Engine) Close() {
 
 	// set flag
 	e.closed = true
+
+	// release token
+	if ok {
+		e.token.Release()
+	}
+
+	// stop goroutines
+	close(e.done)
+	e.mutex.Unlock()
+	e.group.Wait()
+
+	// close store
+	if closer, ok := e.store.(io.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			e.log(LogError, "closing store failed", "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Closed returns whether the engine has been closed.
+func (e *Engine) Closed() bool {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.closed
+}
+
+// Compact will trim the oplog to the configured retention window, rebuild the
+// namespaces that had documents or indexes removed to release the retained
+// memory, and write the rebuilt namespaces to the store to reclaim space. The
+// catalog is left unchanged if there is nothing to compact.
+func (e *Engine) Compact() error {
+	// begin transaction
+	txn, err := e.Begin(nil, true)
+	if err != nil {
+		return err
+	}
+
+	// ensure abortion
+	defer e.Abort(txn)
+
+	// clean oplog
+	txn.Clean(e.opts.MinOplogSize, e.opts.MaxOplogSize, e.opts.MinOplogAge, e.opts.MaxOplogAge)
+
+	// compact namespaces
+	err = txn.Compact()
+	if err != nil {
+		return err
+	}
+
+	// commit transaction
+	err = e.Commit(txn)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (e *Engine) compact(interval time.Duration, reporter func(error)) {
+	// ensure done
+	defer e.group.Done()
+
+	for {
+		// await next interval or close
+		select {
+		case <-time.After(interval):
+		case <-e.done:
+			return
+		}
+
+		// compact engine
+		start := time.Now()
+		err := e.Compact()
+		if errors.Is(err, ErrEngineClosed) {
+			return
+		} else if err != nil {
+			e.log(LogError, "compaction failed", "error", err)
+			if reporter != nil {
+				reporter(err)
+			}
+			continue
+		}
+
+		// log compaction
+		e.log(LogDebug, "compaction completed", "duration", time.Since(start))
+	}
 }
 
 func (e *Engine) expire(interval time.Duration, reporter func(error)) {
+	// ensure done
+	defer e.group.Done()
+
 	for {
-		// await next interval
-		time.Sleep(interval)
+		// await next interval or close
+		select {
+		case <-time.After(interval):
+		case <-e.done:
+			return
+		}
 
 		// get transaction
+		start := time.Now()
 		txn, err := e.Begin(nil, true)
-		if err != nil {
+		if errors.Is(err, ErrEngineClosed) {
+			return
+		} else if err != nil {
+			e.log(LogError, "expiry failed", "error", err)
 			if reporter != nil {
 				reporter(err)
 			}
@@ -377,6 +1101,18 @@ func (e *Engine) expire(interval time.Duration, reporter func(error)) {
 		err = txn.Expire()
 		if err != nil {
 			e.Abort(txn)
+			e.log(LogError, "expiry failed", "error", err)
+			if reporter != nil {
+				reporter(err)
+			}
+			continue
+		}
+
+		// drop ephemeral namespaces
+		dropped, err := e.dropEphemeral(txn)
+		if err != nil {
+			e.Abort(txn)
+			e.log(LogError, "expiry failed", "error", err)
 			if reporter != nil {
 				reporter(err)
 			}
@@ -385,11 +1121,20 @@ func (e *Engine) expire(interval time.Duration, reporter func(error)) {
 
 		// commit transaction
 		err = e.Commit(txn)
-		if err != nil {
+		if errors.Is(err, ErrEngineClosed) {
+			return
+		} else if err != nil {
+			e.log(LogError, "expiry failed", "error", err)
 			if reporter != nil {
 				reporter(err)
 			}
 			continue
 		}
+
+		// forget dropped ephemeral namespaces
+		e.forgetEphemeral(dropped)
+
+		// log expiry
+		e.log(LogDebug, "expiry completed", "duration", time.Since(start))
 	}
 }
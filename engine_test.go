@@ -0,0 +1,1092 @@
+package lungo
+
+import (
+	"context"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestEngineInferSchema(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	_, err = client.Database("foo").Collection("bar").InsertMany(nil, []interface{}{
+		bson.D{{Key: "_id", Value: int32(1)}, {Key: "name", Value: "Alice"}},
+		bson.D{{Key: "_id", Value: int32(2)}, {Key: "age", Value: int32(42)}},
+	})
+	assert.NoError(t, err)
+
+	schema, err := engine.InferSchema(Handle{"foo", "bar"})
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.MustConvert(bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: bson.A{"_id"}},
+		{Key: "properties", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "bsonType", Value: "int"}}},
+			{Key: "name", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+			{Key: "age", Value: bson.D{{Key: "bsonType", Value: "int"}}},
+		}},
+	}), schema)
+
+	_, err = engine.InferSchema(Handle{"foo", "baz"})
+	assert.Error(t, err)
+
+	_, err = engine.InferSchema(Handle{"foo", ""})
+	assert.Error(t, err)
+}
+
+func TestEngineContinueTimestamps(t *testing.T) {
+	now := bsonkit.Now()
+	last := primitive.Timestamp{T: now.T, I: now.I + 1000}
+
+	catalog := NewCatalog()
+	_, err := catalog.Namespaces[Oplog].Insert(bsonkit.MustConvert(bson.M{
+		"_id":         bson.M{"ts": last},
+		"clusterTime": last,
+	}))
+	assert.NoError(t, err)
+
+	store := NewMemoryStore()
+	assert.NoError(t, store.Store(catalog))
+
+	engine, err := CreateEngine(Options{
+		Store: store,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	next := bsonkit.Now()
+	assert.Equal(t, 1, bsonkit.Compare(next, last))
+}
+
+func TestEngineCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.bson")
+
+	client, engine, err := Open(nil, Options{
+		Store:        NewFileStore(path, 0666),
+		MinOplogSize: 1,
+		MaxOplogSize: 1000,
+		MinOplogAge:  time.Nanosecond,
+		MaxOplogAge:  time.Hour,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys:    bson.M{"n": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		_, err = coll.InsertOne(nil, bson.M{"_id": i, "n": i})
+		assert.NoError(t, err)
+	}
+
+	_, err = coll.DeleteMany(nil, bson.M{"_id": bson.M{"$gte": 5}})
+	assert.NoError(t, err)
+
+	err = client.Database("foo").Collection("baz").Drop(nil)
+	assert.NoError(t, err)
+
+	before := engine.Catalog()
+	assert.True(t, cap(before.Namespaces[Handle{"foo", "bar"}].Documents.List) > 5)
+
+	err = engine.Compact()
+	assert.NoError(t, err)
+
+	after := engine.Catalog()
+	namespace := after.Namespaces[Handle{"foo", "bar"}]
+	assert.NotSame(t, before, after)
+	assert.Len(t, namespace.Documents.List, 5)
+	assert.Equal(t, 5, cap(namespace.Documents.List))
+	assert.Len(t, namespace.Indexes, 2)
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": 100, "n": 1})
+	assert.Error(t, err)
+
+	/* reload */
+
+	catalog, err := NewFileStore(path, 0666).Load()
+	assert.NoError(t, err)
+	assert.Len(t, catalog.Namespaces[Handle{"foo", "bar"}].Documents.List, 5)
+
+	before = engine.Catalog()
+	err = engine.Compact()
+	assert.NoError(t, err)
+	assert.Same(t, before, engine.Catalog())
+}
+
+func TestEngineCompactUnchanged(t *testing.T) {
+	_, engine, err := Open(nil, Options{
+		Store:                 NewMemoryStore(),
+		OptimisticConcurrency: true,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	insert := func(txn *Transaction, handle Handle, id int) {
+		_, err := txn.Insert(handle, bsonkit.List{
+			bsonkit.MustConvert(bson.M{"_id": id}),
+		}, true)
+		assert.NoError(t, err)
+	}
+
+	txn, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+	insert(txn, Handle{"foo", "bar"}, 1)
+	insert(txn, Handle{"foo", "bar"}, 2)
+	insert(txn, Handle{"foo", "baz"}, 1)
+	_, err = txn.Delete(Handle{"foo", "baz"}, bsonkit.MustConvert(bson.M{}), nil, 0, 0)
+	assert.NoError(t, err)
+	err = engine.Commit(txn)
+	assert.NoError(t, err)
+
+	txn, err = engine.Begin(nil, true)
+	assert.NoError(t, err)
+	insert(txn, Handle{"foo", "bar"}, 3)
+
+	before := engine.Catalog()
+	err = engine.Compact()
+	assert.NoError(t, err)
+
+	after := engine.Catalog()
+	assert.NotSame(t, before, after)
+	assert.Same(t, before.Namespaces[Handle{"foo", "bar"}], after.Namespaces[Handle{"foo", "bar"}])
+	assert.NotSame(t, before.Namespaces[Handle{"foo", "baz"}], after.Namespaces[Handle{"foo", "baz"}])
+	assert.False(t, after.Namespaces[Handle{"foo", "baz"}].Removed)
+
+	err = engine.Commit(txn)
+	assert.NoError(t, err)
+	assert.Len(t, engine.Catalog().Namespaces[Handle{"foo", "bar"}].Documents.List, 3)
+
+	before = engine.Catalog()
+	err = engine.Compact()
+	assert.NoError(t, err)
+	assert.Same(t, before, engine.Catalog())
+}
+
+func TestEngineMaxDatasetBytes(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:           NewMemoryStore(),
+		MaxDatasetBytes: 50,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	for i := 0; i < 3; i++ {
+		_, err = coll.InsertOne(nil, bson.M{"_id": i})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 42, engine.Catalog().Size())
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": 3})
+	assert.ErrorIs(t, err, ErrDatasetFull)
+	assert.Equal(t, 42, engine.Catalog().Size())
+
+	_, err = coll.DeleteOne(nil, bson.M{"_id": 0})
+	assert.NoError(t, err)
+	assert.Equal(t, 28, engine.Catalog().Size())
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1)},
+		{"_id": int32(2)},
+		{"_id": int32(3)},
+	}, dumpCollection(coll, false))
+}
+
+func TestEngineEvictOldest(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:           NewMemoryStore(),
+		MaxDatasetBytes: 50,
+		Eviction:        EvictOldest(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	for i := 0; i < 10; i++ {
+		_, err = coll.InsertOne(nil, bson.M{"_id": i})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 42, engine.Catalog().Size())
+	assert.Equal(t, []bson.M{
+		{"_id": int32(7)},
+		{"_id": int32(8)},
+		{"_id": int32(9)},
+	}, dumpCollection(coll, false))
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": 10, "data": make([]byte, 100)})
+	assert.ErrorIs(t, err, ErrDatasetFull)
+}
+
+func TestEngineClose(t *testing.T) {
+	var errs []error
+	var mutex sync.Mutex
+	client, engine, err := Open(nil, Options{
+		Store:           NewMemoryStore(),
+		ExpireInterval:  time.Millisecond,
+		CompactInterval: time.Millisecond,
+		ExpireErrors: func(err error) {
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		},
+	})
+	assert.NoError(t, err)
+
+	coll := client.Database("foo").Collection("bar")
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": 1})
+	assert.NoError(t, err)
+
+	csr, err := coll.Find(nil, bson.M{})
+	assert.NoError(t, err)
+
+	stream, err := coll.Watch(nil, bson.A{})
+	assert.NoError(t, err)
+
+	txn, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	_, err = txn.Insert(Handle{"foo", "bar"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 2}),
+	}, true)
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		engine.Close()
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, engine.Closed())
+
+	_, err = engine.Begin(nil, false)
+	assert.Equal(t, ErrEngineClosed, err)
+
+	err = engine.Commit(txn)
+	assert.NoError(t, err)
+
+	<-done
+	assert.True(t, engine.Closed())
+	assert.Len(t, engine.Catalog().Namespaces[Handle{"foo", "bar"}].Documents.List, 2)
+
+	assert.False(t, csr.Next(nil))
+	assert.Equal(t, ErrEngineClosed, csr.Err())
+
+	assert.True(t, stream.Next(nil))
+	assert.False(t, stream.Next(nil))
+	assert.NoError(t, stream.Err())
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": 3})
+	assert.ErrorIs(t, err, ErrEngineClosed)
+
+	_, err = coll.Watch(nil, bson.A{})
+	assert.Equal(t, ErrEngineClosed, err)
+
+	time.Sleep(10 * time.Millisecond)
+	mutex.Lock()
+	assert.Empty(t, errs)
+	mutex.Unlock()
+
+	engine.Close()
+}
+
+func TestEngineContext(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	docs := make([]interface{}, 0, 2500)
+	for i := 0; i < 2500; i++ {
+		docs = append(docs, bson.M{"_id": i})
+	}
+
+	_, err = coll.InsertMany(nil, docs)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = coll.Find(ctx, bson.M{})
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = coll.CountDocuments(ctx, bson.M{})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestEngineOptimisticConcurrency(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:                 NewMemoryStore(),
+		OptimisticConcurrency: true,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	insert := func(txn *Transaction, handle Handle, id int) {
+		_, err := txn.Insert(handle, bsonkit.List{
+			bsonkit.MustConvert(bson.M{"_id": id}),
+		}, true)
+		assert.NoError(t, err)
+	}
+
+	/* different namespaces */
+
+	txn1, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	txn2, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	insert(txn1, Handle{"foo", "bar"}, 1)
+	insert(txn2, Handle{"foo", "baz"}, 2)
+
+	err = engine.Commit(txn1)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn2)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []bson.M{
+		{"_id": int64(1)},
+	}, dumpCollection(client.Database("foo").Collection("bar"), false))
+	assert.Equal(t, []bson.M{
+		{"_id": int64(2)},
+	}, dumpCollection(client.Database("foo").Collection("baz"), false))
+	assert.Len(t, engine.Catalog().Namespaces[Oplog].Documents.List, 2)
+
+	/* same namespace */
+
+	txn1, err = engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	txn2, err = engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	insert(txn1, Handle{"foo", "bar"}, 3)
+	insert(txn2, Handle{"foo", "bar"}, 4)
+
+	err = engine.Commit(txn1)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn2)
+	assert.Equal(t, ErrWriteConflict, err)
+
+	var cmdErr mongo.CommandError
+	assert.ErrorAs(t, err, &cmdErr)
+	assert.True(t, cmdErr.HasErrorLabel("TransientTransactionError"))
+
+	assert.Equal(t, []bson.M{
+		{"_id": int64(1)},
+		{"_id": int64(3)},
+	}, dumpCollection(client.Database("foo").Collection("bar"), false))
+
+	/* aborted */
+
+	txn1, err = engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	engine.Abort(txn1)
+
+	err = engine.Commit(txn1)
+	assert.Error(t, err)
+}
+
+func TestEngineOptimisticConcurrencyOplog(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:                 NewMemoryStore(),
+		OptimisticConcurrency: true,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	insert := func(txn *Transaction, handle Handle, id int) {
+		_, err := txn.Insert(handle, bsonkit.List{
+			bsonkit.MustConvert(bson.M{"_id": id}),
+		}, true)
+		assert.NoError(t, err)
+	}
+
+	stream, err := client.Watch(nil, bson.A{})
+	assert.NoError(t, err)
+	defer stream.Close(nil)
+
+	txn1, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	txn2, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	insert(txn1, Handle{"foo", "bar"}, 1)
+	insert(txn2, Handle{"foo", "baz"}, 2)
+	insert(txn1, Handle{"foo", "bar"}, 3)
+
+	err = engine.Commit(txn2)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn1)
+	assert.NoError(t, err)
+
+	oplog := engine.Catalog().Namespaces[Oplog].Documents.List
+	assert.Len(t, oplog, 3)
+	for i := 1; i < len(oplog); i++ {
+		assert.Equal(t, -1, bsonkit.Compare(bsonkit.Get(oplog[i-1], "clusterTime"), bsonkit.Get(oplog[i], "clusterTime")))
+		assert.Equal(t, bsonkit.Get(oplog[i], "clusterTime"), bsonkit.Get(oplog[i], "_id.ts"))
+	}
+
+	var ids []interface{}
+	for i := 0; i < 3; i++ {
+		assert.True(t, stream.Next(nil))
+		var event bson.M
+		assert.NoError(t, stream.Decode(&event))
+		ids = append(ids, event["documentKey"].(bson.M)["_id"])
+	}
+	assert.Equal(t, []interface{}{int64(2), int64(1), int64(3)}, ids)
+
+	txn1, err = engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	txn2, err = engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	insert(txn2, Handle{"foo", "baz"}, 4)
+	txn2.Clean(0, 0, 0, 0)
+	assert.Empty(t, txn2.Catalog().Namespaces[Oplog].Documents.List)
+
+	insert(txn1, Handle{"foo", "bar"}, 5)
+	err = engine.Commit(txn1)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn2)
+	assert.NoError(t, err)
+
+	oplog = engine.Catalog().Namespaces[Oplog].Documents.List
+	assert.Len(t, oplog, 4)
+	assert.Equal(t, int64(5), bsonkit.Get(oplog[3], "documentKey._id"))
+}
+
+func TestEngineOptimisticConcurrencyRace(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:                 NewMemoryStore(),
+		OptimisticConcurrency: true,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"_id": "counter", "n": 0})
+	assert.NoError(t, err)
+
+	err = client.Database("foo").CreateCollection(nil, "baz", options.CreateCollection().
+		SetTimeSeriesOptions(options.TimeSeries().SetTimeField("t")))
+	assert.NoError(t, err)
+	series := client.Database("foo").Collection("baz")
+
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := coll.InsertOne(nil, bson.M{"_id": i*100 + j})
+				if err != nil {
+					assert.Contains(t, err.Error(), "write conflict")
+				}
+				_, err = coll.UpdateOne(nil, bson.M{"_id": "counter"}, bson.M{"$inc": bson.M{"n": 1}})
+				if err != nil {
+					assert.Contains(t, err.Error(), "write conflict")
+				}
+				_, err = series.InsertOne(nil, bson.M{"t": now, "v": i*100 + j})
+				if err != nil {
+					assert.Contains(t, err.Error(), "write conflict")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestEngineTransact(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:                 NewMemoryStore(),
+		OptimisticConcurrency: true,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	handle := Handle{"foo", "bar"}
+
+	var attempts int
+	err = engine.Transact(nil, func(txn *Transaction) error {
+		attempts++
+
+		// commit a conflicting transaction on the first attempt
+		if attempts == 1 {
+			other, err := engine.Begin(nil, true)
+			assert.NoError(t, err)
+			_, err = other.Insert(handle, bsonkit.List{
+				bsonkit.MustConvert(bson.M{"_id": "other"}),
+			}, true)
+			assert.NoError(t, err)
+			assert.NoError(t, engine.Commit(other))
+		}
+
+		_, err := txn.Insert(handle, bsonkit.List{
+			bsonkit.MustConvert(bson.M{"_id": "txn"}),
+		}, true)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, []bson.M{
+		{"_id": "other"},
+		{"_id": "txn"},
+	}, dumpCollection(client.Database("foo").Collection("bar"), false))
+
+	err = engine.Transact(nil, func(txn *Transaction) error {
+		return ErrNoDocuments
+	})
+	assert.Equal(t, ErrNoDocuments, err)
+}
+
+func TestEngineReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bson")
+
+	client, engine, err := Open(nil, Options{
+		Store: NewFileStore(path, 0666),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	engine.Close()
+
+	client, engine, err = Open(nil, Options{
+		Store:    NewFileStore(path, 0666),
+		ReadOnly: true,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	assert.Equal(t, []bson.M{
+		{"_id": "a"},
+	}, dumpCollection(coll, false))
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": "b"})
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = coll.DeleteMany(nil, bson.M{})
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys: bson.M{"foo": 1},
+	})
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	err = engine.Compact()
+	assert.Equal(t, ErrReadOnly, err)
+
+	n, err := coll.CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestEngineRandom(t *testing.T) {
+	sample := func() []bson.M {
+		client, engine, err := Open(nil, Options{
+			Store:  NewMemoryStore(),
+			Random: rand.New(rand.NewSource(42)),
+		})
+		assert.NoError(t, err)
+		defer engine.Close()
+
+		coll := client.Database("foo").Collection("bar")
+		for i := 0; i < 20; i++ {
+			_, err = coll.InsertOne(nil, bson.M{"_id": i})
+			assert.NoError(t, err)
+		}
+
+		csr, err := coll.Aggregate(nil, bson.A{
+			bson.M{"$sample": bson.M{"size": 5}},
+		})
+		assert.NoError(t, err)
+
+		return readAll(csr)
+	}
+
+	res1 := sample()
+	assert.Len(t, res1, 5)
+	assert.Equal(t, res1, sample())
+}
+
+func TestEngineStrictness(t *testing.T) {
+	_, err := CreateEngine(Options{
+		Store:      NewMemoryStore(),
+		Strictness: "foo",
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `invalid strictness "foo"`, err.Error())
+
+	for _, strictness := range []Strictness{"", Strict, Lenient, Silent} {
+		logger := &testLogger{}
+		client, engine, err := Open(nil, Options{
+			Store:      NewMemoryStore(),
+			Strictness: strictness,
+			Logger:     logger,
+		})
+		assert.NoError(t, err)
+
+		coll := client.Database("foo").Collection("bar")
+		_, err = coll.Find(nil, bson.M{}, options.Find().SetMin(bson.M{"a": 1}))
+
+		switch strictness {
+		case "", Strict:
+			assert.Error(t, err)
+			assert.Equal(t, ErrUnsupportedOption{Operation: "Collection.Find", Option: "Min"}, err)
+			assert.Equal(t, "lungo: unsupported option Min for Collection.Find", err.Error())
+			assert.Empty(t, logger.list())
+		case Lenient:
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"warn: ignoring unsupported option operation=Collection.Find option=Min"}, logger.list())
+		case Silent:
+			assert.NoError(t, err)
+			assert.Empty(t, logger.list())
+		}
+
+		engine.Close()
+	}
+}
+
+func TestEngineStrictnessHandles(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": 1})
+	assert.NoError(t, err)
+
+	unsupported := ErrUnsupportedOption{Operation: "Client.Database", Option: "Foo"}
+	db := &Database{engine: engine, name: "foo", err: unsupported}
+
+	coll := db.Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"_id": 2})
+	assert.Equal(t, unsupported, err)
+
+	_, err = coll.Indexes().List(nil)
+	assert.Equal(t, unsupported, err)
+
+	err = coll.Drop(nil)
+	assert.Equal(t, unsupported, err)
+
+	_, err = db.ListCollectionNames(nil, bson.M{})
+	assert.Equal(t, unsupported, err)
+
+	err = db.Drop(nil)
+	assert.Equal(t, unsupported, err)
+
+	_, err = NewBucket(db).Find(nil, bson.M{})
+	assert.Equal(t, unsupported, err)
+
+	n, err := client.Database("foo").Collection("bar").CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestEngineSortTiebreaker(t *testing.T) {
+	for _, tiebreaker := range []bool{false, true} {
+		client, engine, err := Open(nil, Options{
+			Store:          NewMemoryStore(),
+			SortTiebreaker: tiebreaker,
+		})
+		assert.NoError(t, err)
+
+		coll := client.Database("foo").Collection("bar")
+		_, err = coll.InsertMany(nil, bson.A{
+			bson.M{"_id": int32(3), "a": int32(1)},
+			bson.M{"_id": int32(1), "a": int32(1)},
+			bson.M{"_id": int32(2), "a": int32(0)},
+			bson.M{"_id": int32(0), "a": int32(1)},
+		})
+		assert.NoError(t, err)
+
+		// paginate
+		var ids []interface{}
+		for skip := int64(0); skip < 4; skip += 2 {
+			csr, err := coll.Find(nil, bson.M{}, options.Find().SetSort(bson.M{"a": 1}).SetSkip(skip).SetLimit(2))
+			assert.NoError(t, err)
+			for _, doc := range readAll(csr) {
+				ids = append(ids, doc["_id"])
+			}
+		}
+
+		if tiebreaker {
+			assert.Equal(t, []interface{}{int32(2), int32(0), int32(1), int32(3)}, ids)
+		} else {
+			assert.Equal(t, []interface{}{int32(2), int32(3), int32(1), int32(0)}, ids)
+		}
+
+		// explicit id sort
+		csr, err := coll.Find(nil, bson.M{}, options.Find().SetSort(bson.D{{Key: "a", Value: -1}, {Key: "_id", Value: -1}}))
+		assert.NoError(t, err)
+		ids = nil
+		for _, doc := range readAll(csr) {
+			ids = append(ids, doc["_id"])
+		}
+		assert.Equal(t, []interface{}{int32(3), int32(1), int32(0), int32(2)}, ids)
+
+		// find one
+		var doc bson.M
+		err = coll.FindOne(nil, bson.M{}, options.FindOne().SetSort(bson.M{"a": -1})).Decode(&doc)
+		assert.NoError(t, err)
+		if tiebreaker {
+			assert.Equal(t, int32(0), doc["_id"])
+		} else {
+			assert.Equal(t, int32(3), doc["_id"])
+		}
+
+		engine.Close()
+	}
+}
+
+func TestEngineIndexSort(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	plain := client.Database("foo").Collection("plain")
+	indexed := client.Database("foo").Collection("indexed")
+
+	_, err = indexed.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: -1}},
+	})
+	assert.NoError(t, err)
+
+	_, err = indexed.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys:    bson.D{{Key: "c", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	assert.NoError(t, err)
+
+	var docs bson.A
+	for i := 0; i < 50; i++ {
+		doc := bson.M{"_id": int32(i), "a": int32(i % 3), "b": int32(i % 2)}
+		if i%4 == 0 {
+			doc["c"] = int32(i % 5)
+		}
+		docs = append(docs, doc)
+	}
+	_, err = plain.InsertMany(nil, docs)
+	assert.NoError(t, err)
+	_, err = indexed.InsertMany(nil, docs)
+	assert.NoError(t, err)
+
+	find := func(coll ICollection, filter, sort bson.D, skip, limit int64) []interface{} {
+		csr, err := coll.Find(nil, filter, options.Find().SetSort(sort).SetSkip(skip).SetLimit(limit))
+		assert.NoError(t, err)
+		var ids []interface{}
+		for _, doc := range readAll(csr) {
+			ids = append(ids, doc["_id"])
+		}
+		return ids
+	}
+
+	for _, sort := range []bson.D{
+		{{Key: "_id", Value: 1}},
+		{{Key: "_id", Value: -1}},
+		{{Key: "a", Value: 1}, {Key: "b", Value: -1}},
+		{{Key: "a", Value: -1}, {Key: "b", Value: 1}},
+		{{Key: "a", Value: 1}, {Key: "b", Value: 1}},
+		{{Key: "c", Value: 1}},
+	} {
+		for _, filter := range []bson.D{
+			{},
+			{{Key: "a", Value: bson.M{"$gt": 0}}},
+			{{Key: "b", Value: 1}},
+		} {
+			for _, page := range [][2]int64{{0, 0}, {0, 5}, {3, 7}, {10, 0}, {45, 10}} {
+				expected := find(plain, filter, sort, page[0], page[1])
+				actual := find(indexed, filter, sort, page[0], page[1])
+				assert.Equal(t, expected, actual, "%v %v %v", sort, filter, page)
+			}
+		}
+	}
+
+	// ties
+	ids := find(indexed, bson.D{}, bson.D{{Key: "a", Value: -1}, {Key: "b", Value: 1}}, 0, 4)
+	assert.Equal(t, []interface{}{int32(2), int32(8), int32(14), int32(20)}, ids)
+
+	// sorted delete
+	var doc bson.M
+	err = indexed.FindOneAndDelete(nil, bson.M{}, options.FindOneAndDelete().SetSort(bson.D{{Key: "a", Value: -1}, {Key: "b", Value: 1}})).Decode(&doc)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), doc["_id"])
+}
+
+func TestEngineIndexLookup(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	plain := client.Database("foo").Collection("plain")
+	indexed := client.Database("foo").Collection("indexed")
+
+	_, err = indexed.Indexes().CreateMany(nil, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "a", Value: 1}}},
+		{Keys: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "c", Value: 1}},
+			Options: options.Index().SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
+	})
+	assert.NoError(t, err)
+
+	var docs bson.A
+	for i := 0; i < 50; i++ {
+		docs = append(docs, bson.M{
+			"_id": int32(i),
+			"a":   int32(i % 3),
+			"b":   int32(i % 2),
+			"c":   []string{"foo", "Foo", "FOO", "bar"}[i%4],
+		})
+	}
+	_, err = plain.InsertMany(nil, docs)
+	assert.NoError(t, err)
+	_, err = indexed.InsertMany(nil, docs)
+	assert.NoError(t, err)
+
+	find := func(coll ICollection, filter bson.D, opts *options.FindOptions) []interface{} {
+		csr, err := coll.Find(nil, filter, opts)
+		assert.NoError(t, err)
+		var ids []interface{}
+		for _, doc := range readAll(csr) {
+			ids = append(ids, doc["_id"])
+		}
+		return ids
+	}
+
+	compare := func() {
+		for _, filter := range []bson.D{
+			{{Key: "_id", Value: int32(7)}},
+			{{Key: "a", Value: int32(1)}},
+			{{Key: "a", Value: bson.M{"$eq": 2.0}}},
+			{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(0)}},
+			{{Key: "b", Value: int32(1)}, {Key: "a", Value: int32(0)}, {Key: "_id", Value: bson.M{"$gt": 20}}},
+			{{Key: "c", Value: "foo"}},
+			{{Key: "c", Value: "FOO"}, {Key: "a", Value: int32(0)}},
+		} {
+			for _, opts := range []*options.FindOptions{
+				options.Find(),
+				options.Find().SetSort(bson.M{"_id": -1}).SetLimit(3),
+				options.Find().SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+				options.Find().SetCollation(&options.Collation{Locale: "en", Strength: 2}).SetSkip(2),
+			} {
+				expected := find(plain, filter, opts)
+				actual := find(indexed, filter, opts)
+				assert.Equal(t, expected, actual, "%v", filter)
+			}
+		}
+	}
+
+	// without arrays
+	compare()
+
+	// with arrays
+	for _, coll := range []ICollection{plain, indexed} {
+		_, err = coll.UpdateOne(nil, bson.M{"_id": int32(5)}, bson.M{"$set": bson.M{"a": bson.A{int32(1), int32(0)}, "c": bson.A{"x", "FOO"}}})
+		assert.NoError(t, err)
+	}
+	compare()
+}
+
+func TestEngineCursorTimeout(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:         NewMemoryStore(),
+		CursorTimeout: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertMany(nil, bson.A{
+		bson.M{"_id": int32(1)},
+		bson.M{"_id": int32(2)},
+	})
+	assert.NoError(t, err)
+
+	csr1, err := coll.Find(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.NotZero(t, csr1.ID())
+
+	csr2, err := coll.Find(nil, bson.M{}, options.Find().SetNoCursorTimeout(true))
+	assert.NoError(t, err)
+	assert.NotZero(t, csr2.ID())
+
+	csr3, err := coll.Find(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.True(t, csr3.Next(nil))
+	assert.True(t, csr3.Next(nil))
+	assert.Zero(t, csr3.ID())
+
+	empty, err := coll.Find(nil, bson.M{"_id": "foo"})
+	assert.NoError(t, err)
+	assert.Zero(t, empty.ID())
+
+	assert.True(t, csr1.Next(nil))
+	assert.True(t, csr2.Next(nil))
+
+	time.Sleep(50 * time.Millisecond)
+
+	// idle cursor is killed
+	assert.False(t, csr1.Next(nil))
+	assert.Equal(t, ErrCursorNotFound, csr1.Err())
+	assert.Zero(t, csr1.ID())
+
+	// cursor without timeout is kept
+	assert.True(t, csr2.Next(nil))
+	assert.NoError(t, csr2.Err())
+
+	// exhausted cursor is kept
+	var doc bson.M
+	assert.NoError(t, csr3.Decode(&doc))
+	assert.Equal(t, bson.M{"_id": int32(2)}, doc)
+	assert.NoError(t, csr3.Err())
+}
+
+func TestEngineListAndKillCursors(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertMany(nil, bson.A{
+		bson.M{"_id": int32(1)},
+		bson.M{"_id": int32(2)},
+	})
+	assert.NoError(t, err)
+
+	assert.Empty(t, engine.ListCursors())
+
+	csr1, err := coll.Find(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.True(t, csr1.Next(nil))
+
+	csr2, err := coll.Find(nil, bson.M{}, options.Find().SetNoCursorTimeout(true))
+	assert.NoError(t, err)
+
+	list := engine.ListCursors()
+	assert.Len(t, list, 2)
+	assert.Equal(t, csr1.ID(), list[0].ID)
+	assert.Equal(t, "foo.bar", list[0].Namespace)
+	assert.Equal(t, 1, list[0].Remaining)
+	assert.False(t, list[0].NoTimeout)
+	assert.False(t, list[0].LastUsed.IsZero())
+	assert.Equal(t, csr2.ID(), list[1].ID)
+	assert.Equal(t, 2, list[1].Remaining)
+	assert.True(t, list[1].NoTimeout)
+
+	ok := engine.KillCursor(csr2.ID())
+	assert.True(t, ok)
+	assert.False(t, csr2.Next(nil))
+	assert.Equal(t, ErrCursorNotFound, csr2.Err())
+	assert.Zero(t, csr2.ID())
+
+	ok = engine.KillCursor(42)
+	assert.False(t, ok)
+
+	err = csr1.Close(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, engine.ListCursors())
+}
+
+func TestEngineEphemeral(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:          NewMemoryStore(),
+		ExpireInterval: 5 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	db := client.Database("foo")
+
+	err = engine.SetEphemeral(Handle{"foo", "age"}, 50*time.Millisecond, 0)
+	assert.NoError(t, err)
+	err = engine.SetEphemeral(Handle{"foo", "idle"}, 0, 50*time.Millisecond)
+	assert.NoError(t, err)
+	err = engine.SetEphemeral(Handle{"foo", "unmarked"}, time.Millisecond, 0)
+	assert.NoError(t, err)
+	err = engine.SetEphemeral(Handle{"foo", "unmarked"}, 0, 0)
+	assert.NoError(t, err)
+	err = engine.SetEphemeral(Handle{"foo"}, time.Millisecond, 0)
+	assert.Error(t, err)
+
+	for _, name := range []string{"age", "idle", "unmarked"} {
+		_, err = db.Collection(name).InsertOne(nil, bson.M{"foo": "bar"})
+		assert.NoError(t, err)
+	}
+
+	// keep idle namespace in use
+	for i := 0; i < 10; i++ {
+		n, err := db.Collection("idle").CountDocuments(nil, bson.M{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	names, err := db.ListCollectionNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"idle", "unmarked"}, names)
+
+	assert.Eventually(t, func() bool {
+		names, err := db.ListCollectionNames(nil, bson.M{})
+		assert.NoError(t, err)
+		return len(names) == 1 && names[0] == "unmarked"
+	}, time.Second, 5*time.Millisecond)
+
+	// recreated namespaces are no longer ephemeral
+	_, err = db.Collection("age").InsertOne(nil, bson.M{"foo": "bar"})
+	assert.NoError(t, err)
+	time.Sleep(70 * time.Millisecond)
+
+	names, err = db.ListCollectionNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"age", "unmarked"}, names)
+}
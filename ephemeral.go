@@ -0,0 +1,108 @@
+package lungo
+
+import (
+	"time"
+)
+
+type ephemeral struct {
+	maxAge  time.Duration
+	maxIdle time.Duration
+	created time.Time
+	used    time.Time
+}
+
+// SetEphemeral will mark the namespace as ephemeral. Ephemeral namespaces are
+// dropped by the background expiry once they are older than the max age or
+// have not been read or written for the max idle time. A zero duration
+// disables the respective limit and disabling both limits unmarks the
+// namespace. The namespace may be marked before it is created. The marks are
+// not persisted and must be reapplied after the engine has been reopened.
+func (e *Engine) SetEphemeral(handle Handle, maxAge, maxIdle time.Duration) error {
+	// validate handle
+	err := handle.Validate(true)
+	if err != nil {
+		return err
+	}
+
+	// check read only
+	if e.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// unmark namespace
+	if maxAge <= 0 && maxIdle <= 0 {
+		delete(e.ephemeral, handle)
+		return nil
+	}
+
+	// mark namespace
+	now := time.Now()
+	e.ephemeral[handle] = &ephemeral{
+		maxAge:  maxAge,
+		maxIdle: maxIdle,
+		created: now,
+		used:    now,
+	}
+
+	return nil
+}
+
+func (e *Engine) touchEphemeral(handle Handle) {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// update usage
+	if eph := e.ephemeral[handle]; eph != nil {
+		eph.used = time.Now()
+	}
+}
+
+func (e *Engine) trackEphemeral(changes Changes) {
+	// update usage of written namespaces (caller holds lock)
+	for _, handle := range changes.Modified {
+		if eph := e.ephemeral[handle]; eph != nil {
+			eph.used = time.Now()
+		}
+	}
+}
+
+func (e *Engine) dropEphemeral(txn *Transaction) ([]Handle, error) {
+	// collect due namespaces
+	e.mutex.Lock()
+	now := time.Now()
+	var handles []Handle
+	for handle, eph := range e.ephemeral {
+		if (eph.maxAge > 0 && now.Sub(eph.created) >= eph.maxAge) || (eph.maxIdle > 0 && now.Sub(eph.used) >= eph.maxIdle) {
+			handles = append(handles, handle)
+		}
+	}
+	e.mutex.Unlock()
+
+	// drop existing namespaces
+	for _, handle := range handles {
+		if txn.Catalog().Namespaces[handle] != nil {
+			err := txn.Drop(handle)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return handles, nil
+}
+
+func (e *Engine) forgetEphemeral(handles []Handle) {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// remove marks
+	for _, handle := range handles {
+		delete(e.ephemeral, handle)
+	}
+}
@@ -0,0 +1,120 @@
+package lungo
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errorCode will return the MongoDB error code and name that correspond to
+// the specified engine error.
+func errorCode(err error) (int32, string) {
+	// check sentinel errors
+	switch {
+	case errors.Is(err, ErrEngineClosed):
+		return 11600, "InterruptedAtShutdown"
+	case errors.Is(err, ErrReadOnly):
+		return 20, "IllegalOperation"
+	case errors.Is(err, ErrDatasetFull):
+		return 14031, "OutOfDiskSpace"
+	case errors.Is(err, ErrSessionEnded):
+		return 206, "NoSuchSession"
+	}
+
+	// check document errors
+	switch {
+	case IsUniquenessError(err):
+		return 11000, "DuplicateKey"
+	case strings.Contains(err.Error(), "_id is immutable"):
+		return 66, "ImmutableField"
+	case strings.HasPrefix(err.Error(), "missing index "):
+		return 27, "IndexNotFound"
+	}
+
+	return 2, "BadValue"
+}
+
+// isEngineError returns whether the error is raised by the engine itself and
+// not by a specific document.
+func isEngineError(err error) bool {
+	return errors.Is(err, ErrEngineClosed) || errors.Is(err, ErrReadOnly) ||
+		errors.Is(err, ErrDatasetFull) || errors.Is(err, ErrSessionEnded)
+}
+
+// isShapedError returns whether the error is already shaped like a driver
+// error or should be returned as is, e.g. context and option errors.
+func isShapedError(err error) bool {
+	// check server errors
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return true
+	}
+
+	// check other errors
+	var optionErr ErrUnsupportedOption
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, mongo.ErrNoDocuments) || errors.As(err, &optionErr)
+}
+
+// commandError will convert an engine error into a mongo.CommandError as
+// returned by read commands and commands like findAndModify. The original
+// error is kept as the wrapped error.
+func commandError(err error) error {
+	// check error
+	if err == nil || isShapedError(err) {
+		return err
+	}
+
+	// get code
+	code, name := errorCode(err)
+
+	return mongo.CommandError{
+		Code:    code,
+		Name:    name,
+		Message: err.Error(),
+		Wrapped: err,
+	}
+}
+
+// writeException will convert an engine error into a mongo.WriteException as
+// returned by the insert, update and delete commands. Errors raised by the
+// engine itself are converted into a mongo.CommandError.
+func writeException(err error) error {
+	// check error
+	if err == nil || isShapedError(err) {
+		return err
+	} else if isEngineError(err) {
+		return commandError(err)
+	}
+
+	// get code
+	code, _ := errorCode(err)
+
+	return mongo.WriteException{
+		WriteErrors: mongo.WriteErrors{
+			{
+				Index:   0,
+				Code:    int(code),
+				Message: err.Error(),
+			},
+		},
+	}
+}
+
+// writeError will convert a document error of a batch write into a
+// mongo.BulkWriteError for the specified request.
+func writeError(index int, err error, request mongo.WriteModel) mongo.BulkWriteError {
+	// get code
+	code, _ := errorCode(err)
+
+	return mongo.BulkWriteError{
+		WriteError: mongo.WriteError{
+			Index:   index,
+			Code:    int(code),
+			Message: err.Error(),
+		},
+		Request: request,
+	}
+}
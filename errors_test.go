@@ -0,0 +1,119 @@
+package lungo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestWriteErrors(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		_, err := c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys:    bson.M{"name": 1},
+			Options: options.Index().SetUnique(true),
+		})
+		assert.NoError(t, err)
+
+		_, err = c.InsertOne(nil, bson.M{"_id": 1, "name": "a"})
+		assert.NoError(t, err)
+
+		// insert one
+		_, err = c.InsertOne(nil, bson.M{"_id": 2, "name": "a"})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+		var we mongo.WriteException
+		assert.True(t, errors.As(err, &we))
+		assert.Len(t, we.WriteErrors, 1)
+		assert.Equal(t, 0, we.WriteErrors[0].Index)
+		assert.Equal(t, 11000, we.WriteErrors[0].Code)
+
+		// insert many
+		_, err = c.InsertMany(nil, []interface{}{
+			bson.M{"_id": 3, "name": "b"},
+			bson.M{"_id": 4, "name": "a"},
+		})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+		var bwe mongo.BulkWriteException
+		assert.True(t, errors.As(err, &bwe))
+		assert.Len(t, bwe.WriteErrors, 1)
+		assert.Equal(t, 1, bwe.WriteErrors[0].Index)
+		assert.Equal(t, 11000, bwe.WriteErrors[0].Code)
+		assert.NotNil(t, bwe.WriteErrors[0].Request)
+
+		// bulk write
+		model := mongo.NewInsertOneModel().SetDocument(bson.M{"_id": 6, "name": "a"})
+		_, err = c.BulkWrite(nil, []mongo.WriteModel{
+			mongo.NewInsertOneModel().SetDocument(bson.M{"_id": 5, "name": "c"}),
+			model,
+		})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+		bwe = mongo.BulkWriteException{}
+		assert.True(t, errors.As(err, &bwe))
+		assert.Len(t, bwe.WriteErrors, 1)
+		assert.Equal(t, 1, bwe.WriteErrors[0].Index)
+		assert.Equal(t, 11000, bwe.WriteErrors[0].Code)
+		assert.Equal(t, model, bwe.WriteErrors[0].Request)
+
+		// update one
+		_, err = c.UpdateOne(nil, bson.M{"_id": 3}, bson.M{
+			"$set": bson.M{"name": "a"},
+		})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+		we = mongo.WriteException{}
+		assert.True(t, errors.As(err, &we))
+		assert.Equal(t, 11000, we.WriteErrors[0].Code)
+
+		// replace one
+		_, err = c.ReplaceOne(nil, bson.M{"_id": 3}, bson.M{"_id": 7, "name": "b"})
+		we = mongo.WriteException{}
+		assert.True(t, errors.As(err, &we))
+		assert.Equal(t, 66, we.WriteErrors[0].Code)
+
+		// find one and update
+		err = c.FindOneAndUpdate(nil, bson.M{"_id": 3}, bson.M{
+			"$set": bson.M{"name": "a"},
+		}).Err()
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+		var ce mongo.CommandError
+		assert.True(t, errors.As(err, &ce))
+		assert.Equal(t, int32(11000), ce.Code)
+	})
+}
+
+func TestEngineErrors(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"foo": "bar"})
+	assert.NoError(t, err)
+
+	// index not found
+	_, err = coll.Indexes().DropOne(nil, "foo_1")
+	var ce mongo.CommandError
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, int32(27), ce.Code)
+	assert.Equal(t, "IndexNotFound", ce.Name)
+
+	engine.Close()
+
+	// engine closed
+	_, err = coll.Find(nil, bson.M{})
+	assert.ErrorIs(t, err, ErrEngineClosed)
+	ce = mongo.CommandError{}
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, int32(11600), ce.Code)
+	assert.Equal(t, "InterruptedAtShutdown", ce.Name)
+
+	// engine closed on write
+	_, err = coll.InsertOne(nil, bson.M{"foo": "bar"})
+	assert.ErrorIs(t, err, ErrEngineClosed)
+	ce = mongo.CommandError{}
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, int32(11600), ce.Code)
+}
@@ -0,0 +1,410 @@
+package lungo
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// CSVOptions configures CSV imports and exports.
+type CSVOptions struct {
+	// The fields to import or export. For imports, the fields replace the
+	// header line which is then expected to be absent. For exports, the fields
+	// are required and written as the header line.
+	Fields []string
+
+	// Whether the fields specify a type e.g. "age.int32()". Supported types
+	// are auto(), string(), int32(), int64(), double(), decimal(), boolean(),
+	// date_go(<layout>) and binary(<base64|hex>). Fields without a type are
+	// treated as auto().
+	ColumnsHaveTypes bool
+
+	// Whether empty fields should be omitted from imported documents.
+	IgnoreBlanks bool
+}
+
+// ImportNDJSON will read newline delimited extended JSON documents from the
+// provided reader and insert them into the collection in one transaction. It
+// returns the number of inserted documents.
+func (c *Collection) ImportNDJSON(ctx context.Context, r io.Reader) (int, error) {
+	// prepare scanner
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 32*1024*1024)
+
+	// read documents
+	var list bsonkit.List
+	for line := 1; scanner.Scan(); line++ {
+		// skip blank lines
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		// decode document
+		var doc bson.D
+		err := bson.UnmarshalExtJSON([]byte(text), false, &doc)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		// add document
+		list = append(list, &doc)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.importList(ctx, list)
+}
+
+// ExportNDJSON will write all documents matching the filter as newline
+// delimited relaxed extended JSON to the provided writer. It returns the number
+// of exported documents.
+func (c *Collection) ExportNDJSON(ctx context.Context, w io.Writer, filter interface{}) (int, error) {
+	// find documents
+	list, err := c.exportList(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// prepare writer
+	writer := bufio.NewWriter(w)
+
+	// write documents
+	for _, doc := range list {
+		// encode document
+		buf, err := bson.MarshalExtJSON(doc, false, false)
+		if err != nil {
+			return 0, err
+		}
+
+		// write line
+		_, err = writer.Write(append(buf, '\n'))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// flush writer
+	err = writer.Flush()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(list), nil
+}
+
+// ImportCSV will read CSV records from the provided reader and insert them
+// into the collection in one transaction. Unless fields are specified, the
+// first record is used as the header line. Dotted field names create embedded
+// documents. It returns the number of inserted documents.
+func (c *Collection) ImportCSV(ctx context.Context, r io.Reader, opts CSVOptions) (int, error) {
+	// prepare reader
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	// get fields
+	fields := opts.Fields
+	if len(fields) == 0 {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+		fields = header
+	}
+
+	// parse columns
+	columns := make([]csvColumn, 0, len(fields))
+	for _, field := range fields {
+		column, err := parseCSVColumn(field, opts.ColumnsHaveTypes)
+		if err != nil {
+			return 0, err
+		}
+		columns = append(columns, column)
+	}
+
+	// read records
+	var list bsonkit.List
+	for {
+		// read record
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		// check length
+		if len(record) > len(columns) {
+			line, _ := reader.FieldPos(0)
+			return 0, fmt.Errorf("line %d: too many fields", line)
+		}
+
+		// build document
+		doc := &bson.D{}
+		for i, value := range record {
+			// check blank
+			if value == "" && opts.IgnoreBlanks {
+				continue
+			}
+
+			// parse value
+			v, err := columns[i].parse(value)
+			if err != nil {
+				line, _ := reader.FieldPos(i)
+				return 0, fmt.Errorf("line %d: field %q: %w", line, columns[i].name, err)
+			}
+
+			// set value
+			_, err = bsonkit.Put(doc, columns[i].name, v, false)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// add document
+		list = append(list, doc)
+	}
+
+	return c.importList(ctx, list)
+}
+
+// ExportCSV will write the specified fields of all documents matching the
+// filter as CSV records to the provided writer. Embedded documents and arrays
+// are written as relaxed extended JSON. It returns the number of exported
+// documents.
+func (c *Collection) ExportCSV(ctx context.Context, w io.Writer, filter interface{}, opts CSVOptions) (int, error) {
+	// check fields
+	if len(opts.Fields) == 0 {
+		return 0, fmt.Errorf("missing fields")
+	}
+
+	// find documents
+	list, err := c.exportList(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// prepare writer
+	writer := csv.NewWriter(w)
+
+	// write header
+	err = writer.Write(opts.Fields)
+	if err != nil {
+		return 0, err
+	}
+
+	// write records
+	record := make([]string, len(opts.Fields))
+	for _, doc := range list {
+		// format fields
+		for i, field := range opts.Fields {
+			record[i], err = formatCSVValue(bsonkit.Get(doc, field))
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// write record
+		err = writer.Write(record)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// flush writer
+	writer.Flush()
+	err = writer.Error()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(list), nil
+}
+
+func (c *Collection) importList(ctx context.Context, list bsonkit.List) (int, error) {
+	// check list
+	if len(list) == 0 {
+		return 0, nil
+	}
+
+	// encrypt documents
+	for _, doc := range list {
+		err := c.encrypt(doc)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// insert documents
+	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
+		// insert documents
+		res, err := txn.Insert(c.handle, list, true)
+		if err != nil {
+			return nil, err
+		} else if res.Error != nil {
+			return nil, res.Error
+		}
+
+		return res, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(res.(*Result).Modified), nil
+}
+
+func (c *Collection) exportList(ctx context.Context, filter interface{}) (bsonkit.List, error) {
+	// transform filter
+	query := &bson.D{}
+	if filter != nil {
+		var err error
+		query, err = bsonkit.TransformWithRegistry(c.registry, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// find documents
+	res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
+		return txn.Find(c.handle, query, nil, 0, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decryptList(res.(*Result).Matched)
+}
+
+type csvColumn struct {
+	name string
+	kind string
+	arg  string
+}
+
+func parseCSVColumn(field string, typed bool) (csvColumn, error) {
+	// handle untyped
+	if !typed || !strings.HasSuffix(field, ")") {
+		return csvColumn{name: field, kind: "auto"}, nil
+	}
+
+	// split type
+	open := strings.LastIndex(field, "(")
+	if open < 0 {
+		return csvColumn{}, fmt.Errorf("invalid typed field %q", field)
+	}
+	dot := strings.LastIndex(field[:open], ".")
+	if dot < 0 {
+		return csvColumn{}, fmt.Errorf("invalid typed field %q", field)
+	}
+
+	// prepare column
+	column := csvColumn{
+		name: field[:dot],
+		kind: field[dot+1 : open],
+		arg:  field[open+1 : len(field)-1],
+	}
+
+	// check type
+	switch column.kind {
+	case "auto", "string", "int32", "int64", "double", "decimal", "boolean", "date_go":
+	case "binary":
+		if column.arg != "base64" && column.arg != "hex" {
+			return csvColumn{}, fmt.Errorf("invalid binary encoding %q", column.arg)
+		}
+	default:
+		return csvColumn{}, fmt.Errorf("unsupported field type %q", column.kind)
+	}
+
+	return column, nil
+}
+
+func (c csvColumn) parse(value string) (interface{}, error) {
+	switch c.kind {
+	case "auto":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			if i >= math.MinInt32 && i <= math.MaxInt32 {
+				return int32(i), nil
+			}
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, nil
+		}
+		return value, nil
+	case "string":
+		return value, nil
+	case "int32":
+		i, err := strconv.ParseInt(value, 10, 32)
+		return int32(i), err
+	case "int64":
+		return strconv.ParseInt(value, 10, 64)
+	case "double":
+		return strconv.ParseFloat(value, 64)
+	case "decimal":
+		return primitive.ParseDecimal128(value)
+	case "boolean":
+		return strconv.ParseBool(value)
+	case "date_go":
+		t, err := time.Parse(c.arg, value)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.NewDateTimeFromTime(t), nil
+	case "binary":
+		var data []byte
+		var err error
+		if c.arg == "hex" {
+			data, err = hex.DecodeString(value)
+		} else {
+			data, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return primitive.Binary{Data: data}, nil
+	default:
+		return nil, fmt.Errorf("unsupported field type %q", c.kind)
+	}
+}
+
+func formatCSVValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case bsonkit.MissingType, nil, primitive.Null:
+		return "", nil
+	case string:
+		return value, nil
+	case int32, int64, bool:
+		return fmt.Sprint(value), nil
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	case primitive.Decimal128:
+		return value.String(), nil
+	case primitive.ObjectID:
+		return fmt.Sprintf("ObjectId(%s)", value.Hex()), nil
+	case primitive.DateTime:
+		return value.Time().UTC().Format("2006-01-02T15:04:05.000Z"), nil
+	default:
+		buf, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+		if err != nil {
+			return "", err
+		}
+		return string(buf[len(`{"v":`) : len(buf)-1]), nil
+	}
+}
@@ -0,0 +1,116 @@
+package lungo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCollectionNDJSON(t *testing.T) {
+	coll := testLungoClient.Database(testDB).Collection(collectionName()).(*Collection)
+
+	n, err := coll.ImportNDJSON(nil, strings.NewReader(`
+		{"_id": 1, "name": "Alice", "tags": ["a", "b"]}
+
+		{"_id": {"$numberLong": "2"}, "name": "Bob", "born": {"$date": "2000-01-02T03:04:05Z"}}
+	`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "name": "Alice", "tags": bson.A{"a", "b"}},
+		{"_id": int64(2), "name": "Bob", "born": primitive.NewDateTimeFromTime(time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC))},
+	}, dumpCollection(coll, false))
+
+	var buf bytes.Buffer
+	n, err = coll.ExportNDJSON(nil, &buf, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, `{"_id":1,"name":"Alice","tags":["a","b"]}
+{"_id":2,"name":"Bob","born":{"$date":"2000-01-02T03:04:05Z"}}
+`, buf.String())
+
+	buf.Reset()
+	n, err = coll.ExportNDJSON(nil, &buf, bson.M{"name": "Bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = coll.ImportNDJSON(nil, strings.NewReader(`{"_id": 3}`+"\n"+`{"_id": `))
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = coll.ImportNDJSON(nil, strings.NewReader(`{"_id": 1}`))
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestCollectionCSV(t *testing.T) {
+	coll := testLungoClient.Database(testDB).Collection(collectionName()).(*Collection)
+
+	n, err := coll.ImportCSV(nil, strings.NewReader(strings.Join([]string{
+		"_id,name,age,score,address.city",
+		"1,Alice,42,1.5,Zurich",
+		"2,Bob,,,",
+	}, "\n")), CSVOptions{
+		IgnoreBlanks: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "name": "Alice", "age": int32(42), "score": 1.5, "address": bson.M{"city": "Zurich"}},
+		{"_id": int32(2), "name": "Bob"},
+	}, dumpCollection(coll, false))
+
+	n, err = coll.ImportCSV(nil, strings.NewReader(strings.Join([]string{
+		"3,007,true,2020-01-02,aGVsbG8=",
+	}, "\n")), CSVOptions{
+		Fields:           []string{"_id.int64()", "code.string()", "active.boolean()", "since.date_go(2006-01-02)", "data.binary(base64)"},
+		ColumnsHaveTypes: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, bson.M{
+		"_id":    int64(3),
+		"code":   "007",
+		"active": true,
+		"since":  primitive.NewDateTimeFromTime(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)),
+		"data":   primitive.Binary{Data: []byte("hello")},
+	}, dumpCollection(coll, false)[2])
+
+	n, err = coll.ImportCSV(nil, strings.NewReader("x\n"), CSVOptions{
+		Fields:           []string{"_id.int32()"},
+		ColumnsHaveTypes: true,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = coll.ImportCSV(nil, strings.NewReader("x\n"), CSVOptions{
+		Fields:           []string{"_id.uuid()"},
+		ColumnsHaveTypes: true,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+
+	var buf bytes.Buffer
+	n, err = coll.ExportCSV(nil, &buf, bson.M{"_id": bson.M{"$lt": 3}}, CSVOptions{
+		Fields: []string{"_id", "name", "score", "address", "address.city"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, strings.Join([]string{
+		"_id,name,score,address,address.city",
+		`1,Alice,1.5,"{""city"":""Zurich""}",Zurich`,
+		"2,Bob,,,",
+		"",
+	}, "\n"), buf.String())
+
+	_, err = coll.ExportCSV(nil, &buf, bson.M{}, CSVOptions{})
+	assert.Error(t, err)
+}
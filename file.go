@@ -2,7 +2,6 @@ package lungo
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/256dpi/lungo/bsonkit"
@@ -16,16 +15,27 @@ type File struct {
 
 // FileNamespace is a single namespace stored in a file.
 type FileNamespace struct {
-	Documents bsonkit.List         `bson:"documents"`
-	Indexes   map[string]FileIndex `bson:"indexes"`
+	Documents  bsonkit.List         `bson:"documents"`
+	Indexes    map[string]FileIndex `bson:"indexes"`
+	TimeSeries *FileTimeSeries      `bson:"timeseries,omitempty"`
+	PreImages  bool                 `bson:"preImages,omitempty"`
 }
 
 // FileIndex is a single index stored in a file.
 type FileIndex struct {
-	Key     bsonkit.Doc   `bson:"key"`
-	Unique  bool          `bson:"unique"`
-	Partial bsonkit.Doc   `bson:"partial"`
-	Expiry  time.Duration `bson:"expiry"`
+	Key       bsonkit.Doc   `bson:"key"`
+	Unique    bool          `bson:"unique"`
+	Sparse    bool          `bson:"sparse,omitempty"`
+	Partial   bsonkit.Doc   `bson:"partial"`
+	Expiry    time.Duration `bson:"expiry"`
+	Collation bsonkit.Doc   `bson:"collation,omitempty"`
+}
+
+// FileTimeSeries is a time series configuration stored in a file.
+type FileTimeSeries struct {
+	TimeField   string `bson:"timeField"`
+	MetaField   string `bson:"metaField"`
+	Granularity string `bson:"granularity"`
 }
 
 // BuildFile will build a new file from the provided catalog.
@@ -45,17 +55,32 @@ func BuildFile(catalog *Catalog) *File {
 
 			// add index
 			indexes[name] = FileIndex{
-				Key:     config.Key,
-				Unique:  config.Unique,
-				Partial: config.Partial,
-				Expiry:  config.Expiry,
+				Key:       config.Key,
+				Unique:    config.Unique,
+				Sparse:    config.Sparse,
+				Partial:   config.Partial,
+				Expiry:    config.Expiry,
+				Collation: config.Collation,
+			}
+		}
+
+		// get time series
+		var timeSeries *FileTimeSeries
+		if namespace.Buckets != nil {
+			config := namespace.Buckets.Config()
+			timeSeries = &FileTimeSeries{
+				TimeField:   config.TimeField,
+				MetaField:   config.MetaField,
+				Granularity: config.Granularity,
 			}
 		}
 
 		// add namespace
 		file.Namespaces[handle.String()] = FileNamespace{
-			Documents: namespace.Documents.List,
-			Indexes:   indexes,
+			Documents:  namespace.Documents.List,
+			Indexes:    indexes,
+			TimeSeries: timeSeries,
+			PreImages:  namespace.PreImages,
 		}
 	}
 
@@ -69,29 +94,61 @@ func (f *File) BuildCatalog() (*Catalog, error) {
 
 	// process namespaces
 	for name, ns := range f.Namespaces {
-		// split name
-		segments := strings.Split(name, ".")
-		if len(segments) != 2 {
+		// parse handle
+		handle, err := ParseHandle(name)
+		if err != nil || handle.IsDatabase() {
 			return nil, fmt.Errorf("invalid namespace name %q", name)
 		}
 
-		// prepare handle
-		handle := Handle{segments[0], segments[1]}
-
 		// create namespace
 		namespace := mongokit.NewCollection(false)
 
-		// add documents
-		namespace.Documents = bsonkit.NewSet(ns.Documents)
+		// add documents, keyed sets skip documents with duplicate ids
+		namespace.Documents = bsonkit.NewKeyedSet(ns.Documents)
+		if ns.TimeSeries != nil {
+			namespace.Documents = bsonkit.NewSet(ns.Documents)
+		} else if handle != Oplog && len(namespace.Documents.List) != len(ns.Documents) {
+			return nil, fmt.Errorf("duplicate document for index %q", "_id_")
+		}
+		namespace.Size = bsonkit.SizeList(ns.Documents)
+
+		// set pre-images
+		namespace.PreImages = ns.PreImages
+
+		// add buckets
+		if ns.TimeSeries != nil {
+			// create buckets
+			buckets, err := mongokit.NewBuckets(mongokit.TimeSeriesConfig{
+				TimeField:   ns.TimeSeries.TimeField,
+				MetaField:   ns.TimeSeries.MetaField,
+				Granularity: ns.TimeSeries.Granularity,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			// add documents
+			for _, doc := range ns.Documents {
+				err = buckets.Add(doc)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			// set buckets
+			namespace.Buckets = buckets
+		}
 
 		// add indexes
 		for name, idx := range ns.Indexes {
 			// create index
 			index, err := mongokit.CreateIndex(mongokit.IndexConfig{
-				Key:     idx.Key,
-				Unique:  idx.Unique,
-				Partial: idx.Partial,
-				Expiry:  idx.Expiry,
+				Key:       idx.Key,
+				Unique:    idx.Unique,
+				Sparse:    idx.Sparse,
+				Partial:   idx.Partial,
+				Expiry:    idx.Expiry,
+				Collation: idx.Collation,
 			})
 			if err != nil {
 				return nil, err
@@ -109,6 +166,14 @@ func (f *File) BuildCatalog() (*Catalog, error) {
 			namespace.Indexes[name] = index
 		}
 
+		// ensure id index of regular collections
+		if ns.TimeSeries == nil && handle != Oplog {
+			err = namespace.EnsureIDIndex()
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		// add namespace
 		catalog.Namespaces[handle] = namespace
 	}
@@ -2,9 +2,11 @@ package lungo
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -16,64 +18,112 @@ var _ IIndexView = &IndexView{}
 
 // IndexView wraps an Engine to be mongo compatible.
 type IndexView struct {
-	engine *Engine
-	handle Handle
+	engine   *Engine
+	handle   Handle
+	registry *bsoncodec.Registry
+
+	// the unsupported option error of the collection, returned by all
+	// operations
+	err error
 }
 
-// CreateMany implements the IIndexView.CreateMany method.
+// CreateMany implements the IIndexView.CreateMany method. All indexes are
+// created in a single transaction. If one index cannot be created, none of the
+// indexes are created.
 func (v *IndexView) CreateMany(ctx context.Context, indexes []mongo.IndexModel, opts ...*options.CreateIndexesOptions) ([]string, error) {
-	// merge options
-	opt := options.MergeCreateIndexesOptions(opts...)
-
-	// assert supported options
-	assertOptions(opt, map[string]string{
-		"MaxTime": ignored,
-	})
-
 	// check filer
 	if len(indexes) == 0 {
 		panic("lungo: missing indexes")
 	}
 
-	// created indexes separately
-	var names []string
-	for _, index := range indexes {
-		name, err := v.CreateOne(ctx, index, opts...)
-		if err != nil {
-			return names, err
-		}
-		names = append(names, name)
-	}
-
-	return names, nil
+	return v.create(ctx, "IndexView.CreateMany", indexes, opts)
 }
 
 // CreateOne implements the IIndexView.CreateOne method.
 func (v *IndexView) CreateOne(ctx context.Context, index mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error) {
+	// create index
+	names, err := v.create(ctx, "IndexView.CreateOne", []mongo.IndexModel{index}, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return names[0], nil
+}
+
+func (v *IndexView) create(ctx context.Context, method string, indexes []mongo.IndexModel, opts []*options.CreateIndexesOptions) ([]string, error) {
 	// merge options
 	opt := options.MergeCreateIndexesOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
-		"MaxTime": ignored,
+	err := v.assertOptions(method, opt, map[string]string{
+		"MaxTime": supported,
 	})
+	if err != nil {
+		return nil, err
+	}
 
+	// prepare names and configs
+	names := make([]string, len(indexes))
+	configs := make([]mongokit.IndexConfig, len(indexes))
+	for i, index := range indexes {
+		names[i], configs[i], err = v.prepare(method, index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// apply max time
+	ctx, cancel := withMaxTime(ctx, opt.MaxTime)
+	defer cancel()
+
+	// begin transaction
+	txn, err := v.engine.Begin(ctx, true)
+	if err != nil {
+		return nil, commandError(contextError(ctx, err))
+	}
+
+	// ensure abortion
+	defer v.engine.Abort(txn)
+
+	// create indexes
+	for i := range indexes {
+		names[i], err = txn.CreateIndex(v.handle, names[i], configs[i])
+		if err != nil {
+			return nil, commandError(contextError(ctx, err))
+		}
+	}
+
+	// commit transaction
+	err = v.engine.Commit(txn)
+	if err != nil {
+		return nil, commandError(err)
+	}
+
+	return names, nil
+}
+
+func (v *IndexView) prepare(method string, index mongo.IndexModel) (string, mongokit.IndexConfig, error) {
 	// assert supported index options
 	if index.Options != nil {
-		assertOptions(index.Options, map[string]string{
+		err := v.assertOptions(method, index.Options, map[string]string{
 			"Background":              ignored,
+			"Collation":               supported,
 			"ExpireAfterSeconds":      supported,
 			"Name":                    supported,
+			"Sparse":                  supported,
 			"Unique":                  supported,
 			"Version":                 ignored,
 			"PartialFilterExpression": supported,
 		})
+		if err != nil {
+			return "", mongokit.IndexConfig{}, err
+		}
 	}
 
 	// transform key
-	key, err := bsonkit.Transform(index.Keys)
+	key, err := bsonkit.TransformWithRegistry(v.registry, index.Keys)
 	if err != nil {
-		return "", err
+		return "", mongokit.IndexConfig{}, err
 	}
 
 	// get expiry
@@ -98,115 +148,130 @@ func (v *IndexView) CreateOne(ctx context.Context, index mongo.IndexModel, opts
 		unique = *index.Options.Unique
 	}
 
+	// get sparse
+	var sparse bool
+	if index.Options != nil && index.Options.Sparse != nil {
+		sparse = *index.Options.Sparse
+	}
+
 	// get partial
 	var partial bsonkit.Doc
 	if index.Options != nil && index.Options.PartialFilterExpression != nil {
-		partial, err = bsonkit.Transform(index.Options.PartialFilterExpression)
+		partial, err = bsonkit.TransformWithRegistry(v.registry, index.Options.PartialFilterExpression)
 		if err != nil {
-			return "", err
+			return "", mongokit.IndexConfig{}, err
 		}
 	}
 
-	// begin transaction
-	txn, err := v.engine.Begin(ctx, true)
-	if err != nil {
-		return "", err
+	// get collation
+	var collation bsonkit.Doc
+	if index.Options != nil && index.Options.Collation != nil {
+		collation, err = bsonkit.TransformWithRegistry(v.registry, index.Options.Collation.ToDocument())
+		if err != nil {
+			return "", mongokit.IndexConfig{}, err
+		}
 	}
 
-	// ensure abortion
-	defer v.engine.Abort(txn)
-
-	// create index
-	name, err = txn.CreateIndex(v.handle, name, mongokit.IndexConfig{
-		Key:     key,
-		Unique:  unique,
-		Partial: partial,
-		Expiry:  expiry,
-	})
-	if err != nil {
-		return "", err
+	// prepare config
+	config := mongokit.IndexConfig{
+		Key:       key,
+		Unique:    unique,
+		Sparse:    sparse,
+		Partial:   partial,
+		Expiry:    expiry,
+		Collation: collation,
 	}
 
-	// commit transaction
-	err = v.engine.Commit(txn)
-	if err != nil {
-		return "", err
+	// check namespace length on older servers
+	if v.engine.older(4, 2) {
+		err = checkIndexNamespace(v.handle, name, config)
+		if err != nil {
+			return "", mongokit.IndexConfig{}, err
+		}
 	}
 
-	return name, nil
+	return name, config, nil
 }
 
-// DropAll implements the IIndexView.DropAll method.
+// DropAll implements the IIndexView.DropAll method. It returns a result
+// document with the number of indexes before the drop in "nIndexesWas".
 func (v *IndexView) DropAll(ctx context.Context, opts ...*options.DropIndexesOptions) (bson.Raw, error) {
 	// merge options
 	opt := options.MergeDropIndexesOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := v.assertOptions("IndexView.DropAll", opt, map[string]string{
 		"MaxTime": ignored,
 	})
-
-	// begin transaction
-	txn, err := v.engine.Begin(ctx, true)
-	if err != nil {
-		return nil, err
-	}
-
-	// ensure abortion
-	defer v.engine.Abort(txn)
-
-	// drop all indexes
-	err = txn.DropIndex(v.handle, "")
 	if err != nil {
-		return nil, err
+		return nil, commandError(err)
 	}
 
-	// commit transaction
-	err = v.engine.Commit(txn)
-	if err != nil {
-		return nil, err
-	}
-
-	return nil, nil
+	return v.drop(ctx, "*")
 }
 
-// DropOne implements the IIndexView.DropOne method.
+// DropOne implements the IIndexView.DropOne method. It returns a result
+// document with the number of indexes before the drop in "nIndexesWas".
 func (v *IndexView) DropOne(ctx context.Context, name string, opts ...*options.DropIndexesOptions) (bson.Raw, error) {
 	// merge options
 	opt := options.MergeDropIndexesOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := v.assertOptions("IndexView.DropOne", opt, map[string]string{
 		"MaxTime": ignored,
 	})
+	if err != nil {
+		return nil, commandError(err)
+	}
 
 	// check name
-	if name == "" || name == "*" {
-		panic("lungo: invalid index name")
+	if name == "*" {
+		return nil, mongo.ErrMultipleIndexDrop
+	} else if name == "" {
+		return nil, commandError(fmt.Errorf("missing index %q", name))
 	}
 
+	return v.drop(ctx, name)
+}
+
+func (v *IndexView) drop(ctx context.Context, name string) (bson.Raw, error) {
 	// begin transaction
 	txn, err := v.engine.Begin(ctx, true)
 	if err != nil {
-		return nil, err
+		return nil, commandError(err)
 	}
 
 	// ensure abortion
 	defer v.engine.Abort(txn)
 
-	// drop all indexes
+	// count indexes
+	list, err := txn.ListIndexes(v.handle)
+	if err != nil {
+		return nil, commandError(err)
+	}
+
+	// drop indexes
 	err = txn.DropIndex(v.handle, name)
 	if err != nil {
-		return nil, err
+		return nil, commandError(err)
 	}
 
 	// commit transaction
 	err = v.engine.Commit(txn)
 	if err != nil {
-		return nil, err
+		return nil, commandError(err)
+	}
+
+	// prepare result
+	result := bson.D{
+		bson.E{Key: "nIndexesWas", Value: int32(len(list))},
+	}
+	if name == "*" {
+		result = append(result, bson.E{Key: "msg", Value: "non-_id indexes dropped for collection"})
 	}
+	result = append(result, bson.E{Key: "ok", Value: 1.0})
 
-	return nil, nil
+	return bson.Marshal(result)
 }
 
 // List implements the IIndexView.List method.
@@ -215,15 +280,18 @@ func (v *IndexView) List(ctx context.Context, opts ...*options.ListIndexesOption
 	opt := options.MergeListIndexesOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := v.assertOptions("IndexView.List", opt, map[string]string{
 		"BatchSize": ignored,
 		"MaxTime":   ignored,
 	})
+	if err != nil {
+		return nil, commandError(err)
+	}
 
 	// begin transaction
 	txn, err := v.engine.Begin(ctx, false)
 	if err != nil {
-		return nil, err
+		return nil, commandError(err)
 	}
 
 	// list indexes
@@ -232,10 +300,157 @@ func (v *IndexView) List(ctx context.Context, opts ...*options.ListIndexesOption
 		return nil, err
 	}
 
-	return &Cursor{list: list}, nil
+	// adjust specs for older servers
+	if v.engine.older(4, 4) {
+		for i, spec := range list {
+			list[i] = legacyIndexSpec(v.handle, spec, v.engine.older(3, 4))
+		}
+	}
+
+	return v.engine.trackCursor(&Cursor{engine: v.engine, list: list, registry: v.registry, ns: v.handle.String()}), nil
 }
 
 // ListSpecifications implements the IIndexView.ListSpecifications method.
 func (v *IndexView) ListSpecifications(context.Context, ...*options.ListIndexesOptions) ([]*mongo.IndexSpecification, error) {
 	panic("lungo: not implemented")
 }
+
+func buildIndexSpec(name string, config mongokit.IndexConfig) bsonkit.Doc {
+	// create spec
+	spec := bson.D{
+		bson.E{Key: "v", Value: int32(2)},
+		bson.E{Key: "key", Value: *config.Key},
+		bson.E{Key: "name", Value: name},
+	}
+
+	// add unique
+	if config.Unique && name != "_id_" {
+		spec = append(spec, bson.E{Key: "unique", Value: true})
+	}
+
+	// add sparse
+	if config.Sparse {
+		spec = append(spec, bson.E{Key: "sparse", Value: true})
+	}
+
+	// add partial
+	if config.Partial != nil {
+		spec = append(spec, bson.E{Key: "partialFilterExpression", Value: *config.Partial})
+	}
+
+	// add expiry
+	if config.Expiry > 0 {
+		spec = append(spec, bson.E{Key: "expireAfterSeconds", Value: int32(config.Expiry / time.Second)})
+	}
+
+	// add collation
+	if config.Collation != nil {
+		spec = append(spec, bson.E{Key: "collation", Value: *config.Collation})
+	}
+
+	return &spec
+}
+
+func legacyIndexSpec(handle Handle, spec bsonkit.Doc, v1 bool) bsonkit.Doc {
+	// prepare spec
+	legacy := make(bson.D, 0, len(*spec)+1)
+
+	// copy fields and add namespace after name
+	for _, field := range *spec {
+		if field.Key == "v" && v1 {
+			field.Value = int32(1)
+		}
+		legacy = append(legacy, field)
+		if field.Key == "name" {
+			legacy = append(legacy, bson.E{Key: "ns", Value: handle.String()})
+		}
+	}
+
+	return &legacy
+}
+
+func checkIndexNamespace(handle Handle, name string, config mongokit.IndexConfig) error {
+	// compute name if missing
+	if name == "" {
+		var err error
+		name, err = config.Name()
+		if err != nil {
+			return err
+		}
+	}
+
+	// check length
+	ns := handle.String() + ".$" + name
+	if len(ns) > mongokit.MaxIndexNameLength {
+		return fmt.Errorf("namespace name generated from index name %q is too long (%d byte max)", ns, mongokit.MaxIndexNameLength)
+	}
+
+	return nil
+}
+
+func parseIndexSpec(spec bsonkit.Doc) (string, mongokit.IndexConfig, error) {
+	// get name
+	name, ok := bsonkit.Get(spec, "name").(string)
+	if !ok || name == "" {
+		return "", mongokit.IndexConfig{}, fmt.Errorf("missing or invalid index name")
+	}
+
+	// get key
+	key, ok := bsonkit.Get(spec, "key").(bson.D)
+	if !ok {
+		return "", mongokit.IndexConfig{}, fmt.Errorf("missing or invalid index key")
+	}
+
+	// prepare config
+	config := mongokit.IndexConfig{
+		Key:    &key,
+		Unique: name == "_id_",
+	}
+
+	// get unique
+	if unique, ok := bsonkit.Get(spec, "unique").(bool); ok && unique {
+		config.Unique = true
+	}
+
+	// get sparse
+	if sparse, ok := bsonkit.Get(spec, "sparse").(bool); ok && sparse {
+		config.Sparse = true
+	}
+
+	// get partial
+	if partial, ok := bsonkit.Get(spec, "partialFilterExpression").(bson.D); ok {
+		config.Partial = &partial
+	}
+
+	// get expiry
+	var seconds int64 = -1
+	switch expiry := bsonkit.Get(spec, "expireAfterSeconds").(type) {
+	case int32:
+		seconds = int64(expiry)
+	case int64:
+		seconds = expiry
+	case float64:
+		seconds = int64(expiry)
+	}
+	if seconds == 0 {
+		config.Expiry = time.Nanosecond
+	} else if seconds > 0 {
+		config.Expiry = time.Duration(seconds) * time.Second
+	}
+
+	// get collation
+	if collation, ok := bsonkit.Get(spec, "collation").(bson.D); ok {
+		config.Collation = &collation
+	}
+
+	return name, config, nil
+}
+
+func (v *IndexView) assertOptions(operation string, opts interface{}, fields map[string]string) error {
+	// check error
+	if v.err != nil {
+		return v.err
+	}
+
+	return assertOptions(v.engine, operation, opts, fields)
+}
@@ -1,6 +1,8 @@
 package lungo
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,6 +31,27 @@ func TestIndexViewCreateMany(t *testing.T) {
 		assert.Error(t, err)
 		assert.Nil(t, names)
 
+		// partially invalid indexes
+		names, err = c.Indexes().CreateMany(nil, []mongo.IndexModel{
+			{
+				Keys: bson.M{
+					"qux": 1,
+				},
+			},
+			{
+				Keys: bson.M{
+					"bar": false,
+				},
+			},
+		})
+		assert.Error(t, err)
+		assert.Nil(t, names)
+
+		// list
+		csr, err = c.Indexes().List(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{}, readAll(csr))
+
 		// compound and partial index
 		names, err = c.Indexes().CreateMany(nil, []mongo.IndexModel{
 			{
@@ -134,6 +157,48 @@ func TestIndexViewCreateOne(t *testing.T) {
 		assert.Error(t, err)
 		assert.Empty(t, name)
 
+		// zero direction
+		name, err = c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys: bson.M{
+				"bar": 0,
+			},
+		})
+		assert.Error(t, err)
+		assert.Empty(t, name)
+
+		// unknown plugin
+		name, err = c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys: bson.M{
+				"bar": "foo",
+			},
+		})
+		assert.Error(t, err)
+		assert.Empty(t, name)
+
+		// mixed plugins
+		name, err = c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "bar", Value: "text"},
+				{Key: "baz", Value: "2dsphere"},
+			},
+		})
+		assert.Error(t, err)
+		assert.Empty(t, name)
+
+		// long name
+		name, err = c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys: bson.M{
+				"bar": 1,
+			},
+			Options: options.Index().SetName(strings.Repeat("x", 128)),
+		})
+		switch c.(type) {
+		case *Collection:
+			assert.Error(t, err)
+			assert.Equal(t, fmt.Sprintf("(BadValue) index name %q is too long (127 byte max)", strings.Repeat("x", 128)), err.Error())
+			assert.Empty(t, name)
+		}
+
 		// prepare options
 		opts := options.Index().
 			SetName("foo").
@@ -282,8 +347,10 @@ func TestIndexViewDropAll(t *testing.T) {
 		}, readAll(csr))
 
 		// drop
-		_, err = c.Indexes().DropAll(nil)
+		res, err := c.Indexes().DropAll(nil)
 		assert.NoError(t, err)
+		assert.Equal(t, int32(3), res.Lookup("nIndexesWas").Int32())
+		assert.Equal(t, 1.0, res.Lookup("ok").Double())
 
 		// list
 		csr, err = c.Indexes().List(nil)
@@ -340,9 +407,27 @@ func TestIndexViewDropOne(t *testing.T) {
 			},
 		}, readAll(csr))
 
+		// drop id index
+		_, err = c.Indexes().DropOne(nil, "_id_")
+		assert.Error(t, err)
+
+		// drop missing index
+		_, err = c.Indexes().DropOne(nil, "bar")
+		assert.Error(t, err)
+
+		// drop all indexes
+		_, err = c.Indexes().DropOne(nil, "*")
+		assert.Equal(t, mongo.ErrMultipleIndexDrop, err)
+
+		// drop empty name
+		_, err = c.Indexes().DropOne(nil, "")
+		assert.Error(t, err)
+
 		// drop
-		_, err = c.Indexes().DropOne(nil, "foo")
+		res, err := c.Indexes().DropOne(nil, "foo")
 		assert.NoError(t, err)
+		assert.Equal(t, int32(2), res.Lookup("nIndexesWas").Int32())
+		assert.Equal(t, 1.0, res.Lookup("ok").Double())
 
 		// list
 		csr, err = c.Indexes().List(nil)
@@ -360,7 +445,42 @@ func TestIndexViewDropOne(t *testing.T) {
 }
 
 func TestIndexViewList(t *testing.T) {
-	// tested in above tests
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		// sparse index with collation
+		name, err := c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys: bson.M{
+				"foo": 1,
+			},
+			Options: options.Index().
+				SetSparse(true).
+				SetUnique(true).
+				SetCollation(&options.Collation{
+					Locale:   "en",
+					Strength: 2,
+				}),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "foo_1", name)
+
+		// documents missing the field are not indexed
+		_, err = c.InsertMany(nil, bson.A{
+			bson.M{"bar": 1},
+			bson.M{"bar": 2},
+		})
+		assert.NoError(t, err)
+
+		// list
+		csr, err := c.Indexes().List(nil)
+		assert.NoError(t, err)
+		specs := readAll(csr)
+		assert.Len(t, specs, 2)
+		assert.Equal(t, bson.M{"foo": int32(1)}, specs[1]["key"])
+		assert.Equal(t, "foo_1", specs[1]["name"])
+		assert.Equal(t, true, specs[1]["unique"])
+		assert.Equal(t, true, specs[1]["sparse"])
+		assert.Equal(t, "en", specs[1]["collation"].(bson.M)["locale"])
+		assert.Equal(t, int32(2), specs[1]["collation"].(bson.M)["strength"])
+	})
 }
 
 func TestIndexExpiry(t *testing.T) {
@@ -473,3 +593,118 @@ func TestIndexExpiry(t *testing.T) {
 		}, readAll(csr))
 	})
 }
+
+func TestIndexCollation(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		collation := &options.Collation{
+			Locale:   "en",
+			Strength: 2,
+		}
+
+		// case-insensitive unique index
+		name, err := c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys: bson.M{
+				"name": 1,
+			},
+			Options: options.Index().SetUnique(true).SetCollation(collation),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "name_1", name)
+
+		// add documents
+		_, err = c.InsertMany(nil, bson.A{
+			bson.M{"name": "Alice"},
+			bson.M{"name": "bob"},
+			bson.M{"name": "Carol"},
+		})
+		assert.NoError(t, err)
+
+		// duplicate
+		_, err = c.InsertOne(nil, bson.M{"name": "alice"})
+		assert.Error(t, err)
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+
+		names := func(csr ICursor, err error) []interface{} {
+			assert.NoError(t, err)
+			var list []interface{}
+			for _, doc := range readAll(csr) {
+				list = append(list, doc["name"])
+			}
+			return list
+		}
+
+		// case-sensitive find
+		assert.Nil(t, names(c.Find(nil, bson.M{"name": "ALICE"})))
+
+		// case-insensitive find
+		assert.Equal(t, []interface{}{"Alice"}, names(c.Find(nil, bson.M{
+			"name": "ALICE",
+		}, options.Find().SetCollation(collation))))
+		assert.Equal(t, []interface{}{"Alice", "bob"}, names(c.Find(nil, bson.M{
+			"name": bson.M{"$in": bson.A{"aLiCe", "BOB"}},
+		}, options.Find().SetCollation(collation))))
+
+		// case-insensitive find one
+		var doc bson.M
+		err = c.FindOne(nil, bson.M{"name": "CAROL"}, options.FindOne().SetCollation(collation)).Decode(&doc)
+		assert.NoError(t, err)
+		assert.Equal(t, "Carol", doc["name"])
+
+		// case-sensitive sort
+		assert.Equal(t, []interface{}{"Alice", "Carol", "bob"}, names(c.Find(nil, bson.M{}, options.Find().
+			SetSort(bson.M{"name": 1}))))
+
+		// case-insensitive sort
+		assert.Equal(t, []interface{}{"Carol", "bob", "Alice"}, names(c.Find(nil, bson.M{}, options.Find().
+			SetSort(bson.M{"name": -1}).SetCollation(collation))))
+	})
+}
+
+func TestIndexID(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		// create collection
+		_, err := c.InsertOne(nil, bson.M{"_id": "a"})
+		assert.NoError(t, err)
+
+		// recreate id index
+		name, err := c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys:    bson.M{"_id": 1},
+			Options: options.Index().SetName("_id_"),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "_id_", name)
+
+		// reserved name
+		name, err = c.Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys:    bson.M{"foo": 1},
+			Options: options.Index().SetName("_id_"),
+		})
+		assert.Error(t, err)
+		assert.Empty(t, name)
+
+		// drop id index
+		_, err = c.Indexes().DropOne(nil, "_id_")
+		assert.Error(t, err)
+
+		// drop all indexes
+		_, err = c.Indexes().DropAll(nil)
+		assert.NoError(t, err)
+
+		// list
+		csr, err := c.Indexes().List(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{
+				"key": bson.M{
+					"_id": int32(1),
+				},
+				"name": "_id_",
+				"v":    int32(2),
+			},
+		}, readAll(csr))
+
+		// duplicate
+		_, err = c.InsertOne(nil, bson.M{"_id": "a"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,140 @@
+package lungo
+
+import (
+	"sort"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// Info describes the databases, collections and indexes of a catalog.
+type Info struct {
+	// The databases sorted by name.
+	Databases []DatabaseInfo
+
+	// The encoded BSON size of all documents in bytes, excluding the local
+	// database.
+	Size int
+}
+
+// DatabaseInfo describes a database.
+type DatabaseInfo struct {
+	// The name of the database.
+	Name string
+
+	// The encoded BSON size of all documents in bytes.
+	Size int
+
+	// The collections sorted by name.
+	Collections []CollectionInfo
+}
+
+// CollectionInfo describes a collection.
+type CollectionInfo struct {
+	// The handle of the collection.
+	Handle Handle
+
+	// The type of the collection, either "collection" or "timeseries".
+	Type string
+
+	// The number of documents.
+	Documents int
+
+	// The encoded BSON size of all documents in bytes.
+	Size int
+
+	// The indexes sorted by name.
+	Indexes []IndexInfo
+}
+
+// IndexInfo describes an index.
+type IndexInfo struct {
+	// The name of the index.
+	Name string
+
+	// The index specification as returned by IIndexView.List.
+	Spec bsonkit.Doc
+
+	// The number of indexed documents.
+	Entries int
+
+	// The approximate number of bytes used by the index excluding the indexed
+	// documents, which are shared with the collection.
+	Memory int
+}
+
+// Info will return information about all databases, collections and indexes
+// of the current catalog. As the catalog is immutable, the information is
+// consistent across all namespaces.
+func (e *Engine) Info() (*Info, error) {
+	// acquire lock
+	e.mutex.Lock()
+	catalog := e.catalog
+	closed := e.closed
+	e.mutex.Unlock()
+
+	// check if closed
+	if closed {
+		return nil, ErrEngineClosed
+	}
+
+	return BuildInfo(catalog), nil
+}
+
+// BuildInfo will build the information for the specified catalog.
+func BuildInfo(catalog *Catalog) *Info {
+	// group collections by database
+	databases := map[string]*DatabaseInfo{}
+	for handle, namespace := range catalog.Namespaces {
+		// prepare collection
+		coll := CollectionInfo{
+			Handle:    handle,
+			Type:      "collection",
+			Documents: len(namespace.Documents.List),
+			Size:      namespace.Size,
+		}
+		if namespace.Buckets != nil {
+			coll.Type = "timeseries"
+		}
+
+		// add indexes
+		for name, index := range namespace.Indexes {
+			coll.Indexes = append(coll.Indexes, IndexInfo{
+				Name:    name,
+				Spec:    buildIndexSpec(name, index.Config()),
+				Entries: index.Len(),
+				Memory:  index.Memory(),
+			})
+		}
+		sort.Slice(coll.Indexes, func(i, j int) bool {
+			return coll.Indexes[i].Name < coll.Indexes[j].Name
+		})
+
+		// add collection to database
+		db := databases[handle[0]]
+		if db == nil {
+			db = &DatabaseInfo{Name: handle[0]}
+			databases[handle[0]] = db
+		}
+		db.Size += coll.Size
+		db.Collections = append(db.Collections, coll)
+	}
+
+	// prepare info
+	info := &Info{
+		Databases: make([]DatabaseInfo, 0, len(databases)),
+		Size:      catalog.Size(),
+	}
+
+	// add databases
+	for _, db := range databases {
+		sort.Slice(db.Collections, func(i, j int) bool {
+			return db.Collections[i].Handle[1] < db.Collections[j].Handle[1]
+		})
+		info.Databases = append(info.Databases, *db)
+	}
+	sort.Slice(info.Databases, func(i, j int) bool {
+		return info.Databases[i].Name < info.Databases[j].Name
+	})
+
+	return info
+}
@@ -0,0 +1,73 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestEngineInfo(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+
+	db := client.Database("foo")
+
+	_, err = db.Collection("bar").InsertMany(nil, []interface{}{
+		bson.M{"_id": 1, "a": 1},
+		bson.M{"_id": 2},
+	})
+	assert.NoError(t, err)
+
+	_, err = db.Collection("bar").Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys:    bson.M{"a": 1},
+		Options: options.Index().SetSparse(true),
+	})
+	assert.NoError(t, err)
+
+	err = db.CreateCollection(nil, "baz", options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().SetTimeField("time"),
+	))
+	assert.NoError(t, err)
+
+	info, err := engine.Info()
+	assert.NoError(t, err)
+	assert.Len(t, info.Databases, 2)
+	assert.Equal(t, "foo", info.Databases[0].Name)
+	assert.Equal(t, "local", info.Databases[1].Name)
+
+	foo := info.Databases[0]
+	assert.Equal(t, info.Size, foo.Size)
+	assert.Len(t, foo.Collections, 2)
+
+	bar := foo.Collections[0]
+	assert.Equal(t, Handle{"foo", "bar"}, bar.Handle)
+	assert.Equal(t, "collection", bar.Type)
+	assert.Equal(t, 2, bar.Documents)
+	assert.Equal(t, foo.Size, bar.Size)
+	assert.Len(t, bar.Indexes, 2)
+	assert.Equal(t, "_id_", bar.Indexes[0].Name)
+	assert.Equal(t, 2, bar.Indexes[0].Entries)
+	assert.Equal(t, "a_1", bar.Indexes[1].Name)
+	assert.Equal(t, 1, bar.Indexes[1].Entries)
+	assert.True(t, bar.Indexes[0].Memory > 0)
+	assert.True(t, bar.Indexes[1].Memory > 0)
+	assert.Equal(t, true, bsonkit.Get(bar.Indexes[1].Spec, "sparse"))
+
+	baz := foo.Collections[1]
+	assert.Equal(t, Handle{"foo", "baz"}, baz.Handle)
+	assert.Equal(t, "timeseries", baz.Type)
+	assert.Equal(t, 0, baz.Documents)
+
+	engine.Close()
+
+	info, err = engine.Info()
+	assert.Equal(t, ErrEngineClosed, err)
+	assert.Nil(t, info)
+}
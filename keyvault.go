@@ -0,0 +1,437 @@
+package lungo
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The algorithms supported by ClientEncryption.Encrypt.
+const (
+	AlgorithmDeterministic = "AEAD_AES_256_CBC_HMAC_SHA_512-Deterministic"
+	AlgorithmRandom        = "AEAD_AES_256_CBC_HMAC_SHA_512-Random"
+)
+
+// ClientEncryption provides the explicit encryption API of the official driver
+// without requiring libmongocrypt. Data keys are stored in the key vault
+// namespace of the provided client and protected by the master key of the
+// "local" KMS provider. Values are encrypted using the AEAD AES-256-CBC
+// HMAC-SHA-512 algorithms and returned as binary values with the subtype
+// EncryptedSubtype.
+type ClientEncryption struct {
+	engine    *Engine
+	keyVault  ICollection
+	masterKey []byte
+	keys      map[string][]byte
+	mutex     sync.Mutex
+}
+
+// NewClientEncryption will create and return a new client encryption that uses
+// the key vault namespace of the provided client. Only the "local" KMS provider
+// with a 96-byte master key is supported.
+func NewClientEncryption(client IClient, opts ...*options.ClientEncryptionOptions) (*ClientEncryption, error) {
+	// get engine
+	var engine *Engine
+	if c, ok := client.(*Client); ok {
+		engine = c.engine
+	}
+
+	// merge options
+	opt := options.MergeClientEncryptionOptions(opts...)
+
+	// assert supported options
+	err := assertOptions(engine, "NewClientEncryption", opt, map[string]string{
+		"KeyVaultNamespace": supported,
+		"KmsProviders":      supported,
+		"TLSConfig":         ignored,
+		"HTTPClient":        ignored,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// get key vault namespace
+	handle, ok := parseNamespace(opt.KeyVaultNamespace)
+	if !ok {
+		return nil, fmt.Errorf("invalid key vault namespace %q", opt.KeyVaultNamespace)
+	}
+
+	// check providers
+	for name := range opt.KmsProviders {
+		if name != "local" {
+			return nil, fmt.Errorf("unsupported KMS provider %q", name)
+		}
+	}
+
+	// get master key
+	var masterKey []byte
+	switch key := opt.KmsProviders["local"]["key"].(type) {
+	case []byte:
+		masterKey = key
+	case primitive.Binary:
+		masterKey = key.Data
+	case string:
+		masterKey, err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local master key: %w", err)
+		}
+	}
+	if len(masterKey) != 96 {
+		return nil, fmt.Errorf("expected a 96-byte local master key")
+	}
+
+	return &ClientEncryption{
+		engine:    engine,
+		keyVault:  client.Database(handle[0]).Collection(handle[1]),
+		masterKey: masterKey,
+		keys:      map[string][]byte{},
+	}, nil
+}
+
+// CreateDataKey will create a new data key in the key vault and return its ID.
+func (e *ClientEncryption) CreateDataKey(ctx context.Context, kmsProvider string, opts ...*options.DataKeyOptions) (primitive.Binary, error) {
+	// merge options
+	opt := options.MergeDataKeyOptions(opts...)
+
+	// assert supported options
+	err := assertOptions(e.engine, "ClientEncryption.CreateDataKey", opt, map[string]string{
+		"KeyAltNames": supported,
+		"KeyMaterial": supported,
+	})
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+
+	// check provider
+	if kmsProvider != "local" {
+		return primitive.Binary{}, fmt.Errorf("unsupported KMS provider %q", kmsProvider)
+	}
+
+	// get or generate key material
+	material := opt.KeyMaterial
+	if material == nil {
+		material, err = randomBytes(96)
+		if err != nil {
+			return primitive.Binary{}, err
+		}
+	} else if len(material) != 96 {
+		return primitive.Binary{}, fmt.Errorf("expected 96 bytes of key material")
+	}
+
+	// encrypt key material
+	iv, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+	encrypted := encryptAEAD(e.masterKey, iv, nil, material)
+
+	// generate key ID
+	id, err := randomBytes(16)
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	keyID := primitive.Binary{Subtype: bsontype.BinaryUUID, Data: id}
+
+	// prepare document
+	now := primitive.NewDateTimeFromTime(time.Now())
+	doc := bson.D{
+		{Key: "_id", Value: keyID},
+		{Key: "keyMaterial", Value: primitive.Binary{Data: encrypted}},
+		{Key: "creationDate", Value: now},
+		{Key: "updateDate", Value: now},
+		{Key: "status", Value: int32(0)},
+		{Key: "masterKey", Value: bson.D{{Key: "provider", Value: "local"}}},
+	}
+	if len(opt.KeyAltNames) > 0 {
+		doc = append(doc, bson.E{Key: "keyAltNames", Value: opt.KeyAltNames})
+	}
+
+	// insert data key
+	_, err = e.keyVault.InsertOne(ctx, doc)
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+
+	// cache key
+	e.mutex.Lock()
+	e.keys[string(id)] = material
+	e.mutex.Unlock()
+
+	return keyID, nil
+}
+
+// Encrypt will encrypt the value using the data key identified by the KeyID or
+// KeyAltName option and the algorithm specified by the Algorithm option.
+func (e *ClientEncryption) Encrypt(ctx context.Context, val bson.RawValue, opts ...*options.EncryptOptions) (primitive.Binary, error) {
+	// merge options
+	opt := options.MergeEncryptOptions(opts...)
+
+	// assert supported options
+	err := assertOptions(e.engine, "ClientEncryption.Encrypt", opt, map[string]string{
+		"KeyID":      supported,
+		"KeyAltName": supported,
+		"Algorithm":  supported,
+	})
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+
+	// get algorithm
+	var algorithm byte
+	switch opt.Algorithm {
+	case AlgorithmDeterministic:
+		algorithm = 1
+	case AlgorithmRandom:
+		algorithm = 2
+	default:
+		return primitive.Binary{}, fmt.Errorf("unsupported algorithm %q", opt.Algorithm)
+	}
+
+	// check type
+	switch val.Type {
+	case bsontype.Null, bsontype.Undefined, bsontype.MinKey, bsontype.MaxKey:
+		return primitive.Binary{}, fmt.Errorf("cannot encrypt value of type %s", val.Type)
+	case bsontype.Double, bsontype.Decimal128, bsontype.EmbeddedDocument, bsontype.Array, bsontype.CodeWithScope, bsontype.Boolean:
+		if algorithm == 1 {
+			return primitive.Binary{}, fmt.Errorf("cannot deterministically encrypt value of type %s", val.Type)
+		}
+	}
+
+	// get filter
+	var filter bson.D
+	switch {
+	case opt.KeyID != nil && opt.KeyAltName != nil:
+		return primitive.Binary{}, fmt.Errorf("expected either KeyID or KeyAltName")
+	case opt.KeyID != nil:
+		filter = bson.D{{Key: "_id", Value: *opt.KeyID}}
+	case opt.KeyAltName != nil:
+		filter = bson.D{{Key: "keyAltNames", Value: *opt.KeyAltName}}
+	default:
+		return primitive.Binary{}, fmt.Errorf("expected KeyID or KeyAltName")
+	}
+
+	// get data key
+	id, key, err := e.dataKey(ctx, filter)
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+
+	// prepare associated data
+	ad := append(append([]byte{algorithm}, id...), byte(val.Type))
+
+	// get IV
+	var iv []byte
+	if algorithm == 1 {
+		iv = deterministicIV(key, ad, val.Value)
+	} else {
+		iv, err = randomBytes(aes.BlockSize)
+		if err != nil {
+			return primitive.Binary{}, err
+		}
+	}
+
+	// encrypt value
+	ciphertext := encryptAEAD(key, iv, ad, val.Value)
+
+	return primitive.Binary{
+		Subtype: EncryptedSubtype,
+		Data:    append(ad, ciphertext...),
+	}, nil
+}
+
+// Decrypt will decrypt a value that has been encrypted using Encrypt.
+func (e *ClientEncryption) Decrypt(ctx context.Context, val primitive.Binary) (bson.RawValue, error) {
+	// check value
+	if val.Subtype != EncryptedSubtype || len(val.Data) < 18 || (val.Data[0] != 1 && val.Data[0] != 2) {
+		return bson.RawValue{}, fmt.Errorf("invalid encrypted value")
+	}
+
+	// get associated data
+	ad := val.Data[:18]
+	id := ad[1:17]
+
+	// get data key
+	_, key, err := e.dataKey(ctx, bson.D{
+		{Key: "_id", Value: primitive.Binary{Subtype: bsontype.BinaryUUID, Data: id}},
+	})
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	// decrypt value
+	plaintext, err := decryptAEAD(key, ad, val.Data[18:])
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	return bson.RawValue{
+		Type:  bsontype.Type(ad[17]),
+		Value: plaintext,
+	}, nil
+}
+
+// Close will release the cached data keys.
+func (e *ClientEncryption) Close(context.Context) error {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// clear keys
+	e.keys = map[string][]byte{}
+
+	return nil
+}
+
+func (e *ClientEncryption) dataKey(ctx context.Context, filter bson.D) ([]byte, []byte, error) {
+	// check cache
+	if id, ok := filter[0].Value.(primitive.Binary); ok && filter[0].Key == "_id" {
+		e.mutex.Lock()
+		key, ok := e.keys[string(id.Data)]
+		e.mutex.Unlock()
+		if ok {
+			return id.Data, key, nil
+		}
+	}
+
+	// find data key
+	var doc struct {
+		ID          primitive.Binary `bson:"_id"`
+		KeyMaterial primitive.Binary `bson:"keyMaterial"`
+		MasterKey   struct {
+			Provider string `bson:"provider"`
+		} `bson:"masterKey"`
+	}
+	err := e.keyVault.FindOne(ctx, filter).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, fmt.Errorf("data key not found")
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// check provider
+	if doc.MasterKey.Provider != "local" {
+		return nil, nil, fmt.Errorf("unsupported KMS provider %q", doc.MasterKey.Provider)
+	}
+
+	// decrypt key material
+	key, err := decryptAEAD(e.masterKey, nil, doc.KeyMaterial.Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decrypt data key: %w", err)
+	} else if len(key) != 96 {
+		return nil, nil, fmt.Errorf("invalid data key")
+	}
+
+	// cache key
+	e.mutex.Lock()
+	e.keys[string(doc.ID.Data)] = key
+	e.mutex.Unlock()
+
+	return doc.ID.Data, key, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	// read random bytes
+	buf := make([]byte, n)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func deterministicIV(key, ad, plaintext []byte) []byte {
+	// derive IV from associated data and plaintext
+	mac := hmac.New(sha512.New, key[64:96])
+	mac.Write(ad)
+	mac.Write(adLength(ad))
+	mac.Write(plaintext)
+
+	return mac.Sum(nil)[:aes.BlockSize]
+}
+
+func encryptAEAD(key, iv, ad, plaintext []byte) []byte {
+	// create cipher
+	block, err := aes.NewCipher(key[32:64])
+	if err != nil {
+		panic(err)
+	}
+
+	// pad plaintext (PKCS#7)
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	// encrypt plaintext
+	ciphertext := make([]byte, aes.BlockSize+len(padded))
+	copy(ciphertext, iv)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext[aes.BlockSize:], padded)
+
+	return append(ciphertext, aeadTag(key[:32], ad, ciphertext)...)
+}
+
+func decryptAEAD(key, ad, data []byte) ([]byte, error) {
+	// check length
+	if len(data) < 2*aes.BlockSize+32 || (len(data)-32)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+
+	// verify tag
+	ciphertext, tag := data[:len(data)-32], data[len(data)-32:]
+	if !hmac.Equal(tag, aeadTag(key[:32], ad, ciphertext)) {
+		return nil, fmt.Errorf("authentication failed")
+	}
+
+	// create cipher
+	block, err := aes.NewCipher(key[32:64])
+	if err != nil {
+		return nil, err
+	}
+
+	// decrypt ciphertext
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, ciphertext[:aes.BlockSize]).CryptBlocks(plaintext, ciphertext[aes.BlockSize:])
+
+	// remove padding
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+func aeadTag(key, ad, ciphertext []byte) []byte {
+	// compute tag
+	mac := hmac.New(sha512.New, key)
+	mac.Write(ad)
+	mac.Write(ciphertext)
+	mac.Write(adLength(ad))
+
+	return mac.Sum(nil)[:32]
+}
+
+func adLength(ad []byte) []byte {
+	// encode length in bits
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(len(ad))*8)
+
+	return buf
+}
@@ -0,0 +1,130 @@
+package lungo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestClientEncryption(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	masterKey := bytes.Repeat([]byte{0x42}, 96)
+	opts := options.ClientEncryption().
+		SetKeyVaultNamespace("encryption.__keyVault").
+		SetKmsProviders(map[string]map[string]interface{}{
+			"local": {"key": masterKey},
+		})
+
+	ce, err := NewClientEncryption(client, opts)
+	assert.NoError(t, err)
+
+	keyID, err := ce.CreateDataKey(nil, "local", options.DataKey().SetKeyAltNames([]string{"foo"}))
+	assert.NoError(t, err)
+	assert.Equal(t, bsontype.BinaryUUID, keyID.Subtype)
+	assert.Len(t, keyID.Data, 16)
+
+	var key bson.M
+	err = client.Database("encryption").Collection("__keyVault").FindOne(nil, bson.M{}).Decode(&key)
+	assert.NoError(t, err)
+	assert.Equal(t, keyID, key["_id"])
+	assert.Equal(t, bson.A{"foo"}, key["keyAltNames"])
+	assert.Equal(t, bson.M{"provider": "local"}, key["masterKey"])
+
+	typ, data, err := bson.MarshalValue("secret")
+	assert.NoError(t, err)
+	value := bson.RawValue{Type: typ, Value: data}
+
+	/* deterministic */
+
+	enc1, err := ce.Encrypt(nil, value, options.Encrypt().SetKeyID(keyID).SetAlgorithm(AlgorithmDeterministic))
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptedSubtype, enc1.Subtype)
+	assert.NotContains(t, string(enc1.Data), "secret")
+
+	enc2, err := ce.Encrypt(nil, value, options.Encrypt().SetKeyAltName("foo").SetAlgorithm(AlgorithmDeterministic))
+	assert.NoError(t, err)
+	assert.Equal(t, enc1, enc2)
+
+	dec, err := ce.Decrypt(nil, enc1)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", dec.StringValue())
+
+	/* random */
+
+	enc3, err := ce.Encrypt(nil, value, options.Encrypt().SetKeyID(keyID).SetAlgorithm(AlgorithmRandom))
+	assert.NoError(t, err)
+	assert.NotEqual(t, enc1, enc3)
+
+	dec, err = ce.Decrypt(nil, enc3)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", dec.StringValue())
+
+	typ, data, err = bson.MarshalValue(bson.M{"foo": 4.2})
+	assert.NoError(t, err)
+	doc := bson.RawValue{Type: typ, Value: data}
+
+	_, err = ce.Encrypt(nil, doc, options.Encrypt().SetKeyID(keyID).SetAlgorithm(AlgorithmDeterministic))
+	assert.Error(t, err)
+
+	enc4, err := ce.Encrypt(nil, doc, options.Encrypt().SetKeyID(keyID).SetAlgorithm(AlgorithmRandom))
+	assert.NoError(t, err)
+
+	dec, err = ce.Decrypt(nil, enc4)
+	assert.NoError(t, err)
+	assert.Equal(t, 4.2, dec.Document().Lookup("foo").Double())
+
+	/* key vault */
+
+	err = ce.Close(nil)
+	assert.NoError(t, err)
+
+	ce, err = NewClientEncryption(client, opts)
+	assert.NoError(t, err)
+
+	dec, err = ce.Decrypt(nil, enc1)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", dec.StringValue())
+
+	wrong, err := NewClientEncryption(client, options.ClientEncryption().
+		SetKeyVaultNamespace("encryption.__keyVault").
+		SetKmsProviders(map[string]map[string]interface{}{
+			"local": {"key": bytes.Repeat([]byte{0x24}, 96)},
+		}))
+	assert.NoError(t, err)
+
+	_, err = wrong.Decrypt(nil, enc1)
+	assert.Error(t, err)
+
+	/* errors */
+
+	tampered := primitive.Binary{Subtype: enc1.Subtype, Data: append([]byte{}, enc1.Data...)}
+	tampered.Data[len(tampered.Data)-1] ^= 0xff
+	_, err = ce.Decrypt(nil, tampered)
+	assert.Error(t, err)
+
+	_, err = ce.Encrypt(nil, value, options.Encrypt().SetKeyAltName("bar").SetAlgorithm(AlgorithmRandom))
+	assert.Error(t, err)
+
+	_, err = ce.Encrypt(nil, value, options.Encrypt().SetKeyID(keyID))
+	assert.Error(t, err)
+
+	_, err = ce.CreateDataKey(nil, "aws")
+	assert.Error(t, err)
+
+	_, err = NewClientEncryption(client, options.ClientEncryption().
+		SetKeyVaultNamespace("encryption.__keyVault").
+		SetKmsProviders(map[string]map[string]interface{}{
+			"local": {"key": []byte("short")},
+		}))
+	assert.Error(t, err)
+}
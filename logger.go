@@ -0,0 +1,92 @@
+package lungo
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel is the severity of a log entry.
+type LogLevel int
+
+// The available log levels.
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+// String will return the name of the level.
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// Logger receives diagnostic messages from an engine. The fields are provided
+// as alternating keys and values.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...interface{})
+}
+
+// StdLogger returns a logger that writes entries with the specified or a higher
+// level to the provided standard library logger. If no logger is provided, the
+// standard logger of the log package is used.
+func StdLogger(logger *log.Logger, level LogLevel) Logger {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return &stdLogger{logger: logger, level: level}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+	level  LogLevel
+}
+
+func (l *stdLogger) Log(level LogLevel, msg string, fields ...interface{}) {
+	// check level
+	if level < l.level {
+		return
+	}
+
+	// format entry
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "lungo: [%s] %s", level, msg)
+	for i := 0; i < len(fields); i += 2 {
+		var value interface{} = "<missing>"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		_, _ = fmt.Fprintf(&b, " %v=%v", fields[i], value)
+	}
+
+	// write entry
+	l.logger.Print(b.String())
+}
+
+var defaultLogger = StdLogger(nil, LogWarn)
+
+func (e *Engine) log(level LogLevel, msg string, fields ...interface{}) {
+	// get logger, the default logger is used without an engine
+	logger := defaultLogger
+	if e != nil {
+		logger = e.opts.Logger
+	}
+
+	// log entry
+	if logger != nil {
+		logger.Log(level, msg, fields...)
+	}
+}
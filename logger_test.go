@@ -0,0 +1,115 @@
+package lungo
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type testLogger struct {
+	entries []string
+	mutex   sync.Mutex
+}
+
+func (l *testLogger) Log(level LogLevel, msg string, fields ...interface{}) {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// format entry
+	entry := fmt.Sprintf("%s: %s", level, msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		entry += fmt.Sprintf(" %v=%v", fields[i], fields[i+1])
+	}
+
+	l.entries = append(l.entries, entry)
+}
+
+func (l *testLogger) list() []string {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]string{}, l.entries...)
+}
+
+func TestLogLevel(t *testing.T) {
+	assert.Equal(t, "debug", LogDebug.String())
+	assert.Equal(t, "info", LogInfo.String())
+	assert.Equal(t, "warn", LogWarn.String())
+	assert.Equal(t, "error", LogError.String())
+	assert.Equal(t, "level(7)", LogLevel(7).String())
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := StdLogger(log.New(&buf, "", 0), LogInfo)
+
+	logger.Log(LogDebug, "foo")
+	logger.Log(LogInfo, "bar", "a", 1, "b")
+	logger.Log(LogError, "baz", "c", "d")
+	assert.Equal(t, "lungo: [info] bar a=1 b=<missing>\nlungo: [error] baz c=d\n", buf.String())
+}
+
+func TestLoggerIgnoredOptions(t *testing.T) {
+	logger := &testLogger{}
+	client, engine, err := Open(nil, Options{
+		Store:  NewMemoryStore(),
+		Logger: logger,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.Find(nil, bson.M{}, options.Find().SetBatchSize(10).SetLimit(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"debug: ignoring option operation=Collection.Find option=BatchSize",
+	}, logger.list())
+}
+
+func TestLoggerSlowOperations(t *testing.T) {
+	logger := &testLogger{}
+	client, engine, err := Open(nil, Options{
+		Store:                  NewMemoryStore(),
+		Logger:                 logger,
+		SlowOperationThreshold: time.Nanosecond,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"a": 1}, options.InsertOne().SetComment("hello"))
+	assert.NoError(t, err)
+
+	entries := logger.list()
+	assert.Len(t, entries, 1)
+	assert.Regexp(t, `^warn: slow operation command=insert ns=foo.bar duration=\S+ comment=hello lsid=[0-9a-f-]{36}$`, entries[0])
+}
+
+func TestLoggerExpiry(t *testing.T) {
+	logger := &testLogger{}
+	client, engine, err := Open(nil, Options{
+		Store:          NewMemoryStore(),
+		Logger:         logger,
+		ExpireInterval: time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"a": 1})
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	engine.Close()
+
+	entries := logger.list()
+	assert.NotEmpty(t, entries)
+	assert.Regexp(t, `^debug: expiry completed duration=\S+$`, entries[0])
+}
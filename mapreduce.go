@@ -0,0 +1,187 @@
+package lungo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// MapReducer provides the Go functions used to emulate the JavaScript
+// functions of a mapReduce command.
+type MapReducer struct {
+	// The function called for every matched document. It may emit any number
+	// of key value pairs.
+	Map func(doc bsonkit.Doc, emit func(key, value interface{})) error
+
+	// The function called with all values emitted for a key. It is only
+	// called for keys with more than one value.
+	Reduce func(key interface{}, values []interface{}) (interface{}, error)
+
+	// The optional function called with the final value of every key.
+	Finalize func(key, value interface{}) (interface{}, error)
+}
+
+// RegisterMapReducer will register the map reducer under the specified name.
+// A mapReduce command issued using Database.RunCommand uses the map reducer
+// that is registered under the value of its "map" field. The name may be the
+// JavaScript source of the map function to support existing commands without
+// changes.
+func (e *Engine) RegisterMapReducer(name string, mr MapReducer) {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// set map reducer
+	if e.reducers == nil {
+		e.reducers = map[string]MapReducer{}
+	}
+	e.reducers[name] = mr
+}
+
+func (e *Engine) mapReducer(name string) (MapReducer, bool) {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// get map reducer
+	mr, ok := e.reducers[name]
+
+	return mr, ok
+}
+
+type emitted struct {
+	key   interface{}
+	value interface{}
+}
+
+func (d *Database) mapReduce(ctx context.Context, cmd bsonkit.Doc) (bsonkit.Doc, error) {
+	// get collection
+	coll, ok := bsonkit.Get(cmd, "mapReduce").(string)
+	if !ok || coll == "" {
+		return nil, fmt.Errorf("mapReduce: expected collection name")
+	}
+
+	// get name
+	name, ok := functionName(bsonkit.Get(cmd, "map"))
+	if !ok {
+		return nil, fmt.Errorf("mapReduce: expected map function")
+	}
+
+	// get map reducer
+	mr, ok := d.engine.mapReducer(name)
+	if !ok || mr.Map == nil || mr.Reduce == nil {
+		return nil, fmt.Errorf("mapReduce: no map reducer registered for %q", name)
+	}
+
+	// check output
+	out, ok := bsonkit.Get(cmd, "out").(bson.D)
+	if !ok || len(out) != 1 || out[0].Key != "inline" {
+		return nil, fmt.Errorf("mapReduce: only inline output is supported")
+	}
+
+	// get query
+	var query bsonkit.Doc
+	if doc, ok := bsonkit.Get(cmd, "query").(bson.D); ok {
+		query = &doc
+	} else {
+		query = &bson.D{}
+	}
+
+	// get sort
+	var sorting bsonkit.Doc
+	if doc, ok := bsonkit.Get(cmd, "sort").(bson.D); ok {
+		sorting = &doc
+	}
+
+	// get limit
+	var limit int
+	if num, ok := bsonkit.Get(cmd, "limit").(int32); ok {
+		limit = int(num)
+	} else if num, ok := bsonkit.Get(cmd, "limit").(int64); ok {
+		limit = int(num)
+	}
+
+	// find documents
+	res, err := useTransaction(ctx, d.engine, false, func(txn *Transaction) (interface{}, error) {
+		return txn.Find(Handle{d.name, coll}, query, sorting, 0, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// map documents
+	var pairs []emitted
+	emit := func(key, value interface{}) {
+		pairs = append(pairs, emitted{key: key, value: value})
+	}
+	for _, doc := range res.(*Result).Matched {
+		err = mr.Map(bsonkit.Clone(doc), emit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// sort pairs by key
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return bsonkit.Compare(pairs[i].key, pairs[j].key) < 0
+	})
+
+	// reduce groups
+	results := bson.A{}
+	for i := 0; i < len(pairs); {
+		// get key
+		key := pairs[i].key
+
+		// collect values
+		var values []interface{}
+		for ; i < len(pairs) && bsonkit.Compare(pairs[i].key, key) == 0; i++ {
+			values = append(values, pairs[i].value)
+		}
+
+		// reduce values
+		value := values[0]
+		if len(values) > 1 {
+			value, err = mr.Reduce(key, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// finalize value
+		if mr.Finalize != nil {
+			value, err = mr.Finalize(key, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// add result
+		results = append(results, bson.D{
+			{Key: "_id", Value: key},
+			{Key: "value", Value: value},
+		})
+	}
+
+	return &bson.D{
+		{Key: "results", Value: results},
+		{Key: "ok", Value: 1.0},
+	}, nil
+}
+
+func functionName(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, value != ""
+	case primitive.JavaScript:
+		return string(value), value != ""
+	case primitive.CodeWithScope:
+		return string(value.Code), value.Code != ""
+	default:
+		return "", false
+	}
+}
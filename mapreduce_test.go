@@ -0,0 +1,146 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+const mapFunc = "function() { emit(this.tag, this.qty); }"
+const reduceFunc = "function(key, values) { return Array.sum(values); }"
+
+func TestDatabaseRunCommandMapReduce(t *testing.T) {
+	databaseTest(t, func(t *testing.T, d IDatabase) {
+		if db, ok := d.(*Database); ok {
+			db.engine.RegisterMapReducer(mapFunc, MapReducer{
+				Map: func(doc bsonkit.Doc, emit func(key, value interface{})) error {
+					emit(bsonkit.Get(doc, "tag"), float64(bsonkit.Get(doc, "qty").(int32)))
+					return nil
+				},
+				Reduce: func(key interface{}, values []interface{}) (interface{}, error) {
+					var sum float64
+					for _, value := range values {
+						sum += value.(float64)
+					}
+					return sum, nil
+				},
+			})
+		}
+
+		name := collectionName()
+		coll := d.Collection(name)
+		_, err := coll.InsertMany(nil, bson.A{
+			bson.M{"_id": int32(1), "tag": "b", "qty": int32(2)},
+			bson.M{"_id": int32(2), "tag": "a", "qty": int32(3)},
+			bson.M{"_id": int32(3), "tag": "b", "qty": int32(4)},
+			bson.M{"_id": int32(4), "tag": "c", "qty": int32(5)},
+		})
+		assert.NoError(t, err)
+
+		var res bson.M
+		err = d.RunCommand(nil, bson.D{
+			{Key: "mapReduce", Value: name},
+			{Key: "map", Value: primitive.JavaScript(mapFunc)},
+			{Key: "reduce", Value: primitive.JavaScript(reduceFunc)},
+			{Key: "out", Value: bson.M{"inline": 1}},
+		}).Decode(&res)
+		assert.NoError(t, err)
+		assert.Equal(t, bson.A{
+			bson.M{"_id": "a", "value": 3.0},
+			bson.M{"_id": "b", "value": 6.0},
+			bson.M{"_id": "c", "value": 5.0},
+		}, res["results"])
+		assert.Equal(t, 1.0, res["ok"])
+
+		res = nil
+		err = d.RunCommand(nil, bson.D{
+			{Key: "mapReduce", Value: name},
+			{Key: "map", Value: primitive.JavaScript(mapFunc)},
+			{Key: "reduce", Value: primitive.JavaScript(reduceFunc)},
+			{Key: "out", Value: bson.M{"inline": 1}},
+			{Key: "query", Value: bson.M{"qty": bson.M{"$gt": 2}}},
+			{Key: "sort", Value: bson.M{"_id": -1}},
+			{Key: "limit", Value: 2},
+		}).Decode(&res)
+		assert.NoError(t, err)
+		assert.Equal(t, bson.A{
+			bson.M{"_id": "b", "value": 4.0},
+			bson.M{"_id": "c", "value": 5.0},
+		}, res["results"])
+
+		err = d.RunCommand(nil, bson.D{
+			{Key: "mapReduce", Value: name},
+			{Key: "map", Value: primitive.JavaScript(mapFunc)},
+			{Key: "reduce", Value: primitive.JavaScript(reduceFunc)},
+			{Key: "out", Value: "bar"},
+		}).Err()
+		assert.Error(t, err)
+
+		if _, ok := d.(*Database); ok {
+			err = d.RunCommand(nil, bson.D{
+				{Key: "mapReduce", Value: name},
+				{Key: "map", Value: "unknown"},
+				{Key: "reduce", Value: "unknown"},
+				{Key: "out", Value: bson.M{"inline": 1}},
+			}).Err()
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestEngineRegisterMapReducerFinalize(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	engine.RegisterMapReducer("count", MapReducer{
+		Map: func(doc bsonkit.Doc, emit func(key, value interface{})) error {
+			for _, tag := range bsonkit.Get(doc, "tags").(bson.A) {
+				emit(tag, int64(1))
+			}
+			return nil
+		},
+		Reduce: func(key interface{}, values []interface{}) (interface{}, error) {
+			return int64(len(values)), nil
+		},
+		Finalize: func(key, value interface{}) (interface{}, error) {
+			return bson.M{"count": value}, nil
+		},
+	})
+
+	db := client.Database("test")
+	_, err = db.Collection("foo").InsertMany(nil, bson.A{
+		bson.M{"tags": bson.A{"x", int32(7)}},
+		bson.M{"tags": bson.A{"x", "y"}},
+	})
+	assert.NoError(t, err)
+
+	var res bson.M
+	err = db.RunCommand(nil, bson.D{
+		{Key: "mapReduce", Value: "foo"},
+		{Key: "map", Value: "count"},
+		{Key: "reduce", Value: "count"},
+		{Key: "out", Value: bson.M{"inline": 1}},
+	}).Decode(&res)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.A{
+		bson.M{"_id": int32(7), "value": bson.M{"count": int64(1)}},
+		bson.M{"_id": "x", "value": bson.M{"count": int64(2)}},
+		bson.M{"_id": "y", "value": bson.M{"count": int64(1)}},
+	}, res["results"])
+
+	err = db.RunCommand(nil, bson.D{
+		{Key: "mapReduce", Value: "bar"},
+		{Key: "map", Value: "count"},
+		{Key: "reduce", Value: "count"},
+		{Key: "out", Value: bson.M{"inline": 1}},
+	}).Decode(&res)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.A{}, res["results"])
+}
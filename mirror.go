@@ -0,0 +1,233 @@
+package lungo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// Mirror will copy the documents and index specifications of the specified
+// collections from the source client (e.g. a MongoDB deployment connected
+// using Connect) into the engine. Existing namespaces in the engine are
+// replaced. If follow is true, the function continues to apply the changes
+// received from a change stream on the source until the context is cancelled
+// or an error occurs. The change stream is opened before the collections are
+// copied so that no changes are missed.
+func Mirror(ctx context.Context, source IClient, engine *Engine, handles []Handle, follow bool) error {
+	// ensure context
+	ctx = ensureContext(ctx)
+
+	// validate handles
+	for _, handle := range handles {
+		err := handle.Validate(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	// open change stream
+	var stream IChangeStream
+	if follow {
+		var err error
+		stream, err = source.Watch(ctx, bson.A{
+			*namespaceFilter(handles),
+		}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+		if err != nil {
+			return err
+		}
+
+		// ensure close
+		defer stream.Close(context.Background())
+	}
+
+	// begin transaction
+	txn, err := engine.Begin(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	// ensure abortion
+	defer engine.Abort(txn)
+
+	// copy collections
+	for _, handle := range handles {
+		err = mirrorCollection(ctx, source, txn, handle)
+		if err != nil {
+			return err
+		}
+	}
+
+	// commit transaction
+	err = engine.Commit(txn)
+	if err != nil {
+		return err
+	}
+
+	// check follow
+	if !follow {
+		return nil
+	}
+
+	// apply changes
+	for stream.Next(ctx) {
+		// decode event
+		var event bson.D
+		err = stream.Decode(&event)
+		if err != nil {
+			return err
+		}
+
+		// apply event
+		err = mirrorEvent(ctx, engine, &event)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check context
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return stream.Err()
+}
+
+func mirrorCollection(ctx context.Context, source IClient, txn *Transaction, handle Handle) error {
+	// get collection
+	coll := source.Database(handle[0]).Collection(handle[1])
+
+	// find documents
+	csr, err := coll.Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+
+	// decode documents
+	var docs []bson.D
+	err = csr.All(ctx, &docs)
+	if err != nil {
+		return err
+	}
+
+	// list indexes
+	csr, err = coll.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	// decode indexes
+	var specs []bson.D
+	err = csr.All(ctx, &specs)
+	if err != nil {
+		return err
+	}
+
+	// replace namespace
+	err = txn.Drop(handle)
+	if err != nil {
+		return err
+	}
+	err = txn.Create(handle)
+	if err != nil {
+		return err
+	}
+
+	// insert documents
+	if len(docs) > 0 {
+		list := make(bsonkit.List, 0, len(docs))
+		for i := range docs {
+			list = append(list, &docs[i])
+		}
+		res, err := txn.Insert(handle, list, true)
+		if err != nil {
+			return err
+		} else if res.Error != nil {
+			return res.Error
+		}
+	}
+
+	// create indexes
+	for i := range specs {
+		// parse spec
+		name, config, err := parseIndexSpec(&specs[i])
+		if err != nil {
+			return err
+		}
+
+		// skip default index
+		if name == "_id_" {
+			continue
+		}
+
+		// create index
+		_, err = txn.CreateIndex(handle, name, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mirrorEvent(ctx context.Context, engine *Engine, event bsonkit.Doc) error {
+	// get details
+	opType, _ := bsonkit.Get(event, "operationType").(string)
+	nsDB, _ := bsonkit.Get(event, "ns.db").(string)
+	nsColl, _ := bsonkit.Get(event, "ns.coll").(string)
+	handle := Handle{nsDB, nsColl}
+
+	// prepare query
+	query := bsonkit.MustConvert(bson.M{
+		"_id": bsonkit.Get(event, "documentKey._id"),
+	})
+
+	// begin transaction
+	txn, err := engine.Begin(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	// ensure abortion
+	defer engine.Abort(txn)
+
+	// apply event
+	switch opType {
+	case "insert", "replace", "update":
+		// get document, which is missing for updates of documents that have
+		// been deleted in the meantime
+		doc, ok := bsonkit.Get(event, "fullDocument").(bson.D)
+		if !ok {
+			return nil
+		}
+
+		// upsert document
+		_, err = txn.Replace(handle, query, nil, &doc, true)
+	case "delete":
+		_, err = txn.Delete(handle, query, nil, 0, 0)
+	case "drop":
+		err = txn.Drop(handle)
+	case "rename":
+		toDB, _ := bsonkit.Get(event, "to.db").(string)
+		toColl, _ := bsonkit.Get(event, "to.coll").(string)
+		err = txn.Rename(handle, Handle{toDB, toColl}, true)
+	case "dropDatabase", "invalidate":
+		return nil
+	default:
+		return fmt.Errorf("unsupported change stream event %q", opType)
+	}
+	if err != nil {
+		return err
+	}
+
+	// commit transaction
+	err = engine.Commit(txn)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package lungo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMirror(t *testing.T) {
+	source, sourceEngine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer sourceEngine.Close()
+
+	target, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	sourceColl := source.Database("foo").Collection("bar")
+	targetColl := target.Database("foo").Collection("bar")
+
+	_, err = sourceColl.InsertMany(nil, []interface{}{
+		bson.M{"_id": "a", "n": 1},
+		bson.M{"_id": "b", "n": 2},
+	})
+	assert.NoError(t, err)
+
+	_, err = sourceColl.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys:    bson.D{{Key: "n", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	assert.NoError(t, err)
+
+	_, err = source.Database("foo").Collection("baz").InsertOne(nil, bson.M{"_id": "c"})
+	assert.NoError(t, err)
+
+	_, err = targetColl.InsertOne(nil, bson.M{"_id": "x"})
+	assert.NoError(t, err)
+
+	err = Mirror(nil, source, engine, []Handle{{"foo", "bar"}}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": "a", "n": int32(1)},
+		{"_id": "b", "n": int32(2)},
+	}, dumpCollection(targetColl, false))
+	csr, err := targetColl.Indexes().List(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"key": bson.M{"_id": int32(1)}, "name": "_id_", "v": int32(2)},
+		{"key": bson.M{"n": int32(1)}, "name": "n_1", "unique": true, "v": int32(2)},
+	}, readAll(csr))
+
+	names, err := target.Database("foo").ListCollectionNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bar"}, names)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Mirror(ctx, source, engine, []Handle{{"foo", "bar"}}, true)
+	}()
+
+	_, err = sourceColl.InsertOne(nil, bson.M{"_id": "c", "n": 3})
+	assert.NoError(t, err)
+
+	_, err = sourceColl.UpdateOne(nil, bson.M{"_id": "a"}, bson.M{"$set": bson.M{"n": 4}})
+	assert.NoError(t, err)
+
+	_, err = sourceColl.DeleteOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	_, err = source.Database("foo").Collection("baz").InsertOne(nil, bson.M{"_id": "d"})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]bson.M{
+			{"_id": "a", "n": int32(4)},
+			{"_id": "c", "n": int32(3)},
+		}, dumpCollection(targetColl, false))
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	n, err := target.Database("foo").Collection("baz").CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
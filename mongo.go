@@ -2,6 +2,7 @@ package lungo
 
 import (
 	"context"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,7 +17,28 @@ type MongoClient struct {
 }
 
 // Connect will connect to a MongoDB database and return a lungo compatible client.
+// If the URI applied to the options uses the "lungo" scheme, a lungo database
+// configured by the URI is opened instead (see ParseURI). The engine of such a
+// database is closed when the client is disconnected.
 func Connect(ctx context.Context, opts ...*options.ClientOptions) (IClient, error) {
+	// get uri
+	var uri string
+	for _, opt := range opts {
+		if opt != nil && opt.GetURI() != "" {
+			uri = opt.GetURI()
+		}
+	}
+
+	// open lungo database
+	if strings.HasPrefix(uri, "lungo:") {
+		lungoOpts, err := ParseURI(uri)
+		if err != nil {
+			return nil, err
+		}
+		client, _, err := Open(ctx, lungoOpts)
+		return client, err
+	}
+
 	client, err := mongo.Connect(ctx, opts...)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,625 @@
+package mongokit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// AggregationContext is the context in which a pipeline is executed.
+type AggregationContext struct {
+	// The context used to abort the execution.
+	Context context.Context
+
+	// The variables available to expressions.
+	Variables map[string]interface{}
+
+	// The random number generator used by the $sample stage. If missing, the
+	// global generator of the math/rand package is used.
+	Random *rand.Rand
+
+	// The function accumulators available to the $accumulator operator of the
+	// $group stage, keyed by the value of its "accumulate" field.
+	Functions map[string]FunctionAccumulator
+
+	// The metadata of documents e.g. the scores added by the search stages.
+	meta map[bsonkit.Doc]map[string]interface{}
+}
+
+// Stage is an aggregation pipeline stage. It receives the documents from the
+// previous stage and returns the documents for the next stage. A stage must
+// not modify the received documents.
+type Stage func(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error)
+
+// AggregationStages defines the available aggregation pipeline stages.
+var AggregationStages = map[string]Stage{}
+
+func init() {
+	// register stages
+	AggregationStages["$match"] = stageMatch
+	AggregationStages["$project"] = stageProject
+	AggregationStages["$addFields"] = stageAddFields
+	AggregationStages["$set"] = stageAddFields
+	AggregationStages["$unset"] = stageUnset
+	AggregationStages["$sort"] = stageSort
+	AggregationStages["$skip"] = stageSkip
+	AggregationStages["$limit"] = stageLimit
+	AggregationStages["$sample"] = stageSample
+	AggregationStages["$count"] = stageCount
+	AggregationStages["$group"] = stageGroup
+	AggregationStages["$unwind"] = stageUnwind
+	AggregationStages["$replaceRoot"] = stageReplaceRoot
+	AggregationStages["$replaceWith"] = stageReplaceWith
+	AggregationStages["$redact"] = stageRedact
+}
+
+// Aggregate will run the specified pipeline on the list of documents and
+// return the resulting documents. The documents in the list are not modified.
+func Aggregate(ctx *AggregationContext, list bsonkit.List, pipeline bsonkit.List) (bsonkit.List, error) {
+	// ensure context
+	if ctx == nil {
+		ctx = &AggregationContext{}
+	}
+	if ctx.Context == nil {
+		ctx.Context = context.Background()
+	}
+
+	// run stages
+	for _, stage := range pipeline {
+		// check stage
+		if len(*stage) != 1 {
+			return nil, fmt.Errorf("a pipeline stage specification object must contain exactly one field")
+		}
+
+		// get stage
+		fn := AggregationStages[(*stage)[0].Key]
+		if fn == nil {
+			return nil, fmt.Errorf("unrecognized pipeline stage name: %q", (*stage)[0].Key)
+		}
+
+		// check context
+		err := ctx.Context.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		// run stage
+		list, err = fn(ctx, list, (*stage)[0].Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+func stageMatch(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get query
+	query, ok := arg.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("$match: expected document")
+	}
+
+	return Filter(list, BindVariables(&query, ctx.Variables), 0)
+}
+
+func stageProject(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get projection
+	spec, ok := arg.(bson.D)
+	if !ok || len(spec) == 0 {
+		return nil, fmt.Errorf("$project: expected non-empty document")
+	}
+
+	// split flags and expressions
+	var flags bson.D
+	var exprs bson.D
+	var include, exclude bool
+	for _, field := range flattenSpec(spec, "") {
+		switch value := field.Value.(type) {
+		case bool, int32, int64, float64:
+			// add flag
+			flag := int32(0)
+			if truthy(value) {
+				flag = 1
+			}
+			flags = append(flags, bson.E{Key: field.Key, Value: flag})
+
+			// track mode
+			if field.Key != "_id" {
+				include = include || flag == 1
+				exclude = exclude || flag == 0
+			}
+		default:
+			exprs = append(exprs, field)
+		}
+	}
+
+	// check mode
+	if include && exclude {
+		return nil, fmt.Errorf("$project: cannot have a mix of inclusion and exclusion")
+	} else if exclude && len(exprs) > 0 {
+		return nil, fmt.Errorf("$project: cannot use expressions in exclusion projection")
+	}
+
+	// project documents
+	result := make(bsonkit.List, 0, len(list))
+	for _, doc := range list {
+		// project flags
+		var res bsonkit.Doc
+		if include || len(exprs) == 0 {
+			var err error
+			res, err = Project(doc, &flags)
+			if err != nil {
+				return nil, err
+			}
+			if len(exprs) > 0 {
+				res = bsonkit.Clone(res)
+			}
+		} else {
+			res = &bson.D{}
+			hideID := bsonkit.Get(&flags, "_id")
+			if id := bsonkit.Get(doc, "_id"); id != bsonkit.Missing && (hideID == bsonkit.Missing || truthy(hideID)) {
+				*res = append(*res, bson.E{Key: "_id", Value: id})
+			}
+		}
+
+		// add expressions
+		err := putExpressions(ctx, doc, res, exprs)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, res)
+	}
+
+	return result, nil
+}
+
+func stageAddFields(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get fields
+	spec, ok := arg.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("$addFields: expected document")
+	}
+
+	// flatten fields
+	fields := flattenSpec(spec, "")
+
+	// add fields
+	result := make(bsonkit.List, 0, len(list))
+	for _, doc := range list {
+		res := bsonkit.Clone(doc)
+		err := putExpressions(ctx, doc, res, fields)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, res)
+	}
+
+	return result, nil
+}
+
+func stageUnset(_ *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get paths
+	var paths []string
+	switch arg := arg.(type) {
+	case string:
+		paths = append(paths, arg)
+	case bson.A:
+		for _, item := range arg {
+			path, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("$unset: expected string or array of strings")
+			}
+			paths = append(paths, path)
+		}
+	default:
+		return nil, fmt.Errorf("$unset: expected string or array of strings")
+	}
+
+	// unset fields
+	result := make(bsonkit.List, 0, len(list))
+	for _, doc := range list {
+		res := bsonkit.Clone(doc)
+		for _, path := range paths {
+			bsonkit.Unset(res, path)
+		}
+		result = append(result, res)
+	}
+
+	return result, nil
+}
+
+func stageSort(_ *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get sort
+	doc, ok := arg.(bson.D)
+	if !ok || len(doc) == 0 {
+		return nil, fmt.Errorf("$sort: expected non-empty document")
+	}
+
+	return Sort(list, &doc)
+}
+
+func stageSkip(_ *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get skip
+	skip, ok := toInt64(arg)
+	if !ok || skip < 0 {
+		return nil, fmt.Errorf("$skip: expected non-negative number")
+	}
+
+	// skip documents
+	if int(skip) >= len(list) {
+		return bsonkit.List{}, nil
+	}
+
+	return list[skip:], nil
+}
+
+func stageLimit(_ *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get limit
+	limit, ok := toInt64(arg)
+	if !ok || limit <= 0 {
+		return nil, fmt.Errorf("$limit: expected positive number")
+	}
+
+	// limit documents
+	if int(limit) < len(list) {
+		return list[:limit], nil
+	}
+
+	return list, nil
+}
+
+func stageSample(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get size
+	doc, ok := arg.(bson.D)
+	if !ok || len(doc) != 1 || doc[0].Key != "size" {
+		return nil, fmt.Errorf("$sample: expected document with a single 'size' field")
+	}
+	size, ok := toInt64(doc[0].Value)
+	if !ok || size < 0 {
+		return nil, fmt.Errorf("$sample: size must be a non-negative number")
+	}
+
+	// get random number generator
+	intn := rand.Intn
+	if ctx.Random != nil {
+		intn = ctx.Random.Intn
+	}
+
+	// fill reservoir
+	sample := make(bsonkit.List, 0, minInt64(size, int64(len(list))))
+	for i, doc := range list {
+		if int64(i) < size {
+			sample = append(sample, doc)
+		} else if j := intn(i + 1); int64(j) < size {
+			sample[j] = doc
+		}
+	}
+
+	// shuffle reservoir
+	for i := len(sample) - 1; i > 0; i-- {
+		j := intn(i + 1)
+		sample[i], sample[j] = sample[j], sample[i]
+	}
+
+	return sample, nil
+}
+
+func stageCount(_ *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get field
+	field, ok := arg.(string)
+	if !ok || field == "" || strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+		return nil, fmt.Errorf("$count: expected non-empty field name without '$' or '.'")
+	}
+
+	// handle empty list
+	if len(list) == 0 {
+		return bsonkit.List{}, nil
+	}
+
+	return bsonkit.List{
+		{{Key: field, Value: int32(len(list))}},
+	}, nil
+}
+
+func stageGroup(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get group
+	doc, ok := arg.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("$group: expected document")
+	}
+
+	return groupList(ctx, list, &doc)
+}
+
+func stageUnwind(_ *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get options
+	var path, indexField string
+	var preserve bool
+	switch arg := arg.(type) {
+	case string:
+		path = arg
+	case bson.D:
+		for _, field := range arg {
+			switch field.Key {
+			case "path":
+				path, _ = field.Value.(string)
+			case "includeArrayIndex":
+				var ok bool
+				indexField, ok = field.Value.(string)
+				if !ok || indexField == "" || strings.HasPrefix(indexField, "$") {
+					return nil, fmt.Errorf("$unwind: expected valid field name for includeArrayIndex")
+				}
+			case "preserveNullAndEmptyArrays":
+				var ok bool
+				preserve, ok = field.Value.(bool)
+				if !ok {
+					return nil, fmt.Errorf("$unwind: expected boolean for preserveNullAndEmptyArrays")
+				}
+			default:
+				return nil, fmt.Errorf("$unwind: unrecognized option %q", field.Key)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("$unwind: expected string or document")
+	}
+
+	// check path
+	if !strings.HasPrefix(path, "$") || len(path) < 2 {
+		return nil, fmt.Errorf("$unwind: path must be prefixed with a '$'")
+	}
+	path = path[1:]
+
+	// unwind documents
+	var result bsonkit.List
+	for _, doc := range list {
+		// get value
+		value := bsonkit.Get(doc, path)
+
+		// handle arrays
+		if array, ok := value.(bson.A); ok && len(array) > 0 {
+			for i, item := range array {
+				res := bsonkit.Clone(doc)
+				_, err := bsonkit.Put(res, path, item, false)
+				if err != nil {
+					return nil, err
+				}
+				if indexField != "" {
+					_, err = bsonkit.Put(res, indexField, int64(i), false)
+					if err != nil {
+						return nil, err
+					}
+				}
+				result = append(result, res)
+			}
+			continue
+		}
+
+		// handle null, missing and empty arrays
+		_, isArray := value.(bson.A)
+		if isArray || isNullish(value) {
+			if !preserve {
+				continue
+			}
+			res := bsonkit.Clone(doc)
+			if isArray {
+				bsonkit.Unset(res, path)
+			}
+			if indexField != "" {
+				_, err := bsonkit.Put(res, indexField, nil, false)
+				if err != nil {
+					return nil, err
+				}
+			}
+			result = append(result, res)
+			continue
+		}
+
+		// handle scalars
+		res := doc
+		if indexField != "" {
+			res = bsonkit.Clone(doc)
+			_, err := bsonkit.Put(res, indexField, nil, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, res)
+	}
+
+	return result, nil
+}
+
+func stageReplaceRoot(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get expression
+	spec, ok := arg.(bson.D)
+	if !ok || len(spec) != 1 || spec[0].Key != "newRoot" {
+		return nil, fmt.Errorf("$replaceRoot: expected document with a single 'newRoot' field")
+	}
+
+	return replaceRoot(ctx, "$replaceRoot", list, spec[0].Value)
+}
+
+func stageReplaceWith(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	return replaceRoot(ctx, "$replaceWith", list, arg)
+}
+
+func replaceRoot(ctx *AggregationContext, op string, list bsonkit.List, expr interface{}) (bsonkit.List, error) {
+	// replace documents
+	result := make(bsonkit.List, 0, len(list))
+	for _, doc := range list {
+		// evaluate expression
+		value, err := Evaluate(doc, expr, ctx.Variables)
+		if err != nil {
+			return nil, err
+		}
+
+		// check document
+		root, ok := value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%s: 'newRoot' must evaluate to a document, found: %s", op, typeName(value))
+		}
+
+		result = append(result, bsonkit.Clone(&root))
+	}
+
+	return result, nil
+}
+
+type redactAction string
+
+const (
+	redactDescend redactAction = "descend"
+	redactPrune   redactAction = "prune"
+	redactKeep    redactAction = "keep"
+)
+
+func stageRedact(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// prepare variables
+	variables := map[string]interface{}{
+		"DESCEND": redactDescend,
+		"PRUNE":   redactPrune,
+		"KEEP":    redactKeep,
+	}
+
+	// redact documents
+	result := make(bsonkit.List, 0, len(list))
+	for _, doc := range list {
+		scope := NewScope(doc, ctx.Variables).With(variables)
+		res, err := redactDoc(scope, doc, arg)
+		if err != nil {
+			return nil, err
+		} else if res != nil {
+			result = append(result, res)
+		}
+	}
+
+	return result, nil
+}
+
+func redactDoc(scope *Scope, doc bsonkit.Doc, expr interface{}) (bsonkit.Doc, error) {
+	// evaluate expression with the document as the current document
+	scope = &Scope{
+		Current:   doc,
+		Root:      scope.Root,
+		Variables: scope.Variables,
+	}
+	value, err := scope.Evaluate(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle action
+	switch value {
+	case redactKeep:
+		return bsonkit.Clone(doc), nil
+	case redactPrune:
+		return nil, nil
+	case redactDescend:
+	default:
+		return nil, fmt.Errorf("$redact: expression must evaluate to $$DESCEND, $$PRUNE or $$KEEP, found: %s", typeName(value))
+	}
+
+	// descend into fields
+	res := bson.D{}
+	for _, field := range *doc {
+		switch value := field.Value.(type) {
+		case bson.D:
+			sub, err := redactDoc(scope, &value, expr)
+			if err != nil {
+				return nil, err
+			} else if sub != nil {
+				res = append(res, bson.E{Key: field.Key, Value: *sub})
+			}
+		case bson.A:
+			array, err := redactArray(scope, value, expr)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, bson.E{Key: field.Key, Value: array})
+		default:
+			res = append(res, field)
+		}
+	}
+
+	return &res, nil
+}
+
+func redactArray(scope *Scope, array bson.A, expr interface{}) (bson.A, error) {
+	// descend into elements
+	res := bson.A{}
+	for _, item := range array {
+		switch item := item.(type) {
+		case bson.D:
+			sub, err := redactDoc(scope, &item, expr)
+			if err != nil {
+				return nil, err
+			} else if sub != nil {
+				res = append(res, *sub)
+			}
+		case bson.A:
+			sub, err := redactArray(scope, item, expr)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, sub)
+		default:
+			res = append(res, item)
+		}
+	}
+
+	return res, nil
+}
+
+func flattenSpec(spec bson.D, prefix string) bson.D {
+	var fields bson.D
+	for _, field := range spec {
+		// get path
+		path := prefix + field.Key
+
+		// flatten nested specifications
+		if doc, ok := field.Value.(bson.D); ok && len(doc) > 0 && !strings.HasPrefix(doc[0].Key, "$") {
+			fields = append(fields, flattenSpec(doc, path+".")...)
+			continue
+		}
+
+		fields = append(fields, bson.E{Key: path, Value: field.Value})
+	}
+
+	return fields
+}
+
+func putExpressions(ctx *AggregationContext, doc, res bsonkit.Doc, fields bson.D) error {
+	// prepare scope
+	scope := NewScope(doc, ctx.Variables)
+
+	// add and retain metadata
+	if meta, ok := ctx.meta[doc]; ok {
+		scope.Meta = meta
+		ctx.meta[res] = meta
+	}
+
+	// evaluate and put fields
+	for _, field := range fields {
+		value, err := scope.Evaluate(field.Value)
+		if err != nil {
+			return err
+		}
+		if value == bsonkit.Missing {
+			bsonkit.Unset(res, field.Key)
+			continue
+		}
+		_, err = bsonkit.Put(res, field.Key, value, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,481 @@
+package mongokit
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func aggregateTest(t *testing.T, docs []bson.D, fn func(fn func(bson.A, interface{}))) {
+	t.Run("Mongo", func(t *testing.T) {
+		coll := testCollection()
+		for _, doc := range docs {
+			_, err := coll.InsertOne(nil, doc)
+			assert.NoError(t, err)
+		}
+
+		fn(func(pipeline bson.A, result interface{}) {
+			var out []bson.D
+			csr, err := coll.Aggregate(nil, pipeline)
+			if err == nil {
+				err = csr.All(nil, &out)
+			}
+			if _, ok := result.(string); ok {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, result, out)
+			}
+		})
+	})
+
+	t.Run("Lungo", func(t *testing.T) {
+		fn(func(pipeline bson.A, result interface{}) {
+			// prepare list
+			list := make(bsonkit.List, 0, len(docs))
+			for i := range docs {
+				list = append(list, bsonkit.Clone(&docs[i]))
+			}
+
+			// prepare pipeline
+			stages := make(bsonkit.List, 0, len(pipeline))
+			for _, stage := range pipeline {
+				doc := stage.(bson.D)
+				stages = append(stages, &doc)
+			}
+
+			// run pipeline
+			res, err := Aggregate(nil, list, stages)
+			if str, ok := result.(string); ok {
+				assert.Error(t, err)
+				assert.Equal(t, str, err.Error())
+			} else {
+				assert.NoError(t, err)
+				out := []bson.D{}
+				for _, doc := range res {
+					out = append(out, *doc)
+				}
+				if result == nil {
+					result = []bson.D{}
+				}
+				assert.Equal(t, result, out)
+			}
+
+			// check documents
+			for i, doc := range list {
+				assert.Equal(t, docs[i], *doc)
+			}
+		})
+	})
+}
+
+func TestAggregateStages(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "a", Value: "x"}, {Key: "b", Value: int32(3)}, {Key: "c", Value: bson.A{int32(1), int32(2)}}},
+		{{Key: "_id", Value: int32(2)}, {Key: "a", Value: "y"}, {Key: "b", Value: int32(1)}, {Key: "c", Value: bson.A{}}},
+		{{Key: "_id", Value: int32(3)}, {Key: "a", Value: "x"}, {Key: "b", Value: int32(2)}},
+	}
+
+	aggregateTest(t, docs, func(fn func(bson.A, interface{})) {
+		// unknown stage
+		fn(bson.A{
+			bson.D{{Key: "$foo", Value: bson.D{}}},
+		}, `unrecognized pipeline stage name: "$foo"`)
+
+		// match, sort, skip and limit
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "a", Value: "x"}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "b", Value: int32(1)}}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "b", Value: true}}}},
+			bson.D{{Key: "$skip", Value: int32(1)}},
+			bson.D{{Key: "$limit", Value: int32(1)}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "b", Value: int32(3)}},
+		})
+
+		// project expressions
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: int32(0)},
+				{Key: "d", Value: bson.D{{Key: "$multiply", Value: bson.A{"$b", int32(2)}}}},
+				{Key: "e", Value: bson.D{{Key: "f", Value: "$a"}}},
+			}}},
+		}, []bson.D{
+			{{Key: "d", Value: int32(6)}, {Key: "e", Value: bson.D{{Key: "f", Value: "x"}}}},
+			{{Key: "d", Value: int32(2)}, {Key: "e", Value: bson.D{{Key: "f", Value: "y"}}}},
+			{{Key: "d", Value: int32(4)}, {Key: "e", Value: bson.D{{Key: "f", Value: "x"}}}},
+		})
+
+		// add fields and unset
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "a", Value: bson.D{{Key: "$cond", Value: bson.A{
+					bson.D{{Key: "$gt", Value: bson.A{"$b", int32(1)}}}, "big", "small",
+				}}}},
+				{Key: "d", Value: "$$REMOVE"},
+			}}},
+			bson.D{{Key: "$unset", Value: bson.A{"c"}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "a", Value: "big"}, {Key: "b", Value: int32(3)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "a", Value: "small"}, {Key: "b", Value: int32(1)}},
+			{{Key: "_id", Value: int32(3)}, {Key: "a", Value: "big"}, {Key: "b", Value: int32(2)}},
+		})
+
+		// unwind
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$unwind", Value: "$c"}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "c", Value: int32(1)}}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "c", Value: int32(1)}},
+			{{Key: "_id", Value: int32(1)}, {Key: "c", Value: int32(2)}},
+		})
+
+		// unwind with options
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$unwind", Value: bson.D{
+				{Key: "path", Value: "$c"},
+				{Key: "includeArrayIndex", Value: "i"},
+				{Key: "preserveNullAndEmptyArrays", Value: true},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "c", Value: int32(1)}, {Key: "i", Value: int32(1)}}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "c", Value: int32(1)}, {Key: "i", Value: int64(0)}},
+			{{Key: "_id", Value: int32(1)}, {Key: "c", Value: int32(2)}, {Key: "i", Value: int64(1)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "i", Value: nil}},
+			{{Key: "_id", Value: int32(3)}, {Key: "i", Value: nil}},
+		})
+
+		// count
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "a", Value: "x"}}}},
+			bson.D{{Key: "$count", Value: "n"}},
+		}, []bson.D{
+			{{Key: "n", Value: int32(2)}},
+		})
+
+		// count nothing
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "a", Value: "z"}}}},
+			bson.D{{Key: "$count", Value: "n"}},
+		}, nil)
+
+		// sample all
+		fn(bson.A{
+			bson.D{{Key: "$sample", Value: bson.D{{Key: "size", Value: int32(5)}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}},
+			{{Key: "_id", Value: int32(2)}},
+			{{Key: "_id", Value: int32(3)}},
+		})
+
+		// sample some
+		fn(bson.A{
+			bson.D{{Key: "$sample", Value: bson.D{{Key: "size", Value: int32(2)}}}},
+			bson.D{{Key: "$count", Value: "n"}},
+		}, []bson.D{
+			{{Key: "n", Value: int32(2)}},
+		})
+
+		// sample with invalid size
+		fn(bson.A{
+			bson.D{{Key: "$sample", Value: bson.D{{Key: "size", Value: int32(-1)}}}},
+		}, "$sample: size must be a non-negative number")
+	})
+}
+
+func TestAggregateReplaceRoot(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "sub", Value: bson.D{{Key: "x", Value: int32(1)}}}},
+		{{Key: "_id", Value: int32(2)}, {Key: "sub", Value: bson.D{{Key: "x", Value: int32(2)}}}},
+		{{Key: "_id", Value: int32(3)}},
+	}
+
+	aggregateTest(t, docs, func(fn func(bson.A, interface{})) {
+		// replace root
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "sub", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$replaceRoot", Value: bson.D{{Key: "newRoot", Value: "$sub"}}}},
+		}, []bson.D{
+			{{Key: "x", Value: int32(1)}},
+			{{Key: "x", Value: int32(2)}},
+		})
+
+		// replace with expression
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$replaceWith", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{
+				bson.D{{Key: "id", Value: "$_id"}},
+				"$sub",
+			}}}}},
+		}, []bson.D{
+			{{Key: "id", Value: int32(1)}, {Key: "x", Value: int32(1)}},
+			{{Key: "id", Value: int32(2)}, {Key: "x", Value: int32(2)}},
+			{{Key: "id", Value: int32(3)}},
+		})
+
+		// missing new root
+		fn(bson.A{
+			bson.D{{Key: "$replaceWith", Value: "$sub"}},
+		}, "$replaceWith: 'newRoot' must evaluate to a document, found: missing")
+
+		// invalid specification
+		fn(bson.A{
+			bson.D{{Key: "$replaceRoot", Value: bson.D{{Key: "root", Value: "$sub"}}}},
+		}, "$replaceRoot: expected document with a single 'newRoot' field")
+	})
+}
+
+func TestAggregateRedact(t *testing.T) {
+	docs := []bson.D{
+		{
+			{Key: "_id", Value: int32(1)},
+			{Key: "level", Value: int32(1)},
+			{Key: "public", Value: bson.D{
+				{Key: "level", Value: int32(1)},
+				{Key: "text", Value: "a"},
+			}},
+			{Key: "secret", Value: bson.D{
+				{Key: "level", Value: int32(3)},
+				{Key: "text", Value: "b"},
+			}},
+			{Key: "list", Value: bson.A{
+				bson.D{{Key: "level", Value: int32(1)}, {Key: "text", Value: "c"}},
+				bson.D{{Key: "level", Value: int32(5)}, {Key: "text", Value: "d"}},
+				"e",
+			}},
+		},
+		{
+			{Key: "_id", Value: int32(2)},
+			{Key: "level", Value: int32(4)},
+		},
+		{
+			{Key: "_id", Value: int32(3)},
+			{Key: "level", Value: int32(0)},
+			{Key: "secret", Value: bson.D{
+				{Key: "level", Value: int32(9)},
+			}},
+		},
+	}
+
+	aggregateTest(t, docs, func(fn func(bson.A, interface{})) {
+		// descend and prune
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$redact", Value: bson.D{{Key: "$cond", Value: bson.D{
+				{Key: "if", Value: bson.D{{Key: "$lte", Value: bson.A{"$level", int32(2)}}}},
+				{Key: "then", Value: "$$DESCEND"},
+				{Key: "else", Value: "$$PRUNE"},
+			}}}}},
+		}, []bson.D{
+			{
+				{Key: "_id", Value: int32(1)},
+				{Key: "level", Value: int32(1)},
+				{Key: "public", Value: bson.D{
+					{Key: "level", Value: int32(1)},
+					{Key: "text", Value: "a"},
+				}},
+				{Key: "list", Value: bson.A{
+					bson.D{{Key: "level", Value: int32(1)}, {Key: "text", Value: "c"}},
+					"e",
+				}},
+			},
+			{
+				{Key: "_id", Value: int32(3)},
+				{Key: "level", Value: int32(0)},
+			},
+		})
+
+		// keep
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$redact", Value: bson.D{{Key: "$cond", Value: bson.D{
+				{Key: "if", Value: bson.D{{Key: "$eq", Value: bson.A{"$level", int32(0)}}}},
+				{Key: "then", Value: "$$KEEP"},
+				{Key: "else", Value: "$$PRUNE"},
+			}}}}},
+		}, []bson.D{
+			{
+				{Key: "_id", Value: int32(3)},
+				{Key: "level", Value: int32(0)},
+				{Key: "secret", Value: bson.D{
+					{Key: "level", Value: int32(9)},
+				}},
+			},
+		})
+
+		// invalid result
+		fn(bson.A{
+			bson.D{{Key: "$redact", Value: "$level"}},
+		}, "$redact: expression must evaluate to $$DESCEND, $$PRUNE or $$KEEP, found: int")
+	})
+}
+
+func TestAggregateSample(t *testing.T) {
+	list := bsonkit.List{}
+	for i := 0; i < 10; i++ {
+		list = append(list, &bson.D{{Key: "_id", Value: int32(i)}})
+	}
+
+	stages := bsonkit.List{
+		&bson.D{{Key: "$sample", Value: bson.D{{Key: "size", Value: int32(3)}}}},
+	}
+
+	// same seed yields same sample
+	res1, err := Aggregate(&AggregationContext{Random: rand.New(rand.NewSource(1))}, list, stages)
+	assert.NoError(t, err)
+	assert.Len(t, res1, 3)
+	res2, err := Aggregate(&AggregationContext{Random: rand.New(rand.NewSource(1))}, list, stages)
+	assert.NoError(t, err)
+	assert.Equal(t, res1, res2)
+
+	// every document is eventually selected
+	counts := map[int32]int{}
+	random := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		res, err := Aggregate(&AggregationContext{Random: random}, list, stages)
+		assert.NoError(t, err)
+		for _, doc := range res {
+			counts[bsonkit.Get(doc, "_id").(int32)]++
+		}
+	}
+	assert.Len(t, counts, 10)
+	for _, count := range counts {
+		assert.InDelta(t, 300, count, 100)
+	}
+}
+
+func TestAggregateAccumulators(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(2)}, {Key: "o", Value: bson.D{{Key: "x", Value: int32(1)}}}},
+		{{Key: "_id", Value: int32(2)}, {Key: "g", Value: "a"}, {Key: "v", Value: nil}, {Key: "o", Value: bson.D{{Key: "y", Value: int32(2)}}}},
+		{{Key: "_id", Value: int32(3)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(4)}, {Key: "o", Value: nil}},
+		{{Key: "_id", Value: int32(4)}, {Key: "g", Value: "b"}},
+	}
+
+	aggregateTest(t, docs, func(fn func(bson.A, interface{})) {
+		// unknown accumulator
+		fn(bson.A{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: nil},
+				{Key: "x", Value: bson.D{{Key: "$foo", Value: "$v"}}},
+			}}},
+		}, `unknown group operator "$foo"`)
+
+		// missing id
+		fn(bson.A{
+			bson.D{{Key: "$group", Value: bson.D{}}},
+		}, "a group specification must include an _id")
+
+		// all accumulators
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$g"},
+				{Key: "sum", Value: bson.D{{Key: "$sum", Value: "$v"}}},
+				{Key: "avg", Value: bson.D{{Key: "$avg", Value: "$v"}}},
+				{Key: "min", Value: bson.D{{Key: "$min", Value: "$v"}}},
+				{Key: "max", Value: bson.D{{Key: "$max", Value: "$v"}}},
+				{Key: "push", Value: bson.D{{Key: "$push", Value: "$v"}}},
+				{Key: "set", Value: bson.D{{Key: "$addToSet", Value: "$g"}}},
+				{Key: "first", Value: bson.D{{Key: "$first", Value: "$v"}}},
+				{Key: "last", Value: bson.D{{Key: "$last", Value: "$v"}}},
+				{Key: "dev", Value: bson.D{{Key: "$stdDevPop", Value: "$v"}}},
+				{Key: "merged", Value: bson.D{{Key: "$mergeObjects", Value: "$o"}}},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: int32(1)}}},
+			}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+		}, []bson.D{
+			{
+				{Key: "_id", Value: "a"},
+				{Key: "sum", Value: int32(6)},
+				{Key: "avg", Value: 3.0},
+				{Key: "min", Value: int32(2)},
+				{Key: "max", Value: int32(4)},
+				{Key: "push", Value: bson.A{int32(2), nil, int32(4)}},
+				{Key: "set", Value: bson.A{"a"}},
+				{Key: "first", Value: int32(2)},
+				{Key: "last", Value: int32(4)},
+				{Key: "dev", Value: 1.0},
+				{Key: "merged", Value: bson.D{{Key: "x", Value: int32(1)}, {Key: "y", Value: int32(2)}}},
+				{Key: "count", Value: int32(3)},
+			},
+			{
+				{Key: "_id", Value: "b"},
+				{Key: "sum", Value: int32(0)},
+				{Key: "avg", Value: nil},
+				{Key: "min", Value: nil},
+				{Key: "max", Value: nil},
+				{Key: "push", Value: bson.A{}},
+				{Key: "set", Value: bson.A{"b"}},
+				{Key: "first", Value: nil},
+				{Key: "last", Value: nil},
+				{Key: "dev", Value: nil},
+				{Key: "merged", Value: bson.D{}},
+				{Key: "count", Value: int32(1)},
+			},
+		})
+
+		// group by missing field
+		fn(bson.A{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$foo"},
+				{Key: "n", Value: bson.D{{Key: "$count", Value: bson.D{}}}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: nil}, {Key: "n", Value: int32(4)}},
+		})
+
+		// sum overflow
+		fn(bson.A{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: nil},
+				{Key: "n", Value: bson.D{{Key: "$sum", Value: int32(2147483647)}}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: nil}, {Key: "n", Value: int64(4 * 2147483647)}},
+		})
+
+		// long sum overflow
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$project", Value: bson.D{
+				{Key: "sum", Value: bson.D{{Key: "$sum", Value: bson.A{int64(math.MaxInt64), int64(1)}}}},
+				{Key: "avg", Value: bson.D{{Key: "$avg", Value: bson.A{int64(math.MaxInt64), int64(math.MaxInt64)}}}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "sum", Value: 9.223372036854776e18}, {Key: "avg", Value: 9.223372036854776e18}},
+		})
+
+		// array forms
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$project", Value: bson.D{
+				{Key: "sum", Value: bson.D{{Key: "$sum", Value: bson.A{"$v", int32(3)}}}},
+				{Key: "max", Value: bson.D{{Key: "$max", Value: bson.A{"$v", int32(3)}}}},
+				{Key: "avg", Value: bson.D{{Key: "$avg", Value: bson.D{{Key: "$literal", Value: bson.A{int32(1), int32(2)}}}}}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "sum", Value: int32(5)}, {Key: "max", Value: int32(3)}, {Key: "avg", Value: 1.5}},
+		})
+
+		// merge non-object
+		fn(bson.A{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: nil},
+				{Key: "m", Value: bson.D{{Key: "$mergeObjects", Value: "$g"}}},
+			}}},
+		}, "$mergeObjects requires object inputs, but input is of type string")
+	})
+}
@@ -0,0 +1,698 @@
+package mongokit
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func init() {
+	// register array operators
+	AggregationExpressionOperators["$map"] = exprMap
+	AggregationExpressionOperators["$filter"] = exprFilter
+	AggregationExpressionOperators["$reduce"] = exprReduce
+	AggregationExpressionOperators["$zip"] = exprZip
+	AggregationExpressionOperators["$arrayElemAt"] = exprArrayElemAt
+	AggregationExpressionOperators["$first"] = exprFirstLast
+	AggregationExpressionOperators["$last"] = exprFirstLast
+	AggregationExpressionOperators["$slice"] = exprSlice
+	AggregationExpressionOperators["$in"] = exprIn
+	AggregationExpressionOperators["$indexOfArray"] = exprIndexOfArray
+	AggregationExpressionOperators["$size"] = exprSize
+	AggregationExpressionOperators["$isArray"] = exprIsArray
+	AggregationExpressionOperators["$concatArrays"] = exprConcatArrays
+	AggregationExpressionOperators["$reverseArray"] = exprReverseArray
+	AggregationExpressionOperators["$range"] = exprRange
+	AggregationExpressionOperators["$arrayToObject"] = exprArrayToObject
+	AggregationExpressionOperators["$objectToArray"] = exprObjectToArray
+
+	// register variable operators
+	AggregationExpressionOperators["$let"] = exprLet
+}
+
+func validateVariable(op, name string) error {
+	// check name
+	if name == "" {
+		return fmt.Errorf("%s: empty variable names are not allowed", op)
+	} else if c := name[0]; !(c >= 'a' && c <= 'z') && c < 0x80 {
+		return fmt.Errorf("%s: %q starts with an invalid character for a user variable name", op, name)
+	} else if strings.ContainsAny(name, ".$") {
+		return fmt.Errorf("%s: %q contains an invalid character for a variable name", op, name)
+	}
+
+	return nil
+}
+
+func getVariableName(op string, v interface{}, def string) (string, error) {
+	// handle default
+	if v == nil {
+		return def, nil
+	}
+
+	// check string
+	name, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: 'as' must be a string", op)
+	}
+
+	return name, validateVariable(op, name)
+}
+
+func evaluateArray(scope *Scope, op string, expr interface{}, name string) (bson.A, bool, error) {
+	// evaluate expression
+	value, err := scope.Evaluate(expr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// handle null
+	if isNullish(value) {
+		return nil, true, nil
+	}
+
+	// check array
+	array, ok := value.(bson.A)
+	if !ok {
+		return nil, false, fmt.Errorf("%s requires %s to be an array, found: %s", op, name, typeName(value))
+	}
+
+	return array, false, nil
+}
+
+func exprMap(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// get parameters
+	params, err := getParameters(op, arg, []string{"input", "in"}, "as")
+	if err != nil {
+		return nil, err
+	}
+
+	// get variable
+	name, err := getVariableName(op, params["as"], "this")
+	if err != nil {
+		return nil, err
+	}
+
+	// get input
+	input, null, err := evaluateArray(scope, op, params["input"], "'input'")
+	if err != nil || null {
+		return nil, err
+	}
+
+	// map elements
+	result := make(bson.A, 0, len(input))
+	for _, item := range input {
+		value, err := scope.With(map[string]interface{}{name: item}).Evaluate(params["in"])
+		if err != nil {
+			return nil, err
+		} else if value == bsonkit.Missing {
+			value = nil
+		}
+		result = append(result, value)
+	}
+
+	return result, nil
+}
+
+func exprFilter(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// get parameters
+	params, err := getParameters(op, arg, []string{"input", "cond"}, "as", "limit")
+	if err != nil {
+		return nil, err
+	}
+
+	// get variable
+	name, err := getVariableName(op, params["as"], "this")
+	if err != nil {
+		return nil, err
+	}
+
+	// get input
+	input, null, err := evaluateArray(scope, op, params["input"], "'input'")
+	if err != nil || null {
+		return nil, err
+	}
+
+	// get limit
+	limit := int64(len(input))
+	if expr, ok := params["limit"]; ok {
+		value, err := scope.Evaluate(expr)
+		if err != nil {
+			return nil, err
+		}
+		if !isNullish(value) {
+			limit, err = getInteger(op, "limit", value)
+			if err != nil {
+				return nil, err
+			} else if limit < 1 {
+				return nil, fmt.Errorf("%s: limit must be greater than 0, found %d", op, limit)
+			}
+		}
+	}
+
+	// filter elements
+	result := bson.A{}
+	for _, item := range input {
+		if int64(len(result)) >= limit {
+			break
+		}
+		value, err := scope.With(map[string]interface{}{name: item}).Evaluate(params["cond"])
+		if err != nil {
+			return nil, err
+		}
+		if truthy(value) {
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+func exprReduce(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// get parameters
+	params, err := getParameters(op, arg, []string{"input", "initialValue", "in"})
+	if err != nil {
+		return nil, err
+	}
+
+	// get input
+	input, null, err := evaluateArray(scope, op, params["input"], "'input'")
+	if err != nil || null {
+		return nil, err
+	}
+
+	// get initial value
+	value, err := scope.Evaluate(params["initialValue"])
+	if err != nil {
+		return nil, err
+	}
+
+	// reduce elements
+	for _, item := range input {
+		value, err = scope.With(map[string]interface{}{
+			"this":  item,
+			"value": value,
+		}).Evaluate(params["in"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+func exprZip(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// get parameters
+	params, err := getParameters(op, arg, []string{"inputs"}, "useLongestLength", "defaults")
+	if err != nil {
+		return nil, err
+	}
+
+	// get inputs expressions
+	exprs, ok := params["inputs"].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%s: inputs must be an array of expressions", op)
+	}
+
+	// evaluate inputs
+	inputs := make([]bson.A, 0, len(exprs))
+	for _, expr := range exprs {
+		input, null, err := evaluateArray(scope, op, expr, "inputs")
+		if err != nil {
+			return nil, err
+		} else if null {
+			return nil, nil
+		}
+		inputs = append(inputs, input)
+	}
+
+	// get longest flag
+	longest, _ := params["useLongestLength"].(bool)
+
+	// get defaults
+	var defaults bson.A
+	if expr, ok := params["defaults"]; ok {
+		if !longest {
+			return nil, fmt.Errorf("%s: cannot specify defaults unless useLongestLength is true", op)
+		}
+		defaults, _, err = evaluateArray(scope, op, expr, "defaults")
+		if err != nil {
+			return nil, err
+		} else if len(defaults) != len(inputs) {
+			return nil, fmt.Errorf("%s: defaults and inputs must have the same length", op)
+		}
+	}
+
+	// get length
+	length := -1
+	for _, input := range inputs {
+		if length < 0 || (longest && len(input) > length) || (!longest && len(input) < length) {
+			length = len(input)
+		}
+	}
+
+	// zip inputs
+	result := bson.A{}
+	for i := 0; i < length; i++ {
+		tuple := make(bson.A, 0, len(inputs))
+		for j, input := range inputs {
+			if i < len(input) {
+				tuple = append(tuple, input[i])
+			} else if defaults != nil {
+				tuple = append(tuple, defaults[j])
+			} else {
+				tuple = append(tuple, nil)
+			}
+		}
+		result = append(result, tuple)
+	}
+
+	return result, nil
+}
+
+func exprArrayElemAt(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) || isNullish(args[1]) {
+		return nil, nil
+	}
+
+	// check array
+	array, ok := args[0].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%s's first argument must be an array, but is %s", op, typeName(args[0]))
+	}
+
+	// get index
+	index, err := getInteger(op, "index", args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// handle negative index
+	if index < 0 {
+		index += int64(len(array))
+	}
+
+	// check range
+	if index < 0 || index >= int64(len(array)) {
+		return bsonkit.Missing, nil
+	}
+
+	return array[index], nil
+}
+
+func exprFirstLast(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+
+	// check array
+	array, ok := args[0].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%s's argument must be an array, but is %s", op, typeName(args[0]))
+	}
+
+	// handle empty
+	if len(array) == 0 {
+		return bsonkit.Missing, nil
+	}
+
+	// get element
+	if op == "$first" {
+		return array[0], nil
+	}
+
+	return array[len(array)-1], nil
+}
+
+func exprSlice(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if anyNullish(args) {
+		return nil, nil
+	}
+
+	// check array
+	array, ok := args[0].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%s: first argument must be an array, but is %s", op, typeName(args[0]))
+	}
+	length := int64(len(array))
+
+	// handle single number
+	if len(args) == 2 {
+		n, err := getInteger(op, "second argument", args[1])
+		if err != nil {
+			return nil, err
+		}
+		if n >= 0 {
+			return array[:minInt64(n, length)], nil
+		}
+		return array[length-minInt64(-n, length):], nil
+	}
+
+	// get position and count
+	position, err := getInteger(op, "second argument", args[1])
+	if err != nil {
+		return nil, err
+	}
+	count, err := getInteger(op, "third argument", args[2])
+	if err != nil {
+		return nil, err
+	} else if count <= 0 {
+		return nil, fmt.Errorf("%s: third argument must be positive, found %d", op, count)
+	}
+
+	// get start
+	start := position
+	if start < 0 {
+		start = maxInt64(length+start, 0)
+	}
+	start = minInt64(start, length)
+
+	return array[start:minInt64(start+count, length)], nil
+}
+
+func exprIn(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// check array
+	array, ok := args[1].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%s requires an array as a second argument, found: %s", op, typeName(args[1]))
+	}
+
+	// find element
+	for _, item := range array {
+		if compareExpr(item, args[0]) == 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func exprIndexOfArray(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+
+	// check array
+	array, ok := args[0].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%s requires an array as a first argument, found: %s", op, typeName(args[0]))
+	}
+
+	// get range
+	start, end := int64(0), int64(len(array))
+	if len(args) > 2 {
+		start, err = getInteger(op, "starting index", args[2])
+		if err != nil {
+			return nil, err
+		} else if start < 0 {
+			return nil, fmt.Errorf("%s: starting index must be non-negative, found %d", op, start)
+		}
+	}
+	if len(args) > 3 {
+		end, err = getInteger(op, "ending index", args[3])
+		if err != nil {
+			return nil, err
+		} else if end < 0 {
+			return nil, fmt.Errorf("%s: ending index must be non-negative, found %d", op, end)
+		}
+		end = minInt64(end, int64(len(array)))
+	}
+
+	// find element
+	for i := start; i < end; i++ {
+		if compareExpr(array[i], args[1]) == 0 {
+			return int32(i), nil
+		}
+	}
+
+	return int32(-1), nil
+}
+
+func exprSize(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// check array
+	array, ok := args[0].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("the argument to %s must be an array, but was of type: %s", op, typeName(args[0]))
+	}
+
+	return int32(len(array)), nil
+}
+
+func exprIsArray(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	_, ok := args[0].(bson.A)
+
+	return ok, nil
+}
+
+func exprConcatArrays(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// concatenate arrays
+	result := bson.A{}
+	for _, value := range args {
+		if isNullish(value) {
+			return nil, nil
+		}
+		array, ok := value.(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("%s only supports arrays, not %s", op, typeName(value))
+		}
+		result = append(result, array...)
+	}
+
+	return result, nil
+}
+
+func exprReverseArray(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+
+	// check array
+	array, ok := args[0].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("the argument to %s must be an array, but was of type: %s", op, typeName(args[0]))
+	}
+
+	// reverse array
+	result := make(bson.A, len(array))
+	for i, item := range array {
+		result[len(array)-1-i] = item
+	}
+
+	return result, nil
+}
+
+func exprRange(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	// get start, end and step
+	start, err := getInteger(op, "starting value", args[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := getInteger(op, "ending value", args[1])
+	if err != nil {
+		return nil, err
+	}
+	step := int64(1)
+	if len(args) > 2 {
+		step, err = getInteger(op, "step value", args[2])
+		if err != nil {
+			return nil, err
+		} else if step == 0 {
+			return nil, fmt.Errorf("%s requires a non-zero step value", op)
+		}
+	}
+
+	// build range
+	result := bson.A{}
+	for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+		result = append(result, int32(i))
+	}
+
+	return result, nil
+}
+
+func exprArrayToObject(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+
+	// check array
+	array, ok := args[0].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%s requires an array input, found: %s", op, typeName(args[0]))
+	}
+
+	// build document
+	doc := bson.D{}
+	for _, item := range array {
+		// get pair
+		var key, value interface{}
+		switch item := item.(type) {
+		case bson.A:
+			if len(item) != 2 {
+				return nil, fmt.Errorf("%s requires an array of size 2 arrays", op)
+			}
+			key, value = item[0], item[1]
+		case bson.D:
+			if len(item) != 2 || item[0].Key != "k" || item[1].Key != "v" {
+				return nil, fmt.Errorf("%s requires an object with keys 'k' and 'v'", op)
+			}
+			key, value = item[0].Value, item[1].Value
+		default:
+			return nil, fmt.Errorf("%s requires an array of key-value pairs", op)
+		}
+
+		// check key
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s requires keys to be of type string, found: %s", op, typeName(key))
+		}
+
+		// set field, later keys win
+		found := false
+		for i := range doc {
+			if doc[i].Key == name {
+				doc[i].Value = value
+				found = true
+			}
+		}
+		if !found {
+			doc = append(doc, bson.E{Key: name, Value: value})
+		}
+	}
+
+	return doc, nil
+}
+
+func exprObjectToArray(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+
+	// check document
+	doc, ok := args[0].(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a document input, found: %s", op, typeName(args[0]))
+	}
+
+	// build array
+	result := make(bson.A, 0, len(doc))
+	for _, field := range doc {
+		result = append(result, bson.D{
+			{Key: "k", Value: field.Key},
+			{Key: "v", Value: field.Value},
+		})
+	}
+
+	return result, nil
+}
+
+func exprLet(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// get parameters
+	params, err := getParameters(op, arg, []string{"vars", "in"})
+	if err != nil {
+		return nil, err
+	}
+
+	// get variables
+	vars, ok := params["vars"].(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("%s: 'vars' must be a document", op)
+	}
+
+	// evaluate variables in the outer scope
+	variables := map[string]interface{}{}
+	for _, field := range vars {
+		err = validateVariable(op, field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := scope.Evaluate(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		variables[field.Key] = value
+	}
+
+	return scope.With(variables).Evaluate(params["in"])
+}
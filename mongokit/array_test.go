@@ -0,0 +1,189 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestArrayOperators(t *testing.T) {
+	doc := &bson.D{
+		{Key: "a", Value: bson.A{int32(1), int32(2), int32(3), int32(4)}},
+		{Key: "b", Value: bson.A{"x", "y"}},
+		{Key: "o", Value: bson.D{{Key: "k1", Value: "v1"}, {Key: "k2", Value: int32(2)}}},
+		{Key: "i", Value: int32(2)},
+		{Key: "n", Value: nil},
+	}
+
+	table := []struct {
+		expr interface{}
+		res  interface{}
+		err  string
+	}{
+		// map
+		{expr: bson.D{{Key: "$map", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "in", Value: bson.D{{Key: "$multiply", Value: bson.A{"$$this", "$i"}}}},
+		}}}, res: bson.A{int32(2), int32(4), int32(6), int32(8)}},
+		{expr: bson.D{{Key: "$map", Value: bson.D{
+			{Key: "input", Value: "$b"},
+			{Key: "as", Value: "item"},
+			{Key: "in", Value: bson.D{{Key: "$concat", Value: bson.A{"$$item", "!"}}}},
+		}}}, res: bson.A{"x!", "y!"}},
+		{expr: bson.D{{Key: "$map", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "in", Value: "$$item"},
+		}}}, err: "use of undefined variable: item"},
+		{expr: bson.D{{Key: "$map", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "as", Value: "Item"},
+			{Key: "in", Value: "$$Item"},
+		}}}, err: `$map: "Item" starts with an invalid character for a user variable name`},
+		{expr: bson.D{{Key: "$map", Value: bson.D{{Key: "input", Value: "$n"}, {Key: "in", Value: "$$this"}}}}, res: nil},
+		{expr: bson.D{{Key: "$map", Value: bson.D{{Key: "input", Value: "$i"}, {Key: "in", Value: "$$this"}}}}, err: "$map requires 'input' to be an array, found: int"},
+		{expr: bson.D{{Key: "$map", Value: bson.D{{Key: "input", Value: "$a"}}}}, err: `$map: missing "in" parameter`},
+		// filter
+		{expr: bson.D{{Key: "$filter", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "cond", Value: bson.D{{Key: "$gt", Value: bson.A{"$$this", "$i"}}}},
+		}}}, res: bson.A{int32(3), int32(4)}},
+		{expr: bson.D{{Key: "$filter", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "as", Value: "n"},
+			{Key: "cond", Value: bson.D{{Key: "$gte", Value: bson.A{"$$n", "$i"}}}},
+			{Key: "limit", Value: int32(2)},
+		}}}, res: bson.A{int32(2), int32(3)}},
+		{expr: bson.D{{Key: "$filter", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "cond", Value: false},
+		}}}, res: bson.A{}},
+		{expr: bson.D{{Key: "$filter", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "cond", Value: true},
+			{Key: "limit", Value: int32(0)},
+		}}}, err: "$filter: limit must be greater than 0, found 0"},
+		// reduce
+		{expr: bson.D{{Key: "$reduce", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "initialValue", Value: int32(0)},
+			{Key: "in", Value: bson.D{{Key: "$add", Value: bson.A{"$$value", "$$this"}}}},
+		}}}, res: int32(10)},
+		{expr: bson.D{{Key: "$reduce", Value: bson.D{
+			{Key: "input", Value: "$b"},
+			{Key: "initialValue", Value: ""},
+			{Key: "in", Value: bson.D{{Key: "$concat", Value: bson.A{"$$value", "$$this"}}}},
+		}}}, res: "xy"},
+		{expr: bson.D{{Key: "$reduce", Value: bson.D{
+			{Key: "input", Value: bson.A{}},
+			{Key: "initialValue", Value: "$i"},
+			{Key: "in", Value: "$$this"},
+		}}}, res: int32(2)},
+		{expr: bson.D{{Key: "$reduce", Value: bson.D{
+			{Key: "input", Value: "$a"},
+			{Key: "initialValue", Value: int32(0)},
+			{Key: "in", Value: bson.D{{Key: "$map", Value: bson.D{
+				{Key: "input", Value: bson.A{"$$value"}},
+				{Key: "as", Value: "v"},
+				{Key: "in", Value: bson.D{{Key: "$add", Value: bson.A{"$$v", "$$this"}}}},
+			}}}},
+		}}}, err: "$add: only supports numeric or date types, not array"},
+		// zip
+		{expr: bson.D{{Key: "$zip", Value: bson.D{{Key: "inputs", Value: bson.A{"$a", "$b"}}}}}, res: bson.A{
+			bson.A{int32(1), "x"},
+			bson.A{int32(2), "y"},
+		}},
+		{expr: bson.D{{Key: "$zip", Value: bson.D{
+			{Key: "inputs", Value: bson.A{"$b", bson.A{true}}},
+			{Key: "useLongestLength", Value: true},
+			{Key: "defaults", Value: bson.A{"z", false}},
+		}}}, res: bson.A{
+			bson.A{"x", true},
+			bson.A{"y", false},
+		}},
+		{expr: bson.D{{Key: "$zip", Value: bson.D{{Key: "inputs", Value: bson.A{"$a", "$n"}}}}}, res: nil},
+		{expr: bson.D{{Key: "$zip", Value: bson.D{
+			{Key: "inputs", Value: bson.A{"$a"}},
+			{Key: "defaults", Value: bson.A{int32(0)}},
+		}}}, err: "$zip: cannot specify defaults unless useLongestLength is true"},
+		// element access
+		{expr: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$a", int32(1)}}}, res: int32(2)},
+		{expr: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$a", int32(-1)}}}, res: int32(4)},
+		{expr: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$a", int32(10)}}}, res: bsonkit.Missing},
+		{expr: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$n", int32(0)}}}, res: nil},
+		{expr: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$a", 1.5}}}, err: "$arrayElemAt: index must be an integer, found double"},
+		{expr: bson.D{{Key: "$first", Value: "$a"}}, res: int32(1)},
+		{expr: bson.D{{Key: "$last", Value: "$a"}}, res: int32(4)},
+		{expr: bson.D{{Key: "$last", Value: bson.A{bson.A{}}}}, res: bsonkit.Missing},
+		// slice
+		{expr: bson.D{{Key: "$slice", Value: bson.A{"$a", int32(2)}}}, res: bson.A{int32(1), int32(2)}},
+		{expr: bson.D{{Key: "$slice", Value: bson.A{"$a", int32(-3)}}}, res: bson.A{int32(2), int32(3), int32(4)}},
+		{expr: bson.D{{Key: "$slice", Value: bson.A{"$a", int32(1), int32(2)}}}, res: bson.A{int32(2), int32(3)}},
+		{expr: bson.D{{Key: "$slice", Value: bson.A{"$a", int32(-2), int32(5)}}}, res: bson.A{int32(3), int32(4)}},
+		{expr: bson.D{{Key: "$slice", Value: bson.A{"$a", int32(10), int32(5)}}}, res: bson.A{}},
+		{expr: bson.D{{Key: "$slice", Value: bson.A{"$a", int32(1), int32(0)}}}, err: "$slice: third argument must be positive, found 0"},
+		// membership
+		{expr: bson.D{{Key: "$in", Value: bson.A{int64(3), "$a"}}}, res: true},
+		{expr: bson.D{{Key: "$in", Value: bson.A{"z", "$b"}}}, res: false},
+		{expr: bson.D{{Key: "$in", Value: bson.A{"z", "$x"}}}, err: "$in requires an array as a second argument, found: missing"},
+		{expr: bson.D{{Key: "$indexOfArray", Value: bson.A{"$a", int32(3)}}}, res: int32(2)},
+		{expr: bson.D{{Key: "$indexOfArray", Value: bson.A{"$a", int32(1), int32(1)}}}, res: int32(-1)},
+		{expr: bson.D{{Key: "$indexOfArray", Value: bson.A{"$a", int32(4), int32(0), int32(3)}}}, res: int32(-1)},
+		{expr: bson.D{{Key: "$indexOfArray", Value: bson.A{"$a", int32(4), int32(5)}}}, res: int32(-1)},
+		{expr: bson.D{{Key: "$indexOfArray", Value: bson.A{"$n", int32(4)}}}, res: nil},
+		// misc
+		{expr: bson.D{{Key: "$size", Value: "$a"}}, res: int32(4)},
+		{expr: bson.D{{Key: "$size", Value: "$x"}}, err: "the argument to $size must be an array, but was of type: missing"},
+		{expr: bson.D{{Key: "$isArray", Value: bson.A{"$b"}}}, res: true},
+		{expr: bson.D{{Key: "$isArray", Value: "$i"}}, res: false},
+		{expr: bson.D{{Key: "$concatArrays", Value: bson.A{"$a", "$b"}}}, res: bson.A{int32(1), int32(2), int32(3), int32(4), "x", "y"}},
+		{expr: bson.D{{Key: "$concatArrays", Value: bson.A{"$a", "$n"}}}, res: nil},
+		{expr: bson.D{{Key: "$reverseArray", Value: "$b"}}, res: bson.A{"y", "x"}},
+		{expr: bson.D{{Key: "$range", Value: bson.A{int32(0), int32(5), int32(2)}}}, res: bson.A{int32(0), int32(2), int32(4)}},
+		{expr: bson.D{{Key: "$range", Value: bson.A{int32(3), int32(0), int32(-1)}}}, res: bson.A{int32(3), int32(2), int32(1)}},
+		{expr: bson.D{{Key: "$range", Value: bson.A{int32(0), int32(3), int32(0)}}}, err: "$range requires a non-zero step value"},
+		// objects
+		{expr: bson.D{{Key: "$objectToArray", Value: "$o"}}, res: bson.A{
+			bson.D{{Key: "k", Value: "k1"}, {Key: "v", Value: "v1"}},
+			bson.D{{Key: "k", Value: "k2"}, {Key: "v", Value: int32(2)}},
+		}},
+		{expr: bson.D{{Key: "$arrayToObject", Value: bson.A{bson.A{
+			bson.A{"a", int32(1)},
+			bson.D{{Key: "k", Value: "b"}, {Key: "v", Value: int32(2)}},
+			bson.A{"a", int32(3)},
+		}}}}, res: bson.D{{Key: "a", Value: int32(3)}, {Key: "b", Value: int32(2)}}},
+		{expr: bson.D{{Key: "$arrayToObject", Value: bson.A{bson.A{bson.A{int32(1), int32(2)}}}}}, err: "$arrayToObject requires keys to be of type string, found: int"},
+		// let
+		{expr: bson.D{{Key: "$let", Value: bson.D{
+			{Key: "vars", Value: bson.D{{Key: "x", Value: "$i"}, {Key: "y", Value: int32(3)}}},
+			{Key: "in", Value: bson.D{{Key: "$multiply", Value: bson.A{"$$x", "$$y"}}}},
+		}}}, res: int32(6)},
+		{expr: bson.D{{Key: "$let", Value: bson.D{
+			{Key: "vars", Value: bson.D{{Key: "this", Value: "$i"}}},
+			{Key: "in", Value: bson.D{{Key: "$map", Value: bson.D{
+				{Key: "input", Value: "$b"},
+				{Key: "as", Value: "s"},
+				{Key: "in", Value: bson.A{"$$s", "$$this"}},
+			}}}},
+		}}}, res: bson.A{bson.A{"x", int32(2)}, bson.A{"y", int32(2)}}},
+		{expr: bson.D{{Key: "$let", Value: bson.D{
+			{Key: "vars", Value: bson.D{{Key: "a.b", Value: int32(1)}}},
+			{Key: "in", Value: true},
+		}}}, err: `$let: "a.b" contains an invalid character for a variable name`},
+	}
+
+	for _, item := range table {
+		res, err := Evaluate(doc, item.expr, nil)
+		if item.err != "" {
+			assert.Error(t, err, item.expr)
+			if err != nil {
+				assert.Equal(t, item.err, err.Error(), item.expr)
+			}
+		} else {
+			assert.NoError(t, err, item.expr)
+			assert.Equal(t, item.res, res, item.expr)
+		}
+	}
+}
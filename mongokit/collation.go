@@ -0,0 +1,51 @@
+package mongokit
+
+import (
+	"fmt"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// CaseInsensitive will return whether the specified collation compares strings
+// case-insensitively. This is the case for a strength of 1 or 2 unless the
+// case level is enabled. Strings are then compared using simple Unicode case
+// folding, the locale, diacritic insensitivity of strength 1 and all other
+// collation settings are not applied. An error is returned if the strength or
+// case level have an invalid value.
+func CaseInsensitive(collation bsonkit.Doc) (bool, error) {
+	// check collation
+	if collation == nil {
+		return false, nil
+	}
+
+	// get strength
+	strength := int64(3)
+	if value := bsonkit.Get(collation, "strength"); value != bsonkit.Missing {
+		var ok bool
+		strength, ok = toInt64(value)
+		if !ok || strength < 1 || strength > 5 {
+			return false, fmt.Errorf("invalid collation strength %v", value)
+		}
+	}
+
+	// get case level
+	var caseLevel bool
+	if value := bsonkit.Get(collation, "caseLevel"); value != bsonkit.Missing {
+		var ok bool
+		caseLevel, ok = value.(bool)
+		if !ok {
+			return false, fmt.Errorf("invalid collation case level %v", value)
+		}
+	}
+
+	return strength <= 2 && !caseLevel, nil
+}
+
+func foldColumns(columns []bsonkit.Column, fold bool) []bsonkit.Column {
+	// set fold
+	for i := range columns {
+		columns[i].Fold = fold
+	}
+
+	return columns
+}
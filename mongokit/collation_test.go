@@ -0,0 +1,76 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestCaseInsensitive(t *testing.T) {
+	for _, item := range []struct {
+		collation bson.M
+		result    bool
+		err       string
+	}{
+		{nil, false, ""},
+		{bson.M{"locale": "en"}, false, ""},
+		{bson.M{"locale": "en", "strength": int32(3)}, false, ""},
+		{bson.M{"locale": "en", "strength": int32(2)}, true, ""},
+		{bson.M{"locale": "en", "strength": int64(1)}, true, ""},
+		{bson.M{"locale": "en", "strength": int32(2), "caseLevel": true}, false, ""},
+		{bson.M{"locale": "en", "strength": int32(2), "caseLevel": false}, true, ""},
+		{bson.M{"strength": int32(6)}, false, "invalid collation strength 6"},
+		{bson.M{"strength": "2"}, false, "invalid collation strength 2"},
+		{bson.M{"caseLevel": "true"}, false, "invalid collation case level true"},
+	} {
+		var collation bsonkit.Doc
+		if item.collation != nil {
+			collation = bsonkit.MustConvert(item.collation)
+		}
+
+		res, err := CaseInsensitive(collation)
+		if item.err != "" {
+			assert.Error(t, err)
+			assert.Equal(t, item.err, err.Error())
+		} else {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, item.result, res, item.collation)
+	}
+}
+
+func TestMatchFold(t *testing.T) {
+	doc := bsonkit.MustConvert(bson.M{
+		"name": "Alice",
+		"tags": bson.A{"Foo", "BAR"},
+	})
+
+	for _, item := range []struct {
+		query bson.M
+		match bool
+		fold  bool
+	}{
+		{bson.M{"name": "alice"}, false, true},
+		{bson.M{"name": bson.M{"$ne": "ALICE"}}, true, false},
+		{bson.M{"name": bson.M{"$gt": "alex", "$lt": "ALIEN"}}, false, true},
+		{bson.M{"name": bson.M{"$in": bson.A{"bob", "aLiCe"}}}, false, true},
+		{bson.M{"name": bson.M{"$nin": bson.A{"aLiCe"}}}, true, false},
+		{bson.M{"tags": "bar"}, false, true},
+		{bson.M{"tags": bson.M{"$all": bson.A{"foo", "bar"}}}, false, true},
+		{bson.M{"$or": bson.A{bson.M{"name": "bob"}, bson.M{"name": "alice"}}}, false, true},
+		{bson.M{"name": "bob"}, false, false},
+	} {
+		query := bsonkit.MustConvert(item.query)
+
+		res, err := Match(doc, query)
+		assert.NoError(t, err)
+		assert.Equal(t, item.match, res, item.query)
+
+		res, err = MatchFold(doc, query)
+		assert.NoError(t, err)
+		assert.Equal(t, item.fold, res, item.query)
+	}
+}
@@ -1,7 +1,10 @@
 package mongokit
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,6 +14,10 @@ import (
 
 // TODO: Test Collection.
 
+// checkInterval is the number of documents processed between checks of the
+// context for cancellation.
+const checkInterval = 1000
+
 // Result is returned by collection operations.
 type Result struct {
 	// The list of found or deleted documents.
@@ -30,28 +37,43 @@ type Result struct {
 // collection that offers basic CRUD capabilities. The collection is not safe
 // from concurrent access and does not roll back changes on errors. Therefore,
 // the recommended approach is to clone the collection before making changes.
+//
+// The documents are kept in their natural order, which is the order in which
+// they have been inserted. Updated and replaced documents keep their position.
+// The document set identifies documents by their _id field, except for time
+// series collections, which allow duplicate _id values.
+//
+// Time series collections additionally group their documents in buckets to
+// speed up time range queries. They do not support updates and replacements.
 type Collection struct {
 	Documents *bsonkit.Set
 	Indexes   map[string]*Index
+	Buckets   *Buckets
+
+	// The encoded BSON size of all documents in bytes.
+	Size int
+
+	// Whether the documents before a change should be recorded by users of
+	// the collection, e.g. as pre-images of change stream events.
+	PreImages bool
+
+	// Whether documents or indexes have been removed or replaced since the
+	// collection has been created or compacted. Users that remove documents
+	// from the set directly must set the flag.
+	Removed bool
 }
 
 // NewCollection will create and return a new collection.
 func NewCollection(idIndex bool) *Collection {
 	// create collection
 	coll := &Collection{
-		Documents: bsonkit.NewSet(nil),
+		Documents: bsonkit.NewKeyedSet(nil),
 		Indexes:   map[string]*Index{},
 	}
 
 	// add default index if requested
 	if idIndex {
-		var err error
-		coll.Indexes["_id_"], err = CreateIndex(IndexConfig{
-			Key: bsonkit.MustConvert(bson.M{
-				"_id": int32(1),
-			}),
-			Unique: true,
-		})
+		err := coll.EnsureIDIndex()
 		if err != nil {
 			panic(err)
 		}
@@ -60,36 +82,106 @@ func NewCollection(idIndex bool) *Collection {
 	return coll
 }
 
-// Find will look up the documents that match the specified query.
-func (c *Collection) Find(query, sort bsonkit.Doc, skip, limit int) (*Result, error) {
-	// get documents
-	list := c.Documents.List
+// IDIndexConfig returns the configuration of the unique "_id_" index that
+// is present in every regular collection.
+func IDIndexConfig() IndexConfig {
+	return IndexConfig{
+		Key: bsonkit.MustConvert(bson.M{
+			"_id": int32(1),
+		}),
+		Unique: true,
+	}
+}
 
-	// sort documents
-	var err error
-	if sort != nil && len(*sort) > 0 {
-		list, err = Sort(list, sort)
-		if err != nil {
-			return nil, err
-		}
+// EnsureIDIndex will add the unique "_id_" index if it is missing or replace
+// it if it has a different configuration. The index is built from the existing
+// documents and an error is returned if documents share the same _id.
+func (c *Collection) EnsureIDIndex() error {
+	// get config
+	config := IDIndexConfig()
+
+	// check existing index
+	if index, ok := c.Indexes["_id_"]; ok && config.Equal(index.Config()) {
+		return nil
 	}
 
-	// adjust limit
-	if limit > 0 {
-		limit += skip
+	// create index
+	index, err := CreateIndex(config)
+	if err != nil {
+		return err
 	}
 
-	// filter documents
-	list, err = Filter(list, query, limit)
+	// build index
+	ok, err := index.Build(c.Documents.List)
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("duplicate document for index %q", "_id_")
+	}
+
+	// set index
+	c.Indexes["_id_"] = index
+
+	return nil
+}
+
+// NewTimeSeriesCollection will create and return a new time series collection.
+func NewTimeSeriesCollection(config TimeSeriesConfig) (*Collection, error) {
+	// create buckets
+	buckets, err := NewBuckets(config)
 	if err != nil {
 		return nil, err
 	}
 
-	// apply skip
-	if skip > len(list) {
-		list = nil
-	} else {
-		list = list[skip:]
+	// create collection
+	coll := &Collection{
+		Documents: bsonkit.NewSet(nil),
+		Indexes:   map[string]*Index{},
+		Buckets:   buckets,
+	}
+
+	return coll, nil
+}
+
+// Find will look up the documents that match the specified query.
+func (c *Collection) Find(ctx context.Context, query, sort bsonkit.Doc, skip, limit int) (*Result, error) {
+	return c.FindCollated(ctx, query, sort, nil, skip, limit)
+}
+
+// FindCollated will look up the documents that match the specified query using
+// the specified collation to compare strings when matching and sorting. See
+// CaseInsensitive for the supported collations.
+func (c *Collection) FindCollated(ctx context.Context, query, sort, collation bsonkit.Doc, skip, limit int) (*Result, error) {
+	// get fold
+	fold, err := CaseInsensitive(collation)
+	if err != nil {
+		return nil, err
+	}
+
+	// select documents
+	list, err := c.find(ctx, query, sort, fold, skip, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Matched: list,
+	}, nil
+}
+
+// FindAfter will look up the documents that match the specified query and have
+// a record ID greater than the specified record ID.
+func (c *Collection) FindAfter(ctx context.Context, recordID int64, query, sort bsonkit.Doc, skip, limit int) (*Result, error) {
+	// get documents
+	list := c.Documents.List
+	if recordID > 0 {
+		list = list[c.Documents.After(uint64(recordID-1)):]
+	}
+
+	// select documents
+	list, err := selectDocuments(ctx, list, query, sort, false, skip, limit)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Result{
@@ -97,6 +189,20 @@ func (c *Collection) Find(query, sort bsonkit.Doc, skip, limit int) (*Result, er
 	}, nil
 }
 
+// RecordID returns the record ID of the document. Record IDs are positive,
+// increase monotonically in insertion order and are kept when documents are
+// updated or replaced. It may return false if the document is not part of the
+// collection.
+func (c *Collection) RecordID(doc bsonkit.Doc) (int64, bool) {
+	// get sequence
+	seq, ok := c.Documents.Sequence(doc)
+	if !ok {
+		return 0, false
+	}
+
+	return int64(seq) + 1, true
+}
+
 // Insert will add the specified document to the collection.
 func (c *Collection) Insert(doc bsonkit.Doc) (*Result, error) {
 	// ensure object id
@@ -107,6 +213,14 @@ func (c *Collection) Insert(doc bsonkit.Doc) (*Result, error) {
 		}
 	}
 
+	// add document to bucket
+	if c.Buckets != nil {
+		err := c.Buckets.Add(doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// add document to all indexes
 	for name, index := range c.Indexes {
 		ok, err := index.Add(doc)
@@ -122,28 +236,145 @@ func (c *Collection) Insert(doc bsonkit.Doc) (*Result, error) {
 		return nil, fmt.Errorf("unable to add document to collection")
 	}
 
+	// update size
+	c.Size += bsonkit.Size(doc)
+
 	return &Result{
 		Modified: bsonkit.List{doc},
 	}, nil
 }
 
-// Replace will look up the first document that matches the query and if found
-// replace it with the specified document.
-func (c *Collection) Replace(query, repl, sort bsonkit.Doc) (*Result, error) {
-	// get documents
-	list := c.Documents.List
+// InsertMany will insert the specified documents. Unlike inserting documents
+// one by one, all documents are first checked against the indexes and each
+// other before the accepted documents are merged into the indexes in sorted
+// order. Failed documents are skipped and their errors are returned at their
+// position. If ordered, no documents after the first failed document are
+// inserted. As the collection is not modified by failed documents, it does not
+// need to be cloned for every document. The final error is only returned if
+// the accepted documents could not be added, in which case the collection may
+// have been partially modified.
+func (c *Collection) InsertMany(list bsonkit.List, ordered bool) (*Result, []error, error) {
+	// prepare errors
+	errs := make([]error, len(list))
+
+	// prepare batch documents
+	docs := bsonkit.NewSet(nil)
+	if c.Documents.Keyed() {
+		docs = bsonkit.NewKeyedSet(nil)
+	}
 
-	// sort documents
-	var err error
-	if sort != nil && len(*sort) > 0 {
-		list, err = Sort(list, sort)
+	// prepare batch indexes
+	batch := make(map[string]*Index, len(c.Indexes))
+	for name, index := range c.Indexes {
+		batch[name] = index.empty()
+	}
+
+	// check documents
+	accepted := make(bsonkit.List, 0, len(list))
+	for i, doc := range list {
+		err := c.check(doc, docs, batch)
 		if err != nil {
-			return nil, err
+			errs[i] = err
+			if ordered {
+				break
+			}
+			continue
+		}
+		accepted = append(accepted, doc)
+	}
+
+	// merge indexes
+	for name, index := range c.Indexes {
+		index.merge(batch[name])
+	}
+
+	// add documents to buckets
+	if c.Buckets != nil {
+		err := c.Buckets.AddList(accepted)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
-	// filter documents
-	list, err = Filter(list, query, 1)
+	// add documents
+	for _, doc := range accepted {
+		// add document
+		if !c.Documents.Add(doc) {
+			return nil, nil, fmt.Errorf("unable to add document to collection")
+		}
+
+		// update size
+		c.Size += bsonkit.Size(doc)
+	}
+
+	return &Result{
+		Modified: accepted,
+	}, errs, nil
+}
+
+func (c *Collection) check(doc bsonkit.Doc, docs *bsonkit.Set, batch map[string]*Index) error {
+	// ensure object id
+	if bsonkit.Get(doc, "_id") == bsonkit.Missing {
+		_, err := bsonkit.Put(doc, "_id", primitive.NewObjectID(), true)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check bucket
+	if c.Buckets != nil {
+		_, err := c.Buckets.start(doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check existing and batched documents of all indexes
+	for name, index := range c.Indexes {
+		ok, err := index.Has(doc)
+		if err != nil {
+			return err
+		} else if ok {
+			return fmt.Errorf("duplicate document for index %q", name)
+		}
+		ok, err = batch[name].Has(doc)
+		if err != nil {
+			return err
+		} else if ok {
+			return fmt.Errorf("duplicate document for index %q", name)
+		}
+	}
+
+	// check existing and batched documents, which is only relevant for
+	// collections without an _id index
+	if c.Documents.Has(doc) || docs.Has(doc) {
+		return fmt.Errorf("unable to add document to collection")
+	}
+
+	// add document to batch indexes
+	for _, index := range batch {
+		_, err := index.Add(doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	// add document to batch
+	docs.Add(doc)
+
+	return nil
+}
+
+// Replace will look up the first document that matches the query and if found
+// replace it with the specified document.
+func (c *Collection) Replace(ctx context.Context, query, repl, sort bsonkit.Doc) (*Result, error) {
+	// check buckets
+	if c.Buckets != nil {
+		return nil, fmt.Errorf("time series collections do not support replacements")
+	}
+
+	// select document
+	list, err := c.find(ctx, query, sort, false, 0, 1)
 	if err != nil {
 		return nil, err
 	}
@@ -188,6 +419,10 @@ func (c *Collection) Replace(query, repl, sort bsonkit.Doc) (*Result, error) {
 		return nil, fmt.Errorf("unable to replace document in collection")
 	}
 
+	// update size and flag
+	c.Size += bsonkit.Size(repl) - bsonkit.Size(list[0])
+	c.Removed = true
+
 	return &Result{
 		Matched:  list,
 		Modified: bsonkit.List{repl},
@@ -196,37 +431,18 @@ func (c *Collection) Replace(query, repl, sort bsonkit.Doc) (*Result, error) {
 
 // Update will look up all documents that match the specified query and update
 // them according to the update document.
-func (c *Collection) Update(query, update, sort bsonkit.Doc, skip, limit int, arrayFilters bsonkit.List) (*Result, error) {
-	// get documents
-	list := c.Documents.List
-
-	// sort documents
-	var err error
-	if sort != nil && len(*sort) > 0 {
-		list, err = Sort(list, sort)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// adjust limit
-	if limit > 0 {
-		limit += skip
+func (c *Collection) Update(ctx context.Context, query, update, sort bsonkit.Doc, skip, limit int, arrayFilters bsonkit.List) (*Result, error) {
+	// check buckets
+	if c.Buckets != nil {
+		return nil, fmt.Errorf("time series collections do not support updates")
 	}
 
-	// filter documents
-	list, err = Filter(list, query, limit)
+	// select documents
+	list, err := c.find(ctx, query, sort, false, skip, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	// apply skip
-	if skip > len(list) {
-		list = nil
-	} else {
-		list = list[skip:]
-	}
-
 	// check list
 	if len(list) == 0 {
 		return &Result{}, nil
@@ -279,6 +495,10 @@ func (c *Collection) Update(query, update, sort bsonkit.Doc, skip, limit int, ar
 		}
 	}
 
+	// update size and flag
+	c.Size += bsonkit.SizeList(newList) - bsonkit.SizeList(list)
+	c.Removed = c.Removed || len(list) > 0
+
 	return &Result{
 		Matched:  list,
 		Modified: newList,
@@ -289,6 +509,11 @@ func (c *Collection) Update(query, update, sort bsonkit.Doc, skip, limit int, ar
 // Upsert will insert a document based on the specified query and either the
 // replacement document or update document.
 func (c *Collection) Upsert(query, repl, update bsonkit.Doc, arrayFilters bsonkit.List) (*Result, error) {
+	// check buckets
+	if c.Buckets != nil {
+		return nil, fmt.Errorf("time series collections do not support upserts")
+	}
+
 	// extract query
 	doc, err := Extract(query)
 	if err != nil {
@@ -361,43 +586,22 @@ func (c *Collection) Upsert(query, repl, update bsonkit.Doc, arrayFilters bsonki
 		return nil, fmt.Errorf("unable to add document to collection")
 	}
 
+	// update size
+	c.Size += bsonkit.Size(doc)
+
 	return &Result{
 		Upserted: doc,
 	}, nil
 }
 
 // Delete will remove all documents that match the specified query.
-func (c *Collection) Delete(query, sort bsonkit.Doc, skip, limit int) (*Result, error) {
-	// get documents
-	list := c.Documents.List
-
-	// sort documents
-	var err error
-	if sort != nil && len(*sort) > 0 {
-		list, err = Sort(list, sort)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// adjust limit
-	if limit > 0 {
-		limit += skip
-	}
-
-	// filter documents
-	list, err = Filter(list, query, limit)
+func (c *Collection) Delete(ctx context.Context, query, sort bsonkit.Doc, skip, limit int) (*Result, error) {
+	// select documents
+	list, err := c.find(ctx, query, sort, false, skip, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	// apply skip
-	if skip > len(list) {
-		list = nil
-	} else {
-		list = list[skip:]
-	}
-
 	// update indexes
 	for _, doc := range list {
 		for name, index := range c.Indexes {
@@ -410,6 +614,15 @@ func (c *Collection) Delete(query, sort bsonkit.Doc, skip, limit int) (*Result,
 		}
 	}
 
+	// update buckets
+	if c.Buckets != nil {
+		for _, doc := range list {
+			if !c.Buckets.Remove(doc) {
+				return nil, fmt.Errorf("unable to remove document from bucket")
+			}
+		}
+	}
+
 	// remove documents
 	for _, doc := range list {
 		if !c.Documents.Remove(doc) {
@@ -417,6 +630,10 @@ func (c *Collection) Delete(query, sort bsonkit.Doc, skip, limit int) (*Result,
 		}
 	}
 
+	// update size and flag
+	c.Size -= bsonkit.SizeList(list)
+	c.Removed = c.Removed || len(list) > 0
+
 	return &Result{
 		Matched: list,
 	}, nil
@@ -425,7 +642,7 @@ func (c *Collection) Delete(query, sort bsonkit.Doc, skip, limit int) (*Result,
 // CreateIndex will create and build an index based on the specified
 // configuration. If the index name is missing, it will be generated from the
 // config and returned.
-func (c *Collection) CreateIndex(name string, config IndexConfig) (string, error) {
+func (c *Collection) CreateIndex(ctx context.Context, name string, config IndexConfig) (string, error) {
 	// prepare error
 	var err error
 
@@ -437,6 +654,22 @@ func (c *Collection) CreateIndex(name string, config IndexConfig) (string, error
 		}
 	}
 
+	// check name length
+	if len(name) > MaxIndexNameLength {
+		return "", fmt.Errorf("index name %q is too long (%d byte max)", name, MaxIndexNameLength)
+	}
+
+	// check id index, which is always unique and therefore accepted without
+	// the unique option as done by MongoDB
+	if name == "_id_" {
+		if bsonkit.Compare(*config.Key, *IDIndexConfig().Key) != 0 || config.Sparse || config.Partial != nil || config.Expiry > 0 || config.Collation != nil {
+			return "", fmt.Errorf("index name %q is reserved for the default _id index", name)
+		} else if _, ok := c.Indexes[name]; ok {
+			return name, nil
+		}
+		config.Unique = true
+	}
+
 	// return if existing index is equal
 	if index, ok := c.Indexes[name]; ok {
 		if config.Equal(index.Config()) {
@@ -460,25 +693,46 @@ func (c *Collection) CreateIndex(name string, config IndexConfig) (string, error
 	// add index
 	c.Indexes[name] = index
 
-	// build index
-	ok, err := index.Build(c.Documents.List)
-	if err != nil {
-		return "", err
-	} else if !ok {
-		return "", fmt.Errorf("duplicate document for index %q", name)
+	// build index in chunks
+	list := c.Documents.List
+	for i := 0; i < len(list); i += checkInterval {
+		// check context
+		err = ctx.Err()
+		if err != nil {
+			return "", err
+		}
+
+		// get chunk
+		end := i + checkInterval
+		if end > len(list) {
+			end = len(list)
+		}
+
+		// build chunk
+		ok, err := index.Build(list[i:end])
+		if err != nil {
+			return "", err
+		} else if !ok {
+			return "", fmt.Errorf("duplicate document for index %q", name)
+		}
 	}
 
 	return name, nil
 }
 
-// DropIndex will drop the specific index or drop all indexes if no name has
-// been specified.
+// DropIndex will drop the specific index or drop all indexes except the _id
+// index if no name or "*" has been specified.
 func (c *Collection) DropIndex(name string) ([]string, error) {
 	// collect dropped
 	var dropped []string
 
 	// drop single index
-	if name != "" {
+	if name != "" && name != "*" {
+		// check id index
+		if name == "_id_" {
+			return nil, fmt.Errorf("cannot drop _id index")
+		}
+
 		// check existence
 		if _, ok := c.Indexes[name]; !ok {
 			return nil, fmt.Errorf("missing index %q", name)
@@ -492,7 +746,7 @@ func (c *Collection) DropIndex(name string) ([]string, error) {
 	}
 
 	// drop all indexes
-	if name == "" {
+	if name == "" || name == "*" {
 		for name := range c.Indexes {
 			if name != "_id_" {
 				// drop index
@@ -504,6 +758,9 @@ func (c *Collection) DropIndex(name string) ([]string, error) {
 		}
 	}
 
+	// set flag
+	c.Removed = c.Removed || len(dropped) > 0
+
 	return dropped, nil
 }
 
@@ -513,6 +770,9 @@ func (c *Collection) Clone() *Collection {
 	clone := &Collection{
 		Documents: c.Documents.Clone(),
 		Indexes:   map[string]*Index{},
+		Size:      c.Size,
+		PreImages: c.PreImages,
+		Removed:   c.Removed,
 	}
 
 	// clone indexes
@@ -520,5 +780,438 @@ func (c *Collection) Clone() *Collection {
 		clone.Indexes[name] = index.Clone()
 	}
 
+	// clone buckets
+	if c.Buckets != nil {
+		clone.Buckets = c.Buckets.Clone()
+	}
+
 	return clone
 }
+
+// Compact will return a rebuilt copy of the collection that does not share any
+// structures with the original collection. This releases memory that is still
+// retained by shared structures after documents have been removed. The
+// Removed flag is not set on the returned collection.
+func (c *Collection) Compact() (*Collection, error) {
+	// rebuild documents
+	documents := c.Documents.Rebuild()
+	list := documents.List
+
+	// create collection
+	compact := &Collection{
+		Documents: documents,
+		Indexes:   map[string]*Index{},
+		Size:      c.Size,
+		PreImages: c.PreImages,
+	}
+
+	// rebuild indexes
+	for name, index := range c.Indexes {
+		// create index
+		idx, err := CreateIndex(index.Config())
+		if err != nil {
+			return nil, err
+		}
+
+		// build index
+		ok, err := idx.Build(list)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, fmt.Errorf("duplicate document for index %q", name)
+		}
+
+		// add index
+		compact.Indexes[name] = idx
+	}
+
+	// rebuild buckets
+	if c.Buckets != nil {
+		// create buckets
+		buckets, err := NewBuckets(c.Buckets.Config())
+		if err != nil {
+			return nil, err
+		}
+
+		// add documents
+		for _, doc := range list {
+			err = buckets.Add(doc)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// set buckets
+		compact.Buckets = buckets
+	}
+
+	return compact, nil
+}
+
+// documents will return the list of documents that may match the query.
+func (c *Collection) documents(query bsonkit.Doc) bsonkit.List {
+	// select buckets
+	if c.Buckets != nil {
+		return c.Buckets.Select(query)
+	}
+
+	return c.Documents.List
+}
+
+// find will select the documents that match the query. If the query has
+// equality conditions for all fields of an index, only the documents found in
+// the index are matched. Otherwise, if the sort matches the columns of an index
+// or their reverse, the documents are selected by walking the index instead of
+// sorting them. Indexes are only used if they compare strings in the same way
+// as requested by the fold flag.
+func (c *Collection) find(ctx context.Context, query, sort bsonkit.Doc, fold bool, skip, limit int) (bsonkit.List, error) {
+	// use lookup index if available
+	index, key := c.lookupIndex(query, fold)
+	if index != nil {
+		return selectDocuments(ctx, c.lookup(index, key), query, sort, fold, skip, limit)
+	}
+
+	// use sort index if available
+	index, reverse := c.sortIndex(sort, fold)
+	if index != nil {
+		return selectIndexed(ctx, index, reverse, query, skip, limit)
+	}
+
+	return selectDocuments(ctx, c.documents(query), query, sort, fold, skip, limit)
+}
+
+// lookupIndex will return an index and key that can be used to look up the
+// documents that may match the equality conditions of the query. Only indexes
+// that include all documents, have top level fields and do not index arrays
+// can be used.
+func (c *Collection) lookupIndex(query bsonkit.Doc, fold bool) (*Index, bsonkit.Doc) {
+	// check buckets and query
+	if c.Buckets != nil || query == nil || len(*query) == 0 {
+		return nil, nil
+	}
+
+	// find index with the most columns
+	var index *Index
+	var name string
+	var key bson.D
+	for n, idx := range c.Indexes {
+		// skip unusable indexes
+		if idx.config.Partial != nil || idx.config.Sparse || idx.fold != fold || idx.arrays > 0 {
+			continue
+		}
+
+		// skip indexes with fewer columns or a greater name
+		if index != nil && (len(idx.columns) < len(index.columns) || len(idx.columns) == len(index.columns) && n > name) {
+			continue
+		}
+
+		// get key
+		k := make(bson.D, 0, len(idx.columns))
+		for _, column := range idx.columns {
+			if strings.Contains(column.Path, ".") {
+				break
+			}
+			value, ok := equalityValue(query, column.Path)
+			if !ok {
+				break
+			}
+			k = append(k, bson.E{Key: column.Path, Value: value})
+		}
+		if len(k) != len(idx.columns) {
+			continue
+		}
+
+		// set index
+		index, name, key = idx, n, k
+	}
+	if index == nil {
+		return nil, nil
+	}
+
+	return index, &key
+}
+
+func equalityValue(query bsonkit.Doc, path string) (interface{}, bool) {
+	// find condition
+	for _, exp := range *query {
+		if exp.Key != path {
+			continue
+		}
+
+		// unwrap $eq operator
+		value := exp.Value
+		if doc, ok := value.(bson.D); ok && len(doc) == 1 && doc[0].Key == "$eq" {
+			value = doc[0].Value
+		}
+
+		// check value, nulls also match missing fields, documents may be
+		// operators and arrays and regexes are not matched by equality
+		switch class, _ := bsonkit.Inspect(value); class {
+		case bsonkit.Number, bsonkit.String, bsonkit.Binary, bsonkit.ObjectID,
+			bsonkit.Boolean, bsonkit.Date, bsonkit.Timestamp:
+			return value, true
+		default:
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// lookup will return the documents with the specified key in natural order.
+func (c *Collection) lookup(index *Index, key bsonkit.Doc) bsonkit.List {
+	// collect documents
+	var list bsonkit.List
+	index.Ascend(key, key, func(doc bsonkit.Doc) bool {
+		list = append(list, doc)
+		return true
+	})
+
+	// restore natural order
+	seqs := make(map[bsonkit.Doc]uint64, len(list))
+	for _, doc := range list {
+		seqs[doc], _ = c.Documents.Sequence(doc)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return seqs[list[i]] < seqs[list[j]]
+	})
+
+	return list
+}
+
+// sortIndex will return an index that yields the documents in the order of
+// the specified sort and whether it must be walked in reverse. Only indexes
+// that include all documents can be used.
+func (c *Collection) sortIndex(sort bsonkit.Doc, fold bool) (*Index, bool) {
+	// check buckets and sort
+	if c.Buckets != nil || sort == nil || len(*sort) == 0 {
+		return nil, false
+	}
+
+	// get columns, errors are reported by selectDocuments
+	columns, err := Columns(sort)
+	if err != nil {
+		return nil, false
+	}
+
+	// find index
+	for _, index := range c.Indexes {
+		// skip indexes that omit documents or compare differently
+		if index.config.Partial != nil || index.config.Sparse || index.fold != fold {
+			continue
+		}
+
+		// check columns
+		if len(index.columns) != len(columns) {
+			continue
+		}
+
+		// compare columns
+		forward, backward := true, true
+		for i, column := range index.columns {
+			if column.Path != columns[i].Path {
+				forward, backward = false, false
+				break
+			}
+			if column.Reverse != columns[i].Reverse {
+				forward = false
+			} else {
+				backward = false
+			}
+		}
+		if forward {
+			return index, false
+		} else if backward {
+			return index, true
+		}
+	}
+
+	return nil, false
+}
+
+// selectIndexed will select the documents that match the query by walking the
+// index in order or reverse order. Documents with equal keys are returned in
+// the same order as by a regular sort.
+func selectIndexed(ctx context.Context, index *Index, reverse bool, query bsonkit.Doc, skip, limit int) (bsonkit.List, error) {
+	// adjust limit
+	if limit > 0 {
+		limit += skip
+	}
+
+	// prepare walk
+	var list bsonkit.List
+	var run, i int
+	var err error
+	walk := func(doc bsonkit.Doc) bool {
+		// check context
+		if i%checkInterval == 0 {
+			err = ctx.Err()
+			if err != nil {
+				return false
+			}
+		}
+		i++
+
+		// match document
+		var ok bool
+		ok, err = match(doc, query, index.fold)
+		if err != nil {
+			return false
+		} else if !ok {
+			return true
+		}
+
+		// documents with equal keys are walked in reverse when walking
+		// backwards, restore their order once the key changes
+		if reverse && len(list) > 0 && bsonkit.Order(list[len(list)-1], doc, index.columns, false) != 0 {
+			reverseList(list[run:])
+			run = len(list)
+			if limit > 0 && len(list) >= limit {
+				return false
+			}
+		}
+
+		// add document
+		list = append(list, doc)
+
+		// stop when limit is reached
+		if !reverse && limit > 0 && len(list) >= limit {
+			return false
+		}
+
+		return true
+	}
+
+	// walk index
+	if reverse {
+		index.Descend(nil, nil, walk)
+	} else {
+		index.Ascend(nil, nil, walk)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// restore order of last run
+	if reverse {
+		reverseList(list[run:])
+	}
+
+	// apply limit
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+
+	// apply skip
+	if skip > len(list) {
+		list = nil
+	} else {
+		list = list[skip:]
+	}
+
+	return list, nil
+}
+
+func reverseList(list bsonkit.List) {
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+}
+
+// selectDocuments will run the query pipeline on the provided list. Documents
+// are filtered first, then sorted and finally skipped and limited. Unsorted
+// queries stop filtering as soon as enough documents have been matched and
+// return the documents in their natural order, which may be reversed using a
+// {$natural: -1} sort. The context is checked for cancellation periodically
+// while filtering.
+func selectDocuments(ctx context.Context, list bsonkit.List, query, sort bsonkit.Doc, fold bool, skip, limit int) (bsonkit.List, error) {
+	// handle natural order
+	natural, err := NaturalOrder(sort)
+	if err != nil {
+		return nil, err
+	} else if natural != 0 {
+		sort = nil
+	}
+	if natural < 0 {
+		reversed := make(bsonkit.List, len(list))
+		for i, doc := range list {
+			reversed[len(list)-1-i] = doc
+		}
+		list = reversed
+	}
+
+	// adjust limit
+	if limit > 0 {
+		limit += skip
+	}
+
+	// filter and sort documents
+	if sort == nil || len(*sort) == 0 {
+		// filter documents until limit is reached
+		var i int
+		list = bsonkit.Select(list, limit, func(doc bsonkit.Doc) (bool, bool) {
+			// check context
+			if i%checkInterval == 0 {
+				err = ctx.Err()
+				if err != nil {
+					return false, true
+				}
+			}
+			i++
+
+			// match document
+			var ok bool
+			ok, err = match(doc, query, fold)
+			if err != nil {
+				return false, true
+			}
+
+			return ok, false
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// filter all documents into a transient list
+		filtered := bsonkit.AcquireList(0)
+		for i, doc := range list {
+			// check context
+			if i%checkInterval == 0 {
+				err = ctx.Err()
+				if err != nil {
+					bsonkit.ReleaseList(filtered)
+					return nil, err
+				}
+			}
+
+			// match document
+			ok, err := match(doc, query, fold)
+			if err != nil {
+				bsonkit.ReleaseList(filtered)
+				return nil, err
+			} else if ok {
+				filtered = append(filtered, doc)
+			}
+		}
+
+		// get columns
+		columns, err := Columns(sort)
+		if err != nil {
+			bsonkit.ReleaseList(filtered)
+			return nil, err
+		}
+
+		// sort documents and keep only the first if limited
+		list = bsonkit.SortLimit(filtered, foldColumns(columns, fold), true, limit)
+		bsonkit.ReleaseList(filtered)
+	}
+
+	// apply skip
+	if skip > len(list) {
+		list = nil
+	} else {
+		list = list[skip:]
+	}
+
+	return list, nil
+}
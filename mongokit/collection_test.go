@@ -0,0 +1,54 @@
+package mongokit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestCollectionInsertMany(t *testing.T) {
+	coll := NewCollection(false)
+
+	_, err := coll.Insert(bsonkit.MustConvert(bson.M{"_id": 1}))
+	assert.NoError(t, err)
+
+	res, errs, err := coll.InsertMany(bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 2}),
+		bsonkit.MustConvert(bson.M{"_id": 2}),
+		bsonkit.MustConvert(bson.M{"_id": 1}),
+		bsonkit.MustConvert(bson.M{"_id": 3}),
+	}, false)
+	assert.NoError(t, err)
+	assert.Len(t, res.Modified, 2)
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	assert.Error(t, errs[2])
+	assert.NoError(t, errs[3])
+	assert.Len(t, coll.Documents.List, 3)
+
+	res, errs, err = coll.InsertMany(bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 3}),
+		bsonkit.MustConvert(bson.M{"_id": 4}),
+	}, true)
+	assert.NoError(t, err)
+	assert.Empty(t, res.Modified)
+	assert.Error(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Len(t, coll.Documents.List, 3)
+
+	series, err := NewTimeSeriesCollection(TimeSeriesConfig{TimeField: "t"})
+	assert.NoError(t, err)
+
+	doc := bsonkit.MustConvert(bson.M{"_id": 1, "t": primitive.NewDateTimeFromTime(time.Now())})
+	res, errs, err = series.InsertMany(bsonkit.List{doc, doc}, false)
+	assert.NoError(t, err)
+	assert.Len(t, res.Modified, 1)
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	assert.Equal(t, 1, series.Buckets.Len())
+}
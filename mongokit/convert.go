@@ -0,0 +1,314 @@
+package mongokit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func init() {
+	// register conversion operators
+	AggregationExpressionOperators["$convert"] = exprConvert
+	AggregationExpressionOperators["$toBool"] = exprConvertTo
+	AggregationExpressionOperators["$toInt"] = exprConvertTo
+	AggregationExpressionOperators["$toLong"] = exprConvertTo
+	AggregationExpressionOperators["$toDouble"] = exprConvertTo
+	AggregationExpressionOperators["$toDecimal"] = exprConvertTo
+	AggregationExpressionOperators["$toString"] = exprConvertTo
+	AggregationExpressionOperators["$toDate"] = exprConvertTo
+	AggregationExpressionOperators["$toObjectId"] = exprConvertTo
+
+	// register type operators
+	AggregationExpressionOperators["$type"] = exprType
+	AggregationExpressionOperators["$isNumber"] = exprIsNumber
+}
+
+var convertShorthands = map[string]bsontype.Type{
+	"$toBool":     bsontype.Boolean,
+	"$toInt":      bsontype.Int32,
+	"$toLong":     bsontype.Int64,
+	"$toDouble":   bsontype.Double,
+	"$toDecimal":  bsontype.Decimal128,
+	"$toString":   bsontype.String,
+	"$toDate":     bsontype.DateTime,
+	"$toObjectId": bsontype.ObjectID,
+}
+
+// conversionError is returned for values that cannot be converted and may be
+// handled using the onError branch of $convert.
+type conversionError struct {
+	msg string
+}
+
+func (e *conversionError) Error() string {
+	return e.msg + " in $convert with no onError value"
+}
+
+func unsupportedConversion(v interface{}, to bsontype.Type) error {
+	return &conversionError{
+		msg: fmt.Sprintf("Unsupported conversion from %s to %s", typeName(v), bsonkit.Type2Alias[to]),
+	}
+}
+
+func exprConvert(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"input", "to"}, "onError", "onNull")
+	if err != nil {
+		return nil, err
+	}
+
+	// get target type
+	var to bsontype.Type
+	switch value := fields["to"].(type) {
+	case string:
+		var ok bool
+		to, ok = bsonkit.Alias2Type[value]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown type name: %s", op, value)
+		}
+	case int32, int64, float64:
+		n, _ := toInt64(value)
+		var ok bool
+		to, ok = bsonkit.Number2Type[byte(n)]
+		if !ok || n < 0 || n > 255 {
+			return nil, fmt.Errorf("%s: invalid type code: %d", op, n)
+		}
+	default:
+		if isNullish(value) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: 'to' must evaluate to a string or number, found %s", op, typeName(value))
+	}
+
+	// handle null
+	if isNullish(fields["input"]) {
+		if onNull, ok := fields["onNull"]; ok {
+			return onNull, nil
+		}
+		return nil, nil
+	}
+
+	// convert value
+	res, err := convertTo(fields["input"], to)
+	if _, ok := err.(*conversionError); ok {
+		if onError, ok := fields["onError"]; ok {
+			return onError, nil
+		}
+	}
+
+	return res, err
+}
+
+func exprConvertTo(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+
+	return convertTo(args[0], convertShorthands[op])
+}
+
+func convertTo(v interface{}, to bsontype.Type) (interface{}, error) {
+	switch to {
+	case bsontype.Boolean:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case int32, int64, float64, primitive.Decimal128:
+			return truthy(v), nil
+		case string, primitive.ObjectID, primitive.DateTime:
+			return true, nil
+		}
+	case bsontype.Int32, bsontype.Int64:
+		// get integer
+		var n int64
+		switch v := v.(type) {
+		case bool:
+			if v {
+				n = 1
+			}
+		case int32:
+			n = int64(v)
+		case int64:
+			n = v
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) || v >= math.MaxInt64 || v < math.MinInt64 {
+				return nil, &conversionError{msg: "Conversion would overflow target type"}
+			}
+			n = int64(v)
+		case primitive.Decimal128:
+			f, err := strconv.ParseFloat(v.String(), 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f >= math.MaxInt64 || f < math.MinInt64 {
+				return nil, &conversionError{msg: "Conversion would overflow target type"}
+			}
+			n = int64(f)
+		case string:
+			var err error
+			n, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, &conversionError{msg: fmt.Sprintf("Failed to parse number '%s'", v)}
+			}
+		case primitive.DateTime:
+			if to == bsontype.Int32 {
+				return nil, unsupportedConversion(v, to)
+			}
+			n = int64(v)
+		default:
+			return nil, unsupportedConversion(v, to)
+		}
+
+		// check range
+		if to == bsontype.Int32 {
+			if n > math.MaxInt32 || n < math.MinInt32 {
+				if _, ok := v.(string); ok {
+					return nil, &conversionError{msg: fmt.Sprintf("Failed to parse number '%s'", v)}
+				}
+				return nil, &conversionError{msg: "Conversion would overflow target type"}
+			}
+			return int32(n), nil
+		}
+
+		return n, nil
+	case bsontype.Double:
+		switch v := v.(type) {
+		case bool:
+			if v {
+				return 1.0, nil
+			}
+			return 0.0, nil
+		case int32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case primitive.Decimal128:
+			f, err := strconv.ParseFloat(v.String(), 64)
+			if err != nil {
+				return nil, &conversionError{msg: "Conversion would overflow target type"}
+			}
+			return f, nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || strings.HasPrefix(strings.ToLower(v), "0x") {
+				return nil, &conversionError{msg: fmt.Sprintf("Failed to parse number '%s'", v)}
+			}
+			return f, nil
+		case primitive.DateTime:
+			return float64(v), nil
+		}
+	case bsontype.Decimal128:
+		var str string
+		switch v := v.(type) {
+		case bool:
+			str = "0"
+			if v {
+				str = "1"
+			}
+		case int32, int64:
+			str = fmt.Sprintf("%d", v)
+		case float64:
+			str = strconv.FormatFloat(v, 'g', -1, 64)
+		case primitive.Decimal128:
+			return v, nil
+		case string:
+			str = v
+		case primitive.DateTime:
+			str = strconv.FormatInt(int64(v), 10)
+		default:
+			return nil, unsupportedConversion(v, to)
+		}
+		d, err := primitive.ParseDecimal128(str)
+		if err != nil {
+			return nil, &conversionError{msg: fmt.Sprintf("Failed to parse number '%s'", str)}
+		}
+		return d, nil
+	case bsontype.String:
+		switch v := v.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case primitive.ObjectID:
+			return v.Hex(), nil
+		case int32, int64, float64, primitive.Decimal128, string, primitive.DateTime:
+			return toString("$convert", v)
+		}
+	case bsontype.DateTime:
+		switch v := v.(type) {
+		case primitive.DateTime:
+			return v, nil
+		case int64:
+			return primitive.DateTime(v), nil
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) || v >= math.MaxInt64 || v < math.MinInt64 {
+				return nil, &conversionError{msg: "Conversion would overflow target type"}
+			}
+			return primitive.DateTime(int64(v)), nil
+		case primitive.Decimal128:
+			n, ok := toInt64(v)
+			if !ok {
+				return nil, &conversionError{msg: "Conversion would overflow target type"}
+			}
+			return primitive.DateTime(n), nil
+		case string:
+			t, err := parseDateDefault("$convert", v, time.UTC)
+			if err != nil {
+				return nil, &conversionError{msg: fmt.Sprintf("Error parsing date string '%s'", v)}
+			}
+			return fromTime(t), nil
+		case primitive.ObjectID, primitive.Timestamp:
+			t, _ := toTime("$convert", v)
+			return fromTime(t), nil
+		}
+	case bsontype.ObjectID:
+		switch v := v.(type) {
+		case primitive.ObjectID:
+			return v, nil
+		case string:
+			id, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				return nil, &conversionError{msg: fmt.Sprintf("Failed to parse objectId '%s'", v)}
+			}
+			return id, nil
+		}
+	default:
+		// allow identity conversions for other types
+		if _, typ := bsonkit.Inspect(v); typ == to {
+			return v, nil
+		}
+	}
+
+	return nil, unsupportedConversion(v, to)
+}
+
+func exprType(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return typeName(args[0]), nil
+}
+
+func exprIsNumber(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return isNumber(args[0]), nil
+}
@@ -0,0 +1,88 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConvertOperators(t *testing.T) {
+	id := primitive.NewObjectID()
+	d128, _ := primitive.ParseDecimal128("1.5")
+
+	doc := &bson.D{
+		{Key: "s", Value: "42"},
+		{Key: "f", Value: 2.7},
+		{Key: "b", Value: "abc"},
+		{Key: "id", Value: id.Hex()},
+		{Key: "n", Value: nil},
+	}
+
+	table := []struct {
+		expr interface{}
+		res  interface{}
+		err  string
+	}{
+		// convert
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "to", Value: "int"}}}}, res: int32(42)},
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "to", Value: int32(18)}}}}, res: int64(42)},
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: "$b"}, {Key: "to", Value: "int"}}}}, err: "Failed to parse number 'abc' in $convert with no onError value"},
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: "$b"}, {Key: "to", Value: "int"}, {Key: "onError", Value: int32(-1)}}}}, res: int32(-1)},
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: "$x"}, {Key: "to", Value: "int"}, {Key: "onNull", Value: int32(0)}}}}, res: int32(0)},
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: "$n"}, {Key: "to", Value: "int"}}}}, res: nil},
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "to", Value: "foo"}, {Key: "onError", Value: int32(0)}}}}, err: "$convert: unknown type name: foo"},
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: bson.A{}}, {Key: "to", Value: "string"}}}}, err: "Unsupported conversion from array to string in $convert with no onError value"},
+		{expr: bson.D{{Key: "$convert", Value: bson.D{{Key: "input", Value: "$s"}}}}, err: `$convert: missing "to" parameter`},
+		// bool
+		{expr: bson.D{{Key: "$toBool", Value: int32(0)}}, res: false},
+		{expr: bson.D{{Key: "$toBool", Value: ""}}, res: true},
+		{expr: bson.D{{Key: "$toBool", Value: "$n"}}, res: nil},
+		// integers
+		{expr: bson.D{{Key: "$toInt", Value: "$f"}}, res: int32(2)},
+		{expr: bson.D{{Key: "$toInt", Value: true}}, res: int32(1)},
+		{expr: bson.D{{Key: "$toInt", Value: int64(1 << 40)}}, err: "Conversion would overflow target type in $convert with no onError value"},
+		{expr: bson.D{{Key: "$toLong", Value: primitive.DateTime(1000)}}, res: int64(1000)},
+		{expr: bson.D{{Key: "$toInt", Value: primitive.DateTime(1000)}}, err: "Unsupported conversion from date to int in $convert with no onError value"},
+		// double and decimal
+		{expr: bson.D{{Key: "$toDouble", Value: "1.5"}}, res: 1.5},
+		{expr: bson.D{{Key: "$toDouble", Value: "0x10"}}, err: "Failed to parse number '0x10' in $convert with no onError value"},
+		{expr: bson.D{{Key: "$toDecimal", Value: 1.5}}, res: d128},
+		{expr: bson.D{{Key: "$toDouble", Value: d128}}, res: 1.5},
+		// string
+		{expr: bson.D{{Key: "$toString", Value: int32(7)}}, res: "7"},
+		{expr: bson.D{{Key: "$toString", Value: 2.5}}, res: "2.5"},
+		{expr: bson.D{{Key: "$toString", Value: true}}, res: "true"},
+		{expr: bson.D{{Key: "$toString", Value: id}}, res: id.Hex()},
+		{expr: bson.D{{Key: "$toString", Value: date("2021-01-02T03:04:05.006Z")}}, res: "2021-01-02T03:04:05.006Z"},
+		// date
+		{expr: bson.D{{Key: "$toDate", Value: "2021-01-02T03:04:05.006Z"}}, res: date("2021-01-02T03:04:05.006Z")},
+		{expr: bson.D{{Key: "$toDate", Value: int64(1000)}}, res: primitive.DateTime(1000)},
+		{expr: bson.D{{Key: "$toDate", Value: int32(1000)}}, err: "Unsupported conversion from int to date in $convert with no onError value"},
+		{expr: bson.D{{Key: "$toDate", Value: "foo"}}, err: "Error parsing date string 'foo' in $convert with no onError value"},
+		{expr: bson.D{{Key: "$toDate", Value: id}}, res: primitive.NewDateTimeFromTime(id.Timestamp())},
+		// object id
+		{expr: bson.D{{Key: "$toObjectId", Value: "$id"}}, res: id},
+		{expr: bson.D{{Key: "$toObjectId", Value: "$b"}}, err: "Failed to parse objectId 'abc' in $convert with no onError value"},
+		// type
+		{expr: bson.D{{Key: "$type", Value: "$s"}}, res: "string"},
+		{expr: bson.D{{Key: "$type", Value: "$x"}}, res: "missing"},
+		{expr: bson.D{{Key: "$type", Value: "$n"}}, res: "null"},
+		{expr: bson.D{{Key: "$isNumber", Value: "$f"}}, res: true},
+		{expr: bson.D{{Key: "$isNumber", Value: "$s"}}, res: false},
+	}
+
+	for _, item := range table {
+		res, err := Evaluate(doc, item.expr, nil)
+		if item.err != "" {
+			assert.Error(t, err, item.expr)
+			if err != nil {
+				assert.Equal(t, item.err, err.Error(), item.expr)
+			}
+		} else {
+			assert.NoError(t, err, item.expr)
+			assert.Equal(t, item.res, res, item.expr)
+		}
+	}
+}
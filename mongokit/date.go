@@ -0,0 +1,1011 @@
+package mongokit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	// embed the timezone database to support named timezones everywhere
+	_ "time/tzdata"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// https://github.com/mongodb/mongo/blob/master/src/mongo/db/query/datetime/date_time_support.cpp
+
+func init() {
+	// register date part operators
+	for _, name := range []string{"$year", "$month", "$dayOfMonth", "$hour", "$minute", "$second", "$millisecond", "$dayOfWeek", "$dayOfYear", "$week", "$isoWeek", "$isoWeekYear", "$isoDayOfWeek"} {
+		AggregationExpressionOperators[name] = exprDatePart
+	}
+
+	// register date operators
+	AggregationExpressionOperators["$dateToString"] = exprDateToString
+	AggregationExpressionOperators["$dateFromString"] = exprDateFromString
+	AggregationExpressionOperators["$dateToParts"] = exprDateToParts
+	AggregationExpressionOperators["$dateFromParts"] = exprDateFromParts
+	AggregationExpressionOperators["$dateTrunc"] = exprDateTrunc
+	AggregationExpressionOperators["$dateAdd"] = exprDateAdd
+	AggregationExpressionOperators["$dateSubtract"] = exprDateAdd
+	AggregationExpressionOperators["$dateDiff"] = exprDateDiff
+}
+
+// the reference used to align bins of truncated dates
+var dateReference = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var weekDays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// ParseTimezone will parse a MongoDB timezone which is either an Olson
+// timezone identifier or a UTC offset in the form "+/-[hh]:[mm]",
+// "+/-[hh][mm]" or "+/-[hh]".
+func ParseTimezone(tz string) (*time.Location, error) {
+	// handle offsets
+	if strings.HasPrefix(tz, "+") || strings.HasPrefix(tz, "-") {
+		// get parts
+		digits := strings.ReplaceAll(tz[1:], ":", "")
+		if len(digits) != 2 && len(digits) != 4 {
+			return nil, fmt.Errorf("unrecognized time zone identifier: %q", tz)
+		}
+		hours, err1 := strconv.Atoi(digits[:2])
+		minutes, err2 := strconv.Atoi("0" + digits[2:])
+		if err1 != nil || err2 != nil || hours > 23 || minutes > 59 {
+			return nil, fmt.Errorf("unrecognized time zone identifier: %q", tz)
+		}
+
+		// get offset
+		offset := hours*3600 + minutes*60
+		if tz[0] == '-' {
+			offset = -offset
+		}
+
+		return time.FixedZone(tz, offset), nil
+	}
+
+	// handle UTC
+	if tz == "UTC" || tz == "GMT" || tz == "Z" {
+		return time.UTC, nil
+	}
+
+	// load location
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "" || tz == "Local" {
+		return nil, fmt.Errorf("unrecognized time zone identifier: %q", tz)
+	}
+
+	return loc, nil
+}
+
+func getParameters(op string, arg interface{}, required []string, optional ...string) (map[string]interface{}, error) {
+	// check document
+	doc, ok := arg.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected document", op)
+	}
+
+	// collect fields
+	fields := map[string]interface{}{}
+	for _, field := range doc {
+		// check name
+		known := false
+		for _, name := range append(required, optional...) {
+			if field.Key == name {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: unrecognized parameter %q", op, field.Key)
+		}
+
+		fields[field.Key] = field.Value
+	}
+
+	// check required fields
+	for _, name := range required {
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("%s: missing %q parameter", op, name)
+		}
+	}
+
+	return fields, nil
+}
+
+func evaluateFields(scope *Scope, op string, arg interface{}, required []string, optional ...string) (map[string]interface{}, error) {
+	// get parameters
+	fields, err := getParameters(op, arg, required, optional...)
+	if err != nil {
+		return nil, err
+	}
+
+	// evaluate fields
+	for _, name := range append(required, optional...) {
+		if expr, ok := fields[name]; ok {
+			value, err := scope.Evaluate(expr)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = value
+		}
+	}
+
+	return fields, nil
+}
+
+func toTime(op string, v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case primitive.DateTime:
+		return v.Time().UTC(), nil
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0).UTC(), nil
+	case primitive.ObjectID:
+		return v.Timestamp().UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("%s: can't convert from BSON type %s to Date", op, typeName(v))
+	}
+}
+
+func fromTime(t time.Time) primitive.DateTime {
+	return primitive.NewDateTimeFromTime(t)
+}
+
+func getTimezone(op string, v interface{}) (*time.Location, bool, error) {
+	// handle default
+	if v == nil || v == bsonkit.Missing {
+		return time.UTC, false, nil
+	}
+
+	// check string
+	str, ok := v.(string)
+	if !ok {
+		if isNullish(v) {
+			return nil, true, nil
+		}
+		return nil, false, fmt.Errorf("%s: timezone must evaluate to a string, found %s", op, typeName(v))
+	}
+
+	// parse timezone
+	loc, err := ParseTimezone(str)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return loc, false, nil
+}
+
+func getInteger(op, name string, v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return int64(v), nil
+		}
+	case primitive.Decimal128:
+		if n, ok := toInt64(v); ok {
+			return n, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%s: %s must be an integer, found %s", op, name, typeName(v))
+}
+
+func exprDatePart(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// get date and timezone expressions
+	dateExpr, tzExpr := arg, interface{}(nil)
+	if doc, ok := arg.(bson.D); ok && len(doc) > 0 && !strings.HasPrefix(doc[0].Key, "$") {
+		fields, err := evaluateFields(scope, op, arg, []string{"date"}, "timezone")
+		if err != nil {
+			return nil, err
+		}
+		dateExpr, tzExpr = bson.D{{Key: "$literal", Value: fields["date"]}}, fields["timezone"]
+	} else if array, ok := arg.(bson.A); ok {
+		if len(array) != 1 {
+			return nil, fmt.Errorf("%s: expected 1 argument", op)
+		}
+		dateExpr = array[0]
+	}
+
+	// evaluate date
+	date, err := scope.Evaluate(dateExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	// get timezone
+	loc, null, err := getTimezone(op, tzExpr)
+	if err != nil {
+		return nil, err
+	} else if null || isNullish(date) {
+		return nil, nil
+	}
+
+	// get time
+	t, err := toTime(op, date)
+	if err != nil {
+		return nil, err
+	}
+	t = t.In(loc)
+
+	// get part
+	switch op {
+	case "$year":
+		return int32(t.Year()), nil
+	case "$month":
+		return int32(t.Month()), nil
+	case "$dayOfMonth":
+		return int32(t.Day()), nil
+	case "$hour":
+		return int32(t.Hour()), nil
+	case "$minute":
+		return int32(t.Minute()), nil
+	case "$second":
+		return int32(t.Second()), nil
+	case "$millisecond":
+		return int32(t.Nanosecond() / int(time.Millisecond)), nil
+	case "$dayOfWeek":
+		return int32(t.Weekday()) + 1, nil
+	case "$dayOfYear":
+		return int32(t.YearDay()), nil
+	case "$week":
+		return int32(sundayWeek(t)), nil
+	case "$isoWeek":
+		_, week := t.ISOWeek()
+		return int32(week), nil
+	case "$isoWeekYear":
+		year, _ := t.ISOWeek()
+		return int64(year), nil
+	case "$isoDayOfWeek":
+		return int32(isoWeekday(t)), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown date part", op)
+	}
+}
+
+func sundayWeek(t time.Time) int {
+	return (t.YearDay() + 6 - int(t.Weekday())) / 7
+}
+
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+func formatDate(op, format string, t time.Time) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		// write regular characters
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		// check specifier
+		if i+1 >= len(format) {
+			return "", fmt.Errorf("%s: unmatched '%%' at end of format string", op)
+		}
+		i++
+
+		// write specifier
+		switch format[i] {
+		case 'd':
+			b.WriteString(fmt.Sprintf("%02d", t.Day()))
+		case 'G':
+			year, _ := t.ISOWeek()
+			b.WriteString(fmt.Sprintf("%04d", year))
+		case 'H':
+			b.WriteString(fmt.Sprintf("%02d", t.Hour()))
+		case 'j':
+			b.WriteString(fmt.Sprintf("%03d", t.YearDay()))
+		case 'L':
+			b.WriteString(fmt.Sprintf("%03d", t.Nanosecond()/int(time.Millisecond)))
+		case 'm':
+			b.WriteString(fmt.Sprintf("%02d", int(t.Month())))
+		case 'M':
+			b.WriteString(fmt.Sprintf("%02d", t.Minute()))
+		case 'S':
+			b.WriteString(fmt.Sprintf("%02d", t.Second()))
+		case 'w':
+			b.WriteString(strconv.Itoa(int(t.Weekday()) + 1))
+		case 'u':
+			b.WriteString(strconv.Itoa(isoWeekday(t)))
+		case 'U':
+			b.WriteString(fmt.Sprintf("%02d", sundayWeek(t)))
+		case 'V':
+			_, week := t.ISOWeek()
+			b.WriteString(fmt.Sprintf("%02d", week))
+		case 'Y':
+			b.WriteString(fmt.Sprintf("%04d", t.Year()))
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case 'Z':
+			_, offset := t.Zone()
+			b.WriteString(strconv.Itoa(offset / 60))
+		case 'b':
+			b.WriteString(t.Format("Jan"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("%s: invalid format character '%%%c' in format string", op, format[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+func exprDateToString(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"date"}, "format", "timezone", "onNull")
+	if err != nil {
+		return nil, err
+	}
+
+	// get format
+	format := "%Y-%m-%dT%H:%M:%S.%LZ"
+	if value, ok := fields["format"]; ok && !isNullish(value) {
+		format, ok = value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: format must evaluate to a string, found %s", op, typeName(value))
+		}
+	} else if ok {
+		return nil, nil
+	}
+
+	// get timezone
+	loc, null, err := getTimezone(op, fields["timezone"])
+	if err != nil {
+		return nil, err
+	} else if null {
+		return nil, nil
+	}
+
+	// handle null
+	if isNullish(fields["date"]) {
+		if onNull, ok := fields["onNull"]; ok {
+			return onNull, nil
+		}
+		return nil, nil
+	}
+
+	// get time
+	t, err := toTime(op, fields["date"])
+	if err != nil {
+		return nil, err
+	}
+
+	return formatDate(op, format, t.In(loc))
+}
+
+func exprDateFromString(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"dateString"}, "format", "timezone", "onError", "onNull")
+	if err != nil {
+		return nil, err
+	}
+
+	// get timezone
+	loc, null, err := getTimezone(op, fields["timezone"])
+	if err != nil {
+		return nil, err
+	} else if null {
+		return nil, nil
+	}
+
+	// handle null
+	if isNullish(fields["dateString"]) {
+		if onNull, ok := fields["onNull"]; ok {
+			return onNull, nil
+		}
+		return nil, nil
+	}
+
+	// get format
+	var format string
+	if value, ok := fields["format"]; ok {
+		format, ok = value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: format must evaluate to a string, found %s", op, typeName(value))
+		}
+	}
+
+	// parse date
+	var t time.Time
+	str, ok := fields["dateString"].(string)
+	if !ok {
+		err = fmt.Errorf("%s: date string must evaluate to a string, found %s", op, typeName(fields["dateString"]))
+	} else if format != "" {
+		t, err = parseDate(op, format, str, loc)
+	} else {
+		t, err = parseDateDefault(op, str, loc)
+	}
+	if err != nil {
+		if onError, ok := fields["onError"]; ok {
+			return onError, nil
+		}
+		return nil, err
+	}
+
+	return fromTime(t), nil
+}
+
+var defaultDateLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+}
+
+func parseDateDefault(op, str string, loc *time.Location) (time.Time, error) {
+	// try layouts
+	for _, layout := range defaultDateLayouts {
+		t, err := time.ParseInLocation(layout, str, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%s: error parsing date string %q", op, str)
+}
+
+func parseDate(op, format, str string, loc *time.Location) (time.Time, error) {
+	// prepare parts
+	year, month, day := 1970, 1, 1
+	var hour, minute, second, milli int
+	var offset *int
+
+	// parse string
+	pos := 0
+	number := func(digits int) (int, bool) {
+		// get digits
+		end := pos
+		for end < len(str) && end-pos < digits && str[end] >= '0' && str[end] <= '9' {
+			end++
+		}
+		if end == pos {
+			return 0, false
+		}
+
+		// parse number
+		n, _ := strconv.Atoi(str[pos:end])
+		pos = end
+
+		return n, true
+	}
+	for i := 0; i < len(format); i++ {
+		// match regular characters
+		if format[i] != '%' || i+1 >= len(format) {
+			if pos >= len(str) || str[pos] != format[i] {
+				return time.Time{}, fmt.Errorf("%s: error parsing date string %q", op, str)
+			}
+			pos++
+			continue
+		}
+		i++
+
+		// match specifier
+		var ok bool
+		switch format[i] {
+		case 'Y':
+			year, ok = number(4)
+		case 'm':
+			month, ok = number(2)
+		case 'd':
+			day, ok = number(2)
+		case 'H':
+			hour, ok = number(2)
+		case 'M':
+			minute, ok = number(2)
+		case 'S':
+			second, ok = number(2)
+		case 'L':
+			milli, ok = number(3)
+		case 'j':
+			var yday int
+			yday, ok = number(3)
+			month, day = 1, yday
+		case 'z':
+			if pos < len(str) && (str[pos] == '+' || str[pos] == '-') {
+				sign := 1
+				if str[pos] == '-' {
+					sign = -1
+				}
+				pos++
+				var hh, mm int
+				hh, ok = number(2)
+				if ok && pos < len(str) && str[pos] == ':' {
+					pos++
+				}
+				if ok {
+					mm, ok = number(2)
+				}
+				n := sign * (hh*60 + mm)
+				offset = &n
+			}
+		case 'Z':
+			if pos < len(str) && (str[pos] == '+' || str[pos] == '-') {
+				sign := 1
+				if str[pos] == '-' {
+					sign = -1
+				}
+				pos++
+				var n int
+				n, ok = number(4)
+				n *= sign
+				offset = &n
+			}
+		case '%':
+			ok = pos < len(str) && str[pos] == '%'
+			pos++
+		default:
+			return time.Time{}, fmt.Errorf("%s: invalid format character '%%%c' in format string", op, format[i])
+		}
+		if !ok {
+			return time.Time{}, fmt.Errorf("%s: error parsing date string %q", op, str)
+		}
+	}
+	if pos != len(str) {
+		return time.Time{}, fmt.Errorf("%s: error parsing date string %q", op, str)
+	}
+
+	// apply offset
+	if offset != nil {
+		loc = time.FixedZone("", *offset*60)
+	}
+
+	return time.Date(year, time.Month(month), day, hour, minute, second, milli*int(time.Millisecond), loc), nil
+}
+
+func exprDateToParts(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"date"}, "timezone", "iso8601")
+	if err != nil {
+		return nil, err
+	}
+
+	// get timezone
+	loc, null, err := getTimezone(op, fields["timezone"])
+	if err != nil {
+		return nil, err
+	} else if null || isNullish(fields["date"]) {
+		return nil, nil
+	}
+
+	// get time
+	t, err := toTime(op, fields["date"])
+	if err != nil {
+		return nil, err
+	}
+	t = t.In(loc)
+
+	// prepare time parts
+	parts := bson.D{
+		{Key: "hour", Value: int32(t.Hour())},
+		{Key: "minute", Value: int32(t.Minute())},
+		{Key: "second", Value: int32(t.Second())},
+		{Key: "millisecond", Value: int32(t.Nanosecond() / int(time.Millisecond))},
+	}
+
+	// prepend date parts
+	if iso, _ := fields["iso8601"].(bool); iso {
+		year, week := t.ISOWeek()
+		return append(bson.D{
+			{Key: "isoWeekYear", Value: int32(year)},
+			{Key: "isoWeek", Value: int32(week)},
+			{Key: "isoDayOfWeek", Value: int32(isoWeekday(t))},
+		}, parts...), nil
+	}
+
+	return append(bson.D{
+		{Key: "year", Value: int32(t.Year())},
+		{Key: "month", Value: int32(t.Month())},
+		{Key: "day", Value: int32(t.Day())},
+	}, parts...), nil
+}
+
+func exprDateFromParts(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, nil, "year", "month", "day", "isoWeekYear", "isoWeek", "isoDayOfWeek", "hour", "minute", "second", "millisecond", "timezone")
+	if err != nil {
+		return nil, err
+	}
+
+	// get timezone
+	loc, null, err := getTimezone(op, fields["timezone"])
+	if err != nil {
+		return nil, err
+	} else if null {
+		return nil, nil
+	}
+
+	// check mode
+	_, hasYear := fields["year"]
+	_, hasISOYear := fields["isoWeekYear"]
+	if hasYear == hasISOYear {
+		return nil, fmt.Errorf("%s: must specify either year or isoWeekYear", op)
+	}
+
+	// get parts
+	parts := map[string]int64{}
+	defaults := map[string]int64{"month": 1, "day": 1, "isoWeek": 1, "isoDayOfWeek": 1}
+	for _, name := range []string{"year", "month", "day", "isoWeekYear", "isoWeek", "isoDayOfWeek", "hour", "minute", "second", "millisecond"} {
+		// get value
+		value, ok := fields[name]
+		if !ok {
+			parts[name] = defaults[name]
+			continue
+		}
+
+		// handle null
+		if isNullish(value) {
+			return nil, nil
+		}
+
+		// get integer
+		n, err := getInteger(op, name, value)
+		if err != nil {
+			return nil, err
+		}
+		parts[name] = n
+	}
+
+	// check year
+	year := parts["year"]
+	if hasISOYear {
+		year = parts["isoWeekYear"]
+	}
+	if year < 1 || year > 9999 {
+		return nil, fmt.Errorf("%s: year must be an integer between 1 and 9999, found %d", op, year)
+	}
+
+	// get time
+	nanos := time.Duration(parts["millisecond"]) * time.Millisecond
+	var t time.Time
+	if hasISOYear {
+		// find monday of the first iso week
+		jan4 := time.Date(int(year), 1, 4, 0, 0, 0, 0, loc)
+		monday := jan4.AddDate(0, 0, 1-isoWeekday(jan4))
+
+		// add parts
+		t = time.Date(monday.Year(), monday.Month(), monday.Day()+int((parts["isoWeek"]-1)*7+parts["isoDayOfWeek"]-1), int(parts["hour"]), int(parts["minute"]), int(parts["second"]), 0, loc)
+	} else {
+		t = time.Date(int(year), time.Month(parts["month"]), int(parts["day"]), int(parts["hour"]), int(parts["minute"]), int(parts["second"]), 0, loc)
+	}
+
+	return fromTime(t.Add(nanos)), nil
+}
+
+func getUnit(op string, v interface{}) (string, error) {
+	unit, _ := v.(string)
+	switch unit {
+	case "year", "quarter", "month", "week", "day", "hour", "minute", "second", "millisecond":
+		return unit, nil
+	default:
+		return "", fmt.Errorf("%s: unit must be a valid time unit, found %v", op, v)
+	}
+}
+
+func getStartOfWeek(op string, v interface{}) (time.Weekday, error) {
+	// handle default
+	if v == nil || v == bsonkit.Missing {
+		return time.Sunday, nil
+	}
+
+	// get day
+	str, _ := v.(string)
+	day, ok := weekDays[strings.ToLower(str)]
+	if !ok {
+		return 0, fmt.Errorf("%s: startOfWeek must be a valid day of the week, found %v", op, v)
+	}
+
+	return day, nil
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// wallTime returns the wall clock time of t in its location as a UTC time.
+func wallTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// localTime returns the time in the location for the specified wall clock time.
+func localTime(wall time.Time, loc *time.Location) time.Time {
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), loc)
+}
+
+func truncateDate(t time.Time, unit string, binSize int64, startOfWeek time.Weekday) time.Time {
+	// get wall time
+	wall := wallTime(t)
+
+	// truncate calendar units
+	switch unit {
+	case "year", "quarter", "month":
+		// get bin size in months
+		months := binSize
+		if unit == "year" {
+			months *= 12
+		} else if unit == "quarter" {
+			months *= 3
+		}
+
+		// get bin
+		elapsed := int64(wall.Year()-dateReference.Year())*12 + int64(wall.Month()-1)
+		bin := floorDiv(elapsed, months) * months
+
+		return localTime(dateReference.AddDate(0, int(bin), 0), t.Location())
+	case "week":
+		// get reference aligned to start of week
+		reference := dateReference.AddDate(0, 0, (int(startOfWeek)-int(dateReference.Weekday())+7)%7)
+
+		// get bin
+		days := int64(wall.Sub(reference) / (24 * time.Hour))
+		if wall.Before(reference) && wall.Sub(reference)%(24*time.Hour) != 0 {
+			days--
+		}
+		bin := floorDiv(days, 7*binSize) * 7 * binSize
+
+		return localTime(reference.AddDate(0, 0, int(bin)), t.Location())
+	case "day":
+		// get bin
+		days := int64(wall.Sub(dateReference) / (24 * time.Hour))
+		if wall.Before(dateReference) && wall.Sub(dateReference)%(24*time.Hour) != 0 {
+			days--
+		}
+		bin := floorDiv(days, binSize) * binSize
+
+		return localTime(dateReference.AddDate(0, 0, int(bin)), t.Location())
+	}
+
+	// get unit duration
+	var duration time.Duration
+	switch unit {
+	case "hour":
+		duration = time.Hour
+	case "minute":
+		duration = time.Minute
+	case "second":
+		duration = time.Second
+	default:
+		duration = time.Millisecond
+	}
+
+	// truncate fixed units
+	elapsed := int64(wall.Sub(dateReference) / time.Millisecond)
+	size := binSize * int64(duration/time.Millisecond)
+	bin := floorDiv(elapsed, size) * size
+
+	return localTime(dateReference.Add(time.Duration(bin)*time.Millisecond), t.Location())
+}
+
+func exprDateTrunc(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"date", "unit"}, "binSize", "timezone", "startOfWeek")
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	for _, value := range fields {
+		if isNullish(value) {
+			return nil, nil
+		}
+	}
+
+	// get unit
+	unit, err := getUnit(op, fields["unit"])
+	if err != nil {
+		return nil, err
+	}
+
+	// get bin size
+	binSize := int64(1)
+	if value, ok := fields["binSize"]; ok {
+		binSize, err = getInteger(op, "binSize", value)
+		if err != nil {
+			return nil, err
+		} else if binSize <= 0 {
+			return nil, fmt.Errorf("%s: binSize must be greater than 0, found %d", op, binSize)
+		}
+	}
+
+	// get timezone and start of week
+	loc, _, err := getTimezone(op, fields["timezone"])
+	if err != nil {
+		return nil, err
+	}
+	startOfWeek, err := getStartOfWeek(op, fields["startOfWeek"])
+	if err != nil {
+		return nil, err
+	}
+
+	// get time
+	t, err := toTime(op, fields["date"])
+	if err != nil {
+		return nil, err
+	}
+
+	return fromTime(truncateDate(t.In(loc), unit, binSize, startOfWeek)), nil
+}
+
+func addDate(t time.Time, unit string, amount int64) time.Time {
+	// add calendar units
+	switch unit {
+	case "year", "quarter", "month":
+		// get months
+		months := amount
+		if unit == "year" {
+			months *= 12
+		} else if unit == "quarter" {
+			months *= 3
+		}
+
+		// get target month
+		first := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		first = first.AddDate(0, int(months), 0)
+
+		// clamp day to the end of the month
+		day := t.Day()
+		if last := first.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+
+		return first.AddDate(0, 0, day-1)
+	case "week":
+		return t.AddDate(0, 0, int(amount*7))
+	case "day":
+		return t.AddDate(0, 0, int(amount))
+	case "hour":
+		return t.Add(time.Duration(amount) * time.Hour)
+	case "minute":
+		return t.Add(time.Duration(amount) * time.Minute)
+	case "second":
+		return t.Add(time.Duration(amount) * time.Second)
+	default:
+		return t.Add(time.Duration(amount) * time.Millisecond)
+	}
+}
+
+func exprDateAdd(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"startDate", "unit", "amount"}, "timezone")
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	for _, value := range fields {
+		if isNullish(value) {
+			return nil, nil
+		}
+	}
+
+	// get unit
+	unit, err := getUnit(op, fields["unit"])
+	if err != nil {
+		return nil, err
+	}
+
+	// get amount
+	amount, err := getInteger(op, "amount", fields["amount"])
+	if err != nil {
+		return nil, err
+	}
+	if op == "$dateSubtract" {
+		amount = -amount
+	}
+
+	// get timezone
+	loc, _, err := getTimezone(op, fields["timezone"])
+	if err != nil {
+		return nil, err
+	}
+
+	// get time
+	t, err := toTime(op, fields["startDate"])
+	if err != nil {
+		return nil, err
+	}
+
+	return fromTime(addDate(t.In(loc), unit, amount)), nil
+}
+
+func exprDateDiff(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"startDate", "endDate", "unit"}, "timezone", "startOfWeek")
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	for _, value := range fields {
+		if isNullish(value) {
+			return nil, nil
+		}
+	}
+
+	// get unit
+	unit, err := getUnit(op, fields["unit"])
+	if err != nil {
+		return nil, err
+	}
+
+	// get timezone and start of week
+	loc, _, err := getTimezone(op, fields["timezone"])
+	if err != nil {
+		return nil, err
+	}
+	startOfWeek, err := getStartOfWeek(op, fields["startOfWeek"])
+	if err != nil {
+		return nil, err
+	}
+
+	// get times
+	start, err := toTime(op, fields["startDate"])
+	if err != nil {
+		return nil, err
+	}
+	end, err := toTime(op, fields["endDate"])
+	if err != nil {
+		return nil, err
+	}
+	start, end = start.In(loc), end.In(loc)
+
+	// count crossed unit boundaries
+	switch unit {
+	case "year":
+		return int64(end.Year() - start.Year()), nil
+	case "quarter":
+		return int64((end.Year()*4 + (int(end.Month())-1)/3) - (start.Year()*4 + (int(start.Month())-1)/3)), nil
+	case "month":
+		return int64((end.Year()*12 + int(end.Month())) - (start.Year()*12 + int(start.Month()))), nil
+	case "week":
+		s := wallTime(truncateDate(start, "week", 1, startOfWeek))
+		e := wallTime(truncateDate(end, "week", 1, startOfWeek))
+		return int64(e.Sub(s) / (7 * 24 * time.Hour)), nil
+	case "day":
+		s := wallTime(truncateDate(start, "day", 1, startOfWeek))
+		e := wallTime(truncateDate(end, "day", 1, startOfWeek))
+		return int64(e.Sub(s) / (24 * time.Hour)), nil
+	default:
+		s := wallTime(truncateDate(start, unit, 1, startOfWeek))
+		e := wallTime(truncateDate(end, unit, 1, startOfWeek))
+		switch unit {
+		case "hour":
+			return int64(e.Sub(s) / time.Hour), nil
+		case "minute":
+			return int64(e.Sub(s) / time.Minute), nil
+		case "second":
+			return int64(e.Sub(s) / time.Second), nil
+		default:
+			return int64(end.Sub(start) / time.Millisecond), nil
+		}
+	}
+}
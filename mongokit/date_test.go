@@ -0,0 +1,249 @@
+package mongokit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func date(str string) primitive.DateTime {
+	t, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		panic(err)
+	}
+	return primitive.NewDateTimeFromTime(t)
+}
+
+func TestParseTimezone(t *testing.T) {
+	for _, item := range []struct {
+		tz     string
+		offset int
+		err    bool
+	}{
+		{tz: "UTC", offset: 0},
+		{tz: "+05:30", offset: 19800},
+		{tz: "-0800", offset: -28800},
+		{tz: "+03", offset: 10800},
+		{tz: "Asia/Kolkata", offset: 19800},
+		{tz: "+5", err: true},
+		{tz: "Foo/Bar", err: true},
+		{tz: "", err: true},
+	} {
+		loc, err := ParseTimezone(item.tz)
+		if item.err {
+			assert.Error(t, err, item.tz)
+			continue
+		}
+		assert.NoError(t, err, item.tz)
+		_, offset := time.Date(2020, 1, 1, 0, 0, 0, 0, loc).Zone()
+		assert.Equal(t, item.offset, offset, item.tz)
+	}
+}
+
+func TestDateOperators(t *testing.T) {
+	doc := &bson.D{
+		{Key: "d", Value: date("2021-03-14T01:30:15.250Z")},
+		{Key: "e", Value: date("2022-01-31T12:00:00Z")},
+		{Key: "n", Value: nil},
+	}
+
+	table := []struct {
+		expr interface{}
+		res  interface{}
+		err  string
+	}{
+		// date parts
+		{expr: bson.D{{Key: "$year", Value: "$d"}}, res: int32(2021)},
+		{expr: bson.D{{Key: "$month", Value: "$d"}}, res: int32(3)},
+		{expr: bson.D{{Key: "$dayOfMonth", Value: "$d"}}, res: int32(14)},
+		{expr: bson.D{{Key: "$hour", Value: "$d"}}, res: int32(1)},
+		{expr: bson.D{{Key: "$millisecond", Value: "$d"}}, res: int32(250)},
+		{expr: bson.D{{Key: "$dayOfWeek", Value: "$d"}}, res: int32(1)},
+		{expr: bson.D{{Key: "$dayOfYear", Value: "$d"}}, res: int32(73)},
+		{expr: bson.D{{Key: "$week", Value: "$d"}}, res: int32(11)},
+		{expr: bson.D{{Key: "$isoWeek", Value: "$d"}}, res: int32(10)},
+		{expr: bson.D{{Key: "$isoDayOfWeek", Value: "$d"}}, res: int32(7)},
+		{expr: bson.D{{Key: "$isoWeekYear", Value: "$d"}}, res: int64(2021)},
+		{expr: bson.D{{Key: "$year", Value: "$n"}}, res: nil},
+		{expr: bson.D{{Key: "$year", Value: "foo"}}, err: "$year: can't convert from BSON type string to Date"},
+		{expr: bson.D{{Key: "$dayOfMonth", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "timezone", Value: "America/New_York"},
+		}}}, res: int32(13)},
+		{expr: bson.D{{Key: "$hour", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "timezone", Value: "Foo/Bar"},
+		}}}, err: `$hour: unrecognized time zone identifier: "Foo/Bar"`},
+		// to string
+		{expr: bson.D{{Key: "$dateToString", Value: bson.D{
+			{Key: "date", Value: "$d"},
+		}}}, res: "2021-03-14T01:30:15.250Z"},
+		{expr: bson.D{{Key: "$dateToString", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "format", Value: "%Y-%m-%d %H:%M %z %j %%"},
+			{Key: "timezone", Value: "+05:30"},
+		}}}, res: "2021-03-14 07:00 +0530 073 %"},
+		{expr: bson.D{{Key: "$dateToString", Value: bson.D{
+			{Key: "date", Value: "$x"},
+			{Key: "onNull", Value: "none"},
+		}}}, res: "none"},
+		{expr: bson.D{{Key: "$dateToString", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "format", Value: "%Q"},
+		}}}, err: "$dateToString: invalid format character '%Q' in format string"},
+		// from string
+		{expr: bson.D{{Key: "$dateFromString", Value: bson.D{
+			{Key: "dateString", Value: "2021-03-14T01:30:15.250Z"},
+		}}}, res: date("2021-03-14T01:30:15.250Z")},
+		{expr: bson.D{{Key: "$dateFromString", Value: bson.D{
+			{Key: "dateString", Value: "2021-03-14 06:00"},
+			{Key: "format", Value: "%Y-%m-%d %H:%M"},
+			{Key: "timezone", Value: "Europe/Berlin"},
+		}}}, res: date("2021-03-14T05:00:00Z")},
+		{expr: bson.D{{Key: "$dateFromString", Value: bson.D{
+			{Key: "dateString", Value: "foo"},
+			{Key: "onError", Value: "bad"},
+		}}}, res: "bad"},
+		// parts
+		{expr: bson.D{{Key: "$dateToParts", Value: bson.D{
+			{Key: "date", Value: "$d"},
+		}}}, res: bson.D{
+			{Key: "year", Value: int32(2021)},
+			{Key: "month", Value: int32(3)},
+			{Key: "day", Value: int32(14)},
+			{Key: "hour", Value: int32(1)},
+			{Key: "minute", Value: int32(30)},
+			{Key: "second", Value: int32(15)},
+			{Key: "millisecond", Value: int32(250)},
+		}},
+		{expr: bson.D{{Key: "$dateFromParts", Value: bson.D{
+			{Key: "year", Value: int32(2021)},
+			{Key: "month", Value: int32(14)},
+			{Key: "day", Value: int32(1)},
+			{Key: "timezone", Value: "-01:00"},
+		}}}, res: date("2022-02-01T01:00:00Z")},
+		{expr: bson.D{{Key: "$dateFromParts", Value: bson.D{
+			{Key: "isoWeekYear", Value: int32(2021)},
+			{Key: "isoWeek", Value: int32(10)},
+			{Key: "isoDayOfWeek", Value: int32(7)},
+		}}}, res: date("2021-03-14T00:00:00Z")},
+		// truncate
+		{expr: bson.D{{Key: "$dateTrunc", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "unit", Value: "day"},
+		}}}, res: date("2021-03-14T00:00:00Z")},
+		{expr: bson.D{{Key: "$dateTrunc", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "unit", Value: "day"},
+			{Key: "timezone", Value: "America/Los_Angeles"},
+		}}}, res: date("2021-03-13T08:00:00Z")},
+		{expr: bson.D{{Key: "$dateTrunc", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "unit", Value: "week"},
+			{Key: "startOfWeek", Value: "monday"},
+		}}}, res: date("2021-03-08T00:00:00Z")},
+		{expr: bson.D{{Key: "$dateTrunc", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "unit", Value: "quarter"},
+		}}}, res: date("2021-01-01T00:00:00Z")},
+		{expr: bson.D{{Key: "$dateTrunc", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "unit", Value: "minute"},
+			{Key: "binSize", Value: int32(15)},
+		}}}, res: date("2021-03-14T01:30:00Z")},
+		{expr: bson.D{{Key: "$dateTrunc", Value: bson.D{
+			{Key: "date", Value: "$d"},
+			{Key: "unit", Value: "fortnight"},
+		}}}, err: "$dateTrunc: unit must be a valid time unit, found fortnight"},
+		// add and subtract
+		{expr: bson.D{{Key: "$dateAdd", Value: bson.D{
+			{Key: "startDate", Value: "$e"},
+			{Key: "unit", Value: "month"},
+			{Key: "amount", Value: int32(1)},
+		}}}, res: date("2022-02-28T12:00:00Z")},
+		{expr: bson.D{{Key: "$dateAdd", Value: bson.D{
+			{Key: "startDate", Value: "$d"},
+			{Key: "unit", Value: "day"},
+			{Key: "amount", Value: int32(1)},
+			{Key: "timezone", Value: "America/New_York"},
+		}}}, res: date("2021-03-15T00:30:15.250Z")},
+		{expr: bson.D{{Key: "$dateSubtract", Value: bson.D{
+			{Key: "startDate", Value: "$d"},
+			{Key: "unit", Value: "hour"},
+			{Key: "amount", Value: int64(2)},
+		}}}, res: date("2021-03-13T23:30:15.250Z")},
+		{expr: bson.D{{Key: "$dateAdd", Value: bson.D{
+			{Key: "startDate", Value: "$d"},
+			{Key: "unit", Value: "hour"},
+			{Key: "amount", Value: 1.5},
+		}}}, err: "$dateAdd: amount must be an integer, found double"},
+		// diff
+		{expr: bson.D{{Key: "$dateDiff", Value: bson.D{
+			{Key: "startDate", Value: "$d"},
+			{Key: "endDate", Value: "$e"},
+			{Key: "unit", Value: "month"},
+		}}}, res: int64(10)},
+		{expr: bson.D{{Key: "$dateDiff", Value: bson.D{
+			{Key: "startDate", Value: "$d"},
+			{Key: "endDate", Value: "$e"},
+			{Key: "unit", Value: "year"},
+		}}}, res: int64(1)},
+		{expr: bson.D{{Key: "$dateDiff", Value: bson.D{
+			{Key: "startDate", Value: "$d"},
+			{Key: "endDate", Value: "$e"},
+			{Key: "unit", Value: "day"},
+		}}}, res: int64(323)},
+		{expr: bson.D{{Key: "$dateDiff", Value: bson.D{
+			{Key: "startDate", Value: "$d"},
+			{Key: "endDate", Value: date("2021-03-15T00:00:00Z")},
+			{Key: "unit", Value: "week"},
+			{Key: "startOfWeek", Value: "mon"},
+		}}}, res: int64(1)},
+		{expr: bson.D{{Key: "$dateDiff", Value: bson.D{
+			{Key: "startDate", Value: "$d"},
+			{Key: "endDate", Value: "$n"},
+			{Key: "unit", Value: "day"},
+		}}}, res: nil},
+	}
+
+	for _, item := range table {
+		res, err := Evaluate(doc, item.expr, nil)
+		if item.err != "" {
+			assert.Error(t, err, item.expr)
+			if err != nil {
+				assert.Equal(t, item.err, err.Error(), item.expr)
+			}
+		} else {
+			assert.NoError(t, err, item.expr)
+			assert.Equal(t, item.res, res, item.expr)
+		}
+	}
+}
+
+func TestDateBucketing(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "t", Value: date("2021-06-01T03:00:00Z")}},
+		{{Key: "_id", Value: int32(2)}, {Key: "t", Value: date("2021-06-01T12:00:00Z")}},
+		{{Key: "_id", Value: int32(3)}, {Key: "t", Value: date("2021-06-02T02:00:00Z")}},
+	}
+
+	aggregateTest(t, docs, func(fn func(bson.A, interface{})) {
+		fn(bson.A{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{{Key: "$dateToString", Value: bson.D{
+					{Key: "date", Value: "$t"},
+					{Key: "format", Value: "%Y-%m-%d"},
+					{Key: "timezone", Value: "America/New_York"},
+				}}}},
+				{Key: "n", Value: bson.D{{Key: "$sum", Value: int32(1)}}},
+			}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+		}, []bson.D{
+			{{Key: "_id", Value: "2021-05-31"}, {Key: "n", Value: int32(1)}},
+			{{Key: "_id", Value: "2021-06-01"}, {Key: "n", Value: int32(2)}},
+		})
+	})
+}
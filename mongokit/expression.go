@@ -0,0 +1,665 @@
+package mongokit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// https://github.com/mongodb/mongo/blob/master/src/mongo/db/pipeline/expression.cpp
+
+// ExpressionOperator is an aggregation expression operator. It receives the
+// unevaluated argument of the operator invocation.
+type ExpressionOperator func(scope *Scope, op string, arg interface{}) (interface{}, error)
+
+// AggregationExpressionOperators defines the aggregation expression operators.
+var AggregationExpressionOperators = map[string]ExpressionOperator{}
+
+func init() {
+	// register literal operator
+	AggregationExpressionOperators["$literal"] = exprLiteral
+
+	// register arithmetic operators
+	AggregationExpressionOperators["$add"] = exprAdd
+	AggregationExpressionOperators["$subtract"] = exprSubtract
+	AggregationExpressionOperators["$multiply"] = exprMultiply
+	AggregationExpressionOperators["$divide"] = exprDivide
+	AggregationExpressionOperators["$mod"] = exprMod
+
+	// register comparison operators
+	AggregationExpressionOperators["$cmp"] = exprCompare
+	AggregationExpressionOperators["$eq"] = exprCompare
+	AggregationExpressionOperators["$ne"] = exprCompare
+	AggregationExpressionOperators["$gt"] = exprCompare
+	AggregationExpressionOperators["$gte"] = exprCompare
+	AggregationExpressionOperators["$lt"] = exprCompare
+	AggregationExpressionOperators["$lte"] = exprCompare
+
+	// register boolean operators
+	AggregationExpressionOperators["$and"] = exprAnd
+	AggregationExpressionOperators["$or"] = exprOr
+	AggregationExpressionOperators["$not"] = exprNot
+
+	// register conditional operators
+	AggregationExpressionOperators["$cond"] = exprCond
+	AggregationExpressionOperators["$ifNull"] = exprIfNull
+}
+
+// Scope is the scope in which aggregation expressions are evaluated.
+type Scope struct {
+	// The current document used to resolve field paths ($$CURRENT).
+	Current bsonkit.Doc
+
+	// The root document ($$ROOT).
+	Root bsonkit.Doc
+
+	// The user and system variables.
+	Variables map[string]interface{}
+
+	// The metadata of the current document available using the $meta
+	// operator e.g. "searchScore".
+	Meta map[string]interface{}
+}
+
+// NewScope creates and returns a new scope for the specified document.
+func NewScope(doc bsonkit.Doc, variables map[string]interface{}) *Scope {
+	return &Scope{
+		Current:   doc,
+		Root:      doc,
+		Variables: variables,
+	}
+}
+
+// With will return a child scope that additionally provides the specified
+// variables.
+func (s *Scope) With(variables map[string]interface{}) *Scope {
+	// merge variables
+	merged := make(map[string]interface{}, len(s.Variables)+len(variables))
+	for name, value := range s.Variables {
+		merged[name] = value
+	}
+	for name, value := range variables {
+		merged[name] = value
+	}
+
+	return &Scope{
+		Current:   s.Current,
+		Root:      s.Root,
+		Variables: merged,
+		Meta:      s.Meta,
+	}
+}
+
+// Evaluate will evaluate the aggregation expression in the scope. Missing
+// values are returned as bsonkit.Missing.
+func Evaluate(doc bsonkit.Doc, expr interface{}, variables map[string]interface{}) (interface{}, error) {
+	return NewScope(doc, variables).Evaluate(expr)
+}
+
+// Evaluate will evaluate the aggregation expression in the scope. Missing
+// values are returned as bsonkit.Missing.
+func (s *Scope) Evaluate(expr interface{}) (interface{}, error) {
+	switch expr := expr.(type) {
+	case string:
+		// handle variables
+		if strings.HasPrefix(expr, "$$") {
+			return s.variable(expr[2:])
+		}
+
+		// handle field paths
+		if strings.HasPrefix(expr, "$") {
+			if len(expr) == 1 {
+				return nil, fmt.Errorf("'$' by itself is not a valid FieldPath")
+			}
+			return fieldPath(*s.Current, expr[1:]), nil
+		}
+
+		return expr, nil
+	case bson.D:
+		// handle operators
+		if len(expr) > 0 && strings.HasPrefix(expr[0].Key, "$") {
+			// check length
+			if len(expr) != 1 {
+				return nil, fmt.Errorf("an expression specification must contain exactly one field, the name of the expression")
+			}
+
+			// lookup operator
+			operator := AggregationExpressionOperators[expr[0].Key]
+			if operator == nil {
+				return nil, fmt.Errorf("unknown expression operator %q", expr[0].Key)
+			}
+
+			return operator(s, expr[0].Key, expr[0].Value)
+		}
+
+		// evaluate object
+		doc := make(bson.D, 0, len(expr))
+		for _, field := range expr {
+			value, err := s.Evaluate(field.Value)
+			if err != nil {
+				return nil, err
+			}
+			if value != bsonkit.Missing {
+				doc = append(doc, bson.E{Key: field.Key, Value: value})
+			}
+		}
+
+		return doc, nil
+	case bson.A:
+		// evaluate array
+		array := make(bson.A, 0, len(expr))
+		for _, item := range expr {
+			value, err := s.Evaluate(item)
+			if err != nil {
+				return nil, err
+			}
+			if value == bsonkit.Missing {
+				value = nil
+			}
+			array = append(array, value)
+		}
+
+		return array, nil
+	default:
+		return expr, nil
+	}
+}
+
+func (s *Scope) variable(path string) (interface{}, error) {
+	// split name and path
+	name, rest := path, ""
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		name, rest = path[:i], path[i+1:]
+	}
+
+	// get value
+	var value interface{}
+	switch name {
+	case "CURRENT":
+		value = *s.Current
+	case "ROOT":
+		value = *s.Root
+	case "REMOVE":
+		return bsonkit.Missing, nil
+	default:
+		var ok bool
+		value, ok = s.Variables[name]
+		if !ok && name == "NOW" {
+			value = primitive.NewDateTimeFromTime(time.Now())
+		} else if !ok {
+			return nil, fmt.Errorf("use of undefined variable: %s", name)
+		}
+	}
+
+	// resolve path
+	if rest != "" {
+		return fieldPath(value, rest), nil
+	}
+
+	return value, nil
+}
+
+func fieldPath(v interface{}, path string) interface{} {
+	// get key
+	key := bsonkit.PathSegment(path)
+	rest := bsonkit.ReducePath(path)
+
+	switch v := v.(type) {
+	case bson.D:
+		for _, field := range v {
+			if field.Key == key {
+				if rest == bsonkit.PathEnd {
+					return field.Value
+				}
+				return fieldPath(field.Value, rest)
+			}
+		}
+	case bson.A:
+		// collect values from embedded documents and arrays
+		array := make(bson.A, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case bson.D, bson.A:
+				value := fieldPath(item, path)
+				if value != bsonkit.Missing {
+					array = append(array, value)
+				}
+			}
+		}
+		return array
+	}
+
+	return bsonkit.Missing
+}
+
+func (s *Scope) evaluateArgs(op string, arg interface{}, min, max int) (bson.A, error) {
+	// wrap single argument
+	list, ok := arg.(bson.A)
+	if !ok {
+		list = bson.A{arg}
+	}
+
+	// check length
+	if len(list) < min || (max >= 0 && len(list) > max) {
+		if min == max {
+			return nil, fmt.Errorf("%s: expected %d arguments", op, min)
+		}
+		return nil, fmt.Errorf("%s: invalid number of arguments", op)
+	}
+
+	// evaluate arguments
+	args := make(bson.A, 0, len(list))
+	for _, item := range list {
+		value, err := s.Evaluate(item)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	return args, nil
+}
+
+func isNullish(v interface{}) bool {
+	return v == nil || v == bsonkit.Missing || v == primitive.Null{}
+}
+
+func anyNullish(args bson.A) bool {
+	for _, arg := range args {
+		if isNullish(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int32, int64, float64, primitive.Decimal128:
+		return true
+	default:
+		return false
+	}
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil, primitive.Null, bsonkit.MissingType, primitive.Undefined:
+		return false
+	case bool:
+		return v
+	case int32:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case primitive.Decimal128:
+		f, _ := strconv.ParseFloat(v.String(), 64)
+		return f != 0
+	default:
+		return true
+	}
+}
+
+func typeName(v interface{}) string {
+	if v == bsonkit.Missing {
+		return "missing"
+	}
+	_, typ := bsonkit.Inspect(v)
+	return bsonkit.Type2Alias[typ]
+}
+
+func compareExpr(a, b interface{}) int {
+	// missing values sort before null
+	if a == bsonkit.Missing && b == bsonkit.Missing {
+		return 0
+	} else if a == bsonkit.Missing {
+		return -1
+	} else if b == bsonkit.Missing {
+		return 1
+	}
+
+	return bsonkit.Compare(a, b)
+}
+
+func exprLiteral(_ *Scope, _ string, arg interface{}) (interface{}, error) {
+	return arg, nil
+}
+
+func exprAdd(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if anyNullish(args) {
+		return nil, nil
+	}
+
+	// sum numbers and find date
+	var sum interface{} = int32(0)
+	var date *primitive.DateTime
+	for _, value := range args {
+		switch value := value.(type) {
+		case primitive.DateTime:
+			if date != nil {
+				return nil, fmt.Errorf("%s: only one date allowed", op)
+			}
+			date = &value
+		default:
+			if !isNumber(value) {
+				return nil, fmt.Errorf("%s: only supports numeric or date types, not %s", op, typeName(value))
+			}
+			sum = bsonkit.Add(sum, value)
+		}
+	}
+
+	// add to date
+	if date != nil {
+		ms, _ := toInt64(sum)
+		return *date + primitive.DateTime(ms), nil
+	}
+
+	return sum, nil
+}
+
+func exprSubtract(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if anyNullish(args) {
+		return nil, nil
+	}
+
+	// handle dates
+	if date, ok := args[0].(primitive.DateTime); ok {
+		switch value := args[1].(type) {
+		case primitive.DateTime:
+			return int64(date - value), nil
+		default:
+			ms, ok := toInt64(value)
+			if !ok {
+				return nil, fmt.Errorf("%s: cannot subtract %s from a date", op, typeName(value))
+			}
+			return date - primitive.DateTime(ms), nil
+		}
+	}
+
+	// check numbers
+	if !isNumber(args[0]) || !isNumber(args[1]) {
+		return nil, fmt.Errorf("%s: only supports numeric or date types, not %s and %s", op, typeName(args[0]), typeName(args[1]))
+	}
+
+	return bsonkit.Add(args[0], bsonkit.Mul(args[1], int32(-1))), nil
+}
+
+func exprMultiply(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if anyNullish(args) {
+		return nil, nil
+	}
+
+	// multiply numbers
+	var product interface{} = int32(1)
+	for _, value := range args {
+		if !isNumber(value) {
+			return nil, fmt.Errorf("%s: only supports numeric types, not %s", op, typeName(value))
+		}
+		product = bsonkit.Mul(product, value)
+	}
+
+	return product, nil
+}
+
+func exprDivide(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if anyNullish(args) {
+		return nil, nil
+	}
+
+	// check numbers
+	if !isNumber(args[0]) || !isNumber(args[1]) {
+		return nil, fmt.Errorf("%s: only supports numeric types, not %s and %s", op, typeName(args[0]), typeName(args[1]))
+	}
+
+	// divide numbers
+	res := bsonkit.Div(args[0], args[1])
+	if res == bsonkit.Missing {
+		return nil, fmt.Errorf("%s: can't divide by zero", op)
+	}
+
+	return res, nil
+}
+
+func exprMod(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if anyNullish(args) {
+		return nil, nil
+	}
+
+	// check numbers
+	if !isNumber(args[0]) || !isNumber(args[1]) {
+		return nil, fmt.Errorf("%s: only supports numeric types, not %s and %s", op, typeName(args[0]), typeName(args[1]))
+	}
+
+	// check divisor
+	if bsonkit.Compare(args[1], int32(0)) == 0 {
+		return nil, fmt.Errorf("%s: can't mod by zero", op)
+	}
+
+	return bsonkit.Mod(args[0], args[1]), nil
+}
+
+func exprCompare(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// compare values
+	res := compareExpr(args[0], args[1])
+
+	switch op {
+	case "$cmp":
+		return int32(res), nil
+	case "$eq":
+		return res == 0, nil
+	case "$ne":
+		return res != 0, nil
+	case "$gt":
+		return res > 0, nil
+	case "$gte":
+		return res >= 0, nil
+	case "$lt":
+		return res < 0, nil
+	case "$lte":
+		return res <= 0, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown comparison", op)
+	}
+}
+
+func exprAnd(scope *Scope, _ string, arg interface{}) (interface{}, error) {
+	// wrap single argument
+	list, ok := arg.(bson.A)
+	if !ok {
+		list = bson.A{arg}
+	}
+
+	// evaluate until false
+	for _, item := range list {
+		value, err := scope.Evaluate(item)
+		if err != nil {
+			return nil, err
+		} else if !truthy(value) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func exprOr(scope *Scope, _ string, arg interface{}) (interface{}, error) {
+	// wrap single argument
+	list, ok := arg.(bson.A)
+	if !ok {
+		list = bson.A{arg}
+	}
+
+	// evaluate until true
+	for _, item := range list {
+		value, err := scope.Evaluate(item)
+		if err != nil {
+			return nil, err
+		} else if truthy(value) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func exprNot(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return !truthy(args[0]), nil
+}
+
+func exprCond(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// get branches
+	var cond, then, otherwise interface{}
+	switch arg := arg.(type) {
+	case bson.A:
+		if len(arg) != 3 {
+			return nil, fmt.Errorf("%s: expected 3 arguments", op)
+		}
+		cond, then, otherwise = arg[0], arg[1], arg[2]
+	case bson.D:
+		var found int
+		for _, field := range arg {
+			switch field.Key {
+			case "if":
+				cond = field.Value
+			case "then":
+				then = field.Value
+			case "else":
+				otherwise = field.Value
+			default:
+				return nil, fmt.Errorf("%s: unrecognized parameter %q", op, field.Key)
+			}
+			found++
+		}
+		if found != 3 {
+			return nil, fmt.Errorf("%s: missing 'if', 'then' or 'else' parameter", op)
+		}
+	default:
+		return nil, fmt.Errorf("%s: expected array or document", op)
+	}
+
+	// evaluate condition
+	value, err := scope.Evaluate(cond)
+	if err != nil {
+		return nil, err
+	}
+
+	// evaluate branch
+	if truthy(value) {
+		return scope.Evaluate(then)
+	}
+
+	return scope.Evaluate(otherwise)
+}
+
+func exprIfNull(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// get list
+	list, ok := arg.(bson.A)
+	if !ok || len(list) < 2 {
+		return nil, fmt.Errorf("%s: expected at least 2 arguments", op)
+	}
+
+	// return first non null value
+	for i, item := range list {
+		value, err := scope.Evaluate(item)
+		if err != nil {
+			return nil, err
+		} else if i == len(list)-1 || !isNullish(value) {
+			return value, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return 0, false
+		}
+		return int64(f), true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return 0, false
+		}
+		return f, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,103 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestEvaluate(t *testing.T) {
+	doc := &bson.D{
+		{Key: "a", Value: int32(3)},
+		{Key: "b", Value: bson.D{{Key: "c", Value: "d"}}},
+		{Key: "e", Value: bson.A{
+			bson.D{{Key: "f", Value: int32(1)}},
+			bson.D{{Key: "g", Value: int32(2)}},
+			bson.D{{Key: "f", Value: int32(3)}},
+		}},
+		{Key: "n", Value: nil},
+		{Key: "t", Value: primitive.DateTime(1000)},
+	}
+
+	table := []struct {
+		expr interface{}
+		res  interface{}
+		err  string
+	}{
+		// literals
+		{expr: int32(1), res: int32(1)},
+		{expr: "foo", res: "foo"},
+		{expr: bson.D{{Key: "$literal", Value: "$a"}}, res: "$a"},
+		// field paths
+		{expr: "$a", res: int32(3)},
+		{expr: "$b.c", res: "d"},
+		{expr: "$e.f", res: bson.A{int32(1), int32(3)}},
+		{expr: "$x", res: bsonkit.Missing},
+		{expr: "$", err: "'$' by itself is not a valid FieldPath"},
+		// variables
+		{expr: "$$CURRENT.a", res: int32(3)},
+		{expr: "$$ROOT.b.c", res: "d"},
+		{expr: "$$REMOVE", res: bsonkit.Missing},
+		{expr: "$$foo", err: "use of undefined variable: foo"},
+		// objects and arrays
+		{expr: bson.D{{Key: "x", Value: "$a"}, {Key: "y", Value: "$x"}}, res: bson.D{{Key: "x", Value: int32(3)}}},
+		{expr: bson.A{"$a", "$x"}, res: bson.A{int32(3), nil}},
+		// operators
+		{expr: bson.D{{Key: "$foo", Value: int32(1)}}, err: `unknown expression operator "$foo"`},
+		{expr: bson.D{{Key: "$add", Value: bson.A{"$a", int32(2), 1.5}}}, res: 6.5},
+		{expr: bson.D{{Key: "$add", Value: bson.A{"$a", "$n"}}}, res: nil},
+		{expr: bson.D{{Key: "$add", Value: bson.A{"$t", int32(500)}}}, res: primitive.DateTime(1500)},
+		{expr: bson.D{{Key: "$add", Value: bson.A{"$a", "$b"}}}, err: "$add: only supports numeric or date types, not object"},
+		{expr: bson.D{{Key: "$subtract", Value: bson.A{"$a", int32(5)}}}, res: int32(-2)},
+		{expr: bson.D{{Key: "$subtract", Value: bson.A{"$t", "$t"}}}, res: int64(0)},
+		{expr: bson.D{{Key: "$multiply", Value: bson.A{"$a", int64(2)}}}, res: int64(6)},
+		{expr: bson.D{{Key: "$divide", Value: bson.A{"$a", int32(2)}}}, res: 1.5},
+		{expr: bson.D{{Key: "$divide", Value: bson.A{"$a", int32(0)}}}, err: "$divide: can't divide by zero"},
+		{expr: bson.D{{Key: "$mod", Value: bson.A{"$a", int32(2)}}}, res: int32(1)},
+		{expr: bson.D{{Key: "$eq", Value: bson.A{"$a", int64(3)}}}, res: true},
+		{expr: bson.D{{Key: "$lt", Value: bson.A{"$x", nil}}}, res: true},
+		{expr: bson.D{{Key: "$cmp", Value: bson.A{"$a", int32(4)}}}, res: int32(-1)},
+		{expr: bson.D{{Key: "$and", Value: bson.A{"$a", "$b"}}}, res: true},
+		{expr: bson.D{{Key: "$or", Value: bson.A{"$n", int32(0)}}}, res: false},
+		{expr: bson.D{{Key: "$not", Value: "$x"}}, res: true},
+		{expr: bson.D{{Key: "$cond", Value: bson.D{
+			{Key: "if", Value: "$n"},
+			{Key: "then", Value: "yes"},
+			{Key: "else", Value: "no"},
+		}}}, res: "no"},
+		{expr: bson.D{{Key: "$ifNull", Value: bson.A{"$n", "$x", "$a"}}}, res: int32(3)},
+		{expr: bson.D{{Key: "$a", Value: int32(1)}, {Key: "$b", Value: int32(1)}}, err: "an expression specification must contain exactly one field, the name of the expression"},
+	}
+
+	for _, item := range table {
+		res, err := Evaluate(doc, item.expr, nil)
+		if item.err != "" {
+			assert.Error(t, err, item.expr)
+			assert.Equal(t, item.err, err.Error(), item.expr)
+		} else {
+			assert.NoError(t, err, item.expr)
+			assert.Equal(t, item.res, res, item.expr)
+		}
+	}
+}
+
+func TestScopeWith(t *testing.T) {
+	scope := NewScope(&bson.D{}, map[string]interface{}{
+		"a": int32(1),
+	})
+
+	child := scope.With(map[string]interface{}{
+		"b": int32(2),
+	})
+
+	res, err := child.Evaluate(bson.A{"$$a", "$$b"})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.A{int32(1), int32(2)}, res)
+
+	_, err = scope.Evaluate("$$b")
+	assert.Error(t, err)
+}
@@ -0,0 +1,537 @@
+package mongokit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// MaxDensifyDocuments is the maximum number of documents that may be
+// generated by a single $densify stage.
+var MaxDensifyDocuments = 500000
+
+func init() {
+	// register gap filling stages
+	AggregationStages["$densify"] = stageDensify
+	AggregationStages["$fill"] = stageFill
+}
+
+func stageDensify(_ *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get parameters
+	params, err := getParameters("$densify", arg, []string{"field", "range"}, "partitionByFields")
+	if err != nil {
+		return nil, err
+	}
+
+	// get field
+	field, ok := params["field"].(string)
+	if !ok || field == "" || strings.HasPrefix(field, "$") {
+		return nil, fmt.Errorf("$densify: field must be a non-empty field path without '$'")
+	}
+
+	// get partition fields
+	partitionFields, err := getPartitionFields("$densify", params["partitionByFields"])
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range partitionFields {
+		if name == field || strings.HasPrefix(name, field+".") || strings.HasPrefix(field, name+".") {
+			return nil, fmt.Errorf("$densify: field %q must not overlap with partitionByFields", field)
+		}
+	}
+
+	// get range
+	rng, err := getParameters("$densify.range", params["range"], []string{"step", "bounds"}, "unit")
+	if err != nil {
+		return nil, err
+	}
+
+	// get unit
+	var unit string
+	if value, ok := rng["unit"]; ok {
+		unit, err = getUnit("$densify", value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// get step
+	step := rng["step"]
+	if !isNumber(step) || compareExpr(step, int32(0)) <= 0 {
+		return nil, fmt.Errorf("$densify: step must be a positive number")
+	}
+	var dateStep int64
+	if unit != "" {
+		n, ok := toInt64(step)
+		f, _ := toFloat64(step)
+		if !ok || float64(n) != f {
+			return nil, fmt.Errorf("$densify: step must be an integer if a unit is specified")
+		}
+		dateStep = n
+	}
+
+	// check values
+	var values, nulls bsonkit.List
+	for _, doc := range list {
+		value := bsonkit.Get(doc, field)
+		if isNullish(value) {
+			nulls = append(nulls, doc)
+			continue
+		}
+		if err := checkDensifyValue(value, unit); err != nil {
+			return nil, err
+		}
+		values = append(values, doc)
+	}
+
+	// get bounds
+	var lower, upper interface{}
+	var full, exclusive bool
+	switch bounds := rng["bounds"].(type) {
+	case string:
+		switch bounds {
+		case "full":
+			full = true
+		case "partition":
+		default:
+			return nil, fmt.Errorf("$densify: bounds must be 'full', 'partition' or an array of two values, found %q", bounds)
+		}
+	case bson.A:
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("$densify: bounds must be 'full', 'partition' or an array of two values")
+		}
+		for _, bound := range bounds {
+			if err := checkDensifyValue(bound, unit); err != nil {
+				return nil, err
+			}
+		}
+		if compareExpr(bounds[0], bounds[1]) > 0 {
+			return nil, fmt.Errorf("$densify: lower bound must not be greater than the upper bound")
+		}
+		lower, upper, exclusive = bounds[0], bounds[1], true
+	default:
+		return nil, fmt.Errorf("$densify: bounds must be 'full', 'partition' or an array of two values")
+	}
+
+	// sort documents by field
+	sort.SliceStable(values, func(i, j int) bool {
+		return compareExpr(bsonkit.Get(values[i], field), bsonkit.Get(values[j], field)) < 0
+	})
+
+	// get full bounds
+	if full && len(values) > 0 {
+		lower = bsonkit.Get(values[0], field)
+		upper = bsonkit.Get(values[len(values)-1], field)
+	}
+
+	// partition documents
+	partitions, err := partitionList(values, func(doc bsonkit.Doc) (interface{}, error) {
+		return partitionKey(doc, partitionFields), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// densify partitions
+	result := append(bsonkit.List{}, nulls...)
+	generated := 0
+	for _, partition := range partitions {
+		// get partition bounds
+		low, high := lower, upper
+		if low == nil {
+			low = bsonkit.Get(partition[0], field)
+			high = bsonkit.Get(partition[len(partition)-1], field)
+		}
+
+		// get partition template
+		template := bson.D{}
+		for _, name := range partitionFields {
+			value := bsonkit.Get(partition[0], name)
+			if value != bsonkit.Missing {
+				_, err = bsonkit.Put(&template, name, value, false)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		// merge documents with generated documents
+		i := 0
+		value := low
+		for n := int64(1); ; n++ {
+			// check bounds
+			cmp := compareExpr(value, high)
+			if cmp > 0 || (cmp == 0 && exclusive) {
+				break
+			}
+
+			// add preceding and equal documents
+			found := false
+			for ; i < len(partition); i++ {
+				cmp := compareExpr(bsonkit.Get(partition[i], field), value)
+				if cmp > 0 {
+					break
+				}
+				found = found || cmp == 0
+				result = append(result, partition[i])
+			}
+			if found {
+				value = nextDensifyValue(low, value, step, unit, dateStep, n)
+				continue
+			}
+
+			// check limit
+			generated++
+			if generated > MaxDensifyDocuments {
+				return nil, fmt.Errorf("$densify: exceeded the maximum of %d generated documents", MaxDensifyDocuments)
+			}
+
+			// add generated document
+			doc := bsonkit.Clone(&template)
+			_, err = bsonkit.Put(doc, field, value, false)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, doc)
+
+			// get next value
+			value = nextDensifyValue(low, value, step, unit, dateStep, n)
+		}
+
+		// add remaining documents
+		result = append(result, partition[i:]...)
+	}
+
+	return result, nil
+}
+
+func checkDensifyValue(value interface{}, unit string) error {
+	// check dates
+	if unit != "" {
+		if _, ok := value.(primitive.DateTime); !ok {
+			return fmt.Errorf("$densify: values must be dates if a unit is specified, found %s", typeName(value))
+		}
+		return nil
+	}
+
+	// check numbers
+	if !isNumber(value) {
+		return fmt.Errorf("$densify: values must be numeric if no unit is specified, found %s", typeName(value))
+	}
+
+	return nil
+}
+
+func nextDensifyValue(lower, value, step interface{}, unit string, dateStep, n int64) interface{} {
+	// handle dates, which are always computed from the lower bound to
+	// prevent the clamping of month ends from accumulating
+	if unit != "" {
+		t := lower.(primitive.DateTime).Time().UTC()
+		return fromTime(addDate(t, unit, dateStep*n))
+	}
+
+	return bsonkit.Add(value, step)
+}
+
+func stageFill(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get parameters
+	params, err := getParameters("$fill", arg, []string{"output"}, "partitionBy", "partitionByFields", "sortBy")
+	if err != nil {
+		return nil, err
+	}
+
+	// get partitioning
+	partitionExpr, hasPartitionExpr := params["partitionBy"]
+	partitionFields, err := getPartitionFields("$fill", params["partitionByFields"])
+	if err != nil {
+		return nil, err
+	} else if hasPartitionExpr && partitionFields != nil {
+		return nil, fmt.Errorf("$fill: only one of partitionBy and partitionByFields may be specified")
+	}
+
+	// get sort
+	var sortBy bson.D
+	if value, ok := params["sortBy"]; ok {
+		sortBy, ok = value.(bson.D)
+		if !ok || len(sortBy) == 0 {
+			return nil, fmt.Errorf("$fill: sortBy must be a non-empty document")
+		}
+	}
+
+	// get output
+	output, ok := params["output"].(bson.D)
+	if !ok || len(output) == 0 {
+		return nil, fmt.Errorf("$fill: output must be a non-empty document")
+	}
+
+	// prepare outputs
+	type fill struct {
+		field  string
+		value  interface{}
+		method string
+	}
+	var fills []fill
+	for _, field := range output {
+		// get specification
+		spec, err := getParameters("$fill", field.Value, nil, "value", "method")
+		if err != nil {
+			return nil, err
+		} else if len(spec) != 1 {
+			return nil, fmt.Errorf("$fill: output field %q must specify exactly one of value or method", field.Key)
+		}
+
+		// handle value
+		if value, ok := spec["value"]; ok {
+			fills = append(fills, fill{field: field.Key, value: value})
+			continue
+		}
+
+		// check method
+		method, _ := spec["method"].(string)
+		if method != "linear" && method != "locf" {
+			return nil, fmt.Errorf("$fill: method must be 'linear' or 'locf', found %v", spec["method"])
+		} else if sortBy == nil {
+			return nil, fmt.Errorf("$fill: sortBy is required if a method is specified")
+		} else if method == "linear" && len(sortBy) != 1 {
+			return nil, fmt.Errorf("$fill: sortBy must specify a single field if the linear method is specified")
+		}
+		fills = append(fills, fill{field: field.Key, method: method})
+	}
+
+	// sort documents
+	if sortBy != nil {
+		list, err = Sort(list, &sortBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// partition documents
+	partitions, err := partitionList(list, func(doc bsonkit.Doc) (interface{}, error) {
+		if hasPartitionExpr {
+			value, err := Evaluate(doc, partitionExpr, ctx.Variables)
+			if err != nil {
+				return nil, err
+			} else if value == bsonkit.Missing {
+				value = nil
+			}
+			return value, nil
+		}
+		return partitionKey(doc, partitionFields), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// fill partitions
+	result := make(bsonkit.List, 0, len(list))
+	for _, partition := range partitions {
+		// clone documents
+		docs := make(bsonkit.List, 0, len(partition))
+		for _, doc := range partition {
+			docs = append(docs, bsonkit.Clone(doc))
+		}
+
+		// fill fields
+		for _, f := range fills {
+			var err error
+			switch f.method {
+			case "":
+				err = fillValue(ctx, partition, docs, f.field, f.value)
+			case "locf":
+				err = fillLOCF(docs, f.field)
+			case "linear":
+				err = fillLinear(docs, f.field, sortBy[0].Key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, docs...)
+	}
+
+	return result, nil
+}
+
+func fillValue(ctx *AggregationContext, partition, docs bsonkit.List, field string, expr interface{}) error {
+	for i, doc := range docs {
+		// skip present values
+		if !isNullish(bsonkit.Get(doc, field)) {
+			continue
+		}
+
+		// evaluate value on the original document
+		value, err := Evaluate(partition[i], expr, ctx.Variables)
+		if err != nil {
+			return err
+		} else if value == bsonkit.Missing {
+			value = nil
+		}
+
+		// set value
+		_, err = bsonkit.Put(doc, field, value, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fillLOCF(docs bsonkit.List, field string) error {
+	var last interface{} = bsonkit.Missing
+	for _, doc := range docs {
+		// remember present values
+		value := bsonkit.Get(doc, field)
+		if !isNullish(value) {
+			last = value
+			continue
+		}
+
+		// carry last value forward
+		if last != bsonkit.Missing {
+			_, err := bsonkit.Put(doc, field, last, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func fillLinear(docs bsonkit.List, field, sortField string) error {
+	// get positions
+	positions := make([]float64, len(docs))
+	for i, doc := range docs {
+		value := bsonkit.Get(doc, sortField)
+		if date, ok := value.(primitive.DateTime); ok {
+			positions[i] = float64(date)
+		} else if f, ok := toFloat64(value); ok {
+			positions[i] = f
+		} else {
+			return fmt.Errorf("$fill: linear interpolation requires a numeric or date sortBy field, found %s", typeName(value))
+		}
+	}
+
+	// interpolate between present values
+	prev := -1
+	for i, doc := range docs {
+		// skip missing values
+		value := bsonkit.Get(doc, field)
+		if isNullish(value) {
+			continue
+		}
+
+		// check value
+		if !isNumber(value) {
+			return fmt.Errorf("$fill: linear interpolation requires numeric values, found %s", typeName(value))
+		}
+
+		// fill gap
+		if prev >= 0 && i-prev > 1 {
+			y1, _ := toFloat64(bsonkit.Get(docs[prev], field))
+			y2, _ := toFloat64(value)
+			x1, x2 := positions[prev], positions[i]
+			for j := prev + 1; j < i; j++ {
+				y := y1
+				if x2 != x1 {
+					y = y1 + (y2-y1)*(positions[j]-x1)/(x2-x1)
+				}
+				_, err := bsonkit.Put(docs[j], field, y, false)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		prev = i
+	}
+
+	return nil
+}
+
+func getPartitionFields(op string, v interface{}) ([]string, error) {
+	// handle missing
+	if v == nil {
+		return nil, nil
+	}
+
+	// check array
+	array, ok := v.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%s: partitionByFields must be an array of field paths", op)
+	}
+
+	// get fields
+	fields := make([]string, 0, len(array))
+	for _, item := range array {
+		field, ok := item.(string)
+		if !ok || field == "" || strings.HasPrefix(field, "$") {
+			return nil, fmt.Errorf("%s: partitionByFields must be an array of field paths", op)
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+func partitionKey(doc bsonkit.Doc, fields []string) interface{} {
+	key := make(bson.A, 0, len(fields))
+	for _, field := range fields {
+		value := bsonkit.Get(doc, field)
+		if value == bsonkit.Missing {
+			value = nil
+		}
+		key = append(key, value)
+	}
+
+	return key
+}
+
+func partitionList(list bsonkit.List, key func(bsonkit.Doc) (interface{}, error)) ([]bsonkit.List, error) {
+	// prepare partitions
+	type partition struct {
+		key  interface{}
+		list bsonkit.List
+	}
+	var index []*partition
+
+	// partition documents
+	for _, doc := range list {
+		// get key
+		k, err := key(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		// find partition
+		i := sort.Search(len(index), func(i int) bool {
+			return bsonkit.Compare(index[i].key, k) >= 0
+		})
+
+		// create partition if missing
+		if i == len(index) || bsonkit.Compare(index[i].key, k) != 0 {
+			index = append(index, nil)
+			copy(index[i+1:], index[i:])
+			index[i] = &partition{key: k}
+		}
+
+		// add document
+		index[i].list = append(index[i].list, doc)
+	}
+
+	// collect partitions in key order
+	partitions := make([]bsonkit.List, 0, len(index))
+	for _, p := range index {
+		partitions = append(partitions, p.list)
+	}
+
+	return partitions, nil
+}
@@ -0,0 +1,255 @@
+package mongokit
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAggregateDensify(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(1)}},
+		{{Key: "_id", Value: int32(2)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(4)}},
+		{{Key: "_id", Value: int32(3)}, {Key: "g", Value: "b"}, {Key: "v", Value: int32(2)}},
+		{{Key: "_id", Value: int32(4)}, {Key: "g", Value: "b"}, {Key: "v", Value: nil}},
+	}
+
+	aggregateTest(t, docs, func(fn func(bson.A, interface{})) {
+		// full range
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "g", Value: "a"}}}},
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "v"},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: int32(1)},
+					{Key: "bounds", Value: "full"},
+				}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(1)}},
+			{{Key: "v", Value: int32(2)}},
+			{{Key: "v", Value: int32(3)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(4)}},
+		})
+
+		// partitions with full range
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "v", Value: bson.D{{Key: "$ne", Value: nil}}}}}},
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "v"},
+				{Key: "partitionByFields", Value: bson.A{"g"}},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: int32(2)},
+					{Key: "bounds", Value: "full"},
+				}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(1)}},
+			{{Key: "g", Value: "a"}, {Key: "v", Value: int32(3)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(4)}},
+			{{Key: "g", Value: "b"}, {Key: "v", Value: int32(1)}},
+			{{Key: "_id", Value: int32(3)}, {Key: "g", Value: "b"}, {Key: "v", Value: int32(2)}},
+			{{Key: "g", Value: "b"}, {Key: "v", Value: int32(3)}},
+		})
+
+		// partition range
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "v", Value: bson.D{{Key: "$ne", Value: nil}}}}}},
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "v"},
+				{Key: "partitionByFields", Value: bson.A{"g"}},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: int32(2)},
+					{Key: "bounds", Value: "partition"},
+				}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(1)}},
+			{{Key: "g", Value: "a"}, {Key: "v", Value: int32(3)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(4)}},
+			{{Key: "_id", Value: int32(3)}, {Key: "g", Value: "b"}, {Key: "v", Value: int32(2)}},
+		})
+
+		// explicit range
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "g", Value: "a"}}}},
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "v"},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: int32(1)},
+					{Key: "bounds", Value: bson.A{int32(2), int32(4)}},
+				}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(1)}},
+			{{Key: "v", Value: int32(2)}},
+			{{Key: "v", Value: int32(3)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "g", Value: "a"}, {Key: "v", Value: int32(4)}},
+		})
+
+		// null values
+		fn(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "g", Value: "b"}}}},
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "v"},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: int32(1)},
+					{Key: "bounds", Value: bson.A{int32(1), int32(3)}},
+				}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(4)}, {Key: "g", Value: "b"}, {Key: "v", Value: nil}},
+			{{Key: "v", Value: int32(1)}},
+			{{Key: "_id", Value: int32(3)}, {Key: "g", Value: "b"}, {Key: "v", Value: int32(2)}},
+		})
+
+		// date values without unit
+		fn(bson.A{
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "g"},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: int32(1)},
+					{Key: "bounds", Value: "full"},
+				}},
+			}}},
+		}, "$densify: values must be numeric if no unit is specified, found string")
+
+		// invalid step
+		fn(bson.A{
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "v"},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: int32(0)},
+					{Key: "bounds", Value: "full"},
+				}},
+			}}},
+		}, "$densify: step must be a positive number")
+	})
+}
+
+func TestAggregateDensifyDates(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "d", Value: date("2021-01-31T00:00:00Z")}},
+		{{Key: "_id", Value: int32(2)}, {Key: "d", Value: date("2021-04-30T00:00:00Z")}},
+	}
+
+	aggregateTest(t, docs, func(fn func(bson.A, interface{})) {
+		// months
+		fn(bson.A{
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "d"},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: int32(1)},
+					{Key: "unit", Value: "month"},
+					{Key: "bounds", Value: "full"},
+				}},
+			}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "d", Value: date("2021-01-31T00:00:00Z")}},
+			{{Key: "d", Value: date("2021-02-28T00:00:00Z")}},
+			{{Key: "d", Value: date("2021-03-31T00:00:00Z")}},
+			{{Key: "_id", Value: int32(2)}, {Key: "d", Value: date("2021-04-30T00:00:00Z")}},
+		})
+
+		// fractional step
+		fn(bson.A{
+			bson.D{{Key: "$densify", Value: bson.D{
+				{Key: "field", Value: "d"},
+				{Key: "range", Value: bson.D{
+					{Key: "step", Value: 1.5},
+					{Key: "unit", Value: "day"},
+					{Key: "bounds", Value: "full"},
+				}},
+			}}},
+		}, "$densify: step must be an integer if a unit is specified")
+	})
+}
+
+func TestAggregateFill(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "g", Value: "a"}, {Key: "t", Value: int32(1)}, {Key: "v", Value: int32(10)}},
+		{{Key: "_id", Value: int32(2)}, {Key: "g", Value: "a"}, {Key: "t", Value: int32(2)}, {Key: "v", Value: nil}},
+		{{Key: "_id", Value: int32(3)}, {Key: "g", Value: "a"}, {Key: "t", Value: int32(5)}, {Key: "v", Value: int32(40)}},
+		{{Key: "_id", Value: int32(4)}, {Key: "g", Value: "b"}, {Key: "t", Value: int32(1)}},
+		{{Key: "_id", Value: int32(5)}, {Key: "g", Value: "b"}, {Key: "t", Value: int32(3)}, {Key: "v", Value: int32(7)}},
+		{{Key: "_id", Value: int32(6)}, {Key: "g", Value: "b"}, {Key: "t", Value: int32(4)}},
+	}
+
+	aggregateTest(t, docs, func(fn func(bson.A, interface{})) {
+		// value
+		fn(bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: int32(1)}}}},
+			bson.D{{Key: "$fill", Value: bson.D{
+				{Key: "output", Value: bson.D{
+					{Key: "v", Value: bson.D{{Key: "value", Value: bson.D{{Key: "$multiply", Value: bson.A{"$t", int32(-1)}}}}}},
+				}},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "v", Value: int32(1)}}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "v", Value: int32(10)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "v", Value: int32(-2)}},
+			{{Key: "_id", Value: int32(3)}, {Key: "v", Value: int32(40)}},
+			{{Key: "_id", Value: int32(4)}, {Key: "v", Value: int32(-1)}},
+			{{Key: "_id", Value: int32(5)}, {Key: "v", Value: int32(7)}},
+			{{Key: "_id", Value: int32(6)}, {Key: "v", Value: int32(-4)}},
+		})
+
+		// last observation carried forward
+		fn(bson.A{
+			bson.D{{Key: "$fill", Value: bson.D{
+				{Key: "partitionByFields", Value: bson.A{"g"}},
+				{Key: "sortBy", Value: bson.D{{Key: "t", Value: int32(1)}}},
+				{Key: "output", Value: bson.D{
+					{Key: "v", Value: bson.D{{Key: "method", Value: "locf"}}},
+				}},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "v", Value: int32(1)}}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "v", Value: int32(10)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "v", Value: int32(10)}},
+			{{Key: "_id", Value: int32(3)}, {Key: "v", Value: int32(40)}},
+			{{Key: "_id", Value: int32(4)}},
+			{{Key: "_id", Value: int32(5)}, {Key: "v", Value: int32(7)}},
+			{{Key: "_id", Value: int32(6)}, {Key: "v", Value: int32(7)}},
+		})
+
+		// linear interpolation
+		fn(bson.A{
+			bson.D{{Key: "$fill", Value: bson.D{
+				{Key: "partitionBy", Value: "$g"},
+				{Key: "sortBy", Value: bson.D{{Key: "t", Value: int32(1)}}},
+				{Key: "output", Value: bson.D{
+					{Key: "v", Value: bson.D{{Key: "method", Value: "linear"}}},
+				}},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "v", Value: int32(1)}}}},
+		}, []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "v", Value: int32(10)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "v", Value: 17.5}},
+			{{Key: "_id", Value: int32(3)}, {Key: "v", Value: int32(40)}},
+			{{Key: "_id", Value: int32(4)}},
+			{{Key: "_id", Value: int32(5)}, {Key: "v", Value: int32(7)}},
+			{{Key: "_id", Value: int32(6)}},
+		})
+
+		// method without sort
+		fn(bson.A{
+			bson.D{{Key: "$fill", Value: bson.D{
+				{Key: "output", Value: bson.D{
+					{Key: "v", Value: bson.D{{Key: "method", Value: "locf"}}},
+				}},
+			}}},
+		}, "$fill: sortBy is required if a method is specified")
+
+		// conflicting partitions
+		fn(bson.A{
+			bson.D{{Key: "$fill", Value: bson.D{
+				{Key: "partitionBy", Value: "$g"},
+				{Key: "partitionByFields", Value: bson.A{"g"}},
+				{Key: "output", Value: bson.D{
+					{Key: "v", Value: bson.D{{Key: "value", Value: int32(0)}}},
+				}},
+			}}},
+		}, "$fill: only one of partitionBy and partitionByFields may be specified")
+	})
+}
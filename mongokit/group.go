@@ -0,0 +1,648 @@
+package mongokit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// https://github.com/mongodb/mongo/tree/master/src/mongo/db/pipeline/accumulator.h
+
+// Accumulator accumulates the values of a group.
+type Accumulator interface {
+	// Add will add the evaluated value of the accumulator expression. The
+	// value is bsonkit.Missing if the expression evaluated to nothing.
+	Add(value interface{}) error
+
+	// Result will return the accumulated value.
+	Result() interface{}
+}
+
+// Accumulators defines the available group accumulators.
+var Accumulators = map[string]func() Accumulator{}
+
+func init() {
+	// register accumulators
+	Accumulators["$sum"] = func() Accumulator { return &sumAccumulator{} }
+	Accumulators["$avg"] = func() Accumulator { return &avgAccumulator{} }
+	Accumulators["$min"] = func() Accumulator { return &extremeAccumulator{min: true} }
+	Accumulators["$max"] = func() Accumulator { return &extremeAccumulator{} }
+	Accumulators["$push"] = func() Accumulator { return &pushAccumulator{} }
+	Accumulators["$addToSet"] = func() Accumulator { return &addToSetAccumulator{} }
+	Accumulators["$first"] = func() Accumulator { return &firstAccumulator{} }
+	Accumulators["$last"] = func() Accumulator { return &lastAccumulator{} }
+	Accumulators["$stdDevPop"] = func() Accumulator { return &stdDevAccumulator{} }
+	Accumulators["$stdDevSamp"] = func() Accumulator { return &stdDevAccumulator{sample: true} }
+	Accumulators["$mergeObjects"] = func() Accumulator { return &mergeObjectsAccumulator{} }
+	Accumulators["$count"] = func() Accumulator { return &countAccumulator{} }
+
+	// register array forms of accumulators
+	for _, name := range []string{"$sum", "$avg", "$min", "$max", "$stdDevPop", "$stdDevSamp", "$mergeObjects"} {
+		AggregationExpressionOperators[name] = exprAccumulate
+	}
+}
+
+// FunctionAccumulator provides the Go functions used to emulate the
+// JavaScript functions of an $accumulator group operator.
+type FunctionAccumulator struct {
+	// The function called to create the initial state of a group with the
+	// evaluated "initArgs", which are evaluated against the first document of
+	// the group.
+	Init func(args bson.A) (interface{}, error)
+
+	// The function called for every document of a group with the current
+	// state and the evaluated "accumulateArgs". It returns the new state.
+	Accumulate func(state interface{}, args bson.A) (interface{}, error)
+
+	// The function called to merge two states of the same group. As groups
+	// are accumulated in a single pass, it is currently never called.
+	Merge func(state1, state2 interface{}) (interface{}, error)
+
+	// The optional function called with the final state of a group. It
+	// returns the value of the field.
+	Finalize func(state interface{}) (interface{}, error)
+}
+
+// Group will group the documents in the list by the evaluated _id expression
+// of the specified group document and compute the accumulator fields. Groups
+// are returned in the order of their first appearance. The $accumulator
+// operator is only available in pipelines run with function accumulators.
+func Group(list bsonkit.List, group bsonkit.Doc, variables map[string]interface{}) (bsonkit.List, error) {
+	return groupList(&AggregationContext{Variables: variables}, list, group)
+}
+
+func groupList(ctx *AggregationContext, list bsonkit.List, group bsonkit.Doc) (bsonkit.List, error) {
+	// get variables
+	variables := ctx.Variables
+
+	// get id expression
+	idExpr := bsonkit.Get(group, "_id")
+	if idExpr == bsonkit.Missing {
+		return nil, fmt.Errorf("a group specification must include an _id")
+	}
+
+	// prepare fields
+	type field struct {
+		name     string
+		op       string
+		expr     interface{}
+		fn       *FunctionAccumulator
+		initArgs interface{}
+	}
+	var fields []field
+	for _, pair := range *group {
+		// skip id
+		if pair.Key == "_id" {
+			continue
+		}
+
+		// check accumulator
+		doc, ok := pair.Value.(bson.D)
+		if !ok || len(doc) != 1 {
+			return nil, fmt.Errorf("the field %q must be an accumulator object", pair.Key)
+		}
+
+		// handle function accumulators
+		if doc[0].Key == "$accumulator" {
+			fn, initArgs, accumulateArgs, err := parseFunctionAccumulator(ctx, doc[0].Value)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{
+				name:     pair.Key,
+				op:       doc[0].Key,
+				expr:     accumulateArgs,
+				fn:       fn,
+				initArgs: initArgs,
+			})
+			continue
+		}
+
+		// check operator
+		if Accumulators[doc[0].Key] == nil {
+			return nil, fmt.Errorf("unknown group operator %q", doc[0].Key)
+		}
+
+		// add field
+		fields = append(fields, field{
+			name: pair.Key,
+			op:   doc[0].Key,
+			expr: doc[0].Value,
+		})
+	}
+
+	// prepare groups
+	type entry struct {
+		id   interface{}
+		accs []Accumulator
+	}
+	var groups []*entry
+	var index []*entry
+
+	// process documents
+	for _, doc := range list {
+		// prepare scope
+		scope := NewScope(doc, variables)
+
+		// evaluate id
+		id, err := scope.Evaluate(idExpr)
+		if err != nil {
+			return nil, err
+		} else if id == bsonkit.Missing {
+			id = nil
+		}
+
+		// find group
+		i := sort.Search(len(index), func(i int) bool {
+			return bsonkit.Compare(index[i].id, id) >= 0
+		})
+
+		// create group if missing
+		if i == len(index) || bsonkit.Compare(index[i].id, id) != 0 {
+			grp := &entry{id: id}
+			for _, f := range fields {
+				// handle function accumulators
+				if f.fn != nil {
+					acc, err := newFunctionAccumulator(scope, f.fn, f.initArgs)
+					if err != nil {
+						return nil, err
+					}
+					grp.accs = append(grp.accs, acc)
+					continue
+				}
+
+				grp.accs = append(grp.accs, Accumulators[f.op]())
+			}
+			groups = append(groups, grp)
+			index = append(index, nil)
+			copy(index[i+1:], index[i:])
+			index[i] = grp
+		}
+
+		// accumulate values
+		for j, f := range fields {
+			value, err := scope.Evaluate(f.expr)
+			if err != nil {
+				return nil, err
+			}
+			err = index[i].accs[j].Add(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// build results
+	result := make(bsonkit.List, 0, len(groups))
+	for _, grp := range groups {
+		doc := bson.D{{Key: "_id", Value: grp.id}}
+		for j, f := range fields {
+			// get value
+			value := grp.accs[j].Result()
+
+			// finalize function accumulators
+			if f.fn != nil && f.fn.Finalize != nil {
+				var err error
+				value, err = f.fn.Finalize(value)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			doc = append(doc, bson.E{Key: f.name, Value: value})
+		}
+		result = append(result, &doc)
+	}
+
+	return result, nil
+}
+
+func parseFunctionAccumulator(ctx *AggregationContext, spec interface{}) (*FunctionAccumulator, interface{}, interface{}, error) {
+	// check spec
+	doc, ok := spec.(bson.D)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("$accumulator: expected document")
+	}
+
+	// get fields
+	var name string
+	var initArgs interface{} = bson.A{}
+	var accumulateArgs interface{}
+	for _, field := range doc {
+		switch field.Key {
+		case "init", "merge", "finalize":
+			// ignore functions
+		case "initArgs":
+			initArgs = field.Value
+		case "accumulate":
+			switch value := field.Value.(type) {
+			case string:
+				name = value
+			case primitive.JavaScript:
+				name = string(value)
+			default:
+				return nil, nil, nil, fmt.Errorf("$accumulator: expected string or javascript for 'accumulate'")
+			}
+		case "accumulateArgs":
+			accumulateArgs = field.Value
+		case "lang":
+			if field.Value != "js" {
+				return nil, nil, nil, fmt.Errorf("$accumulator: unsupported language %v", field.Value)
+			}
+		default:
+			return nil, nil, nil, fmt.Errorf("$accumulator: unknown argument %q", field.Key)
+		}
+	}
+
+	// check fields
+	if name == "" {
+		return nil, nil, nil, fmt.Errorf("$accumulator: missing 'accumulate'")
+	} else if accumulateArgs == nil {
+		return nil, nil, nil, fmt.Errorf("$accumulator: missing 'accumulateArgs'")
+	}
+
+	// get function
+	fn, ok := ctx.Functions[name]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("$accumulator: no function accumulator registered for %q", name)
+	} else if fn.Init == nil || fn.Accumulate == nil {
+		return nil, nil, nil, fmt.Errorf("$accumulator: function accumulator %q is missing 'Init' or 'Accumulate'", name)
+	}
+
+	return &fn, initArgs, accumulateArgs, nil
+}
+
+func newFunctionAccumulator(scope *Scope, fn *FunctionAccumulator, initArgs interface{}) (Accumulator, error) {
+	// evaluate arguments
+	args, null, err := evaluateArray(scope, "$accumulator", initArgs, "initArgs")
+	if err != nil {
+		return nil, err
+	} else if null {
+		args = bson.A{}
+	}
+
+	// get initial state
+	state, err := fn.Init(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &functionAccumulator{
+		fn:    fn,
+		state: state,
+	}, nil
+}
+
+type functionAccumulator struct {
+	fn    *FunctionAccumulator
+	state interface{}
+}
+
+func (a *functionAccumulator) Add(value interface{}) error {
+	// check arguments
+	args, ok := value.(bson.A)
+	if !ok {
+		return fmt.Errorf("$accumulator requires accumulateArgs to be an array, found: %s", typeName(value))
+	}
+
+	// accumulate state
+	state, err := a.fn.Accumulate(a.state, args)
+	if err != nil {
+		return err
+	}
+	a.state = state
+
+	return nil
+}
+
+func (a *functionAccumulator) Result() interface{} {
+	return a.state
+}
+
+func exprAccumulate(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single array argument is accumulated by its elements
+	if len(args) == 1 {
+		if array, ok := args[0].(bson.A); ok {
+			args = array
+		}
+	}
+
+	// accumulate values
+	acc := Accumulators[op]()
+	for _, value := range args {
+		err = acc.Add(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return acc.Result(), nil
+}
+
+type sumAccumulator struct {
+	sum  interface{}
+	wide bool
+}
+
+func (a *sumAccumulator) Add(value interface{}) error {
+	// ignore non-numbers
+	if !isNumber(value) {
+		return nil
+	}
+
+	// widen int32 values so that sums exceeding the int32 range are kept as
+	// int64, the result is narrowed again if no int64 value has been added
+	if n, ok := value.(int32); ok {
+		value = int64(n)
+	} else if _, ok := value.(int64); ok {
+		a.wide = true
+	}
+
+	// add value
+	if a.sum == nil {
+		a.sum = value
+	} else if x, y, ok := int64Pair(a.sum, value); ok && (x+y > x) != (y > 0) {
+		// switch to double on int64 overflows
+		a.sum = float64(x) + float64(y)
+	} else {
+		a.sum = bsonkit.Add(a.sum, value)
+	}
+
+	return nil
+}
+
+func (a *sumAccumulator) Result() interface{} {
+	// handle empty sum
+	if a.sum == nil {
+		return int32(0)
+	}
+
+	// narrow integers that fit
+	if n, ok := a.sum.(int64); ok && !a.wide && n >= math.MinInt32 && n <= math.MaxInt32 {
+		return int32(n)
+	}
+
+	return a.sum
+}
+
+func int64Pair(a, b interface{}) (int64, int64, bool) {
+	x, ok1 := a.(int64)
+	y, ok2 := b.(int64)
+	return x, y, ok1 && ok2
+}
+
+type avgAccumulator struct {
+	sum   sumAccumulator
+	count int64
+}
+
+func (a *avgAccumulator) Add(value interface{}) error {
+	// ignore non-numbers
+	if !isNumber(value) {
+		return nil
+	}
+
+	// add value
+	a.count++
+
+	return a.sum.Add(value)
+}
+
+func (a *avgAccumulator) Result() interface{} {
+	// handle empty average
+	if a.count == 0 {
+		return nil
+	}
+
+	return bsonkit.Div(a.sum.sum, a.count)
+}
+
+type extremeAccumulator struct {
+	min   bool
+	value interface{}
+}
+
+func (a *extremeAccumulator) Add(value interface{}) error {
+	// ignore null and missing values
+	if isNullish(value) {
+		return nil
+	}
+
+	// set first value
+	if a.value == nil {
+		a.value = value
+		return nil
+	}
+
+	// compare values
+	res := bsonkit.Compare(value, a.value)
+	if (a.min && res < 0) || (!a.min && res > 0) {
+		a.value = value
+	}
+
+	return nil
+}
+
+func (a *extremeAccumulator) Result() interface{} {
+	return a.value
+}
+
+type pushAccumulator struct {
+	values bson.A
+}
+
+func (a *pushAccumulator) Add(value interface{}) error {
+	// ignore missing values
+	if value != bsonkit.Missing {
+		a.values = append(a.values, value)
+	}
+
+	return nil
+}
+
+func (a *pushAccumulator) Result() interface{} {
+	if a.values == nil {
+		return bson.A{}
+	}
+	return a.values
+}
+
+type addToSetAccumulator struct {
+	pushAccumulator
+}
+
+func (a *addToSetAccumulator) Add(value interface{}) error {
+	// ignore missing values
+	if value == bsonkit.Missing {
+		return nil
+	}
+
+	// ignore existing values
+	for _, item := range a.values {
+		if bsonkit.Compare(item, value) == 0 {
+			return nil
+		}
+	}
+
+	// add value
+	a.values = append(a.values, value)
+
+	return nil
+}
+
+type firstAccumulator struct {
+	value interface{}
+	done  bool
+}
+
+func (a *firstAccumulator) Add(value interface{}) error {
+	// keep first value
+	if !a.done {
+		a.value = value
+		a.done = true
+	}
+
+	return nil
+}
+
+func (a *firstAccumulator) Result() interface{} {
+	if a.value == bsonkit.Missing {
+		return nil
+	}
+	return a.value
+}
+
+type lastAccumulator struct {
+	value interface{}
+}
+
+func (a *lastAccumulator) Add(value interface{}) error {
+	// keep last value
+	a.value = value
+
+	return nil
+}
+
+func (a *lastAccumulator) Result() interface{} {
+	if a.value == bsonkit.Missing {
+		return nil
+	}
+	return a.value
+}
+
+type stdDevAccumulator struct {
+	sample bool
+	count  float64
+	mean   float64
+	m2     float64
+}
+
+func (a *stdDevAccumulator) Add(value interface{}) error {
+	// get number
+	var num float64
+	switch value := value.(type) {
+	case int32:
+		num = float64(value)
+	case int64:
+		num = float64(value)
+	case float64:
+		num = value
+	case primitive.Decimal128:
+		n, err := strconv.ParseFloat(value.String(), 64)
+		if err != nil {
+			return nil
+		}
+		num = n
+	default:
+		return nil
+	}
+
+	// update statistics (Welford)
+	a.count++
+	delta := num - a.mean
+	a.mean += delta / a.count
+	a.m2 += delta * (num - a.mean)
+
+	return nil
+}
+
+func (a *stdDevAccumulator) Result() interface{} {
+	// get divisor
+	divisor := a.count
+	if a.sample {
+		divisor--
+	}
+
+	// check divisor
+	if divisor <= 0 {
+		return nil
+	}
+
+	return math.Sqrt(a.m2 / divisor)
+}
+
+type mergeObjectsAccumulator struct {
+	doc bson.D
+}
+
+func (a *mergeObjectsAccumulator) Add(value interface{}) error {
+	// ignore null and missing values
+	if isNullish(value) {
+		return nil
+	}
+
+	// check document
+	doc, ok := value.(bson.D)
+	if !ok {
+		return fmt.Errorf("$mergeObjects requires object inputs, but input is of type %s", typeName(value))
+	}
+
+	// merge fields
+	for _, field := range doc {
+		found := false
+		for i := range a.doc {
+			if a.doc[i].Key == field.Key {
+				a.doc[i].Value = field.Value
+				found = true
+				break
+			}
+		}
+		if !found {
+			a.doc = append(a.doc, field)
+		}
+	}
+
+	return nil
+}
+
+func (a *mergeObjectsAccumulator) Result() interface{} {
+	if a.doc == nil {
+		return bson.D{}
+	}
+	return a.doc
+}
+
+type countAccumulator struct {
+	count int32
+}
+
+func (a *countAccumulator) Add(interface{}) error {
+	a.count++
+	return nil
+}
+
+func (a *countAccumulator) Result() interface{} {
+	return a.count
+}
@@ -0,0 +1,150 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestGroup(t *testing.T) {
+	list := bsonkit.List{
+		{{Key: "a", Value: int32(2)}, {Key: "b", Value: int32(1)}},
+		{{Key: "a", Value: int64(2)}, {Key: "b", Value: 1.5}},
+		{{Key: "a", Value: int32(1)}, {Key: "b", Value: "x"}},
+		{{Key: "b", Value: int32(4)}},
+	}
+
+	// group by number
+	res, err := Group(list, &bson.D{
+		{Key: "_id", Value: "$a"},
+		{Key: "sum", Value: bson.D{{Key: "$sum", Value: "$b"}}},
+		{Key: "set", Value: bson.D{{Key: "$addToSet", Value: "$a"}}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{
+		{{Key: "_id", Value: int32(2)}, {Key: "sum", Value: 2.5}, {Key: "set", Value: bson.A{int32(2)}}},
+		{{Key: "_id", Value: int32(1)}, {Key: "sum", Value: int32(0)}, {Key: "set", Value: bson.A{int32(1)}}},
+		{{Key: "_id", Value: nil}, {Key: "sum", Value: int32(4)}, {Key: "set", Value: bson.A{}}},
+	}, res)
+
+	// group by variable
+	res, err = Group(list, &bson.D{
+		{Key: "_id", Value: "$$key"},
+		{Key: "n", Value: bson.D{{Key: "$count", Value: bson.D{}}}},
+		{Key: "dev", Value: bson.D{{Key: "$stdDevSamp", Value: "$a"}}},
+	}, map[string]interface{}{
+		"key": "all",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{
+		{{Key: "_id", Value: "all"}, {Key: "n", Value: int32(4)}, {Key: "dev", Value: 0.5773502691896258}},
+	}, res)
+
+	// invalid accumulator
+	res, err = Group(list, &bson.D{
+		{Key: "_id", Value: nil},
+		{Key: "n", Value: int32(1)},
+	}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, `the field "n" must be an accumulator object`, err.Error())
+	assert.Nil(t, res)
+}
+
+func TestGroupFunctionAccumulator(t *testing.T) {
+	list := bsonkit.List{
+		{{Key: "a", Value: "x"}, {Key: "b", Value: int32(1)}},
+		{{Key: "a", Value: "y"}, {Key: "b", Value: int32(2)}},
+		{{Key: "a", Value: "x"}, {Key: "b", Value: int32(3)}},
+	}
+
+	ctx := &AggregationContext{
+		Functions: map[string]FunctionAccumulator{
+			"sum": {
+				Init: func(args bson.A) (interface{}, error) {
+					return args[0], nil
+				},
+				Accumulate: func(state interface{}, args bson.A) (interface{}, error) {
+					return state.(int32) + args[0].(int32), nil
+				},
+				Finalize: func(state interface{}) (interface{}, error) {
+					return bson.D{{Key: "total", Value: state}}, nil
+				},
+			},
+		},
+	}
+
+	// accumulate
+	res, err := Aggregate(ctx, list, bsonkit.List{
+		&bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$a"},
+			{Key: "sum", Value: bson.D{{Key: "$accumulator", Value: bson.D{
+				{Key: "init", Value: "function(n) { return n }"},
+				{Key: "initArgs", Value: bson.A{int32(10)}},
+				{Key: "accumulate", Value: "sum"},
+				{Key: "accumulateArgs", Value: bson.A{"$b"}},
+				{Key: "merge", Value: "function(a, b) { return a + b }"},
+				{Key: "lang", Value: "js"},
+			}}}},
+		}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{
+		{{Key: "_id", Value: "x"}, {Key: "sum", Value: bson.D{{Key: "total", Value: int32(14)}}}},
+		{{Key: "_id", Value: "y"}, {Key: "sum", Value: bson.D{{Key: "total", Value: int32(12)}}}},
+	}, res)
+
+	// unknown function
+	res, err = Aggregate(ctx, list, bsonkit.List{
+		&bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "sum", Value: bson.D{{Key: "$accumulator", Value: bson.D{
+				{Key: "accumulate", Value: "avg"},
+				{Key: "accumulateArgs", Value: bson.A{"$b"}},
+			}}}},
+		}}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `$accumulator: no function accumulator registered for "avg"`, err.Error())
+	assert.Nil(t, res)
+
+	// invalid arguments
+	res, err = Aggregate(ctx, list, bsonkit.List{
+		&bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "sum", Value: bson.D{{Key: "$accumulator", Value: bson.D{
+				{Key: "initArgs", Value: bson.A{int32(0)}},
+				{Key: "accumulate", Value: "sum"},
+				{Key: "accumulateArgs", Value: "$b"},
+			}}}},
+		}}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "$accumulator requires accumulateArgs to be an array, found: int", err.Error())
+	assert.Nil(t, res)
+
+	// unsupported language
+	_, err = Aggregate(ctx, list, bsonkit.List{
+		&bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "sum", Value: bson.D{{Key: "$accumulator", Value: bson.D{
+				{Key: "accumulate", Value: "sum"},
+				{Key: "accumulateArgs", Value: bson.A{"$b"}},
+				{Key: "lang", Value: "lua"},
+			}}}},
+		}}},
+	})
+	assert.Error(t, err)
+
+	// not available without context
+	_, err = Group(list, &bson.D{
+		{Key: "_id", Value: nil},
+		{Key: "sum", Value: bson.D{{Key: "$accumulator", Value: bson.D{
+			{Key: "accumulate", Value: "sum"},
+			{Key: "accumulateArgs", Value: bson.A{"$b"}},
+		}}}},
+	}, nil)
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package mongokit
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +14,17 @@ import (
 
 // TODO: Allow-list supported query operators?
 
+// MaxIndexNameLength is the maximum length of an index name in bytes.
+const MaxIndexNameLength = 127
+
+var indexPlugins = map[string]bool{
+	"2d":          true,
+	"2dsphere":    true,
+	"geoHaystack": true,
+	"hashed":      true,
+	"text":        true,
+}
+
 // IndexConfig defines an index configuration.
 type IndexConfig struct {
 	// The index key.
@@ -21,11 +33,18 @@ type IndexConfig struct {
 	// Whether the index is unique.
 	Unique bool
 
+	// Whether the index is sparse.
+	Sparse bool
+
 	// The partial index filter.
 	Partial bsonkit.Doc
 
 	// The time after documents expire.
 	Expiry time.Duration
+
+	// The index collation. Only case-insensitive collations are applied, see
+	// CaseInsensitive for details. Other collations are stored but not applied.
+	Collation bsonkit.Doc
 }
 
 // Equal will compare to configurations and return whether they are equal.
@@ -35,8 +54,8 @@ func (c IndexConfig) Equal(d IndexConfig) bool {
 		return false
 	}
 
-	// check unique
-	if c.Unique != d.Unique {
+	// check unique and sparse
+	if c.Unique != d.Unique || c.Sparse != d.Sparse {
 		return false
 	}
 
@@ -57,6 +76,18 @@ func (c IndexConfig) Equal(d IndexConfig) bool {
 		return false
 	}
 
+	// check collations
+	var c1, c2 bson.D
+	if c.Collation != nil {
+		c1 = *c.Collation
+	}
+	if d.Collation != nil {
+		c2 = *d.Collation
+	}
+	if bsonkit.Compare(c1, c2) != 0 {
+		return false
+	}
+
 	return true
 }
 
@@ -84,25 +115,84 @@ func (c IndexConfig) Name() (string, error) {
 	return name, nil
 }
 
+// ValidateIndexKey will validate the provided index key pattern. Only
+// ascending and descending fields are supported, special index types are
+// recognized but rejected.
+func ValidateIndexKey(key bsonkit.Doc) error {
+	// check length
+	if key == nil || len(*key) == 0 {
+		return fmt.Errorf("index keys cannot be empty")
+	}
+
+	// check fields
+	var plugin string
+	for _, field := range *key {
+		// check name
+		if field.Key == "" {
+			return fmt.Errorf("index keys cannot be an empty field")
+		} else if strings.HasPrefix(field.Key, "$") {
+			return fmt.Errorf("index key contains an illegal field name: field name starts with '$'")
+		}
+		for _, segment := range strings.Split(field.Key, ".") {
+			if segment == "" {
+				return fmt.Errorf("index keys cannot contain an empty field name: %q", field.Key)
+			}
+		}
+
+		// check value
+		switch value := field.Value.(type) {
+		case int32, int64, float64:
+			// check direction
+			direction, _ := toFloat64(value)
+			if direction == 0 || math.IsNaN(direction) {
+				return fmt.Errorf("values in the index key pattern can't be 0")
+			} else if direction != 1 && direction != -1 {
+				return fmt.Errorf("index key %q: expected 1 or -1 as direction", field.Key)
+			}
+		case string:
+			// check plugin
+			if !indexPlugins[value] {
+				return fmt.Errorf("unknown index plugin %q", value)
+			} else if plugin != "" && plugin != value {
+				return fmt.Errorf("can't use more than one index plugin for a single index")
+			}
+			plugin = value
+		default:
+			return fmt.Errorf("values in v:2 index key pattern cannot be of type %s, only numbers > 0, numbers < 0, and strings are allowed", typeName(value))
+		}
+	}
+
+	// check plugin
+	if plugin != "" {
+		return fmt.Errorf("index plugin %q is not supported", plugin)
+	}
+
+	return nil
+}
+
 // Index is an index for documents that supports MongoDB features. The index is
 // not safe from concurrent access and does not roll back changes on errors.
 // Therefore, the recommended approach is to clone the index before making changes.
 type Index struct {
 	config  IndexConfig
 	columns []bsonkit.Column
+	fold    bool
+	arrays  int
 	base    *bsonkit.Index
 }
 
 // CreateIndex will create and return a new index.
 func CreateIndex(config IndexConfig) (*Index, error) {
-	// check key
-	if len(*config.Key) == 0 {
-		return nil, fmt.Errorf("empty index key")
+	// validate key
+	err := ValidateIndexKey(config.Key)
+	if err != nil {
+		return nil, err
 	}
 
-	// clone key and partial
+	// clone key, partial and collation
 	config.Key = bsonkit.Clone(config.Key)
 	config.Partial = bsonkit.Clone(config.Partial)
+	config.Collation = bsonkit.Clone(config.Collation)
 
 	// parse columns
 	columns, err := Columns(config.Key)
@@ -115,10 +205,18 @@ func CreateIndex(config IndexConfig) (*Index, error) {
 		return nil, fmt.Errorf("invalid expiring compound index")
 	}
 
+	// apply collation
+	fold, err := CaseInsensitive(config.Collation)
+	if err != nil {
+		return nil, err
+	}
+	columns = foldColumns(columns, fold)
+
 	// create index
 	index := &Index{
 		config:  config,
 		columns: columns,
+		fold:    fold,
 		base:    bsonkit.NewIndex(config.Unique, columns),
 	}
 
@@ -145,29 +243,35 @@ func (i *Index) Build(list bsonkit.List) (bool, error) {
 // already been added to the index. If the document has been skipped due to a
 // partial filter true is returned.
 func (i *Index) Add(doc bsonkit.Doc) (bool, error) {
-	// skip documents that do not match partial expression
-	if i.config.Partial != nil {
-		ok, err := Match(doc, i.config.Partial)
-		if err != nil {
-			return false, err
-		} else if !ok {
-			return true, nil
-		}
+	// skip documents that are not indexed
+	ok, err := i.indexed(doc)
+	if err != nil {
+		return false, err
+	} else if !ok {
+		return true, nil
+	}
+
+	// add document
+	if !i.base.Add(doc) {
+		return false, nil
+	}
+
+	// count arrays
+	if i.hasArray(doc) {
+		i.arrays++
 	}
 
-	return i.base.Add(doc), nil
+	return true, nil
 }
 
 // Has returns whether the specified document has been added to the index.
 func (i *Index) Has(doc bsonkit.Doc) (bool, error) {
-	// skip documents that do not match partial expression
-	if i.config.Partial != nil {
-		ok, err := Match(doc, i.config.Partial)
-		if err != nil {
-			return false, err
-		} else if !ok {
-			return false, nil
-		}
+	// skip documents that are not indexed
+	ok, err := i.indexed(doc)
+	if err != nil {
+		return false, err
+	} else if !ok {
+		return false, nil
 	}
 
 	return i.base.Has(doc), nil
@@ -176,17 +280,58 @@ func (i *Index) Has(doc bsonkit.Doc) (bool, error) {
 // Remove will remove a document from the index. May return false if the document
 // has not yet been added to the index.
 func (i *Index) Remove(doc bsonkit.Doc) (bool, error) {
+	// skip documents that are not indexed
+	ok, err := i.indexed(doc)
+	if err != nil {
+		return false, err
+	} else if !ok {
+		return true, nil
+	}
+
+	// remove document
+	if !i.base.Remove(doc) {
+		return false, nil
+	}
+
+	// count arrays
+	if i.hasArray(doc) {
+		i.arrays--
+	}
+
+	return true, nil
+}
+
+func (i *Index) indexed(doc bsonkit.Doc) (bool, error) {
 	// skip documents that do not match partial expression
 	if i.config.Partial != nil {
 		ok, err := Match(doc, i.config.Partial)
-		if err != nil {
+		if err != nil || !ok {
 			return false, err
-		} else if !ok {
-			return true, nil
 		}
 	}
 
-	return i.base.Remove(doc), nil
+	// skip documents that miss all fields of sparse index
+	if i.config.Sparse {
+		for _, column := range i.columns {
+			if bsonkit.Get(doc, column.Path) != bsonkit.Missing {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (i *Index) hasArray(doc bsonkit.Doc) bool {
+	// check column values
+	for _, column := range i.columns {
+		if _, ok := bsonkit.Get(doc, column.Path).(bson.A); ok {
+			return true
+		}
+	}
+
+	return false
 }
 
 // List will return an ascending list of all documents in the index.
@@ -194,22 +339,74 @@ func (i *Index) List() bsonkit.List {
 	return i.base.List()
 }
 
+// Columns will return the columns of the index key.
+func (i *Index) Columns() []bsonkit.Column {
+	return append([]bsonkit.Column(nil), i.columns...)
+}
+
+// Ascend will call the function with the indexed documents in index order
+// within the optional inclusive bounds. See bsonkit.Index.Ascend for details.
+func (i *Index) Ascend(lower, upper bsonkit.Doc, fn func(bsonkit.Doc) bool) {
+	i.base.Ascend(lower, upper, fn)
+}
+
+// Descend will call the function with the indexed documents in reverse index
+// order within the optional inclusive bounds. See bsonkit.Index.Descend for
+// details.
+func (i *Index) Descend(lower, upper bsonkit.Doc, fn func(bsonkit.Doc) bool) {
+	i.base.Descend(lower, upper, fn)
+}
+
+// Len will return the number of indexed documents.
+func (i *Index) Len() int {
+	return i.base.Len()
+}
+
+// Memory will return the approximate number of bytes used by the index
+// excluding the indexed documents.
+func (i *Index) Memory() int {
+	return i.base.Memory()
+}
+
 // Config will return the index configuration.
 func (i *Index) Config() IndexConfig {
 	return IndexConfig{
-		Key:     bsonkit.Clone(i.config.Key),
-		Unique:  i.config.Unique,
-		Partial: bsonkit.Clone(i.config.Partial),
-		Expiry:  i.config.Expiry,
+		Key:       bsonkit.Clone(i.config.Key),
+		Unique:    i.config.Unique,
+		Sparse:    i.config.Sparse,
+		Partial:   bsonkit.Clone(i.config.Partial),
+		Expiry:    i.config.Expiry,
+		Collation: bsonkit.Clone(i.config.Collation),
 	}
 }
 
+func (i *Index) empty() *Index {
+	return &Index{
+		config:  i.config,
+		columns: i.columns,
+		fold:    i.fold,
+		base:    bsonkit.NewIndex(i.config.Unique, i.columns),
+	}
+}
+
+func (i *Index) merge(batch *Index) {
+	// add documents in index order
+	for _, doc := range batch.base.List() {
+		i.base.Add(doc)
+	}
+
+	// count arrays
+	i.arrays += batch.arrays
+}
+
 // Clone will clone the index. Mutating the new index will not mutate the
 // original index.
 func (i *Index) Clone() *Index {
 	return &Index{
 		config:  i.config,
 		columns: i.columns,
+		fold:    i.fold,
+		arrays:  i.arrays,
 		base:    i.base.Clone(),
 	}
 }
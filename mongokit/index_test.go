@@ -73,6 +73,69 @@ func TestIndex(t *testing.T) {
 	assert.False(t, mustHas(index.Has(d2)))
 }
 
+func TestValidateIndexKey(t *testing.T) {
+	table := []struct {
+		key bson.D
+		err string
+	}{
+		{
+			key: bson.D{{Key: "a", Value: int32(1)}, {Key: "b.c", Value: -1.0}},
+		},
+		{
+			key: bson.D{},
+			err: "index keys cannot be empty",
+		},
+		{
+			key: bson.D{{Key: "", Value: int32(1)}},
+			err: "index keys cannot be an empty field",
+		},
+		{
+			key: bson.D{{Key: "$a", Value: int32(1)}},
+			err: "index key contains an illegal field name: field name starts with '$'",
+		},
+		{
+			key: bson.D{{Key: "a..b", Value: int32(1)}},
+			err: `index keys cannot contain an empty field name: "a..b"`,
+		},
+		{
+			key: bson.D{{Key: "a", Value: int64(0)}},
+			err: "values in the index key pattern can't be 0",
+		},
+		{
+			key: bson.D{{Key: "a", Value: int32(2)}},
+			err: `index key "a": expected 1 or -1 as direction`,
+		},
+		{
+			key: bson.D{{Key: "a", Value: true}},
+			err: "values in v:2 index key pattern cannot be of type bool, only numbers > 0, numbers < 0, and strings are allowed",
+		},
+		{
+			key: bson.D{{Key: "a", Value: "foo"}},
+			err: `unknown index plugin "foo"`,
+		},
+		{
+			key: bson.D{{Key: "a", Value: "text"}, {Key: "b", Value: "2dsphere"}},
+			err: "can't use more than one index plugin for a single index",
+		},
+		{
+			key: bson.D{{Key: "a", Value: "text"}, {Key: "b", Value: "text"}},
+			err: `index plugin "text" is not supported`,
+		},
+	}
+
+	for _, item := range table {
+		err := ValidateIndexKey(&item.key)
+		if item.err == "" {
+			assert.NoError(t, err, item.key)
+		} else {
+			assert.Error(t, err, item.key)
+			if err != nil {
+				assert.Equal(t, item.err, err.Error(), item.key)
+			}
+		}
+	}
+}
+
 func TestIndexCompound(t *testing.T) {
 	d1 := bsonkit.MustConvert(bson.M{"a": "1", "b": true})
 	d2 := bsonkit.MustConvert(bson.M{"a": "1", "b": false})
@@ -183,6 +246,74 @@ func TestIndexUnique(t *testing.T) {
 	assert.False(t, mustHas(index.Has(d3)))
 }
 
+func TestIndexCollation(t *testing.T) {
+	d1 := bsonkit.MustConvert(bson.M{"a": "Alice"})
+	d2 := bsonkit.MustConvert(bson.M{"a": "alice"})
+	d3 := bsonkit.MustConvert(bson.M{"a": "Bob"})
+
+	// invalid collation
+	_, err := CreateIndex(IndexConfig{
+		Key: bsonkit.MustConvert(bson.M{
+			"a": int32(1),
+		}),
+		Collation: bsonkit.MustConvert(bson.M{
+			"locale":   "en",
+			"strength": int32(0),
+		}),
+	})
+	assert.Error(t, err)
+
+	// case-sensitive collation
+	index, err := CreateIndex(IndexConfig{
+		Key: bsonkit.MustConvert(bson.M{
+			"a": int32(1),
+		}),
+		Unique: true,
+		Collation: bsonkit.MustConvert(bson.M{
+			"locale":   "en",
+			"strength": int32(3),
+		}),
+	})
+	assert.NoError(t, err)
+
+	ok, err := index.Build(bsonkit.List{d1, d2, d3})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, bsonkit.List{d1, d3, d2}, index.List())
+
+	// case-insensitive collation
+	index, err = CreateIndex(IndexConfig{
+		Key: bsonkit.MustConvert(bson.M{
+			"a": int32(1),
+		}),
+		Unique: true,
+		Collation: bsonkit.MustConvert(bson.M{
+			"locale":   "en",
+			"strength": int32(2),
+		}),
+	})
+	assert.NoError(t, err)
+
+	ok, err = index.Build(bsonkit.List{d3, d1})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, bsonkit.List{d1, d3}, index.List())
+	assert.True(t, mustHas(index.Has(d2)))
+
+	ok, err = index.Add(d2)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// lookup
+	var list bsonkit.List
+	key := bsonkit.MustConvert(bson.M{"a": "ALICE"})
+	index.Ascend(key, key, func(doc bsonkit.Doc) bool {
+		list = append(list, doc)
+		return true
+	})
+	assert.Equal(t, bsonkit.List{d1}, list)
+}
+
 func TestIndexCompoundUnique(t *testing.T) {
 	d1 := bsonkit.MustConvert(bson.M{"a": "1", "b": true})
 	d2 := bsonkit.MustConvert(bson.M{"a": "2", "b": true})
@@ -336,3 +467,75 @@ func TestIndexPartial(t *testing.T) {
 	assert.False(t, mustHas(index.Has(d1)))
 	assert.False(t, mustHas(index.Has(d2)))
 }
+
+func TestIndexSparse(t *testing.T) {
+	d1 := bsonkit.MustConvert(bson.M{"b": "1"})
+	d2 := bsonkit.MustConvert(bson.M{"b": "2"})
+	d3 := bsonkit.MustConvert(bson.M{"a": nil})
+	d4 := bsonkit.MustConvert(bson.M{"a": nil})
+
+	index, err := CreateIndex(IndexConfig{
+		Key: bsonkit.MustConvert(bson.M{
+			"a": int32(1),
+		}),
+		Unique: true,
+		Sparse: true,
+	})
+	assert.NoError(t, err)
+
+	ok, err := index.Add(d1)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, mustHas(index.Has(d1)))
+
+	ok, err = index.Add(d2)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, mustHas(index.Has(d2)))
+
+	ok, err = index.Add(d3)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, mustHas(index.Has(d3)))
+
+	ok, err = index.Add(d4)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = index.Remove(d1)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, bsonkit.List{d3}, index.List())
+}
+
+func TestIndexAscendDescend(t *testing.T) {
+	d1 := bsonkit.MustConvert(bson.M{"a": 1})
+	d2 := bsonkit.MustConvert(bson.M{"a": 2})
+	d3 := bsonkit.MustConvert(bson.M{"a": 3})
+
+	index, err := CreateIndex(IndexConfig{
+		Key: bsonkit.MustConvert(bson.M{
+			"a": int32(-1),
+		}),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bsonkit.Column{{Path: "a", Reverse: true}}, index.Columns())
+
+	ok, err := index.Build(bsonkit.List{d2, d3, d1})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	var list bsonkit.List
+	index.Ascend(nil, bsonkit.MustConvert(bson.M{"a": 2}), func(doc bsonkit.Doc) bool {
+		list = append(list, doc)
+		return true
+	})
+	assert.Equal(t, bsonkit.List{d3, d2}, list)
+
+	list = nil
+	index.Descend(nil, nil, func(doc bsonkit.Doc) bool {
+		list = append(list, doc)
+		return true
+	})
+	assert.Equal(t, bsonkit.List{d1, d2, d3}, list)
+}
@@ -26,6 +26,8 @@ func init() {
 	TopLevelQueryOperators["$or"] = matchOr
 	TopLevelQueryOperators["$nor"] = matchNor
 	TopLevelQueryOperators["$jsonSchema"] = matchJSONSchema
+	TopLevelQueryOperators["$expr"] = matchExpr
+	TopLevelQueryOperators["$comment"] = matchComment
 
 	// register expression query operators
 	ExpressionQueryOperators[""] = matchComp
@@ -48,10 +50,22 @@ func init() {
 // Match will test if the specified document matches the supplied MongoDB query
 // document.
 func Match(doc, query bsonkit.Doc) (bool, error) {
+	return match(doc, query, false)
+}
+
+// MatchFold is like Match but compares strings case-insensitively in the
+// comparison, $in, $nin and $all operators, as done by case-insensitive
+// collations.
+func MatchFold(doc, query bsonkit.Doc) (bool, error) {
+	return match(doc, query, true)
+}
+
+func match(doc, query bsonkit.Doc, fold bool) (bool, error) {
 	// match document to query
 	err := Process(Context{
 		TopLevel:   TopLevelQueryOperators,
 		Expression: ExpressionQueryOperators,
+		Fold:       fold,
 	}, doc, *query, "", true)
 	if err == ErrNotMatched {
 		return false, nil
@@ -132,7 +146,7 @@ func matchNor(ctx Context, doc bsonkit.Doc, name, path string, v interface{}) er
 	})
 }
 
-func matchComp(_ Context, doc bsonkit.Doc, op, path string, v interface{}) error {
+func matchComp(ctx Context, doc bsonkit.Doc, op, path string, v interface{}) error {
 	return matchUnwind(doc, path, true, false, func(field interface{}) error {
 		// determine if comparable (type bracketing)
 		lc, _ := bsonkit.Inspect(field)
@@ -140,7 +154,7 @@ func matchComp(_ Context, doc bsonkit.Doc, op, path string, v interface{}) error
 		comp := lc == rc
 
 		// compare field with value
-		res := bsonkit.Compare(field, v)
+		res := compareValues(ctx, field, v)
 
 		// check operator
 		var ok bool
@@ -195,7 +209,7 @@ func matchNot(ctx Context, doc bsonkit.Doc, name, path string, v interface{}) er
 	return ErrNotMatched
 }
 
-func matchIn(_ Context, doc bsonkit.Doc, name, path string, v interface{}) error {
+func matchIn(ctx Context, doc bsonkit.Doc, name, path string, v interface{}) error {
 	return matchUnwind(doc, path, true, false, func(field interface{}) error {
 		// get array
 		array, ok := v.(bson.A)
@@ -205,7 +219,7 @@ func matchIn(_ Context, doc bsonkit.Doc, name, path string, v interface{}) error
 
 		// check if field is in array
 		for _, item := range array {
-			if bsonkit.Compare(field, item) == 0 {
+			if compareValues(ctx, field, item) == 0 {
 				return nil
 			}
 		}
@@ -321,7 +335,27 @@ func matchJSONSchema(_ Context, doc bsonkit.Doc, name, _ string, v interface{})
 	return nil
 }
 
-func matchAll(_ Context, doc bsonkit.Doc, name, path string, v interface{}) error {
+func matchExpr(_ Context, doc bsonkit.Doc, _, _ string, v interface{}) error {
+	// evaluate expression
+	res, err := Evaluate(doc, v, nil)
+	if err != nil {
+		return err
+	}
+
+	// check result
+	if !truthy(res) {
+		return ErrNotMatched
+	}
+
+	return nil
+}
+
+func matchComment(_ Context, _ bsonkit.Doc, _, _ string, _ interface{}) error {
+	// comments are only used for tracing and always match
+	return nil
+}
+
+func matchAll(ctx Context, doc bsonkit.Doc, name, path string, v interface{}) error {
 	return matchUnwind(doc, path, false, true, func(field interface{}) error {
 		// get array
 		array, ok := v.(bson.A)
@@ -340,7 +374,7 @@ func matchAll(_ Context, doc bsonkit.Doc, name, path string, v interface{}) erro
 			for _, value := range array {
 				ok := false
 				for _, element := range arr {
-					if bsonkit.Compare(value, element) == 0 {
+					if compareValues(ctx, value, element) == 0 {
 						ok = true
 					}
 				}
@@ -355,7 +389,7 @@ func matchAll(_ Context, doc bsonkit.Doc, name, path string, v interface{}) erro
 
 		// check if field is in array
 		for _, item := range array {
-			if bsonkit.Compare(field, item) != 0 {
+			if compareValues(ctx, field, item) != 0 {
 				return ErrNotMatched
 			}
 		}
@@ -428,6 +462,15 @@ func matchElem(ctx Context, doc bsonkit.Doc, name, path string, v interface{}) e
 	return ErrNotMatched
 }
 
+func compareValues(ctx Context, a, b interface{}) int {
+	// compare case-insensitively if requested
+	if ctx.Fold {
+		return bsonkit.CompareFold(a, b)
+	}
+
+	return bsonkit.Compare(a, b)
+}
+
 func matchUnwind(doc bsonkit.Doc, path string, merge, yieldMerge bool, op func(interface{}) error) error {
 	// get value
 	value, multi := bsonkit.All(doc, path, true, merge)
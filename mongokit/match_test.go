@@ -979,6 +979,65 @@ func TestMatchJSONSchema(t *testing.T) {
 	})
 }
 
+func TestMatchExpr(t *testing.T) {
+	matchTest(t, bson.M{
+		"a": int32(5),
+		"b": int32(3),
+	}, func(fn func(bson.M, interface{})) {
+		// comparison
+		fn(bson.M{
+			"$expr": bson.M{"$gt": bson.A{"$a", "$b"}},
+		}, true)
+		fn(bson.M{
+			"$expr": bson.M{"$lt": bson.A{"$a", "$b"}},
+		}, false)
+
+		// truthy values
+		fn(bson.M{
+			"$expr": bson.M{"$subtract": bson.A{"$a", "$b"}},
+		}, true)
+		fn(bson.M{
+			"$expr": "$c",
+		}, false)
+
+		// combined
+		fn(bson.M{
+			"$and": bson.A{
+				bson.M{"a": int32(5)},
+				bson.M{"$expr": bson.M{"$eq": bson.A{bson.M{"$add": bson.A{"$b", int32(2)}}, "$a"}}},
+			},
+		}, true)
+
+		// invalid expression
+		fn(bson.M{
+			"$expr": bson.M{"$foo": int32(1)},
+		}, `unknown expression operator "$foo"`)
+
+		// undefined variable
+		fn(bson.M{
+			"$expr": "$$foo",
+		}, "use of undefined variable: foo")
+	})
+}
+
+func TestMatchComment(t *testing.T) {
+	matchTest(t, bson.M{
+		"a": "b",
+	}, func(fn func(bson.M, interface{})) {
+		fn(bson.M{
+			"$comment": "foo",
+		}, true)
+		fn(bson.M{
+			"a":        "b",
+			"$comment": bson.M{"caller": "foo"},
+		}, true)
+		fn(bson.M{
+			"a":        "c",
+			"$comment": "foo",
+		}, false)
+	})
+}
+
 func TestMatchAll(t *testing.T) {
 	matchTest(t, bson.M{
 		"foo": "bar",
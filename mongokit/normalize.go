@@ -0,0 +1,339 @@
+package mongokit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// ErrorCode classifies the errors returned by NormalizeQuery and
+// NormalizeUpdate.
+type ErrorCode int
+
+// The available error codes.
+const (
+	// InvalidDocument is returned if a document or operator value does not
+	// have the expected shape.
+	InvalidDocument ErrorCode = iota + 1
+
+	// UnknownOperator is returned for operators that are not registered.
+	UnknownOperator
+
+	// InvalidOperand is returned if an operator rejects its operand.
+	InvalidOperand
+
+	// ConflictingPaths is returned if an update modifies the same path or
+	// overlapping paths more than once.
+	ConflictingPaths
+)
+
+// String returns the name of the code.
+func (c ErrorCode) String() string {
+	switch c {
+	case InvalidDocument:
+		return "InvalidDocument"
+	case UnknownOperator:
+		return "UnknownOperator"
+	case InvalidOperand:
+		return "InvalidOperand"
+	case ConflictingPaths:
+		return "ConflictingPaths"
+	default:
+		return fmt.Sprintf("ErrorCode(%d)", int(c))
+	}
+}
+
+// NormalizeError is returned by NormalizeQuery and NormalizeUpdate.
+type NormalizeError struct {
+	// The error code.
+	Code ErrorCode
+
+	// The operator and path at which the error occurred, if available.
+	Operator string
+	Path     string
+
+	// The underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *NormalizeError) Error() string {
+	// prepare message
+	var parts []string
+	if e.Operator != "" {
+		parts = append(parts, e.Operator)
+	}
+	if e.Path != "" {
+		parts = append(parts, fmt.Sprintf("%q", e.Path))
+	}
+	parts = append(parts, e.Err.Error())
+
+	return e.Code.String() + ": " + strings.Join(parts, ": ")
+}
+
+// Unwrap returns the underlying error.
+func (e *NormalizeError) Unwrap() error {
+	return e.Err
+}
+
+// Node is a node of a normalized query or update document.
+type Node struct {
+	// The operator of the node e.g. "$and", "$eq" or "$set". The implicit
+	// conjunction of a query document uses "$and".
+	Operator string
+
+	// The path the operator is applied to, if any.
+	Path string
+
+	// The operand of leaf nodes.
+	Value interface{}
+
+	// The child nodes of logical operators, $not and $elemMatch and the
+	// operations of an update. The paths of $elemMatch children are relative
+	// to the array element.
+	Children []*Node
+}
+
+// NormalizeQuery will parse and validate the specified query document and
+// return its normalized form. The operators are looked up in the same
+// registries that are used by Match and each operand is validated by matching
+// the operator against an empty document. Operand errors that only occur for
+// specific field values are therefore not detected.
+func NormalizeQuery(query bsonkit.Doc) (*Node, error) {
+	// check document
+	if query == nil {
+		return nil, &NormalizeError{Code: InvalidDocument, Err: fmt.Errorf("missing document")}
+	}
+
+	return normalizeQuery(*query, "")
+}
+
+func normalizeQuery(query bson.D, prefix string) (*Node, error) {
+	// prepare conjunction
+	node := &Node{Operator: "$and", Path: prefix}
+
+	// normalize expressions
+	for _, exp := range query {
+		// handle top level operators
+		if strings.HasPrefix(exp.Key, "$") {
+			child, err := normalizeTopLevel(exp, prefix)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+			continue
+		}
+
+		// get path
+		path := exp.Key
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+
+		// normalize field conditions
+		children, err := normalizeConditions(path, exp.Value)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, children...)
+	}
+
+	return node, nil
+}
+
+func normalizeTopLevel(exp bson.E, prefix string) (*Node, error) {
+	// check operator
+	if TopLevelQueryOperators[exp.Key] == nil {
+		return nil, &NormalizeError{Code: UnknownOperator, Operator: exp.Key, Path: prefix, Err: fmt.Errorf("unknown top level operator")}
+	}
+
+	// handle logical operators
+	switch exp.Key {
+	case "$and", "$or", "$nor":
+		// get array
+		array, ok := exp.Value.(bson.A)
+		if !ok || len(array) == 0 {
+			return nil, &NormalizeError{Code: InvalidDocument, Operator: exp.Key, Path: prefix, Err: fmt.Errorf("expected non-empty array")}
+		}
+
+		// normalize queries
+		node := &Node{Operator: exp.Key, Path: prefix}
+		for _, item := range array {
+			query, ok := item.(bson.D)
+			if !ok {
+				return nil, &NormalizeError{Code: InvalidDocument, Operator: exp.Key, Path: prefix, Err: fmt.Errorf("expected array of documents")}
+			}
+			child, err := normalizeQuery(query, prefix)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+
+		return node, nil
+	}
+
+	// validate operand
+	err := validateQuery(exp.Key, prefix, bson.D{exp})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Node{Operator: exp.Key, Path: prefix, Value: exp.Value}, nil
+}
+
+func normalizeConditions(path string, value interface{}) ([]*Node, error) {
+	// handle simple conditions, documents are only treated as operator
+	// expressions if the first key looks like an operator
+	exps, ok := value.(bson.D)
+	if !ok || len(exps) == 0 || !strings.HasPrefix(exps[0].Key, "$") {
+		return []*Node{{Operator: "$eq", Path: path, Value: value}}, nil
+	}
+
+	// normalize operator expressions
+	nodes := make([]*Node, 0, len(exps))
+	for _, exp := range exps {
+		// check operator
+		if !strings.HasPrefix(exp.Key, "$") {
+			return nil, &NormalizeError{Code: InvalidDocument, Path: path, Err: fmt.Errorf("expected operator, got %q", exp.Key)}
+		} else if exp.Key == "" || ExpressionQueryOperators[exp.Key] == nil {
+			return nil, &NormalizeError{Code: UnknownOperator, Operator: exp.Key, Path: path, Err: fmt.Errorf("unknown expression operator")}
+		}
+
+		// handle nested operators
+		switch exp.Key {
+		case "$not":
+			// normalize negated conditions
+			doc, ok := exp.Value.(bson.D)
+			if !ok || len(doc) == 0 || !strings.HasPrefix(doc[0].Key, "$") {
+				return nil, &NormalizeError{Code: InvalidDocument, Operator: exp.Key, Path: path, Err: fmt.Errorf("expected operator document")}
+			}
+			children, err := normalizeConditions(path, doc)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, &Node{Operator: exp.Key, Path: path, Children: children})
+			continue
+		case "$elemMatch":
+			// normalize element conditions, operators apply to the element
+			// and fields to the fields of the element
+			doc, ok := exp.Value.(bson.D)
+			if !ok {
+				return nil, &NormalizeError{Code: InvalidDocument, Operator: exp.Key, Path: path, Err: fmt.Errorf("expected document")}
+			}
+			var children []*Node
+			for _, item := range doc {
+				var list []*Node
+				var err error
+				if strings.HasPrefix(item.Key, "$") {
+					list, err = normalizeConditions("", bson.D{item})
+				} else {
+					list, err = normalizeConditions(item.Key, item.Value)
+				}
+				if err != nil {
+					return nil, err
+				}
+				children = append(children, list...)
+			}
+			nodes = append(nodes, &Node{Operator: exp.Key, Path: path, Children: children})
+			continue
+		}
+
+		// validate operand
+		err := validateQuery(exp.Key, path, bson.D{{Key: path, Value: bson.D{exp}}})
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, &Node{Operator: exp.Key, Path: path, Value: exp.Value})
+	}
+
+	return nodes, nil
+}
+
+func validateQuery(op, path string, query bson.D) error {
+	// match empty document
+	_, err := Match(&bson.D{}, &query)
+	if err != nil {
+		return &NormalizeError{Code: InvalidOperand, Operator: op, Path: path, Err: err}
+	}
+
+	return nil
+}
+
+// NormalizeUpdate will parse and validate the specified update document and
+// return its normalized form. The returned node has an "update" operator and
+// a child for every modified path. The operators are looked up in the same
+// registry that is used by Apply and each operation is validated by applying
+// it to an empty document. Operations with positional paths are not applied.
+func NormalizeUpdate(update bsonkit.Doc) (*Node, error) {
+	// check document
+	if update == nil || len(*update) == 0 {
+		return nil, &NormalizeError{Code: InvalidDocument, Err: fmt.Errorf("empty update document")}
+	}
+
+	// prepare node
+	node := &Node{Operator: "update"}
+
+	// normalize operations
+	tree := map[string]string{}
+	for _, exp := range *update {
+		// check operator
+		if !strings.HasPrefix(exp.Key, "$") {
+			return nil, &NormalizeError{Code: InvalidDocument, Path: exp.Key, Err: fmt.Errorf("expected update operator")}
+		} else if FieldUpdateOperators[exp.Key] == nil {
+			return nil, &NormalizeError{Code: UnknownOperator, Operator: exp.Key, Err: fmt.Errorf("unknown update operator")}
+		}
+
+		// get fields
+		fields, ok := exp.Value.(bson.D)
+		if !ok {
+			return nil, &NormalizeError{Code: InvalidDocument, Operator: exp.Key, Err: fmt.Errorf("expected document")}
+		}
+
+		// normalize fields
+		for _, field := range fields {
+			// check path
+			if field.Key == "" || strings.HasPrefix(field.Key, ".") || strings.HasSuffix(field.Key, ".") || strings.Contains(field.Key, "..") {
+				return nil, &NormalizeError{Code: InvalidDocument, Operator: exp.Key, Path: field.Key, Err: fmt.Errorf("invalid path")}
+			}
+
+			// collect paths
+			paths := []string{field.Key}
+			if exp.Key == "$rename" {
+				target, ok := field.Value.(string)
+				if !ok || target == "" {
+					return nil, &NormalizeError{Code: InvalidOperand, Operator: exp.Key, Path: field.Key, Err: fmt.Errorf("expected non-empty string")}
+				}
+				paths = append(paths, target)
+			}
+
+			// check conflicts
+			for _, path := range paths {
+				for other, op := range tree {
+					if path == other || strings.HasPrefix(path, other+".") || strings.HasPrefix(other, path+".") {
+						return nil, &NormalizeError{Code: ConflictingPaths, Operator: exp.Key, Path: path, Err: fmt.Errorf("conflicts with %s %q", op, other)}
+					}
+				}
+				tree[path] = exp.Key
+			}
+
+			// validate operation
+			if !strings.Contains(field.Key, "$") {
+				_, err := Apply(&bson.D{}, nil, &bson.D{{Key: exp.Key, Value: bson.D{field}}}, true, nil)
+				if err != nil && !errors.Is(err, ErrNotMatched) {
+					return nil, &NormalizeError{Code: InvalidOperand, Operator: exp.Key, Path: field.Key, Err: err}
+				}
+			}
+
+			// add node
+			node.Children = append(node.Children, &Node{Operator: exp.Key, Path: field.Key, Value: field.Value})
+		}
+	}
+
+	return node, nil
+}
@@ -0,0 +1,153 @@
+package mongokit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func normalizeCode(err error) ErrorCode {
+	var ne *NormalizeError
+	if errors.As(err, &ne) {
+		return ne.Code
+	}
+	return 0
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	node, err := NormalizeQuery(bsonkit.MustConvert(bson.D{
+		{Key: "a", Value: 1},
+		{Key: "b", Value: bson.D{
+			{Key: "$gt", Value: 1},
+			{Key: "$not", Value: bson.D{{Key: "$in", Value: bson.A{5, 6}}}},
+		}},
+		{Key: "c", Value: bson.D{{Key: "d", Value: 2}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "e", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: "f", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+				{Key: "$gte", Value: 3},
+				{Key: "g", Value: 4},
+			}}}}},
+		}},
+		{Key: "$comment", Value: "foo"},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, &Node{
+		Operator: "$and",
+		Children: []*Node{
+			{Operator: "$eq", Path: "a", Value: int64(1)},
+			{Operator: "$gt", Path: "b", Value: int64(1)},
+			{Operator: "$not", Path: "b", Children: []*Node{
+				{Operator: "$in", Path: "b", Value: bson.A{int64(5), int64(6)}},
+			}},
+			{Operator: "$eq", Path: "c", Value: bson.D{{Key: "d", Value: int64(2)}}},
+			{Operator: "$or", Children: []*Node{
+				{Operator: "$and", Children: []*Node{
+					{Operator: "$exists", Path: "e", Value: true},
+				}},
+				{Operator: "$and", Children: []*Node{
+					{Operator: "$elemMatch", Path: "f", Children: []*Node{
+						{Operator: "$gte", Value: int64(3)},
+						{Operator: "$eq", Path: "g", Value: int64(4)},
+					}},
+				}},
+			}},
+			{Operator: "$comment", Value: "foo"},
+		},
+	}, node)
+
+	for _, item := range []struct {
+		query bson.D
+		code  ErrorCode
+	}{
+		{bson.D{{Key: "$foo", Value: 1}}, UnknownOperator},
+		{bson.D{{Key: "a", Value: bson.D{{Key: "$foo", Value: 1}}}}, UnknownOperator},
+		{bson.D{{Key: "a", Value: bson.D{{Key: "$gt", Value: 1}, {Key: "b", Value: 1}}}}, InvalidDocument},
+		{bson.D{{Key: "$and", Value: bson.A{}}}, InvalidDocument},
+		{bson.D{{Key: "$or", Value: bson.A{1}}}, InvalidDocument},
+		{bson.D{{Key: "a", Value: bson.D{{Key: "$not", Value: 1}}}}, InvalidDocument},
+		{bson.D{{Key: "a", Value: bson.D{{Key: "$in", Value: 1}}}}, InvalidOperand},
+		{bson.D{{Key: "a", Value: bson.D{{Key: "$size", Value: "foo"}}}}, InvalidOperand},
+		{bson.D{{Key: "a", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "$foo", Value: 1}}}}}}, UnknownOperator},
+		{bson.D{{Key: "$expr", Value: bson.D{{Key: "$foo", Value: 1}}}}, InvalidOperand},
+	} {
+		node, err = NormalizeQuery(bsonkit.MustConvert(item.query))
+		assert.Error(t, err, item.query)
+		assert.Nil(t, node)
+		assert.Equal(t, item.code, normalizeCode(err), item.query)
+	}
+
+	_, err = NormalizeQuery(bsonkit.MustConvert(bson.D{{Key: "a", Value: bson.D{{Key: "$in", Value: 1}}}}))
+	assert.Equal(t, `InvalidOperand: $in: "a": $in: expected array`, err.Error())
+}
+
+func TestNormalizeUpdate(t *testing.T) {
+	node, err := NormalizeUpdate(bsonkit.MustConvert(bson.D{
+		{Key: "$set", Value: bson.D{{Key: "a.b", Value: 1}, {Key: "c", Value: "d"}}},
+		{Key: "$inc", Value: bson.D{{Key: "e", Value: 2}}},
+		{Key: "$rename", Value: bson.D{{Key: "f", Value: "g"}}},
+		{Key: "$unset", Value: bson.D{{Key: "h.$[]", Value: ""}}},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, &Node{
+		Operator: "update",
+		Children: []*Node{
+			{Operator: "$set", Path: "a.b", Value: int64(1)},
+			{Operator: "$set", Path: "c", Value: "d"},
+			{Operator: "$inc", Path: "e", Value: int64(2)},
+			{Operator: "$rename", Path: "f", Value: "g"},
+			{Operator: "$unset", Path: "h.$[]", Value: ""},
+		},
+	}, node)
+
+	for _, item := range []struct {
+		update bson.D
+		code   ErrorCode
+	}{
+		{bson.D{}, InvalidDocument},
+		{bson.D{{Key: "a", Value: 1}}, InvalidDocument},
+		{bson.D{{Key: "$foo", Value: bson.D{{Key: "a", Value: 1}}}}, UnknownOperator},
+		{bson.D{{Key: "$set", Value: 1}}, InvalidDocument},
+		{bson.D{{Key: "$set", Value: bson.D{{Key: "a..b", Value: 1}}}}, InvalidDocument},
+		{bson.D{{Key: "$inc", Value: bson.D{{Key: "a", Value: "b"}}}}, InvalidOperand},
+		{bson.D{{Key: "$rename", Value: bson.D{{Key: "a", Value: 1}}}}, InvalidOperand},
+		{bson.D{
+			{Key: "$set", Value: bson.D{{Key: "a.b", Value: 1}}},
+			{Key: "$unset", Value: bson.D{{Key: "a", Value: ""}}},
+		}, ConflictingPaths},
+		{bson.D{
+			{Key: "$set", Value: bson.D{{Key: "a", Value: 1}}},
+			{Key: "$rename", Value: bson.D{{Key: "b", Value: "a"}}},
+		}, ConflictingPaths},
+	} {
+		node, err = NormalizeUpdate(bsonkit.MustConvert(item.update))
+		assert.Error(t, err, item.update)
+		assert.Nil(t, node)
+		assert.Equal(t, item.code, normalizeCode(err), item.update)
+	}
+}
+
+func FuzzNormalizeQuery(f *testing.F) {
+	f.Add([]byte(`{"a": {"$gt": 1}, "$or": [{"b": 2}, {"c": {"$in": [1, 2]}}]}`))
+	f.Add([]byte(`{"a": {"$elemMatch": {"$gte": 3, "b": 4}}}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var query bson.D
+		if bson.UnmarshalExtJSON(data, false, &query) != nil {
+			return
+		}
+
+		node, err := NormalizeQuery(&query)
+		if err != nil {
+			assert.Nil(t, node)
+			assert.NotZero(t, normalizeCode(err))
+			return
+		}
+
+		_, err = Match(&bson.D{}, &query)
+		assert.NoError(t, err)
+	})
+}
@@ -31,6 +31,9 @@ type Context struct {
 	// A custom value available to the operators.
 	Value interface{}
 
+	// Whether query operators should compare strings case-insensitively.
+	Fold bool
+
 	// The query used to resolve positional operators in top level operator
 	// invocation paths.
 	TopLevelQuery bsonkit.Doc
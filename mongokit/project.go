@@ -24,12 +24,15 @@ type projectState struct {
 	merge   map[string]interface{}
 }
 
-// ProjectList will apply the provided projection to the specified list.
+// ProjectList will apply the provided projection to the specified list. The
+// returned list is taken from the list pool and may be released using
+// bsonkit.ReleaseList when not used anymore.
 func ProjectList(list bsonkit.List, projection bsonkit.Doc) (bsonkit.List, error) {
-	result := make(bsonkit.List, 0, len(list))
+	result := bsonkit.AcquireList(len(list))
 	for _, doc := range list {
 		res, err := Project(doc, projection)
 		if err != nil {
+			bsonkit.ReleaseList(result)
 			return nil, err
 		}
 		result = append(result, res)
@@ -67,17 +70,19 @@ func Project(doc, projection bsonkit.Doc) (bsonkit.Doc, error) {
 		// set null document
 		res = &bson.D{}
 
-		// copy id
-		_, err := bsonkit.Put(res, "_id", bsonkit.Get(doc, "_id"), false)
-		if err != nil {
-			return nil, err
+		// copy id if available
+		if id := bsonkit.Get(doc, "_id"); id != bsonkit.Missing {
+			_, err := bsonkit.Put(res, "_id", id, false)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		// copy included fields
 		for _, path := range state.include {
 			value := bsonkit.Get(doc, path)
 			if value != bsonkit.Missing {
-				_, err = bsonkit.Put(res, path, value, false)
+				_, err := bsonkit.Put(res, path, value, false)
 				if err != nil {
 					return nil, err
 				}
@@ -103,10 +108,12 @@ func Project(doc, projection bsonkit.Doc) (bsonkit.Doc, error) {
 			// set null document
 			res = &bson.D{}
 
-			// copy id
-			_, err := bsonkit.Put(res, "_id", bsonkit.Get(doc, "_id"), false)
-			if err != nil {
-				return nil, err
+			// copy id if available
+			if id := bsonkit.Get(doc, "_id"); id != bsonkit.Missing {
+				_, err := bsonkit.Put(res, "_id", id, false)
+				if err != nil {
+					return nil, err
+				}
 			}
 		}
 
@@ -134,6 +134,30 @@ func TestProject(t *testing.T) {
 	})
 }
 
+func TestProjectMissingID(t *testing.T) {
+	doc := bsonkit.MustConvert(bson.M{
+		"foo": "bar",
+		"bar": "baz",
+	})
+
+	res, err := Project(doc, bsonkit.MustConvert(bson.M{
+		"foo": 1,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.MustConvert(bson.M{
+		"foo": "bar",
+	}), res)
+
+	res, err = Project(doc, bsonkit.MustConvert(bson.M{
+		"_id": 0,
+		"foo": 1,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.MustConvert(bson.M{
+		"foo": "bar",
+	}), res)
+}
+
 func TestProjectSlice(t *testing.T) {
 	id := primitive.NewObjectID()
 
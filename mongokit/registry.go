@@ -0,0 +1,135 @@
+package mongokit
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// customOperators contains the names of the registered custom operators.
+var customOperators = map[string]bool{}
+
+// RegisterQueryOperator will register a custom expression query operator
+// e.g. "$fuzzyMatch" that can be used in field conditions of filters and
+// $match stages. The operator should return ErrNotMatched if the document
+// does not match, MatchValues may be used to match the array elements of a
+// field. Operators must be registered before they are used, e.g. from an init
+// function, as the registries are not synchronized.
+func RegisterQueryOperator(name string, operator Operator) error {
+	// check name
+	err := checkOperatorName(name, operator != nil, ExpressionQueryOperators[name] != nil || TopLevelQueryOperators[name] != nil)
+	if err != nil {
+		return err
+	}
+
+	// register operator
+	ExpressionQueryOperators[name] = operator
+	customOperators[name] = true
+
+	return nil
+}
+
+// RegisterUpdateOperator will register a custom field update operator. The
+// operator is called for every path of the update with a context that has
+// the *Changes of the update set as its value, which must be used to record
+// the changed paths. Operators must be registered before they are used, e.g.
+// from an init function, as the registries are not synchronized.
+func RegisterUpdateOperator(name string, operator Operator) error {
+	// check name
+	err := checkOperatorName(name, operator != nil, FieldUpdateOperators[name] != nil)
+	if err != nil {
+		return err
+	}
+
+	// register operator
+	FieldUpdateOperators[name] = operator
+	customOperators[name] = true
+
+	return nil
+}
+
+// RegisterExpression will register a custom aggregation expression operator
+// that can be used in pipelines and $expr queries. The operator receives the
+// unevaluated argument, which may be evaluated using Scope.Evaluate. Operators
+// must be registered before they are used, e.g. from an init function, as the
+// registries are not synchronized.
+func RegisterExpression(name string, operator ExpressionOperator) error {
+	// check name
+	err := checkOperatorName(name, operator != nil, AggregationExpressionOperators[name] != nil)
+	if err != nil {
+		return err
+	}
+
+	// register operator
+	AggregationExpressionOperators[name] = operator
+	customOperators[name] = true
+
+	return nil
+}
+
+// Volatile will return whether the query may match different documents when
+// it is evaluated again on the same documents. This is the case for queries
+// that use $expr, $where, the $$NOW or $$CLUSTER_TIME variables or a custom
+// operator, as their results may depend on the time of evaluation.
+func Volatile(query bsonkit.Doc) bool {
+	// check query
+	if query == nil {
+		return false
+	}
+
+	return volatileValue(*query)
+}
+
+func volatileValue(value interface{}) bool {
+	switch value := value.(type) {
+	case bson.D:
+		for _, field := range value {
+			if field.Key == "$expr" || field.Key == "$where" || customOperators[field.Key] {
+				return true
+			} else if volatileValue(field.Value) {
+				return true
+			}
+		}
+	case *bson.D:
+		return value != nil && volatileValue(*value)
+	case bson.A:
+		for _, item := range value {
+			if volatileValue(item) {
+				return true
+			}
+		}
+	case string:
+		return strings.HasPrefix(value, "$$NOW") || strings.HasPrefix(value, "$$CLUSTER_TIME")
+	}
+
+	return false
+}
+
+// MatchValues will call the function with the value of the path and each
+// element if the value is an array, as done by the builtin query operators.
+// It returns nil on the first match and ErrNotMatched if no value matched.
+func MatchValues(doc bsonkit.Doc, path string, fn func(value interface{}) error) error {
+	return matchUnwind(doc, path, true, false, fn)
+}
+
+func checkOperatorName(name string, valid, exists bool) error {
+	// check name
+	if len(name) < 2 || name[0] != '$' {
+		return fmt.Errorf("invalid operator name %q", name)
+	}
+
+	// check operator
+	if !valid {
+		return fmt.Errorf("missing operator %q", name)
+	}
+
+	// check existence
+	if exists {
+		return fmt.Errorf("operator %q already registered", name)
+	}
+
+	return nil
+}
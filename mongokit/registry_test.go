@@ -0,0 +1,158 @@
+package mongokit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestRegisterQueryOperator(t *testing.T) {
+	defer delete(ExpressionQueryOperators, "$fuzzyMatch")
+
+	err := RegisterQueryOperator("$fuzzyMatch", func(_ Context, doc bsonkit.Doc, op, path string, v interface{}) error {
+		query, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string", op)
+		}
+		return MatchValues(doc, path, func(value interface{}) error {
+			str, ok := value.(string)
+			if !ok || !strings.Contains(strings.ToLower(str), strings.ToLower(query)) {
+				return ErrNotMatched
+			}
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+
+	err = RegisterQueryOperator("$fuzzyMatch", matchComp)
+	assert.Error(t, err)
+
+	doc := bsonkit.MustConvert(bson.M{
+		"name": "Hello World",
+		"tags": bson.A{"Foo", "Bar"},
+	})
+
+	res, err := Match(doc, bsonkit.MustConvert(bson.M{"name": bson.M{"$fuzzyMatch": "world"}}))
+	assert.NoError(t, err)
+	assert.True(t, res)
+
+	res, err = Match(doc, bsonkit.MustConvert(bson.M{"tags": bson.M{"$fuzzyMatch": "ba"}}))
+	assert.NoError(t, err)
+	assert.True(t, res)
+
+	res, err = Match(doc, bsonkit.MustConvert(bson.M{"name": bson.M{"$fuzzyMatch": "baz"}}))
+	assert.NoError(t, err)
+	assert.False(t, res)
+
+	res, err = Match(doc, bsonkit.MustConvert(bson.M{"name": bson.M{"$fuzzyMatch": 1}}))
+	assert.Error(t, err)
+	assert.False(t, res)
+
+	list, err := Aggregate(nil, bsonkit.List{doc}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"$match": bson.M{"name": bson.M{"$fuzzyMatch": "hello"}}}),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{doc}, list)
+
+	_, err = NormalizeQuery(bsonkit.MustConvert(bson.M{"name": bson.M{"$fuzzyMatch": "hello"}}))
+	assert.NoError(t, err)
+}
+
+func TestRegisterUpdateOperator(t *testing.T) {
+	defer delete(FieldUpdateOperators, "$append")
+
+	err := RegisterUpdateOperator("$append", func(ctx Context, doc bsonkit.Doc, op, path string, v interface{}) error {
+		str, _ := bsonkit.Get(doc, path).(string)
+		value := str + fmt.Sprint(v)
+		_, err := bsonkit.Put(doc, path, value, false)
+		if err != nil {
+			return err
+		}
+		return ctx.Value.(*Changes).Record(path, value)
+	})
+	assert.NoError(t, err)
+
+	err = RegisterUpdateOperator("append", applySet)
+	assert.Error(t, err)
+
+	err = RegisterUpdateOperator("$set", applySet)
+	assert.Error(t, err)
+
+	doc := bsonkit.MustConvert(bson.M{"name": "foo"})
+	changes, err := Apply(doc, nil, bsonkit.MustConvert(bson.M{
+		"$append": bson.M{"name": "bar"},
+	}), false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "foobar"}, changes.Changed)
+	assert.Equal(t, bsonkit.MustConvert(bson.M{"name": "foobar"}), doc)
+}
+
+func TestRegisterExpression(t *testing.T) {
+	defer delete(AggregationExpressionOperators, "$reverse")
+
+	err := RegisterExpression("$reverse", func(scope *Scope, op string, arg interface{}) (interface{}, error) {
+		value, err := scope.Evaluate(arg)
+		if err != nil {
+			return nil, err
+		}
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected string", op)
+		}
+		runes := []rune(str)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	})
+	assert.NoError(t, err)
+
+	err = RegisterExpression("$reverse", nil)
+	assert.Error(t, err)
+
+	doc := bsonkit.MustConvert(bson.M{"name": "foo"})
+
+	list, err := Aggregate(nil, bsonkit.List{doc}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"$project": bson.M{"_id": 0, "name": bson.M{"$reverse": "$name"}}}),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{bsonkit.MustConvert(bson.M{"name": "oof"})}, list)
+
+	res, err := Match(doc, bsonkit.MustConvert(bson.M{
+		"$expr": bson.M{"$eq": bson.A{bson.M{"$reverse": "$name"}, "oof"}},
+	}))
+	assert.NoError(t, err)
+	assert.True(t, res)
+}
+
+func TestVolatile(t *testing.T) {
+	defer delete(ExpressionQueryOperators, "$volatileMatch")
+	defer delete(customOperators, "$volatileMatch")
+
+	err := RegisterQueryOperator("$volatileMatch", matchComp)
+	assert.NoError(t, err)
+
+	for _, item := range []struct {
+		query    bson.M
+		volatile bool
+	}{
+		{query: nil, volatile: false},
+		{query: bson.M{"a": 1}, volatile: false},
+		{query: bson.M{"a": bson.M{"$gt": "$$NOW"}}, volatile: true},
+		{query: bson.M{"$expr": bson.M{"$eq": bson.A{"$a", 1}}}, volatile: true},
+		{query: bson.M{"$or": bson.A{bson.M{"a": 1}, bson.M{"$where": "true"}}}, volatile: true},
+		{query: bson.M{"a": bson.M{"$volatileMatch": 1}}, volatile: true},
+		{query: bson.M{"a": "$$CLUSTER_TIME"}, volatile: true},
+	} {
+		var query bsonkit.Doc
+		if item.query != nil {
+			query = bsonkit.MustConvert(item.query)
+		}
+		assert.Equal(t, item.volatile, Volatile(query), item.query)
+	}
+}
@@ -0,0 +1,329 @@
+package mongokit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func init() {
+	// register search stage
+	AggregationStages["$search"] = stageSearch
+
+	// register meta operator
+	AggregationExpressionOperators["$meta"] = exprMeta
+}
+
+type searchOperator struct {
+	name       string
+	terms      [][]string
+	paths      []string
+	wildcard   bool
+	slop       int
+	sequential bool
+}
+
+func stageSearch(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get parameters
+	params, err := getParameters("$search", arg, nil, "index", "text", "phrase", "autocomplete", "count", "highlight", "returnStoredSource", "scoreDetails")
+	if err != nil {
+		return nil, err
+	}
+
+	// get operator
+	var op *searchOperator
+	for _, name := range []string{"text", "phrase", "autocomplete"} {
+		if spec, ok := params[name]; ok {
+			if op != nil {
+				return nil, fmt.Errorf("$search: expected a single operator")
+			}
+			op, err = parseSearchOperator(name, spec)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if op == nil {
+		return nil, fmt.Errorf("$search: expected one of the operators text, phrase or autocomplete")
+	}
+
+	// tokenize documents
+	tokens := make([][]string, len(list))
+	for i, doc := range list {
+		tokens[i] = searchTokens(doc, op.paths, op.wildcard)
+	}
+
+	// count documents per term
+	frequency := map[string]int{}
+	for _, terms := range op.terms {
+		for _, term := range terms {
+			frequency[term] = 0
+		}
+	}
+	for _, list := range tokens {
+		for term := range frequency {
+			if op.count(list, []string{term}) > 0 {
+				frequency[term]++
+			}
+		}
+	}
+
+	// score documents
+	type match struct {
+		doc   bsonkit.Doc
+		score float64
+	}
+	var matches []match
+	for i, doc := range list {
+		var score float64
+		for _, terms := range op.terms {
+			count := op.count(tokens[i], terms)
+			if count == 0 {
+				continue
+			}
+			for _, term := range terms {
+				score += float64(count) * math.Log(1+float64(len(list))/float64(frequency[term]))
+			}
+		}
+		if score > 0 {
+			matches = append(matches, match{doc: doc, score: score})
+		}
+	}
+
+	// sort matches by score
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	// collect documents
+	result := make(bsonkit.List, 0, len(matches))
+	for _, match := range matches {
+		ctx.setMeta(match.doc, "searchScore", match.score)
+		result = append(result, match.doc)
+	}
+
+	return result, nil
+}
+
+func parseSearchOperator(name string, spec interface{}) (*searchOperator, error) {
+	// get parameters
+	op := "$search." + name
+	params, err := getParameters(op, spec, []string{"query", "path"}, "fuzzy", "score", "slop", "tokenOrder", "synonyms")
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare operator
+	searchOp := &searchOperator{
+		name: name,
+	}
+
+	// get queries
+	var queries []string
+	switch query := params["query"].(type) {
+	case string:
+		queries = []string{query}
+	case bson.A:
+		for _, item := range query {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected query to be a string or an array of strings", op)
+			}
+			queries = append(queries, str)
+		}
+	default:
+		return nil, fmt.Errorf("%s: expected query to be a string or an array of strings", op)
+	}
+
+	// get terms, text queries match any term and phrase and autocomplete
+	// queries match the sequence of terms
+	for _, query := range queries {
+		terms := tokenize(query)
+		if len(terms) == 0 {
+			continue
+		}
+		if name == "text" {
+			for _, term := range terms {
+				searchOp.terms = append(searchOp.terms, []string{term})
+			}
+		} else {
+			searchOp.terms = append(searchOp.terms, terms)
+		}
+	}
+
+	// get paths
+	switch path := params["path"].(type) {
+	case string:
+		searchOp.paths = []string{path}
+	case bson.A:
+		for _, item := range path {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected path to be a string or an array of strings", op)
+			}
+			searchOp.paths = append(searchOp.paths, str)
+		}
+	case bson.D:
+		if len(path) != 1 || path[0].Key != "wildcard" || path[0].Value != "*" {
+			return nil, fmt.Errorf("%s: only the wildcard path \"*\" is supported", op)
+		}
+		searchOp.wildcard = true
+	default:
+		return nil, fmt.Errorf("%s: expected path to be a string, an array of strings or a wildcard", op)
+	}
+
+	// get slop
+	if slop, ok := params["slop"]; ok {
+		num, ok := toInt64(slop)
+		if !ok || num < 0 || name != "phrase" {
+			return nil, fmt.Errorf("%s: invalid slop", op)
+		}
+		searchOp.slop = int(num)
+	}
+
+	// get token order
+	if order, ok := params["tokenOrder"]; ok {
+		if name != "autocomplete" || (order != "any" && order != "sequential") {
+			return nil, fmt.Errorf("%s: invalid token order", op)
+		}
+		searchOp.sequential = order == "sequential"
+	}
+
+	// autocomplete queries match any term by default
+	if name == "autocomplete" && !searchOp.sequential {
+		var terms [][]string
+		for _, list := range searchOp.terms {
+			for _, term := range list {
+				terms = append(terms, []string{term})
+			}
+		}
+		searchOp.terms = terms
+	}
+
+	return searchOp, nil
+}
+
+func (o *searchOperator) count(tokens, terms []string) int {
+	// count matches of the terms starting at every token
+	var count int
+	for i := range tokens {
+		if o.match(tokens[i:], terms) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (o *searchOperator) match(tokens, terms []string) bool {
+	// match first term
+	if len(tokens) == 0 || !o.matchTerm(tokens[0], terms[0], len(terms) == 1) {
+		return false
+	}
+
+	// match remaining terms allowing the configured slop between them
+	pos := 0
+	for i := 1; i < len(terms); i++ {
+		found := false
+		for j := pos + 1; j <= pos+1+o.slop && j < len(tokens); j++ {
+			if o.matchTerm(tokens[j], terms[i], i == len(terms)-1) {
+				pos = j
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (o *searchOperator) matchTerm(token, term string, last bool) bool {
+	// autocomplete matches the last term as a prefix
+	if o.name == "autocomplete" && last {
+		return strings.HasPrefix(token, term)
+	}
+
+	return token == term
+}
+
+func searchTokens(doc bsonkit.Doc, paths []string, wildcard bool) []string {
+	// collect values
+	var values []interface{}
+	if wildcard {
+		values = append(values, *doc)
+	} else {
+		for _, path := range paths {
+			values = append(values, bsonkit.Get(doc, path))
+		}
+	}
+
+	// tokenize strings
+	var tokens []string
+	var walk func(interface{})
+	walk = func(value interface{}) {
+		switch value := value.(type) {
+		case string:
+			tokens = append(tokens, tokenize(value)...)
+		case bson.A:
+			for _, item := range value {
+				walk(item)
+			}
+		case bson.D:
+			if wildcard {
+				for _, field := range value {
+					walk(field.Value)
+				}
+			}
+		}
+	}
+	for _, value := range values {
+		walk(value)
+	}
+
+	return tokens
+}
+
+func tokenize(str string) []string {
+	return strings.FieldsFunc(strings.ToLower(str), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func (c *AggregationContext) setMeta(doc bsonkit.Doc, key string, value interface{}) {
+	// ensure map
+	if c.meta == nil {
+		c.meta = map[bsonkit.Doc]map[string]interface{}{}
+	}
+
+	// set value
+	meta := map[string]interface{}{}
+	for k, v := range c.meta[doc] {
+		meta[k] = v
+	}
+	meta[key] = value
+	c.meta[doc] = meta
+}
+
+func exprMeta(scope *Scope, _ string, arg interface{}) (interface{}, error) {
+	// check keyword
+	if arg != "searchScore" && arg != "vectorSearchScore" {
+		return nil, fmt.Errorf("$meta: unsupported keyword %v", arg)
+	}
+
+	// get value
+	value, ok := scope.Meta[arg.(string)]
+	if !ok {
+		return bsonkit.Missing, nil
+	}
+
+	return value, nil
+}
@@ -0,0 +1,161 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func searchTest(t *testing.T, search bson.D, extra ...bson.D) (bsonkit.List, error) {
+	list := bsonkit.List{
+		{{Key: "_id", Value: int32(1)}, {Key: "title", Value: "The Quick Brown Fox"}, {Key: "tags", Value: bson.A{"animal", "fast"}}},
+		{{Key: "_id", Value: int32(2)}, {Key: "title", Value: "Brown bread, brown butter"}, {Key: "meta", Value: bson.D{{Key: "note", Value: "quick recipe"}}}},
+		{{Key: "_id", Value: int32(3)}, {Key: "title", Value: "A lazy dog"}},
+		{{Key: "_id", Value: int32(4)}, {Key: "title", Value: "Quickly browning onions"}},
+	}
+
+	pipeline := bsonkit.List{{{Key: "$search", Value: search}}}
+	for i := range extra {
+		pipeline = append(pipeline, &extra[i])
+	}
+
+	return Aggregate(nil, list, pipeline)
+}
+
+func searchIDs(list bsonkit.List) []interface{} {
+	ids := make([]interface{}, 0, len(list))
+	for _, doc := range list {
+		ids = append(ids, bsonkit.Get(doc, "_id"))
+	}
+	return ids
+}
+
+func TestAggregateSearch(t *testing.T) {
+	// text
+	res, err := searchTest(t, bson.D{
+		{Key: "index", Value: "default"},
+		{Key: "text", Value: bson.D{
+			{Key: "query", Value: "brown fox"},
+			{Key: "path", Value: "title"},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1), int32(2)}, searchIDs(res))
+
+	// text with multiple paths
+	res, err = searchTest(t, bson.D{
+		{Key: "text", Value: bson.D{
+			{Key: "query", Value: bson.A{"quick", "fast"}},
+			{Key: "path", Value: bson.A{"title", "tags"}},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1)}, searchIDs(res))
+
+	// text with wildcard path
+	res, err = searchTest(t, bson.D{
+		{Key: "text", Value: bson.D{
+			{Key: "query", Value: "quick"},
+			{Key: "path", Value: bson.D{{Key: "wildcard", Value: "*"}}},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1), int32(2)}, searchIDs(res))
+
+	// phrase
+	res, err = searchTest(t, bson.D{
+		{Key: "phrase", Value: bson.D{
+			{Key: "query", Value: "brown fox"},
+			{Key: "path", Value: "title"},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1)}, searchIDs(res))
+
+	// phrase with slop
+	res, err = searchTest(t, bson.D{
+		{Key: "phrase", Value: bson.D{
+			{Key: "query", Value: "quick fox"},
+			{Key: "path", Value: "title"},
+			{Key: "slop", Value: int32(1)},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1)}, searchIDs(res))
+
+	// autocomplete
+	res, err = searchTest(t, bson.D{
+		{Key: "autocomplete", Value: bson.D{
+			{Key: "query", Value: "qui"},
+			{Key: "path", Value: "title"},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1), int32(4)}, searchIDs(res))
+
+	// autocomplete sequential
+	res, err = searchTest(t, bson.D{
+		{Key: "autocomplete", Value: bson.D{
+			{Key: "query", Value: "quickly brow"},
+			{Key: "path", Value: "title"},
+			{Key: "tokenOrder", Value: "sequential"},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(4)}, searchIDs(res))
+
+	// errors
+	_, err = searchTest(t, bson.D{})
+	assert.Error(t, err)
+	_, err = searchTest(t, bson.D{
+		{Key: "compound", Value: bson.D{}},
+	})
+	assert.Error(t, err)
+	_, err = searchTest(t, bson.D{
+		{Key: "text", Value: bson.D{{Key: "query", Value: "foo"}}},
+	})
+	assert.Error(t, err)
+}
+
+func TestAggregateSearchScore(t *testing.T) {
+	res, err := searchTest(t, bson.D{
+		{Key: "text", Value: bson.D{
+			{Key: "query", Value: "brown"},
+			{Key: "path", Value: "title"},
+		}},
+	}, bson.D{
+		{Key: "$project", Value: bson.D{
+			{Key: "score", Value: bson.D{{Key: "$meta", Value: "searchScore"}}},
+		}},
+	}, bson.D{
+		{Key: "$addFields", Value: bson.D{
+			{Key: "again", Value: bson.D{{Key: "$meta", Value: "searchScore"}}},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(2), int32(1)}, searchIDs(res))
+
+	score1 := bsonkit.Get(res[0], "score").(float64)
+	score2 := bsonkit.Get(res[1], "score").(float64)
+	assert.Greater(t, score1, score2)
+	assert.Greater(t, score2, 0.0)
+	assert.Equal(t, score1, bsonkit.Get(res[0], "again"))
+
+	res, err = Aggregate(nil, bsonkit.List{{{Key: "_id", Value: int32(1)}}}, bsonkit.List{
+		{{Key: "$project", Value: bson.D{
+			{Key: "score", Value: bson.D{{Key: "$meta", Value: "searchScore"}}},
+		}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{{{Key: "_id", Value: int32(1)}}}, res)
+
+	_, err = Aggregate(nil, bsonkit.List{{{Key: "_id", Value: int32(1)}}}, bsonkit.List{
+		{{Key: "$project", Value: bson.D{
+			{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}},
+		}}},
+	})
+	assert.Error(t, err)
+}
@@ -57,3 +57,51 @@ func Sort(list bsonkit.List, doc bsonkit.Doc) (bsonkit.List, error) {
 
 	return result, nil
 }
+
+// SortLimit will sort a list based on a MongoDB sort document and return a new
+// list with the first sorted documents up to the provided limit. A zero limit
+// will return all documents.
+func SortLimit(list bsonkit.List, doc bsonkit.Doc, limit int) (bsonkit.List, error) {
+	// prepare columns
+	columns, err := Columns(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// sort list
+	result := bsonkit.SortLimit(list, columns, true, limit)
+
+	return result, nil
+}
+
+// NaturalOrder will return the direction of a {$natural: 1} or {$natural: -1}
+// sort or hint document. Zero is returned if the document does not request the
+// natural order, which is the order in which documents have been inserted.
+func NaturalOrder(doc bsonkit.Doc) (int, error) {
+	// check document
+	if doc == nil {
+		return 0, nil
+	}
+
+	// find natural field
+	for _, field := range *doc {
+		if field.Key != "$natural" {
+			continue
+		}
+
+		// check combination
+		if len(*doc) != 1 {
+			return 0, fmt.Errorf("$natural cannot be combined with other fields")
+		}
+
+		// get direction
+		direction, ok := toInt64(field.Value)
+		if !ok || (direction != 1 && direction != -1) {
+			return 0, fmt.Errorf("$natural: expected 1 or -1 as direction")
+		}
+
+		return int(direction), nil
+	}
+
+	return 0, nil
+}
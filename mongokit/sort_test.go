@@ -68,3 +68,67 @@ func TestSort(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, bsonkit.List{a2, a3, a1}, list)
 }
+
+func TestSortLimit(t *testing.T) {
+	a1 := bsonkit.MustConvert(bson.M{"a": "1", "b": true})
+	a2 := bsonkit.MustConvert(bson.M{"a": "2", "b": false})
+	a3 := bsonkit.MustConvert(bson.M{"a": "3", "b": true})
+
+	// invalid document
+	list, err := SortLimit(bsonkit.List{a3, a1, a2}, &bson.D{
+		bson.E{Key: "a", Value: 0},
+	}, 1)
+	assert.Error(t, err)
+	assert.Nil(t, list)
+
+	// sort forwards limited
+	list, err = SortLimit(bsonkit.List{a3, a1, a2}, &bson.D{
+		bson.E{Key: "a", Value: int64(1)},
+	}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{a1, a2}, list)
+
+	// sort backwards limited
+	list, err = SortLimit(bsonkit.List{a3, a1, a2}, &bson.D{
+		bson.E{Key: "a", Value: int64(-1)},
+	}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{a3}, list)
+
+	// sort multiple unlimited
+	list, err = SortLimit(bsonkit.List{a3, a1, a2}, &bson.D{
+		bson.E{Key: "b", Value: int64(1)},
+		bson.E{Key: "a", Value: int64(1)},
+	}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{a2, a1, a3}, list)
+}
+
+func TestNaturalOrder(t *testing.T) {
+	natural, err := NaturalOrder(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, natural)
+
+	natural, err = NaturalOrder(&bson.D{{Key: "a", Value: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, natural)
+
+	natural, err = NaturalOrder(&bson.D{{Key: "$natural", Value: int32(1)}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, natural)
+
+	natural, err = NaturalOrder(&bson.D{{Key: "$natural", Value: -1.0}})
+	assert.NoError(t, err)
+	assert.Equal(t, -1, natural)
+
+	natural, err = NaturalOrder(&bson.D{{Key: "$natural", Value: 2}})
+	assert.Error(t, err)
+	assert.Equal(t, "$natural: expected 1 or -1 as direction", err.Error())
+
+	natural, err = NaturalOrder(&bson.D{
+		{Key: "$natural", Value: 1},
+		{Key: "a", Value: 1},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "$natural cannot be combined with other fields", err.Error())
+}
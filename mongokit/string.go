@@ -0,0 +1,589 @@
+package mongokit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// https://github.com/mongodb/mongo/blob/master/src/mongo/db/pipeline/expression.cpp
+
+func init() {
+	// register string operators
+	AggregationExpressionOperators["$concat"] = exprConcat
+	AggregationExpressionOperators["$toUpper"] = exprCase
+	AggregationExpressionOperators["$toLower"] = exprCase
+	AggregationExpressionOperators["$strcasecmp"] = exprStrcasecmp
+	AggregationExpressionOperators["$substr"] = exprSubstrBytes
+	AggregationExpressionOperators["$substrBytes"] = exprSubstrBytes
+	AggregationExpressionOperators["$substrCP"] = exprSubstrCP
+	AggregationExpressionOperators["$strLenBytes"] = exprStrLen
+	AggregationExpressionOperators["$strLenCP"] = exprStrLen
+	AggregationExpressionOperators["$indexOfBytes"] = exprIndexOf
+	AggregationExpressionOperators["$indexOfCP"] = exprIndexOf
+	AggregationExpressionOperators["$split"] = exprSplit
+	AggregationExpressionOperators["$trim"] = exprTrim
+	AggregationExpressionOperators["$ltrim"] = exprTrim
+	AggregationExpressionOperators["$rtrim"] = exprTrim
+	AggregationExpressionOperators["$replaceOne"] = exprReplace
+	AggregationExpressionOperators["$replaceAll"] = exprReplace
+	AggregationExpressionOperators["$regexMatch"] = exprRegex
+	AggregationExpressionOperators["$regexFind"] = exprRegex
+	AggregationExpressionOperators["$regexFindAll"] = exprRegex
+}
+
+// the whitespace characters removed by $trim if no characters are specified
+const trimWhitespace = "\x00 \t\n\v\f\r\u00a0\u1680\u2000\u2001\u2002\u2003\u2004\u2005\u2006\u2007\u2008\u2009\u200a"
+
+func toString(op string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case primitive.Decimal128:
+		return v.String(), nil
+	case primitive.DateTime:
+		return v.Time().UTC().Format("2006-01-02T15:04:05.000Z"), nil
+	default:
+		if isNullish(v) {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s: can't convert from BSON type %s to String", op, typeName(v))
+	}
+}
+
+func exprConcat(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// concatenate strings
+	var b strings.Builder
+	for _, value := range args {
+		if isNullish(value) {
+			return nil, nil
+		}
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s only supports strings, not %s", op, typeName(value))
+		}
+		b.WriteString(str)
+	}
+
+	return b.String(), nil
+}
+
+func exprCase(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// get string
+	str, err := toString(op, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// only ASCII characters are converted
+	b := []byte(str)
+	for i, c := range b {
+		if op == "$toUpper" && c >= 'a' && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		} else if op == "$toLower" && c >= 'A' && c <= 'Z' {
+			b[i] = c - 'A' + 'a'
+		}
+	}
+
+	return string(b), nil
+}
+
+func exprStrcasecmp(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// get strings
+	a, err := toString(op, args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := toString(op, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// compare ASCII case-insensitive
+	res := strings.Compare(strings.ToUpper(a), strings.ToUpper(b))
+
+	return int32(res), nil
+}
+
+func exprSubstrBytes(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	// get string
+	str, err := toString(op, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// get start and length
+	start, err := getInteger(op, "starting index", args[1])
+	if err != nil {
+		return nil, err
+	} else if start < 0 {
+		return nil, fmt.Errorf("%s: starting index must be non-negative, found %d", op, start)
+	}
+	length, err := getInteger(op, "length", args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	// handle out of range start
+	if start >= int64(len(str)) {
+		return "", nil
+	}
+
+	// check start
+	if !utf8.RuneStart(str[start]) {
+		return nil, fmt.Errorf("%s: invalid range, starting index is a UTF-8 continuation byte", op)
+	}
+
+	// get end, a negative length selects the remainder
+	end := int64(len(str))
+	if length >= 0 && start+length < end {
+		end = start + length
+	}
+
+	// check end
+	if end < int64(len(str)) && !utf8.RuneStart(str[end]) {
+		return nil, fmt.Errorf("%s: invalid range, ending index is in the middle of a UTF-8 character", op)
+	}
+
+	return str[start:end], nil
+}
+
+func exprSubstrCP(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	// get string
+	str, err := toString(op, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// get start and count
+	start, err := getInteger(op, "starting index", args[1])
+	if err != nil {
+		return nil, err
+	} else if start < 0 {
+		return nil, fmt.Errorf("%s: starting index must be non-negative, found %d", op, start)
+	}
+	count, err := getInteger(op, "length", args[2])
+	if err != nil {
+		return nil, err
+	} else if count < 0 {
+		return nil, fmt.Errorf("%s: length must be non-negative, found %d", op, count)
+	}
+
+	// get code points
+	runes := []rune(str)
+	if start >= int64(len(runes)) {
+		return "", nil
+	}
+	end := int64(len(runes))
+	if start+count < end {
+		end = start + count
+	}
+
+	return string(runes[start:end]), nil
+}
+
+func exprStrLen(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate argument
+	args, err := scope.evaluateArgs(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// check string
+	str, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a string argument, found: %s", op, typeName(args[0]))
+	}
+
+	// count bytes or code points
+	if op == "$strLenCP" {
+		return int32(utf8.RuneCountInString(str)), nil
+	}
+
+	return int32(len(str)), nil
+}
+
+func exprIndexOf(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+
+	// get strings
+	str, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a string as the first argument, found: %s", op, typeName(args[0]))
+	}
+	sub, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a string as the second argument, found: %s", op, typeName(args[1]))
+	}
+
+	// get byte offsets of units
+	var offsets []int
+	if op == "$indexOfCP" {
+		for i := range str {
+			offsets = append(offsets, i)
+		}
+	} else {
+		for i := 0; i < len(str); i++ {
+			offsets = append(offsets, i)
+		}
+	}
+	offsets = append(offsets, len(str))
+
+	// get range
+	start, end := int64(0), int64(len(offsets)-1)
+	if len(args) > 2 {
+		start, err = getInteger(op, "starting index", args[2])
+		if err != nil {
+			return nil, err
+		} else if start < 0 {
+			return nil, fmt.Errorf("%s: starting index must be non-negative, found %d", op, start)
+		}
+	}
+	if len(args) > 3 {
+		end, err = getInteger(op, "ending index", args[3])
+		if err != nil {
+			return nil, err
+		} else if end < 0 {
+			return nil, fmt.Errorf("%s: ending index must be non-negative, found %d", op, end)
+		}
+		if end > int64(len(offsets)-1) {
+			end = int64(len(offsets) - 1)
+		}
+	}
+
+	// check range
+	if start > end {
+		return int32(-1), nil
+	}
+
+	// search substring
+	index := strings.Index(str[offsets[start]:offsets[end]], sub)
+	if index < 0 {
+		return int32(-1), nil
+	}
+
+	// get unit index
+	for i := start; i < int64(len(offsets)); i++ {
+		if offsets[i] == offsets[start]+index {
+			return int32(i), nil
+		}
+	}
+
+	return int32(-1), nil
+}
+
+func exprSplit(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate arguments
+	args, err := scope.evaluateArgs(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(args[0]) || isNullish(args[1]) {
+		return nil, nil
+	}
+
+	// get strings
+	str, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s requires an expression that evaluates to a string as a first argument, found: %s", op, typeName(args[0]))
+	}
+	sep, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s requires an expression that evaluates to a string as a second argument, found: %s", op, typeName(args[1]))
+	} else if sep == "" {
+		return nil, fmt.Errorf("%s requires a non-empty separator", op)
+	}
+
+	// split string
+	array := bson.A{}
+	for _, part := range strings.Split(str, sep) {
+		array = append(array, part)
+	}
+
+	return array, nil
+}
+
+func exprTrim(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"input"}, "chars")
+	if err != nil {
+		return nil, err
+	}
+
+	// handle null
+	if isNullish(fields["input"]) {
+		return nil, nil
+	}
+	if chars, ok := fields["chars"]; ok && isNullish(chars) {
+		return nil, nil
+	}
+
+	// get input
+	input, ok := fields["input"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s requires its input to be a string, got %s", op, typeName(fields["input"]))
+	}
+
+	// get characters
+	cutset := trimWhitespace
+	if chars, ok := fields["chars"]; ok {
+		cutset, ok = chars.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s requires 'chars' to be a string, got %s", op, typeName(chars))
+		}
+	}
+
+	// trim input
+	switch op {
+	case "$ltrim":
+		return strings.TrimLeft(input, cutset), nil
+	case "$rtrim":
+		return strings.TrimRight(input, cutset), nil
+	default:
+		return strings.Trim(input, cutset), nil
+	}
+}
+
+func exprReplace(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"input", "find", "replacement"})
+	if err != nil {
+		return nil, err
+	}
+
+	// check strings
+	var strs []string
+	for _, name := range []string{"input", "find", "replacement"} {
+		value := fields[name]
+		if isNullish(value) {
+			strs = append(strs, "")
+			continue
+		}
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s requires that '%s' be a string, found: %s", op, name, typeName(value))
+		}
+		strs = append(strs, str)
+	}
+
+	// handle null
+	for _, value := range fields {
+		if isNullish(value) {
+			return nil, nil
+		}
+	}
+
+	// replace strings
+	if op == "$replaceOne" {
+		return strings.Replace(strs[0], strs[1], strs[2], 1), nil
+	}
+
+	return strings.ReplaceAll(strs[0], strs[1], strs[2]), nil
+}
+
+// CompileRegex will compile a MongoDB regular expression with the specified
+// options. The options "i", "m", "s" and "x" are supported.
+func CompileRegex(pattern, options string) (*regexp.Regexp, error) {
+	// prepare flags
+	var flags string
+	for _, opt := range options {
+		switch opt {
+		case 'i', 'm', 's':
+			if !strings.ContainsRune(flags, opt) {
+				flags += string(opt)
+			}
+		case 'x':
+			pattern = stripExtendedRegex(pattern)
+		default:
+			return nil, fmt.Errorf("invalid flag in regex options: %c", opt)
+		}
+	}
+
+	// add flags
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	return regexp.Compile(pattern)
+}
+
+func stripExtendedRegex(pattern string) string {
+	var b strings.Builder
+	escaped, class, comment := false, false, false
+	for _, r := range pattern {
+		switch {
+		case comment:
+			comment = r != '\n'
+		case escaped:
+			escaped = false
+			b.WriteRune(r)
+		case r == '\\':
+			escaped = true
+			b.WriteRune(r)
+		case class:
+			class = r != ']'
+			b.WriteRune(r)
+		case r == '[':
+			class = true
+			b.WriteRune(r)
+		case r == '#':
+			comment = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' || r == '\v':
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func exprRegex(scope *Scope, op string, arg interface{}) (interface{}, error) {
+	// evaluate fields
+	fields, err := evaluateFields(scope, op, arg, []string{"input", "regex"}, "options")
+	if err != nil {
+		return nil, err
+	}
+
+	// get pattern and options
+	var pattern, options string
+	switch regex := fields["regex"].(type) {
+	case string:
+		pattern = regex
+	case primitive.Regex:
+		pattern, options = regex.Pattern, regex.Options
+	default:
+		if !isNullish(regex) {
+			return nil, fmt.Errorf("%s needs 'regex' to be of type string or regex", op)
+		}
+	}
+	if value, ok := fields["options"]; ok && !isNullish(value) {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s needs 'options' to be of type string", op)
+		} else if options != "" {
+			return nil, fmt.Errorf("%s found regex options specified in both 'regex' and 'options' fields", op)
+		}
+		options = str
+	}
+
+	// prepare empty result
+	var empty interface{}
+	switch op {
+	case "$regexMatch":
+		empty = false
+	case "$regexFindAll":
+		empty = bson.A{}
+	}
+
+	// handle null
+	if isNullish(fields["input"]) || isNullish(fields["regex"]) {
+		return empty, nil
+	}
+
+	// get input
+	input, ok := fields["input"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s needs 'input' to be of type string", op)
+	}
+
+	// compile regex
+	regex, err := CompileRegex(pattern, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// handle match
+	if op == "$regexMatch" {
+		return regex.MatchString(input), nil
+	}
+
+	// find matches
+	limit := 1
+	if op == "$regexFindAll" {
+		limit = -1
+	}
+	matches := regex.FindAllStringSubmatchIndex(input, limit)
+
+	// build results
+	results := bson.A{}
+	for _, match := range matches {
+		// collect captures
+		captures := bson.A{}
+		for i := 2; i < len(match); i += 2 {
+			if match[i] < 0 {
+				captures = append(captures, nil)
+			} else {
+				captures = append(captures, input[match[i]:match[i+1]])
+			}
+		}
+
+		// add result with code point index
+		results = append(results, bson.D{
+			{Key: "match", Value: input[match[0]:match[1]]},
+			{Key: "idx", Value: int32(utf8.RuneCountInString(input[:match[0]]))},
+			{Key: "captures", Value: captures},
+		})
+	}
+
+	// return first match
+	if op == "$regexFind" {
+		if len(results) == 0 {
+			return nil, nil
+		}
+		return results[0], nil
+	}
+
+	return results, nil
+}
@@ -0,0 +1,98 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStringOperators(t *testing.T) {
+	doc := &bson.D{
+		{Key: "s", Value: "héllo wörld"},
+		{Key: "p", Value: "  padded\t"},
+		{Key: "n", Value: nil},
+		{Key: "i", Value: int32(42)},
+	}
+
+	table := []struct {
+		expr interface{}
+		res  interface{}
+		err  string
+	}{
+		// concat
+		{expr: bson.D{{Key: "$concat", Value: bson.A{"$s", "!", "?"}}}, res: "héllo wörld!?"},
+		{expr: bson.D{{Key: "$concat", Value: bson.A{"$s", "$x"}}}, res: nil},
+		{expr: bson.D{{Key: "$concat", Value: bson.A{"$s", "$i"}}}, err: "$concat only supports strings, not int"},
+		// case
+		{expr: bson.D{{Key: "$toUpper", Value: "$s"}}, res: "HéLLO WöRLD"},
+		{expr: bson.D{{Key: "$toLower", Value: "ABC"}}, res: "abc"},
+		{expr: bson.D{{Key: "$toUpper", Value: "$n"}}, res: ""},
+		{expr: bson.D{{Key: "$toUpper", Value: "$i"}}, res: "42"},
+		{expr: bson.D{{Key: "$strcasecmp", Value: bson.A{"abc", "ABC"}}}, res: int32(0)},
+		{expr: bson.D{{Key: "$strcasecmp", Value: bson.A{"abc", "abd"}}}, res: int32(-1)},
+		// substrings
+		{expr: bson.D{{Key: "$substrBytes", Value: bson.A{"$s", int32(0), int32(3)}}}, res: "hé"},
+		{expr: bson.D{{Key: "$substrBytes", Value: bson.A{"$s", int32(2), int32(1)}}}, err: "$substrBytes: invalid range, starting index is a UTF-8 continuation byte"},
+		{expr: bson.D{{Key: "$substrBytes", Value: bson.A{"$s", int32(0), int32(2)}}}, err: "$substrBytes: invalid range, ending index is in the middle of a UTF-8 character"},
+		{expr: bson.D{{Key: "$substr", Value: bson.A{"$s", int32(7), int32(-1)}}}, res: "wörld"},
+		{expr: bson.D{{Key: "$substrCP", Value: bson.A{"$s", int32(1), int32(4)}}}, res: "éllo"},
+		{expr: bson.D{{Key: "$substrCP", Value: bson.A{"$s", int32(20), int32(4)}}}, res: ""},
+		{expr: bson.D{{Key: "$substrCP", Value: bson.A{"$s", 1.5, int32(4)}}}, err: "$substrCP: starting index must be an integer, found double"},
+		// lengths
+		{expr: bson.D{{Key: "$strLenBytes", Value: "$s"}}, res: int32(13)},
+		{expr: bson.D{{Key: "$strLenCP", Value: "$s"}}, res: int32(11)},
+		{expr: bson.D{{Key: "$strLenCP", Value: "$x"}}, err: "$strLenCP requires a string argument, found: missing"},
+		// index
+		{expr: bson.D{{Key: "$indexOfBytes", Value: bson.A{"$s", "l"}}}, res: int32(3)},
+		{expr: bson.D{{Key: "$indexOfCP", Value: bson.A{"$s", "l"}}}, res: int32(2)},
+		{expr: bson.D{{Key: "$indexOfCP", Value: bson.A{"$s", "l", int32(5)}}}, res: int32(9)},
+		{expr: bson.D{{Key: "$indexOfCP", Value: bson.A{"$s", "l", int32(5), int32(8)}}}, res: int32(-1)},
+		{expr: bson.D{{Key: "$indexOfCP", Value: bson.A{"$s", "l", int32(8), int32(5)}}}, res: int32(-1)},
+		{expr: bson.D{{Key: "$indexOfBytes", Value: bson.A{"$n", "l"}}}, res: nil},
+		// split
+		{expr: bson.D{{Key: "$split", Value: bson.A{"a,b,,c", ","}}}, res: bson.A{"a", "b", "", "c"}},
+		{expr: bson.D{{Key: "$split", Value: bson.A{"$n", ","}}}, res: nil},
+		{expr: bson.D{{Key: "$split", Value: bson.A{"abc", ""}}}, err: "$split requires a non-empty separator"},
+		// trim
+		{expr: bson.D{{Key: "$trim", Value: bson.D{{Key: "input", Value: "$p"}}}}, res: "padded"},
+		{expr: bson.D{{Key: "$ltrim", Value: bson.D{{Key: "input", Value: "$p"}}}}, res: "padded\t"},
+		{expr: bson.D{{Key: "$rtrim", Value: bson.D{{Key: "input", Value: "xxaxx"}, {Key: "chars", Value: "x"}}}}, res: "xxa"},
+		{expr: bson.D{{Key: "$trim", Value: bson.D{{Key: "input", Value: "$n"}}}}, res: nil},
+		{expr: bson.D{{Key: "$trim", Value: bson.D{{Key: "foo", Value: "$n"}}}}, err: `$trim: unrecognized parameter "foo"`},
+		// replace
+		{expr: bson.D{{Key: "$replaceOne", Value: bson.D{{Key: "input", Value: "aaa"}, {Key: "find", Value: "a"}, {Key: "replacement", Value: "b"}}}}, res: "baa"},
+		{expr: bson.D{{Key: "$replaceAll", Value: bson.D{{Key: "input", Value: "aaa"}, {Key: "find", Value: "a"}, {Key: "replacement", Value: "b"}}}}, res: "bbb"},
+		{expr: bson.D{{Key: "$replaceAll", Value: bson.D{{Key: "input", Value: "$n"}, {Key: "find", Value: "a"}, {Key: "replacement", Value: "b"}}}}, res: nil},
+		{expr: bson.D{{Key: "$replaceAll", Value: bson.D{{Key: "input", Value: "$i"}, {Key: "find", Value: "a"}, {Key: "replacement", Value: "b"}}}}, err: "$replaceAll requires that 'input' be a string, found: int"},
+		// regex
+		{expr: bson.D{{Key: "$regexMatch", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "regex", Value: "^HÉ"}, {Key: "options", Value: "i"}}}}, res: true},
+		{expr: bson.D{{Key: "$regexMatch", Value: bson.D{{Key: "input", Value: "$n"}, {Key: "regex", Value: "a"}}}}, res: false},
+		{expr: bson.D{{Key: "$regexMatch", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "regex", Value: primitive.Regex{Pattern: "w ö # comment", Options: "x"}}}}}, res: true},
+		{expr: bson.D{{Key: "$regexFind", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "regex", Value: "w(ö)(x)?"}}}}, res: bson.D{
+			{Key: "match", Value: "wö"},
+			{Key: "idx", Value: int32(6)},
+			{Key: "captures", Value: bson.A{"ö", nil}},
+		}},
+		{expr: bson.D{{Key: "$regexFind", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "regex", Value: "z"}}}}, res: nil},
+		{expr: bson.D{{Key: "$regexFindAll", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "regex", Value: "l+"}}}}, res: bson.A{
+			bson.D{{Key: "match", Value: "ll"}, {Key: "idx", Value: int32(2)}, {Key: "captures", Value: bson.A{}}},
+			bson.D{{Key: "match", Value: "l"}, {Key: "idx", Value: int32(9)}, {Key: "captures", Value: bson.A{}}},
+		}},
+		{expr: bson.D{{Key: "$regexMatch", Value: bson.D{{Key: "input", Value: "$s"}, {Key: "regex", Value: "a"}, {Key: "options", Value: "q"}}}}, err: "$regexMatch: invalid flag in regex options: q"},
+	}
+
+	for _, item := range table {
+		res, err := Evaluate(doc, item.expr, nil)
+		if item.err != "" {
+			assert.Error(t, err, item.expr)
+			if err != nil {
+				assert.Equal(t, item.err, err.Error(), item.expr)
+			}
+		} else {
+			assert.NoError(t, err, item.expr)
+			assert.Equal(t, item.res, res, item.expr)
+		}
+	}
+}
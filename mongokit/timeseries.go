@@ -0,0 +1,366 @@
+package mongokit
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/btree"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// TimeSeriesConfig defines a time series collection configuration.
+type TimeSeriesConfig struct {
+	// The top-level field that holds the time of a measurement.
+	TimeField string
+
+	// The optional top-level field that describes the series.
+	MetaField string
+
+	// The granularity of the measurements: "seconds", "minutes" or "hours".
+	//
+	// Default: "seconds".
+	Granularity string
+}
+
+// Validate will validate the configuration.
+func (c TimeSeriesConfig) Validate() error {
+	// check time field
+	if c.TimeField == "" {
+		return fmt.Errorf("missing time field")
+	}
+
+	// check meta field
+	if c.MetaField == c.TimeField || c.MetaField == "_id" {
+		return fmt.Errorf("invalid meta field %q", c.MetaField)
+	}
+
+	// check granularity
+	switch c.Granularity {
+	case "", "seconds", "minutes", "hours":
+	default:
+		return fmt.Errorf("invalid granularity %q", c.Granularity)
+	}
+
+	return nil
+}
+
+// Span returns the time span covered by a single bucket.
+func (c TimeSeriesConfig) Span() time.Duration {
+	switch c.Granularity {
+	case "minutes":
+		return 24 * time.Hour
+	case "hours":
+		return 30 * 24 * time.Hour
+	default:
+		return time.Hour
+	}
+}
+
+type bucket struct {
+	start int64
+	docs  *bsonkit.Set
+	owner *bucketOwner
+}
+
+// bucketOwner identifies the buckets that may be modified in place. It is
+// marked shared atomically when the buckets are cloned as the original may be
+// part of a catalog that is read concurrently.
+type bucketOwner struct {
+	shared atomic.Bool
+}
+
+// Buckets groups the documents of a time series collection into buckets that
+// each cover a fixed time span. Queries on the time field only need to scan the
+// buckets that overlap the queried time range. The buckets are not safe from
+// concurrent access.
+//
+// Cloned buckets share the bucket sets with the original buckets. A bucket is
+// copied once when it is first modified after cloning and then modified in
+// place.
+type Buckets struct {
+	config TimeSeriesConfig
+	span   int64
+	tree   *btree.BTreeG[*bucket]
+	owner  *bucketOwner
+}
+
+// NewBuckets will create and return new buckets.
+func NewBuckets(config TimeSeriesConfig) (*Buckets, error) {
+	// validate config
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// set default granularity
+	if config.Granularity == "" {
+		config.Granularity = "seconds"
+	}
+
+	// create buckets
+	buckets := &Buckets{
+		config: config,
+		span:   config.Span().Milliseconds(),
+		tree: btree.NewBTreeG[*bucket](func(a, b *bucket) bool {
+			return a.start < b.start
+		}),
+		owner: &bucketOwner{},
+	}
+
+	return buckets, nil
+}
+
+// Config will return the time series configuration.
+func (b *Buckets) Config() TimeSeriesConfig {
+	return b.config
+}
+
+// Len will return the number of buckets.
+func (b *Buckets) Len() int {
+	return b.tree.Len()
+}
+
+// Add will add the document to its bucket. An error is returned if the time
+// field is missing or not a date.
+func (b *Buckets) Add(doc bsonkit.Doc) error {
+	// get start
+	start, err := b.start(doc)
+	if err != nil {
+		return err
+	}
+
+	// get bucket
+	item := b.bucket(start)
+
+	// add document
+	if !item.docs.Add(doc) {
+		return fmt.Errorf("document already added to bucket")
+	}
+
+	return nil
+}
+
+// AddList will add the documents to their buckets. The documents are grouped
+// per bucket to look up each bucket only once. An error is returned if the
+// time field of a document is missing or not a date, in which case no
+// document has been added.
+func (b *Buckets) AddList(list bsonkit.List) error {
+	// group documents
+	var starts []int64
+	groups := map[int64]bsonkit.List{}
+	for _, doc := range list {
+		start, err := b.start(doc)
+		if err != nil {
+			return err
+		}
+		if _, ok := groups[start]; !ok {
+			starts = append(starts, start)
+		}
+		groups[start] = append(groups[start], doc)
+	}
+
+	// add documents
+	for _, start := range starts {
+		item := b.bucket(start)
+		for _, doc := range groups[start] {
+			if !item.docs.Add(doc) {
+				return fmt.Errorf("document already added to bucket")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Remove will remove the document from its bucket. It may return false if the
+// document has not been added.
+func (b *Buckets) Remove(doc bsonkit.Doc) bool {
+	// get start
+	start, err := b.start(doc)
+	if err != nil {
+		return false
+	}
+
+	// get bucket
+	item, ok := b.tree.Get(&bucket{start: start})
+	if !ok || !item.docs.Has(doc) {
+		return false
+	}
+
+	// delete empty bucket
+	if len(item.docs.List) == 1 {
+		b.tree.Delete(item)
+		return true
+	}
+
+	// own bucket and remove document
+	item = b.own(item)
+	item.docs.Remove(doc)
+
+	return true
+}
+
+// Select will return the documents of all buckets that may contain documents
+// matching the time range constraints of the query.
+func (b *Buckets) Select(query bsonkit.Doc) bsonkit.List {
+	// get range
+	min, max := b.timeRange(query)
+
+	// collect documents
+	var list bsonkit.List
+	b.tree.Ascend(&bucket{start: min - b.span + 1}, func(item *bucket) bool {
+		if item.start > max {
+			return false
+		}
+		list = append(list, item.docs.List...)
+		return true
+	})
+
+	return list
+}
+
+// Clone will clone the buckets. Mutating the new buckets will not mutate the
+// original buckets.
+func (b *Buckets) Clone() *Buckets {
+	// mark owned buckets as shared
+	b.owner.shared.Store(true)
+
+	return &Buckets{
+		config: b.config,
+		span:   b.span,
+		tree:   b.tree.Copy(),
+		owner:  &bucketOwner{},
+	}
+}
+
+func (b *Buckets) bucket(start int64) *bucket {
+	// get existing bucket
+	item, ok := b.tree.Get(&bucket{start: start})
+	if ok {
+		return b.own(item)
+	}
+
+	// create bucket
+	item = &bucket{start: start, docs: bsonkit.NewSet(nil), owner: b.renew()}
+	b.tree.Set(item)
+
+	return item
+}
+
+func (b *Buckets) own(item *bucket) *bucket {
+	// check owner
+	if item.owner == b.renew() {
+		return item
+	}
+
+	// copy bucket
+	item = &bucket{start: item.start, docs: item.docs.Clone(), owner: b.owner}
+	b.tree.Set(item)
+
+	return item
+}
+
+func (b *Buckets) renew() *bucketOwner {
+	// renew owner if the owned buckets have been shared by a clone
+	if b.owner.shared.Load() {
+		b.owner = &bucketOwner{}
+	}
+
+	return b.owner
+}
+
+func (b *Buckets) start(doc bsonkit.Doc) (int64, error) {
+	// get time
+	dt, ok := bsonkit.Get(doc, b.config.TimeField).(primitive.DateTime)
+	if !ok {
+		return 0, fmt.Errorf("missing or invalid time field %q", b.config.TimeField)
+	}
+
+	// compute start
+	ms := int64(dt)
+	start := ms - ms%b.span
+	if ms%b.span < 0 {
+		start -= b.span
+	}
+
+	return start, nil
+}
+
+func (b *Buckets) timeRange(query bsonkit.Doc) (int64, int64) {
+	// prepare range
+	var min, max int64 = -1 << 63, 1<<63 - 1
+	if query == nil {
+		return min + b.span, max
+	}
+
+	// narrow range
+	var narrow func(doc bson.D)
+	narrow = func(doc bson.D) {
+		for _, e := range doc {
+			// handle conjunctions
+			if e.Key == "$and" {
+				arr, _ := e.Value.(bson.A)
+				for _, item := range arr {
+					if sub, ok := item.(bson.D); ok {
+						narrow(sub)
+					}
+				}
+				continue
+			}
+
+			// check field
+			if e.Key != b.config.TimeField {
+				continue
+			}
+
+			// handle equality
+			if dt, ok := e.Value.(primitive.DateTime); ok {
+				min, max = maxInt64(min, int64(dt)), minInt64(max, int64(dt))
+				continue
+			}
+
+			// handle operators
+			ops, _ := e.Value.(bson.D)
+			for _, op := range ops {
+				dt, ok := op.Value.(primitive.DateTime)
+				if !ok {
+					continue
+				}
+				switch op.Key {
+				case "$eq":
+					min, max = maxInt64(min, int64(dt)), minInt64(max, int64(dt))
+				case "$gt", "$gte":
+					min = maxInt64(min, int64(dt))
+				case "$lt", "$lte":
+					max = minInt64(max, int64(dt))
+				}
+			}
+		}
+	}
+	narrow(*query)
+
+	// prevent underflow
+	if min < -1<<63+b.span {
+		min = -1<<63 + b.span
+	}
+
+	return min, max
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
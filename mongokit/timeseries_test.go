@@ -0,0 +1,159 @@
+package mongokit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestTimeSeriesConfig(t *testing.T) {
+	assert.Error(t, TimeSeriesConfig{}.Validate())
+	assert.Error(t, TimeSeriesConfig{TimeField: "t", MetaField: "t"}.Validate())
+	assert.Error(t, TimeSeriesConfig{TimeField: "t", MetaField: "_id"}.Validate())
+	assert.Error(t, TimeSeriesConfig{TimeField: "t", Granularity: "days"}.Validate())
+	assert.NoError(t, TimeSeriesConfig{TimeField: "t", MetaField: "m", Granularity: "hours"}.Validate())
+
+	assert.Equal(t, time.Hour, TimeSeriesConfig{}.Span())
+	assert.Equal(t, 24*time.Hour, TimeSeriesConfig{Granularity: "minutes"}.Span())
+	assert.Equal(t, 30*24*time.Hour, TimeSeriesConfig{Granularity: "hours"}.Span())
+}
+
+func TestBuckets(t *testing.T) {
+	buckets, err := NewBuckets(TimeSeriesConfig{TimeField: "t"})
+	assert.NoError(t, err)
+	assert.Equal(t, "seconds", buckets.Config().Granularity)
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) primitive.DateTime {
+		return primitive.NewDateTimeFromTime(base.Add(d))
+	}
+
+	d1 := bsonkit.MustConvert(bson.M{"t": at(0)})
+	d2 := bsonkit.MustConvert(bson.M{"t": at(30 * time.Minute)})
+	d3 := bsonkit.MustConvert(bson.M{"t": at(90 * time.Minute)})
+	d4 := bsonkit.MustConvert(bson.M{"t": at(-time.Minute)})
+
+	list := bsonkit.List{d1, d2, d3, d4}
+	for _, doc := range list {
+		assert.NoError(t, buckets.Add(doc))
+	}
+	assert.Equal(t, 3, buckets.Len())
+
+	err = buckets.Add(bsonkit.MustConvert(bson.M{"t": "foo"}))
+	assert.Error(t, err)
+
+	assert.Equal(t, bsonkit.List{d4, d1, d2, d3}, buckets.Select(nil))
+	assert.Equal(t, bsonkit.List{d4, d1, d2, d3}, buckets.Select(bsonkit.MustConvert(bson.M{})))
+
+	assert.Equal(t, bsonkit.List{d1, d2}, buckets.Select(bsonkit.MustConvert(bson.M{
+		"t": bson.M{"$gte": at(0), "$lt": at(time.Hour - time.Millisecond)},
+	})))
+
+	assert.Equal(t, bsonkit.List{d1, d2, d3}, buckets.Select(bsonkit.MustConvert(bson.M{
+		"t": bson.M{"$gt": at(59 * time.Minute)},
+	})))
+
+	assert.Equal(t, bsonkit.List{d4}, buckets.Select(bsonkit.MustConvert(bson.M{
+		"$and": bson.A{
+			bson.M{"t": bson.M{"$lte": at(-time.Minute)}},
+		},
+	})))
+
+	assert.Equal(t, bsonkit.List{d3}, buckets.Select(bsonkit.MustConvert(bson.M{
+		"t": at(90 * time.Minute),
+	})))
+
+	clone := buckets.Clone()
+	assert.True(t, clone.Remove(d1))
+	assert.True(t, clone.Remove(d4))
+	assert.False(t, clone.Remove(d4))
+	assert.Equal(t, 2, clone.Len())
+	assert.Equal(t, bsonkit.List{d2, d3}, clone.Select(nil))
+	assert.Equal(t, 3, buckets.Len())
+	assert.Equal(t, bsonkit.List{d4, d1, d2, d3}, buckets.Select(nil))
+}
+
+func TestBucketsClone(t *testing.T) {
+	buckets, err := NewBuckets(TimeSeriesConfig{TimeField: "t"})
+	assert.NoError(t, err)
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) primitive.DateTime {
+		return primitive.NewDateTimeFromTime(base.Add(d))
+	}
+
+	d1 := bsonkit.MustConvert(bson.M{"t": at(0)})
+	d2 := bsonkit.MustConvert(bson.M{"t": at(10 * time.Minute)})
+	d3 := bsonkit.MustConvert(bson.M{"t": at(20 * time.Minute)})
+	d4 := bsonkit.MustConvert(bson.M{"t": at(90 * time.Minute)})
+
+	err = buckets.AddList(bsonkit.List{d1, d4, d2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, buckets.Len())
+
+	err = buckets.AddList(bsonkit.List{d3, bsonkit.MustConvert(bson.M{"t": "foo"})})
+	assert.Error(t, err)
+	assert.Equal(t, bsonkit.List{d1, d2, d4}, buckets.Select(nil))
+
+	clone := buckets.Clone()
+	get := func() *bucket {
+		item, ok := clone.tree.Get(&bucket{start: base.UnixMilli()})
+		assert.True(t, ok)
+		return item
+	}
+	shared := get()
+
+	assert.NoError(t, clone.Add(d3))
+	owned := get()
+	assert.NotSame(t, shared, owned)
+
+	assert.True(t, clone.Remove(d2))
+	assert.Same(t, owned, get())
+
+	assert.Equal(t, bsonkit.List{d1, d3, d4}, clone.Select(nil))
+	assert.Equal(t, bsonkit.List{d1, d2, d4}, buckets.Select(nil))
+
+	assert.True(t, buckets.Remove(d1))
+	assert.Equal(t, bsonkit.List{d2, d4}, buckets.Select(nil))
+	assert.Equal(t, bsonkit.List{d1, d3, d4}, clone.Select(nil))
+
+	clone2 := clone.Clone()
+	assert.NoError(t, clone.Add(d2))
+	assert.Equal(t, bsonkit.List{d1, d3, d2, d4}, clone.Select(nil))
+	assert.Equal(t, bsonkit.List{d1, d3, d4}, clone2.Select(nil))
+}
+
+func TestTimeSeriesCollection(t *testing.T) {
+	coll, err := NewTimeSeriesCollection(TimeSeriesConfig{TimeField: "t"})
+	assert.NoError(t, err)
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	_, err = coll.Insert(bsonkit.MustConvert(bson.M{"t": now, "v": 1}))
+	assert.NoError(t, err)
+
+	_, err = coll.Insert(bsonkit.MustConvert(bson.M{"v": 2}))
+	assert.Error(t, err)
+
+	res, err := coll.Find(context.Background(), bsonkit.MustConvert(bson.M{"t": bson.M{"$gte": now}}), nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res.Matched, 1)
+
+	_, err = coll.Update(context.Background(), bsonkit.MustConvert(bson.M{}), bsonkit.MustConvert(bson.M{
+		"$set": bson.M{"v": 3},
+	}), nil, 0, 0, nil)
+	assert.Error(t, err)
+
+	clone := coll.Clone()
+	res, err = clone.Delete(context.Background(), bsonkit.MustConvert(bson.M{"v": 1}), nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res.Matched, 1)
+	assert.Equal(t, 0, clone.Buckets.Len())
+	assert.Equal(t, 1, coll.Buckets.Len())
+}
@@ -0,0 +1,157 @@
+package mongokit
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// Validation describes the result of validating a collection.
+type Validation struct {
+	// The number of documents.
+	Records int
+
+	// The validation of every index.
+	Indexes map[string]IndexValidation
+
+	// The detected inconsistencies.
+	Errors []string
+}
+
+// IndexValidation describes the result of validating an index.
+type IndexValidation struct {
+	// The number of index entries.
+	Keys int
+
+	// Whether no inconsistencies have been detected.
+	Valid bool
+}
+
+// Validate will verify the internal invariants of the collection. It checks
+// that the size matches the documents, that _id values are unique, that every
+// index entry references a stored document, that every document that should
+// be indexed has an index entry and that index entries are ordered by key.
+func (c *Collection) Validate() *Validation {
+	// prepare validation
+	validation := &Validation{
+		Records: len(c.Documents.List),
+		Indexes: map[string]IndexValidation{},
+	}
+
+	// check size
+	size := bsonkit.SizeList(c.Documents.List)
+	if c.Size != size {
+		validation.Errors = append(validation.Errors, fmt.Sprintf("collection size is %d bytes but documents have %d bytes", c.Size, size))
+	}
+
+	// check _id uniqueness of regular collections
+	if c.Buckets == nil {
+		list := append(bsonkit.List(nil), c.Documents.List...)
+		columns := []bsonkit.Column{{Path: "_id"}}
+		bsonkit.Sort(list, columns, false)
+		for i := 1; i < len(list); i++ {
+			if bsonkit.Order(list[i-1], list[i], columns, false) == 0 {
+				validation.Errors = append(validation.Errors, fmt.Sprintf("duplicate _id %v", bsonkit.Get(list[i], "_id")))
+			}
+		}
+	}
+
+	// sort index names
+	names := make([]string, 0, len(c.Indexes))
+	for name := range c.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// check indexes
+	for _, name := range names {
+		errs := c.Indexes[name].validate(name, c.Documents)
+		validation.Indexes[name] = IndexValidation{
+			Keys:  c.Indexes[name].Len(),
+			Valid: len(errs) == 0,
+		}
+		validation.Errors = append(validation.Errors, errs...)
+	}
+
+	return validation
+}
+
+func (i *Index) validate(name string, documents *bsonkit.Set) []string {
+	// prepare errors
+	var errs []string
+
+	// check entries
+	entries := map[bsonkit.Doc]bool{}
+	var prev bsonkit.Doc
+	for _, entry := range i.base.List() {
+		// check order
+		if prev != nil && bsonkit.Order(prev, entry, i.columns, false) > 0 {
+			errs = append(errs, fmt.Sprintf("index %q is not ordered at _id %v", name, bsonkit.Get(entry, "_id")))
+		}
+		prev = entry
+
+		// check duplicates
+		if entries[entry] {
+			errs = append(errs, fmt.Sprintf("index %q has duplicate entry for _id %v", name, bsonkit.Get(entry, "_id")))
+		}
+		entries[entry] = true
+
+		// check document
+		doc, ok := documents.Get(entry)
+		if !ok || doc != entry {
+			errs = append(errs, fmt.Sprintf("index %q has extra entry for _id %v", name, bsonkit.Get(entry, "_id")))
+			continue
+		}
+
+		// check filter
+		ok, err := i.indexed(entry)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("index %q failed to match _id %v: %s", name, bsonkit.Get(entry, "_id"), err.Error()))
+		} else if !ok {
+			errs = append(errs, fmt.Sprintf("index %q has entry for unindexed _id %v", name, bsonkit.Get(entry, "_id")))
+		}
+	}
+
+	// check documents
+	for _, doc := range documents.List {
+		ok, err := i.indexed(doc)
+		if err == nil && ok && !entries[doc] {
+			errs = append(errs, fmt.Sprintf("index %q is missing entry for _id %v", name, bsonkit.Get(doc, "_id")))
+		}
+	}
+
+	return errs
+}
+
+// Rebuild will return a copy of the collection with indexes that have been
+// rebuilt from the documents and a size that has been recalculated. It may be
+// used to repair collections that failed validation.
+func (c *Collection) Rebuild() (*Collection, error) {
+	// create new collection
+	clone := &Collection{
+		Documents: c.Documents.Clone(),
+		Indexes:   map[string]*Index{},
+		Size:      bsonkit.SizeList(c.Documents.List),
+		PreImages: c.PreImages,
+	}
+
+	// rebuild indexes
+	for name, index := range c.Indexes {
+		rebuilt := index.empty()
+		ok, err := rebuilt.Build(c.Documents.List)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, fmt.Errorf("duplicate document for index %q", name)
+		}
+		clone.Indexes[name] = rebuilt
+	}
+
+	// clone buckets
+	if c.Buckets != nil {
+		clone.Buckets = c.Buckets.Clone()
+	}
+
+	return clone, nil
+}
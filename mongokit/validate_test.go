@@ -0,0 +1,84 @@
+package mongokit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestCollectionValidate(t *testing.T) {
+	coll := NewCollection(true)
+
+	for i := 0; i < 3; i++ {
+		_, err := coll.Insert(bsonkit.MustConvert(bson.M{"_id": int32(i), "n": int32(i)}))
+		assert.NoError(t, err)
+	}
+
+	_, err := coll.CreateIndex(context.Background(), "n", IndexConfig{
+		Key:     bsonkit.MustConvert(bson.M{"n": int32(1)}),
+		Partial: bsonkit.MustConvert(bson.M{"n": bson.M{"$gt": int32(0)}}),
+	})
+	assert.NoError(t, err)
+
+	// valid
+	assert.Equal(t, &Validation{
+		Records: 3,
+		Indexes: map[string]IndexValidation{
+			"_id_": {Keys: 3, Valid: true},
+			"n":    {Keys: 2, Valid: true},
+		},
+	}, coll.Validate())
+
+	// missing entry
+	doc := coll.Documents.List[1]
+	coll.Indexes["n"].base.Remove(doc)
+	validation := coll.Validate()
+	assert.False(t, validation.Indexes["n"].Valid)
+	assert.True(t, validation.Indexes["_id_"].Valid)
+	assert.Equal(t, []string{`index "n" is missing entry for _id 1`}, validation.Errors)
+	coll.Indexes["n"].base.Add(doc)
+
+	// extra entry
+	extra := bsonkit.MustConvert(bson.M{"_id": int32(7), "n": int32(7)})
+	coll.Indexes["n"].base.Add(extra)
+	validation = coll.Validate()
+	assert.Equal(t, []string{`index "n" has extra entry for _id 7`}, validation.Errors)
+	coll.Indexes["n"].base.Remove(extra)
+
+	// unindexed entry
+	coll.Indexes["n"].base.Add(coll.Documents.List[0])
+	validation = coll.Validate()
+	assert.Equal(t, []string{`index "n" has entry for unindexed _id 0`}, validation.Errors)
+	coll.Indexes["n"].base.Remove(coll.Documents.List[0])
+
+	// mutated document
+	(*coll.Documents.List[2])[1].Value = int32(-1)
+	validation = coll.Validate()
+	assert.Equal(t, []string{
+		`index "n" is not ordered at _id 2`,
+		`index "n" has entry for unindexed _id 2`,
+	}, validation.Errors)
+	(*coll.Documents.List[2])[1].Value = int32(2)
+
+	// size
+	coll.Size++
+	validation = coll.Validate()
+	assert.Len(t, validation.Errors, 1)
+	assert.True(t, validation.Indexes["n"].Valid)
+	coll.Size--
+
+	assert.Empty(t, coll.Validate().Errors)
+
+	// rebuild
+	coll.Indexes["n"].base.Remove(coll.Documents.List[1])
+	coll.Size = 0
+	assert.Len(t, coll.Validate().Errors, 2)
+	rebuilt, err := coll.Rebuild()
+	assert.NoError(t, err)
+	assert.Empty(t, rebuilt.Validate().Errors)
+	assert.Len(t, coll.Validate().Errors, 2)
+}
@@ -0,0 +1,190 @@
+package mongokit
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// EvaluateVariables will evaluate the specified let document to a map of
+// variables. The values may be constants or expressions that do not reference
+// any document fields.
+func EvaluateVariables(let bsonkit.Doc) (map[string]interface{}, error) {
+	// prepare variables
+	variables := make(map[string]interface{}, len(*let))
+
+	// evaluate variables
+	scope := NewScope(&bson.D{}, nil)
+	for _, field := range *let {
+		// check name
+		err := validateVariable("let", field.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		// evaluate value
+		value, err := scope.Evaluate(field.Value)
+		if err != nil {
+			return nil, err
+		} else if value == bsonkit.Missing {
+			value = nil
+		}
+
+		variables[field.Key] = value
+	}
+
+	return variables, nil
+}
+
+// BindVariables will return a copy of the query in which all references to
+// the specified variables in $expr expressions are replaced by their values.
+// Variables that are shadowed by $let, $map, $filter or $reduce expressions
+// are left untouched.
+func BindVariables(query bsonkit.Doc, variables map[string]interface{}) bsonkit.Doc {
+	// check variables
+	if len(variables) == 0 {
+		return query
+	}
+
+	// bind query
+	res := bindQuery(*query, variables)
+
+	return &res
+}
+
+func bindQuery(query bson.D, variables map[string]interface{}) bson.D {
+	res := make(bson.D, 0, len(query))
+	for _, field := range query {
+		switch field.Key {
+		case "$expr":
+			field.Value = bindExpression(field.Value, variables)
+		case "$and", "$or", "$nor":
+			if array, ok := field.Value.(bson.A); ok {
+				list := make(bson.A, 0, len(array))
+				for _, item := range array {
+					if doc, ok := item.(bson.D); ok {
+						item = bindQuery(doc, variables)
+					}
+					list = append(list, item)
+				}
+				field.Value = list
+			}
+		}
+		res = append(res, field)
+	}
+
+	return res
+}
+
+func bindExpression(expr interface{}, variables map[string]interface{}) interface{} {
+	switch expr := expr.(type) {
+	case string:
+		// check variable
+		if !strings.HasPrefix(expr, "$$") {
+			return expr
+		}
+
+		// split name and path
+		name, path := expr[2:], ""
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name, path = name[:i], name[i+1:]
+		}
+
+		// get value
+		value, ok := variables[name]
+		if !ok {
+			return expr
+		}
+
+		// resolve path
+		if path != "" {
+			value = fieldPath(value, path)
+			if value == bsonkit.Missing {
+				return "$$REMOVE"
+			}
+		}
+
+		return bson.D{{Key: "$literal", Value: value}}
+	case bson.A:
+		res := make(bson.A, 0, len(expr))
+		for _, item := range expr {
+			res = append(res, bindExpression(item, variables))
+		}
+		return res
+	case bson.D:
+		// handle operators
+		if len(expr) == 1 {
+			switch expr[0].Key {
+			case "$literal":
+				return expr
+			case "$let", "$map", "$filter", "$reduce":
+				if params, ok := expr[0].Value.(bson.D); ok {
+					return bson.D{{Key: expr[0].Key, Value: bindScoped(expr[0].Key, params, variables)}}
+				}
+			}
+		}
+
+		// bind fields
+		res := make(bson.D, 0, len(expr))
+		for _, field := range expr {
+			res = append(res, bson.E{Key: field.Key, Value: bindExpression(field.Value, variables)})
+		}
+		return res
+	default:
+		return expr
+	}
+}
+
+func bindScoped(op string, params bson.D, variables map[string]interface{}) bson.D {
+	// collect shadowed variables
+	var shadowed []string
+	switch op {
+	case "$let":
+		for _, field := range params {
+			if vars, ok := field.Value.(bson.D); ok && field.Key == "vars" {
+				for _, v := range vars {
+					shadowed = append(shadowed, v.Key)
+				}
+			}
+		}
+	case "$map", "$filter":
+		name := "this"
+		for _, field := range params {
+			if as, ok := field.Value.(string); ok && field.Key == "as" {
+				name = as
+			}
+		}
+		shadowed = append(shadowed, name)
+	case "$reduce":
+		shadowed = append(shadowed, "this", "value")
+	}
+
+	// prepare inner variables
+	inner := make(map[string]interface{}, len(variables))
+	for name, value := range variables {
+		inner[name] = value
+	}
+	for _, name := range shadowed {
+		delete(inner, name)
+	}
+
+	// bind parameters
+	res := make(bson.D, 0, len(params))
+	for _, field := range params {
+		switch field.Key {
+		case "in", "cond":
+			field.Value = bindExpression(field.Value, inner)
+		case "vars":
+			if vars, ok := field.Value.(bson.D); ok {
+				field.Value = bindExpression(vars, variables)
+			}
+		default:
+			field.Value = bindExpression(field.Value, variables)
+		}
+		res = append(res, field)
+	}
+
+	return res
+}
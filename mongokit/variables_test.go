@@ -0,0 +1,112 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestEvaluateVariables(t *testing.T) {
+	vars, err := EvaluateVariables(bsonkit.MustConvert(bson.D{
+		{Key: "a", Value: int32(1)},
+		{Key: "b", Value: bson.D{{Key: "$add", Value: bson.A{int32(1), int32(2)}}}},
+		{Key: "c", Value: "$$REMOVE"},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": int32(1),
+		"b": int32(3),
+		"c": nil,
+	}, vars)
+
+	_, err = EvaluateVariables(bsonkit.MustConvert(bson.D{
+		{Key: "A", Value: int32(1)},
+	}))
+	assert.Error(t, err)
+	assert.Equal(t, `let: "A" starts with an invalid character for a user variable name`, err.Error())
+
+	_, err = EvaluateVariables(bsonkit.MustConvert(bson.D{
+		{Key: "a", Value: "$$b"},
+	}))
+	assert.Error(t, err)
+	assert.Equal(t, "use of undefined variable: b", err.Error())
+}
+
+func TestBindVariables(t *testing.T) {
+	vars := map[string]interface{}{
+		"x": int32(7),
+		"y": bson.D{{Key: "z", Value: "$a"}},
+	}
+
+	table := []struct {
+		query bson.D
+		res   bson.D
+	}{
+		// plain queries
+		{
+			query: bson.D{{Key: "a", Value: "$$x"}},
+			res:   bson.D{{Key: "a", Value: "$$x"}},
+		},
+		// expressions
+		{
+			query: bson.D{{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$a", "$$x"}}}}},
+			res: bson.D{{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{
+				"$a",
+				bson.D{{Key: "$literal", Value: int32(7)}},
+			}}}}},
+		},
+		// paths
+		{
+			query: bson.D{{Key: "$expr", Value: bson.A{"$$y.z", "$$y.q", "$$NOW"}}},
+			res: bson.D{{Key: "$expr", Value: bson.A{
+				bson.D{{Key: "$literal", Value: "$a"}},
+				"$$REMOVE",
+				"$$NOW",
+			}}},
+		},
+		// nested queries
+		{
+			query: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "$expr", Value: "$$x"}},
+			}}},
+			res: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "$expr", Value: bson.D{{Key: "$literal", Value: int32(7)}}}},
+			}}},
+		},
+		// shadowing
+		{
+			query: bson.D{{Key: "$expr", Value: bson.D{{Key: "$map", Value: bson.D{
+				{Key: "input", Value: "$$x"},
+				{Key: "as", Value: "x"},
+				{Key: "in", Value: "$$x"},
+			}}}}},
+			res: bson.D{{Key: "$expr", Value: bson.D{{Key: "$map", Value: bson.D{
+				{Key: "input", Value: bson.D{{Key: "$literal", Value: int32(7)}}},
+				{Key: "as", Value: "x"},
+				{Key: "in", Value: "$$x"},
+			}}}}},
+		},
+		{
+			query: bson.D{{Key: "$expr", Value: bson.D{{Key: "$let", Value: bson.D{
+				{Key: "vars", Value: bson.D{{Key: "x", Value: "$$x"}}},
+				{Key: "in", Value: "$$x"},
+			}}}}},
+			res: bson.D{{Key: "$expr", Value: bson.D{{Key: "$let", Value: bson.D{
+				{Key: "vars", Value: bson.D{{Key: "x", Value: bson.D{{Key: "$literal", Value: int32(7)}}}}},
+				{Key: "in", Value: "$$x"},
+			}}}}},
+		},
+	}
+
+	for _, item := range table {
+		res := BindVariables(&item.query, vars)
+		assert.Equal(t, &item.res, res, item.query)
+	}
+
+	// without variables
+	query := &bson.D{{Key: "$expr", Value: "$$x"}}
+	assert.True(t, query == BindVariables(query, nil))
+}
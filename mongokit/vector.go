@@ -0,0 +1,178 @@
+package mongokit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func init() {
+	// register vector search stage
+	AggregationStages["$vectorSearch"] = stageVectorSearch
+}
+
+func stageVectorSearch(ctx *AggregationContext, list bsonkit.List, arg interface{}) (bsonkit.List, error) {
+	// get parameters
+	params, err := getParameters("$vectorSearch", arg, []string{"path", "queryVector", "limit"}, "index", "numCandidates", "filter", "exact", "similarity")
+	if err != nil {
+		return nil, err
+	}
+
+	// get path
+	path, ok := params["path"].(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("$vectorSearch: expected path to be a non-empty string")
+	}
+
+	// get query vector
+	query, ok := toVector(params["queryVector"])
+	if !ok || len(query) == 0 {
+		return nil, fmt.Errorf("$vectorSearch: expected queryVector to be a non-empty array of numbers")
+	}
+
+	// get limit
+	limit, ok := toInt64(params["limit"])
+	if !ok || limit <= 0 {
+		return nil, fmt.Errorf("$vectorSearch: expected limit to be a positive number")
+	}
+
+	// get exact
+	var exact bool
+	if value, ok := params["exact"]; ok {
+		exact, ok = value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("$vectorSearch: expected exact to be a boolean")
+		}
+	}
+
+	// check candidates, approximate searches are run exhaustively
+	if !exact {
+		candidates, ok := toInt64(params["numCandidates"])
+		if !ok || candidates < limit {
+			return nil, fmt.Errorf("$vectorSearch: expected numCandidates to be a number greater than or equal to limit")
+		}
+	} else if _, ok := params["numCandidates"]; ok {
+		return nil, fmt.Errorf("$vectorSearch: numCandidates is not allowed for exact searches")
+	}
+
+	// get similarity, which is configured by the search index in Atlas
+	similarity := "cosine"
+	if value, ok := params["similarity"]; ok {
+		similarity, _ = value.(string)
+	}
+	var score func(a, b []float64) float64
+	switch similarity {
+	case "cosine":
+		score = cosineScore
+	case "dotProduct":
+		score = dotProductScore
+	case "euclidean":
+		score = euclideanScore
+	default:
+		return nil, fmt.Errorf("$vectorSearch: unsupported similarity %v", params["similarity"])
+	}
+
+	// filter documents
+	if filter, ok := params["filter"]; ok {
+		query, ok := filter.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("$vectorSearch: expected filter to be a document")
+		}
+		list, err = Filter(list, BindVariables(&query, ctx.Variables), 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// score documents
+	type match struct {
+		doc   bsonkit.Doc
+		score float64
+	}
+	var matches []match
+	for _, doc := range list {
+		vector, ok := toVector(bsonkit.Get(doc, path))
+		if !ok || len(vector) != len(query) {
+			continue
+		}
+		matches = append(matches, match{doc: doc, score: score(query, vector)})
+	}
+
+	// sort matches by score
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	// apply limit
+	if int64(len(matches)) > limit {
+		matches = matches[:limit]
+	}
+
+	// collect documents
+	result := make(bsonkit.List, 0, len(matches))
+	for _, match := range matches {
+		ctx.setMeta(match.doc, "vectorSearchScore", match.score)
+		result = append(result, match.doc)
+	}
+
+	return result, nil
+}
+
+func toVector(value interface{}) ([]float64, bool) {
+	// check array
+	array, ok := value.(bson.A)
+	if !ok {
+		return nil, false
+	}
+
+	// convert numbers
+	vector := make([]float64, 0, len(array))
+	for _, item := range array {
+		switch num := item.(type) {
+		case float64:
+			vector = append(vector, num)
+		case int32:
+			vector = append(vector, float64(num))
+		case int64:
+			vector = append(vector, float64(num))
+		default:
+			return nil, false
+		}
+	}
+
+	return vector, true
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func cosineScore(a, b []float64) float64 {
+	// handle zero vectors
+	norm := math.Sqrt(dot(a, a)) * math.Sqrt(dot(b, b))
+	if norm == 0 {
+		return 0.5
+	}
+
+	return (1 + dot(a, b)/norm) / 2
+}
+
+func dotProductScore(a, b []float64) float64 {
+	return (1 + dot(a, b)) / 2
+}
+
+func euclideanScore(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return 1 / (1 + math.Sqrt(sum))
+}
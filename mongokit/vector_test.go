@@ -0,0 +1,124 @@
+package mongokit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func vectorSearchTest(t *testing.T, search bson.D, extra ...bson.D) (bsonkit.List, error) {
+	list := bsonkit.List{
+		{{Key: "_id", Value: int32(1)}, {Key: "kind", Value: "a"}, {Key: "v", Value: bson.A{1.0, 0.0}}},
+		{{Key: "_id", Value: int32(2)}, {Key: "kind", Value: "b"}, {Key: "v", Value: bson.A{0.0, 1.0}}},
+		{{Key: "_id", Value: int32(3)}, {Key: "kind", Value: "a"}, {Key: "v", Value: bson.A{int32(2), int32(2)}}},
+		{{Key: "_id", Value: int32(4)}, {Key: "kind", Value: "b"}, {Key: "v", Value: bson.A{3.0, 0.5}}},
+		{{Key: "_id", Value: int32(5)}, {Key: "v", Value: bson.A{1.0}}},
+		{{Key: "_id", Value: int32(6)}, {Key: "v", Value: "foo"}},
+		{{Key: "_id", Value: int32(7)}},
+	}
+
+	pipeline := bsonkit.List{{{Key: "$vectorSearch", Value: search}}}
+	for i := range extra {
+		pipeline = append(pipeline, &extra[i])
+	}
+
+	return Aggregate(nil, list, pipeline)
+}
+
+func TestAggregateVectorSearch(t *testing.T) {
+	// cosine
+	res, err := vectorSearchTest(t, bson.D{
+		{Key: "index", Value: "vector"},
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{1.0, 0.1}},
+		{Key: "numCandidates", Value: int32(10)},
+		{Key: "limit", Value: int32(3)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(4), int32(1), int32(3)}, searchIDs(res))
+
+	// dot product
+	res, err = vectorSearchTest(t, bson.D{
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{1.0, 0.1}},
+		{Key: "exact", Value: true},
+		{Key: "limit", Value: int32(2)},
+		{Key: "similarity", Value: "dotProduct"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(4), int32(3)}, searchIDs(res))
+
+	// euclidean
+	res, err = vectorSearchTest(t, bson.D{
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{0.0, 0.9}},
+		{Key: "exact", Value: true},
+		{Key: "limit", Value: int32(10)},
+		{Key: "similarity", Value: "euclidean"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(2), int32(1), int32(3), int32(4)}, searchIDs(res))
+
+	// filter
+	res, err = vectorSearchTest(t, bson.D{
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{1.0, 0.1}},
+		{Key: "numCandidates", Value: int32(10)},
+		{Key: "limit", Value: int32(3)},
+		{Key: "filter", Value: bson.D{{Key: "kind", Value: "a"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1), int32(3)}, searchIDs(res))
+
+	// errors
+	_, err = vectorSearchTest(t, bson.D{
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{1.0, 0.1}},
+		{Key: "limit", Value: int32(3)},
+	})
+	assert.Error(t, err)
+	_, err = vectorSearchTest(t, bson.D{
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{1.0, 0.1}},
+		{Key: "numCandidates", Value: int32(2)},
+		{Key: "limit", Value: int32(3)},
+	})
+	assert.Error(t, err)
+	_, err = vectorSearchTest(t, bson.D{
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{"foo"}},
+		{Key: "exact", Value: true},
+		{Key: "limit", Value: int32(3)},
+	})
+	assert.Error(t, err)
+	_, err = vectorSearchTest(t, bson.D{
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{1.0, 0.1}},
+		{Key: "exact", Value: true},
+		{Key: "limit", Value: int32(3)},
+		{Key: "similarity", Value: "manhattan"},
+	})
+	assert.Error(t, err)
+}
+
+func TestAggregateVectorSearchScore(t *testing.T) {
+	res, err := vectorSearchTest(t, bson.D{
+		{Key: "path", Value: "v"},
+		{Key: "queryVector", Value: bson.A{1.0, 0.0}},
+		{Key: "exact", Value: true},
+		{Key: "limit", Value: int32(2)},
+	}, bson.D{
+		{Key: "$project", Value: bson.D{
+			{Key: "score", Value: bson.D{{Key: "$meta", Value: "vectorSearchScore"}}},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bsonkit.List{
+		{{Key: "_id", Value: int32(1)}, {Key: "score", Value: 1.0}},
+		{{Key: "_id", Value: int32(4)}, {Key: "score", Value: bsonkit.Get(res[1], "score")}},
+	}, res)
+	assert.InDelta(t, 0.993, bsonkit.Get(res[1], "score"), 0.001)
+}
@@ -0,0 +1,105 @@
+package lungo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// CommandEvent is emitted by collections for every started operation if a
+// monitor has been configured using the engine options.
+type CommandEvent struct {
+	// The name of the command e.g. "find", "insert", "update", "delete",
+	// "findAndModify", "aggregate", "count", "distinct" or "bulkWrite".
+	Command string
+
+	// The handle of the namespace.
+	Handle Handle
+
+	// The comment specified using the Comment option or the $comment query
+	// operator. The option takes precedence over the query operator.
+	Comment interface{}
+
+	// The logical session ID (lsid) of the explicit session in the context or
+	// the implicit session that has been checked out for the operation.
+	SessionID bson.Raw
+}
+
+func (c *Collection) monitor(ctx context.Context, command string, comment interface{}, query bsonkit.Doc) (context.Context, func()) {
+	// track usage of ephemeral namespaces
+	c.engine.touchEphemeral(c.handle)
+
+	// get start
+	start := time.Now()
+
+	// get monitor and threshold
+	monitor := c.engine.opts.Monitor
+	threshold := c.engine.opts.SlowOperationThreshold
+
+	// get comment from option
+	if str, ok := comment.(*string); ok {
+		comment = nil
+		if str != nil {
+			comment = *str
+		}
+	}
+
+	// get comment from query
+	if comment == nil && query != nil {
+		for _, field := range *query {
+			if field.Key == "$comment" {
+				comment = field.Value
+			}
+		}
+	}
+
+	// get explicit session or check out implicit session if monitored
+	var lsid bson.Raw
+	release := func() {}
+	if sess, ok := ensureContext(ctx).Value(sessionKey{}).(*Session); ok {
+		lsid = sess.ID()
+	} else if monitor != nil || threshold > 0 {
+		lsid = c.engine.acquireSession()
+		release = func() {
+			c.engine.releaseSession(lsid)
+		}
+	}
+
+	// track operation
+	ctx, id := c.engine.trackOperation(ctx, OperationInfo{
+		Command:   command,
+		Namespace: c.handle.String(),
+		Query:     query,
+		Comment:   comment,
+		SessionID: lsid,
+		Started:   start,
+	})
+
+	// emit event
+	if monitor != nil {
+		monitor(CommandEvent{
+			Command:   command,
+			Handle:    c.handle,
+			Comment:   comment,
+			SessionID: lsid,
+		})
+	}
+
+	return ctx, func() {
+		// untrack operation and release session
+		c.engine.untrackOperation(id)
+		release()
+
+		// record duration
+		duration := time.Since(start)
+		c.engine.diagnostics.recordOperation(c.handle, command, duration)
+
+		// log slow operation
+		if threshold > 0 && duration >= threshold {
+			c.engine.log(LogWarn, "slow operation", "command", command, "ns", c.handle.String(), "duration", duration, "comment", comment, "lsid", formatSessionID(lsid))
+		}
+	}
+}
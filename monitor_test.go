@@ -0,0 +1,66 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMonitor(t *testing.T) {
+	var events []CommandEvent
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+		Monitor: func(event CommandEvent) {
+			events = append(events, event)
+		},
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	_, err = coll.InsertOne(nil, bson.M{"a": 1}, options.InsertOne().SetComment("insert"))
+	assert.NoError(t, err)
+
+	_, err = coll.Find(nil, bson.M{"a": 1}, options.Find().SetComment("find"))
+	assert.NoError(t, err)
+
+	_, err = coll.UpdateOne(nil, bson.M{"a": 1, "$comment": "query"}, bson.M{"$set": bson.M{"b": 2}})
+	assert.NoError(t, err)
+
+	_, err = coll.DeleteMany(nil, bson.M{"$comment": "query"}, options.Delete().SetComment(bson.M{"caller": "test"}))
+	assert.NoError(t, err)
+
+	_, err = coll.Aggregate(nil, bson.A{}, options.Aggregate().SetComment("aggregate"))
+	assert.NoError(t, err)
+
+	_, err = coll.CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+
+	lsid := events[0].SessionID
+	assert.NotEmpty(t, lsid)
+
+	handle := Handle{"foo", "bar"}
+	assert.Equal(t, []CommandEvent{
+		{Command: "insert", Handle: handle, Comment: "insert", SessionID: lsid},
+		{Command: "find", Handle: handle, Comment: "find", SessionID: lsid},
+		{Command: "update", Handle: handle, Comment: "query", SessionID: lsid},
+		{Command: "delete", Handle: handle, Comment: bson.M{"caller": "test"}, SessionID: lsid},
+		{Command: "aggregate", Handle: handle, Comment: "aggregate", SessionID: lsid},
+		{Command: "count", Handle: handle, SessionID: lsid},
+	}, events)
+
+	sess, err := client.StartSession()
+	assert.NoError(t, err)
+
+	err = WithSession(nil, sess, func(sc ISessionContext) error {
+		_, err := coll.InsertOne(sc, bson.M{"a": 2})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, sess.ID(), events[6].SessionID)
+
+	sess.EndSession(nil)
+}
@@ -0,0 +1,205 @@
+package lungo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// ErrMultiEngine is returned by methods of a MultiClient that would span
+// multiple engines.
+var ErrMultiEngine = errors.New("operation spans multiple engines")
+
+var _ IClient = &MultiClient{}
+
+// MultiClient routes every database to one of multiple isolated engines based
+// on a hash of its name. It allows tests that run in parallel within the same
+// process to use separate databases without contending on a single engine.
+type MultiClient struct {
+	engines []*Engine
+	clients []*Client
+}
+
+// OpenMulti will create n engines that each use a new memory store and return
+// a client that routes databases to them. The store of the provided options is
+// ignored, all other options are used for every engine.
+func OpenMulti(_ context.Context, n int, opts Options) (*MultiClient, []*Engine, error) {
+	// check count
+	if n < 1 {
+		return nil, nil, fmt.Errorf("invalid engine count %d", n)
+	}
+
+	// create engines
+	client := &MultiClient{}
+	for i := 0; i < n; i++ {
+		// set store
+		opts.Store = NewMemoryStore()
+
+		// create engine
+		engine, err := CreateEngine(opts)
+		if err != nil {
+			for _, engine := range client.engines {
+				engine.Close()
+			}
+			return nil, nil, err
+		}
+
+		// add engine
+		client.engines = append(client.engines, engine)
+		client.clients = append(client.clients, NewClient(engine).(*Client))
+	}
+
+	return client, client.engines, nil
+}
+
+// Engine will return the engine that is used for the specified database.
+func (c *MultiClient) Engine(database string) *Engine {
+	return c.engines[c.index(database)]
+}
+
+// Client will return a client for the engine that is used for the specified
+// database. In contrast to the multi client, it supports sessions and change
+// streams for all databases of the engine.
+func (c *MultiClient) Client(database string) IClient {
+	return c.clients[c.index(database)]
+}
+
+// Connect implements the IClient.Connect method.
+func (c *MultiClient) Connect(context.Context) error {
+	return nil
+}
+
+// Database implements the IClient.Database method.
+func (c *MultiClient) Database(name string, opts ...*options.DatabaseOptions) IDatabase {
+	return c.Client(name).Database(name, opts...)
+}
+
+// Disconnect implements the IClient.Disconnect method. It closes all engines
+// used by the client and returns the first error from closing their stores.
+func (c *MultiClient) Disconnect(context.Context) error {
+	// close engines
+	var firstErr error
+	for _, engine := range c.engines {
+		err := engine.close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// ListDatabaseNames implements the IClient.ListDatabaseNames method.
+func (c *MultiClient) ListDatabaseNames(ctx context.Context, filter interface{}, opts ...*options.ListDatabasesOptions) ([]string, error) {
+	// list databases
+	res, err := c.ListDatabases(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// collect names
+	names := make([]string, 0, len(res.Databases))
+	for _, db := range res.Databases {
+		names = append(names, db.Name)
+	}
+
+	return names, nil
+}
+
+// ListDatabases implements the IClient.ListDatabases method. The databases of
+// all engines are returned ordered by name. Databases that exist in multiple
+// engines like the "local" database are merged.
+func (c *MultiClient) ListDatabases(ctx context.Context, filter interface{}, opts ...*options.ListDatabasesOptions) (mongo.ListDatabasesResult, error) {
+	// list databases
+	var result mongo.ListDatabasesResult
+	index := map[string]int{}
+	for _, client := range c.clients {
+		res, err := client.ListDatabases(ctx, filter, opts...)
+		if err != nil {
+			return mongo.ListDatabasesResult{}, err
+		}
+
+		// merge databases
+		for _, spec := range res.Databases {
+			if i, ok := index[spec.Name]; ok {
+				result.Databases[i].SizeOnDisk += spec.SizeOnDisk
+				result.Databases[i].Empty = result.Databases[i].Empty && spec.Empty
+				continue
+			}
+			index[spec.Name] = len(result.Databases)
+			result.Databases = append(result.Databases, spec)
+		}
+
+		// add size
+		result.TotalSize += res.TotalSize
+	}
+
+	// sort databases
+	sort.Slice(result.Databases, func(i, j int) bool {
+		return result.Databases[i].Name < result.Databases[j].Name
+	})
+
+	return result, nil
+}
+
+// NumberSessionsInProgress implements the IClient.NumberSessionsInProgress method.
+func (c *MultiClient) NumberSessionsInProgress() int {
+	// sum sessions
+	var num int
+	for _, client := range c.clients {
+		num += client.NumberSessionsInProgress()
+	}
+
+	return num
+}
+
+// Ping implements the IClient.Ping method.
+func (c *MultiClient) Ping(context.Context, *readpref.ReadPref) error {
+	return nil
+}
+
+// StartSession implements the IClient.StartSession method. As sessions are
+// bound to a single engine, it returns ErrMultiEngine. Sessions may be started
+// using the client returned by Client.
+func (c *MultiClient) StartSession(...*options.SessionOptions) (ISession, error) {
+	return nil, ErrMultiEngine
+}
+
+// Timeout implements the IClient.Timeout method.
+func (c *MultiClient) Timeout() *time.Duration {
+	return nil
+}
+
+// UseSession implements the IClient.UseSession method. It returns
+// ErrMultiEngine, see StartSession.
+func (c *MultiClient) UseSession(context.Context, func(ISessionContext) error) error {
+	return ErrMultiEngine
+}
+
+// UseSessionWithOptions implements the IClient.UseSessionWithOptions method.
+// It returns ErrMultiEngine, see StartSession.
+func (c *MultiClient) UseSessionWithOptions(context.Context, *options.SessionOptions, func(ISessionContext) error) error {
+	return ErrMultiEngine
+}
+
+// Watch implements the IClient.Watch method. As change streams are bound to a
+// single engine, it returns ErrMultiEngine. Databases and collections may be
+// watched directly or using the client returned by Client.
+func (c *MultiClient) Watch(context.Context, interface{}, ...*options.ChangeStreamOptions) (IChangeStream, error) {
+	return nil, ErrMultiEngine
+}
+
+func (c *MultiClient) index(database string) int {
+	// hash name
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(database))
+
+	return int(hash.Sum32() % uint32(len(c.engines)))
+}
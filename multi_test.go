@@ -0,0 +1,81 @@
+package lungo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMultiClient(t *testing.T) {
+	client, engines, err := OpenMulti(nil, 4, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, engines, 4)
+	defer client.Disconnect(nil)
+
+	t.Run("Parallel", func(t *testing.T) {
+		for i := 0; i < 8; i++ {
+			name := fmt.Sprintf("db%d", i)
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				coll := client.Database(name).Collection("foo")
+				for j := 0; j < 10; j++ {
+					_, err := coll.InsertOne(nil, bson.M{"n": j})
+					assert.NoError(t, err)
+				}
+
+				n, err := coll.CountDocuments(nil, bson.M{})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(10), n)
+			})
+		}
+	})
+
+	// isolation
+	used := map[*Engine]bool{}
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("db%d", i)
+		engine := client.Engine(name)
+		used[engine] = true
+		for _, other := range engines {
+			_, ok := other.Catalog().Namespaces[Handle{name, "foo"}]
+			assert.Equal(t, engine == other, ok)
+		}
+	}
+	assert.True(t, len(used) > 1)
+
+	// list databases
+	names, err := client.ListDatabaseNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db0", "db1", "db2", "db3", "db4", "db5", "db6", "db7", "local"}, names)
+
+	// sessions
+	_, err = client.StartSession()
+	assert.Equal(t, ErrMultiEngine, err)
+	assert.Equal(t, ErrMultiEngine, client.UseSession(nil, func(ISessionContext) error {
+		return nil
+	}))
+	sess, err := client.Client("db0").StartSession()
+	assert.NoError(t, err)
+	sess.EndSession(nil)
+	assert.Equal(t, 0, client.NumberSessionsInProgress())
+
+	// watch
+	_, err = client.Watch(nil, bson.A{})
+	assert.Equal(t, ErrMultiEngine, err)
+
+	// disconnect
+	err = client.Disconnect(nil)
+	assert.NoError(t, err)
+	for _, engine := range engines {
+		assert.True(t, engine.Closed())
+	}
+
+	// invalid count
+	_, _, err = OpenMulti(nil, 0, Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package lungo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// ErrInterrupted is returned by operations that have been killed using
+// Engine.KillOp or the killOp command. Like the error returned by MongoDB it
+// has the code 11601.
+var ErrInterrupted = mongo.CommandError{
+	Code:    11601,
+	Name:    "Interrupted",
+	Message: "operation was interrupted",
+}
+
+var errKilled = errors.New("operation killed")
+
+// OperationInfo describes an in-flight operation of a collection.
+type OperationInfo struct {
+	// The operation ID.
+	ID int64
+
+	// The name of the command as reported by CommandEvent.
+	Command string
+
+	// The namespace of the operation.
+	Namespace string
+
+	// The query of the operation, if any.
+	Query bsonkit.Doc
+
+	// The comment of the operation, if any.
+	Comment interface{}
+
+	// The logical session ID (lsid) of the explicit session in the context or
+	// the implicit session that has been checked out for a monitored
+	// operation, if any.
+	SessionID bson.Raw
+
+	// The time the operation has been started.
+	Started time.Time
+}
+
+type operation struct {
+	info   OperationInfo
+	cancel context.CancelCauseFunc
+}
+
+// CurrentOps will return information about all in-flight operations, ordered
+// by their ID. The information is also available using the $currentOp
+// aggregation stage of the admin database.
+func (e *Engine) CurrentOps() []OperationInfo {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// collect operations
+	list := make([]OperationInfo, 0, len(e.operations))
+	for _, op := range e.operations {
+		list = append(list, op.info)
+	}
+
+	// sort operations
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// KillOp will kill the in-flight operation with the specified ID by cancelling
+// its context. Long-running scans stop early and the operation fails with
+// ErrInterrupted. It returns false if no such operation is in flight.
+func (e *Engine) KillOp(id int64) bool {
+	// get operation
+	e.mutex.Lock()
+	op := e.operations[id]
+	e.mutex.Unlock()
+
+	// check operation
+	if op == nil {
+		return false
+	}
+
+	// cancel context
+	op.cancel(errKilled)
+
+	return true
+}
+
+func (e *Engine) trackOperation(ctx context.Context, info OperationInfo) (context.Context, int64) {
+	// derive context
+	ctx, cancel := context.WithCancelCause(ensureContext(ctx))
+
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// add operation
+	e.operation++
+	info.ID = e.operation
+	e.operations[info.ID] = &operation{
+		info:   info,
+		cancel: cancel,
+	}
+
+	return ctx, info.ID
+}
+
+func (e *Engine) untrackOperation(id int64) {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// get operation
+	op := e.operations[id]
+	if op == nil {
+		return
+	}
+
+	// release context and remove operation
+	op.cancel(nil)
+	delete(e.operations, id)
+}
@@ -0,0 +1,122 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestEngineCurrentOps(t *testing.T) {
+	var ops []OperationInfo
+	var engine *Engine
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+		Monitor: func(event CommandEvent) {
+			ops = engine.CurrentOps()
+		},
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"n": 1})
+	assert.NoError(t, err)
+	assert.Len(t, ops, 1)
+	assert.Equal(t, "insert", ops[0].Command)
+	assert.Nil(t, ops[0].Query)
+
+	n, err := coll.CountDocuments(nil, bson.M{"n": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Len(t, ops, 1)
+	assert.Equal(t, "count", ops[0].Command)
+	assert.Equal(t, "foo.bar", ops[0].Namespace)
+	assert.Equal(t, &bson.D{{Key: "n", Value: int32(1)}}, ops[0].Query)
+	assert.False(t, ops[0].Started.IsZero())
+	assert.True(t, ops[0].ID > 0)
+
+	assert.Empty(t, engine.CurrentOps())
+}
+
+func TestEngineKillOp(t *testing.T) {
+	var engine *Engine
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+		Monitor: func(event CommandEvent) {
+			if event.Command == "find" || event.Command == "update" {
+				for _, op := range engine.CurrentOps() {
+					assert.True(t, engine.KillOp(op.ID))
+				}
+			}
+		},
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	assert.False(t, engine.KillOp(42))
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertMany(nil, []interface{}{
+		bson.M{"n": 1},
+		bson.M{"n": 2},
+	})
+	assert.NoError(t, err)
+
+	// read
+	_, err = coll.Find(nil, bson.M{"n": 2})
+	assert.Equal(t, ErrInterrupted, err)
+
+	// write
+	_, err = coll.UpdateMany(nil, bson.M{}, bson.M{"$set": bson.M{"n": 3}})
+	assert.Equal(t, ErrInterrupted, err)
+
+	var ce mongo.CommandError
+	assert.ErrorAs(t, err, &ce)
+	assert.Equal(t, int32(11601), ce.Code)
+
+	// unchanged
+	n, err := coll.CountDocuments(nil, bson.M{"n": 3})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	assert.Empty(t, engine.CurrentOps())
+}
+
+func TestDatabaseRunCommandKillOp(t *testing.T) {
+	var client IClient
+	var engine *Engine
+	var res bson.M
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+		Monitor: func(event CommandEvent) {
+			if event.Command == "find" {
+				ops := engine.CurrentOps()
+				err := client.Database("admin").RunCommand(nil, bson.D{
+					{Key: "killOp", Value: 1},
+					{Key: "op", Value: ops[0].ID},
+				}).Decode(&res)
+				assert.NoError(t, err)
+			}
+		},
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"n": 1})
+	assert.NoError(t, err)
+
+	err = coll.FindOne(nil, bson.M{}).Err()
+	assert.Equal(t, ErrInterrupted, err)
+	assert.Equal(t, bson.M{
+		"info": "attempting to kill op",
+		"ok":   1.0,
+	}, res)
+
+	err = client.Database("foo").RunCommand(nil, bson.D{
+		{Key: "killOp", Value: 1},
+		{Key: "op", Value: 1},
+	}).Err()
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package lungo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// PatchOne will apply the JSON Patch (RFC 6902) operations to the first
+// document that matches the filter. The document is read, patched and replaced
+// in one transaction. If any operation fails, the document is left unchanged.
+// Changing the _id field or an encrypted field results in an error.
+func (c *Collection) PatchOne(ctx context.Context, filter interface{}, ops []bsonkit.PatchOperation) (*mongo.UpdateResult, error) {
+	// check filer
+	if filter == nil {
+		panic("lungo: missing filter document")
+	}
+
+	// transform filter
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// check operations
+	err = c.checkEncryptedPatch(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	// patch document
+	res, err := useTransaction(ctx, c.engine, true, func(txn *Transaction) (interface{}, error) {
+		// find document
+		res, err := txn.Find(c.handle, query, nil, 0, 1)
+		if err != nil {
+			return nil, err
+		} else if len(res.Matched) == 0 {
+			return &Result{}, nil
+		}
+
+		// apply patch
+		doc, err := bsonkit.ApplyPatch(res.Matched[0], ops)
+		if err != nil {
+			return nil, err
+		}
+
+		// replace document
+		return txn.Replace(c.handle, bsonkit.MustConvert(bson.M{
+			"_id": bsonkit.Get(res.Matched[0], "_id"),
+		}), nil, doc, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// get result
+	result := res.(*Result)
+
+	return &mongo.UpdateResult{
+		MatchedCount:  int64(len(result.Matched)),
+		ModifiedCount: int64(len(result.Modified)),
+	}, nil
+}
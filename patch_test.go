@@ -0,0 +1,57 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestCollectionPatchOne(t *testing.T) {
+	coll := testLungoClient.Database(testDB).Collection(collectionName()).(*Collection)
+
+	_, err := coll.InsertOne(nil, bson.M{
+		"_id":  "a",
+		"name": "Alice",
+		"tags": bson.A{"x"},
+	})
+	assert.NoError(t, err)
+
+	ops, err := bsonkit.ParsePatch([]byte(`[
+		{ "op": "test", "path": "/name", "value": "Alice" },
+		{ "op": "replace", "path": "/name", "value": "Bob" },
+		{ "op": "add", "path": "/tags/-", "value": "y" }
+	]`))
+	assert.NoError(t, err)
+
+	res, err := coll.PatchOne(nil, bson.M{"_id": "a"}, ops)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.MatchedCount)
+	assert.Equal(t, int64(1), res.ModifiedCount)
+	assert.Equal(t, []bson.M{
+		{"_id": "a", "name": "Bob", "tags": bson.A{"x", "y"}},
+	}, dumpCollection(coll, false))
+
+	// failed test
+	_, err = coll.PatchOne(nil, bson.M{"_id": "a"}, []bsonkit.PatchOperation{
+		{Op: "remove", Path: "/tags"},
+		{Op: "test", Path: "/name", Value: "Alice"},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": "a", "name": "Bob", "tags": bson.A{"x", "y"}},
+	}, dumpCollection(coll, false))
+
+	// immutable id
+	_, err = coll.PatchOne(nil, bson.M{"_id": "a"}, []bsonkit.PatchOperation{
+		{Op: "replace", Path: "/_id", Value: "b"},
+	})
+	assert.Error(t, err)
+
+	// missing document
+	res, err = coll.PatchOne(nil, bson.M{"_id": "b"}, ops)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), res.MatchedCount)
+}
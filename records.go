@@ -0,0 +1,80 @@
+package lungo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+type resumeRecordIDKey struct{}
+
+// ResumeAfterRecordID returns a context that makes find operations only consider
+// documents with a record ID greater than the specified record ID. Record IDs
+// are returned in the "$recordId" field of documents if the ShowRecordID option
+// is set. As record IDs increase monotonically in insertion order and are kept
+// when documents are updated, paginating with the last seen record ID is not
+// affected by concurrent inserts and deletes, unlike paginating with skip.
+//
+// Record IDs are not persisted and are reassigned in natural order when the
+// catalog is loaded from a store.
+func ResumeAfterRecordID(ctx context.Context, recordID int64) context.Context {
+	return context.WithValue(ensureContext(ctx), resumeRecordIDKey{}, recordID)
+}
+
+func resumeRecordID(ctx context.Context) (int64, bool) {
+	// check context
+	if ctx == nil {
+		return 0, false
+	}
+
+	// get record id
+	recordID, ok := ctx.Value(resumeRecordIDKey{}).(int64)
+
+	return recordID, ok
+}
+
+func findDocuments(ctx context.Context, txn *Transaction, handle Handle, query, sort, collation bsonkit.Doc, skip, limit int, showRecordID bool) (*Result, []int64, error) {
+	// find documents
+	var res *Result
+	var err error
+	if after, ok := resumeRecordID(ctx); ok {
+		if collation != nil {
+			return nil, nil, fmt.Errorf("collations are not supported when resuming after a record ID")
+		}
+		res, err = txn.FindAfter(handle, after, query, sort, skip, limit)
+	} else {
+		res, err = txn.FindCollated(handle, query, sort, collation, skip, limit)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// check record ids
+	if !showRecordID {
+		return res, nil, nil
+	}
+
+	// get record ids
+	recordIDs, err := txn.RecordIDs(handle, res.Matched)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res, recordIDs, nil
+}
+
+func addRecordIDs(list bsonkit.List, recordIDs []int64) bsonkit.List {
+	// add record ids to copies of the documents
+	result := make(bsonkit.List, 0, len(list))
+	for i, doc := range list {
+		copied := make(bson.D, len(*doc), len(*doc)+1)
+		copy(copied, *doc)
+		copied = append(copied, bson.E{Key: "$recordId", Value: recordIDs[i]})
+		result = append(result, &copied)
+	}
+
+	return result
+}
@@ -0,0 +1,111 @@
+package lungo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestShowRecordID(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		if _, ok := c.(*Collection); !ok {
+			return
+		}
+
+		_, err := c.InsertMany(nil, bson.A{
+			bson.M{"_id": "a"},
+			bson.M{"_id": "b"},
+			bson.M{"_id": "c"},
+		})
+		assert.NoError(t, err)
+
+		// find
+		csr, err := c.Find(nil, bson.M{}, options.Find().SetShowRecordID(true).SetSort(bson.M{"_id": -1}))
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": "c", "$recordId": int64(3)},
+			{"_id": "b", "$recordId": int64(2)},
+			{"_id": "a", "$recordId": int64(1)},
+		}, readAll(csr))
+
+		// update keeps record id
+		_, err = c.UpdateOne(nil, bson.M{"_id": "b"}, bson.M{
+			"$set": bson.M{"v": int32(1)},
+		})
+		assert.NoError(t, err)
+
+		// find one with projection
+		var doc bson.M
+		err = c.FindOne(nil, bson.M{"_id": "b"}, options.FindOne().SetShowRecordID(true).SetProjection(bson.M{
+			"v": 1,
+		})).Decode(&doc)
+		assert.NoError(t, err)
+		assert.Equal(t, bson.M{"_id": "b", "v": int32(1), "$recordId": int64(2)}, doc)
+
+		// stored documents are not modified
+		doc = nil
+		err = c.FindOne(nil, bson.M{"_id": "b"}).Decode(&doc)
+		assert.NoError(t, err)
+		assert.Equal(t, bson.M{"_id": "b", "v": int32(1)}, doc)
+	})
+}
+
+func TestResumeAfterRecordID(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		if _, ok := c.(*Collection); !ok {
+			return
+		}
+
+		_, err := c.InsertMany(nil, bson.A{
+			bson.M{"_id": int32(1)},
+			bson.M{"_id": int32(2)},
+			bson.M{"_id": int32(3)},
+			bson.M{"_id": int32(4)},
+		})
+		assert.NoError(t, err)
+
+		next := func(recordID int64) []bson.M {
+			ctx := ResumeAfterRecordID(context.Background(), recordID)
+			csr, err := c.Find(ctx, bson.M{}, options.Find().SetShowRecordID(true).SetLimit(2))
+			assert.NoError(t, err)
+			return readAll(csr)
+		}
+
+		// first page
+		page := next(0)
+		assert.Equal(t, []bson.M{
+			{"_id": int32(1), "$recordId": int64(1)},
+			{"_id": int32(2), "$recordId": int64(2)},
+		}, page)
+
+		// concurrent changes
+		_, err = c.DeleteOne(nil, bson.M{"_id": int32(1)})
+		assert.NoError(t, err)
+		_, err = c.InsertOne(nil, bson.M{"_id": int32(0)})
+		assert.NoError(t, err)
+
+		// second page
+		page = next(page[1]["$recordId"].(int64))
+		assert.Equal(t, []bson.M{
+			{"_id": int32(3), "$recordId": int64(3)},
+			{"_id": int32(4), "$recordId": int64(4)},
+		}, page)
+
+		// last page
+		page = next(page[1]["$recordId"].(int64))
+		assert.Equal(t, []bson.M{
+			{"_id": int32(0), "$recordId": int64(5)},
+		}, page)
+
+		// filter
+		ctx := ResumeAfterRecordID(context.Background(), 3)
+		csr, err := c.Find(ctx, bson.M{"_id": bson.M{"$lt": int32(4)}})
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": int32(0)},
+		}, readAll(csr))
+	})
+}
@@ -0,0 +1,142 @@
+package lungo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// ResolveRefs will find all documents that match the filter and decode them to
+// out with all DBRef subdocuments ({$ref, $id, $db}) replaced by the referenced
+// documents. References without a $db field are resolved in the database of the
+// collection. References that cannot be resolved are replaced with null. Only
+// references in the matched documents are resolved, references in referenced
+// documents are left unchanged.
+func (c *Collection) ResolveRefs(ctx context.Context, filter interface{}, out interface{}) error {
+	// check filer
+	if filter == nil {
+		panic("lungo: missing filter document")
+	}
+
+	// transform filter
+	query, err := bsonkit.TransformWithRegistry(c.registry, filter)
+	if err != nil {
+		return err
+	}
+
+	// find and resolve documents
+	res, err := useTransaction(ctx, c.engine, false, func(txn *Transaction) (interface{}, error) {
+		// find documents
+		res, err := txn.Find(c.handle, query, nil, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		// decrypt documents
+		matched, err := c.decryptList(res.Matched)
+		if err != nil {
+			return nil, err
+		}
+
+		// resolve references
+		list := make(bsonkit.List, 0, len(matched))
+		for _, doc := range matched {
+			value, err := c.resolveRefs(txn, *doc)
+			if err != nil {
+				return nil, err
+			}
+			resolved := value.(bson.D)
+			list = append(list, &resolved)
+		}
+
+		return list, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// decode list
+	return bsonkit.DecodeListWithRegistry(c.registry, res.(bsonkit.List), out)
+}
+
+func (c *Collection) resolveRefs(txn *Transaction, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case bson.D:
+		// resolve reference
+		ref, id, refDB, ok := parseRef(value)
+		if ok {
+			// get database
+			if refDB == "" {
+				refDB = c.handle[0]
+			}
+
+			// get referenced collection
+			coll := &Collection{engine: c.engine, handle: Handle{refDB, ref}, registry: c.registry}
+
+			// find document
+			res, err := txn.Find(coll.handle, bsonkit.MustConvert(bson.M{
+				"_id": id,
+			}), nil, 0, 1)
+			if err != nil {
+				return nil, err
+			} else if len(res.Matched) == 0 {
+				return nil, nil
+			}
+
+			// decrypt document
+			doc, err := coll.decrypt(bsonkit.Clone(res.Matched[0]))
+			if err != nil {
+				return nil, err
+			}
+
+			return *doc, nil
+		}
+
+		// resolve fields
+		doc := make(bson.D, 0, len(value))
+		for _, e := range value {
+			v, err := c.resolveRefs(txn, e.Value)
+			if err != nil {
+				return nil, err
+			}
+			doc = append(doc, bson.E{Key: e.Key, Value: v})
+		}
+
+		return doc, nil
+	case bson.A:
+		// resolve elements
+		arr := make(bson.A, 0, len(value))
+		for _, v := range value {
+			v, err := c.resolveRefs(txn, v)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+
+		return arr, nil
+	default:
+		return value, nil
+	}
+}
+
+func parseRef(doc bson.D) (string, interface{}, string, bool) {
+	// get fields
+	var ref, db string
+	var id interface{}
+	var hasRef, hasID bool
+	for _, e := range doc {
+		switch e.Key {
+		case "$ref":
+			ref, hasRef = e.Value.(string)
+		case "$id":
+			id, hasID = e.Value, true
+		case "$db":
+			db, _ = e.Value.(string)
+		}
+	}
+
+	return ref, id, db, hasRef && hasID && ref != ""
+}
@@ -0,0 +1,61 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCollectionResolveRefs(t *testing.T) {
+	db := testLungoClient.Database(testDB)
+	authors := db.Collection(collectionName())
+	posts := db.Collection(collectionName()).(*Collection)
+	other := testLungoClient.Database("other").Collection(collectionName())
+
+	_, err := authors.InsertOne(nil, bson.M{"_id": 1, "name": "Alice"})
+	assert.NoError(t, err)
+
+	_, err = other.InsertOne(nil, bson.M{"_id": 2, "name": "Bob"})
+	assert.NoError(t, err)
+
+	_, err = posts.InsertOne(nil, bson.D{
+		{Key: "_id", Value: "a"},
+		{Key: "author", Value: bson.D{
+			{Key: "$ref", Value: authors.Name()},
+			{Key: "$id", Value: 1},
+		}},
+		{Key: "editors", Value: bson.A{
+			bson.D{
+				{Key: "$ref", Value: other.Name()},
+				{Key: "$id", Value: 2},
+				{Key: "$db", Value: "other"},
+			},
+			bson.D{
+				{Key: "$ref", Value: authors.Name()},
+				{Key: "$id", Value: 3},
+			},
+		}},
+	})
+	assert.NoError(t, err)
+
+	var list []bson.M
+	err = posts.ResolveRefs(nil, bson.M{}, &list)
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{
+			"_id":    "a",
+			"author": bson.M{"_id": int32(1), "name": "Alice"},
+			"editors": bson.A{
+				bson.M{"_id": int32(2), "name": "Bob"},
+				nil,
+			},
+		},
+	}, list)
+
+	// stored documents are unchanged
+	assert.Equal(t, bson.M{
+		"$ref": authors.Name(),
+		"$id":  int32(1),
+	}, dumpCollection(posts, false)[0]["author"])
+}
@@ -0,0 +1,174 @@
+package lungo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// ReplicateOptions configures a replication.
+type ReplicateOptions struct {
+	// The namespaces to replicate.
+	//
+	// Default: all namespaces.
+	Handles []Handle
+
+	// The resume token of the last applied change. If missing, the
+	// replication starts with the next change.
+	ResumeAfter bson.Raw
+
+	// The function that is called with the resume token after a change has
+	// been applied. It may be used to persist the replication progress.
+	Checkpoint func(token bson.Raw)
+
+	// The function that is called with errors from applying changes.
+	Errors func(error)
+
+	// The delay after which a failed change is retried.
+	//
+	// Default: 1s.
+	RetryDelay time.Duration
+}
+
+// Replicate will tail the oplog of the engine and apply the changes to the
+// target client (e.g. a MongoDB deployment connected using Connect) until the
+// context is cancelled or the oplog position has been lost. Changes are
+// applied in order and retried until they succeed, which allows an engine to
+// be used as an offline-first store that syncs upstream whenever the target
+// is reachable. Changes are applied idempotently using the full document of
+// the change and may therefore be applied more than once.
+func Replicate(ctx context.Context, engine *Engine, target IClient, opts ReplicateOptions) error {
+	// ensure context
+	ctx = ensureContext(ctx)
+
+	// set default retry delay
+	if opts.RetryDelay == 0 {
+		opts.RetryDelay = time.Second
+	}
+
+	// prepare pipeline
+	var pipeline bsonkit.List
+	if len(opts.Handles) > 0 {
+		pipeline = bsonkit.List{namespaceFilter(opts.Handles)}
+	}
+
+	// get resume after
+	var resumeAfter bsonkit.Doc
+	if opts.ResumeAfter != nil {
+		var token bson.D
+		err := bson.Unmarshal(opts.ResumeAfter, &token)
+		if err != nil {
+			return err
+		}
+		resumeAfter = &token
+	}
+
+	// open stream
+	stream, err := engine.Watch(Handle{}, pipeline, resumeAfter, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	// ensure close
+	defer stream.Close(context.Background())
+
+	// keep post images of updates
+	stream.fullDocument = options.WhenAvailable
+
+	// apply changes
+	for stream.Next(ctx) {
+		// decode event
+		var event bson.D
+		err = stream.Decode(&event)
+		if err != nil {
+			return err
+		}
+
+		// apply event until successful
+		for {
+			err = replicateEvent(ctx, target, &event)
+			if err == nil {
+				break
+			} else if ctx.Err() != nil {
+				return nil
+			}
+
+			// report error
+			if opts.Errors != nil {
+				opts.Errors(err)
+			}
+
+			// await retry
+			select {
+			case <-time.After(opts.RetryDelay):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		// yield token
+		if opts.Checkpoint != nil {
+			opts.Checkpoint(stream.ResumeToken())
+		}
+	}
+
+	// check context
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return stream.Err()
+}
+
+func replicateEvent(ctx context.Context, target IClient, event bsonkit.Doc) error {
+	// get details
+	opType, _ := bsonkit.Get(event, "operationType").(string)
+	nsDB, _ := bsonkit.Get(event, "ns.db").(string)
+	nsColl, _ := bsonkit.Get(event, "ns.coll").(string)
+
+	// prepare query
+	query := bson.D{{Key: "_id", Value: bsonkit.Get(event, "documentKey._id")}}
+
+	// apply event
+	switch opType {
+	case "insert", "replace", "update":
+		doc, _ := bsonkit.Get(event, "fullDocument").(bson.D)
+		_, err := target.Database(nsDB).Collection(nsColl).ReplaceOne(ctx, query, doc, options.Replace().SetUpsert(true))
+		return err
+	case "delete":
+		_, err := target.Database(nsDB).Collection(nsColl).DeleteOne(ctx, query)
+		return err
+	case "drop":
+		return target.Database(nsDB).Collection(nsColl).Drop(ctx)
+	case "rename":
+		toDB, _ := bsonkit.Get(event, "to.db").(string)
+		toColl, _ := bsonkit.Get(event, "to.coll").(string)
+		return target.Database("admin").RunCommand(ctx, bson.D{
+			{Key: "renameCollection", Value: nsDB + "." + nsColl},
+			{Key: "to", Value: toDB + "." + toColl},
+			{Key: "dropTarget", Value: true},
+		}).Err()
+	case "dropDatabase":
+		return target.Database(nsDB).Drop(ctx)
+	default:
+		return fmt.Errorf("unsupported change stream event %q", opType)
+	}
+}
+
+func namespaceFilter(handles []Handle) bsonkit.Doc {
+	// collect namespaces
+	namespaces := bson.A{}
+	for _, handle := range handles {
+		namespaces = append(namespaces, bson.D{
+			{Key: "ns.db", Value: handle[0]},
+			{Key: "ns.coll", Value: handle[1]},
+		})
+	}
+
+	return &bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: namespaces}}}}
+}
@@ -0,0 +1,118 @@
+package lungo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReplicate(t *testing.T) {
+	source, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	target, targetEngine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer targetEngine.Close()
+
+	sourceColl := source.Database("foo").Collection("bar")
+	targetColl := target.Database("foo").Collection("bar")
+
+	var token bson.Raw
+	tokens := make(chan bson.Raw, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Replicate(ctx, engine, target, ReplicateOptions{
+			Handles: []Handle{{"foo", "bar"}},
+			Checkpoint: func(t bson.Raw) {
+				tokens <- t
+			},
+		})
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = sourceColl.InsertMany(nil, []interface{}{
+		bson.M{"_id": "a", "n": 1},
+		bson.M{"_id": "b", "n": 2},
+	})
+	assert.NoError(t, err)
+
+	_, err = sourceColl.UpdateOne(nil, bson.M{"_id": "a"}, bson.M{"$set": bson.M{"n": 3}})
+	assert.NoError(t, err)
+
+	_, err = sourceColl.DeleteOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	_, err = source.Database("foo").Collection("baz").InsertOne(nil, bson.M{"_id": "c"})
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		token = <-tokens
+	}
+
+	assert.Equal(t, []bson.M{
+		{"_id": "a", "n": int32(3)},
+	}, dumpCollection(targetColl, false))
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	_, err = sourceColl.InsertOne(nil, bson.M{"_id": "d", "n": 4})
+	assert.NoError(t, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		done <- Replicate(ctx, engine, target, ReplicateOptions{
+			ResumeAfter: token,
+			Checkpoint: func(t bson.Raw) {
+				tokens <- t
+			},
+		})
+	}()
+
+	<-tokens
+	<-tokens
+
+	assert.Equal(t, []bson.M{
+		{"_id": "a", "n": int32(3)},
+		{"_id": "d", "n": int32(4)},
+	}, dumpCollection(targetColl, false))
+
+	err = source.Database("admin").RunCommand(nil, bson.D{
+		{Key: "renameCollection", Value: "foo.bar"},
+		{Key: "to", Value: "foo.qux"},
+	}).Err()
+	assert.NoError(t, err)
+
+	<-tokens
+
+	assert.Empty(t, dumpCollection(targetColl, false))
+	assert.Equal(t, []bson.M{
+		{"_id": "a", "n": int32(3)},
+		{"_id": "d", "n": int32(4)},
+	}, dumpCollection(target.Database("foo").Collection("qux"), false))
+
+	err = source.Database("foo").Drop(nil)
+	assert.NoError(t, err)
+
+	<-tokens
+	<-tokens
+	<-tokens
+
+	names, err := target.ListDatabaseNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"local"}, names)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
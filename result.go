@@ -2,6 +2,7 @@ package lungo
 
 import (
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/256dpi/lungo/bsonkit"
@@ -15,8 +16,9 @@ var _ ISingleResult = &SingleResult{}
 
 // SingleResult wraps a result to be mongo compatible.
 type SingleResult struct {
-	doc bsonkit.Doc
-	err error
+	doc      bsonkit.Doc
+	err      error
+	registry *bsoncodec.Registry
 }
 
 // Decode implements the ISingleResult.Decode method.
@@ -32,11 +34,19 @@ func (r *SingleResult) Decode(out interface{}) error {
 	}
 
 	// decode document
-	return bsonkit.Decode(r.doc, out)
+	return bsonkit.DecodeWithRegistry(r.registry, r.doc, out)
 }
 
-// DecodeBytes implements the ISingleResult.DecodeBytes method.
+// DecodeBytes implements the ISingleResult.DecodeBytes method. It returns the
+// same document as Raw.
 func (r *SingleResult) DecodeBytes() (bson.Raw, error) {
+	return r.Raw()
+}
+
+// Raw returns the document as raw BSON. Like Decode, it returns the error of
+// the operation or ErrNoDocuments if no document has been found. The method
+// mirrors the Raw method of newer driver versions.
+func (r *SingleResult) Raw() (bson.Raw, error) {
 	// check error
 	if r.err != nil {
 		return nil, r.err
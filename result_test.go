@@ -0,0 +1,72 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSingleResultNoDocuments(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		_, err := c.InsertOne(nil, bson.M{"_id": 1, "foo": "bar"})
+		assert.NoError(t, err)
+
+		results := []ISingleResult{
+			c.FindOne(nil, bson.M{"foo": "baz"}),
+			c.FindOne(nil, bson.M{}, options.FindOne().SetSkip(1)),
+			c.FindOneAndDelete(nil, bson.M{"foo": "baz"}),
+			c.FindOneAndReplace(nil, bson.M{"foo": "baz"}, bson.M{"foo": "qux"}),
+			c.FindOneAndReplace(nil, bson.M{"_id": 2}, bson.M{"foo": "qux"}, options.FindOneAndReplace().SetUpsert(true)),
+			c.FindOneAndUpdate(nil, bson.M{"foo": "baz"}, bson.M{"$set": bson.M{"foo": "qux"}}),
+			c.FindOneAndUpdate(nil, bson.M{"_id": 3}, bson.M{"$set": bson.M{"foo": "qux"}}, options.FindOneAndUpdate().SetUpsert(true)),
+		}
+
+		for _, res := range results {
+			assert.Equal(t, mongo.ErrNoDocuments, res.Err())
+
+			var doc bson.M
+			assert.Equal(t, mongo.ErrNoDocuments, res.Decode(&doc))
+			assert.Nil(t, doc)
+
+			raw, err := res.DecodeBytes()
+			assert.Equal(t, mongo.ErrNoDocuments, err)
+			assert.Nil(t, raw)
+		}
+	})
+}
+
+func TestSingleResultRaw(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"_id": 1, "foo": "bar"})
+	assert.NoError(t, err)
+
+	res := coll.FindOne(nil, bson.M{}).(*SingleResult)
+	raw, err := res.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", raw.Lookup("foo").StringValue())
+
+	bytes, err := res.DecodeBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, raw, bytes)
+
+	res = coll.FindOne(nil, bson.M{"foo": "baz"}).(*SingleResult)
+	raw, err = res.Raw()
+	assert.Equal(t, ErrNoDocuments, err)
+	assert.Nil(t, raw)
+
+	engine.Close()
+
+	res = coll.FindOne(nil, bson.M{}).(*SingleResult)
+	raw, err = res.Raw()
+	assert.ErrorIs(t, err, ErrEngineClosed)
+	assert.Nil(t, raw)
+}
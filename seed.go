@@ -0,0 +1,133 @@
+package lungo
+
+import (
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// Fixtures describes the documents and indexes that are seeded into an
+// engine. Namespaces are specified as "<db>.<coll>" strings.
+type Fixtures struct {
+	// The documents to insert per namespace.
+	Documents map[string][]interface{}
+
+	// The indexes to create per namespace.
+	Indexes map[string][]mongo.IndexModel
+
+	// Whether the namespaces listed in the fixtures should be dropped before
+	// being seeded. Other namespaces are not touched.
+	Reset bool
+}
+
+// Seed will create the namespaces, indexes and documents described by the
+// fixtures using a single transaction. If any document or index fails to be
+// seeded, the engine remains unchanged. Namespaces are seeded in alphabetical
+// order and indexes are created before the documents are inserted.
+func Seed(ctx context.Context, engine *Engine, fixtures Fixtures) error {
+	// collect namespaces
+	namespaces := map[string]bool{}
+	for ns := range fixtures.Documents {
+		namespaces[ns] = true
+	}
+	for ns := range fixtures.Indexes {
+		namespaces[ns] = true
+	}
+
+	// sort namespaces
+	names := make([]string, 0, len(namespaces))
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	// seed namespaces
+	return engine.Transact(ctx, func(txn *Transaction) error {
+		for _, ns := range names {
+			err := seedNamespace(txn, engine, ns, fixtures)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func seedNamespace(txn *Transaction, engine *Engine, ns string, fixtures Fixtures) error {
+	// parse handle
+	handle, err := ParseHandle(ns)
+	if err != nil {
+		return err
+	}
+
+	// drop existing namespace
+	if fixtures.Reset {
+		err = txn.Drop(handle)
+		if err != nil {
+			return err
+		}
+	}
+
+	// ensure namespace
+	err = txn.Create(handle)
+	if err != nil {
+		return err
+	}
+
+	// prepare index view
+	view := &IndexView{
+		handle:   handle,
+		engine:   engine,
+		registry: engine.opts.Registry,
+	}
+
+	// create indexes
+	for _, model := range fixtures.Indexes[ns] {
+		// prepare index
+		name, config, err := view.prepare("Seed", model)
+		if err != nil {
+			return err
+		}
+
+		// create index
+		_, err = txn.CreateIndex(handle, name, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	// get documents
+	documents := fixtures.Documents[ns]
+	if len(documents) == 0 {
+		return nil
+	}
+
+	// transform documents
+	list, err := bsonkit.TransformListWithRegistry(engine.opts.Registry, documents)
+	if err != nil {
+		return err
+	}
+
+	// encrypt documents
+	coll := &Collection{engine: engine, handle: handle}
+	for _, doc := range list {
+		err = coll.encrypt(doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	// insert documents
+	res, err := txn.Insert(handle, list, true)
+	if err != nil {
+		return err
+	} else if res.Error != nil {
+		return res.Error
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestSeed(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	fixtures := Fixtures{
+		Documents: map[string][]interface{}{
+			"foo.bar": {
+				bson.M{"_id": 1, "name": "a"},
+				bson.M{"_id": 2, "name": "b"},
+			},
+			"foo.baz": {
+				bson.M{"_id": 1},
+			},
+		},
+		Indexes: map[string][]mongo.IndexModel{
+			"foo.bar": {{
+				Keys:    bson.D{{Key: "name", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}},
+			"foo.qux": {{
+				Keys: bson.D{{Key: "n", Value: 1}},
+			}},
+		},
+	}
+
+	// seed
+	err = Seed(nil, engine, fixtures)
+	assert.NoError(t, err)
+
+	db := client.Database("foo")
+	csr, err := db.Collection("bar").Find(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "name": "a"},
+		{"_id": int32(2), "name": "b"},
+	}, readAll(csr))
+
+	names, err := db.ListCollectionNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"bar", "baz", "qux"}, names)
+
+	csr, err = db.Collection("qux").Indexes().List(nil)
+	assert.NoError(t, err)
+	assert.Len(t, readAll(csr), 2)
+
+	// duplicate without reset
+	err = Seed(nil, engine, fixtures)
+	assert.Error(t, err)
+
+	// reset
+	_, err = db.Collection("bar").InsertOne(nil, bson.M{"_id": 3, "name": "c"})
+	assert.NoError(t, err)
+
+	fixtures.Reset = true
+	err = Seed(nil, engine, fixtures)
+	assert.NoError(t, err)
+
+	n, err := db.Collection("bar").CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// atomic
+	err = Seed(nil, engine, Fixtures{
+		Documents: map[string][]interface{}{
+			"foo.bar": {
+				bson.M{"_id": 4, "name": "a"},
+			},
+			"foo.new": {
+				bson.M{"_id": 1},
+			},
+		},
+	})
+	assert.True(t, IsUniquenessError(err))
+
+	names, err = db.ListCollectionNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"bar", "baz", "qux"}, names)
+
+	// invalid namespace
+	err = Seed(nil, engine, Fixtures{
+		Documents: map[string][]interface{}{
+			"foo": {bson.M{}},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestSeedFieldEncryption(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+		FieldEncryption: &FieldEncryption{
+			Fields: map[string][]string{
+				"foo.bar": {"ssn"},
+			},
+			Encrypt: func(ns, field string, plaintext []byte) ([]byte, error) {
+				return xorBytes(plaintext), nil
+			},
+			Decrypt: func(ns, field string, ciphertext []byte) ([]byte, error) {
+				return xorBytes(ciphertext), nil
+			},
+		},
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	err = Seed(nil, engine, Fixtures{
+		Documents: map[string][]interface{}{
+			"foo.bar": {
+				bson.M{"_id": 1, "ssn": "123"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	// stored values are encrypted
+	stored := engine.Catalog().Namespaces[Handle{"foo", "bar"}].Documents.List[0]
+	ssn, ok := bsonkit.Get(stored, "ssn").(primitive.Binary)
+	assert.True(t, ok)
+	assert.Equal(t, EncryptedSubtype, ssn.Subtype)
+
+	// read values are decrypted
+	assert.Equal(t, []bson.M{
+		{"_id": int32(1), "ssn": "123"},
+	}, dumpCollection(client.Database("foo").Collection("bar"), false))
+}
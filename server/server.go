@@ -0,0 +1,302 @@
+// Package server provides an HTTP/JSON API to access a lungo database
+// remotely. It allows sidecar tools to query a database that is embedded in
+// another service.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo"
+)
+
+// MaxBodySize is the maximum size of a request body.
+const MaxBodySize = 8 << 20
+
+// Request is the body of a request. Documents are encoded using relaxed
+// extended JSON.
+type Request struct {
+	// The filter document (find, count, update, replace, delete).
+	Filter bson.D `bson:"filter,omitempty"`
+
+	// The sort document (find).
+	Sort bson.D `bson:"sort,omitempty"`
+
+	// The projection document (find).
+	Projection bson.D `bson:"projection,omitempty"`
+
+	// The documents to skip and return (find).
+	Skip  int64 `bson:"skip,omitempty"`
+	Limit int64 `bson:"limit,omitempty"`
+
+	// The documents to insert (insert).
+	Documents []bson.D `bson:"documents,omitempty"`
+
+	// The update document (update).
+	Update bson.D `bson:"update,omitempty"`
+
+	// The replacement document (replace).
+	Replacement bson.D `bson:"replacement,omitempty"`
+
+	// Whether all matching documents should be updated or deleted (update,
+	// delete).
+	Many bool `bson:"many,omitempty"`
+
+	// Whether a document should be inserted if none matches (update, replace).
+	Upsert bool `bson:"upsert,omitempty"`
+}
+
+// Server serves the HTTP/JSON API. Requests are made using the POST method to
+// the "/<database>/<collection>/<operation>" path where operation is one of
+// "find", "count", "insert", "update", "replace" or "delete". If tokens are
+// configured, requests must be authenticated using the "Authorization: Bearer
+// <token>" header.
+type Server struct {
+	client lungo.IClient
+	tokens []string
+}
+
+// New will create and return a new server that uses the specified client.
+func New(client lungo.IClient, tokens ...string) *Server {
+	return &Server{
+		client: client,
+		tokens: tokens,
+	}
+}
+
+// Serve will serve the API on the specified listener until it is closed. If a
+// TLS config is provided, connections are served over TLS.
+func (s *Server) Serve(listener net.Listener, config *tls.Config) error {
+	// wrap listener
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+
+	// serve requests
+	err := http.Serve(listener, s)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check method
+	if r.Method != http.MethodPost {
+		s.fail(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	// check authentication
+	if !s.authenticate(r) {
+		s.fail(w, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	// parse path
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) != 3 || segments[0] == "" || segments[1] == "" {
+		s.fail(w, http.StatusNotFound, fmt.Errorf("invalid path"))
+		return
+	}
+
+	// read body
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxBodySize))
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// decode request
+	var req Request
+	if len(body) > 0 {
+		err = bson.UnmarshalExtJSON(body, false, &req)
+		if err != nil {
+			s.fail(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// ensure filter
+	if req.Filter == nil {
+		req.Filter = bson.D{}
+	}
+
+	// get collection
+	coll := s.client.Database(segments[0]).Collection(segments[1])
+
+	// run operation
+	res, err := s.run(r.Context(), coll, segments[2], req)
+	if err == errUnknownOperation {
+		s.fail(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		s.fail(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// write response
+	s.write(w, http.StatusOK, res)
+}
+
+var errUnknownOperation = fmt.Errorf("unknown operation")
+
+func (s *Server) run(ctx context.Context, coll lungo.ICollection, op string, req Request) (bson.D, error) {
+	switch op {
+	case "find":
+		// prepare options
+		opts := options.Find().SetSkip(req.Skip).SetLimit(req.Limit)
+		if req.Sort != nil {
+			opts.SetSort(req.Sort)
+		}
+		if req.Projection != nil {
+			opts.SetProjection(req.Projection)
+		}
+
+		// find documents
+		csr, err := coll.Find(ctx, req.Filter, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		// decode documents
+		docs := make([]bson.D, 0)
+		err = csr.All(ctx, &docs)
+		if err != nil {
+			return nil, err
+		}
+
+		return bson.D{{Key: "documents", Value: docs}}, nil
+	case "count":
+		// count documents
+		n, err := coll.CountDocuments(ctx, req.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		return bson.D{{Key: "count", Value: n}}, nil
+	case "insert":
+		// check documents
+		if len(req.Documents) == 0 {
+			return nil, fmt.Errorf("missing documents")
+		}
+
+		// insert documents
+		docs := make([]interface{}, 0, len(req.Documents))
+		for _, doc := range req.Documents {
+			docs = append(docs, doc)
+		}
+		res, err := coll.InsertMany(ctx, docs)
+		if err != nil {
+			return nil, err
+		}
+
+		return bson.D{{Key: "insertedIDs", Value: res.InsertedIDs}}, nil
+	case "update":
+		// check update
+		if req.Update == nil {
+			return nil, fmt.Errorf("missing update")
+		}
+
+		// update documents
+		opts := options.Update().SetUpsert(req.Upsert)
+		update := coll.UpdateOne
+		if req.Many {
+			update = coll.UpdateMany
+		}
+		res, err := update(ctx, req.Filter, req.Update, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return bson.D{
+			{Key: "matched", Value: res.MatchedCount},
+			{Key: "modified", Value: res.ModifiedCount},
+			{Key: "upsertedID", Value: res.UpsertedID},
+		}, nil
+	case "replace":
+		// check replacement
+		if req.Replacement == nil {
+			return nil, fmt.Errorf("missing replacement")
+		}
+
+		// replace document
+		res, err := coll.ReplaceOne(ctx, req.Filter, req.Replacement, options.Replace().SetUpsert(req.Upsert))
+		if err != nil {
+			return nil, err
+		}
+
+		return bson.D{
+			{Key: "matched", Value: res.MatchedCount},
+			{Key: "modified", Value: res.ModifiedCount},
+			{Key: "upsertedID", Value: res.UpsertedID},
+		}, nil
+	case "delete":
+		// delete documents
+		remove := coll.DeleteOne
+		if req.Many {
+			remove = coll.DeleteMany
+		}
+		res, err := remove(ctx, req.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		return bson.D{{Key: "deleted", Value: res.DeletedCount}}, nil
+	default:
+		return nil, errUnknownOperation
+	}
+}
+
+func (s *Server) authenticate(r *http.Request) bool {
+	// allow all requests if no tokens are configured
+	if len(s.tokens) == 0 {
+		return true
+	}
+
+	// get token
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+
+	// compare tokens
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) fail(w http.ResponseWriter, status int, err error) {
+	s.write(w, status, bson.D{{Key: "error", Value: err.Error()}})
+}
+
+func (s *Server) write(w http.ResponseWriter, status int, res bson.D) {
+	// encode response
+	data, err := bson.MarshalExtJSON(res, false, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
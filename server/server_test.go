@@ -0,0 +1,128 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/lungo"
+)
+
+func request(t *testing.T, srv *Server, token, path, body string) (int, string) {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	res, err := io.ReadAll(rec.Body)
+	assert.NoError(t, err)
+
+	return rec.Code, string(res)
+}
+
+func TestServer(t *testing.T) {
+	client, engine, err := lungo.Open(nil, lungo.Options{
+		Store: lungo.NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	srv := New(client, "secret")
+
+	code, res := request(t, srv, "", "/foo/bar/find", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, `{"error":"unauthorized"}`, res)
+
+	code, _ = request(t, srv, "wrong", "/foo/bar/find", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, res = request(t, srv, "secret", "/foo/bar/insert", `{"documents":[{"_id":1,"n":1},{"_id":2,"n":2}]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"insertedIDs":[1,2]}`, res)
+
+	code, res = request(t, srv, "secret", "/foo/bar/find", `{"filter":{"n":{"$gt":1}}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"documents":[{"_id":2,"n":2}]}`, res)
+
+	code, res = request(t, srv, "secret", "/foo/bar/find", `{"sort":{"n":-1},"limit":1,"projection":{"_id":1}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"documents":[{"_id":2}]}`, res)
+
+	code, res = request(t, srv, "secret", "/foo/bar/update", `{"update":{"$inc":{"n":10}},"many":true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"matched":2,"modified":2,"upsertedID":null}`, res)
+
+	code, res = request(t, srv, "secret", "/foo/bar/replace", `{"filter":{"_id":1},"replacement":{"n":0}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"matched":1,"modified":1,"upsertedID":null}`, res)
+
+	code, res = request(t, srv, "secret", "/foo/bar/count", `{"filter":{"n":{"$gte":10}}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"count":1}`, res)
+
+	code, res = request(t, srv, "secret", "/foo/bar/delete", `{"filter":{"_id":2}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"deleted":1}`, res)
+
+	code, res = request(t, srv, "secret", "/foo/bar/insert", `{"documents":[{"_id":1}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, res, "duplicate")
+
+	code, _ = request(t, srv, "secret", "/foo/bar/drop", `{}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = request(t, srv, "secret", "/foo/find", `{}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = request(t, srv, "secret", "/foo/bar/find", `{`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestServerTLS(t *testing.T) {
+	client, engine, err := lungo.Open(nil, lungo.Options{
+		Store: lungo.NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	// get test certificate
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	config := ts.TLS.Clone()
+	httpClient := ts.Client()
+	ts.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- New(client).Serve(listener, config)
+	}()
+
+	url := "https://" + listener.Addr().String() + "/foo/bar/count"
+
+	res, err := httpClient.Post(url, "application/json", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, `{"count":0}`, string(body))
+
+	res, err = http.Post("http://"+listener.Addr().String()+"/foo/bar/count", "application/json", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	err = listener.Close()
+	assert.NoError(t, err)
+	assert.NoError(t, <-done)
+}
@@ -25,14 +25,16 @@ type SessionContext struct {
 // Session provides a mongo compatible way to handle transactions.
 type Session struct {
 	engine *Engine
+	id     bson.Raw
 	txn    *Transaction
 	ended  bool
 	mutex  sync.Mutex
 }
 
-// ID implements the ISession.ID method.
+// ID implements the ISession.ID method. It returns the logical session ID
+// (lsid) of the server session that has been checked out from the engine.
 func (s *Session) ID() bson.Raw {
-	return nil
+	return s.id
 }
 
 // AbortTransaction implements the ISession.AbortTransaction method.
@@ -68,7 +70,8 @@ func (s *Session) AdvanceOperationTime(*primitive.Timestamp) error {
 // Client implements the ISession.Client method.
 func (s *Session) Client() IClient {
 	return &Client{
-		engine: s.engine,
+		engine:   s.engine,
+		registry: s.engine.opts.Registry,
 	}
 }
 
@@ -123,6 +126,9 @@ func (s *Session) EndSession(context.Context) {
 		s.txn = nil
 	}
 
+	// release server session
+	s.engine.releaseSession(s.id)
+
 	// set flag
 	s.ended = true
 }
@@ -147,12 +153,15 @@ func (s *Session) StartTransaction(opts ...*options.TransactionOptions) error {
 	opt := options.MergeTransactionOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := assertOptions(s.engine, "Session.StartTransaction", opt, map[string]string{
 		"ReadConcern":    ignored,
 		"ReadPreference": ignored,
 		"WriteConcern":   ignored,
 		"MaxCommitTime":  ignored,
 	})
+	if err != nil {
+		return err
+	}
 
 	// check transaction
 	if s.txn != nil {
@@ -179,15 +188,18 @@ func (s *Session) WithTransaction(ctx context.Context, fn func(ISessionContext)
 	opt := options.MergeTransactionOptions(opts...)
 
 	// assert supported options
-	assertOptions(opt, map[string]string{
+	err := assertOptions(s.engine, "Session.WithTransaction", opt, map[string]string{
 		"ReadConcern":    ignored,
 		"ReadPreference": ignored,
 		"WriteConcern":   ignored,
 		"MaxCommitTime":  ignored,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// start transaction
-	err := s.StartTransaction(opt)
+	err = s.StartTransaction(opt)
 	if err != nil {
 		return nil, err
 	}
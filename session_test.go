@@ -242,3 +242,44 @@ func TestSessionAutomatic(t *testing.T) {
 		}, readAll(csr))
 	})
 }
+
+func TestSessionID(t *testing.T) {
+	clientTest(t, func(t *testing.T, c IClient) {
+		n := c.NumberSessionsInProgress()
+
+		sess1, err := c.StartSession()
+		assert.NoError(t, err)
+
+		subtype, data, ok := sess1.ID().Lookup("id").BinaryOK()
+		assert.True(t, ok)
+		assert.Equal(t, byte(4), subtype)
+		assert.Len(t, data, 16)
+
+		sess2, err := c.StartSession()
+		assert.NoError(t, err)
+		assert.NotEqual(t, sess1.ID(), sess2.ID())
+
+		if _, ok := c.(*Client); ok {
+			assert.Equal(t, n+2, c.NumberSessionsInProgress())
+		}
+
+		id := sess2.ID()
+		sess2.EndSession(nil)
+		sess2.EndSession(nil)
+
+		sess3, err := c.StartSession()
+		assert.NoError(t, err)
+
+		if _, ok := c.(*Client); ok {
+			assert.Equal(t, id, sess3.ID())
+			assert.Equal(t, n+2, c.NumberSessionsInProgress())
+		}
+
+		sess1.EndSession(nil)
+		sess3.EndSession(nil)
+
+		if _, ok := c.(*Client); ok {
+			assert.Equal(t, n, c.NumberSessionsInProgress())
+		}
+	})
+}
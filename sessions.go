@@ -0,0 +1,140 @@
+package lungo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SessionInfo describes a server session of the engine pool.
+type SessionInfo struct {
+	// The logical session ID (lsid).
+	ID bson.Raw
+
+	// Whether the session is currently checked out by a session or operation.
+	Active bool
+
+	// The time the session has last been checked out or released.
+	LastUse time.Time
+}
+
+// ListSessions will return information about all server sessions that have
+// been created by the engine, ordered by their last use. The information is
+// also available using the $listLocalSessions and $listSessions aggregation
+// stages of the admin database.
+func (e *Engine) ListSessions() []SessionInfo {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// collect pooled sessions
+	pooled := make(map[string]bool, len(e.sessions))
+	for _, id := range e.sessions {
+		pooled[string(id)] = true
+	}
+
+	// collect sessions
+	list := make([]SessionInfo, 0, len(e.sessionUse))
+	for id, used := range e.sessionUse {
+		list = append(list, SessionInfo{
+			ID:      bson.Raw(id),
+			Active:  !pooled[id],
+			LastUse: used,
+		})
+	}
+
+	// sort sessions
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].LastUse.Equal(list[j].LastUse) {
+			return list[i].LastUse.Before(list[j].LastUse)
+		}
+		return string(list[i].ID) < string(list[j].ID)
+	})
+
+	return list
+}
+
+func (e *Engine) acquireSession() bson.Raw {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// increment counter
+	e.active++
+
+	// reuse last released session
+	var id bson.Raw
+	if n := len(e.sessions); n > 0 {
+		id = e.sessions[n-1]
+		e.sessions = e.sessions[:n-1]
+	} else {
+		id = newSessionID()
+	}
+
+	// set usage
+	e.sessionUse[string(id)] = time.Now()
+
+	return id
+}
+
+func (e *Engine) releaseSession(id bson.Raw) {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// decrement counter
+	e.active--
+
+	// add session to pool
+	e.sessions = append(e.sessions, id)
+
+	// set usage
+	e.sessionUse[string(id)] = time.Now()
+}
+
+func (e *Engine) sessionsInProgress() int {
+	// acquire lock
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.active
+}
+
+func newSessionID() bson.Raw {
+	// generate random (version 4) UUID
+	uuid := make([]byte, 16)
+	_, err := rand.Read(uuid)
+	if err != nil {
+		panic(err)
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	// encode id
+	id, err := bson.Marshal(bson.D{
+		{Key: "id", Value: primitive.Binary{Subtype: bsontype.BinaryUUID, Data: uuid}},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return id
+}
+
+func formatSessionID(id bson.Raw) string {
+	// get UUID
+	_, uuid, ok := id.Lookup("id").BinaryOK()
+	if !ok || len(uuid) != 16 {
+		return ""
+	}
+
+	// format UUID
+	str := hex.EncodeToString(uuid)
+
+	return str[:8] + "-" + str[8:12] + "-" + str[12:16] + "-" + str[16:20] + "-" + str[20:]
+}
@@ -2,11 +2,18 @@ package lungo
 
 import (
 	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/256dpi/lungo/dbkit"
+	"github.com/256dpi/lungo/mongokit"
 )
 
 // Store is the interface that describes storage adapters.
@@ -15,20 +22,139 @@ type Store interface {
 	Store(*Catalog) error
 }
 
+// Changes describes the namespaces that have been changed by a commit.
+type Changes struct {
+	// The created or modified namespaces.
+	Modified []Handle
+
+	// The dropped namespaces.
+	Dropped []Handle
+}
+
+// IncrementalStore is implemented by stores that persist only the changed
+// namespaces of a catalog. The engine calls StoreChanges instead of Store with
+// the new catalog and the namespaces changed since the previously stored
+// catalog.
+type IncrementalStore interface {
+	Store
+	StoreChanges(*Catalog, Changes) error
+}
+
+// LazyStore is implemented by stores that defer loading the documents of
+// namespaces until they are first accessed. The catalog returned by Load may
+// contain cold namespaces that only carry the indexes, options and size of a
+// namespace. Transactions pass cold namespaces to Resolve before accessing
+// them, which returns the loaded namespace. Resolve must return the same
+// loaded namespace for every call with the same cold namespace.
+type LazyStore interface {
+	Store
+	Cold(*mongokit.Collection) bool
+	Resolve(*mongokit.Collection) (*mongokit.Collection, error)
+}
+
+// StoreChanges will store the changes using the store. Stores that do not
+// implement IncrementalStore receive the full catalog.
+func StoreChanges(store Store, catalog *Catalog, changes Changes) error {
+	// store changes
+	if inc, ok := store.(IncrementalStore); ok {
+		return inc.StoreChanges(catalog, changes)
+	}
+
+	return store.Store(catalog)
+}
+
+// DiffCatalogs will return the namespaces that have been changed between the
+// two catalogs. As namespaces are copy on write, only the namespace pointers
+// are compared. A missing previous catalog is treated as empty.
+func DiffCatalogs(before, after *Catalog) Changes {
+	// collect modified namespaces
+	var changes Changes
+	for handle, namespace := range after.Namespaces {
+		if before == nil || before.Namespaces[handle] != namespace {
+			changes.Modified = append(changes.Modified, handle)
+		}
+	}
+
+	// collect dropped namespaces
+	if before != nil {
+		for handle := range before.Namespaces {
+			if _, ok := after.Namespaces[handle]; !ok {
+				changes.Dropped = append(changes.Dropped, handle)
+			}
+		}
+	}
+
+	// sort handles
+	sortHandles(changes.Modified)
+	sortHandles(changes.Dropped)
+
+	return changes
+}
+
+func sortHandles(handles []Handle) {
+	sort.Slice(handles, func(i, j int) bool {
+		if handles[i][0] != handles[j][0] {
+			return handles[i][0] < handles[j][0]
+		}
+		return handles[i][1] < handles[j][1]
+	})
+}
+
+// MemoryStoreOptions configures a memory store.
+type MemoryStoreOptions struct {
+	// The optional path of a file the catalog is written to when the store
+	// is closed. If the file exists, the catalog is loaded from it when the
+	// store is loaded the first time. This provides best-effort persistence
+	// without writing to disk on every commit.
+	SnapshotPath string
+
+	// The file mode used to write the snapshot.
+	//
+	// Default: 0666.
+	SnapshotMode os.FileMode
+}
+
 // MemoryStore holds the catalog in memory.
 type MemoryStore struct {
-	catalog *Catalog
+	catalog  *Catalog
+	snapshot *FileStore
+	loaded   bool
 }
 
 // NewMemoryStore creates and returns a new memory store.
-func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
+func NewMemoryStore(opts ...MemoryStoreOptions) *MemoryStore {
+	// prepare store
+	store := &MemoryStore{
 		catalog: NewCatalog(),
 	}
+
+	// prepare snapshot
+	for _, opt := range opts {
+		if opt.SnapshotPath != "" {
+			mode := opt.SnapshotMode
+			if mode == 0 {
+				mode = 0666
+			}
+			store.snapshot = NewFileStore(opt.SnapshotPath, mode)
+		}
+	}
+
+	return store
 }
 
-// Load will return the catalog.
+// Load will return the catalog. If a snapshot is configured, the catalog is
+// read from the snapshot file on the first call.
 func (m *MemoryStore) Load() (*Catalog, error) {
+	// load snapshot
+	if m.snapshot != nil && !m.loaded {
+		catalog, err := m.snapshot.Load()
+		if err != nil {
+			return nil, err
+		}
+		m.catalog = catalog
+		m.loaded = true
+	}
+
 	return m.catalog, nil
 }
 
@@ -38,6 +164,22 @@ func (m *MemoryStore) Store(data *Catalog) error {
 	return nil
 }
 
+// Close will write the catalog to the snapshot file, if configured.
+func (m *MemoryStore) Close() error {
+	// check snapshot
+	if m.snapshot == nil {
+		return nil
+	}
+
+	// write snapshot
+	err := m.snapshot.Store(m.catalog)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // FileStore writes the catalog to a single file on disk.
 type FileStore struct {
 	path string
@@ -98,3 +240,843 @@ func (s *FileStore) Store(catalog *Catalog) error {
 
 	return nil
 }
+
+// DirectoryStore writes each database of the catalog to a separate file in a
+// directory. Only the files of changed databases are rewritten and the files
+// of dropped databases are removed. This allows databases to be backed up,
+// restored and dropped independently. Unlike the FileStore, a catalog is not
+// written atomically as a whole but per database.
+type DirectoryStore struct {
+	path string
+	mode os.FileMode
+	last *Catalog
+}
+
+// NewDirectoryStore creates and returns a new directory store.
+func NewDirectoryStore(path string, mode os.FileMode) *DirectoryStore {
+	return &DirectoryStore{
+		path: path,
+		mode: mode,
+	}
+}
+
+// Load will read the catalog from the database files in the directory and
+// return it. If no directory exists at the specified location an empty
+// catalog is returned.
+func (s *DirectoryStore) Load() (*Catalog, error) {
+	// read directory
+	entries, err := os.ReadDir(s.path)
+	if os.IsNotExist(err) {
+		s.last = NewCatalog()
+		return s.last, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// prepare catalog
+	catalog := NewCatalog()
+
+	// load database files
+	for _, entry := range entries {
+		// check entry
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".bson") {
+			continue
+		}
+
+		// get database
+		database := strings.TrimSuffix(name, ".bson")
+
+		// load file
+		buf, err := os.ReadFile(filepath.Join(s.path, name))
+		if err != nil {
+			return nil, err
+		}
+
+		// decode file
+		var file File
+		err = bson.Unmarshal(buf, &file)
+		if err != nil {
+			return nil, err
+		}
+
+		// build catalog from file
+		dbCatalog, err := file.BuildCatalog()
+		if err != nil {
+			return nil, err
+		}
+
+		// add namespaces of database
+		for handle, namespace := range dbCatalog.Namespaces {
+			if handle[0] == database {
+				catalog.Namespaces[handle] = namespace
+			}
+		}
+	}
+
+	// set catalog
+	s.last = catalog
+
+	return catalog, nil
+}
+
+// Store will atomically write the files of all changed databases to disk and
+// remove the files of dropped databases.
+func (s *DirectoryStore) Store(catalog *Catalog) error {
+	return s.StoreChanges(catalog, DiffCatalogs(s.last, catalog))
+}
+
+// StoreChanges will atomically write the files of the databases with changed
+// namespaces to disk and remove the files of databases without namespaces.
+func (s *DirectoryStore) StoreChanges(catalog *Catalog, changes Changes) error {
+	// group namespaces
+	databases := groupDatabases(catalog)
+
+	// collect changed databases
+	changed := map[string]bool{}
+	for _, handle := range changes.Modified {
+		changed[handle[0]] = true
+	}
+	for _, handle := range changes.Dropped {
+		changed[handle[0]] = true
+	}
+
+	// ensure directory
+	err := os.MkdirAll(s.path, 0777)
+	if err != nil {
+		return err
+	}
+
+	// write or remove changed databases
+	for database := range changed {
+		// check name
+		if strings.ContainsAny(database, `/\`) {
+			return fmt.Errorf("invalid database name %q", database)
+		}
+
+		// get namespaces
+		namespaces := databases[database]
+
+		// remove dropped database
+		if len(namespaces) == 0 {
+			err = os.Remove(filepath.Join(s.path, database+".bson"))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		// build file from database
+		file := BuildFile(&Catalog{Namespaces: namespaces})
+
+		// encode file
+		buf, err := bson.Marshal(file)
+		if err != nil {
+			return err
+		}
+
+		// write file
+		err = dbkit.AtomicWriteFile(filepath.Join(s.path, database+".bson"), bytes.NewReader(buf), s.mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	// set catalog
+	s.last = catalog
+
+	return nil
+}
+
+func groupDatabases(catalog *Catalog) map[string]map[Handle]*mongokit.Collection {
+	// group namespaces by database
+	databases := map[string]map[Handle]*mongokit.Collection{}
+	for handle, namespace := range catalog.Namespaces {
+		if databases[handle[0]] == nil {
+			databases[handle[0]] = map[Handle]*mongokit.Collection{}
+		}
+		databases[handle[0]][handle] = namespace
+	}
+
+	return databases
+}
+
+// HybridStore writes each namespace of the catalog to a separate file in a
+// directory and keeps the indexes, options and sizes of all namespaces in an
+// additional catalog file. When loaded, only the catalog file and the
+// namespaces of the local database are read. The other namespaces are
+// returned as cold namespaces and their documents are read from disk when a
+// transaction accesses them for the first time. Afterwards, they are kept in
+// memory like with the other stores. This cuts the startup time of engines
+// with many rarely used collections. Like the DirectoryStore, only the files
+// of changed namespaces are rewritten.
+//
+// Engine.Catalog and Engine.Info report cold namespaces with their size, but
+// without documents. The documents of cold namespaces are not verified by
+// VerifyOnLoad as their indexes are rebuilt when loaded. The store must be
+// used directly by the engine to load namespaces lazily.
+type HybridStore struct {
+	path    string
+	mode    os.FileMode
+	last    *Catalog
+	meta    map[string]hybridNamespace
+	cold    map[*mongokit.Collection]*coldNamespace
+	handles map[Handle]*mongokit.Collection
+	mutex   sync.Mutex
+}
+
+type hybridFile struct {
+	Namespaces map[string]hybridNamespace `bson:"namespaces"`
+}
+
+type hybridNamespace struct {
+	Indexes    map[string]FileIndex `bson:"indexes"`
+	TimeSeries *FileTimeSeries      `bson:"timeseries,omitempty"`
+	PreImages  bool                 `bson:"preImages,omitempty"`
+	Size       int                  `bson:"size"`
+}
+
+type coldNamespace struct {
+	handle Handle
+	loaded *mongokit.Collection
+}
+
+// NewHybridStore creates and returns a new hybrid store.
+func NewHybridStore(path string, mode os.FileMode) *HybridStore {
+	return &HybridStore{
+		path:    path,
+		mode:    mode,
+		meta:    map[string]hybridNamespace{},
+		cold:    map[*mongokit.Collection]*coldNamespace{},
+		handles: map[Handle]*mongokit.Collection{},
+	}
+}
+
+// Load will read the catalog file and the namespaces of the local database
+// from the directory and return the catalog. All other namespaces are cold
+// until resolved. If no catalog file exists an empty catalog is returned.
+func (s *HybridStore) Load() (*Catalog, error) {
+	// acquire lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// reset state
+	s.meta = map[string]hybridNamespace{}
+	s.cold = map[*mongokit.Collection]*coldNamespace{}
+	s.handles = map[Handle]*mongokit.Collection{}
+
+	// load catalog file
+	buf, err := os.ReadFile(filepath.Join(s.path, "catalog.bson"))
+	if os.IsNotExist(err) {
+		s.last = NewCatalog()
+		return s.last, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// decode catalog file
+	var file hybridFile
+	err = bson.Unmarshal(buf, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare catalog
+	catalog := NewCatalog()
+
+	// add namespaces
+	for name, meta := range file.Namespaces {
+		// parse handle
+		handle, err := ParseHandle(name)
+		if err != nil || handle.IsDatabase() {
+			return nil, fmt.Errorf("invalid namespace name %q", name)
+		}
+
+		// load local namespaces
+		if handle[0] == Local {
+			namespace, err := s.read(handle)
+			if err != nil {
+				return nil, err
+			}
+			catalog.Namespaces[handle] = namespace
+			s.meta[name] = meta
+			continue
+		}
+
+		// build cold namespace from metadata
+		metaCatalog, err := (&File{
+			Namespaces: map[string]FileNamespace{
+				name: {
+					Indexes:    meta.Indexes,
+					TimeSeries: meta.TimeSeries,
+					PreImages:  meta.PreImages,
+				},
+			},
+		}).BuildCatalog()
+		if err != nil {
+			return nil, err
+		}
+		namespace := metaCatalog.Namespaces[handle]
+		namespace.Size = meta.Size
+
+		// add namespace
+		catalog.Namespaces[handle] = namespace
+		s.meta[name] = meta
+		s.cold[namespace] = &coldNamespace{handle: handle}
+		s.handles[handle] = namespace
+	}
+
+	// set catalog
+	s.last = catalog
+
+	return catalog, nil
+}
+
+// Cold will return whether the specified namespace is a cold namespace.
+func (s *HybridStore) Cold(namespace *mongokit.Collection) bool {
+	// acquire lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// check namespace
+	_, ok := s.cold[namespace]
+
+	return ok
+}
+
+// Resolve will return the loaded namespace for the specified cold namespace.
+// The namespace is read from disk on the first call. Other namespaces are
+// returned as is.
+func (s *HybridStore) Resolve(namespace *mongokit.Collection) (*mongokit.Collection, error) {
+	// acquire lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// check namespace
+	cold := s.cold[namespace]
+	if cold == nil {
+		return namespace, nil
+	}
+
+	return s.resolve(cold)
+}
+
+// Store will atomically write the files of all changed namespaces to disk and
+// remove the files of dropped namespaces.
+func (s *HybridStore) Store(catalog *Catalog) error {
+	return s.StoreChanges(catalog, DiffCatalogs(s.last, catalog))
+}
+
+// StoreChanges will atomically write the files of the changed namespaces and
+// the catalog file to disk and remove the files of dropped namespaces. Cold
+// namespaces and namespaces that have only been loaded are not rewritten.
+func (s *HybridStore) StoreChanges(catalog *Catalog, changes Changes) error {
+	// acquire lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// ensure directory
+	err := os.MkdirAll(s.path, 0777)
+	if err != nil {
+		return err
+	}
+
+	// write modified namespaces
+	changed := false
+	for _, handle := range changes.Modified {
+		// check name
+		if strings.ContainsAny(handle.String(), `/\`) {
+			return fmt.Errorf("invalid namespace name %q", handle.String())
+		}
+
+		// get namespace
+		namespace := catalog.Namespaces[handle]
+
+		// skip unchanged cold namespaces
+		if placeholder := s.handles[handle]; placeholder != nil {
+			if namespace == placeholder || namespace == s.cold[placeholder].loaded {
+				continue
+			}
+
+			// keep namespace available for older catalogs
+			_, err = s.resolve(s.cold[placeholder])
+			if err != nil {
+				return err
+			}
+			delete(s.handles, handle)
+		}
+
+		// resolve cold namespaces of other handles
+		if cold := s.cold[namespace]; cold != nil {
+			namespace, err = s.resolve(cold)
+			if err != nil {
+				return err
+			}
+		}
+
+		// build file from namespace
+		file := BuildFile(&Catalog{Namespaces: map[Handle]*mongokit.Collection{
+			handle: namespace,
+		}})
+
+		// encode file
+		buf, err := bson.Marshal(file)
+		if err != nil {
+			return err
+		}
+
+		// write file
+		err = dbkit.AtomicWriteFile(filepath.Join(s.path, handle.String()+".bson"), bytes.NewReader(buf), s.mode)
+		if err != nil {
+			return err
+		}
+
+		// update metadata
+		ns := file.Namespaces[handle.String()]
+		s.meta[handle.String()] = hybridNamespace{
+			Indexes:    ns.Indexes,
+			TimeSeries: ns.TimeSeries,
+			PreImages:  ns.PreImages,
+			Size:       namespace.Size,
+		}
+		changed = true
+	}
+
+	// remove metadata of dropped namespaces
+	for _, handle := range changes.Dropped {
+		// keep namespace available for older catalogs
+		if placeholder := s.handles[handle]; placeholder != nil {
+			_, err = s.resolve(s.cold[placeholder])
+			if err != nil {
+				return err
+			}
+			delete(s.handles, handle)
+		}
+
+		// remove metadata
+		delete(s.meta, handle.String())
+		changed = true
+	}
+
+	// write catalog file
+	if changed {
+		// encode catalog file
+		buf, err := bson.Marshal(hybridFile{Namespaces: s.meta})
+		if err != nil {
+			return err
+		}
+
+		// write catalog file
+		err = dbkit.AtomicWriteFile(filepath.Join(s.path, "catalog.bson"), bytes.NewReader(buf), s.mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	// remove files of dropped namespaces
+	for _, handle := range changes.Dropped {
+		err = os.Remove(filepath.Join(s.path, handle.String()+".bson"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// set catalog
+	s.last = catalog
+
+	return nil
+}
+
+func (s *HybridStore) resolve(cold *coldNamespace) (*mongokit.Collection, error) {
+	// check loaded
+	if cold.loaded != nil {
+		return cold.loaded, nil
+	}
+
+	// read namespace
+	namespace, err := s.read(cold.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	// set loaded
+	cold.loaded = namespace
+
+	return namespace, nil
+}
+
+func (s *HybridStore) read(handle Handle) (*mongokit.Collection, error) {
+	// load file
+	buf, err := os.ReadFile(filepath.Join(s.path, handle.String()+".bson"))
+	if err != nil {
+		return nil, err
+	}
+
+	// decode file
+	var file File
+	err = bson.Unmarshal(buf, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	// build catalog from file
+	catalog, err := file.BuildCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	// get namespace
+	namespace := catalog.Namespaces[handle]
+	if namespace == nil {
+		return nil, fmt.Errorf("missing namespace %q in file", handle.String())
+	}
+
+	return namespace, nil
+}
+
+// FlushStore wraps a store and defers writes to it. Instead of writing every
+// catalog, only the latest catalog is written at the configured interval.
+// Changes received using StoreChanges are accumulated and passed on together
+// to incremental stores. Errors from deferred writes are returned by the next
+// call to Store or StoreChanges. The catalogs committed since the last flush
+// are lost if the process exits before the store is flushed or closed.
+type FlushStore struct {
+	store    Store
+	interval time.Duration
+	pending  pendingWrite
+	timer    *time.Timer
+	err      error
+	mutex    sync.Mutex
+}
+
+// NewFlushStore creates and returns a new flush store.
+func NewFlushStore(store Store, interval time.Duration) *FlushStore {
+	return &FlushStore{
+		store:    store,
+		interval: interval,
+	}
+}
+
+// Load will load the catalog from the underlying store.
+func (s *FlushStore) Load() (*Catalog, error) {
+	return s.store.Load()
+}
+
+// Store will schedule the catalog to be written to the underlying store.
+func (s *FlushStore) Store(catalog *Catalog) error {
+	// acquire lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.schedule(catalog, nil)
+}
+
+// StoreChanges will schedule the changes to be written to the underlying store.
+func (s *FlushStore) StoreChanges(catalog *Catalog, changes Changes) error {
+	// acquire lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.schedule(catalog, &changes)
+}
+
+func (s *FlushStore) schedule(catalog *Catalog, changes *Changes) error {
+	// return error from deferred write
+	if s.err != nil {
+		err := s.err
+		s.err = nil
+		return err
+	}
+
+	// add write
+	s.pending.add(catalog, changes)
+
+	// schedule flush
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, func() {
+			// acquire lock
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			// unset timer
+			s.timer = nil
+
+			// flush catalog
+			s.err = s.flush()
+		})
+	}
+
+	return nil
+}
+
+// Flush will immediately write a pending catalog to the underlying store.
+func (s *FlushStore) Flush() error {
+	// acquire lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.flush()
+}
+
+// Close will stop the scheduled write and flush a pending catalog.
+func (s *FlushStore) Close() error {
+	// acquire lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// stop timer
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	return s.flush()
+}
+
+func (s *FlushStore) flush() error {
+	// write pending catalog
+	err := s.pending.write(s.store)
+	if err != nil {
+		return err
+	}
+
+	// reset write
+	s.pending = pendingWrite{}
+
+	return nil
+}
+
+// TeeStore writes catalogs synchronously to a primary store and mirrors them
+// asynchronously to a secondary store, e.g. on a network share, for cheap
+// disaster recovery. Only the latest catalog is mirrored and the changes of
+// skipped catalogs are merged and passed on together to incremental stores.
+// Failed mirror writes are reported and retried at the configured interval
+// until they succeed. Catalogs are always loaded from the primary store.
+type TeeStore struct {
+	primary   Store
+	secondary Store
+	interval  time.Duration
+	reporter  func(error)
+	pending   pendingWrite
+	signal    chan struct{}
+	done      chan struct{}
+	closed    bool
+	group     sync.WaitGroup
+	writing   sync.Mutex
+	mutex     sync.Mutex
+}
+
+// NewTeeStore creates and returns a new tee store. The optional reporter is
+// called with errors from failed mirror writes.
+func NewTeeStore(primary, secondary Store, retryInterval time.Duration, reporter func(error)) *TeeStore {
+	// create store
+	s := &TeeStore{
+		primary:   primary,
+		secondary: secondary,
+		interval:  retryInterval,
+		reporter:  reporter,
+		signal:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	// run mirror
+	s.group.Add(1)
+	go s.mirror()
+
+	return s
+}
+
+// Load will load the catalog from the primary store.
+func (s *TeeStore) Load() (*Catalog, error) {
+	return s.primary.Load()
+}
+
+// Store will write the catalog to the primary store and schedule it to be
+// mirrored to the secondary store.
+func (s *TeeStore) Store(catalog *Catalog) error {
+	return s.store(catalog, nil)
+}
+
+// StoreChanges will write the changes to the primary store and schedule them
+// to be mirrored to the secondary store.
+func (s *TeeStore) StoreChanges(catalog *Catalog, changes Changes) error {
+	return s.store(catalog, &changes)
+}
+
+func (s *TeeStore) store(catalog *Catalog, changes *Changes) error {
+	// write primary
+	var err error
+	if changes != nil {
+		err = StoreChanges(s.primary, catalog, *changes)
+	} else {
+		err = s.primary.Store(catalog)
+	}
+	if err != nil {
+		return err
+	}
+
+	// add write
+	s.mutex.Lock()
+	s.pending.add(catalog, changes)
+	s.mutex.Unlock()
+
+	// signal mirror
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Flush will immediately write a pending catalog to the secondary store.
+func (s *TeeStore) Flush() error {
+	// acquire write lock
+	s.writing.Lock()
+	defer s.writing.Unlock()
+
+	// take pending write
+	s.mutex.Lock()
+	pending := s.pending
+	s.pending = pendingWrite{}
+	s.mutex.Unlock()
+
+	// write secondary
+	err := pending.write(s.secondary)
+	if err != nil {
+		// requeue write, newer writes take precedence
+		s.mutex.Lock()
+		s.pending.merge(pending)
+		s.mutex.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// Close will stop the background mirroring and make a final attempt to mirror
+// a pending catalog.
+func (s *TeeStore) Close() error {
+	// stop mirror
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mutex.Unlock()
+	s.group.Wait()
+
+	return s.Flush()
+}
+
+func (s *TeeStore) mirror() {
+	// ensure done
+	defer s.group.Done()
+
+	for {
+		// await signal or close
+		select {
+		case <-s.signal:
+		case <-s.done:
+			return
+		}
+
+		// mirror until successful
+		for {
+			err := s.Flush()
+			if err == nil {
+				break
+			}
+
+			// report error
+			if s.reporter != nil {
+				s.reporter(err)
+			}
+
+			// await retry or close
+			select {
+			case <-time.After(s.interval):
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// pendingWrite accumulates catalogs and changes that have not yet been written
+// to a store. Only the latest catalog is retained.
+type pendingWrite struct {
+	catalog *Catalog
+	changes map[Handle]bool
+	full    bool
+}
+
+func (w *pendingWrite) add(catalog *Catalog, changes *Changes) {
+	// set catalog
+	w.catalog = catalog
+
+	// set flag if changes are unknown
+	if changes == nil {
+		w.full = true
+		return
+	}
+
+	// merge changes
+	if w.changes == nil {
+		w.changes = map[Handle]bool{}
+	}
+	for _, handle := range changes.Modified {
+		w.changes[handle] = true
+	}
+	for _, handle := range changes.Dropped {
+		w.changes[handle] = false
+	}
+}
+
+func (w *pendingWrite) merge(older pendingWrite) {
+	// use older write if empty
+	if w.catalog == nil {
+		*w = older
+		return
+	}
+
+	// merge flag
+	w.full = w.full || older.full
+
+	// merge older changes
+	for handle, modified := range older.changes {
+		if w.changes == nil {
+			w.changes = map[Handle]bool{}
+		}
+		if _, ok := w.changes[handle]; !ok {
+			w.changes[handle] = modified
+		}
+	}
+}
+
+func (w *pendingWrite) write(store Store) error {
+	// check catalog
+	if w.catalog == nil {
+		return nil
+	}
+
+	// write full catalog
+	if w.full {
+		return store.Store(w.catalog)
+	}
+
+	// collect changes
+	var changes Changes
+	for handle, modified := range w.changes {
+		if modified {
+			changes.Modified = append(changes.Modified, handle)
+		} else {
+			changes.Dropped = append(changes.Dropped, handle)
+		}
+	}
+	sortHandles(changes.Modified)
+	sortHandles(changes.Dropped)
+
+	return StoreChanges(store, w.catalog, changes)
+}
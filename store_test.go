@@ -1,17 +1,167 @@
 package lungo
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/256dpi/lungo/bsonkit"
 	"github.com/256dpi/lungo/mongokit"
 )
 
+func TestFileStoreDottedCollections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	client, engine, err := Open(nil, Options{
+		Store: NewFileStore(path, 0666),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("fs.files").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	engine.Close()
+
+	client, engine, err = Open(nil, Options{
+		Store: NewFileStore(path, 0666),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	n, err := client.Database("foo").Collection("fs.files").CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestFileStoreInvalidDatabaseName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	client, engine, err := Open(nil, Options{
+		Store: NewFileStore(path, 0666),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("a.b").Collection("x").InsertOne(nil, bson.M{"_id": "a"})
+	assert.Error(t, err)
+
+	_, err = client.Database("a").Collection("b.x").InsertOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	engine.Close()
+
+	client, engine, err = Open(nil, Options{
+		Store: NewFileStore(path, 0666),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	names, err := client.ListDatabaseNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "local"}, names)
+
+	assert.Equal(t, []bson.M{
+		{"_id": "b"},
+	}, dumpCollection(client.Database("a").Collection("b.x"), false))
+}
+
+func TestFileBuildCatalogIDIndex(t *testing.T) {
+	// missing id index
+	catalog, err := (&File{
+		Namespaces: map[string]FileNamespace{
+			"foo.bar": {
+				Documents: bsonkit.List{
+					bsonkit.MustConvert(bson.M{"_id": "a"}),
+					bsonkit.MustConvert(bson.M{"_id": "b"}),
+				},
+			},
+		},
+	}).BuildCatalog()
+	assert.NoError(t, err)
+
+	namespace := catalog.Namespaces[Handle{"foo", "bar"}]
+	assert.NotNil(t, namespace.Indexes["_id_"])
+	assert.Equal(t, 2, namespace.Indexes["_id_"].Len())
+
+	_, errs, err := namespace.InsertMany(bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": "a"}),
+	}, true)
+	assert.NoError(t, err)
+	assert.Error(t, errs[0])
+	assert.Equal(t, `duplicate document for index "_id_"`, errs[0].Error())
+
+	// invalid id index
+	catalog, err = (&File{
+		Namespaces: map[string]FileNamespace{
+			"foo.bar": {
+				Documents: bsonkit.List{
+					bsonkit.MustConvert(bson.M{"_id": "a"}),
+				},
+				Indexes: map[string]FileIndex{
+					"_id_": {
+						Key: bsonkit.MustConvert(bson.M{"_id": int32(1)}),
+					},
+				},
+			},
+		},
+	}).BuildCatalog()
+	assert.NoError(t, err)
+	assert.True(t, catalog.Namespaces[Handle{"foo", "bar"}].Indexes["_id_"].Config().Unique)
+
+	// duplicate documents
+	_, err = (&File{
+		Namespaces: map[string]FileNamespace{
+			"foo.bar": {
+				Documents: bsonkit.List{
+					bsonkit.MustConvert(bson.M{"_id": "a"}),
+					bsonkit.MustConvert(bson.M{"_id": "a"}),
+				},
+			},
+		},
+	}).BuildCatalog()
+	assert.Error(t, err)
+	assert.Equal(t, `duplicate document for index "_id_"`, err.Error())
+}
+
+func TestMemoryStoreSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(MemoryStoreOptions{SnapshotPath: path}),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	engine.Close()
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+
+	client, engine, err = Open(nil, Options{
+		Store: NewMemoryStore(MemoryStoreOptions{SnapshotPath: path}),
+	})
+	assert.NoError(t, err)
+
+	n, err := client.Database("foo").Collection("bar").CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	engine.Close()
+}
+
 func TestFileStore(t *testing.T) {
 	_ = os.Remove("./test.bson")
 
@@ -184,3 +334,445 @@ func TestFileStore(t *testing.T) {
 
 	engine.Close()
 }
+
+func TestFlushStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.bson")
+
+	file := NewFileStore(path, 0666)
+	store := NewFlushStore(file, 50*time.Millisecond)
+
+	engine, err := CreateEngine(Options{Store: store})
+	assert.NoError(t, err)
+
+	txn, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	_, err = txn.Insert(Handle{"foo", "bar"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": "a"}),
+	}, false)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	time.Sleep(100 * time.Millisecond)
+
+	catalog, err := file.Load()
+	assert.NoError(t, err)
+	assert.Len(t, catalog.Namespaces[Handle{"foo", "bar"}].Documents.List, 1)
+
+	txn, err = engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	_, err = txn.Insert(Handle{"foo", "bar"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": "b"}),
+	}, false)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn)
+	assert.NoError(t, err)
+
+	catalog, err = file.Load()
+	assert.NoError(t, err)
+	assert.Len(t, catalog.Namespaces[Handle{"foo", "bar"}].Documents.List, 1)
+
+	engine.Close()
+
+	catalog, err = file.Load()
+	assert.NoError(t, err)
+	assert.Len(t, catalog.Namespaces[Handle{"foo", "bar"}].Documents.List, 2)
+}
+
+func TestDirectoryStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+
+	client, engine, err := Open(nil, Options{
+		Store: NewDirectoryStore(dir, 0666),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	_, err = client.Database("bar").Collection("baz").InsertOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.bson"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "bar.bson"),
+		filepath.Join(dir, "foo.bson"),
+		filepath.Join(dir, "local.bson"),
+	}, files)
+
+	info1, err := os.Stat(filepath.Join(dir, "foo.bson"))
+	assert.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = client.Database("bar").Collection("baz").InsertOne(nil, bson.M{"_id": "c"})
+	assert.NoError(t, err)
+
+	info2, err := os.Stat(filepath.Join(dir, "foo.bson"))
+	assert.NoError(t, err)
+	assert.Equal(t, info1.ModTime(), info2.ModTime())
+
+	err = client.Database("foo").Drop(nil)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "foo.bson"))
+	assert.True(t, os.IsNotExist(err))
+
+	engine.Close()
+
+	client, engine, err = Open(nil, Options{
+		Store: NewDirectoryStore(dir, 0666),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	names, err := client.ListDatabaseNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"bar", "local"}, names)
+
+	assert.Equal(t, []bson.M{
+		{"_id": "b"},
+		{"_id": "c"},
+	}, dumpCollection(client.Database("bar").Collection("baz"), false))
+}
+
+func TestHybridStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+
+	client, engine, err := Open(nil, Options{
+		Store: NewHybridStore(dir, 0666),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys: bson.M{"foo": 1},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("baz").InsertOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.bson"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "catalog.bson"),
+		filepath.Join(dir, "foo.bar.bson"),
+		filepath.Join(dir, "foo.baz.bson"),
+		filepath.Join(dir, "local.oplog.bson"),
+	}, files)
+
+	size := engine.Catalog().Size()
+	engine.Close()
+
+	store := NewHybridStore(dir, 0666)
+	client, engine, err = Open(nil, Options{
+		Store: store,
+	})
+	assert.NoError(t, err)
+
+	bar := engine.Catalog().Namespaces[Handle{"foo", "bar"}]
+	baz := engine.Catalog().Namespaces[Handle{"foo", "baz"}]
+	assert.True(t, store.Cold(bar))
+	assert.True(t, store.Cold(baz))
+	assert.False(t, store.Cold(engine.Catalog().Namespaces[Oplog]))
+	assert.Equal(t, size, engine.Catalog().Size())
+
+	names, err := client.Database("foo").ListCollectionNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"bar", "baz"}, names)
+
+	csr, err := client.Database("foo").Collection("bar").Indexes().List(nil)
+	assert.NoError(t, err)
+	assert.Len(t, readAll(csr), 2)
+
+	assert.Nil(t, store.cold[bar].loaded)
+	assert.Nil(t, store.cold[baz].loaded)
+
+	count, err := client.Database("foo").Collection("bar").CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	assert.NotNil(t, store.cold[bar].loaded)
+	assert.Nil(t, store.cold[baz].loaded)
+
+	info1, err := os.Stat(filepath.Join(dir, "foo.baz.bson"))
+	assert.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "c"})
+	assert.NoError(t, err)
+
+	info2, err := os.Stat(filepath.Join(dir, "foo.baz.bson"))
+	assert.NoError(t, err)
+	assert.Equal(t, info1.ModTime(), info2.ModTime())
+
+	assert.False(t, store.Cold(engine.Catalog().Namespaces[Handle{"foo", "bar"}]))
+	assert.True(t, store.Cold(engine.Catalog().Namespaces[Handle{"foo", "baz"}]))
+	assert.Nil(t, store.cold[baz].loaded)
+
+	err = client.Database("foo").Collection("baz").Drop(nil)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "foo.baz.bson"))
+	assert.True(t, os.IsNotExist(err))
+
+	engine.Close()
+
+	client, engine, err = Open(nil, Options{
+		Store: NewHybridStore(dir, 0666),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	names, err = client.Database("foo").ListCollectionNames(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bar"}, names)
+
+	assert.Equal(t, []bson.M{
+		{"_id": "a"},
+		{"_id": "c"},
+	}, dumpCollection(client.Database("foo").Collection("bar"), false))
+}
+
+func TestHybridStoreConcurrency(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+
+	client, engine, err := Open(nil, Options{
+		Store: NewHybridStore(dir, 0666),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	engine.Close()
+
+	engine, err = CreateEngine(Options{
+		Store:                 NewHybridStore(dir, 0666),
+		OptimisticConcurrency: true,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	handle := Handle{"foo", "bar"}
+	query := bsonkit.MustConvert(bson.M{})
+
+	txn1, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	txn2, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	res, err := txn2.Find(handle, query, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res.Matched, 1)
+
+	_, err = txn2.Insert(Handle{"foo", "baz"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": "b"}),
+	}, true)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn2)
+	assert.NoError(t, err)
+
+	_, err = txn1.Insert(handle, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": "c"}),
+	}, true)
+	assert.NoError(t, err)
+
+	err = engine.Commit(txn1)
+	assert.NoError(t, err)
+
+	txn3, err := engine.Begin(nil, false)
+	assert.NoError(t, err)
+
+	res, err = txn3.Find(handle, query, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res.Matched, 2)
+}
+
+type changesStore struct {
+	*MemoryStore
+	changes []Changes
+}
+
+func (s *changesStore) StoreChanges(catalog *Catalog, changes Changes) error {
+	s.changes = append(s.changes, changes)
+	return s.MemoryStore.Store(catalog)
+}
+
+func TestIncrementalStore(t *testing.T) {
+	store := &changesStore{MemoryStore: NewMemoryStore()}
+
+	client, engine, err := Open(nil, Options{
+		Store: store,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("baz").InsertOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("baz").Find(nil, bson.M{})
+	assert.NoError(t, err)
+
+	err = client.Database("foo").Collection("bar").Drop(nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Changes{
+		{Modified: []Handle{{"foo", "bar"}, {"local", "oplog"}}},
+		{Modified: []Handle{{"foo", "baz"}, {"local", "oplog"}}},
+		{Modified: []Handle{{"local", "oplog"}}, Dropped: []Handle{{"foo", "bar"}}},
+	}, store.changes)
+}
+
+func TestFlushStoreChanges(t *testing.T) {
+	inner := &changesStore{MemoryStore: NewMemoryStore()}
+	store := NewFlushStore(inner, time.Hour)
+
+	catalog := NewCatalog()
+	err := store.StoreChanges(catalog, Changes{
+		Modified: []Handle{{"foo", "bar"}, {"foo", "baz"}},
+	})
+	assert.NoError(t, err)
+
+	err = store.StoreChanges(catalog, Changes{
+		Modified: []Handle{{"foo", "qux"}},
+		Dropped:  []Handle{{"foo", "bar"}},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, inner.changes)
+
+	err = store.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, []Changes{
+		{Modified: []Handle{{"foo", "baz"}, {"foo", "qux"}}, Dropped: []Handle{{"foo", "bar"}}},
+	}, inner.changes)
+
+	err = store.Store(catalog)
+	assert.NoError(t, err)
+
+	err = store.Close()
+	assert.NoError(t, err)
+	assert.Len(t, inner.changes, 1)
+	assert.Equal(t, catalog, inner.catalog)
+}
+
+func TestDiffCatalogs(t *testing.T) {
+	ns := mongokit.NewCollection(false)
+
+	before := NewCatalog()
+	before.Namespaces[Handle{"foo", "bar"}] = ns
+	before.Namespaces[Handle{"foo", "baz"}] = ns
+
+	after := before.Clone()
+	after.Namespaces[Handle{"foo", "bar"}] = ns.Clone()
+	after.Namespaces[Handle{"bar", "foo"}] = ns
+	delete(after.Namespaces, Handle{"foo", "baz"})
+
+	assert.Equal(t, Changes{
+		Modified: []Handle{{"bar", "foo"}, {"foo", "bar"}},
+		Dropped:  []Handle{{"foo", "baz"}},
+	}, DiffCatalogs(before, after))
+
+	assert.Equal(t, Changes{
+		Modified: []Handle{{"foo", "bar"}, {"foo", "baz"}, {"local", "oplog"}},
+	}, DiffCatalogs(nil, before))
+}
+
+type failingStore struct {
+	*changesStore
+	failures int
+	mutex    sync.Mutex
+}
+
+func (s *failingStore) StoreChanges(catalog *Catalog, changes Changes) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return fmt.Errorf("failure")
+	}
+	return s.changesStore.StoreChanges(catalog, changes)
+}
+
+func (s *failingStore) get() ([]Changes, *Catalog) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.changes, s.catalog
+}
+
+func TestTeeStore(t *testing.T) {
+	primary := NewMemoryStore()
+	secondary := &failingStore{
+		changesStore: &changesStore{MemoryStore: NewMemoryStore()},
+		failures:     2,
+	}
+
+	var errs int32
+	store := NewTeeStore(primary, secondary, 10*time.Millisecond, func(err error) {
+		assert.Error(t, err)
+		atomic.AddInt32(&errs, 1)
+	})
+
+	client, engine, err := Open(nil, Options{
+		Store: store,
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("foo").Collection("bar").InsertOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+	assert.Len(t, primary.catalog.Namespaces[Handle{"foo", "bar"}].Documents.List, 1)
+
+	assert.Eventually(t, func() bool {
+		changes, _ := secondary.get()
+		return len(changes) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&errs))
+
+	changes, catalog := secondary.get()
+	assert.Equal(t, []Changes{
+		{Modified: []Handle{{"foo", "bar"}, {"local", "oplog"}}},
+	}, changes)
+	assert.Equal(t, primary.catalog, catalog)
+
+	secondary.mutex.Lock()
+	secondary.failures = 1000
+	secondary.mutex.Unlock()
+
+	_, err = client.Database("foo").Collection("baz").InsertOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	err = client.Database("foo").Collection("bar").Drop(nil)
+	assert.NoError(t, err)
+
+	time.Sleep(30 * time.Millisecond)
+
+	secondary.mutex.Lock()
+	secondary.failures = 0
+	secondary.mutex.Unlock()
+
+	engine.Close()
+
+	changes, catalog = secondary.get()
+	assert.Equal(t, []Changes{
+		{Modified: []Handle{{"foo", "bar"}, {"local", "oplog"}}},
+		{Modified: []Handle{{"foo", "baz"}, {"local", "oplog"}}, Dropped: []Handle{{"foo", "bar"}}},
+	}, changes)
+	assert.Equal(t, primary.catalog, catalog)
+}
@@ -3,34 +3,47 @@ package lungo
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"sync"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
 )
 
 // ErrLostOplogPosition may be returned by a stream when the oplog position has
 // been lost. This can happen if a consumer is slower than the expiration of
-// oplog entries.
+// oplog entries. It is also returned when resuming a stream from a token that
+// is older than the oldest retained oplog entry.
 var ErrLostOplogPosition = errors.New("lost oplog position")
 
-// Stream provides a mongo compatible way to read oplog events.
+// Stream provides a mongo compatible way to read oplog events. Events are
+// passed through the pipeline before delivery, which may contain $match,
+// $project and $unset stages.
 type Stream struct {
-	handle   Handle
-	last     bsonkit.Doc
-	pipeline bsonkit.List
-	signal   chan struct{}
-	oplog    func() *bsonkit.Set
-	cancel   func()
-	event    bsonkit.Doc
-	token    interface{}
-	dropped  bool
-	closed   bool
-	error    error
-	mutex    sync.Mutex
+	handle                   Handle
+	last                     bsonkit.Doc
+	pipeline                 bsonkit.List
+	signal                   chan struct{}
+	oplog                    func() *bsonkit.Set
+	lookup                   func(Handle, interface{}) (bsonkit.Doc, error)
+	decrypt                  func(Handle, bsonkit.Doc) (bsonkit.Doc, error)
+	cancel                   func()
+	event                    bsonkit.Doc
+	token                    interface{}
+	registry                 *bsoncodec.Registry
+	fullDocument             options.FullDocument
+	fullDocumentBeforeChange options.FullDocument
+	dropped                  bool
+	closed                   bool
+	error                    error
+	mutex                    sync.Mutex
 }
 
 // Close implements the IChangeStream.Close method.
@@ -63,7 +76,7 @@ func (s *Stream) Decode(out interface{}) error {
 	}
 
 	// decode event
-	err := bsonkit.Decode(s.event, out)
+	err := bsonkit.DecodeWithRegistry(s.registry, s.event, out)
 	if err != nil {
 		return err
 	}
@@ -149,7 +162,7 @@ func (s *Stream) next(ctx context.Context, block bool) bool {
 		// get index
 		index := -1
 		if s.last != nil {
-			i, ok := oplog.Index[s.last]
+			i, ok := oplog.Position(s.last)
 			if !ok {
 				s.cancel()
 				s.closed = true
@@ -179,18 +192,28 @@ func (s *Stream) next(ctx context.Context, block bool) bool {
 				continue
 			}
 
-			// check drop and drop database
-			if s.handle[0] != "" && s.handle[1] != "" && opType == "drop" {
+			// check drop, rename and drop database
+			if s.handle[0] != "" && s.handle[1] != "" && (opType == "drop" || opType == "rename") {
 				s.dropped = true
 			} else if s.handle[0] != "" && opType == "dropDatabase" {
 				s.dropped = true
 			}
 
-			// TODO: Filter with pipeline.
+			// process event
+			processed, err := s.process(event)
+			if err != nil {
+				s.cancel()
+				s.closed = true
+				s.error = err
+				return false
+			} else if processed == nil {
+				s.last = event
+				continue
+			}
 
 			// set event and token
 			s.last = event
-			s.event = event
+			s.event = processed
 			s.token = token
 
 			return true
@@ -227,3 +250,199 @@ func (s *Stream) next(ctx context.Context, block bool) bool {
 		}
 	}
 }
+
+func (s *Stream) process(event bsonkit.Doc) (bsonkit.Doc, error) {
+	// handle full document of update events
+	if bsonkit.Get(event, "operationType") == "update" {
+		switch s.fullDocument {
+		case options.WhenAvailable, options.Required:
+			// keep post image
+		case options.UpdateLookup:
+			// lookup current document
+			doc, err := s.lookup(Handle{
+				bsonkit.Get(event, "ns.db").(string),
+				bsonkit.Get(event, "ns.coll").(string),
+			}, bsonkit.Get(event, "documentKey._id"))
+			if err != nil {
+				return nil, err
+			}
+
+			// set full document
+			event = bsonkit.Clone(event)
+			if doc != nil {
+				_, err = bsonkit.Put(event, "fullDocument", *doc, false)
+			} else {
+				_, err = bsonkit.Put(event, "fullDocument", nil, false)
+			}
+			if err != nil {
+				return nil, err
+			}
+		default:
+			// remove full document
+			event = bsonkit.Clone(event)
+			bsonkit.Unset(event, "fullDocument")
+		}
+	}
+
+	// handle full document before change of update, replace and delete events
+	switch bsonkit.Get(event, "operationType") {
+	case "update", "replace", "delete":
+		before := bsonkit.Get(event, "fullDocumentBeforeChange")
+		switch s.fullDocumentBeforeChange {
+		case options.WhenAvailable, options.Required:
+			// check pre image
+			if before != bsonkit.Missing {
+				break
+			} else if s.fullDocumentBeforeChange == options.Required {
+				return nil, fmt.Errorf("full document before change is not available")
+			}
+
+			// set missing pre image
+			event = bsonkit.Clone(event)
+			_, err := bsonkit.Put(event, "fullDocumentBeforeChange", nil, false)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			// remove pre image
+			if before != bsonkit.Missing {
+				event = bsonkit.Clone(event)
+				bsonkit.Unset(event, "fullDocumentBeforeChange")
+			}
+		}
+	}
+
+	// decrypt full documents
+	if coll, ok := bsonkit.Get(event, "ns.coll").(string); ok {
+		handle := Handle{bsonkit.Get(event, "ns.db").(string), coll}
+		cloned := false
+		for _, field := range []string{"fullDocument", "fullDocumentBeforeChange"} {
+			// get document
+			doc, ok := bsonkit.Get(event, field).(bson.D)
+			if !ok {
+				continue
+			}
+
+			// decrypt document
+			res, err := s.decrypt(handle, &doc)
+			if err != nil {
+				return nil, err
+			} else if res == &doc {
+				continue
+			}
+
+			// set document
+			if !cloned {
+				event = bsonkit.Clone(event)
+				cloned = true
+			}
+			_, err = bsonkit.Put(event, field, *res, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// get token
+	token := bsonkit.Get(event, "_id")
+
+	// run pipeline
+	for _, stage := range s.pipeline {
+		// get operator and argument
+		op, arg := (*stage)[0].Key, (*stage)[0].Value
+
+		switch op {
+		case "$match":
+			// match event
+			query := arg.(bson.D)
+			ok, err := mongokit.Match(event, &query)
+			if err != nil {
+				return nil, err
+			} else if !ok {
+				return nil, nil
+			}
+		case "$project":
+			// project event
+			projection := arg.(bson.D)
+			res, err := mongokit.Project(event, &projection)
+			if err != nil {
+				return nil, err
+			}
+			event = res
+		case "$unset":
+			// unset fields
+			event = bsonkit.Clone(event)
+			for _, path := range unsetPaths(arg) {
+				bsonkit.Unset(event, path)
+			}
+		}
+	}
+
+	// check token
+	if bsonkit.Compare(token, bsonkit.Get(event, "_id")) != 0 {
+		return nil, fmt.Errorf("change stream pipeline modified the resume token")
+	}
+
+	return event, nil
+}
+
+func validatePipeline(pipeline bsonkit.List) error {
+	for _, stage := range pipeline {
+		// check stage
+		if len(*stage) != 1 {
+			return fmt.Errorf("invalid change stream pipeline stage")
+		}
+
+		// check operator and argument
+		op, arg := (*stage)[0].Key, (*stage)[0].Value
+		switch op {
+		case "$match", "$project":
+			if _, ok := arg.(bson.D); !ok {
+				return fmt.Errorf("expected document for %s stage", op)
+			}
+		case "$unset":
+			if unsetPaths(arg) == nil {
+				return fmt.Errorf("expected string or array of strings for $unset stage")
+			}
+		default:
+			return fmt.Errorf("unsupported change stream pipeline stage %q", op)
+		}
+	}
+
+	return nil
+}
+
+func unsetPaths(arg interface{}) []string {
+	switch arg := arg.(type) {
+	case string:
+		return []string{arg}
+	case bson.A:
+		paths := make([]string, 0, len(arg))
+		for _, item := range arg {
+			str, ok := item.(string)
+			if !ok {
+				return nil
+			}
+			paths = append(paths, str)
+		}
+		return paths
+	default:
+		return nil
+	}
+}
+
+func resumeError(oplog *bsonkit.Set, token bsonkit.Doc) error {
+	// check if the token predates the oldest retained event
+	ts, ok := bsonkit.Get(token, "ts").(primitive.Timestamp)
+	if ok {
+		if len(oplog.List) == 0 {
+			return ErrLostOplogPosition
+		}
+		first := bsonkit.Get(oplog.List[0], "clusterTime")
+		if bsonkit.Compare(ts, first) < 0 {
+			return ErrLostOplogPosition
+		}
+	}
+
+	return fmt.Errorf("unable to resume change stream")
+}
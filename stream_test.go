@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -814,6 +815,95 @@ func TestStreamInvalidationCollection(t *testing.T) {
 	})
 }
 
+func TestStreamInvalidationRename(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		_, err := c.InsertOne(nil, bson.M{})
+		assert.NoError(t, err)
+
+		stream, err := c.Watch(nil, bson.A{})
+		assert.NoError(t, err)
+		assert.NotNil(t, stream)
+
+		dbStream, err := c.Database().Watch(nil, bson.A{})
+		assert.NoError(t, err)
+		assert.NotNil(t, dbStream)
+
+		/* rename */
+
+		name := collectionName()
+		err = c.Database().Client().Database("admin").RunCommand(nil, bson.D{
+			{Key: "renameCollection", Value: c.Database().Name() + "." + c.Name()},
+			{Key: "to", Value: c.Database().Name() + "." + name},
+		}).Err()
+		assert.NoError(t, err)
+
+		ret := stream.Next(nil)
+		assert.True(t, ret)
+
+		var event bson.M
+		err = stream.Decode(&event)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, event["_id"])
+		assert.NotEmpty(t, event["clusterTime"])
+		assert.Equal(t, bson.M{
+			"_id":         event["_id"],
+			"clusterTime": event["clusterTime"],
+			"ns": bson.M{
+				"db":   c.Database().Name(),
+				"coll": c.Name(),
+			},
+			"to": bson.M{
+				"db":   c.Database().Name(),
+				"coll": name,
+			},
+			"operationType": "rename",
+		}, event)
+
+		/* invalidate */
+
+		ret = stream.Next(nil)
+		assert.True(t, ret)
+
+		event = nil
+		err = stream.Decode(&event)
+		assert.NoError(t, err)
+		assert.Equal(t, "invalidate", event["operationType"])
+
+		ret = stream.Next(nil)
+		assert.False(t, ret)
+		assert.NoError(t, stream.Err())
+
+		/* database stream */
+
+		ret = dbStream.Next(nil)
+		assert.True(t, ret)
+
+		event = nil
+		err = dbStream.Decode(&event)
+		assert.NoError(t, err)
+		assert.Equal(t, "rename", event["operationType"])
+
+		_, err = c.Database().Collection(name).InsertOne(nil, bson.M{})
+		assert.NoError(t, err)
+
+		ret = dbStream.Next(nil)
+		assert.True(t, ret)
+
+		event = nil
+		err = dbStream.Decode(&event)
+		assert.NoError(t, err)
+		assert.Equal(t, "insert", event["operationType"])
+
+		/* close */
+
+		err = stream.Close(nil)
+		assert.NoError(t, err)
+
+		err = dbStream.Close(nil)
+		assert.NoError(t, err)
+	})
+}
+
 func TestStreamInvalidationDatabase(t *testing.T) {
 	clientTest(t, func(t *testing.T, c IClient) {
 		db := c.Database("test-lungo-stream")
@@ -1088,3 +1178,286 @@ func TestStreamLostOplogPosition(t *testing.T) {
 	err = stream.Err()
 	assert.True(t, errors.Is(ErrLostOplogPosition, err))
 }
+
+func TestStreamPipeline(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		stream, err := c.Watch(nil, bson.A{
+			bson.M{"$match": bson.M{
+				"operationType":    "insert",
+				"fullDocument.foo": "bar",
+			}},
+			bson.M{"$project": bson.M{
+				"operationType": 1,
+				"fullDocument":  1,
+			}},
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, stream)
+
+		id1 := primitive.NewObjectID()
+		id2 := primitive.NewObjectID()
+
+		_, err = c.InsertOne(nil, bson.M{"_id": id1, "foo": "baz"})
+		assert.NoError(t, err)
+
+		_, err = c.InsertOne(nil, bson.M{"_id": id2, "foo": "bar"})
+		assert.NoError(t, err)
+
+		_, err = c.DeleteOne(nil, bson.M{"_id": id2})
+		assert.NoError(t, err)
+
+		ret := stream.Next(nil)
+		assert.True(t, ret)
+
+		var event bson.M
+		err = stream.Decode(&event)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, event["_id"])
+		assert.Equal(t, bson.M{
+			"_id":           event["_id"],
+			"operationType": "insert",
+			"fullDocument": bson.M{
+				"_id": id2,
+				"foo": "bar",
+			},
+		}, event)
+
+		ret = stream.TryNext(nil)
+		assert.False(t, ret)
+
+		err = stream.Close(nil)
+		assert.NoError(t, err)
+	})
+}
+
+func TestStreamPipelineErrors(t *testing.T) {
+	c := testLungoClient.Database(testDB).Collection(collectionName())
+
+	_, err := c.Watch(nil, bson.A{
+		bson.M{"$group": bson.M{"_id": nil}},
+	})
+	assert.Error(t, err)
+
+	_, err = c.Watch(nil, bson.A{
+		bson.M{"$unset": 1},
+	})
+	assert.Error(t, err)
+
+	stream, err := c.Watch(nil, bson.A{
+		bson.M{"$unset": "_id"},
+	})
+	assert.NoError(t, err)
+
+	_, err = c.InsertOne(nil, bson.M{})
+	assert.NoError(t, err)
+
+	ret := stream.TryNext(nil)
+	assert.False(t, ret)
+	assert.Error(t, stream.Err())
+}
+
+func TestStreamFullDocument(t *testing.T) {
+	collectionTest(t, func(t *testing.T, c ICollection) {
+		id := primitive.NewObjectID()
+
+		_, err := c.InsertOne(nil, bson.M{"_id": id, "foo": "bar"})
+		assert.NoError(t, err)
+
+		plain, err := c.Watch(nil, bson.A{})
+		assert.NoError(t, err)
+
+		lookup, err := c.Watch(nil, bson.A{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+		assert.NoError(t, err)
+
+		_, err = c.UpdateOne(nil, bson.M{"_id": id}, bson.M{
+			"$set": bson.M{"foo": "baz"},
+		})
+		assert.NoError(t, err)
+
+		_, err = c.DeleteOne(nil, bson.M{"_id": id})
+		assert.NoError(t, err)
+
+		/* default */
+
+		ret := plain.Next(nil)
+		assert.True(t, ret)
+
+		var event bson.M
+		err = plain.Decode(&event)
+		assert.NoError(t, err)
+		assert.Equal(t, "update", event["operationType"])
+		assert.NotContains(t, event, "fullDocument")
+
+		/* update lookup */
+
+		ret = lookup.Next(nil)
+		assert.True(t, ret)
+
+		event = nil
+		err = lookup.Decode(&event)
+		assert.NoError(t, err)
+		assert.Equal(t, "update", event["operationType"])
+		assert.Contains(t, event, "fullDocument")
+		assert.Nil(t, event["fullDocument"])
+	})
+}
+
+func TestStreamResumptionAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.bson")
+
+	client, engine, err := Open(nil, Options{
+		Store: NewFileStore(path, 0666),
+	})
+	assert.NoError(t, err)
+
+	c := client.Database("foo").Collection("bar")
+
+	stream, err := c.Watch(nil, bson.A{})
+	assert.NoError(t, err)
+
+	_, err = c.InsertOne(nil, bson.M{"_id": 1})
+	assert.NoError(t, err)
+
+	ret := stream.Next(nil)
+	assert.True(t, ret)
+
+	token := stream.ResumeToken()
+	assert.NotNil(t, token)
+
+	engine.Close()
+
+	/* restart */
+
+	client, engine, err = Open(nil, Options{
+		Store: NewFileStore(path, 0666),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	c = client.Database("foo").Collection("bar")
+
+	_, err = c.InsertOne(nil, bson.M{"_id": 2})
+	assert.NoError(t, err)
+
+	stream, err = c.Watch(nil, bson.A{}, options.ChangeStream().SetResumeAfter(token))
+	assert.NoError(t, err)
+
+	ret = stream.TryNext(nil)
+	assert.True(t, ret)
+
+	var event bson.M
+	err = stream.Decode(&event)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), event["documentKey"].(bson.M)["_id"])
+
+	ret = stream.TryNext(nil)
+	assert.False(t, ret)
+
+	/* lost position */
+
+	txn, err := engine.Begin(nil, true)
+	assert.NoError(t, err)
+
+	txn.Clean(0, 0, 0, time.Hour)
+
+	err = engine.Commit(txn)
+	assert.NoError(t, err)
+
+	_, err = c.InsertOne(nil, bson.M{"_id": 3})
+	assert.NoError(t, err)
+
+	_, err = c.Watch(nil, bson.A{}, options.ChangeStream().SetResumeAfter(token))
+	assert.True(t, errors.Is(err, ErrLostOplogPosition))
+}
+
+func TestStreamFullDocumentBeforeChange(t *testing.T) {
+	databaseTest(t, func(t *testing.T, d IDatabase) {
+		if _, ok := d.(*Database); !ok {
+			return
+		}
+
+		name := collectionName()
+		err := d.CreateCollection(nil, name, options.CreateCollection().SetChangeStreamPreAndPostImages(bson.M{
+			"enabled": true,
+		}))
+		assert.NoError(t, err)
+
+		c := d.Collection(name)
+		_, err = c.InsertOne(nil, bson.M{"_id": "a", "foo": "bar"})
+		assert.NoError(t, err)
+
+		plain, err := c.Watch(nil, bson.A{})
+		assert.NoError(t, err)
+
+		available, err := c.Watch(nil, bson.A{}, options.ChangeStream().SetFullDocumentBeforeChange(options.WhenAvailable))
+		assert.NoError(t, err)
+
+		_, err = c.UpdateOne(nil, bson.M{"_id": "a"}, bson.M{
+			"$set": bson.M{"foo": "baz"},
+		})
+		assert.NoError(t, err)
+
+		_, err = c.ReplaceOne(nil, bson.M{"_id": "a"}, bson.M{"foo": "qux"})
+		assert.NoError(t, err)
+
+		_, err = c.DeleteOne(nil, bson.M{"_id": "a"})
+		assert.NoError(t, err)
+
+		/* default */
+
+		for _, op := range []string{"update", "replace", "delete"} {
+			assert.True(t, plain.Next(nil))
+
+			var event bson.M
+			err = plain.Decode(&event)
+			assert.NoError(t, err)
+			assert.Equal(t, op, event["operationType"])
+			assert.NotContains(t, event, "fullDocumentBeforeChange")
+		}
+
+		/* when available */
+
+		for _, item := range []struct {
+			op     string
+			before bson.M
+		}{
+			{op: "update", before: bson.M{"_id": "a", "foo": "bar"}},
+			{op: "replace", before: bson.M{"_id": "a", "foo": "baz"}},
+			{op: "delete", before: bson.M{"_id": "a", "foo": "qux"}},
+		} {
+			assert.True(t, available.Next(nil))
+
+			var event bson.M
+			err = available.Decode(&event)
+			assert.NoError(t, err)
+			assert.Equal(t, item.op, event["operationType"])
+			assert.Equal(t, item.before, event["fullDocumentBeforeChange"])
+		}
+
+		/* disabled */
+
+		other := d.Collection(collectionName())
+		_, err = other.InsertOne(nil, bson.M{"_id": "b"})
+		assert.NoError(t, err)
+
+		available, err = other.Watch(nil, bson.A{}, options.ChangeStream().SetFullDocumentBeforeChange(options.WhenAvailable))
+		assert.NoError(t, err)
+
+		required, err := other.Watch(nil, bson.A{}, options.ChangeStream().SetFullDocumentBeforeChange(options.Required))
+		assert.NoError(t, err)
+
+		_, err = other.DeleteOne(nil, bson.M{"_id": "b"})
+		assert.NoError(t, err)
+
+		assert.True(t, available.Next(nil))
+
+		var event bson.M
+		err = available.Decode(&event)
+		assert.NoError(t, err)
+		assert.Contains(t, event, "fullDocumentBeforeChange")
+		assert.Nil(t, event["fullDocumentBeforeChange"])
+
+		assert.False(t, required.Next(nil))
+		assert.Error(t, required.Err())
+	})
+}
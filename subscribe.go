@@ -0,0 +1,135 @@
+package lungo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// Event is a change event delivered by a subscription.
+type Event struct {
+	// The resume token of the event. It may be used to resume change streams
+	// using the ResumeAfter option.
+	Token bson.Raw
+
+	// The operation type e.g. "insert", "update", "replace", "delete", "drop",
+	// "rename", "dropDatabase" or "invalidate".
+	Type string
+
+	// The namespace of the event. The collection is empty for database events
+	// and the handle is empty for invalidate events.
+	Handle Handle
+
+	// The _id of the changed document.
+	Key interface{}
+
+	// The document after the change, if available.
+	Document bsonkit.Doc
+
+	// The document before the change, if recorded.
+	Before bsonkit.Doc
+
+	// The cluster time of the event.
+	Time primitive.Timestamp
+
+	// The raw change stream event.
+	Raw bsonkit.Doc
+}
+
+// Subscribe will return a channel that receives the events of the namespaces
+// matched by the handle as an alternative to Watch. The optional filter is
+// matched against the raw change stream events. The subscription ends if the
+// returned cancel function is called, the engine is closed or the watched
+// namespace is invalidated, after which the channel is closed. The cancel
+// function returns the error that ended the subscription, if any.
+func (e *Engine) Subscribe(handle Handle, filter bsonkit.Doc) (<-chan Event, func() error, error) {
+	// prepare pipeline
+	var pipeline bsonkit.List
+	if filter != nil {
+		pipeline = bsonkit.List{&bson.D{{Key: "$match", Value: *filter}}}
+	}
+
+	// open stream
+	stream, err := e.Watch(handle, pipeline, nil, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// include available documents
+	stream.fullDocument = options.WhenAvailable
+	stream.fullDocumentBeforeChange = options.WhenAvailable
+
+	// prepare context
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// prepare channels
+	events := make(chan Event)
+	done := make(chan struct{})
+
+	// run stream
+	var streamErr error
+	go func() {
+		// ensure cleanup
+		defer close(done)
+		defer close(events)
+		defer stream.Close(nil)
+
+		for stream.Next(ctx) {
+			// get event
+			event := newEvent(stream.ResumeToken(), bsonkit.Clone(stream.event))
+
+			// send event
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// get error
+		err := stream.Err()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			streamErr = err
+		}
+	}()
+
+	return events, func() error {
+		cancel()
+		<-done
+		return streamErr
+	}, nil
+}
+
+func newEvent(token bson.Raw, raw bsonkit.Doc) Event {
+	// prepare event
+	event := Event{
+		Token: token,
+		Raw:   raw,
+	}
+
+	// get details
+	event.Type, _ = bsonkit.Get(raw, "operationType").(string)
+	event.Handle[0], _ = bsonkit.Get(raw, "ns.db").(string)
+	event.Handle[1], _ = bsonkit.Get(raw, "ns.coll").(string)
+	event.Time, _ = bsonkit.Get(raw, "clusterTime").(primitive.Timestamp)
+
+	// get key
+	if key := bsonkit.Get(raw, "documentKey._id"); key != bsonkit.Missing {
+		event.Key = key
+	}
+
+	// get documents
+	if doc, ok := bsonkit.Get(raw, "fullDocument").(bson.D); ok {
+		event.Document = &doc
+	}
+	if doc, ok := bsonkit.Get(raw, "fullDocumentBeforeChange").(bson.D); ok {
+		event.Before = &doc
+	}
+
+	return event
+}
@@ -0,0 +1,100 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+func TestEngineSubscribe(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	events, cancel, err := engine.Subscribe(Handle{"foo", "bar"}, nil)
+	assert.NoError(t, err)
+
+	filtered, cancelFiltered, err := engine.Subscribe(Handle{"foo", ""}, bsonkit.MustConvert(bson.M{
+		"operationType": "delete",
+	}))
+	assert.NoError(t, err)
+
+	_, err = coll.InsertOne(nil, bson.D{{Key: "_id", Value: "a"}, {Key: "n", Value: int32(1)}})
+	assert.NoError(t, err)
+
+	_, err = coll.UpdateOne(nil, bson.M{"_id": "a"}, bson.M{"$set": bson.M{"n": int32(2)}})
+	assert.NoError(t, err)
+
+	_, err = coll.DeleteOne(nil, bson.M{"_id": "a"})
+	assert.NoError(t, err)
+
+	event := <-events
+	assert.Equal(t, "insert", event.Type)
+	assert.Equal(t, Handle{"foo", "bar"}, event.Handle)
+	assert.Equal(t, "a", event.Key)
+	assert.Equal(t, bsonkit.MustConvert(bson.D{{Key: "_id", Value: "a"}, {Key: "n", Value: int32(1)}}), event.Document)
+	assert.Nil(t, event.Before)
+	assert.NotEmpty(t, event.Token)
+	assert.NotZero(t, event.Time)
+
+	event = <-events
+	assert.Equal(t, "update", event.Type)
+	assert.Equal(t, bsonkit.MustConvert(bson.D{{Key: "_id", Value: "a"}, {Key: "n", Value: int32(2)}}), event.Document)
+
+	event = <-events
+	assert.Equal(t, "delete", event.Type)
+	assert.Equal(t, "a", event.Key)
+	assert.Nil(t, event.Document)
+
+	event = <-filtered
+	assert.Equal(t, "delete", event.Type)
+	assert.Equal(t, Handle{"foo", "bar"}, event.Handle)
+
+	// cancel
+	err = cancelFiltered()
+	assert.NoError(t, err)
+	_, ok := <-filtered
+	assert.False(t, ok)
+
+	// invalidate
+	err = coll.Drop(nil)
+	assert.NoError(t, err)
+
+	event = <-events
+	assert.Equal(t, "drop", event.Type)
+	event = <-events
+	assert.Equal(t, "invalidate", event.Type)
+	_, ok = <-events
+	assert.False(t, ok)
+
+	err = cancel()
+	assert.NoError(t, err)
+}
+
+func TestEngineSubscribeClose(t *testing.T) {
+	_, engine, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+
+	events, cancel, err := engine.Subscribe(Handle{}, nil)
+	assert.NoError(t, err)
+
+	engine.Close()
+
+	_, ok := <-events
+	assert.False(t, ok)
+
+	err = cancel()
+	assert.NoError(t, err)
+
+	_, _, err = engine.Subscribe(Handle{}, nil)
+	assert.Equal(t, ErrEngineClosed, err)
+}
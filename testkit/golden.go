@@ -0,0 +1,182 @@
+// Package testkit provides helpers to assert the state of a lungo engine in
+// tests using golden files.
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo"
+	"github.com/256dpi/lungo/bsonkit"
+)
+
+// Update specifies whether golden files are written instead of compared. It
+// is enabled if the LUNGO_UPDATE_GOLDEN environment variable is set.
+var Update = os.Getenv("LUNGO_UPDATE_GOLDEN") != ""
+
+// Snapshot will return the documents of the selected namespaces as indented
+// canonical extended JSON. Namespaces are selected using "<db>.<coll>" or
+// "<db>" strings and default to all namespaces except the local database.
+// The namespaces are ordered by name, the documents by their _id and the
+// fields of all documents by name with the _id field first to obtain a stable
+// output. A selected collection that does not exist is included
+// with an empty list.
+func Snapshot(ctx context.Context, engine *lungo.Engine, namespaces ...string) ([]byte, error) {
+	// get snapshot
+	txn, err := engine.Begin(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// get catalog
+	catalog := txn.Catalog()
+
+	// select handles
+	handles := map[lungo.Handle]bool{}
+	if len(namespaces) == 0 {
+		for handle := range catalog.Namespaces {
+			if handle[0] != lungo.Local {
+				handles[handle] = true
+			}
+		}
+	}
+	for _, ns := range namespaces {
+		// parse namespace
+		handle, err := lungo.ParseHandle(ns)
+		if err != nil {
+			return nil, err
+		}
+
+		// add collection
+		if handle[1] != "" {
+			handles[handle] = true
+			continue
+		}
+
+		// add database collections
+		for h := range catalog.Namespaces {
+			if h[0] == handle[0] {
+				handles[h] = true
+			}
+		}
+	}
+
+	// sort handles
+	list := make([]lungo.Handle, 0, len(handles))
+	for handle := range handles {
+		list = append(list, handle)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].String() < list[j].String()
+	})
+
+	// load namespaces
+	err = txn.Load(list...)
+	if err != nil {
+		return nil, err
+	}
+	catalog = txn.Catalog()
+
+	// collect documents
+	doc := bson.D{}
+	for _, handle := range list {
+		// get namespace
+		namespace := catalog.Namespaces[handle]
+
+		// sort documents
+		var docs bsonkit.List
+		if namespace != nil {
+			docs = append(docs, namespace.Documents.List...)
+		}
+		bsonkit.Sort(docs, []bsonkit.Column{{Path: "_id"}}, true)
+
+		// add documents
+		array := make(bson.A, 0, len(docs))
+		for _, item := range docs {
+			array = append(array, canonicalize(*item))
+		}
+		doc = append(doc, bson.E{Key: handle.String(), Value: array})
+	}
+
+	// encode snapshot
+	buf, err := bson.MarshalExtJSONIndent(doc, true, false, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf, '\n'), nil
+}
+
+func canonicalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.D:
+		// copy fields
+		doc := make(bson.D, 0, len(v))
+		for _, e := range v {
+			doc = append(doc, bson.E{Key: e.Key, Value: canonicalize(e.Value)})
+		}
+
+		// sort fields
+		sort.SliceStable(doc, func(i, j int) bool {
+			if doc[i].Key == "_id" || doc[j].Key == "_id" {
+				return doc[i].Key == "_id" && doc[j].Key != "_id"
+			}
+			return doc[i].Key < doc[j].Key
+		})
+
+		return doc
+	case bson.A:
+		// copy items
+		array := make(bson.A, 0, len(v))
+		for _, item := range v {
+			array = append(array, canonicalize(item))
+		}
+
+		return array
+	default:
+		return v
+	}
+}
+
+// AssertGolden will compare a snapshot of the selected namespaces with the
+// golden file at the specified path and report a diff if they differ. If
+// Update is enabled, the golden file is written instead.
+func AssertGolden(t assert.TestingT, engine *lungo.Engine, path string, namespaces ...string) bool {
+	// mark helper
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	// get snapshot
+	actual, err := Snapshot(nil, engine, namespaces...)
+	if err != nil {
+		return assert.NoError(t, err)
+	}
+
+	// write golden file
+	if Update {
+		err = os.MkdirAll(filepath.Dir(path), 0777)
+		if err == nil {
+			err = os.WriteFile(path, actual, 0666)
+		}
+		return assert.NoError(t, err)
+	}
+
+	// read golden file
+	expected, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return assert.Fail(t, fmt.Sprintf("missing golden file %q, set LUNGO_UPDATE_GOLDEN=1 to create it", path))
+	} else if err != nil {
+		return assert.NoError(t, err)
+	}
+
+	// compare snapshot, normalizing line endings of checked out files
+	return assert.Equal(t, strings.ReplaceAll(string(expected), "\r\n", "\n"), string(actual), "golden file %q differs", path)
+}
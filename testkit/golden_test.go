@@ -0,0 +1,129 @@
+package testkit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo"
+)
+
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, format)
+}
+
+func TestSnapshot(t *testing.T) {
+	client, engine, err := lungo.Open(nil, lungo.Options{
+		Store: lungo.NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	_, err = client.Database("foo").Collection("bar").InsertMany(nil, []interface{}{
+		bson.M{"_id": 2, "name": "b"},
+		bson.D{{Key: "tags", Value: bson.A{bson.D{{Key: "z", Value: 1}, {Key: "y", Value: 2}}}}, {Key: "name", Value: "a"}, {Key: "_id", Value: 1}},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database("baz").Collection("qux").InsertOne(nil, bson.M{"_id": "x"})
+	assert.NoError(t, err)
+
+	// all namespaces
+	buf, err := Snapshot(nil, engine)
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "baz.qux": [
+    {
+      "_id": "x"
+    }
+  ],
+  "foo.bar": [
+    {
+      "_id": {
+        "$numberInt": "1"
+      },
+      "name": "a",
+      "tags": [
+        {
+          "y": {
+            "$numberInt": "2"
+          },
+          "z": {
+            "$numberInt": "1"
+          }
+        }
+      ]
+    },
+    {
+      "_id": {
+        "$numberInt": "2"
+      },
+      "name": "b"
+    }
+  ]
+}
+`, string(buf))
+
+	// selected namespaces
+	buf, err = Snapshot(nil, engine, "baz", "foo.missing")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "baz.qux": [
+    {
+      "_id": "x"
+    }
+  ],
+  "foo.missing": []
+}
+`, string(buf))
+
+	// invalid namespace
+	_, err = Snapshot(nil, engine, "foo.")
+	assert.Error(t, err)
+}
+
+func TestAssertGolden(t *testing.T) {
+	client, engine, err := lungo.Open(nil, lungo.Options{
+		Store: lungo.NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertOne(nil, bson.M{"_id": 1, "name": "a"})
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "golden", "foo.json")
+
+	// missing
+	rec := &recorder{}
+	assert.False(t, AssertGolden(rec, engine, path))
+	assert.Len(t, rec.errors, 1)
+
+	// update
+	Update = true
+	assert.True(t, AssertGolden(t, engine, path, "foo.bar"))
+	Update = false
+
+	buf, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), `"foo.bar"`)
+
+	// match
+	assert.True(t, AssertGolden(t, engine, path, "foo.bar"))
+
+	// mismatch
+	_, err = coll.InsertOne(nil, bson.M{"_id": 2, "name": "b"})
+	assert.NoError(t, err)
+
+	rec = &recorder{}
+	assert.False(t, AssertGolden(rec, engine, path, "foo.bar"))
+	assert.Len(t, rec.errors, 1)
+}
@@ -1,7 +1,10 @@
 package lungo
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"strings"
 	"sync"
 	"time"
 
@@ -78,22 +81,109 @@ type Result struct {
 
 	// The error that occurred during the operation.
 	Error error
+
+	// The errors of the individual documents at their position in the list
+	// of inserted documents. Only set by Insert if a document failed.
+	Errors []error
 }
 
-// Transaction buffers multiple changes to a catalog.
+// Transaction buffers multiple changes to a catalog. Long-running operations
+// stop early and return the context error if the transaction context has been
+// cancelled.
 type Transaction struct {
-	catalog *Catalog
-	dirty   bool
-	mutex   sync.RWMutex
+	ctx       context.Context
+	base      *Catalog
+	catalog   *Catalog
+	cache     *queryCache
+	lazy      LazyStore
+	dirty     bool
+	untracked bool
+	mutex     sync.RWMutex
 }
 
 // NewTransaction creates and returns a new transaction.
 func NewTransaction(catalog *Catalog) *Transaction {
 	return &Transaction{
+		ctx:     context.Background(),
+		base:    catalog,
 		catalog: catalog,
 	}
 }
 
+// SetContext will set the context that is checked for cancellation by
+// long-running operations. It is set by Engine.Begin and may be changed for
+// every operation of a long-lived transaction.
+func (t *Transaction) SetContext(ctx context.Context) {
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// set context
+	t.ctx = ensureContext(ctx)
+}
+
+// Load will ensure that the documents of the specified namespaces are loaded
+// if the catalog has been loaded from a LazyStore. The transaction methods
+// load the namespaces they access, but namespaces must be loaded explicitly
+// before reading their documents from the catalog directly.
+func (t *Transaction) Load(handles ...Handle) error {
+	// check store
+	if t.lazy == nil {
+		return nil
+	}
+
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.load(handles...)
+}
+
+func (t *Transaction) load(handles ...Handle) error {
+	// check store
+	if t.lazy == nil {
+		return nil
+	}
+
+	// resolve cold namespaces
+	var clone *Catalog
+	for _, handle := range handles {
+		// get namespace
+		namespace := t.catalog.Namespaces[handle]
+		if namespace == nil || !t.lazy.Cold(namespace) {
+			continue
+		}
+
+		// resolve namespace
+		loaded, err := t.lazy.Resolve(namespace)
+		if err != nil {
+			return err
+		}
+
+		// set namespace on cloned catalog
+		if clone == nil {
+			clone = t.catalog.Clone()
+		}
+		clone.Namespaces[handle] = loaded
+	}
+
+	// set catalog
+	if clone != nil {
+		t.catalog = clone
+	}
+
+	return nil
+}
+
+func (t *Transaction) resolve(namespace *mongokit.Collection) (*mongokit.Collection, error) {
+	// check store
+	if t.lazy == nil || namespace == nil {
+		return namespace, nil
+	}
+
+	return t.lazy.Resolve(namespace)
+}
+
 // Create will ensure that a namespace for the provided handle exists.
 func (t *Transaction) Create(handle Handle) error {
 	// acquire write lock
@@ -124,27 +214,189 @@ func (t *Transaction) Create(handle Handle) error {
 	return nil
 }
 
+// CreateTimeSeries will ensure a time series namespace with the specified
+// configuration. An error is returned if a namespace with a different
+// configuration already exists.
+func (t *Transaction) CreateTimeSeries(handle Handle, config mongokit.TimeSeriesConfig) error {
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// validate handle
+	err := handle.Validate(true)
+	if err != nil {
+		return err
+	}
+
+	// check access
+	if handle[0] == Local {
+		return fmt.Errorf("namespace local.* is read only")
+	}
+
+	// create collection
+	namespace, err := mongokit.NewTimeSeriesCollection(config)
+	if err != nil {
+		return err
+	}
+
+	// check catalog
+	existing := t.catalog.Namespaces[handle]
+	if existing != nil {
+		if existing.Buckets == nil || existing.Buckets.Config() != namespace.Buckets.Config() {
+			return fmt.Errorf("namespace %q already exists with different options", handle.String())
+		}
+		return nil
+	}
+
+	// add collection
+	t.catalog = t.catalog.Clone()
+	t.catalog.Namespaces[handle] = namespace
+	t.dirty = true
+
+	return nil
+}
+
+// EnablePreImages will set whether the documents before a change are recorded
+// in the oplog events of updated, replaced and deleted documents of the
+// namespace. The namespace is created if it does not exist.
+func (t *Transaction) EnablePreImages(handle Handle, enabled bool) error {
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// validate handle
+	err := handle.Validate(true)
+	if err != nil {
+		return err
+	}
+
+	// check access
+	if handle[0] == Local {
+		return fmt.Errorf("namespace local.* is read only")
+	}
+
+	// load namespace
+	err = t.load(handle)
+	if err != nil {
+		return err
+	}
+
+	// get namespace
+	namespace := t.catalog.Namespaces[handle]
+	if namespace != nil && namespace.PreImages == enabled {
+		return nil
+	}
+
+	// clone or create namespace
+	if namespace != nil {
+		namespace = namespace.Clone()
+	} else {
+		namespace = mongokit.NewCollection(true)
+	}
+
+	// set flag
+	namespace.PreImages = enabled
+
+	// set namespace
+	t.catalog = t.catalog.Clone()
+	t.catalog.Namespaces[handle] = namespace
+	t.dirty = true
+
+	return nil
+}
+
 // Find will query documents from a namespace. Sort, skip and limit may be
 // supplied to modify the result. The returned results will contain the matched
 // list of documents.
 func (t *Transaction) Find(handle Handle, query, sort bsonkit.Doc, skip, limit int) (*Result, error) {
+	return t.FindCollated(handle, query, sort, nil, skip, limit)
+}
+
+// FindCollated will query documents from a namespace like Find but uses the
+// specified collation to compare strings, see mongokit.CaseInsensitive for the
+// supported collations.
+func (t *Transaction) FindCollated(handle Handle, query, sort, collation bsonkit.Doc, skip, limit int) (*Result, error) {
+	// load namespace
+	err := t.Load(handle)
+	if err != nil {
+		return nil, err
+	}
+
 	// acquire read lock
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
 
 	// validate handle
-	err := handle.Validate(true)
+	err = handle.Validate(true)
 	if err != nil {
 		return nil, err
 	}
 
-	// check namespace
-	if t.catalog.Namespaces[handle] == nil {
+	// get namespace
+	namespace := t.catalog.Namespaces[handle]
+	if namespace == nil {
+		return &Result{}, nil
+	}
+
+	// check cache
+	var key queryKey
+	var cached bool
+	if t.cache != nil {
+		key, cached = t.cache.key(handle, query, sort, collation, skip, limit)
+		if cached {
+			list, ok := t.cache.get(key, namespace)
+			if ok {
+				return &Result{
+					Matched: list,
+				}, nil
+			}
+		}
+	}
+
+	// find documents
+	res, err := namespace.FindCollated(t.ctx, query, sort, collation, skip, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// cache result
+	if cached {
+		t.cache.put(key, namespace, res.Matched)
+	}
+
+	return &Result{
+		Matched: res.Matched,
+	}, nil
+}
+
+// FindAfter will query documents from a namespace that have a record ID
+// greater than the specified record ID. Sort, skip and limit may be supplied
+// to modify the result.
+func (t *Transaction) FindAfter(handle Handle, recordID int64, query, sort bsonkit.Doc, skip, limit int) (*Result, error) {
+	// load namespace
+	err := t.Load(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	// acquire read lock
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	// validate handle
+	err = handle.Validate(true)
+	if err != nil {
+		return nil, err
+	}
+
+	// get namespace
+	namespace := t.catalog.Namespaces[handle]
+	if namespace == nil {
 		return &Result{}, nil
 	}
 
 	// find documents
-	res, err := t.catalog.Namespaces[handle].Find(query, sort, skip, limit)
+	res, err := namespace.FindAfter(t.ctx, recordID, query, sort, skip, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -154,6 +406,39 @@ func (t *Transaction) Find(handle Handle, query, sort bsonkit.Doc, skip, limit i
 	}, nil
 }
 
+// RecordIDs will return the record IDs of the specified documents. Record IDs
+// increase monotonically per namespace and are kept when documents are updated
+// or replaced. Zero is returned for documents that are not part of the
+// namespace.
+func (t *Transaction) RecordIDs(handle Handle, list bsonkit.List) ([]int64, error) {
+	// load namespace
+	err := t.Load(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	// acquire read lock
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	// validate handle
+	err = handle.Validate(true)
+	if err != nil {
+		return nil, err
+	}
+
+	// get record ids
+	ids := make([]int64, len(list))
+	namespace := t.catalog.Namespaces[handle]
+	if namespace != nil {
+		for i, doc := range list {
+			ids[i], _ = namespace.RecordID(doc)
+		}
+	}
+
+	return ids, nil
+}
+
 // Bulk performs the specified operations in one go. If ordered is true the
 // process is aborted on the first error.
 func (t *Transaction) Bulk(handle Handle, ops []Operation, ordered bool) ([]Result, error) {
@@ -172,6 +457,12 @@ func (t *Transaction) Bulk(handle Handle, ops []Operation, ordered bool) ([]Resu
 		return nil, fmt.Errorf("namespace local.* is read only")
 	}
 
+	// load namespace
+	err = t.load(handle)
+	if err != nil {
+		return nil, err
+	}
+
 	// clone catalog
 	clone := t.catalog.Clone()
 
@@ -274,6 +565,12 @@ func (t *Transaction) Insert(handle Handle, list bsonkit.List, ordered bool) (*R
 		return nil, fmt.Errorf("namespace local.* is read only")
 	}
 
+	// load namespace
+	err = t.load(handle)
+	if err != nil {
+		return nil, err
+	}
+
 	// clone list
 	list = bsonkit.CloneList(list)
 
@@ -285,40 +582,40 @@ func (t *Transaction) Insert(handle Handle, list bsonkit.List, ordered bool) (*R
 		clone.Namespaces[handle] = mongokit.NewCollection(true)
 	}
 
-	// prepare result
-	result := &Result{}
+	// clone namespace and oplog, failed documents do not modify the namespace
+	namespace := clone.Namespaces[handle].Clone()
+	oplog := clone.Namespaces[Oplog].Clone()
 
 	// insert documents
-	for _, doc := range list {
-		// clone namespace and oplog for every insert as the collections may
-		// be left in an undefined state after skipping errors
-
-		// clone namespace and oplog
-		namespace := clone.Namespaces[handle].Clone()
-		oplog := clone.Namespaces[Oplog].Clone()
+	res, errs, err := namespace.InsertMany(list, ordered)
+	if err != nil {
+		return nil, err
+	}
 
-		// perform insert
-		res, err := t.insert(handle, oplog, namespace, doc)
+	// append oplog
+	for _, doc := range res.Modified {
+		err = t.append(oplog, handle, "insert", doc, nil, nil)
 		if err != nil {
-			// set error
-			if result.Error == nil {
-				result.Error = err
-			}
-
-			// stop if ordered or continue
-			if ordered {
-				break
-			} else {
-				continue
-			}
+			return nil, err
 		}
+	}
 
-		// replace namespace and oplog
-		clone.Namespaces[handle] = namespace
-		clone.Namespaces[Oplog] = oplog
+	// replace namespace and oplog
+	clone.Namespaces[handle] = namespace
+	clone.Namespaces[Oplog] = oplog
 
-		// merge result
-		result.Modified = append(result.Modified, res.Modified...)
+	// prepare result
+	result := &Result{
+		Modified: res.Modified,
+	}
+
+	// set first error and errors
+	for _, err := range errs {
+		if err != nil {
+			result.Error = err
+			result.Errors = errs
+			break
+		}
 	}
 
 	// set catalog and flag
@@ -338,7 +635,7 @@ func (t *Transaction) insert(handle Handle, oplog, namespace *mongokit.Collectio
 	}
 
 	// append oplog
-	err = t.append(oplog, handle, "insert", doc, nil)
+	err = t.append(oplog, handle, "insert", doc, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -368,6 +665,12 @@ func (t *Transaction) Replace(handle Handle, query, sort, repl bsonkit.Doc, upse
 		return nil, fmt.Errorf("namespace local.* is read only")
 	}
 
+	// load namespace
+	err = t.load(handle)
+	if err != nil {
+		return nil, err
+	}
+
 	// check namespace
 	if t.catalog.Namespaces[handle] == nil && !upsert {
 		return &Result{}, nil
@@ -410,7 +713,7 @@ func (t *Transaction) Replace(handle Handle, query, sort, repl bsonkit.Doc, upse
 
 func (t *Transaction) replace(handle Handle, oplog, namespace *mongokit.Collection, query, repl, sort bsonkit.Doc, upsert bool) (*Result, error) {
 	// replace document
-	res, err := namespace.Replace(query, repl, sort)
+	res, err := namespace.Replace(t.ctx, query, repl, sort)
 	if err != nil {
 		return nil, err
 	}
@@ -423,7 +726,7 @@ func (t *Transaction) replace(handle Handle, oplog, namespace *mongokit.Collecti
 		}
 
 		// append oplog
-		err = t.append(oplog, handle, "insert", res.Upserted, nil)
+		err = t.append(oplog, handle, "insert", res.Upserted, nil, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -435,7 +738,7 @@ func (t *Transaction) replace(handle Handle, oplog, namespace *mongokit.Collecti
 
 	// append oplog
 	if len(res.Modified) > 0 {
-		err = t.append(oplog, handle, "replace", res.Modified[0], nil)
+		err = t.append(oplog, handle, "replace", res.Modified[0], preImage(namespace, res.Matched[0]), nil)
 		if err != nil {
 			return nil, err
 		}
@@ -468,6 +771,12 @@ func (t *Transaction) Update(handle Handle, query, sort, update bsonkit.Doc, ski
 		return nil, fmt.Errorf("namespace local.* is read only")
 	}
 
+	// load namespace
+	err = t.load(handle)
+	if err != nil {
+		return nil, err
+	}
+
 	// check namespace
 	if t.catalog.Namespaces[handle] == nil && !upsert {
 		return &Result{}, nil
@@ -507,7 +816,7 @@ func (t *Transaction) Update(handle Handle, query, sort, update bsonkit.Doc, ski
 
 func (t *Transaction) update(handle Handle, oplog, namespace *mongokit.Collection, query, update, sort bsonkit.Doc, upsert bool, skip, limit int, arrayFilters bsonkit.List) (*Result, error) {
 	// perform update
-	res, err := namespace.Update(query, update, sort, skip, limit, arrayFilters)
+	res, err := namespace.Update(t.ctx, query, update, sort, skip, limit, arrayFilters)
 	if err != nil {
 		return nil, err
 	}
@@ -520,7 +829,7 @@ func (t *Transaction) update(handle Handle, oplog, namespace *mongokit.Collectio
 		}
 
 		// append oplog
-		err = t.append(oplog, handle, "insert", res.Upserted, nil)
+		err = t.append(oplog, handle, "insert", res.Upserted, nil, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -532,7 +841,14 @@ func (t *Transaction) update(handle Handle, oplog, namespace *mongokit.Collectio
 
 	// append oplog
 	for i, doc := range res.Modified {
-		err = t.append(oplog, handle, "update", doc, res.Changes[i])
+		// skip unchanged documents
+		diff := bsonkit.Diff(res.Matched[i], doc)
+		if diff.Empty() {
+			continue
+		}
+
+		// append event
+		err = t.append(oplog, handle, "update", doc, preImage(namespace, res.Matched[i]), minimalChanges(res.Changes[i], diff))
 		if err != nil {
 			return nil, err
 		}
@@ -563,6 +879,12 @@ func (t *Transaction) Delete(handle Handle, query, sort bsonkit.Doc, skip, limit
 		return nil, fmt.Errorf("namespace local.* is read only")
 	}
 
+	// load namespace
+	err = t.load(handle)
+	if err != nil {
+		return nil, err
+	}
+
 	// check namespace
 	if t.catalog.Namespaces[handle] == nil {
 		return &Result{}, nil
@@ -596,14 +918,14 @@ func (t *Transaction) Delete(handle Handle, query, sort bsonkit.Doc, skip, limit
 
 func (t *Transaction) delete(handle Handle, oplog, namespace *mongokit.Collection, query, sort bsonkit.Doc, skip, limit int) (*Result, error) {
 	// perform delete
-	res, err := namespace.Delete(query, sort, skip, limit)
+	res, err := namespace.Delete(t.ctx, query, sort, skip, limit)
 	if err != nil {
 		return nil, err
 	}
 
 	// append oplog
 	for _, doc := range res.Matched {
-		err = t.append(oplog, handle, "delete", doc, nil)
+		err = t.append(oplog, handle, "delete", doc, preImage(namespace, doc), nil)
 		if err != nil {
 			return nil, err
 		}
@@ -645,13 +967,13 @@ func (t *Transaction) Drop(handle Handle) error {
 
 	// drop all matching namespaces
 	for ns := range clone.Namespaces {
-		if ns == handle || handle[1] == "" && ns[0] == handle[0] {
+		if handle.Contains(ns) {
 			// delete namespace
 			delete(clone.Namespaces, ns)
 			dropped++
 
 			// append oplog
-			err = t.append(oplog, ns, "drop", nil, nil)
+			err = t.append(oplog, ns, "drop", nil, nil, nil)
 			if err != nil {
 				return err
 			}
@@ -659,8 +981,8 @@ func (t *Transaction) Drop(handle Handle) error {
 	}
 
 	// append oplog if database has been dropped
-	if handle[1] == "" && dropped > 0 {
-		err = t.append(oplog, handle, "dropDatabase", nil, nil)
+	if handle.IsDatabase() && dropped > 0 {
+		err = t.append(oplog, handle, "dropDatabase", nil, nil, nil)
 		if err != nil {
 			return err
 		}
@@ -675,7 +997,96 @@ func (t *Transaction) Drop(handle Handle) error {
 	return nil
 }
 
-func (t *Transaction) append(oplog *mongokit.Collection, handle Handle, op string, doc bsonkit.Doc, changes *mongokit.Changes) error {
+// Rename will rename the namespace with the specified handle. If the target
+// namespace exists, it is dropped if requested or an error is returned.
+func (t *Transaction) Rename(from, to Handle, dropTarget bool) error {
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// validate handles
+	err := from.Validate(true)
+	if err != nil {
+		return err
+	}
+	err = to.Validate(true)
+	if err != nil {
+		return err
+	}
+
+	// check access
+	if from[0] == Local || to[0] == Local {
+		return fmt.Errorf("namespace local.* is read only")
+	}
+
+	// load namespace
+	err = t.load(from)
+	if err != nil {
+		return err
+	}
+
+	// check namespaces
+	if t.catalog.Namespaces[from] == nil {
+		return fmt.Errorf("source namespace does not exist")
+	} else if from == to {
+		return fmt.Errorf("can't rename a collection to itself")
+	} else if t.catalog.Namespaces[to] != nil && !dropTarget {
+		return fmt.Errorf("target namespace exists")
+	}
+
+	// clone catalog
+	clone := t.catalog.Clone()
+
+	// clone oplog
+	oplog := clone.Namespaces[Oplog].Clone()
+	clone.Namespaces[Oplog] = oplog
+
+	// drop target
+	if clone.Namespaces[to] != nil {
+		delete(clone.Namespaces, to)
+
+		// append oplog
+		err = t.append(oplog, to, "drop", nil, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// move namespace
+	clone.Namespaces[to] = clone.Namespaces[from]
+	delete(clone.Namespaces, from)
+
+	// get time
+	now := bsonkit.Now()
+
+	// append oplog
+	_, err = oplog.Insert(bsonkit.MustConvert(bson.M{
+		"ns": bson.M{
+			"db":   from[0],
+			"coll": from[1],
+		},
+		"_id": bson.M{
+			"ts": now,
+		},
+		"clusterTime":   now,
+		"operationType": "rename",
+		"to": bson.M{
+			"db":   to[0],
+			"coll": to[1],
+		},
+	}))
+	if err != nil {
+		return err
+	}
+
+	// set catalog and flag
+	t.catalog = clone
+	t.dirty = true
+
+	return nil
+}
+
+func (t *Transaction) append(oplog *mongokit.Collection, handle Handle, op string, doc, before bsonkit.Doc, changes *mongokit.Changes) error {
 	// get time
 	now := bsonkit.Now()
 
@@ -708,6 +1119,11 @@ func (t *Transaction) append(oplog *mongokit.Collection, handle Handle, op strin
 		}
 	}
 
+	// add full document before change
+	if before != nil {
+		event["fullDocumentBeforeChange"] = *before
+	}
+
 	// add changes
 	if changes != nil {
 		// collect updated and removed fields
@@ -756,7 +1172,7 @@ func (t *Transaction) ListDatabases(query bsonkit.Doc) (bsonkit.List, error) {
 		// check emptiness
 		empty := true
 		for _, ns := range nss {
-			if len(ns.Documents.List) > 0 {
+			if len(ns.Documents.List) > 0 || ns.Size > 0 {
 				empty = false
 			}
 		}
@@ -794,9 +1210,42 @@ func (t *Transaction) ListCollections(handle Handle, query bsonkit.Doc) (bsonkit
 	list := make(bsonkit.List, 0, len(t.catalog.Namespaces))
 
 	// add documents
-	for ns := range t.catalog.Namespaces {
-		if ns[0] == handle[0] {
+	for ns, namespace := range t.catalog.Namespaces {
+		// handle time series
+		if ns[0] == handle[0] && namespace.Buckets != nil {
+			// get config
+			config := namespace.Buckets.Config()
+
+			// prepare options
+			options := bson.D{
+				bson.E{Key: "timeField", Value: config.TimeField},
+			}
+			if config.MetaField != "" {
+				options = append(options, bson.E{Key: "metaField", Value: config.MetaField})
+			}
+			options = append(options,
+				bson.E{Key: "granularity", Value: config.Granularity},
+				bson.E{Key: "bucketMaxSpanSeconds", Value: int32(config.Span().Seconds())},
+			)
+
+			// add specification
 			list = append(list, &bson.D{
+				bson.E{Key: "name", Value: ns[1]},
+				bson.E{Key: "type", Value: "timeseries"},
+				bson.E{Key: "options", Value: bson.D{
+					bson.E{Key: "timeseries", Value: options},
+				}},
+				bson.E{Key: "info", Value: bson.D{
+					bson.E{Key: "readOnly", Value: false},
+				}},
+			})
+
+			continue
+		}
+
+		if ns[0] == handle[0] {
+			// prepare specification
+			spec := bson.D{
 				bson.E{Key: "name", Value: ns[1]},
 				bson.E{Key: "type", Value: "collection"},
 				bson.E{Key: "options", Value: bson.D{}},
@@ -804,15 +1253,22 @@ func (t *Transaction) ListCollections(handle Handle, query bsonkit.Doc) (bsonkit
 					bson.E{Key: "uuid", Value: ns.String()},
 					bson.E{Key: "readOnly", Value: false},
 				}},
-				bson.E{Key: "idIndex", Value: bson.D{
+			}
+
+			// add id index
+			if namespace.Indexes["_id_"] != nil {
+				spec = append(spec, bson.E{Key: "idIndex", Value: bson.D{
 					bson.E{Key: "v", Value: 2},
 					bson.E{Key: "key", Value: bson.D{
 						bson.E{Key: "_id", Value: 1},
 					}},
 					bson.E{Key: "name", Value: "_id_"},
 					bson.E{Key: "namespace", Value: ns.String()},
-				}},
-			})
+				}})
+			}
+
+			// add specification
+			list = append(list, &spec)
 		}
 	}
 
@@ -827,12 +1283,18 @@ func (t *Transaction) ListCollections(handle Handle, query bsonkit.Doc) (bsonkit
 
 // CountDocuments will return the number of documents in the specified namespace.
 func (t *Transaction) CountDocuments(handle Handle) (int, error) {
+	// load namespace
+	err := t.Load(handle)
+	if err != nil {
+		return 0, err
+	}
+
 	// acquire read lock
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
 
 	// validate handle
-	err := handle.Validate(true)
+	err = handle.Validate(true)
 	if err != nil {
 		return 0, err
 	}
@@ -869,33 +1331,7 @@ func (t *Transaction) ListIndexes(handle Handle) (bsonkit.List, error) {
 	// prepare list
 	var list bsonkit.List
 	for name, index := range namespace.Indexes {
-		// get config
-		config := index.Config()
-
-		// create spec
-		spec := bson.D{
-			bson.E{Key: "v", Value: 2},
-			bson.E{Key: "key", Value: *config.Key},
-			bson.E{Key: "name", Value: name},
-		}
-
-		// add unique
-		if config.Unique && name != "_id_" {
-			spec = append(spec, bson.E{Key: "unique", Value: true})
-		}
-
-		// add partial
-		if config.Partial != nil {
-			spec = append(spec, bson.E{Key: "partialFilterExpression", Value: *config.Partial})
-		}
-
-		// add expiry
-		if config.Expiry > 0 {
-			spec = append(spec, bson.E{Key: "expireAfterSeconds", Value: int32(config.Expiry / time.Second)})
-		}
-
-		// add specification
-		list = append(list, &spec)
+		list = append(list, buildIndexSpec(name, index.Config()))
 	}
 
 	// sort list
@@ -924,6 +1360,12 @@ func (t *Transaction) CreateIndex(handle Handle, name string, config mongokit.In
 		return "", fmt.Errorf("namespace local.* is read only")
 	}
 
+	// load namespace
+	err = t.load(handle)
+	if err != nil {
+		return "", err
+	}
+
 	// clone catalog
 	clone := t.catalog.Clone()
 
@@ -938,7 +1380,7 @@ func (t *Transaction) CreateIndex(handle Handle, name string, config mongokit.In
 	}
 
 	// create index
-	name, err = namespace.CreateIndex(name, config)
+	name, err = namespace.CreateIndex(t.ctx, name, config)
 	if err != nil {
 		return "", err
 	}
@@ -950,7 +1392,8 @@ func (t *Transaction) CreateIndex(handle Handle, name string, config mongokit.In
 	return name, nil
 }
 
-// DropIndex will drop the specified index in the specified namespace.
+// DropIndex will drop the specified index in the specified namespace. All
+// indexes except the _id index are dropped if the name is empty or "*".
 func (t *Transaction) DropIndex(handle Handle, name string) error {
 	// acquire write lock
 	t.mutex.Lock()
@@ -967,6 +1410,12 @@ func (t *Transaction) DropIndex(handle Handle, name string) error {
 		return fmt.Errorf("namespace local.* is read only")
 	}
 
+	// load namespace
+	err = t.load(handle)
+	if err != nil {
+		return err
+	}
+
 	// check namespace
 	if t.catalog.Namespaces[handle] == nil {
 		return fmt.Errorf("missing namespace %q", handle.String())
@@ -1012,6 +1461,137 @@ func (t *Transaction) Catalog() *Catalog {
 	return t.catalog
 }
 
+// Savepoint captures the state of a transaction. It can be used to roll back
+// the changes made after it has been created without aborting the whole
+// transaction.
+type Savepoint struct {
+	txn     *Transaction
+	catalog *Catalog
+	dirty   bool
+}
+
+// Savepoint will create and return a savepoint for the current state of the
+// transaction.
+func (t *Transaction) Savepoint() *Savepoint {
+	// acquire read lock
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return &Savepoint{
+		txn:     t,
+		catalog: t.catalog,
+		dirty:   t.dirty,
+	}
+}
+
+// RollbackTo will discard all changes made after the specified savepoint has
+// been created. Since namespaces are copied on write, this does not require
+// any undo operations.
+func (t *Transaction) RollbackTo(savepoint *Savepoint) error {
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// check savepoint
+	if savepoint == nil || savepoint.txn != t {
+		return fmt.Errorf("savepoint does not belong to transaction")
+	}
+
+	// restore state
+	t.catalog = savepoint.catalog
+	t.dirty = savepoint.dirty
+
+	return nil
+}
+
+// rebase will apply the changes of the transaction to the specified catalog
+// that has been committed since the transaction began. It returns
+// ErrWriteConflict if a namespace has been changed by both.
+func (t *Transaction) rebase(current *Catalog) error {
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// clone current catalog
+	clone := current.Clone()
+
+	// collect handles
+	handles := map[Handle]struct{}{}
+	for handle := range t.base.Namespaces {
+		handles[handle] = struct{}{}
+	}
+	for handle := range t.catalog.Namespaces {
+		handles[handle] = struct{}{}
+	}
+
+	// apply changed namespaces
+	for handle := range handles {
+		// skip oplog and unchanged namespaces
+		namespace := t.catalog.Namespaces[handle]
+		base := t.base.Namespaces[handle]
+		if handle == Oplog || namespace == base {
+			continue
+		}
+
+		// skip cold namespaces that have only been loaded
+		if namespace != nil && base != nil && t.lazy != nil && t.lazy.Cold(base) {
+			loaded, err := t.lazy.Resolve(base)
+			if err != nil {
+				return err
+			} else if namespace == loaded {
+				continue
+			}
+			base = loaded
+		}
+
+		// check conflict, a cold namespace may have been committed loaded
+		committed := current.Namespaces[handle]
+		if committed != base && committed != t.base.Namespaces[handle] {
+			return ErrWriteConflict
+		}
+
+		// set or remove namespace
+		if namespace != nil {
+			clone.Namespaces[handle] = namespace
+		} else {
+			delete(clone.Namespaces, handle)
+		}
+	}
+
+	// append new events to current oplog, the events are stamped again to keep
+	// the oplog ordered by cluster time after the events of other commits
+	events := newEvents(t.base.Namespaces[Oplog], t.catalog.Namespaces[Oplog])
+	if len(events) > 0 {
+		oplog := clone.Namespaces[Oplog].Clone()
+		for _, event := range events {
+			// stamp event
+			event = bsonkit.Clone(event)
+			now := bsonkit.Now()
+			_, err := bsonkit.Put(event, "_id.ts", now, false)
+			if err != nil {
+				return err
+			}
+			_, err = bsonkit.Put(event, "clusterTime", now, false)
+			if err != nil {
+				return err
+			}
+
+			// insert event
+			_, err = oplog.Insert(event)
+			if err != nil {
+				return err
+			}
+		}
+		clone.Namespaces[Oplog] = oplog
+	}
+
+	// set catalogs
+	t.base = current
+	t.catalog = clone
+
+	return nil
+}
+
 // Clean will clean the oplog and only keep up to the specified amount of events
 // and delete events that are older than the specified age.
 func (t *Transaction) Clean(minSize, maxSize int, minAge, maxAge time.Duration) {
@@ -1032,6 +1612,13 @@ func (t *Transaction) Clean(minSize, maxSize int, minAge, maxAge time.Duration)
 	minTimestamp.T -= uint32(minAge / time.Second)
 	maxTimestamp.T -= uint32(maxAge / time.Second)
 
+	// events are aged in seconds, events from the threshold second are kept
+	// when a minimum age is required and dropped when exceeding the maximum age
+	if minAge > 0 {
+		minTimestamp.I = 0
+	}
+	maxTimestamp.I = math.MaxUint32
+
 	// determine indexes
 	minIndex := len(oplog.Documents.List) - minSize
 	maxIndex := len(oplog.Documents.List) - maxSize
@@ -1052,6 +1639,8 @@ func (t *Transaction) Clean(minSize, maxSize int, minAge, maxAge time.Duration)
 		// remove event if below threshold or timestamp
 		if afterMin && beyondMax {
 			oplog.Documents.Remove(doc)
+			oplog.Size -= bsonkit.Size(doc)
+			oplog.Removed = true
 			dropped++
 		} else {
 			break
@@ -1065,6 +1654,41 @@ func (t *Transaction) Clean(minSize, maxSize int, minAge, maxAge time.Duration)
 	}
 }
 
+// Compact will rebuild the namespaces that had documents or indexes removed
+// since their last compaction to release memory that is retained by structures
+// shared with previous catalogs. Other namespaces are left untouched and the
+// transaction is only marked dirty if a namespace has been rebuilt.
+func (t *Transaction) Compact() error {
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// clone catalog
+	clone := t.catalog.Clone()
+
+	// compact namespaces, cold namespaces are loaded compacted
+	var compacted int
+	for handle, namespace := range clone.Namespaces {
+		if !namespace.Removed || (t.lazy != nil && t.lazy.Cold(namespace)) {
+			continue
+		}
+		compact, err := namespace.Compact()
+		if err != nil {
+			return err
+		}
+		clone.Namespaces[handle] = compact
+		compacted++
+	}
+
+	// set catalog and flag
+	if compacted > 0 {
+		t.catalog = clone
+		t.dirty = true
+	}
+
+	return nil
+}
+
 // Expire will remove documents that are expired due to a TTL index.
 func (t *Transaction) Expire() error {
 	// acquire write lock
@@ -1096,8 +1720,12 @@ func (t *Transaction) Expire() error {
 			continue
 		}
 
-		// clone namespace
-		namespace := clone.Namespaces[handle].Clone()
+		// resolve and clone namespace
+		namespace, err := t.resolve(namespace)
+		if err != nil {
+			return err
+		}
+		namespace = namespace.Clone()
 		clone.Namespaces[handle] = namespace
 
 		// collect conditions
@@ -1133,3 +1761,62 @@ func (t *Transaction) Expire() error {
 
 	return nil
 }
+
+func newEvents(base, oplog *mongokit.Collection) bsonkit.List {
+	// get lists
+	baseList := base.Documents.List
+	list := oplog.Documents.List
+	if len(baseList) == 0 {
+		return list
+	}
+
+	// events are only appended and cleaned from the front, therefore the new
+	// events follow the last base event or are all events if it was cleaned
+	last := baseList[len(baseList)-1]
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i] == last {
+			return list[i+1:]
+		}
+	}
+
+	return list
+}
+
+func preImage(namespace *mongokit.Collection, doc bsonkit.Doc) bsonkit.Doc {
+	// check flag
+	if !namespace.PreImages {
+		return nil
+	}
+
+	return doc
+}
+
+// minimalChanges will return the recorded changes that overlap with a field
+// of the difference. The recorded changes are kept as the source of the update
+// description since they match the paths reported by MongoDB, e.g. "a.1" for
+// an element pushed to an array, which the difference reports as a whole. The
+// difference only drops the changes that did not modify the document.
+func minimalChanges(changes *mongokit.Changes, diff *bsonkit.Difference) *mongokit.Changes {
+	// collect paths
+	paths := make([]string, 0, len(diff.Updated)+len(diff.Removed))
+	for _, e := range diff.Updated {
+		paths = append(paths, e.Key)
+	}
+	paths = append(paths, diff.Removed...)
+
+	// keep overlapping changes
+	changed := make(map[string]interface{}, len(changes.Changed))
+	for path, val := range changes.Changed {
+		for _, p := range paths {
+			if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(path, p+".") {
+				changed[path] = val
+				break
+			}
+		}
+	}
+
+	return &mongokit.Changes{
+		Upsert:  changes.Upsert,
+		Changed: changed,
+	}
+}
@@ -1,6 +1,7 @@
 package lungo
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
 )
 
 func TestTransactionOplogCleaningBySize(t *testing.T) {
@@ -115,3 +117,204 @@ func TestTransactionOplogCleaningByTime(t *testing.T) {
 	assert.Empty(t, txn.Catalog().Namespaces[Oplog].Documents.List)
 
 }
+
+func TestTransactionUnchangedUpdate(t *testing.T) {
+	txn := NewTransaction(NewCatalog())
+
+	id1 := primitive.NewObjectID()
+	_, err := txn.Insert(Handle{"foo", "bar"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{
+			"_id": id1,
+			"foo": "bar",
+		}),
+	}, true)
+	assert.NoError(t, err)
+
+	res, err := txn.Update(Handle{"foo", "bar"}, bsonkit.MustConvert(bson.M{
+		"_id": id1,
+	}), nil, bsonkit.MustConvert(bson.M{
+		"$set": bson.M{
+			"foo": "bar",
+		},
+	}), 0, 0, false, nil)
+	assert.NoError(t, err)
+	assert.Len(t, res.Modified, 1)
+	assert.Len(t, txn.Catalog().Namespaces[Oplog].Documents.List, 1)
+
+	_, err = txn.Update(Handle{"foo", "bar"}, bsonkit.MustConvert(bson.M{
+		"_id": id1,
+	}), nil, bsonkit.MustConvert(bson.M{
+		"$set": bson.M{
+			"foo": "baz",
+		},
+	}), 0, 0, false, nil)
+	assert.NoError(t, err)
+	assert.Len(t, txn.Catalog().Namespaces[Oplog].Documents.List, 2)
+
+	_, err = txn.Update(Handle{"foo", "bar"}, bsonkit.MustConvert(bson.M{
+		"_id": id1,
+	}), nil, bsonkit.MustConvert(bson.M{
+		"$set": bson.M{
+			"foo": "baz",
+			"bar": bson.A{int32(1), int32(2)},
+		},
+		"$unset": bson.M{
+			"baz": "",
+		},
+	}), 0, 0, false, nil)
+	assert.NoError(t, err)
+
+	oplog := txn.Catalog().Namespaces[Oplog].Documents.List
+	assert.Len(t, oplog, 3)
+	assert.Equal(t, *bsonkit.MustConvert(bson.M{
+		"updatedFields": bson.M{
+			"bar": bson.A{int32(1), int32(2)},
+		},
+		"removedFields":   bson.A{},
+		"truncatedArrays": bson.A{},
+	}), bsonkit.Get(oplog[2], "updateDescription").(bson.D))
+}
+
+func TestTransactionInsertBatch(t *testing.T) {
+	handle := Handle{"foo", "bar"}
+	txn := NewTransaction(NewCatalog())
+
+	_, err := txn.CreateIndex(handle, "n", mongokit.IndexConfig{
+		Key:    bsonkit.MustConvert(bson.M{"n": int32(1)}),
+		Unique: true,
+		Partial: bsonkit.MustConvert(bson.M{
+			"n": bson.M{"$gt": int32(0)},
+		}),
+	})
+	assert.NoError(t, err)
+
+	res, err := txn.Insert(handle, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": int32(1), "n": int32(1)}),
+	}, true)
+	assert.NoError(t, err)
+	assert.NoError(t, res.Error)
+	assert.Len(t, res.Modified, 1)
+
+	// unordered
+	res, err = txn.Insert(handle, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": int32(2), "n": int32(1)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(3), "n": int32(3)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(4), "n": int32(3)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(5), "n": int32(0)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(6), "n": int32(0)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(5), "n": int32(5)}),
+	}, false)
+	assert.NoError(t, err)
+	assert.Error(t, res.Error)
+	assert.Equal(t, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": int32(3), "n": int32(3)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(5), "n": int32(0)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(6), "n": int32(0)}),
+	}, res.Modified)
+
+	// ordered
+	res, err = txn.Insert(handle, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": int32(7), "n": int32(7)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(8), "n": int32(7)}),
+		bsonkit.MustConvert(bson.M{"_id": int32(9), "n": int32(9)}),
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `duplicate document for index "n"`, res.Error.Error())
+	assert.Equal(t, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": int32(7), "n": int32(7)}),
+	}, res.Modified)
+
+	namespace := txn.Catalog().Namespaces[handle]
+	assert.Len(t, namespace.Documents.List, 5)
+	assert.Len(t, namespace.Indexes["n"].List(), 3)
+	assert.Len(t, namespace.Indexes["_id_"].List(), 5)
+	assert.Len(t, txn.Catalog().Namespaces[Oplog].Documents.List, 5)
+}
+
+func TestTransactionContext(t *testing.T) {
+	txn := NewTransaction(NewCatalog())
+
+	list := make(bsonkit.List, 0, 2500)
+	for i := 0; i < 2500; i++ {
+		list = append(list, bsonkit.MustConvert(bson.M{
+			"_id": i,
+		}))
+	}
+
+	_, err := txn.Insert(Handle{"foo", "bar"}, list, true)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	txn.SetContext(ctx)
+
+	_, err = txn.Find(Handle{"foo", "bar"}, bsonkit.MustConvert(bson.M{}), nil, 0, 0)
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = txn.Find(Handle{"foo", "bar"}, bsonkit.MustConvert(bson.M{}), bsonkit.MustConvert(bson.M{
+		"_id": -1,
+	}), 0, 0)
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = txn.Delete(Handle{"foo", "bar"}, bsonkit.MustConvert(bson.M{}), nil, 0, 0)
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = txn.CreateIndex(Handle{"foo", "bar"}, "", mongokit.IndexConfig{
+		Key: bsonkit.MustConvert(bson.M{"foo": 1}),
+	})
+	assert.Equal(t, context.Canceled, err)
+
+	txn.SetContext(nil)
+
+	res, err := txn.Find(Handle{"foo", "bar"}, bsonkit.MustConvert(bson.M{}), nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res.Matched, 2500)
+}
+
+func TestTransactionSavepoint(t *testing.T) {
+	txn := NewTransaction(NewCatalog())
+
+	_, err := txn.Insert(Handle{"foo", "bar"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 1}),
+	}, true)
+	assert.NoError(t, err)
+
+	sp := txn.Savepoint()
+
+	_, err = txn.Insert(Handle{"foo", "bar"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 2}),
+	}, true)
+	assert.NoError(t, err)
+
+	_, err = txn.Insert(Handle{"foo", "baz"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 3}),
+	}, true)
+	assert.NoError(t, err)
+
+	assert.Len(t, txn.Catalog().Namespaces[Handle{"foo", "bar"}].Documents.List, 2)
+	assert.Len(t, txn.Catalog().Namespaces[Oplog].Documents.List, 3)
+
+	err = txn.RollbackTo(sp)
+	assert.NoError(t, err)
+	assert.True(t, txn.Dirty())
+	assert.Len(t, txn.Catalog().Namespaces[Handle{"foo", "bar"}].Documents.List, 1)
+	assert.Nil(t, txn.Catalog().Namespaces[Handle{"foo", "baz"}])
+	assert.Len(t, txn.Catalog().Namespaces[Oplog].Documents.List, 1)
+
+	empty := NewTransaction(NewCatalog())
+	sp = empty.Savepoint()
+
+	_, err = empty.Insert(Handle{"foo", "bar"}, bsonkit.List{
+		bsonkit.MustConvert(bson.M{"_id": 1}),
+	}, true)
+	assert.NoError(t, err)
+	assert.True(t, empty.Dirty())
+
+	err = empty.RollbackTo(sp)
+	assert.NoError(t, err)
+	assert.False(t, empty.Dirty())
+
+	err = txn.RollbackTo(sp)
+	assert.Error(t, err)
+}
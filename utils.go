@@ -2,10 +2,43 @@ package lungo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
 )
 
+// ErrMaxTimeExpired is returned if an operation exceeds the time limit set
+// using the MaxTime option. Like the error returned by MongoDB it has the code
+// 50 and is detected by mongo.IsTimeout.
+var ErrMaxTimeExpired = mongo.CommandError{
+	Code:    50,
+	Name:    "MaxTimeMSExpired",
+	Message: "operation exceeded time limit",
+}
+
+// ErrUnsupportedOption is returned by strict engines if an operation is called
+// with an option that is not supported by lungo.
+type ErrUnsupportedOption struct {
+	// The operation e.g. "Collection.Find".
+	Operation string
+
+	// The name of the option e.g. "Collation".
+	Option string
+}
+
+// Error implements the error interface.
+func (e ErrUnsupportedOption) Error() string {
+	return fmt.Sprintf("lungo: unsupported option %s for %s", e.Option, e.Operation)
+}
+
 const (
 	supported = "supported"
 	ignored   = "ignored"
@@ -20,7 +53,54 @@ func ensureContext(ctx context.Context) context.Context {
 	return context.Background()
 }
 
-func assertOptions(opts interface{}, fields map[string]string) {
+type maxTimeKey struct{}
+
+func withMaxTime(ctx context.Context, maxTime *time.Duration) (context.Context, context.CancelFunc) {
+	// ensure context
+	ctx = ensureContext(ctx)
+
+	// check max time
+	if maxTime == nil || *maxTime <= 0 {
+		return ctx, func() {}
+	}
+
+	// derive context with deadline
+	deadline := time.Now().Add(*maxTime)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	ctx = context.WithValue(ctx, maxTimeKey{}, deadline)
+
+	return ctx, cancel
+}
+
+func contextError(ctx context.Context, err error) error {
+	// check if the operation has been killed
+	if errors.Is(err, context.Canceled) && context.Cause(ctx) == errKilled {
+		return ErrInterrupted
+	}
+
+	// get deadline
+	deadline, ok := ctx.Value(maxTimeKey{}).(time.Time)
+	if !ok || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	// check if the max time deadline has been reached before the deadline of
+	// the parent context
+	actual, _ := ctx.Deadline()
+	if !actual.Equal(deadline) {
+		return err
+	}
+
+	return ErrMaxTimeExpired
+}
+
+func assertOptions(engine *Engine, operation string, opts interface{}, fields map[string]string) error {
+	// get strictness
+	strictness := Strict
+	if engine != nil {
+		strictness = engine.opts.Strictness
+	}
+
 	// get value
 	value := reflect.ValueOf(opts).Elem()
 
@@ -31,15 +111,32 @@ func assertOptions(opts interface{}, fields map[string]string) {
 
 		// check if field is supported
 		support := fields[name]
-		if support == supported || support == ignored {
+		if support == supported {
 			continue
 		}
 
-		// otherwise, assert field is nil
-		if !value.Field(i).IsNil() {
-			panic(fmt.Sprintf("lungo: unsupported option: %s", name))
+		// skip unset fields
+		if value.Field(i).IsZero() {
+			continue
+		}
+
+		// check if field is ignored
+		if support == ignored {
+			engine.log(LogDebug, "ignoring option", "operation", operation, "option", name)
+			continue
+		}
+
+		// handle unsupported field
+		switch strictness {
+		case Lenient:
+			engine.log(LogWarn, "ignoring unsupported option", "operation", operation, "option", name)
+		case Silent:
+		default:
+			return ErrUnsupportedOption{Operation: operation, Option: name}
 		}
 	}
+
+	return nil
 }
 
 func useTransaction(ctx context.Context, engine *Engine, lock bool, fn func(*Transaction) (interface{}, error)) (interface{}, error) {
@@ -51,6 +148,8 @@ func useTransaction(ctx context.Context, engine *Engine, lock bool, fn func(*Tra
 	if ok {
 		txn := sess.Transaction()
 		if txn != nil {
+			txn.SetContext(ctx)
+			defer txn.SetContext(nil)
 			return fn(txn)
 		}
 	}
@@ -83,3 +182,84 @@ func useTransaction(ctx context.Context, engine *Engine, lock bool, fn func(*Tra
 
 	return res, nil
 }
+
+func transformLet(registry *bsoncodec.Registry, let interface{}) (map[string]interface{}, error) {
+	// check let
+	if let == nil {
+		return nil, nil
+	}
+
+	// transform let
+	doc, err := bsonkit.TransformWithRegistry(registry, let)
+	if err != nil {
+		return nil, err
+	}
+
+	return mongokit.EvaluateVariables(doc)
+}
+
+func bindLet(registry *bsoncodec.Registry, query bsonkit.Doc, let interface{}) (bsonkit.Doc, error) {
+	// get variables
+	variables, err := transformLet(registry, let)
+	if err != nil {
+		return nil, err
+	}
+
+	return mongokit.BindVariables(query, variables), nil
+}
+
+func insertErrors(documents []interface{}, errs []error) error {
+	// collect write errors
+	var writeErrors []mongo.BulkWriteError
+	for i, err := range errs {
+		if err != nil {
+			writeErrors = append(writeErrors, writeError(i, err, mongo.NewInsertOneModel().SetDocument(documents[i])))
+		}
+	}
+
+	return mongo.BulkWriteException{
+		WriteErrors: writeErrors,
+	}
+}
+
+func tiebreakSort(engine *Engine, sort bsonkit.Doc) bsonkit.Doc {
+	// check option and sort
+	if !engine.opts.SortTiebreaker || sort == nil || len(*sort) == 0 {
+		return sort
+	}
+
+	// check fields
+	for _, field := range *sort {
+		if field.Key == "_id" || field.Key == "$natural" {
+			return sort
+		}
+	}
+
+	// append id
+	doc := make(bson.D, 0, len(*sort)+1)
+	doc = append(doc, *sort...)
+	doc = append(doc, bson.E{Key: "_id", Value: int32(1)})
+
+	return &doc
+}
+
+func naturalHint(registry *bsoncodec.Registry, hint interface{}) (bsonkit.Doc, error) {
+	// ignore index name hints
+	if _, ok := hint.(string); ok || hint == nil {
+		return nil, nil
+	}
+
+	// transform hint
+	doc, err := bsonkit.TransformWithRegistry(registry, hint)
+	if err != nil {
+		return nil, err
+	}
+
+	// check natural order
+	natural, err := mongokit.NaturalOrder(doc)
+	if err != nil || natural == 0 {
+		return nil, err
+	}
+
+	return doc, nil
+}
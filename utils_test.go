@@ -12,6 +12,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -52,6 +54,34 @@ func init() {
 	testLungoEngine = lungoEngine
 }
 
+type testDate struct {
+	Year, Month, Day int
+}
+
+var testDateType = reflect.TypeOf(testDate{})
+
+func testRegistry() *bsoncodec.Registry {
+	return bson.NewRegistryBuilder().
+		RegisterTypeEncoder(testDateType, bsoncodec.ValueEncoderFunc(func(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+			date := val.Interface().(testDate)
+			return vw.WriteString(fmt.Sprintf("%04d-%02d-%02d", date.Year, date.Month, date.Day))
+		})).
+		RegisterTypeDecoder(testDateType, bsoncodec.ValueDecoderFunc(func(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+			str, err := vr.ReadString()
+			if err != nil {
+				return err
+			}
+			var date testDate
+			_, err = fmt.Sscanf(str, "%04d-%02d-%02d", &date.Year, &date.Month, &date.Day)
+			if err != nil {
+				return err
+			}
+			val.Set(reflect.ValueOf(date))
+			return nil
+		})).
+		Build()
+}
+
 func clientTest(t *testing.T, fn func(t *testing.T, c IClient)) {
 	t.Run("Mongo", func(t *testing.T) {
 		fn(t, testMongoClient)
@@ -0,0 +1,65 @@
+package lungo
+
+import (
+	"fmt"
+	"sort"
+)
+
+func (e *Engine) verifyCatalog(catalog *Catalog, repair bool) (*Catalog, error) {
+	// sort handles
+	handles := make([]Handle, 0, len(catalog.Namespaces))
+	for handle := range catalog.Namespaces {
+		handles = append(handles, handle)
+	}
+	sort.Slice(handles, func(i, j int) bool {
+		return handles[i].String() < handles[j].String()
+	})
+
+	// verify namespaces
+	var clone *Catalog
+	for _, handle := range handles {
+		// skip cold namespaces
+		namespace := catalog.Namespaces[handle]
+		if e.lazy != nil && e.lazy.Cold(namespace) {
+			continue
+		}
+
+		// validate namespace
+		validation := namespace.Validate()
+		if len(validation.Errors) == 0 {
+			continue
+		}
+
+		// check repair
+		if !repair {
+			return nil, fmt.Errorf("inconsistent namespace %q: %s", handle.String(), validation.Errors[0])
+		}
+
+		// rebuild namespace
+		rebuilt, err := namespace.Rebuild()
+		if err != nil {
+			return nil, fmt.Errorf("failed to repair namespace %q: %w", handle.String(), err)
+		}
+
+		// validate again
+		if errs := rebuilt.Validate().Errors; len(errs) > 0 {
+			return nil, fmt.Errorf("failed to repair namespace %q: %s", handle.String(), errs[0])
+		}
+
+		// set namespace on cloned catalog as loaded catalogs may be shared
+		if clone == nil {
+			clone = catalog.Clone()
+		}
+		clone.Namespaces[handle] = rebuilt
+
+		// log repair
+		e.log(LogWarn, "repaired namespace", "ns", handle.String(), "errors", len(validation.Errors), "error", validation.Errors[0])
+	}
+
+	// use clone if repaired
+	if clone != nil {
+		return clone, nil
+	}
+
+	return catalog, nil
+}
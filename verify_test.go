@@ -0,0 +1,91 @@
+package lungo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestEngineVerifyOnLoad(t *testing.T) {
+	store := NewMemoryStore()
+
+	client, engine, err := Open(nil, Options{
+		Store: store,
+	})
+	assert.NoError(t, err)
+
+	coll := client.Database("foo").Collection("bar")
+	_, err = coll.InsertMany(nil, []interface{}{
+		bson.M{"_id": 1, "n": 1},
+		bson.M{"_id": 2, "n": 2},
+	})
+	assert.NoError(t, err)
+
+	_, err = coll.Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys:    bson.M{"n": 1},
+		Options: options.Index().SetName("n"),
+	})
+	assert.NoError(t, err)
+
+	engine.Close()
+
+	// consistent
+	engine, err = CreateEngine(Options{
+		Store:        store,
+		VerifyOnLoad: true,
+	})
+	assert.NoError(t, err)
+	engine.Close()
+
+	// corrupt index
+	catalog, err := store.Load()
+	assert.NoError(t, err)
+	namespace := catalog.Namespaces[Handle{"foo", "bar"}]
+	ok, err := namespace.Indexes["n"].Remove(namespace.Documents.List[1])
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// not verified
+	engine, err = CreateEngine(Options{
+		Store: store,
+	})
+	assert.NoError(t, err)
+	engine.Close()
+
+	// verified
+	engine, err = CreateEngine(Options{
+		Store:        store,
+		VerifyOnLoad: true,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `inconsistent namespace "foo.bar": index "n" is missing entry for _id 2`, err.Error())
+	assert.Nil(t, engine)
+
+	// repaired
+	logger := &testLogger{}
+	client, engine, err = Open(nil, Options{
+		Store:        store,
+		VerifyOnLoad: true,
+		RepairOnLoad: true,
+		Logger:       logger,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+	assert.Equal(t, []string{
+		`warn: repaired namespace ns=foo.bar errors=1 error=index "n" is missing entry for _id 2`,
+	}, logger.list())
+
+	var res bson.M
+	err = client.Database("foo").RunCommand(nil, bson.D{
+		{Key: "validate", Value: "bar"},
+	}).Decode(&res)
+	assert.NoError(t, err)
+	assert.Equal(t, true, res["valid"])
+
+	// stored catalog is unchanged until the next commit
+	assert.Equal(t, 1, namespace.Indexes["n"].Len())
+	assert.Equal(t, 2, engine.Catalog().Namespaces[Handle{"foo", "bar"}].Indexes["n"].Len())
+}
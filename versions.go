@@ -0,0 +1,229 @@
+package lungo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
+)
+
+// Versions is the handle for the local versions namespace. If enabled, it
+// contains a document for every written document in the form:
+//
+//	{ _id: { db, coll, id }, ts: <timestamp>, deleted: <bool> }
+var Versions = Handle{Local, "versions"}
+
+// Merge will reconcile the documents of the source engine into the target
+// engine using last-write-wins semantics. Both engines must track versions.
+// Every document that has a newer version in the source than in the target is
+// written to or deleted from the target, keeping the version of the source.
+// Merging in both directions converges two diverged datasets. Drops of
+// namespaces and index changes are not merged. The function returns the number
+// of applied changes.
+func Merge(ctx context.Context, target, source *Engine) (int, error) {
+	// check engines
+	if !target.opts.TrackVersions || !source.opts.TrackVersions {
+		return 0, fmt.Errorf("engines must track versions")
+	}
+
+	// get snapshot
+	snapshot, err := source.Begin(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+
+	// get catalog
+	catalog := snapshot.Catalog()
+
+	// check versions
+	sourceVersions := catalog.Namespaces[Versions]
+	if sourceVersions == nil {
+		return 0, nil
+	}
+
+	// begin transaction
+	txn, err := target.Begin(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+
+	// ensure abortion
+	defer target.Abort(txn)
+
+	// versions are kept from the source
+	txn.untracked = true
+
+	// apply newer versions
+	var versions bsonkit.List
+	for _, version := range sourceVersions.Documents.List {
+		// get details
+		key := bsonkit.Get(version, "_id").(bson.D)
+		ts := bsonkit.Get(version, "ts")
+		deleted, _ := bsonkit.Get(version, "deleted").(bool)
+
+		// get target version
+		targetVersion, err := findVersion(txn.ctx, txn.catalog.Namespaces[Versions], key)
+		if err != nil {
+			return 0, err
+		}
+
+		// skip if not newer
+		if targetVersion != nil && bsonkit.Compare(ts, bsonkit.Get(targetVersion, "ts")) <= 0 {
+			continue
+		}
+
+		// prepare handle and query
+		handle := Handle{bsonkit.Get(&key, "db").(string), bsonkit.Get(&key, "coll").(string)}
+		query := bsonkit.MustConvert(bson.M{"_id": bsonkit.Get(&key, "id")})
+
+		// delete document
+		if deleted {
+			_, err = txn.Delete(handle, query, nil, 0, 0)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// write document
+		if !deleted {
+			// get document
+			err = snapshot.Load(handle)
+			if err != nil {
+				return 0, err
+			}
+			namespace := snapshot.Catalog().Namespaces[handle]
+			if namespace == nil {
+				continue
+			}
+			res, err := namespace.Find(txn.ctx, query, nil, 0, 1)
+			if err != nil {
+				return 0, err
+			} else if len(res.Matched) == 0 {
+				continue
+			}
+
+			// upsert document
+			_, err = txn.Replace(handle, query, nil, bsonkit.Clone(res.Matched[0]), true)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// add version
+		versions = append(versions, newVersion(key, ts, deleted))
+	}
+
+	// put versions
+	err = txn.putVersions(versions)
+	if err != nil {
+		return 0, err
+	}
+
+	// commit transaction
+	err = target.Commit(txn)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(versions), nil
+}
+
+func (t *Transaction) trackVersions() error {
+	// skip if untracked
+	if t.untracked {
+		return nil
+	}
+
+	// get new events
+	events := newEvents(t.base.Namespaces[Oplog], t.catalog.Namespaces[Oplog])
+
+	// collect versions
+	var list bsonkit.List
+	for _, event := range events {
+		// get document key
+		id := bsonkit.Get(event, "documentKey._id")
+		if id == bsonkit.Missing {
+			continue
+		}
+
+		// add version
+		list = append(list, newVersion(bson.D{
+			bson.E{Key: "db", Value: bsonkit.Get(event, "ns.db")},
+			bson.E{Key: "coll", Value: bsonkit.Get(event, "ns.coll")},
+			bson.E{Key: "id", Value: id},
+		}, bsonkit.Get(event, "clusterTime"), bsonkit.Get(event, "operationType") == "delete"))
+	}
+
+	return t.putVersions(list)
+}
+
+func (t *Transaction) putVersions(list bsonkit.List) error {
+	// acquire write lock
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// check list
+	if len(list) == 0 {
+		return nil
+	}
+
+	// clone catalog
+	clone := t.catalog.Clone()
+
+	// clone or create versions
+	versions := mongokit.NewCollection(true)
+	if clone.Namespaces[Versions] != nil {
+		versions = clone.Namespaces[Versions].Clone()
+	}
+	clone.Namespaces[Versions] = versions
+
+	// put versions
+	for _, version := range list {
+		// remove existing version
+		query := bsonkit.MustConvert(bson.M{"_id": bsonkit.Get(version, "_id")})
+		_, err := versions.Delete(t.ctx, query, nil, 0, 1)
+		if err != nil {
+			return err
+		}
+
+		// add version
+		_, err = versions.Insert(version)
+		if err != nil {
+			return err
+		}
+	}
+
+	// set catalog and flag
+	t.catalog = clone
+	t.dirty = true
+
+	return nil
+}
+
+func newVersion(key bson.D, ts interface{}, deleted bool) bsonkit.Doc {
+	return &bson.D{
+		bson.E{Key: "_id", Value: key},
+		bson.E{Key: "ts", Value: ts},
+		bson.E{Key: "deleted", Value: deleted},
+	}
+}
+
+func findVersion(ctx context.Context, versions *mongokit.Collection, key bson.D) (bsonkit.Doc, error) {
+	// check versions
+	if versions == nil {
+		return nil, nil
+	}
+
+	// find version
+	res, err := versions.Find(ctx, bsonkit.MustConvert(bson.M{"_id": key}), nil, 0, 1)
+	if err != nil {
+		return nil, err
+	} else if len(res.Matched) == 0 {
+		return nil, nil
+	}
+
+	return res.Matched[0], nil
+}
@@ -0,0 +1,132 @@
+package lungo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMerge(t *testing.T) {
+	client1, engine1, err := Open(nil, Options{
+		Store:         NewMemoryStore(),
+		TrackVersions: true,
+	})
+	assert.NoError(t, err)
+	defer engine1.Close()
+
+	client2, engine2, err := Open(nil, Options{
+		Store:         NewMemoryStore(),
+		TrackVersions: true,
+	})
+	assert.NoError(t, err)
+	defer engine2.Close()
+
+	coll1 := client1.Database("foo").Collection("bar")
+	coll2 := client2.Database("foo").Collection("bar")
+
+	_, err = coll1.InsertMany(nil, []interface{}{
+		bson.M{"_id": "a", "n": 1},
+		bson.M{"_id": "b", "n": 1},
+		bson.M{"_id": "c", "n": 1},
+	})
+	assert.NoError(t, err)
+
+	versions := dumpCollection(client1.Database("local").Collection("versions"), false)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, bson.M{"db": "foo", "coll": "bar", "id": "a"}, versions[0]["_id"])
+	assert.Equal(t, false, versions[0]["deleted"])
+	assert.NotZero(t, versions[0]["ts"])
+
+	n, err := Merge(nil, engine2, engine1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, dumpCollection(coll1, false), dumpCollection(coll2, false))
+
+	n, err = Merge(nil, engine1, engine2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	/* diverge */
+
+	_, err = coll1.UpdateOne(nil, bson.M{"_id": "a"}, bson.M{"$set": bson.M{"n": 2}})
+	assert.NoError(t, err)
+
+	_, err = coll2.DeleteOne(nil, bson.M{"_id": "b"})
+	assert.NoError(t, err)
+
+	_, err = coll2.InsertOne(nil, bson.M{"_id": "d", "n": 2})
+	assert.NoError(t, err)
+
+	_, err = coll2.UpdateOne(nil, bson.M{"_id": "c"}, bson.M{"$set": bson.M{"n": 2}})
+	assert.NoError(t, err)
+
+	_, err = coll1.UpdateOne(nil, bson.M{"_id": "c"}, bson.M{"$set": bson.M{"n": 3}})
+	assert.NoError(t, err)
+
+	n, err = Merge(nil, engine1, engine2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = Merge(nil, engine2, engine1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, []bson.M{
+		{"_id": "a", "n": int32(2)},
+		{"_id": "c", "n": int32(3)},
+		{"_id": "d", "n": int32(2)},
+	}, dumpCollection(coll1, false))
+	assert.Equal(t, dumpCollection(coll1, false), dumpCollection(coll2, false))
+
+	n, err = Merge(nil, engine1, engine2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, engine3, err := Open(nil, Options{
+		Store: NewMemoryStore(),
+	})
+	assert.NoError(t, err)
+	defer engine3.Close()
+
+	_, err = Merge(nil, engine3, engine1)
+	assert.Error(t, err)
+}
+
+func TestTrackVersionsCompact(t *testing.T) {
+	client, engine, err := Open(nil, Options{
+		Store:         NewMemoryStore(),
+		TrackVersions: true,
+		MinOplogSize:  1,
+		MaxOplogSize:  2,
+		MinOplogAge:   time.Nanosecond,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	coll := client.Database("foo").Collection("bar")
+
+	_, err = coll.InsertMany(nil, []interface{}{
+		bson.M{"_id": "a"},
+		bson.M{"_id": "b"},
+		bson.M{"_id": "c"},
+		bson.M{"_id": "d"},
+		bson.M{"_id": "e"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, engine.Catalog().Namespaces[Oplog].Documents.List, 5)
+
+	time.Sleep(time.Second)
+
+	err = engine.Compact()
+	assert.NoError(t, err)
+	assert.Len(t, engine.Catalog().Namespaces[Oplog].Documents.List, 2)
+
+	_, err = coll.InsertOne(nil, bson.M{"_id": "f"})
+	assert.NoError(t, err)
+
+	versions := dumpCollection(client.Database("local").Collection("versions"), false)
+	assert.Len(t, versions, 6)
+	assert.Equal(t, bson.M{"db": "foo", "coll": "bar", "id": "f"}, versions[5]["_id"])
+}